@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/scheduler"
+)
+
+// executorOptions selects and configures the executor of a command
+type executorOptions struct {
+	Backend   string
+	Org       string
+	RecordDir string // Save every execution here for later replay
+	ReplayDir string // Replay saved executions instead of running them
+	APIFloor  int    // Minimum remaining daily API requests; 0 disables the check
+}
+
+// newExecutor creates an executor for the selected backend and returns it
+// with the org to run against. It checks the backend's CLI and, for
+// backends that run against an org, resolves the org: credentials in the
+// environment are logged in under opts.Org (or a default alias), otherwise
+// the org falls back to the default org. A given org must be authenticated
+// in the CLI. A ReplayDir selects the replay backend.
+func (g *globalOptions) newExecutor(opts executorOptions) (executor.Executor, string, error) {
+	backend := opts.Backend
+	if opts.ReplayDir != "" {
+		if backend != "" && backend != executor.DefaultBackend && backend != "replay" {
+			return nil, "", fmt.Errorf("--replay cannot be combined with --backend %s", backend)
+		}
+		backend = "replay"
+	}
+
+	b, err := executor.LookupBackend(backend)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Check the backend's CLI and warn about unsupported versions
+	if b.Check != nil {
+		if err := b.Check(); err != nil {
+			return nil, "", err
+		}
+		if b.Name != "sfdx" && executor.UsingLegacyCLI() {
+			g.progressf("sf CLI not found, using sfdx\n")
+		}
+		if v, ok := executor.DetectedCLIVersion(); ok && v.Warning() != "" {
+			g.warnf("%s", v.Warning())
+		}
+	}
+
+	g.verbosef("Backend: %s\n", b.Name)
+
+	if g.tempDir != "" {
+		if err := os.MkdirAll(g.tempDir, 0o755); err != nil {
+			return nil, "", fmt.Errorf("failed to create --temp-dir: %w", err)
+		}
+	}
+
+	org := opts.Org
+	if b.RequiresOrg {
+		// Headless jobs may provide credentials in the environment
+		alias, source, err := executor.LoginFromEnv(org, g.tempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		if alias != "" {
+			g.progressf("Authenticated org %s from %s\n", alias, source)
+			org = alias
+		} else if org != "" {
+			// Catch typos before the first execution; the org list is only
+			// advisory, so failing to get it is not an error
+			orgs, err := executor.ListOrgs()
+			if err != nil {
+				g.verbosef("Skipping org check: %v\n", err)
+			} else if err := executor.ValidateOrg(org, orgs); err != nil {
+				return nil, "", err
+			}
+		}
+
+		// Get org
+		resolved, err := executor.GetOrg(org)
+		if err != nil {
+			return nil, "", err
+		}
+		if org == "" {
+			g.progressf("Using default org: %s\n", resolved)
+		}
+		org = resolved
+	}
+
+	exec, err := b.New(executor.Options{ReplayDir: opts.ReplayDir, TempDir: g.tempDir, KeepTemp: g.keepTemp})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, ok := exec.(*executor.CLIExecutor); ok && g.keepTemp {
+		dir := g.tempDir
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		g.progressf("Keeping generated Apex scripts in %s\n", dir)
+	}
+	if opts.RecordDir != "" {
+		recorder, err := executor.NewRecordingExecutor(exec, opts.RecordDir)
+		if err != nil {
+			return nil, "", err
+		}
+		recorder.Redactor = g.redactor
+		exec = recorder
+		g.progressf("Recording executions to %s\n", opts.RecordDir)
+	}
+	if opts.APIFloor > 0 && b.RequiresOrg {
+		exec = executor.NewBudgetExecutor(exec, org, opts.APIFloor)
+	}
+
+	// Executions of the whole process share the scheduler; a limit given
+	// for the org's alias also applies to the username it resolves to
+	scheduler.Default.SetCapacity(g.maxExecs)
+	scheduler.Default.Warnf = func(format string, args ...any) {
+		g.logf(slog.LevelWarn, "  Warning: ", format+"\n", args...)
+	}
+	limits, err := parseOrgLimits(g.orgLimits)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, name := range []string{opts.Org, org} {
+		if limit, ok := limits[name]; ok && name != "" {
+			scheduler.Default.SetOrgLimit(org, limit)
+			g.verbosef("Limiting concurrent executions against %s to %d\n", org, limit)
+			break
+		}
+	}
+
+	return exec, org, nil
+}
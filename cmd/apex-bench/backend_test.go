@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestNewExecutor_MockBackendNeedsNoOrg(t *testing.T) {
+	g := &globalOptions{}
+	exec, org, err := g.newExecutor(executorOptions{Backend: "mock"})
+	if err != nil {
+		t.Fatalf("Expected mock backend without sf CLI, got error: %v", err)
+	}
+	if _, ok := exec.(*executor.SimulatedExecutor); !ok {
+		t.Errorf("Expected *executor.SimulatedExecutor, got %T", exec)
+	}
+	if org != "" {
+		t.Errorf("Expected org to stay empty, got %q", org)
+	}
+}
+
+func TestNewExecutor_UnknownBackend(t *testing.T) {
+	g := &globalOptions{}
+	_, _, err := g.newExecutor(executorOptions{Backend: "nope", Org: "test-org"})
+	if err == nil || !strings.Contains(err.Error(), "unknown backend") {
+		t.Errorf("Expected unknown backend error, got: %v", err)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_SimulatedBackend(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := filepath.Join(t.TempDir(), "results.json")
+
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{
+			{Name: "First", Code: "Integer a = 1;"},
+			{Name: "Second", Code: "Integer b = 2;"},
+		},
+		Iterations: 10,
+		Runs:       3,
+		Parallel:   2,
+		Combine:    true,
+		Out:        path,
+		Output:     "json",
+	}
+	if err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config); err != nil {
+		t.Fatalf("Expected simulated comparison to succeed, got: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	if !strings.Contains(string(content), `"name": "Second"`) || !strings.Contains(string(content), `"runs": 3`) {
+		t.Errorf("Expected aggregated simulated results, got: %s", content)
+	}
+}
+
+func TestNewExecutor_ReplayConflictsWithBackend(t *testing.T) {
+	g := &globalOptions{}
+	_, _, err := g.newExecutor(executorOptions{Backend: "mock", ReplayDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "--replay") {
+		t.Errorf("Expected --replay conflict error, got: %v", err)
+	}
+}
+
+func TestNewExecutor_RecordWrapsBackend(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	exec, _, err := g.newExecutor(executorOptions{Backend: "mock", RecordDir: t.TempDir(), APIFloor: 100})
+	if err != nil {
+		t.Fatalf("Expected recording executor, got error: %v", err)
+	}
+	if _, ok := exec.(*executor.RecordingExecutor); !ok {
+		t.Errorf("Expected *executor.RecordingExecutor, got %T", exec)
+	}
+}
+
+func TestNewExecutor_TempDir(t *testing.T) {
+	g := &globalOptions{}
+	installFakeSF(t)
+	t.Setenv(executor.EnvAuthURL, "")
+	t.Setenv(executor.EnvJWTKeyFile, "")
+	var stderrBuf bytes.Buffer
+	g.errOut = &stderrBuf
+	dir := filepath.Join(t.TempDir(), "scripts")
+	g.tempDir, g.keepTemp = dir, true
+
+	exec, org, err := g.newExecutor(executorOptions{Backend: "sf-cli", Org: "test-org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.Run(context.Background(), executor.ExecRequest{Code: "Integer i = 1;", Org: org}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".apex") {
+		t.Errorf("Expected the script kept in the created --temp-dir, got %v (%v)", entries, err)
+	}
+	if !strings.Contains(stderrBuf.String(), "Keeping generated Apex scripts in "+dir) {
+		t.Errorf("Expected the kept scripts to be announced, got:\n%s", stderrBuf.String())
+	}
+}
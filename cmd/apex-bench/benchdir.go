@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/config"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// sidecar is the metadata of a benchmark file, read from a .yaml or .json
+// file next to it with the same base name
+type sidecar struct {
+	Name      string           `yaml:"name"`
+	Setup     string           `yaml:"setup"`
+	Teardown  string           `yaml:"teardown"`
+	Tags      []string         `yaml:"tags"`
+	Units     float64          `yaml:"units"`
+	Threshold *types.Threshold `yaml:"threshold"`
+}
+
+// isBenchmarkDir reports whether path names a directory of benchmark files:
+// a directory, or one followed by /... to include its subdirectories
+func isBenchmarkDir(path string) bool {
+	dir, _ := splitRecursive(path)
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// splitRecursive strips a trailing /... from path and reports whether it
+// was there
+func splitRecursive(path string) (string, bool) {
+	if dir, ok := strings.CutSuffix(filepath.ToSlash(path), "/..."); ok {
+		if dir == "" {
+			dir = "/"
+		}
+		return filepath.FromSlash(dir), true
+	}
+	return path, false
+}
+
+// loadBenchmarkDir builds a suite from the .apex files in a directory, and
+// in its subdirectories when path ends in /..., in lexical order. Each file
+// is a benchmark named after its path within the directory, without the
+// extension; a sidecar <name>.yaml or <name>.json next to it may set the
+// name, setup, teardown, tags, units and a threshold. Settings keep the
+// defaults of the compare command.
+func loadBenchmarkDir(path string) (types.BenchmarkConfig, error) {
+	dir, recursive := splitRecursive(path)
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(p) == ".apex" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("failed to read benchmark directory: %w", err)
+	}
+	if len(files) == 0 {
+		if recursive {
+			return types.BenchmarkConfig{}, fmt.Errorf("no .apex files in %s or its subdirectories", dir)
+		}
+		return types.BenchmarkConfig{}, fmt.Errorf("no .apex files in %s (end it with /... to include subdirectories)", dir)
+	}
+	sort.Strings(files)
+
+	config := suiteDefaults()
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return types.BenchmarkConfig{}, err
+		}
+		spec := types.BenchmarkSpec{
+			Name: filepath.ToSlash(strings.TrimSuffix(rel, ".apex")),
+			File: file,
+		}
+		meta, err := loadSidecar(strings.TrimSuffix(file, ".apex"))
+		if err != nil {
+			return types.BenchmarkConfig{}, err
+		}
+		if meta.Name != "" {
+			spec.Name = meta.Name
+		}
+		spec.Setup, spec.Teardown = meta.Setup, meta.Teardown
+		spec.Tags, spec.Units = meta.Tags, meta.Units
+		if meta.Threshold != nil {
+			if config.Thresholds == nil {
+				config.Thresholds = make(map[string]types.Threshold)
+			}
+			config.Thresholds[spec.Name] = *meta.Threshold
+		}
+		config.Benchmarks = append(config.Benchmarks, spec)
+	}
+	if err := orchestrator.ValidateUniqueNames(config.Benchmarks); err != nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("%s: %w", dir, err)
+	}
+	return config, nil
+}
+
+// loadSidecar reads the sidecar of the benchmark file with base path base,
+// from base.yaml, base.yml or base.json; a missing sidecar is empty
+func loadSidecar(base string) (sidecar, error) {
+	var meta sidecar
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		err := config.Load(base+ext, &meta)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return meta, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// writeBenchmarkDir creates a directory of benchmark files
+func writeBenchmarkDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadBenchmarkDir(t *testing.T) {
+	dir := writeBenchmarkDir(t, map[string]string{
+		"map.apex":         "Boolean found = byValue.get(1) != null;",
+		"map.yaml":         "name: Map.get\nsetup: \"Map<Integer, Integer> byValue = new Map<Integer, Integer>{1 => 1};\"\ntags: [lookup]\nthreshold:\n  maxCpuMs: 5\n",
+		"list.apex":        "Boolean found = values.contains(1);",
+		"notes.txt":        "not a benchmark",
+		"string/join.apex": "String s = String.join(new List<String>{'a'}, ',');",
+		".git/x.apex":      "Integer hidden = 1;",
+	})
+
+	config, err := loadBenchmarkDir(dir)
+	if err != nil {
+		t.Fatalf("loadBenchmarkDir() error = %v", err)
+	}
+	if len(config.Benchmarks) != 2 || config.Benchmarks[0].Name != "list" || config.Benchmarks[1].Name != "Map.get" {
+		t.Fatalf("Expected list and Map.get in file order, got %+v", config.Benchmarks)
+	}
+	m := config.Benchmarks[1]
+	if !strings.Contains(m.Setup, "byValue") || len(m.Tags) != 1 || m.File != filepath.Join(dir, "map.apex") {
+		t.Errorf("Expected the sidecar's metadata, got %+v", m)
+	}
+	if th, ok := config.Thresholds["Map.get"]; !ok || th.MaxCpuMs == nil || *th.MaxCpuMs != 5 {
+		t.Errorf("Expected the sidecar's threshold, got %+v", config.Thresholds)
+	}
+	if config.Iterations != 100 || config.Output != compareDefaultOutput {
+		t.Errorf("Expected suite defaults, got %+v", config)
+	}
+
+	config, err = loadSuite(dir + "/...")
+	if err != nil {
+		t.Fatalf("loadSuite(dir/...) error = %v", err)
+	}
+	var names []string
+	for _, spec := range config.Benchmarks {
+		names = append(names, spec.Name)
+	}
+	if strings.Join(names, ",") != "list,Map.get,string/join" {
+		t.Errorf("Expected subdirectories but not hidden ones, got %v", names)
+	}
+}
+
+func TestLoadBenchmarkDir_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{"no files", map[string]string{"notes.txt": "x"}, "no .apex files"},
+		{"unknown sidecar field", map[string]string{"a.apex": "Integer a;", "a.yaml": "iteratons: 5\n"}, `a.yaml:1:1: unknown key "iteratons"`},
+		{"wrong sidecar type", map[string]string{"a.apex": "Integer a;", "a.json": `{"units": "many"}`}, `a.json:1:11: units: expected a number, got "many"`},
+		{"duplicate names", map[string]string{"a.apex": "Integer a;", "b.apex": "Integer b;", "b.yml": "name: a\n"}, "both named"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeBenchmarkDir(t, tt.files)
+			if _, err := loadBenchmarkDir(dir); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunBenchmark_Dir(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := writeBenchmarkDir(t, map[string]string{"a.apex": "Integer a = 1;", "b.apex": "Integer b = 2;"})
+	out := filepath.Join(t.TempDir(), "out.json")
+	cmd := NewRunCmd(g)
+	setFlags(t, cmd, "backend", "mock", "iterations", "20")
+	g.outputs = []string{"json:" + out}
+	if err := cmd.RunE(cmd, []string{dir}); err != nil {
+		t.Fatalf("run <dir> error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []types.AggregatedResult
+	if err := json.Unmarshal(data, &results); err != nil || len(results) != 2 || results[0].Name != "a" {
+		t.Errorf("Expected results of a and b, got %s (%v)", data, err)
+	}
+
+	withCode := NewRunCmd(g)
+	setFlags(t, withCode, "code", "Integer c = 3;")
+	if err := withCode.RunE(withCode, []string{dir}); err == nil || !strings.Contains(err.Error(), "cannot combine") {
+		t.Errorf("Expected a directory and --code to be exclusive, got %v", err)
+	}
+	if err := cmd.RunE(cmd, []string{filepath.Join(dir, "a.apex")}); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Expected a file argument to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// benchSpecFormat describes the accepted --bench forms in parse errors
+const benchSpecFormat = "expected Name:code, Name:file or a file alone; write Name:code=... or Name:file=... to say which the source is"
+
+// benchSpecError reports a malformed --bench value and where in it the
+// problem is
+type benchSpecError struct {
+	Spec   string
+	Offset int // Byte offset of the problem in Spec
+	Reason string
+}
+
+// Error shows the spec with a caret under the problem
+func (e *benchSpecError) Error() string {
+	column := utf8.RuneCountInString(e.Spec[:e.Offset])
+	return fmt.Sprintf("invalid benchmark %q: %s at column %d\n  %s\n  %s^\n%s",
+		e.Spec, e.Reason, column+1, e.Spec, strings.Repeat(" ", column), benchSpecFormat)
+}
+
+// Keys that say whether the source of a spec is a file or inline code
+const (
+	fileKey = "file="
+	codeKey = "code="
+)
+
+// fenceSpecPattern matches a code fence of a Markdown file in a benchmark
+// spec, e.g. docs/perf.md#2
+var fenceSpecPattern = regexp.MustCompile(`^(.+\.(?i:md|markdown))#([1-9][0-9]*)$`)
+
+// drivePathPattern matches a path starting with a Windows drive letter,
+// whose colon does not end a name
+var drivePathPattern = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// parseBenchSpec parses a --bench value: Name:source, or a file alone,
+// which is named after it. The name may be wrapped in double or single
+// quotes, in which case it can contain colons; a backslash escapes the next
+// character inside quotes. The source is a file when it ends in .apex,
+// names a Markdown code fence or exists, and inline code otherwise; a
+// file= or code= prefix says which explicitly.
+func parseBenchSpec(bench string) (types.BenchmarkSpec, error) {
+	fail := func(offset int, reason string) (types.BenchmarkSpec, error) {
+		return types.BenchmarkSpec{}, &benchSpecError{Spec: bench, Offset: offset, Reason: reason}
+	}
+
+	pos := len(bench) - len(strings.TrimLeft(bench, " \t"))
+	rest := bench[pos:]
+	if strings.TrimSpace(rest) == "" {
+		return fail(pos, "empty benchmark")
+	}
+
+	// A file alone is named after it
+	if spec, ok, err := fileOnlySpec(strings.TrimSpace(rest)); err != nil {
+		return fail(pos, err.Error())
+	} else if ok {
+		return spec, nil
+	}
+
+	var name string
+	if rest[0] == '"' || rest[0] == '\'' {
+		quote := rest[0]
+		var sb strings.Builder
+		closed := false
+		i := 1
+		for ; i < len(rest); i++ {
+			ch := rest[i]
+			if ch == '\\' && i+1 < len(rest) {
+				i++
+				sb.WriteByte(rest[i])
+				continue
+			}
+			if ch == quote {
+				closed = true
+				break
+			}
+			sb.WriteByte(ch)
+		}
+		if !closed {
+			return fail(pos, "unterminated quoted name")
+		}
+		name = sb.String()
+		after := rest[i+1:]
+		pos += i + 1 + len(after) - len(strings.TrimLeft(after, " \t"))
+		rest = strings.TrimLeft(after, " \t")
+		if !strings.HasPrefix(rest, ":") {
+			return fail(pos, "missing ':' after quoted name")
+		}
+		rest = rest[1:]
+		pos++
+	} else {
+		idx := strings.Index(rest, ":")
+		if idx == -1 {
+			return fail(len(bench), "missing ':' between name and code")
+		}
+		name = strings.TrimSpace(rest[:idx])
+		rest = rest[idx+1:]
+		pos += idx + 1
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return fail(pos-1, "name is empty")
+	}
+	pos += len(rest) - len(strings.TrimLeft(rest, " \t"))
+	source := strings.TrimSpace(rest)
+	if source == "" {
+		return fail(pos, "code or file is empty")
+	}
+
+	spec, err := sourceSpec(source)
+	if err != nil {
+		return fail(pos, err.Error())
+	}
+	spec.Name = name
+	return spec, nil
+}
+
+// sourceSpec returns the benchmark of the source part of a spec, unnamed
+func sourceSpec(source string) (types.BenchmarkSpec, error) {
+	if code, ok := strings.CutPrefix(source, codeKey); ok {
+		if strings.TrimSpace(code) == "" {
+			return types.BenchmarkSpec{}, fmt.Errorf("code= is empty")
+		}
+		return types.BenchmarkSpec{Code: strings.TrimSpace(code)}, nil
+	}
+	file, explicit := strings.CutPrefix(source, fileKey)
+	file = strings.TrimSpace(file)
+	if explicit && file == "" {
+		return types.BenchmarkSpec{}, fmt.Errorf("file= has no path")
+	}
+
+	// A Markdown file may pick one of its code fences as file.md#N
+	if m := fenceSpecPattern.FindStringSubmatch(file); m != nil {
+		fence, _ := strconv.Atoi(m[2])
+		return types.BenchmarkSpec{File: m[1], Fence: fence}, nil
+	}
+	if explicit || strings.HasSuffix(file, ".apex") || fileExists(file) {
+		return types.BenchmarkSpec{File: file}, nil
+	}
+	return types.BenchmarkSpec{Code: source}, nil
+}
+
+// fileOnlySpec returns the benchmark of a spec that is only a file: one
+// given with file=, an existing file, or a path ending in .apex or naming a
+// Markdown code fence such as docs/perf.md#2 without a colon other than a
+// drive letter's. It is named by fileBenchName; a pattern is left unnamed,
+// so each matching file is named by expandFileGlobs alone.
+func fileOnlySpec(source string) (types.BenchmarkSpec, bool, error) {
+	path := source
+	if drivePathPattern.MatchString(path) {
+		path = path[2:]
+	}
+	looksLikeFile := strings.HasSuffix(source, ".apex") || fenceSpecPattern.MatchString(source)
+	isFile := strings.HasPrefix(source, fileKey) || fileExists(source) || (looksLikeFile && !strings.Contains(path, ":"))
+	if !isFile {
+		return types.BenchmarkSpec{}, false, nil
+	}
+
+	spec, err := sourceSpec(source)
+	if err != nil {
+		return types.BenchmarkSpec{}, false, err
+	}
+	if !isGlob(spec.File) {
+		spec.Name = fileBenchName(spec.File, spec.Fence)
+	}
+	return spec, true, nil
+}
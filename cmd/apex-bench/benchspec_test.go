@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBenchSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantName  string
+		wantCode  string
+		wantFile  string
+		wantFence int
+		wantErr   string
+	}{
+		{
+			name:     "simple inline code",
+			input:    "Plus:String s = 'a' + 'b';",
+			wantName: "Plus",
+			wantCode: "String s = 'a' + 'b';",
+		},
+		{
+			name:     "apex file",
+			input:    "Format: snippets/format.apex",
+			wantName: "Format",
+			wantFile: "snippets/format.apex",
+		},
+		{
+			name:     "code containing colons",
+			input:    "Map:Map<Id, Account> m = new Map<Id, Account>(); Object o = m.get(null);",
+			wantName: "Map",
+			wantCode: "Map<Id, Account> m = new Map<Id, Account>(); Object o = m.get(null);",
+		},
+		{
+			name:     "double-quoted name with colon",
+			input:    `"Map: keyed by Id":Integer x = 1;`,
+			wantName: "Map: keyed by Id",
+			wantCode: "Integer x = 1;",
+		},
+		{
+			name:     "single-quoted name with space before separator",
+			input:    `'A:B' : Integer x = 1;`,
+			wantName: "A:B",
+			wantCode: "Integer x = 1;",
+		},
+		{
+			name:     "escaped quote inside quoted name",
+			input:    `"Say \"hi\"":Integer x = 1;`,
+			wantName: `Say "hi"`,
+			wantCode: "Integer x = 1;",
+		},
+		{
+			name:      "markdown code fence",
+			input:     "Documented:docs/perf.md#2",
+			wantName:  "Documented",
+			wantFile:  "docs/perf.md",
+			wantFence: 2,
+		},
+		{
+			name:     "apex file without a name",
+			input:    "snippets/string-format.apex",
+			wantName: "string-format",
+			wantFile: "snippets/string-format.apex",
+		},
+		{
+			name:     "file pattern without a name",
+			input:    "benchmarks/*.apex",
+			wantFile: "benchmarks/*.apex",
+		},
+		{
+			name:     "explicit file",
+			input:    "Snippet:file=snippets/bulk",
+			wantName: "Snippet",
+			wantFile: "snippets/bulk",
+		},
+		{
+			name:     "explicit code that looks like a file",
+			input:    "Literal:code=Object o = x.apex",
+			wantName: "Literal",
+			wantCode: "Object o = x.apex",
+		},
+		{
+			name:     "explicit file without a name",
+			input:    "file=snippets/bulk.txt",
+			wantName: "bulk",
+			wantFile: "snippets/bulk.txt",
+		},
+		{
+			name:     "drive letter path",
+			input:    `Format:C:\bench\format.apex`,
+			wantName: "Format",
+			wantFile: `C:\bench\format.apex`,
+		},
+		{
+			name:     "drive letter path without a name",
+			input:    "C:/bench/format.apex",
+			wantName: "format",
+			wantFile: "C:/bench/format.apex",
+		},
+		{
+			name:    "explicit file without a path",
+			input:   "Name:file=",
+			wantErr: "file= has no path",
+		},
+		{
+			name:    "explicit code without code",
+			input:   "Name:code= ",
+			wantErr: "code= is empty",
+		},
+		{
+			name:    "missing separator",
+			input:   "NoColonInThisString",
+			wantErr: "missing ':'",
+		},
+		{
+			name:    "unterminated quote",
+			input:   `"Open:Integer x = 1;`,
+			wantErr: "unterminated",
+		},
+		{
+			name:    "quoted name without separator",
+			input:   `"Name" Integer x = 1;`,
+			wantErr: "missing ':' after quoted name",
+		},
+		{
+			name:    "empty name",
+			input:   ":Integer x = 1;",
+			wantErr: "name is empty",
+		},
+		{
+			name:    "empty source",
+			input:   "Name:   ",
+			wantErr: "code or file is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseBenchSpec(tt.input)
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("Expected error containing %q, got nil", tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if spec.Name != tt.wantName {
+				t.Errorf("Expected name %q, got %q", tt.wantName, spec.Name)
+			}
+			if spec.Code != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, spec.Code)
+			}
+			if spec.File != tt.wantFile {
+				t.Errorf("Expected file %q, got %q", tt.wantFile, spec.File)
+			}
+			if spec.Fence != tt.wantFence {
+				t.Errorf("Expected fence %d, got %d", tt.wantFence, spec.Fence)
+			}
+		})
+	}
+}
+
+func TestParseBenchSpec_ErrorPosition(t *testing.T) {
+	_, err := parseBenchSpec(`"Name" Integer x = 1;`)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	want := "at column 8\n  \"Name\" Integer x = 1;\n         ^\n"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected a caret under the problem, got:\n%v", err)
+	}
+	if !strings.Contains(err.Error(), "Name:code=") {
+		t.Errorf("Expected the accepted forms in the error, got:\n%v", err)
+	}
+}
+
+func TestParseBenchSpec_ExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "bulk_insert.cls")
+	doc := filepath.Join(dir, "perf.md")
+	for _, path := range []string{file, doc} {
+		if err := os.WriteFile(path, []byte("Integer i = 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec, err := parseBenchSpec(file)
+	if err != nil || spec.Name != "bulk_insert" || spec.File != file {
+		t.Errorf("parseBenchSpec(%s) = %+v, %v", file, spec, err)
+	}
+	spec, err = parseBenchSpec(doc + "#2")
+	if err != nil || spec.Name != "perf#2" || spec.File != doc || spec.Fence != 2 {
+		t.Errorf("parseBenchSpec(%s#2) = %+v, %v", doc, spec, err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// gitOutput runs git in dir and returns its output, through g.git when set
+func (g *globalOptions) gitOutput(dir string, args ...string) ([]byte, error) {
+	if g.git != nil {
+		return g.git(dir, args...)
+	}
+	return runGit(dir, args...)
+}
+
+// runGit runs git in dir and returns its output
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return output, nil
+}
+
+// changedFiles returns the absolute paths of the files changed in the git
+// repository containing dir since it forked from base: committed changes,
+// changes not committed yet and untracked files
+func (g *globalOptions) changedFiles(dir, base string) (map[string]bool, error) {
+	root, err := g.gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	// --end-of-options keeps a base starting with - from reading as an option
+	forkPoint, err := g.gitOutput(dir, "merge-base", "--end-of-options", base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := g.gitOutput(dir, "diff", "--name-only", strings.TrimSpace(string(forkPoint)))
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := g.gitOutput(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, line := range strings.Split(string(diff)+"\n"+string(untracked), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			changed[filepath.Join(strings.TrimSpace(string(root)), filepath.FromSlash(line))] = true
+		}
+	}
+	return changed, nil
+}
+
+// changedBenchmarks returns the names of the benchmarks of a suite affected
+// by changed files: benchmarks whose file changed, benchmarks whose code
+// mentions an Apex class or trigger that changed and, when the suite file
+// itself changed, benchmarks with inline code, which may be what changed
+func changedBenchmarks(specs []types.BenchmarkSpec, suitePath string, changed map[string]bool) ([]string, error) {
+	var classes []string
+	for path := range changed {
+		if ext := filepath.Ext(path); ext == ".cls" || ext == ".trigger" {
+			classes = append(classes, regexp.QuoteMeta(strings.TrimSuffix(filepath.Base(path), ext)))
+		}
+	}
+	var mentions *regexp.Regexp
+	if len(classes) > 0 {
+		// Apex identifiers are case-insensitive
+		mentions = regexp.MustCompile(`(?i)\b(` + strings.Join(classes, "|") + `)\b`)
+	}
+	suiteChanged := isChanged(suitePath, changed)
+
+	var names []string
+	for _, spec := range specs {
+		code := spec.Code
+		affected := spec.File == "" && suiteChanged
+		if spec.File != "" {
+			affected = isChanged(spec.File, changed)
+			content, err := os.ReadFile(spec.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %w", spec.File, err)
+			}
+			code = string(content)
+		}
+		if !affected && mentions != nil {
+			affected = mentions.MatchString(code + "\n" + spec.Setup + "\n" + spec.Teardown)
+		}
+		if affected {
+			names = append(names, spec.Name)
+		}
+	}
+	return names, nil
+}
+
+// isChanged reports whether the file at path is among changed
+func isChanged(path string, changed map[string]bool) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	return changed[abs]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestChangedBenchmarks(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	edited := write("edited.apex", "Integer a = 1;")
+	service := write("service.apex", "accountService.load();")
+	same := write("same.apex", "Integer c = 3;")
+	suite := write("suite.yaml", "")
+	specs := []types.BenchmarkSpec{
+		{Name: "Edited", File: edited},
+		{Name: "Service", File: service},
+		{Name: "Same", File: same},
+		{Name: "Inline", Code: "Integer d = 4;"},
+		{Name: "Setup", Code: "Integer e = 5;", Setup: "AccountService.seed();"},
+	}
+
+	changed := map[string]bool{edited: true, filepath.Join(dir, "classes", "AccountService.cls"): true}
+	got, err := changedBenchmarks(specs, suite, changed)
+	if err != nil {
+		t.Fatalf("changedBenchmarks() error = %v", err)
+	}
+	if want := []string{"Edited", "Service", "Setup"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changedBenchmarks() = %v, want %v", got, want)
+	}
+
+	got, _ = changedBenchmarks(specs, suite, map[string]bool{suite: true})
+	if want := []string{"Inline", "Setup"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changedBenchmarks() with a changed suite = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := runGit(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	for _, name := range []string{"a.apex", "b.apex"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("Integer x = 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+
+	if err := os.WriteFile(filepath.Join(dir, "a.apex"), []byte("Integer x = 2;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.apex"), []byte("Integer y = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &globalOptions{}
+	changed, err := g.changedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("changedFiles() error = %v", err)
+	}
+	want := map[string]bool{filepath.Join(dir, "a.apex"): true, filepath.Join(dir, "new.apex"): true}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changedFiles() = %v, want %v", changed, want)
+	}
+
+	if _, err := g.changedFiles(dir, "no-such-ref"); err == nil {
+		t.Error("Expected an error for an unknown ref")
+	}
+	if _, err := g.changedFiles(dir, "--octopus"); err == nil {
+		t.Error("Expected a base starting with - to be read as a ref")
+	}
+}
+
+func TestSelectChanged(t *testing.T) {
+	g := &globalOptions{}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.git = func(_ string, args ...string) ([]byte, error) {
+		switch args[0] {
+		case "rev-parse":
+			return []byte(dir + "\n"), nil
+		case "merge-base":
+			return []byte("abc123\n"), nil
+		case "diff":
+			return []byte("a.apex\n"), nil
+		}
+		return nil, nil
+	}
+	for _, name := range []string{"a.apex", "b.apex"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("Integer x = 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := types.BenchmarkConfig{Benchmarks: []types.BenchmarkSpec{
+		{Name: "A", File: filepath.Join(dir, "a.apex")},
+		{Name: "B", File: filepath.Join(dir, "b.apex")},
+	}}
+	if err := g.selectChanged(&config, filepath.Join(dir, "suite.yaml"), "origin/main"); err != nil {
+		t.Fatalf("selectChanged() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Unchanged, []string{"B"}) {
+		t.Errorf("Expected only B unchanged, got %v", config.Unchanged)
+	}
+}
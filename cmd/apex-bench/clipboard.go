@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardTool is a pair of commands reading and writing the system
+// clipboard
+type clipboardTool struct {
+	paste []string
+	copy  []string
+}
+
+// platformClipboardTools returns the clipboard tools of the current
+// platform, in order of preference
+func platformClipboardTools() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{paste: []string{"pbpaste"}, copy: []string{"pbcopy"}}}
+	case "windows":
+		return []clipboardTool{{
+			paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+			copy:  []string{"clip"},
+		}}
+	}
+	var tools []clipboardTool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append(tools, clipboardTool{paste: []string{"wl-paste", "--no-newline"}, copy: []string{"wl-copy"}})
+	}
+	return append(tools,
+		clipboardTool{paste: []string{"xclip", "-selection", "clipboard", "-o"}, copy: []string{"xclip", "-selection", "clipboard", "-i"}},
+		clipboardTool{paste: []string{"xsel", "--clipboard", "--output"}, copy: []string{"xsel", "--clipboard", "--input"}},
+	)
+}
+
+// findClipboardTool returns the first clipboard tool that is installed
+func (g *globalOptions) findClipboardTool() (clipboardTool, error) {
+	list := platformClipboardTools
+	if g.clipboardTools != nil {
+		list = g.clipboardTools
+	}
+	tools := list()
+	var names []string
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool.paste[0]); err == nil {
+			return tool, nil
+		}
+		names = append(names, tool.paste[0])
+	}
+	return clipboardTool{}, fmt.Errorf("no clipboard tool found (install one of: %s)", strings.Join(names, ", "))
+}
+
+// readClipboard returns the text on the system clipboard
+func (g *globalOptions) readClipboard() (string, error) {
+	tool, err := g.findClipboardTool()
+	if err != nil {
+		return "", err
+	}
+	text, err := runClipboardTool(tool.paste, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the clipboard: %w", err)
+	}
+	return text, nil
+}
+
+// writeClipboard places text on the system clipboard
+func (g *globalOptions) writeClipboard(text string) error {
+	tool, err := g.findClipboardTool()
+	if err != nil {
+		return err
+	}
+	if _, err := runClipboardTool(tool.copy, strings.NewReader(text)); err != nil {
+		return fmt.Errorf("failed to copy to the clipboard: %w", err)
+	}
+	return nil
+}
+
+// runClipboardTool runs a clipboard command with stdin and returns its output
+func runClipboardTool(args []string, stdin io.Reader) (string, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	return string(output), nil
+}
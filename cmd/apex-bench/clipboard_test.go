@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeClipboard replaces the system clipboard with a file for the test
+func fakeClipboard(t *testing.T, g *globalOptions, content string) string {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	path := filepath.Join(t.TempDir(), "clipboard")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g.clipboardTools = func() []clipboardTool {
+		return []clipboardTool{{
+			paste: []string{"sh", "-c", `cat "$0"`, path},
+			copy:  []string{"sh", "-c", `cat > "$0"`, path},
+		}}
+	}
+	return path
+}
+
+func TestClipboard(t *testing.T) {
+	g := &globalOptions{}
+	path := fakeClipboard(t, g, "Integer a = 1;")
+
+	text, err := g.readClipboard()
+	if err != nil || text != "Integer a = 1;" {
+		t.Errorf("readClipboard() = %q, %v", text, err)
+	}
+	if err := g.writeClipboard("copied"); err != nil {
+		t.Fatalf("writeClipboard() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "copied" {
+		t.Errorf("Expected the clipboard to hold %q, got %q", "copied", data)
+	}
+
+	g.clipboardTools = func() []clipboardTool {
+		return []clipboardTool{{paste: []string{"no-such-clipboard-tool"}, copy: []string{"no-such-clipboard-tool"}}}
+	}
+	if _, err := g.readClipboard(); err == nil || !strings.Contains(err.Error(), "no-such-clipboard-tool") {
+		t.Errorf("Expected an error naming the missing tool, got %v", err)
+	}
+}
+
+func TestWriteReports_CopyResult(t *testing.T) {
+	g := &globalOptions{}
+	path := fakeClipboard(t, g, "")
+	g.copy = true
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = oldStdout, oldStderr }()
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	targets := []outputTarget{{format: "table"}, {format: "json", path: filepath.Join(t.TempDir(), "out.json")}}
+	err := g.writeReports(targets, func(format string, w io.Writer) error {
+		_, err := io.WriteString(w, "report as "+format)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("writeReports() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "report as table" {
+		t.Errorf("Expected the first report on the clipboard, got %q", data)
+	}
+}
+
+func TestRunBenchmark_FromClipboard(t *testing.T) {
+	g := &globalOptions{}
+	fakeClipboard(t, g, "String s = 'copied';")
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	out := filepath.Join(t.TempDir(), "out.json")
+	cmd := NewRunCmd(g)
+	setFlags(t, cmd, "from-clipboard", "true", "backend", "mock")
+	g.outputs = []string{"json:" + out}
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("run --from-clipboard error = %v", err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("Expected results, got %v", err)
+	}
+
+	setFlags(t, cmd, "code", "Integer a = 1;")
+	if err := cmd.RunE(cmd, nil); err == nil || !strings.Contains(err.Error(), "--from-clipboard") {
+		t.Errorf("Expected --from-clipboard and --code to be exclusive, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// commitsOptions are the flags of a compare-commits command
+type commitsOptions struct {
+	global *globalOptions
+	measureOptions
+	file       string
+	base       string
+	head       string
+	relativeTo string
+}
+
+// newCompareCommitsCmd creates a compare-commits command with g as its
+// global options
+func newCompareCommitsCmd(g *globalOptions) *cobra.Command {
+	o := &commitsOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "compare-commits",
+		Short: "Compare a benchmark file at two git refs",
+		Long: `Benchmark an Apex code file as it is at two git refs and compare the
+versions, answering "did my change help?". Both versions are read with
+git show, so neither needs to be checked out; the head version is
+compared against the base version.`,
+		Args: cobra.NoArgs,
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.file, "file", "", "Path to the Apex code file in a git repository")
+	cmd.Flags().StringVar(&o.base, "base", "main", "Git ref of the version to compare against")
+	cmd.Flags().StringVar(&o.head, "head", "HEAD", "Git ref of the changed version")
+	o.measureOptions.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&o.relativeTo, "relative-to", "", "Metric the change is computed on: cpu, wall, heap (default: cpu, or wall with --metrics wall)")
+
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func (o *commitsOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+	if err != nil {
+		return err
+	}
+
+	config := types.BenchmarkConfig{
+		Iterations:     o.iterations,
+		Warmup:         o.warmup,
+		BatchSize:      o.batchSize,
+		Runs:           o.runs,
+		Parallel:       g.parallel,
+		Timeout:        g.timeout,
+		Delay:          g.delay,
+		Jitter:         g.jitter,
+		TrackHeap:      o.trackHeap,
+		TrackDB:        o.trackDB,
+		Aggregate:      o.aggregate,
+		NoiseThreshold: o.noiseThreshold,
+		Metrics:        o.metrics,
+		RelativeTo:     o.relativeTo,
+		APIVersion:     o.apiVersion,
+		Namespace:      g.namespace,
+		Vars:           g.benchVars(nil),
+		Outputs:        g.outputs,
+		Output:         compareDefaultOutput,
+		Out:            o.out,
+	}
+	return g.compareCommitsWithExecutor(commandContext(cmd), exec, org, o.file, o.base, o.head, config)
+}
+
+// compareCommitsWithExecutor is the testable core logic. It benchmarks the
+// file at path as of base and head, each named after its ref, and compares
+// head against base.
+func (g *globalOptions) compareCommitsWithExecutor(ctx context.Context, exec executor.Executor, org, path, base, head string, config types.BenchmarkConfig) error {
+	base, head = strings.TrimSpace(base), strings.TrimSpace(head)
+	if base == "" || head == "" {
+		return fmt.Errorf("--base and --head must name git refs")
+	}
+	if base == head {
+		return fmt.Errorf("--base and --head are both %q; compare two different refs", base)
+	}
+
+	baseCode, err := g.gitShow(path, base)
+	if err != nil {
+		return err
+	}
+	headCode, err := g.gitShow(path, head)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(baseCode) == strings.TrimSpace(headCode) {
+		g.warnf("%s is the same at %s and %s", path, base, head)
+	}
+
+	config.Benchmarks = []types.BenchmarkSpec{
+		{Name: base, Code: baseCode},
+		{Name: head, Code: headCode},
+	}
+	config.Baseline = base
+	return g.compareBenchmarksWithExecutor(ctx, exec, org, config)
+}
+
+// gitShow returns the content of the file at path as of ref. The ref is
+// resolved to a commit first, so one starting with - is not read as an
+// option of git show.
+func (g *globalOptions) gitShow(path, ref string) (string, error) {
+	dir := filepath.Dir(path)
+	commit, err := g.gitOutput(dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s at %s: %w", path, ref, err)
+	}
+	content, err := g.gitOutput(dir, "show", strings.TrimSpace(string(commit))+":./"+filepath.Base(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s at %s: %w", path, ref, err)
+	}
+	return string(content), nil
+}
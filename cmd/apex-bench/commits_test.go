@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestCompareCommitsWithExecutor(t *testing.T) {
+	g := &globalOptions{}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := runGit(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "algo.apex")
+	commit := func(code, message string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", ".")
+		git("commit", "-q", "-m", message)
+	}
+	git("init", "-q", "-b", "main")
+	commit("Integer a = 1;", "base")
+	git("checkout", "-q", "-b", "my-branch")
+	commit("Integer a = 2;", "change")
+
+	out := filepath.Join(t.TempDir(), "results.json")
+	config := types.BenchmarkConfig{Iterations: 10, Runs: 1, Parallel: 1, Aggregate: "median", Outputs: []string{"json:" + out}}
+	if err := g.compareCommitsWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", path, "main", "my-branch", config); err != nil {
+		t.Fatalf("compareCommitsWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name": "main"`) || !strings.Contains(string(data), `"name": "my-branch"`) {
+		t.Errorf("Expected both refs in the results, got: %s", data)
+	}
+
+	err = g.compareCommitsWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", path, "main", "main", config)
+	if err == nil || !strings.Contains(err.Error(), "compare two different refs") {
+		t.Errorf("Expected an error for equal refs, got %v", err)
+	}
+	err = g.compareCommitsWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", path, "main", "missing", config)
+	if err == nil || !strings.Contains(err.Error(), "at missing") {
+		t.Errorf("Expected an error for an unknown ref, got %v", err)
+	}
+
+	// A ref that looks like an option is never passed to git show as one
+	outDir := t.TempDir()
+	err = g.compareCommitsWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", path, "--output="+filepath.Join(outDir, "written"), "main", config)
+	if err == nil || !strings.Contains(err.Error(), "at --output=") {
+		t.Errorf("Expected an error for an option-like ref, got %v", err)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 0 {
+		t.Errorf("Expected git to write nothing, got %v", entries)
+	}
+}
@@ -1,181 +1,272 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
-	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
-	"github.com/ipavlic/apex-benchmark-cli/pkg/parser"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
-	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 	"github.com/spf13/cobra"
 )
 
-var (
-	// Flags for compare command
-	compareBenches []string
-	compareIterations int
-	compareWarmup     int
-	compareRuns       int
-	compareParallel   int
-	compareTrackHeap  bool
-	compareTrackDB    bool
-	compareOrg        string
-	compareOutput     string
-)
+// compareOptions are the flags of a compare command
+type compareOptions struct {
+	global *globalOptions
+	measureOptions
+	benches       []string
+	minSuccessful int
+	trackHeapPeak bool
+	trackCache    string
+	queryPlan     bool
+	combine       bool
+	failFast      bool
+	keepGoing     bool
+	captureDebug  bool
+	debugLogDir   string
+	keepLogs      string
+	showRuns      bool
+	raw           string
+	noRaw         bool
+	relativeTo    string
+	baseline      string
+	require       []string
+	units         []string
+	perUnits      float64
+	manifest      string
+	record        string
+	replay        string
+	apiFloor      int
+}
 
-var compareCmd = &cobra.Command{
-	Use:   "compare",
-	Short: "Compare multiple benchmarks",
-	Long: `Compare multiple benchmarks side-by-side.
+// compareDefaultOutput is the report format used when --output is not given
+const compareDefaultOutput = "table"
+
+// NewCompareCmd creates a compare command with g as its global options. Its
+// flags are bound to variables of its own, so separate instances can be
+// executed concurrently and repeatedly without seeing each other's flags.
+func NewCompareCmd(g *globalOptions) *cobra.Command {
+	o := &compareOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "compare",
+		Short: "Compare multiple benchmarks",
+		Long: `Compare multiple benchmarks side-by-side.
 Use --bench flag multiple times to specify benchmarks.
-Format: --bench "Name:code" or --bench "Name:path/to/file.apex"`,
-	RunE: compareBenchmarks,
-}
+Format: --bench "Name:code" or --bench "Name:path/to/file.apex"
+Quote the name to include colons or other special characters:
+--bench '"Map: keyed by Id":path/to/file.apex'
+A file pattern such as --bench "Strings:benchmarks/string/*.apex" adds a
+benchmark per matching file, named Strings/<file name>. In a Markdown file,
+the benchmark is its only apex code fence, or the one numbered N with
+--bench "Name:docs/perf.md#N".`,
+		RunE: o.run,
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVar(&o.benches, "bench", []string{}, "Benchmark to compare (repeatable)")
+	o.measureOptions.addFlags(flags)
+	flags.IntVar(&o.minSuccessful, "min-successful-runs", 0, "Aggregate the successful runs when some fail, if at least this many succeed (0 requires all)")
+	flags.BoolVar(&o.trackHeapPeak, "track-heap-peak", false, "Track the heap high-water mark during measurement and its share of the heap limit")
+	flags.StringVar(&o.trackCache, "track-cache", "", "Track keys and capacity used in this Platform Cache partition, e.g. local.Bench, or session:local.Bench for the session cache")
+	flags.BoolVar(&o.queryPlan, "query-plan", false, "Attach the query plan of each inline SOQL query (requires --track-db)")
+	flags.BoolVar(&o.combine, "combine", false, "Run all benchmarks in a single Apex script per run (shares governor limits)")
+	flags.BoolVar(&o.failFast, "fail-fast", false, "Stop at the first failing benchmark, reporting the results completed so far (default)")
+	flags.BoolVar(&o.keepGoing, "keep-going", false, "Run every benchmark even if some fail, reporting each failure in the results")
+	flags.BoolVar(&o.captureDebug, "capture-debug", false, "Attach System.debug output from benchmark code to the results")
+	flags.StringVar(&o.debugLogDir, "debug-log-dir", "", "Write captured System.debug output to this directory (implies --capture-debug)")
+	flags.StringVar(&o.keepLogs, "keep-logs", "", "Save each run's full debug log under this directory")
+	flags.BoolVar(&o.showRuns, "show-runs", false, "Also print a table of each run's averages in table output")
+	flags.StringVar(&o.raw, "raw", "full", "Per-run results in JSON output: full, summary (only their count) or none")
+	flags.BoolVar(&o.noRaw, "no-raw", false, "Leave per-run results out of JSON output (same as --raw none)")
+	flags.StringVar(&o.relativeTo, "relative-to", "", "Metric the Relative column and fastest benchmark are based on: cpu, wall, heap (default: cpu, or wall with --metrics wall)")
+	flags.StringVar(&o.baseline, "baseline", "", "Name of the benchmark multipliers are computed against (default: the fastest)")
+	flags.StringArrayVar(&o.require, "require", nil, "Fail unless a condition over benchmark averages holds, e.g. \"New <= Old * 0.9\" (repeatable)")
+	flags.StringArrayVar(&o.units, "units", nil, "Units of work a benchmark processes per iteration as Name=N, e.g. \"Bulk=200\"; set for every benchmark to compare per unit (repeatable)")
+	flags.Float64Var(&o.perUnits, "per-units", 1, "Show per-unit times for this many units, e.g. 1000 for ms per 1000 records")
+	flags.StringVar(&o.manifest, "manifest", "", "Write a manifest of the session to this file, for reproducing it with rerun")
+	flags.IntVar(&o.apiFloor, "api-floor", 0, "Stop before the org's remaining daily API requests drop below this (0 disables)")
+	flags.StringVar(&o.record, "record", "", "Save every execution to this directory for later replay")
+	flags.StringVar(&o.replay, "replay", "", "Replay executions saved with --record (or debug logs) from this directory instead of running them")
 
-func init() {
-	compareCmd.Flags().StringArrayVar(&compareBenches, "bench", []string{}, "Benchmark to compare (repeatable)")
-	compareCmd.Flags().IntVar(&compareIterations, "iterations", 100, "Number of measurement iterations")
-	compareCmd.Flags().IntVar(&compareWarmup, "warmup", 10, "Number of warmup iterations")
-	compareCmd.Flags().IntVar(&compareRuns, "runs", 1, "Number of complete runs for aggregation")
-	compareCmd.Flags().IntVar(&compareParallel, "parallel", 1, "Maximum concurrent executions")
-	compareCmd.Flags().BoolVar(&compareTrackHeap, "track-heap", false, "Enable heap usage tracking")
-	compareCmd.Flags().BoolVar(&compareTrackDB, "track-db", false, "Enable DML/SOQL tracking")
-	compareCmd.Flags().StringVar(&compareOrg, "org", "", "Target Salesforce org (uses default if not specified)")
-	compareCmd.Flags().StringVar(&compareOutput, "output", "table", "Output format: json, table")
-
-	compareCmd.MarkFlagRequired("bench")
+	cmd.MarkFlagRequired("bench")
+	cmd.MarkFlagsMutuallyExclusive("fail-fast", "keep-going")
+	cmd.MarkFlagsMutuallyExclusive("raw", "no-raw")
+	return cmd
 }
 
-func compareBenchmarks(cmd *cobra.Command, args []string) error {
+func (o *compareOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	// Parse benchmark specifications
+	benchSpecs := make([]types.BenchmarkSpec, 0, len(o.benches))
+	for _, bench := range o.benches {
+		spec, err := parseBenchSpec(bench)
+		if err != nil {
+			return err
+		}
+		benchSpecs = append(benchSpecs, spec)
+	}
+	benchSpecs, err := expandFileGlobs(benchSpecs)
+	if err != nil {
+		return err
+	}
+
 	// Validate flags
-	if len(compareBenches) < 2 {
+	if len(benchSpecs) < 2 {
 		return fmt.Errorf("must provide at least 2 benchmarks to compare")
 	}
 
-	// Check Salesforce CLI
-	if err := executor.CheckSalesforceCLI(); err != nil {
+	// Select the backend and the org it runs against
+	exec, org, err := g.newExecutor(executorOptions{
+		Backend:   o.backend,
+		Org:       g.org,
+		RecordDir: o.record,
+		ReplayDir: o.replay,
+		APIFloor:  o.apiFloor,
+	})
+	if err != nil {
 		return err
 	}
 
-	// Get org
-	org, err := executor.GetOrg(compareOrg)
-	if err != nil {
+	if err := applyUnits(benchSpecs, o.units); err != nil {
 		return err
 	}
-	if compareOrg == "" {
-		fmt.Fprintf(os.Stderr, "Using default org: %s\n", org)
-	}
-
-	// Parse benchmark specifications
-	benchSpecs := make([]types.BenchmarkSpec, 0, len(compareBenches))
-	for _, bench := range compareBenches {
-		parts := strings.SplitN(bench, ":", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid benchmark format %q, expected 'Name:code' or 'Name:file'", bench)
-		}
-
-		name := strings.TrimSpace(parts[0])
-		source := strings.TrimSpace(parts[1])
 
-		spec := types.BenchmarkSpec{
-			Name: name,
-		}
-
-		// Check if source is a file (ends with .apex or exists as a file)
-		if strings.HasSuffix(source, ".apex") || fileExists(source) {
-			spec.File = source
-		} else {
-			spec.Code = source
+	// Run
+	config := types.BenchmarkConfig{
+		Benchmarks:     benchSpecs,
+		Iterations:     o.iterations,
+		Warmup:         o.warmup,
+		BatchSize:      o.batchSize,
+		Runs:           o.runs,
+		MinSuccessful:  o.minSuccessful,
+		Parallel:       g.parallel,
+		Timeout:        g.timeout,
+		Delay:          g.delay,
+		Jitter:         g.jitter,
+		TrackHeap:      o.trackHeap,
+		TrackHeapPeak:  o.trackHeapPeak,
+		TrackDB:        o.trackDB,
+		TrackCache:     o.trackCache,
+		QueryPlan:      o.queryPlan,
+		Combine:        o.combine,
+		KeepGoing:      o.keepGoing,
+		CaptureDebug:   o.captureDebug,
+		DebugLogDir:    o.debugLogDir,
+		KeepLogs:       o.keepLogs,
+		Aggregate:      o.aggregate,
+		NoiseThreshold: o.noiseThreshold,
+		Metrics:        o.metrics,
+		ShowRuns:       o.showRuns,
+		Raw:            rawFlag(o.raw, o.noRaw),
+		RelativeTo:     o.relativeTo,
+		Baseline:       o.baseline,
+		Require:        o.require,
+		PerUnits:       o.perUnits,
+		APIVersion:     o.apiVersion,
+		Namespace:      g.namespace,
+		Vars:           g.benchVars(nil),
+		Outputs:        g.outputs,
+		Output:         compareDefaultOutput,
+		Out:            o.out,
+	}
+	if o.manifest != "" {
+		if err := g.saveManifest(o.manifest, cmd, config, org, o.backend); err != nil {
+			return err
 		}
-
-		benchSpecs = append(benchSpecs, spec)
 	}
+	return g.compareBenchmarksWithExecutor(commandContext(cmd), exec, org, config)
+}
 
-	// Create executor and run
-	exec := executor.NewCLIExecutor()
-	return compareBenchmarksWithExecutor(exec, org, benchSpecs, compareIterations, compareWarmup, compareRuns, compareParallel, compareTrackHeap, compareTrackDB, compareOutput)
+// compareBenchmarksWithExecutor is the testable core logic. Measurement and
+// output settings are taken from config and applied to every benchmark.
+// Results completed before a failure or before ctx is cancelled are still
+// reported; the failure is returned afterwards so the command exits non-zero.
+func (g *globalOptions) compareBenchmarksWithExecutor(ctx context.Context, exec executor.Executor, org string, config types.BenchmarkConfig) error {
+	c, err := g.runComparison(ctx, exec, org, config)
+	if err != nil {
+		return err
+	}
+	if err := c.report(); err != nil {
+		return err
+	}
+	return c.Err(ctx)
 }
 
-// compareBenchmarksWithExecutor is the testable core logic
-func compareBenchmarksWithExecutor(exec executor.Executor, org string, benchSpecs []types.BenchmarkSpec, iterations int, warmup int, runs int, parallel int, trackHeap bool, trackDB bool, outputFormat string) error {
-	aggregatedResults := make([]types.AggregatedResult, 0, len(benchSpecs))
+// comparison is the outcome of comparing benchmarks, with the reports it
+// is to be written to
+type comparison struct {
+	orchestrator.Comparison
+	global  *globalOptions
+	targets []outputTarget
+	org     string // Tags exported metrics
+}
 
-	for i, benchSpec := range benchSpecs {
-		fmt.Fprintf(os.Stderr, "\n[%d/%d] Running benchmark: %s\n", i+1, len(benchSpecs), benchSpec.Name)
+// runComparison runs config's benchmarks with orchestrator.Compare,
+// reporting progress on stderr, once its output targets are known to be
+// valid. It only fails when no benchmark produced a result; other failures
+// are left to comparison.Err.
+func (g *globalOptions) runComparison(ctx context.Context, exec executor.Executor, org string, config types.BenchmarkConfig) (comparison, error) {
+	targets, err := parseOutputTargets(config)
+	if err != nil {
+		return comparison{}, err
+	}
+	c, err := orchestrator.Compare(ctx, g.sessionOptions(exec, org, config))
+	if err != nil {
+		return comparison{}, flagError(err)
+	}
+	return comparison{Comparison: c, global: g, targets: targets, org: org}, nil
+}
 
-		// Read code
-		userCode := benchSpec.Code
-		if benchSpec.File != "" {
-			content, err := os.ReadFile(benchSpec.File)
-			if err != nil {
-				return fmt.Errorf("failed to read file %s: %w", benchSpec.File, err)
-			}
-			userCode = string(content)
-		}
+// Err returns why the comparison failed, like orchestrator.Comparison.Err,
+// naming settings by their flags
+func (c comparison) Err(ctx context.Context) error {
+	return flagError(c.Comparison.Err(ctx))
+}
 
-		// Build CodeSpec
-		spec := types.CodeSpec{
-			Name:       benchSpec.Name,
-			UserCode:   strings.TrimSpace(userCode),
-			Iterations: iterations,
-			Warmup:     warmup,
-			TrackHeap:  trackHeap,
-			TrackDB:    trackDB,
+// report writes the results to every output target and exports their
+// metrics
+func (c comparison) report() error {
+	c.global.progressf("\n")
+	err := c.global.writeReports(c.targets, func(format string, w io.Writer) error {
+		if format == "table" {
+			return reporter.PrintComparisonWithMetrics(c.Results, w, c.Metrics)
 		}
+		return reporter.PrintJSON(reporter.TrimRaw(c.Results, c.Raw), w)
+	})
+	if err != nil {
+		return err
+	}
+	return c.global.exportResults(c.Results, c.org)
+}
 
-		// Generate
-		apexCode, err := generator.Generate(spec)
-		if err != nil {
-			return fmt.Errorf("failed to generate code for %s: %w", benchSpec.Name, err)
+// applyUnits sets the units of the benchmarks named by --units values of
+// the form Name=N
+func applyUnits(specs []types.BenchmarkSpec, values []string) error {
+	for _, value := range values {
+		i := strings.LastIndex(value, "=")
+		if i == -1 {
+			return fmt.Errorf("invalid --units %q (expected Name=N)", value)
 		}
-
-		// Execute
-		var outputs []string
-		if runs == 1 {
-			output, err := exec.Run(apexCode, org)
-			if err != nil {
-				return fmt.Errorf("execution failed for %s: %w", benchSpec.Name, err)
-			}
-			outputs = []string{output}
-		} else {
-			var err error
-			outputs, err = exec.ExecuteParallel(apexCode, runs, parallel, org)
-			if err != nil {
-				return fmt.Errorf("execution failed for %s: %w", benchSpec.Name, err)
-			}
+		units, err := strconv.ParseFloat(strings.TrimSpace(value[i+1:]), 64)
+		if err != nil || units <= 0 {
+			return fmt.Errorf("invalid --units %q: units must be a positive number", value)
 		}
-
-		// Parse
-		results, err := parser.ParseMultipleResults(outputs)
-		if err != nil {
-			return fmt.Errorf("failed to parse results for %s: %w", benchSpec.Name, err)
+		name, ok := orchestrator.FindBenchmark(specs, value[:i])
+		if !ok {
+			return fmt.Errorf("--units %q matches no benchmark", value)
 		}
-
-		// Aggregate
-		aggregated, err := stats.Aggregate(results)
-		if err != nil {
-			return fmt.Errorf("failed to aggregate results for %s: %w", benchSpec.Name, err)
+		for j := range specs {
+			if specs[j].Name == name {
+				specs[j].Units = units
+			}
 		}
-		aggregated.Warmup = warmup
-
-		aggregatedResults = append(aggregatedResults, aggregated)
-		fmt.Fprintf(os.Stderr, "  Completed: avg CPU %.3f ms\n", aggregated.AvgCpuMs)
-	}
-
-	// Output
-	fmt.Fprintf(os.Stderr, "\n")
-	switch outputFormat {
-	case "json":
-		return reporter.PrintJSON(aggregatedResults, os.Stdout)
-	case "table":
-		return reporter.PrintComparison(aggregatedResults, os.Stdout)
-	default:
-		return fmt.Errorf("unknown output format: %s", outputFormat)
 	}
+	return nil
 }
 
 // fileExists checks if a file exists
@@ -2,15 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
 func TestCompareBenchmarksWithExecutor_Success(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -27,7 +30,7 @@ func TestCompareBenchmarksWithExecutor_Success(t *testing.T) {
 		{Name: "Bench2", Code: "String s2 = 'b';"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	// Restore stdout and capture output
 	w.Close()
@@ -50,6 +53,7 @@ func TestCompareBenchmarksWithExecutor_Success(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_JSONOutput(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -66,7 +70,7 @@ func TestCompareBenchmarksWithExecutor_JSONOutput(t *testing.T) {
 		{Name: "Test2", Code: "Integer y = 2;"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 5, 1, 1, 1, false, false, "json")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 5, Warmup: 1, Runs: 1, Parallel: 1, Output: "json"})
 
 	// Restore stdout and capture output
 	w.Close()
@@ -86,6 +90,7 @@ func TestCompareBenchmarksWithExecutor_JSONOutput(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_WithFiles(t *testing.T) {
+	g := &globalOptions{}
 	// Create temporary files
 	tmpFile1, err := os.CreateTemp("", "bench1-*.apex")
 	if err != nil {
@@ -121,7 +126,7 @@ func TestCompareBenchmarksWithExecutor_WithFiles(t *testing.T) {
 		{Name: "File2", File: tmpFile2.Name()},
 	}
 
-	err = compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err = g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	// Restore stdout
 	w.Close()
@@ -135,6 +140,7 @@ func TestCompareBenchmarksWithExecutor_WithFiles(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_FileReadError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -146,7 +152,7 @@ func TestCompareBenchmarksWithExecutor_FileReadError(t *testing.T) {
 		{Name: "Invalid", File: "/nonexistent/file.apex"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	if err == nil {
 		t.Error("Expected file read error")
@@ -157,6 +163,7 @@ func TestCompareBenchmarksWithExecutor_FileReadError(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_ExecutionError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -177,7 +184,7 @@ func TestCompareBenchmarksWithExecutor_ExecutionError(t *testing.T) {
 		{Name: "Bench2", Code: "String s2 = 'b';"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	if err == nil {
 		t.Error("Expected execution error")
@@ -188,6 +195,7 @@ func TestCompareBenchmarksWithExecutor_ExecutionError(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_MultipleRuns(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -218,7 +226,7 @@ func TestCompareBenchmarksWithExecutor_MultipleRuns(t *testing.T) {
 		{Name: "Multi2", Code: "String s2 = 'b';"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 3, 2, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 3, Parallel: 2, Output: "table"})
 
 	// Restore stdout
 	w.Close()
@@ -236,6 +244,7 @@ func TestCompareBenchmarksWithExecutor_MultipleRuns(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_InvalidOutputFormat(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -247,7 +256,7 @@ func TestCompareBenchmarksWithExecutor_InvalidOutputFormat(t *testing.T) {
 		{Name: "Test2", Code: "String s2 = 'b';"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "xml")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "xml"})
 
 	if err == nil {
 		t.Error("Expected error for invalid output format")
@@ -258,6 +267,7 @@ func TestCompareBenchmarksWithExecutor_InvalidOutputFormat(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_GenerationError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -268,7 +278,7 @@ func TestCompareBenchmarksWithExecutor_GenerationError(t *testing.T) {
 		{Name: "", Code: "String s = 'test';"}, // Invalid: empty name
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	if err == nil {
 		t.Error("Expected generation error")
@@ -279,6 +289,7 @@ func TestCompareBenchmarksWithExecutor_GenerationError(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_ParseError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -296,7 +307,7 @@ func TestCompareBenchmarksWithExecutor_ParseError(t *testing.T) {
 		{Name: "Parse2", Code: "String s2 = 'b';"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	if err == nil {
 		t.Error("Expected parse error")
@@ -307,6 +318,7 @@ func TestCompareBenchmarksWithExecutor_ParseError(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_WithTrackingOptions(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -337,7 +349,7 @@ func TestCompareBenchmarksWithExecutor_WithTrackingOptions(t *testing.T) {
 		{Name: "Track2", Code: "String s2 = 'b';"},
 	}
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, true, true, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, TrackHeap: true, TrackDB: true, Runs: 1, Parallel: 1, Output: "table"})
 
 	// Restore stdout
 	w.Close()
@@ -355,6 +367,7 @@ func TestCompareBenchmarksWithExecutor_WithTrackingOptions(t *testing.T) {
 }
 
 func TestCompareBenchmarksWithExecutor_EmptyBenchmarks(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -368,7 +381,7 @@ func TestCompareBenchmarksWithExecutor_EmptyBenchmarks(t *testing.T) {
 	mock := &mockExecutor{}
 	benchSpecs := []types.BenchmarkSpec{} // Empty list
 
-	err := compareBenchmarksWithExecutor(mock, "test-org", benchSpecs, 10, 2, 1, 1, false, false, "table")
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Output: "table"})
 
 	// Restore stdout
 	w.Close()
@@ -381,3 +394,314 @@ func TestCompareBenchmarksWithExecutor_EmptyBenchmarks(t *testing.T) {
 		t.Logf("Got error for empty benchmarks: %v", err)
 	}
 }
+
+func TestCompareBenchmarksWithExecutor_Combined(t *testing.T) {
+	g := &globalOptions{}
+	// Redirect stderr to suppress log output
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	// Redirect stdout to capture output
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	executions := 0
+	mock := &mockExecutor{
+		runFunc: func(apexCode string, org string) (string, error) {
+			executions++
+			return mockSuccessfulBenchResultFromCode(apexCode), nil
+		},
+	}
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Bench1", Code: "String s = 'a';"},
+		{Name: "Bench2", Code: "String s = 'b';"},
+		{Name: "Bench3", Code: "String s = 'c';"},
+	}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Combine: true, Output: "json"})
+
+	// Restore stdout and capture output
+	w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	output := buf.String()
+
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if executions != 1 {
+		t.Errorf("Expected a single execution, got %d", executions)
+	}
+	for _, name := range []string{"Bench1", "Bench2", "Bench3"} {
+		if !strings.Contains(output, name) {
+			t.Errorf("Expected output to contain %s, got: %s", name, output)
+		}
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_CombinedMultipleRuns(t *testing.T) {
+	g := &globalOptions{}
+	// Redirect stderr to suppress log output
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	// Redirect stdout to capture output
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	mock := &mockExecutor{}
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Bench1", Code: "String s = 'a';"},
+		{Name: "Bench2", Code: "String s = 'b';"},
+	}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 3, Parallel: 2, Combine: true, Output: "json"})
+
+	// Restore stdout and capture output
+	w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	output := buf.String()
+
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if strings.Count(output, `"runs": 3`) != 2 {
+		t.Errorf("Expected both benchmarks to aggregate 3 runs, got: %s", output)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_CombinedMissingResult(t *testing.T) {
+	g := &globalOptions{}
+	// Redirect stderr to suppress log output
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	mock := &mockExecutor{
+		runFunc: func(apexCode string, org string) (string, error) {
+			// Only the first benchmark reports a result
+			return mockSuccessfulBenchResult(), nil
+		},
+	}
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "TestBench", Code: "String s = 'a';"},
+		{Name: "Other", Code: "String s = 'b';"},
+	}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Combine: true, Output: "table"})
+	if err == nil {
+		t.Fatal("Expected error for missing result")
+	}
+	if !strings.Contains(err.Error(), "no result for Other") {
+		t.Errorf("Expected missing result error, got: %v", err)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_CombinedRejectsDeclarations(t *testing.T) {
+	g := &globalOptions{}
+	mock := &mockExecutor{}
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Bench1", Code: "String s = 'a';"},
+		{Name: "Bench2", Code: "void helper() {}\nhelper();"},
+	}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Warmup: 2, Runs: 1, Parallel: 1, Combine: true, Output: "table"})
+	if err == nil {
+		t.Fatal("Expected generation error")
+	}
+	if !strings.Contains(err.Error(), "failed to generate combined code") {
+		t.Errorf("Expected generation error, got: %v", err)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_PartialResults(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	mock := &mockExecutor{runFunc: func(apexCode string, org string) (string, error) {
+		if strings.Contains(apexCode, "Broken") {
+			return "", fmt.Errorf("compile error")
+		}
+		return mockSuccessfulBenchResultFromCode(apexCode), nil
+	}}
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Bench1", Code: "String s1 = 'a';"},
+		{Name: "Broken", Code: "String s2 = 'b';"},
+		{Name: "Bench3", Code: "String s3 = 'c';"},
+	}
+
+	for _, keepGoing := range []bool{false, true} {
+		out := t.TempDir() + "/results.json"
+		config := types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Runs: 1, Parallel: 1, KeepGoing: keepGoing, Outputs: []string{"json:" + out}}
+
+		err := g.compareBenchmarksWithExecutor(context.Background(), mock, "test-org", config)
+		if err == nil {
+			t.Fatalf("Expected error with keep-going=%v", keepGoing)
+		}
+
+		data, readErr := os.ReadFile(out)
+		if readErr != nil {
+			t.Fatalf("Expected partial results to be written: %v", readErr)
+		}
+		output := string(data)
+		if !strings.Contains(output, `"name": "Bench1"`) {
+			t.Errorf("Expected completed Bench1 in results, got: %s", output)
+		}
+		if keepGoing {
+			if !strings.Contains(err.Error(), "1 of 3 benchmarks failed") || !strings.Contains(output, `"error": "execution failed for Broken`) || !strings.Contains(output, `"name": "Bench3"`) {
+				t.Errorf("Expected every benchmark with the failure recorded, got %v: %s", err, output)
+			}
+		} else if strings.Contains(output, "Bench3") || !strings.Contains(err.Error(), "stopped after 1 of 3 benchmarks") {
+			t.Errorf("Expected to stop at Broken, got %v: %s", err, output)
+		}
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_QueryPlan(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	benchSpecs := []types.BenchmarkSpec{{Name: "Lookup", Code: "List<Account> a = [SELECT Id FROM Account WHERE Name = 'Acme'];"}}
+	config := types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Runs: 1, Parallel: 1, QueryPlan: true, Output: "json"}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "--query-plan requires --track-db") {
+		t.Fatalf("Expected --track-db to be required, got %v", err)
+	}
+
+	out := t.TempDir() + "/results.json"
+	config.TrackDB = true
+	config.Outputs = []string{"json:" + out}
+	if err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config); err != nil {
+		t.Fatalf("compareBenchmarksWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"query": "SELECT Id FROM Account WHERE Name = 'Acme'"`) {
+		t.Errorf("Expected the query plan in the results, got: %s", data)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_RelativeTo(t *testing.T) {
+	g := &globalOptions{}
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Bench1", Code: "String s1 = 'a';"},
+		{Name: "Bench2", Code: "String s2 = 'b';"},
+	}
+	config := types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Runs: 1, Parallel: 1, Output: "table", RelativeTo: "latency"}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), &mockExecutor{}, "test-org", config)
+	if err == nil || !strings.Contains(err.Error(), "unknown relative metric") {
+		t.Errorf("Expected an unknown metric error, got %v", err)
+	}
+
+	config.RelativeTo = "heap"
+	err = g.compareBenchmarksWithExecutor(context.Background(), &mockExecutor{}, "test-org", config)
+	if err == nil || !strings.Contains(err.Error(), "--relative-to heap requires --track-heap") {
+		t.Errorf("Expected --track-heap to be required, got %v", err)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_Require(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Bench1", Code: "String s1 = 'a';"},
+		{Name: "Bench2", Code: "String s2 = 'b';"},
+	}
+	config := types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Runs: 1, Parallel: 1, Output: "json", Require: []string{"Bench3 < Bench1"}}
+	config.Outputs = []string{"json:" + t.TempDir() + "/results.json"}
+
+	err := g.compareBenchmarksWithExecutor(context.Background(), &mockExecutor{}, "test-org", config)
+	if err == nil || !strings.Contains(err.Error(), `unknown benchmark "Bench3"`) {
+		t.Fatalf("Expected an unknown benchmark error, got %v", err)
+	}
+
+	config.Require = []string{"Bench1 < 1000000", "Bench2 <= Bench1 * 1.5"}
+	if err := g.compareBenchmarksWithExecutor(context.Background(), &mockExecutor{}, "test-org", config); err != nil {
+		t.Fatalf("Expected the requirements to hold, got %v", err)
+	}
+
+	config.Require = []string{"Bench1 > 1000000"}
+	err = g.compareBenchmarksWithExecutor(context.Background(), &mockExecutor{}, "test-org", config)
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 requirements failed: Bench1 > 1000000") {
+		t.Errorf("Expected a failed requirement, got %v", err)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_PerUnit(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	benchSpecs := []types.BenchmarkSpec{
+		{Name: "Small", Code: "String s1 = 'a';", Units: 10},
+		{Name: "Large", Code: "String s2 = 'b';", Units: 100},
+	}
+	out := t.TempDir() + "/results.json"
+	config := types.BenchmarkConfig{Benchmarks: benchSpecs, Iterations: 10, Runs: 1, Parallel: 1, PerUnits: 1000, Outputs: []string{"json:" + out}}
+
+	if err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config); err != nil {
+		t.Fatalf("compareBenchmarksWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"units": 100`) || !strings.Contains(string(data), `"cpuMsPerUnit"`) {
+		t.Errorf("Expected per-unit times in the results, got: %s", data)
+	}
+
+	config.Benchmarks = []types.BenchmarkSpec{benchSpecs[0], {Name: "Other", Code: "String s3 = 'c';"}}
+	err = g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "set them for every benchmark") {
+		t.Errorf("Expected an error for missing units, got %v", err)
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_RawSummary(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	out := t.TempDir() + "/results.json"
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{{Name: "Bench1", Code: "String s1 = 'a';"}, {Name: "Bench2", Code: "String s2 = 'b';"}},
+		Iterations: 10, Runs: 3, Parallel: 1, Raw: "summary", Outputs: []string{"json:" + out},
+	}
+
+	if err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config); err != nil {
+		t.Fatalf("compareBenchmarksWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"rawCount": 3`) || strings.Contains(string(data), `"raw":`) {
+		t.Errorf("Expected run counts instead of raw results, got: %s", data)
+	}
+
+	config.Raw = "some"
+	err = g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "unknown raw mode") {
+		t.Errorf("Expected an error for an unknown raw mode, got %v", err)
+	}
+}
@@ -6,10 +6,15 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 	"github.com/spf13/cobra"
 )
 
 func TestCompareCommand_Flags(t *testing.T) {
+	compareCmd, _, err := NewRootCmd().Find([]string{"compare"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	flags := compareCmd.Flags()
 
 	if flags.Lookup("bench") == nil {
@@ -21,28 +26,75 @@ func TestCompareCommand_Flags(t *testing.T) {
 	if flags.Lookup("warmup") == nil {
 		t.Error("Expected 'warmup' flag to be registered")
 	}
+	if flags.Lookup("batch-size") == nil {
+		t.Error("Expected 'batch-size' flag to be registered")
+	}
 	if flags.Lookup("runs") == nil {
 		t.Error("Expected 'runs' flag to be registered")
 	}
-	if flags.Lookup("parallel") == nil {
-		t.Error("Expected 'parallel' flag to be registered")
-	}
 	if flags.Lookup("track-heap") == nil {
 		t.Error("Expected 'track-heap' flag to be registered")
 	}
 	if flags.Lookup("track-db") == nil {
 		t.Error("Expected 'track-db' flag to be registered")
 	}
-	if flags.Lookup("org") == nil {
-		t.Error("Expected 'org' flag to be registered")
+	if flags.Lookup("capture-debug") == nil {
+		t.Error("Expected 'capture-debug' flag to be registered")
+	}
+	if flags.Lookup("debug-log-dir") == nil {
+		t.Error("Expected 'debug-log-dir' flag to be registered")
+	}
+	if flags.Lookup("keep-logs") == nil {
+		t.Error("Expected 'keep-logs' flag to be registered")
+	}
+	if flags.Lookup("aggregate") == nil {
+		t.Error("Expected 'aggregate' flag to be registered")
+	}
+	if flags.Lookup("noise-threshold") == nil {
+		t.Error("Expected 'noise-threshold' flag to be registered")
+	}
+	if flags.Lookup("metrics") == nil {
+		t.Error("Expected 'metrics' flag to be registered")
+	}
+	if flags.Lookup("combine") == nil {
+		t.Error("Expected 'combine' flag to be registered")
+	}
+	if flags.Lookup("fail-fast") == nil {
+		t.Error("Expected 'fail-fast' flag to be registered")
+	}
+	if flags.Lookup("keep-going") == nil {
+		t.Error("Expected 'keep-going' flag to be registered")
+	}
+	if flags.Lookup("record") == nil {
+		t.Error("Expected 'record' flag to be registered")
+	}
+	if flags.Lookup("replay") == nil {
+		t.Error("Expected 'replay' flag to be registered")
 	}
-	if flags.Lookup("output") == nil {
-		t.Error("Expected 'output' flag to be registered")
+	if flags.Lookup("api-version") == nil {
+		t.Error("Expected 'api-version' flag to be registered")
+	}
+	if flags.Lookup("api-floor") == nil {
+		t.Error("Expected 'api-floor' flag to be registered")
+	}
+	if flags.Lookup("backend") == nil {
+		t.Error("Expected 'backend' flag to be registered")
+	}
+	if flags.Lookup("out") == nil {
+		t.Error("Expected 'out' flag to be registered")
+	}
+
+	// Shared flags are inherited from the root command
+	inherited := compareCmd.InheritedFlags()
+	for _, name := range []string{"org", "output", "parallel", "timeout", "verbose", "quiet"} {
+		if inherited.Lookup(name) == nil {
+			t.Errorf("Expected inherited '%s' flag", name)
+		}
 	}
 }
 
 func TestCompareCommand_DefaultValues(t *testing.T) {
-	flags := compareCmd.Flags()
+	flags := NewCompareCmd(&globalOptions{}).Flags()
 
 	iterVal, _ := flags.GetInt("iterations")
 	if iterVal != 100 {
@@ -54,17 +106,16 @@ func TestCompareCommand_DefaultValues(t *testing.T) {
 		t.Errorf("Expected default warmup 10, got %d", warmupVal)
 	}
 
-	outputVal, _ := flags.GetString("output")
-	if outputVal != "table" {
-		t.Errorf("Expected default output 'table', got %s", outputVal)
+	if compareDefaultOutput != "table" {
+		t.Errorf("Expected default output table, got %s", compareDefaultOutput)
 	}
 }
 
 func TestCompareBenchmarks_TooFewBenchmarks(t *testing.T) {
-	compareBenches = []string{"Test1:code1"}
-
-	cmd := &cobra.Command{}
-	err := compareBenchmarks(cmd, []string{})
+	g := &globalOptions{}
+	cmd := NewCompareCmd(g)
+	setFlags(t, cmd, "bench", "Test1:code1")
+	err := cmd.RunE(cmd, []string{})
 
 	if err == nil {
 		t.Error("Expected error when fewer than 2 benchmarks provided")
@@ -106,8 +157,9 @@ func TestFileExists(t *testing.T) {
 }
 
 func TestCompareCommand_Integration(t *testing.T) {
+	g := &globalOptions{}
 	rootCmd := &cobra.Command{Use: "test"}
-	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(NewCompareCmd(g))
 
 	var buf bytes.Buffer
 	rootCmd.SetOut(&buf)
@@ -207,3 +259,19 @@ func TestCompareBenchmarks_FileReading(t *testing.T) {
 		t.Errorf("Expected content %q, got %q", testCode1, string(content))
 	}
 }
+
+func TestApplyUnits(t *testing.T) {
+	specs := []types.BenchmarkSpec{{Name: "Small"}, {Name: "Large"}}
+	if err := applyUnits(specs, []string{"Small=10", "Large = 1000"}); err != nil {
+		t.Fatalf("applyUnits() error = %v", err)
+	}
+	if specs[0].Units != 10 || specs[1].Units != 1000 {
+		t.Errorf("applyUnits() set units %v and %v, want 10 and 1000", specs[0].Units, specs[1].Units)
+	}
+
+	for _, value := range []string{"Small", "Small=0", "Small=abc", "Missing=5"} {
+		if err := applyUnits(specs, []string{value}); err == nil {
+			t.Errorf("applyUnits(%q) expected an error", value)
+		}
+	}
+}
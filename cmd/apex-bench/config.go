@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// projectConfigName is the file name of the project config
+const projectConfigName = ".apex-bench.yaml"
+
+// findProjectConfig returns the project config in dir or, failing that, in
+// the root of the git repository containing dir. It returns "" when there
+// is none.
+func findProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory %s: %w", dir, err)
+	}
+
+	candidates := []string{dir}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			if d != dir {
+				candidates = append(candidates, d)
+			}
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	for _, d := range candidates {
+		path := filepath.Join(d, projectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to check %s: %w", path, err)
+		}
+	}
+	return "", nil
+}
+
+// loadProjectConfig reads the settings of a project config file, in YAML or
+// JSON, with the files it extends and includes. Keys are flag names, written
+// either as flags ("noise-threshold") or in camelCase ("noiseThreshold").
+func loadProjectConfig(path string) (map[string]interface{}, error) {
+	var settings map[string]interface{}
+	if err := config.Load(path, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// profileSettings returns settings with the named profile laid over the
+// top-level settings. Profiles are listed under "profiles"; an empty name
+// selects the "profile" setting, if any.
+func profileSettings(settings map[string]interface{}, name, path string) (map[string]interface{}, error) {
+	profiles := map[string]interface{}{}
+	if raw, ok := settings["profiles"]; ok {
+		if profiles, ok = raw.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: profiles must map profile names to settings", path)
+		}
+	}
+	if name == "" {
+		name, _ = settings["profile"].(string)
+	}
+
+	merged := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if key != "profiles" {
+			merged[key] = value
+		}
+	}
+	if name == "" {
+		return merged, nil
+	}
+
+	raw, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s: unknown profile %q (no profiles defined)", path, name)
+		}
+		return nil, fmt.Errorf("%s: unknown profile %q (available: %s)", path, name, strings.Join(names, ", "))
+	}
+	profile, ok := raw.(map[string]interface{})
+	if !ok && raw != nil {
+		return nil, fmt.Errorf("%s: profile %q must map settings to values", path, name)
+	}
+	for key, value := range profile {
+		// A profile's key replaces the top-level key however it is spelled
+		for existing := range merged {
+			if configKey(existing) == configKey(key) {
+				delete(merged, existing)
+			}
+		}
+		merged[key] = value
+	}
+	merged["profile"] = name
+	return merged, nil
+}
+
+// configKey normalizes a flag name or config key for matching, so that
+// "track-db", "trackDB" and "track_db" are the same setting
+func configKey(name string) string {
+	name = strings.ToLower(name)
+	name = strings.ReplaceAll(name, "-", "")
+	return strings.ReplaceAll(name, "_", "")
+}
+
+// applyProjectConfig sets flags that were neither given on the command line
+// nor from the environment to the values in settings. Settings for flags of
+// other commands, whose keys are known, are ignored; keys that match no
+// flag at all are errors.
+func applyProjectConfig(flags *pflag.FlagSet, known map[string]bool, settings map[string]interface{}, path string) error {
+	byKey := make(map[string]*pflag.Flag)
+	flags.VisitAll(func(f *pflag.Flag) {
+		byKey[configKey(f.Name)] = f
+	})
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f, ok := byKey[configKey(key)]
+		if !ok {
+			if !known[configKey(key)] {
+				return fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+
+		values := []interface{}{settings[key]}
+		if list, ok := settings[key].([]interface{}); ok {
+			values = list
+		}
+		for _, v := range values {
+			if err := flags.Set(f.Name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: invalid %s: %w", path, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// knownConfigKeys returns the normalized names of every flag of root and
+// its commands
+func knownConfigKeys(root *cobra.Command) map[string]bool {
+	known := make(map[string]bool)
+	add := func(f *pflag.Flag) { known[configKey(f.Name)] = true }
+	for _, cmd := range append([]*cobra.Command{root}, root.Commands()...) {
+		cmd.Flags().VisitAll(add)
+		cmd.PersistentFlags().VisitAll(add)
+	}
+	return known
+}
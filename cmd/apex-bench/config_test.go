@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestFindProjectConfig(t *testing.T) {
+	repo := t.TempDir()
+	sub := filepath.Join(repo, "force-app", "bench")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// No config anywhere
+	path, err := findProjectConfig(sub)
+	if err != nil || path != "" {
+		t.Errorf("findProjectConfig() = %q, %v; want no config", path, err)
+	}
+
+	// Config in the repository root
+	rootConfig := filepath.Join(repo, projectConfigName)
+	if err := os.WriteFile(rootConfig, []byte("iterations: 50\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err = findProjectConfig(sub)
+	if err != nil || path != rootConfig {
+		t.Errorf("findProjectConfig() = %q, %v; want %q", path, err, rootConfig)
+	}
+
+	// Config in the current directory wins
+	localConfig := filepath.Join(sub, projectConfigName)
+	if err := os.WriteFile(localConfig, []byte("iterations: 20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err = findProjectConfig(sub)
+	if err != nil || path != localConfig {
+		t.Errorf("findProjectConfig() = %q, %v; want %q", path, err, localConfig)
+	}
+}
+
+func TestLoadProjectConfig_InvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), projectConfigName)
+	if err := os.WriteFile(path, []byte("iterations: [1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadProjectConfig(path); err == nil || !strings.Contains(err.Error(), "failed to parse config") {
+		t.Errorf("loadProjectConfig() error = %v, want parse error", err)
+	}
+}
+
+func TestLoadProjectConfig_Extends(t *testing.T) {
+	dir := writeBenchmarkDir(t, map[string]string{
+		"base-bench.yaml":             "iterations: 50\nprofiles:\n  ci:\n    org: ci-org\n  nightly:\n    runs: 10\n",
+		"module/" + projectConfigName: "extends: ../base-bench.yaml\nwarmup: 5\nprofiles:\n  ci:\n    runs: 3\n",
+	})
+	settings, err := loadProjectConfig(filepath.Join(dir, "module", projectConfigName))
+	if err != nil {
+		t.Fatalf("loadProjectConfig() error = %v", err)
+	}
+	merged, err := profileSettings(settings, "ci", projectConfigName)
+	if err != nil {
+		t.Fatalf("profileSettings() error = %v", err)
+	}
+	if merged["iterations"] != 50 || merged["warmup"] != 5 || merged["org"] != "ci-org" || merged["runs"] != 3 {
+		t.Errorf("Expected the base's settings and profiles merged with the module's, got %v", merged)
+	}
+	if _, err := profileSettings(settings, "nightly", projectConfigName); err != nil {
+		t.Errorf("Expected the base's profiles to be available, got %v", err)
+	}
+}
+
+func TestApplyProjectConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), projectConfigName)
+	content := `org: team-sandbox
+iterations: 250
+noiseThreshold: 10
+output:
+  - table
+  - json:results.json
+bench:
+  - "A:a.apex"
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := loadProjectConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var org string
+	var outputs []string
+	var iterations int
+	var noiseThreshold float64
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVar(&org, "org", "", "")
+	flags.StringArrayVar(&outputs, "output", nil, "")
+	flags.IntVar(&iterations, "iterations", 100, "")
+	flags.Float64Var(&noiseThreshold, "noise-threshold", 20, "")
+	if err := flags.Parse([]string{"--org", "cli-org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// bench belongs to compare and is ignored here
+	if err := applyProjectConfig(flags, knownConfigKeys(NewRootCmd()), settings, path); err != nil {
+		t.Fatalf("applyProjectConfig() error = %v", err)
+	}
+	if org != "cli-org" {
+		t.Errorf("org = %q, want the command line value cli-org", org)
+	}
+	if iterations != 250 {
+		t.Errorf("iterations = %d, want 250", iterations)
+	}
+	if noiseThreshold != 10 {
+		t.Errorf("noise-threshold = %v, want 10", noiseThreshold)
+	}
+	if len(outputs) != 2 || outputs[0] != "table" || outputs[1] != "json:results.json" {
+		t.Errorf("outputs = %v, want [table json:results.json]", outputs)
+	}
+}
+
+func TestApplyProjectConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     string
+	}{
+		{"unknown setting", map[string]interface{}{"iteratons": 5}, `unknown setting "iteratons"`},
+		{"invalid value", map[string]interface{}{"iterations": "many"}, "invalid iterations"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var iterations int
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.IntVar(&iterations, "iterations", 100, "")
+
+			err := applyProjectConfig(flags, knownConfigKeys(NewRootCmd()), tt.settings, projectConfigName)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("applyProjectConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"org":            "dev-org",
+		"iterations":     100,
+		"noiseThreshold": 20,
+		"profiles": map[string]interface{}{
+			"ci": map[string]interface{}{
+				"org":             "ci-org",
+				"noise-threshold": 5,
+			},
+			"dev": nil,
+		},
+	}
+
+	merged, err := profileSettings(settings, "ci", projectConfigName)
+	if err != nil {
+		t.Fatalf("profileSettings() error = %v", err)
+	}
+	if merged["org"] != "ci-org" || merged["iterations"] != 100 || merged["noise-threshold"] != 5 {
+		t.Errorf("profileSettings() = %v, want ci settings over the top level", merged)
+	}
+	if _, ok := merged["noiseThreshold"]; ok {
+		t.Error("Expected the profile to replace noiseThreshold")
+	}
+	if _, ok := merged["profiles"]; ok {
+		t.Error("Expected profiles to be removed")
+	}
+
+	// Without a profile only the top-level settings apply
+	merged, err = profileSettings(settings, "", projectConfigName)
+	if err != nil {
+		t.Fatalf("profileSettings() error = %v", err)
+	}
+	if merged["org"] != "dev-org" {
+		t.Errorf("org = %v, want dev-org", merged["org"])
+	}
+
+	// The profile setting selects a default profile
+	settings["profile"] = "ci"
+	merged, err = profileSettings(settings, "", projectConfigName)
+	if err != nil {
+		t.Fatalf("profileSettings() error = %v", err)
+	}
+	if merged["org"] != "ci-org" {
+		t.Errorf("org = %v, want ci-org from the default profile", merged["org"])
+	}
+}
+
+func TestProfileSettings_UnknownProfile(t *testing.T) {
+	settings := map[string]interface{}{
+		"profiles": map[string]interface{}{
+			"staging": map[string]interface{}{},
+			"ci":      map[string]interface{}{},
+		},
+	}
+
+	_, err := profileSettings(settings, "prod", projectConfigName)
+	if err == nil || !strings.Contains(err.Error(), "available: ci, staging") {
+		t.Errorf("profileSettings() error = %v, want list of profiles", err)
+	}
+}
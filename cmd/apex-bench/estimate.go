@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// estimateOptions are the flags of an estimate command
+type estimateOptions struct {
+	global     *globalOptions
+	benchmarks int
+	code       string
+	file       string
+	iterations int
+	warmup     int
+	batchSize  int
+	runs       int
+	combine    bool
+	calibrate  bool
+	apiVersion string
+	backend    string
+}
+
+// Calibration runs measure at most this many iterations, enough to time the
+// code without spending long on it
+const (
+	calibrationIterations = 20
+	calibrationWarmup     = 2
+)
+
+// newEstimateCmd creates an estimate command with g as its global options
+func newEstimateCmd(g *globalOptions) *cobra.Command {
+	o := &estimateOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "estimate",
+		Short: "Estimate the executions, time and API requests of a benchmark session",
+		Long: `Estimate what a benchmark session costs before running it: the number
+of Apex executions (sf CLI invocations), the approximate wall time and the
+daily API requests it consumes.
+
+A short calibration run of --code or --file (or of a trivial snippet) times
+an execution and measures its API requests; --calibrate=false skips it and
+only counts executions.`,
+		Args: cobra.NoArgs,
+		RunE: o.run,
+	}
+
+	cmd.Flags().IntVar(&o.benchmarks, "benchmarks", 1, "Number of benchmarks in the session")
+	cmd.Flags().StringVar(&o.code, "code", "", "Inline Apex code to calibrate with (- reads it from stdin)")
+	cmd.Flags().StringVar(&o.file, "file", "", "Path to an Apex code file to calibrate with (- reads stdin)")
+	cmd.Flags().IntVar(&o.iterations, "iterations", 100, "Number of measurement iterations")
+	cmd.Flags().IntVar(&o.warmup, "warmup", 10, "Number of warmup iterations")
+	cmd.Flags().IntVar(&o.batchSize, "batch-size", 0, "Iterations timed together per sample (0 starts at 1 and doubles while batches read 0 ms)")
+	cmd.Flags().IntVar(&o.runs, "runs", 1, "Number of complete runs per benchmark")
+	cmd.Flags().BoolVar(&o.combine, "combine", false, "Estimate for all benchmarks in a single Apex script per run")
+	cmd.Flags().BoolVar(&o.calibrate, "calibrate", true, "Time one short execution against the org to estimate wall time and API requests")
+	cmd.Flags().StringVar(&o.apiVersion, "api-version", "", "Salesforce API version to execute with, e.g. 62.0 (default: org default)")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+
+	cmd.MarkFlagsMutuallyExclusive("code", "file")
+	return cmd
+}
+
+func (o *estimateOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	plan := sessionPlan{
+		Benchmarks: o.benchmarks,
+		Iterations: o.iterations,
+		Warmup:     o.warmup,
+		Runs:       o.runs,
+		Parallel:   g.parallel,
+		Combine:    o.combine,
+		Delay:      g.delay,
+	}
+	if err := plan.validate(); err != nil {
+		return err
+	}
+	config := types.BenchmarkConfig{Outputs: g.outputs, Output: "table"}
+	targets, err := parseOutputTargets(config)
+	if err != nil {
+		return err
+	}
+
+	est := plan.estimate(nil)
+	if o.calibrate {
+		code := "Integer calibration = 0;"
+		if o.code != "" || o.file != "" {
+			if code, err = g.readCode(o.code, o.file, 0, cmd.InOrStdin()); err != nil {
+				return err
+			}
+		}
+
+		b, err := executor.LookupBackend(o.backend)
+		if err != nil {
+			return err
+		}
+		exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+		if err != nil {
+			return err
+		}
+		usage := func() (executor.APIUsage, error) { return executor.GetAPIUsage(org) }
+		if !b.RequiresOrg {
+			usage = nil
+		}
+		spec := types.CodeSpec{
+			Name:       "Calibration",
+			UserCode:   strings.TrimSpace(code),
+			Iterations: min(o.iterations, calibrationIterations),
+			Warmup:     min(o.warmup, calibrationWarmup),
+			BatchSize:  o.batchSize,
+			Namespace:  g.namespace,
+			Vars:       g.benchVars(nil),
+		}
+		cal, err := g.calibrate(commandContext(cmd), exec, org, spec, o.apiVersion, usage)
+		if err != nil {
+			return err
+		}
+		est = plan.estimate(&cal)
+	}
+
+	return g.writeReports(targets, func(format string, w io.Writer) error {
+		if format == "json" {
+			return reporter.PrintJSON(est, w)
+		}
+		printEstimate(est, w)
+		return nil
+	})
+}
+
+// sessionPlan is the shape of a benchmark session to estimate
+type sessionPlan struct {
+	Benchmarks int
+	Iterations int
+	Warmup     int
+	Runs       int
+	Parallel   int
+	Combine    bool
+	Delay      time.Duration // Pause between executions
+}
+
+// validate rejects plans no session could have
+func (p sessionPlan) validate() error {
+	switch {
+	case p.Benchmarks < 1:
+		return fmt.Errorf("--benchmarks must be positive, got %d", p.Benchmarks)
+	case p.Runs < 1:
+		return fmt.Errorf("--runs must be positive, got %d", p.Runs)
+	case p.Iterations < 1 || p.Warmup < 0:
+		return fmt.Errorf("--iterations must be positive and --warmup not negative")
+	}
+	return nil
+}
+
+// calibration is what one short execution measured
+type calibration struct {
+	Iterations   int           // Iterations run, warmup included
+	Elapsed      time.Duration // Duration of the whole execution
+	IterationMs  float64       // Average wall time of one iteration
+	APIRequests  int           // Daily API requests the execution used, when known
+	APIRemaining int           // Daily API requests left afterwards, when known
+	APIKnown     bool
+}
+
+// calibrate runs spec once, timing the execution and, when usage is given,
+// measuring the API requests it consumes
+func (g *globalOptions) calibrate(ctx context.Context, exec executor.Executor, org string, spec types.CodeSpec, apiVersion string, usage func() (executor.APIUsage, error)) (calibration, error) {
+	var before executor.APIUsage
+	if usage != nil {
+		var err error
+		if before, err = usage(); err != nil {
+			return calibration{}, err
+		}
+	}
+
+	g.progressf("Calibrating with one execution of %d iterations...\n", spec.Iterations+spec.Warmup)
+	config := types.BenchmarkConfig{Runs: 1, Parallel: 1, Aggregate: "median", APIVersion: apiVersion}
+	start := time.Now()
+	result, err := g.newRunner(exec, org, config).Run(ctx, spec)
+	if err != nil {
+		return calibration{}, fmt.Errorf("calibration failed: %w", err)
+	}
+	cal := calibration{
+		Iterations:  spec.Iterations + spec.Warmup,
+		Elapsed:     time.Since(start),
+		IterationMs: result.AvgWallMs,
+	}
+
+	if usage != nil {
+		after, err := usage()
+		if err != nil {
+			return calibration{}, err
+		}
+		cal.APIRequests = max(after.Used-before.Used, 0)
+		cal.APIRemaining = after.Remaining()
+		cal.APIKnown = true
+	}
+	return cal, nil
+}
+
+// sessionEstimate is the predicted cost of a session
+type sessionEstimate struct {
+	Executions   int     `json:"executions"`
+	Calibrated   bool    `json:"calibrated"`
+	WallSeconds  float64 `json:"wallSeconds,omitempty"`
+	APIRequests  *int    `json:"apiRequests,omitempty"`
+	APIRemaining *int    `json:"apiRemaining,omitempty"` // Daily API requests left before the session
+}
+
+// estimate predicts the session's cost. Runs of a benchmark execute in
+// parallel and benchmarks one after another, so wall time grows with the
+// waves of parallel runs. An execution costs the calibrated overhead plus
+// the time of the iterations it runs, and every wave after the first waits
+// out the delay.
+func (p sessionPlan) estimate(cal *calibration) sessionEstimate {
+	scripts := p.Benchmarks
+	perScript := 1
+	if p.Combine {
+		scripts, perScript = 1, p.Benchmarks
+	}
+	est := sessionEstimate{Executions: scripts * p.Runs}
+	if cal == nil {
+		return est
+	}
+
+	est.Calibrated = true
+	iterationSec := cal.IterationMs / 1000
+	overhead := max(cal.Elapsed.Seconds()-float64(cal.Iterations)*iterationSec, 0)
+	execution := overhead + float64(perScript*(p.Warmup+p.Iterations))*iterationSec
+	waves := int(math.Ceil(float64(p.Runs) / float64(max(p.Parallel, 1))))
+	est.WallSeconds = float64(scripts*waves)*execution + float64(scripts*waves-1)*p.Delay.Seconds()
+
+	if cal.APIKnown {
+		requests := est.Executions * cal.APIRequests
+		remaining := cal.APIRemaining
+		est.APIRequests, est.APIRemaining = &requests, &remaining
+	}
+	return est
+}
+
+// printEstimate writes an estimate as text
+func printEstimate(est sessionEstimate, w io.Writer) {
+	fmt.Fprintf(w, "Executions:   %d\n", est.Executions)
+	if !est.Calibrated {
+		fmt.Fprintln(w, "Wall time and API requests need a calibration run (--calibrate)")
+		return
+	}
+	fmt.Fprintf(w, "Wall time:    ~%s\n", time.Duration(est.WallSeconds*float64(time.Second)).Round(time.Second))
+	if est.APIRequests == nil {
+		fmt.Fprintln(w, "API requests: not counted by this backend")
+		return
+	}
+	fmt.Fprintf(w, "API requests: ~%d of %d left today\n", *est.APIRequests, *est.APIRemaining)
+	if *est.APIRequests > *est.APIRemaining {
+		fmt.Fprintln(w, "Warning: the session needs more API requests than the org has left today")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestSessionPlanEstimate(t *testing.T) {
+	cal := calibration{Iterations: 10, Elapsed: 3 * time.Second, IterationMs: 100, APIRequests: 4, APIRemaining: 50, APIKnown: true}
+
+	tests := []struct {
+		name       string
+		plan       sessionPlan
+		executions int
+		wall       float64
+	}{
+		// 2s overhead plus 20 iterations of 0.1s per execution
+		{"separate", sessionPlan{Benchmarks: 3, Iterations: 15, Warmup: 5, Runs: 4, Parallel: 2}, 12, 3 * 2 * 4},
+		{"combined", sessionPlan{Benchmarks: 3, Iterations: 15, Warmup: 5, Runs: 4, Parallel: 4, Combine: true}, 4, 2 + 3*2},
+		// Each of the 6 waves after the first waits out the delay
+		{"delayed", sessionPlan{Benchmarks: 3, Iterations: 15, Warmup: 5, Runs: 4, Parallel: 2, Delay: time.Second}, 12, 3*2*4 + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			est := tt.plan.estimate(&cal)
+			if est.Executions != tt.executions || est.WallSeconds != tt.wall {
+				t.Errorf("estimate() = %d executions, %vs, want %d, %vs", est.Executions, est.WallSeconds, tt.executions, tt.wall)
+			}
+			if est.APIRequests == nil || *est.APIRequests != 4*tt.executions {
+				t.Errorf("Expected %d API requests, got %v", 4*tt.executions, est.APIRequests)
+			}
+		})
+	}
+
+	if est := tests[0].plan.estimate(nil); est.Calibrated || est.Executions != 12 {
+		t.Errorf("Expected an uncalibrated count of executions, got %+v", est)
+	}
+}
+
+func TestPrintEstimate(t *testing.T) {
+	requests, remaining := 60, 50
+	var buf bytes.Buffer
+	printEstimate(sessionEstimate{Executions: 12, Calibrated: true, WallSeconds: 90.4, APIRequests: &requests, APIRemaining: &remaining}, &buf)
+
+	output := buf.String()
+	for _, want := range []string{"Executions:   12", "Wall time:    ~1m30s", "API requests: ~60 of 50 left today", "Warning: the session needs more API requests"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	calls := 0
+	usage := func() (executor.APIUsage, error) {
+		calls++
+		return executor.APIUsage{Used: 100 + 3*calls, Max: 1000}, nil
+	}
+	spec := types.CodeSpec{Name: "Calibration", UserCode: "Integer i = 0;", Iterations: 5, Warmup: 1}
+
+	cal, err := g.calibrate(context.Background(), executor.NewSimulatedExecutor(), "", spec, "", usage)
+	if err != nil {
+		t.Fatalf("calibrate() error = %v", err)
+	}
+	if cal.Iterations != 6 || cal.IterationMs <= 0 || !cal.APIKnown || cal.APIRequests != 3 || cal.APIRemaining != 894 {
+		t.Errorf("Unexpected calibration: %+v", cal)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// example is a ready-to-run suite answering a common Apex question
+type example struct {
+	Name        string
+	Description string
+	Suite       string // Suite file content
+}
+
+// examples are listed in this order
+var examples = []example{
+	{
+		Name:        "string-concat",
+		Description: "String += in a loop vs String.join over a list",
+		Suite: `# Building a string piece by piece: += copies the string every time,
+# String.join builds it once
+benchmarks:
+  - name: "String +="
+    code: |
+      String s = '';
+      for (Integer k = 0; k < 50; k++) {
+          s += 'item' + k + ',';
+      }
+  - name: "String.join"
+    code: |
+      List<String> parts = new List<String>();
+      for (Integer k = 0; k < 50; k++) {
+          parts.add('item' + k);
+      }
+      String s = String.join(parts, ',');
+
+iterations: 200
+warmup: 20
+runs: 3
+trackHeap: true
+`,
+	},
+	{
+		Name:        "map-vs-list",
+		Description: "Finding a value by scanning a List vs Map.get vs Set.contains",
+		Suite: `# Looking up one value among 1000: a List is scanned, a Map or Set
+# finds it by hash
+benchmarks:
+  - name: "List scan"
+    setup: |
+      List<Integer> values = new List<Integer>();
+      for (Integer k = 0; k < 1000; k++) {
+          values.add(k);
+      }
+    code: |
+      Boolean found = false;
+      for (Integer v : values) {
+          if (v == 999) {
+              found = true;
+              break;
+          }
+      }
+  - name: "Map.get"
+    setup: |
+      Map<Integer, Integer> byValue = new Map<Integer, Integer>();
+      for (Integer k = 0; k < 1000; k++) {
+          byValue.put(k, k);
+      }
+    code: "Boolean found = byValue.get(999) != null;"
+  - name: "Set.contains"
+    setup: |
+      Set<Integer> valueSet = new Set<Integer>();
+      for (Integer k = 0; k < 1000; k++) {
+          valueSet.add(k);
+      }
+    code: "Boolean found = valueSet.contains(999);"
+
+iterations: 200
+warmup: 20
+runs: 3
+`,
+	},
+	{
+		Name:        "soql-in-loop",
+		Description: "One SOQL query per record vs one bulk query",
+		Suite: `# Querying records one at a time vs all at once. Each iteration of
+# "Query per record" uses 10 of the 100 queries a transaction allows, so
+# the iterations are few; the inserted accounts are rolled back.
+benchmarks:
+  - name: "Query per record"
+    setup: |
+      List<Account> accounts = new List<Account>();
+      for (Integer k = 0; k < 10; k++) {
+          accounts.add(new Account(Name = 'Bench ' + k));
+      }
+      insert accounts;
+    code: |
+      for (Account a : accounts) {
+          Account fetched = [SELECT Id, Name FROM Account WHERE Id = :a.Id];
+      }
+  - name: "Bulk query"
+    setup: |
+      List<Account> accounts = new List<Account>();
+      for (Integer k = 0; k < 10; k++) {
+          accounts.add(new Account(Name = 'Bench ' + k));
+      }
+      insert accounts;
+    code: "Map<Id, Account> fetched = new Map<Id, Account>([SELECT Id, Name FROM Account WHERE Id IN :accounts]);"
+
+iterations: 5
+warmup: 1
+batchSize: 1
+runs: 3
+trackDB: true
+`,
+	},
+	{
+		Name:        "loop-styles",
+		Description: "Indexed for loops, with and without a cached size, vs for-each",
+		Suite: `# Summing a list of 200 numbers with different loop styles
+benchmarks:
+  - name: "Indexed for"
+    setup: &numbers |
+      List<Integer> numbers = new List<Integer>();
+      for (Integer k = 0; k < 200; k++) {
+          numbers.add(k);
+      }
+    code: |
+      Integer sum = 0;
+      for (Integer k = 0; k < numbers.size(); k++) {
+          sum += numbers[k];
+      }
+  - name: "Cached size"
+    setup: *numbers
+    code: |
+      Integer sum = 0;
+      Integer size = numbers.size();
+      for (Integer k = 0; k < size; k++) {
+          sum += numbers[k];
+      }
+  - name: "For-each"
+    setup: *numbers
+    code: |
+      Integer sum = 0;
+      for (Integer n : numbers) {
+          sum += n;
+      }
+
+iterations: 200
+warmup: 20
+runs: 3
+`,
+	},
+}
+
+// examplesOptions are the flags of an examples command
+type examplesOptions struct {
+	global *globalOptions
+	out    string
+}
+
+// newExamplesCmd creates an examples command with g as its global options
+func newExamplesCmd(g *globalOptions) *cobra.Command {
+	o := &examplesOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "examples [name]",
+		Short: "List or print ready-to-run example suites",
+		Long: `List the example suites, or print one to start from. Each example is a
+suite file comparing common ways of doing something in Apex; save it and
+run it with the suite command:
+
+  apex-bench examples map-vs-list --out map-vs-list.yaml
+  apex-bench suite map-vs-list.yaml`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: exampleNames(),
+		RunE:      o.run,
+	}
+
+	cmd.Flags().StringVar(&o.out, "out", "", "Write the example suite to this file instead of stdout")
+	return cmd
+}
+
+func (o *examplesOptions) run(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return listExamples(cmd.OutOrStdout())
+	}
+	ex, err := findExample(args[0])
+	if err != nil {
+		return err
+	}
+	if o.out == "" {
+		_, err := io.WriteString(cmd.OutOrStdout(), ex.Suite)
+		return err
+	}
+	if err := os.WriteFile(o.out, []byte(ex.Suite), 0o644); err != nil {
+		return fmt.Errorf("failed to write example: %w", err)
+	}
+	o.global.progressf("Example %s written to %s; run it with: apex-bench suite %s\n", ex.Name, o.out, o.out)
+	return nil
+}
+
+// exampleNames returns the names of the examples, in order
+func exampleNames() []string {
+	names := make([]string, len(examples))
+	for i, ex := range examples {
+		names[i] = ex.Name
+	}
+	return names
+}
+
+// findExample returns the example called name
+func findExample(name string) (example, error) {
+	for _, ex := range examples {
+		if ex.Name == name {
+			return ex, nil
+		}
+	}
+	return example{}, fmt.Errorf("unknown example %q (available: %s)", name, strings.Join(exampleNames(), ", "))
+}
+
+// listExamples writes the name and description of every example
+func listExamples(w io.Writer) error {
+	width := 0
+	for _, ex := range examples {
+		width = max(width, len(ex.Name))
+	}
+	for _, ex := range examples {
+		if _, err := fmt.Fprintf(w, "%-*s  %s\n", width, ex.Name, ex.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
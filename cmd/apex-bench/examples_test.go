@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+)
+
+func TestExamples_Valid(t *testing.T) {
+	for _, ex := range examples {
+		t.Run(ex.Name, func(t *testing.T) {
+			config, err := parseSuite([]byte(ex.Suite), ex.Name)
+			if err != nil {
+				t.Fatalf("parseSuite() error = %v", err)
+			}
+			if len(config.Benchmarks) < 2 {
+				t.Errorf("Expected an example to compare at least 2 benchmarks, got %d", len(config.Benchmarks))
+			}
+			for _, benchSpec := range config.Benchmarks {
+				spec, err := bench.NewCodeSpec(benchSpec, config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := generator.Generate(spec); err != nil {
+					t.Errorf("benchmark %s: %v", benchSpec.Name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExamplesCommand(t *testing.T) {
+	var buf bytes.Buffer
+	examplesCmd := newExamplesCmd(&globalOptions{})
+	examplesCmd.SetOut(&buf)
+
+	if err := examplesCmd.RunE(examplesCmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "map-vs-list  ") || !strings.Contains(buf.String(), "soql-in-loop") {
+		t.Errorf("Expected the examples listed, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := examplesCmd.RunE(examplesCmd, []string{"string-concat"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `name: "String.join"`) {
+		t.Errorf("Expected the suite printed, got: %s", buf.String())
+	}
+
+	examplesOut := filepath.Join(t.TempDir(), "suite.yaml")
+	setFlags(t, examplesCmd, "out", examplesOut)
+	if err := examplesCmd.RunE(examplesCmd, []string{"loop-styles"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSuite(examplesOut); err != nil {
+		t.Errorf("Expected a loadable suite, got %v", err)
+	}
+
+	if err := examplesCmd.RunE(examplesCmd, []string{"missing"}); err == nil || !strings.Contains(err.Error(), "available: string-concat") {
+		t.Errorf("Expected an unknown example error, got %v", err)
+	}
+}
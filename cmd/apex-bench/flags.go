@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/exporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/storage"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/telemetry"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// globalOptions are the flags shared by every command of a root command,
+// with what the command derives from them once they are resolved. Each root
+// has options of its own, so separate roots can be executed concurrently
+// and repeatedly.
+type globalOptions struct {
+	org       string
+	namespace string
+	vars      []string
+	redact    []string
+	outputs   []string
+	uploads   []string
+	exports   []string
+	copy      bool
+	parallel  int
+	maxExecs  int
+	orgLimits []string
+	timeout   time.Duration
+	delay     time.Duration
+	jitter    time.Duration
+	verbose   bool
+	quiet     bool
+	logFormat string
+	tempDir   string
+	keepTemp  bool
+	// noColor disables colored output; NO_COLOR and non-terminal output are
+	// detected automatically
+	noColor bool
+	// configPath selects the project config file instead of discovering one
+	configPath string
+	// profileName selects a profile of the project config
+	profileName string
+
+	// redactor masks the --redact patterns and secret variable values in
+	// logs, reports and messages; nil when there is nothing to mask
+	redactor *redact.Redactor
+	// out and errOut are the writers of the running command, which reports
+	// and messages go to; nil before the command runs, for os.Stdout and
+	// os.Stderr
+	out, errOut io.Writer
+
+	// Stand-ins for tests: git runs git in a directory, clipboardTools lists
+	// the clipboard tools to try and telemetryStore locates telemetry
+	// settings. nil uses git, the platform's tools and the user's config
+	// directory.
+	git            func(dir string, args ...string) ([]byte, error)
+	clipboardTools func() []clipboardTool
+	telemetryStore func() (telemetry.Store, error)
+}
+
+// envFlags maps persistent flags to the environment variables used when the
+// flag is not given on the command line. Precedence is flag, then
+// environment variable, then project config, then the flag default.
+var envFlags = []struct {
+	flag string
+	env  string
+}{
+	{"org", "APEX_BENCH_ORG"},
+	{"namespace", "APEX_BENCH_NAMESPACE"},
+	{"redact", "APEX_BENCH_REDACT"},
+	{"output", "APEX_BENCH_OUTPUT"},
+	{"upload", "APEX_BENCH_UPLOAD"},
+	{"export", "APEX_BENCH_EXPORT"},
+	{"copy-result", "APEX_BENCH_COPY_RESULT"},
+	{"parallel", "APEX_BENCH_PARALLEL"},
+	{"max-executions", "APEX_BENCH_MAX_EXECUTIONS"},
+	{"org-limit", "APEX_BENCH_ORG_LIMIT"},
+	{"timeout", "APEX_BENCH_TIMEOUT"},
+	{"delay", "APEX_BENCH_DELAY"},
+	{"jitter", "APEX_BENCH_JITTER"},
+	{"verbose", "APEX_BENCH_VERBOSE"},
+	{"quiet", "APEX_BENCH_QUIET"},
+	{"log-format", "APEX_BENCH_LOG_FORMAT"},
+	{"temp-dir", "APEX_BENCH_TEMP_DIR"},
+	{"keep-temp", "APEX_BENCH_KEEP_TEMP"},
+	{"no-color", "APEX_BENCH_NO_COLOR"},
+	{"config", "APEX_BENCH_CONFIG"},
+	{"profile", "APEX_BENCH_PROFILE"},
+}
+
+// addFlags binds the persistent flags to the options
+func (g *globalOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&g.org, "org", "", "Target Salesforce org (uses default if not specified)")
+	flags.StringVar(&g.namespace, "namespace", "", "Managed package namespace substituted for %%%NAMESPACE%%% and %%%NAMESPACE_DOT%%% in benchmark code")
+	flags.StringArrayVar(&g.vars, "var", nil, "Value substituted for ${NAME} in benchmark code as NAME=value, ahead of the suite's vars and the environment; repeatable")
+	flags.StringArrayVar(&g.redact, "redact", nil, "Mask matches of this regular expression, or with env:NAME the value of an environment variable, in saved logs, reports and messages; repeatable")
+	flags.StringArrayVar(&g.outputs, "output", nil, "Output format: json, table, optionally with a file as format:path; repeatable (default: json for run, table for compare)")
+	flags.StringArrayVar(&g.uploads, "upload", nil, "Upload the JSON report after the run to a URL such as s3://bucket/path, gs://bucket/path, file:///dir or an https PUT URL; repeatable")
+	flags.StringArrayVar(&g.exports, "export", nil, "Send result metrics to a monitoring service: "+strings.Join(exporter.Names(), ", ")+", with its API key in the environment; repeatable")
+	flags.BoolVar(&g.copy, "copy-result", false, "Also copy the report, in the first --output format, to the system clipboard")
+	flags.IntVar(&g.parallel, "parallel", 1, "Maximum concurrent executions")
+	flags.IntVar(&g.maxExecs, "max-executions", 0, "Maximum concurrent executions of the whole process, shared by every benchmark (0 leaves only --parallel)")
+	flags.StringArrayVar(&g.orgLimits, "org-limit", nil, "Maximum concurrent executions against one org as org=N, for orgs that limit concurrent Apex; repeatable")
+	flags.DurationVar(&g.timeout, "timeout", 0, "Limit for a single execution, e.g. 5m (0 means none)")
+	flags.DurationVar(&g.delay, "delay", 0, "Pause between executions, e.g. 2s, to spare shared orgs (0 means none)")
+	flags.DurationVar(&g.jitter, "jitter", 0, "Vary each --delay pause randomly by up to this much either way, e.g. 500ms")
+	flags.BoolVar(&g.verbose, "verbose", false, "Show per-run details")
+	flags.BoolVarP(&g.quiet, "quiet", "q", false, "Only print warnings, errors and results")
+	flags.StringVar(&g.tempDir, "temp-dir", "", "Directory for the generated .apex scripts passed to the sf CLI, created if missing (default: the system temporary directory)")
+	flags.BoolVar(&g.keepTemp, "keep-temp", false, "Keep the generated .apex scripts after their executions, for debugging")
+	flags.StringVar(&g.logFormat, "log-format", "text", "Format of progress, warnings and errors on stderr: text, or json for one record per message with per-run durations")
+	flags.BoolVar(&g.noColor, "no-color", false, "Disable colored output")
+	flags.StringVar(&g.configPath, "config", "", "Project config file (default: "+projectConfigName+" in the current directory or repository root)")
+	flags.StringVar(&g.profileName, "profile", "", "Project config profile to use, e.g. ci")
+}
+
+// measureOptions are the measurement and reporting flags shared by run,
+// compare and compare-commits, declared once so their defaults agree
+type measureOptions struct {
+	iterations     int
+	warmup         int
+	batchSize      int
+	runs           int
+	trackHeap      bool
+	trackDB        bool
+	aggregate      string
+	noiseThreshold float64
+	metrics        string
+	out            string
+	apiVersion     string
+	backend        string
+}
+
+// addFlags binds the shared measurement flags to the options
+func (m *measureOptions) addFlags(flags *pflag.FlagSet) {
+	flags.IntVar(&m.iterations, "iterations", 100, "Number of measurement iterations")
+	flags.IntVar(&m.warmup, "warmup", 10, "Number of warmup iterations")
+	flags.IntVar(&m.batchSize, "batch-size", 0, "Iterations timed together per sample (0 starts at 1 and doubles while batches read 0 ms)")
+	flags.IntVar(&m.runs, "runs", 1, "Number of complete runs for aggregation")
+	flags.BoolVar(&m.trackHeap, "track-heap", false, "Enable heap usage tracking")
+	flags.BoolVar(&m.trackDB, "track-db", false, "Enable DML/SOQL tracking")
+	flags.StringVar(&m.aggregate, "aggregate", "mean", "How runs are combined: mean, median, min, trimmed-mean")
+	flags.Float64Var(&m.noiseThreshold, "noise-threshold", 20, "Flag results whose run-to-run CPU variation exceeds this percentage")
+	flags.StringVar(&m.metrics, "metrics", "cpu,heap,db", "Metric groups shown in table output: cpu, wall, heap, db")
+	flags.StringVar(&m.out, "out", "", "Write results to this file instead of stdout")
+	flags.StringVar(&m.apiVersion, "api-version", "", "Salesforce API version to execute with, e.g. 62.0 (default: org default)")
+	flags.StringVar(&m.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+}
+
+// applyEnvFlags sets flags that were not given on the command line from
+// their APEX_BENCH_* environment variables. APEX_BENCH_OUTPUT,
+// APEX_BENCH_UPLOAD, APEX_BENCH_EXPORT and APEX_BENCH_ORG_LIMIT may list
+// several values separated by commas.
+func applyEnvFlags(flags *pflag.FlagSet) error {
+	for _, ef := range envFlags {
+		f := flags.Lookup(ef.flag)
+		if f == nil || f.Changed {
+			continue
+		}
+		value := os.Getenv(ef.env)
+		if value == "" {
+			continue
+		}
+
+		values := []string{value}
+		if ef.flag == "output" || ef.flag == "upload" || ef.flag == "export" || ef.flag == "org-limit" {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if err := flags.Set(ef.flag, strings.TrimSpace(v)); err != nil {
+				return fmt.Errorf("invalid %s: %w", ef.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveFlags fills in the flags of cmd not given on the command line,
+// first from the environment and then from the project config, and checks
+// the result
+func (g *globalOptions) resolveFlags(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	if err := applyEnvFlags(flags); err != nil {
+		return err
+	}
+
+	path := g.configPath
+	if path == "" {
+		found, err := findProjectConfig(".")
+		if err != nil {
+			return err
+		}
+		path = found
+	}
+	if path != "" {
+		settings, err := loadProjectConfig(path)
+		if err != nil {
+			return err
+		}
+		if settings, err = profileSettings(settings, g.profileName, path); err != nil {
+			return err
+		}
+		if err := applyProjectConfig(flags, knownConfigKeys(cmd.Root()), settings, path); err != nil {
+			return err
+		}
+		g.verbosef("Using config %s\n", path)
+		if g.profileName != "" {
+			g.verbosef("Using profile %s\n", g.profileName)
+		}
+	} else if g.profileName != "" {
+		return fmt.Errorf("--profile %s needs a project config (%s)", g.profileName, projectConfigName)
+	}
+
+	if g.verbose && g.quiet {
+		return fmt.Errorf("--verbose and --quiet cannot be combined")
+	}
+	if err := checkLogFormat(g.logFormat); err != nil {
+		return err
+	}
+	if g.maxExecs < 0 {
+		return fmt.Errorf("--max-executions cannot be negative, got %d", g.maxExecs)
+	}
+	if g.delay < 0 || g.jitter < 0 {
+		return fmt.Errorf("--delay and --jitter cannot be negative")
+	}
+	if g.jitter > 0 && g.delay == 0 {
+		return fmt.Errorf("--jitter needs --delay")
+	}
+	for _, dest := range g.uploads {
+		if err := storage.Check(dest); err != nil {
+			return err
+		}
+	}
+	for _, name := range g.exports {
+		if err := exporter.Check(name); err != nil {
+			return err
+		}
+	}
+	if _, err := parseOrgLimits(g.orgLimits); err != nil {
+		return err
+	}
+	if _, err := parseVars(g.vars); err != nil {
+		return err
+	}
+	r, err := g.newRedactor()
+	if err != nil {
+		return err
+	}
+	g.redactor = r
+	return nil
+}
+
+// parseOrgLimits parses --org-limit values of the form org=N
+func parseOrgLimits(values []string) (map[string]int, error) {
+	limits := make(map[string]int, len(values))
+	for _, value := range values {
+		org, n, ok := strings.Cut(value, "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if !ok || strings.TrimSpace(org) == "" || err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid --org-limit %q (expected org=N with N positive)", value)
+		}
+		limits[strings.TrimSpace(org)] = limit
+	}
+	return limits, nil
+}
+
+// parseVars parses --var values of the form NAME=value
+func parseVars(values []string) (map[string]string, error) {
+	vars := make(map[string]string, len(values))
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, "=")
+		if !ok || !generator.VarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid --var %q (expected NAME=value with NAME of letters, digits and underscores)", value)
+		}
+		vars[name] = v
+	}
+	return vars, nil
+}
+
+// benchVars returns vars, e.g. a suite's, overridden by the --var values
+func (g *globalOptions) benchVars(vars map[string]string) map[string]string {
+	flagVars, _ := parseVars(g.vars) // Checked by resolveFlags
+	if len(flagVars) == 0 {
+		return vars
+	}
+	merged := make(map[string]string, len(vars)+len(flagVars))
+	for name, value := range vars {
+		merged[name] = value
+	}
+	for name, value := range flagVars {
+		merged[name] = value
+	}
+	return merged
+}
+
+// optionFlags maps the types.BenchmarkConfig fields named by orchestrator
+// errors to the flags that set them
+var optionFlags = map[string]string{
+	"Baseline":      "--baseline",
+	"Cache":         "--cache",
+	"CacheMaxAge":   "--cache-max-age",
+	"KeepGoing":     "--keep-going",
+	"MinSuccessful": "--min-successful-runs",
+	"PerUnits":      "--per-units",
+	"QueryPlan":     "--query-plan",
+	"RelativeTo":    "--relative-to",
+	"Runs":          "--runs",
+	"TrackDB":       "--track-db",
+	"TrackHeap":     "--track-heap",
+	"Unchanged":     "--changed-only",
+}
+
+// flagError names the settings of an orchestrator.OptionError by their
+// flags; other errors are returned as they are
+func flagError(err error) error {
+	optionErr, ok := err.(*orchestrator.OptionError)
+	if !ok {
+		return err
+	}
+	return &flagOptionError{optionErr}
+}
+
+// flagOptionError is an orchestrator.OptionError worded for the command line
+type flagOptionError struct {
+	*orchestrator.OptionError
+}
+
+func (e *flagOptionError) Error() string {
+	return e.Message(func(field string) string {
+		if flag, ok := optionFlags[field]; ok {
+			return flag
+		}
+		return field
+	})
+}
+
+func (e *flagOptionError) Unwrap() error { return e.OptionError }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newEnvTestFlags returns a flag set shaped like the persistent flags,
+// bound to local variables
+func newEnvTestFlags(org *string, outputs *[]string, parallel *int) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVar(org, "org", "", "")
+	flags.StringArrayVar(outputs, "output", nil, "")
+	flags.IntVar(parallel, "parallel", 1, "")
+	return flags
+}
+
+func TestApplyEnvFlags_EnvironmentFallback(t *testing.T) {
+	t.Setenv("APEX_BENCH_ORG", "ci-org")
+	t.Setenv("APEX_BENCH_OUTPUT", "table, json:results.json")
+	t.Setenv("APEX_BENCH_PARALLEL", "4")
+
+	var org string
+	var outputs []string
+	var parallel int
+	flags := newEnvTestFlags(&org, &outputs, &parallel)
+	if err := flags.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyEnvFlags(flags); err != nil {
+		t.Fatalf("applyEnvFlags() error = %v", err)
+	}
+	if org != "ci-org" {
+		t.Errorf("org = %q, want ci-org", org)
+	}
+	if len(outputs) != 2 || outputs[0] != "table" || outputs[1] != "json:results.json" {
+		t.Errorf("outputs = %v, want [table json:results.json]", outputs)
+	}
+	if parallel != 4 {
+		t.Errorf("parallel = %d, want 4", parallel)
+	}
+}
+
+func TestApplyEnvFlags_FlagTakesPrecedence(t *testing.T) {
+	t.Setenv("APEX_BENCH_ORG", "ci-org")
+	t.Setenv("APEX_BENCH_OUTPUT", "table")
+
+	var org string
+	var outputs []string
+	var parallel int
+	flags := newEnvTestFlags(&org, &outputs, &parallel)
+	if err := flags.Parse([]string{"--org", "cli-org", "--output", "json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyEnvFlags(flags); err != nil {
+		t.Fatalf("applyEnvFlags() error = %v", err)
+	}
+	if org != "cli-org" {
+		t.Errorf("org = %q, want cli-org", org)
+	}
+	if len(outputs) != 1 || outputs[0] != "json" {
+		t.Errorf("outputs = %v, want [json]", outputs)
+	}
+}
+
+func TestApplyEnvFlags_InvalidValue(t *testing.T) {
+	t.Setenv("APEX_BENCH_PARALLEL", "many")
+
+	var org string
+	var outputs []string
+	var parallel int
+	flags := newEnvTestFlags(&org, &outputs, &parallel)
+	if err := flags.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err := applyEnvFlags(flags)
+	if err == nil || !strings.Contains(err.Error(), "APEX_BENCH_PARALLEL") {
+		t.Errorf("applyEnvFlags() error = %v, want error naming APEX_BENCH_PARALLEL", err)
+	}
+}
+
+func TestApplyEnvFlags_VerboseAndQuiet(t *testing.T) {
+	g := &globalOptions{verbose: true, quiet: true}
+	err := g.resolveFlags(&cobra.Command{})
+	if err == nil {
+		t.Error("Expected error when --verbose and --quiet are combined")
+	}
+}
+
+func TestParseOrgLimits(t *testing.T) {
+	limits, err := parseOrgLimits([]string{"dev=2", " prod = 1 "})
+	if err != nil {
+		t.Fatalf("parseOrgLimits() error = %v", err)
+	}
+	if len(limits) != 2 || limits["dev"] != 2 || limits["prod"] != 1 {
+		t.Errorf("parseOrgLimits() = %v", limits)
+	}
+
+	for _, value := range []string{"dev", "dev=0", "=2", "dev=many"} {
+		if _, err := parseOrgLimits([]string{value}); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := parseVars([]string{"ACCOUNT_ID=001000000000001", "FILTER=Name = 'a=b'", "EMPTY="})
+	if err != nil {
+		t.Fatalf("parseVars() error = %v", err)
+	}
+	if len(vars) != 3 || vars["ACCOUNT_ID"] != "001000000000001" || vars["FILTER"] != "Name = 'a=b'" || vars["EMPTY"] != "" {
+		t.Errorf("parseVars() = %v", vars)
+	}
+
+	for _, value := range []string{"NAME", "=1", "1ST=a", "A-B=c"} {
+		if _, err := parseVars([]string{value}); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestBenchVars(t *testing.T) {
+	g := &globalOptions{}
+	suite := map[string]string{"SIZE": "100", "OBJECT": "Account"}
+	if got := g.benchVars(suite); len(got) != 2 || got["SIZE"] != "100" {
+		t.Errorf("benchVars() without --var = %v", got)
+	}
+
+	g.vars = []string{"SIZE=200"}
+	got := g.benchVars(suite)
+	if got["SIZE"] != "200" || got["OBJECT"] != "Account" {
+		t.Errorf("Expected --var to override the suite's vars, got %v", got)
+	}
+	if suite["SIZE"] != "100" {
+		t.Errorf("benchVars() modified the suite's vars: %v", suite)
+	}
+}
+
+func TestFlagError(t *testing.T) {
+	err := flagError(orchestrator.ValidateMinSuccessful(types.BenchmarkConfig{Runs: 2, MinSuccessful: 3}))
+	if err == nil || err.Error() != "--min-successful-runs 3 exceeds --runs 2" {
+		t.Errorf("Expected the settings named by their flags, got %v", err)
+	}
+	var optionErr *orchestrator.OptionError
+	if !errors.As(err, &optionErr) {
+		t.Error("Expected the OptionError to stay reachable")
+	}
+
+	plain := errors.New("boom")
+	if flagError(plain) != plain || flagError(nil) != nil {
+		t.Error("Expected other errors returned as they are")
+	}
+}
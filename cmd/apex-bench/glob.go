@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// isGlob reports whether path is a pattern such as benchmarks/*.apex
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globFiles returns the files matching pattern in lexical order, each with
+// its name: its path below the pattern's first directory holding a
+// wildcard, without the extension
+func globFiles(pattern string) (files, names []string, err error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	for _, match := range matches {
+		if fileExists(match) {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no files match %s", pattern)
+	}
+	sort.Strings(files)
+
+	base := pattern
+	for isGlob(base) {
+		base = filepath.Dir(base)
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			rel = filepath.Base(file)
+		}
+		names = append(names, filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))))
+	}
+	return files, names, nil
+}
+
+// expandFileGlobs replaces every benchmark whose file is a pattern with one
+// benchmark per matching file, named <name>/<file name> and otherwise
+// alike, e.g. "Strings/concat" for strings/concat.apex matched by
+// strings/*.apex, or only <file name> when the benchmark has no name
+func expandFileGlobs(specs []types.BenchmarkSpec) ([]types.BenchmarkSpec, error) {
+	expanded := make([]types.BenchmarkSpec, 0, len(specs))
+	for _, spec := range specs {
+		if spec.File == "" || !isGlob(spec.File) {
+			expanded = append(expanded, spec)
+			continue
+		}
+		files, names, err := globFiles(spec.File)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark %q: %w", spec.Name, err)
+		}
+		for i, file := range files {
+			match := spec
+			match.Name = names[i]
+			if spec.Name != "" {
+				match.Name = spec.Name + "/" + names[i]
+			}
+			match.File = file
+			match.Tags = append([]string(nil), spec.Tags...)
+			expanded = append(expanded, match)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestExpandFileGlobs(t *testing.T) {
+	dir := writeBenchmarkDir(t, map[string]string{
+		"string/join.apex":   "String s = String.join(new List<String>{'a'}, ',');",
+		"string/concat.apex": "String s = 'a' + 'b';",
+		"string/notes.txt":   "not a benchmark",
+		"map/get.apex":       "Integer v = new Map<Integer, Integer>{1 => 1}.get(1);",
+	})
+
+	specs := []types.BenchmarkSpec{
+		{Name: "Inline", Code: "Integer a = 1;"},
+		{Name: "Strings", File: filepath.Join(dir, "string", "*.apex"), Setup: "Integer n = 1;", Tags: []string{"string"}},
+		{Name: "All", File: filepath.Join(dir, "*", "*.apex")},
+		{File: filepath.Join(dir, "map", "*.apex")},
+	}
+	expanded, err := expandFileGlobs(specs)
+	if err != nil {
+		t.Fatalf("expandFileGlobs() error = %v", err)
+	}
+	var names []string
+	for _, spec := range expanded {
+		names = append(names, spec.Name)
+	}
+	want := "Inline,Strings/concat,Strings/join,All/map/get,All/string/concat,All/string/join,get"
+	if strings.Join(names, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(names, ","))
+	}
+	if s := expanded[2]; s.File != filepath.Join(dir, "string", "join.apex") || s.Setup != "Integer n = 1;" || len(s.Tags) != 1 {
+		t.Errorf("Expected the pattern's settings on each match, got %+v", s)
+	}
+
+	_, err = expandFileGlobs([]types.BenchmarkSpec{{Name: "None", File: filepath.Join(dir, "*.cls")}})
+	if err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("Expected an error for a pattern matching nothing, got %v", err)
+	}
+}
+
+func TestLoadSuite_FileGlobs(t *testing.T) {
+	dir := writeBenchmarkDir(t, map[string]string{
+		"string/join.apex":   "String s = String.join(new List<String>{'a'}, ',');",
+		"string/concat.apex": "String s = 'a' + 'b';",
+	})
+	suite := "benchmarks:\n  - name: Strings\n    file: " + filepath.Join(dir, "string", "*.apex") + "\nthresholds:\n  Strings/join:\n    maxCpuMs: 5\n"
+	path := filepath.Join(dir, "suite.yaml")
+	if err := os.WriteFile(path, []byte(suite), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadSuite(path)
+	if err != nil {
+		t.Fatalf("loadSuite() error = %v", err)
+	}
+	if len(config.Benchmarks) != 2 || config.Benchmarks[1].Name != "Strings/join" {
+		t.Errorf("Expected a benchmark per file, got %+v", config.Benchmarks)
+	}
+
+	suite = strings.Replace(suite, "Strings/join", "Strings/split", 1)
+	if err := os.WriteFile(path, []byte(suite), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSuite(path); err == nil || !strings.Contains(err.Error(), "unknown benchmark") {
+		t.Errorf("Expected a threshold for no matching file to be rejected, got %v", err)
+	}
+}
+
+func TestRunBenchmark_FileGlob(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := writeBenchmarkDir(t, map[string]string{"a.apex": "Integer a = 1;", "b.apex": "Integer b = 2;"})
+	out := filepath.Join(t.TempDir(), "out.json")
+	cmd := NewRunCmd(g)
+	setFlags(t, cmd, "file", filepath.Join(dir, "*.apex"), "backend", "mock")
+	g.outputs = []string{"json:" + out}
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("run --file <pattern> error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []types.AggregatedResult
+	if err := json.Unmarshal(data, &results); err != nil || len(results) != 2 || results[1].Name != "b" {
+		t.Errorf("Expected results of a and b, got %s (%v)", data, err)
+	}
+}
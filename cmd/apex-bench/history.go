@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/history"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+// historyOptions are the flags of a history command and its subcommands
+type historyOptions struct {
+	global       *globalOptions
+	file         string
+	exportFormat string
+	exportOut    string
+}
+
+// newHistoryCmd creates a history command, with its export and import
+// subcommands, with g as its global options
+func newHistoryCmd(g *globalOptions) *cobra.Command {
+	o := &historyOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Export and import benchmark history files",
+		Long: `Manage history files written by schedule, serve and suites with a
+history setting, so histories collected on different machines can be
+merged or moved elsewhere.`,
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write a history file as JSON Lines or a JSON array",
+		Args:  cobra.NoArgs,
+		RunE:  o.exportHistory,
+	}
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>...",
+		Short: "Merge exported histories into a history file",
+		Long: `Merge the entries of exported histories, as JSON Lines or a JSON array,
+into the --history file. Entries already present, with the same time and
+org, are skipped, so importing the same export twice changes nothing; the
+merged history is ordered by time. Use - to read from stdin.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: o.importHistory,
+	}
+
+	cmd.PersistentFlags().StringVar(&o.file, "history", "", "History file to read or merge into")
+	cmd.MarkPersistentFlagRequired("history")
+
+	exportCmd.Flags().StringVar(&o.exportFormat, "format", "jsonl", "Export format: jsonl, json")
+	exportCmd.Flags().StringVar(&o.exportOut, "out", "", "Write the export to this file instead of stdout")
+
+	cmd.AddCommand(exportCmd)
+	cmd.AddCommand(importCmd)
+	return cmd
+}
+
+func (o *historyOptions) exportHistory(cmd *cobra.Command, args []string) error {
+	if o.exportFormat != "jsonl" && o.exportFormat != "json" {
+		return fmt.Errorf("unknown export format: %s (expected jsonl or json)", o.exportFormat)
+	}
+	if _, err := os.Stat(o.file); err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	entries, err := history.Load(o.file)
+	if err != nil {
+		return err
+	}
+	return o.global.writeReport(o.exportOut, func(w io.Writer) error {
+		if o.exportFormat == "json" {
+			if entries == nil {
+				entries = []history.Entry{}
+			}
+			return reporter.PrintJSON(entries, w)
+		}
+		return history.Write(w, entries)
+	})
+}
+
+func (o *historyOptions) importHistory(cmd *cobra.Command, args []string) error {
+	entries, err := history.Load(o.file)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, path := range args {
+		incoming, err := readHistoryExport(path, cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		var added int
+		entries, added = history.Merge(entries, incoming)
+		o.global.progressf("%s: %d of %d entries added\n", path, added, len(incoming))
+		total += added
+	}
+	if total == 0 {
+		return nil
+	}
+	return history.Save(o.file, entries)
+}
+
+// readHistoryExport reads the entries of an export, or of stdin for "-"
+func readHistoryExport(path string, stdin io.Reader) ([]history.Entry, error) {
+	if path == "-" {
+		entries, err := history.Read(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history from stdin: %w", err)
+		}
+		return entries, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history export: %w", err)
+	}
+	defer f.Close()
+	entries, err := history.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history export %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/history"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+func TestHistoryExportImport(t *testing.T) {
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	remote := filepath.Join(dir, "remote.jsonl")
+	for i, org := range []string{"ci", "staging"} {
+		entry := history.Entry{Time: start.Add(time.Duration(i) * time.Hour), Org: org, Results: []types.AggregatedResult{{Name: "A"}}}
+		if err := history.Append(remote, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Export the remote history as a JSON array
+	o := &historyOptions{global: &globalOptions{}, file: remote, exportFormat: "json"}
+	o.exportOut = filepath.Join(dir, "export.json")
+	if err := o.exportHistory(&cobra.Command{}, nil); err != nil {
+		t.Fatalf("exportHistory() error = %v", err)
+	}
+	data, err := os.ReadFile(o.exportOut)
+	if err != nil || !strings.HasPrefix(string(data), "[") {
+		t.Fatalf("Expected a JSON array, got %q, %v", data, err)
+	}
+
+	// Import it into a local history sharing one entry
+	local := filepath.Join(dir, "local.jsonl")
+	if err := history.Append(local, history.Entry{Time: start, Org: "ci"}); err != nil {
+		t.Fatal(err)
+	}
+	o.file = local
+	for range 2 {
+		if err := o.importHistory(&cobra.Command{}, []string{o.exportOut}); err != nil {
+			t.Fatalf("importHistory() error = %v", err)
+		}
+	}
+	entries, err := history.Load(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Org != "staging" {
+		t.Errorf("Expected the new entry merged once, got %+v", entries)
+	}
+
+	o.exportFormat = "csv"
+	if err := o.exportHistory(&cobra.Command{}, nil); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+)
+
+// logFormats lists the supported --log-format values
+var logFormats = []string{"text", "json"}
+
+// checkLogFormat reports whether format is a supported --log-format
+func checkLogFormat(format string) error {
+	for _, f := range logFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log format %q (available: %s)", format, strings.Join(logFormats, ", "))
+}
+
+// jsonLogs reports whether messages are written as JSON records
+func (g *globalOptions) jsonLogs() bool {
+	return g.logFormat == "json"
+}
+
+// progressf reports progress on stderr unless --quiet is set
+func (g *globalOptions) progressf(format string, args ...interface{}) {
+	if !g.quiet {
+		g.logf(slog.LevelInfo, "", format, args...)
+	}
+}
+
+// verbosef reports details on stderr when --verbose is set
+func (g *globalOptions) verbosef(format string, args ...interface{}) {
+	if g.verbose {
+		g.logf(slog.LevelDebug, "", format, args...)
+	}
+}
+
+// warnf reports a problem that does not stop the command on stderr
+func (g *globalOptions) warnf(format string, args ...interface{}) {
+	g.logf(slog.LevelWarn, "Warning: ", format+"\n", args...)
+}
+
+// logf writes a message at level on stderr: with --log-format text as is,
+// after prefix, and with --log-format json as one record, trimmed of
+// surrounding blank lines. Blank messages only space out text.
+func (g *globalOptions) logf(level slog.Level, prefix, format string, args ...interface{}) {
+	if !g.jsonLogs() {
+		fmt.Fprintf(g.stderr(), prefix+format, args...)
+		return
+	}
+	msg := strings.TrimSpace(fmt.Sprintf(format, args...))
+	if msg == "" {
+		return
+	}
+	g.logRecord(level, msg)
+}
+
+// logRecord writes one JSON record with the time, level, msg and attrs
+func (g *globalOptions) logRecord(level slog.Level, msg string, attrs ...slog.Attr) {
+	handler := slog.NewJSONHandler(g.stderr(), &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.New(handler).LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// logRun records an execution of a benchmark script with --log-format json,
+// so log aggregation can index the duration of every sf invocation. Failed
+// executions are warnings; successful ones are left out with --quiet.
+func (g *globalOptions) logRun(event bench.RunEvent) {
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.String("benchmark", strings.Join(event.Benchmarks, ",")),
+		slog.Int("run", event.Run),
+		slog.Int("runs", event.Runs),
+		slog.Float64("sf_duration_ms", float64(event.Duration)/float64(time.Millisecond)),
+	}
+	if event.Err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	} else if g.quiet {
+		return
+	}
+	g.logRecord(level, "run finished", attrs...)
+}
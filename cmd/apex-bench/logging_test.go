@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// logOptions returns global options with --log-format, capturing stderr
+func logOptions(format string) (*globalOptions, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return &globalOptions{logFormat: format, errOut: &buf}, &buf
+}
+
+// logRecords decodes the JSON records written to buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record, got %q (%v)", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogf_Text(t *testing.T) {
+	g, buf := logOptions("text")
+	g.progressf("\n[1/2] Running benchmark: %s\n", "Concat")
+	g.warnf("%d of %d runs failed", 1, 3)
+
+	want := "\n[1/2] Running benchmark: Concat\nWarning: 1 of 3 runs failed\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected output %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLogf_JSON(t *testing.T) {
+	g, buf := logOptions("json")
+	g.verbose = true
+
+	g.progressf("\n[1/2] Running benchmark: %s\n", "Concat")
+	g.progressf("\n") // Only spaces out text
+	g.verbosef("  Run 1: 120ms\n")
+	g.warnf("%d of %d runs failed", 1, 3)
+
+	records := logRecords(t, buf)
+	want := []struct{ level, msg string }{
+		{"INFO", "[1/2] Running benchmark: Concat"},
+		{"DEBUG", "Run 1: 120ms"},
+		{"WARN", "1 of 3 runs failed"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %d:\n%s", len(want), len(records), buf.String())
+	}
+	for i, w := range want {
+		if records[i]["level"] != w.level || records[i]["msg"] != w.msg || records[i]["time"] == nil {
+			t.Errorf("Record %d = %v, want level %s and msg %q", i, records[i], w.level, w.msg)
+		}
+	}
+}
+
+func TestLogRun(t *testing.T) {
+	g, buf := logOptions("json")
+	g.logRun(bench.RunEvent{Benchmarks: []string{"A", "B"}, Run: 2, Runs: 3, Duration: 1500 * time.Millisecond})
+	g.logRun(bench.RunEvent{Benchmarks: []string{"A"}, Run: 3, Runs: 3, Duration: time.Second, Err: errors.New("Apex execution failed")})
+
+	records := logRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got:\n%s", buf.String())
+	}
+	first := records[0]
+	if first["level"] != "INFO" || first["benchmark"] != "A,B" || first["run"] != 2.0 || first["runs"] != 3.0 || first["sf_duration_ms"] != 1500.0 {
+		t.Errorf("Unexpected record %v", first)
+	}
+	if records[1]["level"] != "WARN" || records[1]["error"] != "Apex execution failed" {
+		t.Errorf("Expected the failed execution as a warning, got %v", records[1])
+	}
+
+	// Only failures are kept with --quiet
+	buf.Reset()
+	g.quiet = true
+	g.logRun(bench.RunEvent{Benchmarks: []string{"A"}, Run: 1, Runs: 1})
+	if buf.Len() != 0 {
+		t.Errorf("Expected no record with --quiet, got %s", buf.String())
+	}
+}
+
+func TestRunBenchmark_JSONLogs(t *testing.T) {
+	g, buf := logOptions("json")
+	var out bytes.Buffer
+	g.out = &out
+
+	spec := types.CodeSpec{Name: "Concat", UserCode: "String s = 'a';", Iterations: 10}
+	err := g.runBenchmarkWithExecutor(context.Background(), &mockExecutor{}, "test-org", spec, types.BenchmarkConfig{Runs: 2, Parallel: 1, Output: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := 0
+	for _, record := range logRecords(t, buf) {
+		if record["msg"] == "run finished" {
+			runs++
+			if record["benchmark"] != "Concat" || record["sf_duration_ms"] == nil {
+				t.Errorf("Unexpected run record %v", record)
+			}
+		}
+	}
+	if runs != 2 {
+		t.Errorf("Expected a record per run, got %d:\n%s", runs, buf.String())
+	}
+	if !strings.Contains(out.String(), `"avgCpuMs"`) {
+		t.Errorf("Expected the report on stdout, got %s", out.String())
+	}
+}
+
+func TestCheckLogFormat(t *testing.T) {
+	if err := checkLogFormat("json"); err != nil {
+		t.Errorf("checkLogFormat(json) error = %v", err)
+	}
+	if err := checkLogFormat("xml"); err == nil || !strings.Contains(err.Error(), "text, json") {
+		t.Errorf("Expected an unknown format to list the available ones, got %v", err)
+	}
+}
@@ -1,31 +1,112 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var version = "0.1.0"
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	g := &globalOptions{}
+	root := newRootCmd(g)
+	start := time.Now()
+	cmd, err := root.ExecuteContextC(interruptContext(root.ErrOrStderr()))
+	g.recordTelemetry(cmd, time.Since(start), err)
+	if err != nil {
+		g.logf(slog.LevelError, "Error: ", "%v\n", err)
 		os.Exit(1)
 	}
 }
 
-var rootCmd = &cobra.Command{
-	Use:   "apex-bench",
-	Short: "Apex Benchmark CLI - Benchmark Salesforce Apex code snippets",
-	Long: `apex-bench is a CLI tool for benchmarking Salesforce Apex code snippets
-without deployment. It wraps your code in measurement logic and executes
-it via the Salesforce CLI.`,
-	Version: version,
+// interruptContext returns a context cancelled on the first Ctrl+C or
+// SIGTERM, so commands can stop in-flight executions and report the runs
+// that already finished, saying so on w. A second Ctrl+C exits immediately.
+func interruptContext(w io.Writer) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Fprintln(w, "\nInterrupted, stopping (press Ctrl+C again to quit immediately)")
+		cancel()
+	}()
+	return ctx
+}
+
+// commandContext returns the context cmd was executed with, or a background
+// context when its RunE is called directly
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
 }
 
-func init() {
-	rootCmd.AddCommand(runCmd)
-	rootCmd.AddCommand(compareCmd)
+// NewRootCmd creates the apex-bench command with new instances of all its
+// subcommands. Its persistent flags are bound to options of its own, so
+// separate instances can be executed concurrently and repeatedly without
+// seeing each other's flags or output.
+func NewRootCmd() *cobra.Command {
+	return newRootCmd(&globalOptions{})
+}
+
+// newRootCmd creates the apex-bench command with g as its global options
+func newRootCmd(g *globalOptions) *cobra.Command {
+	root := &cobra.Command{
+		Use:   "apex-bench",
+		Short: "Apex Benchmark CLI - Benchmark Salesforce Apex code snippets",
+		Long: `apex-bench is a CLI tool for benchmarking Salesforce Apex code snippets
+without deployment. It wraps your code in measurement logic and executes
+it via the Salesforce CLI.`,
+		Version: version,
+		// Errors are logged by main, masked and in the --log-format
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.resolveFlags(cmd); err != nil {
+				return err
+			}
+			g.setOutput(cmd)
+			if g.noColor {
+				// Colors are switched off for the whole process:
+				// the color package only has the global switch
+				color.NoColor = true
+			}
+			return nil
+		},
+	}
+	g.addFlags(root.PersistentFlags())
+	root.AddCommand(
+		NewRunCmd(g),
+		NewCompareCmd(g),
+		newCompareCommitsCmd(g),
+		newSuiteCmd(g),
+		newRerunCmd(g),
+		newScheduleCmd(g),
+		newServeCmd(g),
+		newRPCCmd(g),
+		newHistoryCmd(g),
+		newWatchCmd(g),
+		newScaleCmd(g),
+		newTriggerCmd(g),
+		newEstimateCmd(g),
+		newOrgsCmd(g),
+		newSchemaCmd(),
+		newExamplesCmd(g),
+		newNewCmd(g),
+		newVersionCmd(g),
+		newTelemetryCmd(g),
+	)
+	root.RegisterFlagCompletionFunc("org", completeOrgs)
+	return root
 }
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestVersion is the format of the run manifests this version writes
+const manifestVersion = 1
+
+// rerunOptions are the flags of a rerun command
+type rerunOptions struct {
+	global  *globalOptions
+	backend string
+	out     string
+}
+
+// newRerunCmd creates a rerun command with g as its global options
+func newRerunCmd(g *globalOptions) *cobra.Command {
+	o := &rerunOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "rerun <manifest>",
+		Short: "Re-execute the session recorded in a run manifest",
+		Long: `Re-execute a session from the manifest written with --manifest by
+compare or suite: the same benchmark code and settings, against the org
+and with the backend it recorded.
+
+The manifest's inputs hash must match its contents, so edited manifests
+are rejected. Benchmarks whose generated Apex differs from the recorded
+hash, typically because another apex-bench version wrote the manifest,
+are reported as a warning before running.`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", ")+" (default: the recorded backend)")
+	cmd.Flags().StringVar(&o.out, "out", "", "Write results to this file instead of stdout")
+	return cmd
+}
+
+// runManifest records what a session ran, so it can be checked and
+// repeated with rerun
+type runManifest struct {
+	Version    int                 `json:"version"`
+	Tool       string              `json:"tool"` // apex-bench version that wrote the manifest
+	Created    time.Time           `json:"created"`
+	Command    string              `json:"command"`
+	Flags      map[string]string   `json:"flags,omitempty"` // Flags given on the command line
+	Org        orgSnapshot         `json:"org"`
+	InputsHash string              `json:"inputsHash"` // SHA-256 of Config
+	Benchmarks []manifestBenchmark `json:"benchmarks"`
+	// Session settings as in a suite file, with benchmark code inlined
+	Config map[string]any `json:"config"`
+}
+
+// orgSnapshot describes where a session ran
+type orgSnapshot struct {
+	Org         string `json:"org,omitempty"`
+	Backend     string `json:"backend"`
+	Username    string `json:"username,omitempty"`
+	InstanceURL string `json:"instanceUrl,omitempty"`
+	APIVersion  string `json:"apiVersion,omitempty"` // Requested version; empty used the org default
+	CLIVersion  string `json:"cliVersion,omitempty"`
+}
+
+// manifestBenchmark identifies the code of one benchmark
+type manifestBenchmark struct {
+	Name     string `json:"name"`
+	File     string `json:"file,omitempty"` // Where the code was read from
+	CodeHash string `json:"codeHash"`       // SHA-256 of the code, setup and teardown
+	ApexHash string `json:"apexHash"`       // SHA-256 of the benchmark's generated Apex
+}
+
+// newManifest records a session of command running config against org with
+// backend. Flags given to cmd are recorded when cmd is set.
+func (g *globalOptions) newManifest(cmd *cobra.Command, config types.BenchmarkConfig, org, backend string) (runManifest, error) {
+	m := runManifest{
+		Version: manifestVersion,
+		Tool:    version,
+		Created: time.Now().UTC(),
+		Org:     g.snapshotOrg(org, backend, config.APIVersion),
+	}
+	if cmd != nil {
+		m.Command = cmd.Name()
+		m.Flags = make(map[string]string)
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			m.Flags[f.Name] = f.Value.String()
+		})
+	}
+
+	// Inline the code of benchmarks read from files, so the manifest alone
+	// reproduces the session
+	config.Benchmarks = append([]types.BenchmarkSpec(nil), config.Benchmarks...)
+	for i, benchSpec := range config.Benchmarks {
+		spec, err := bench.NewCodeSpec(benchSpec, config)
+		if err != nil {
+			return runManifest{}, err
+		}
+		apexHash, err := generator.ScriptHash(spec)
+		if err != nil {
+			return runManifest{}, fmt.Errorf("benchmark %s: %w", benchSpec.Name, err)
+		}
+		m.Benchmarks = append(m.Benchmarks, manifestBenchmark{
+			Name:     benchSpec.Name,
+			File:     benchSpec.File,
+			CodeHash: hashString(spec.UserCode + "\x00" + spec.Setup + "\x00" + spec.Teardown),
+			ApexHash: apexHash,
+		})
+		config.Benchmarks[i].Code = spec.UserCode
+		config.Benchmarks[i].File = ""
+		config.Benchmarks[i].Fence = 0
+	}
+
+	var err error
+	if m.Config, err = configMap(config); err != nil {
+		return runManifest{}, err
+	}
+	if m.InputsHash, err = hashJSON(m.Config); err != nil {
+		return runManifest{}, err
+	}
+	return m, nil
+}
+
+// snapshotOrg describes org as far as the CLI knows it. Org details are
+// informational, so failing to list orgs leaves them out.
+func (g *globalOptions) snapshotOrg(org, backend, apiVersion string) orgSnapshot {
+	snapshot := orgSnapshot{Org: org, Backend: backend, APIVersion: apiVersion}
+	if v, ok := executor.DetectedCLIVersion(); ok {
+		snapshot.CLIVersion = v.String()
+	}
+	if b, err := executor.LookupBackend(backend); err != nil || !b.RequiresOrg || org == "" {
+		return snapshot
+	}
+	orgs, err := executor.ListOrgs()
+	if err != nil {
+		g.verbosef("Leaving org details out of the manifest: %v\n", err)
+		return snapshot
+	}
+	for _, info := range orgs {
+		if info.Username == org || info.Alias == org {
+			snapshot.Username = info.Username
+			snapshot.InstanceURL = info.InstanceURL
+			break
+		}
+	}
+	return snapshot
+}
+
+// saveManifest records a session and writes the manifest to path
+func (g *globalOptions) saveManifest(path string, cmd *cobra.Command, config types.BenchmarkConfig, org, backend string) error {
+	m, err := g.newManifest(cmd, config, org, backend)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	g.progressf("Manifest written to %s\n", path)
+	return nil
+}
+
+// loadManifest reads a manifest written by saveManifest
+func loadManifest(path string) (runManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return runManifest{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m runManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return runManifest{}, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.Version < 1 || m.Version > manifestVersion {
+		return runManifest{}, fmt.Errorf("manifest %s has unsupported version %d (this apex-bench reads version %d)", path, m.Version, manifestVersion)
+	}
+	return m, nil
+}
+
+// benchmarkConfig returns the recorded session settings, checking them
+// against the inputs hash
+func (m runManifest) benchmarkConfig() (types.BenchmarkConfig, error) {
+	hash, err := hashJSON(m.Config)
+	if err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	if hash != m.InputsHash {
+		return types.BenchmarkConfig{}, fmt.Errorf("manifest inputs do not match their hash; was the manifest edited?")
+	}
+	data, err := yaml.Marshal(m.Config)
+	if err != nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("failed to encode manifest config: %w", err)
+	}
+	return parseSuite(data, "manifest")
+}
+
+// changedBenchmarks returns the benchmarks of config whose generated Apex
+// differs from the manifest's record of them
+func (m runManifest) changedBenchmarks(config types.BenchmarkConfig) ([]string, error) {
+	recorded := make(map[string]string, len(m.Benchmarks))
+	for _, b := range m.Benchmarks {
+		recorded[b.Name] = b.ApexHash
+	}
+	var changed []string
+	for _, benchSpec := range config.Benchmarks {
+		spec, err := bench.NewCodeSpec(benchSpec, config)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := generator.ScriptHash(spec)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark %s: %w", benchSpec.Name, err)
+		}
+		if hash != recorded[benchSpec.Name] {
+			changed = append(changed, benchSpec.Name)
+		}
+	}
+	return changed, nil
+}
+
+func (o *rerunOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	m, err := loadManifest(args[0])
+	if err != nil {
+		return err
+	}
+	config, err := m.benchmarkConfig()
+	if err != nil {
+		return err
+	}
+	changed, err := m.changedBenchmarks(config)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		g.warnf("the generated Apex of %s differs from the manifest, written by apex-bench %s; results may not be comparable", strings.Join(changed, ", "), m.Tool)
+	}
+
+	backend := m.Org.Backend
+	if cmd.Flags().Changed("backend") || backend == "" {
+		backend = o.backend
+	}
+	org := m.Org.Org
+	if g.org != "" {
+		org = g.org
+	}
+	if len(g.outputs) > 0 {
+		config.Outputs = g.outputs
+	}
+	if o.out != "" {
+		config.Out = o.out
+	}
+
+	exec, org, err := g.newExecutor(executorOptions{Backend: backend, Org: org})
+	if err != nil {
+		return err
+	}
+	g.progressf("Re-running the %s session of %s\n", m.Command, m.Created.Format(time.RFC3339))
+	return g.compareBenchmarksWithExecutor(commandContext(cmd), exec, org, config)
+}
+
+// configMap converts config to its suite file form
+func configMap(config types.BenchmarkConfig) (map[string]any, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return m, nil
+}
+
+// hashJSON returns the SHA-256 hash, in hex, of v encoded as JSON, whose
+// object keys are sorted
+func hashJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash manifest inputs: %w", err)
+	}
+	return hashString(string(data)), nil
+}
+
+// hashString returns the SHA-256 hash of s in hex
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestManifest_RoundTrip(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "loop.apex")
+	if err := os.WriteFile(file, []byte("Integer a = 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{{Name: "FromFile", File: file}, {Name: "Inline", Code: "Integer b = 2;", Units: 10}},
+		Iterations: 10,
+		Warmup:     1,
+		Runs:       2,
+		Parallel:   1,
+		Timeout:    30 * time.Second,
+		Aggregate:  "median",
+		Output:     "table",
+	}
+	path := filepath.Join(dir, "manifest.json")
+	if err := g.saveManifest(path, nil, config, "", "mock"); err != nil {
+		t.Fatalf("saveManifest() error = %v", err)
+	}
+
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("loadManifest() error = %v", err)
+	}
+	if m.Org.Backend != "mock" || len(m.Benchmarks) != 2 || m.Benchmarks[0].File != file || len(m.Benchmarks[0].ApexHash) != 64 {
+		t.Errorf("Unexpected manifest: %+v", m)
+	}
+	got, err := m.benchmarkConfig()
+	if err != nil {
+		t.Fatalf("benchmarkConfig() error = %v", err)
+	}
+	if got.Benchmarks[0].Code != "Integer a = 1;" || got.Benchmarks[0].File != "" || got.Benchmarks[1].Units != 10 {
+		t.Errorf("Expected benchmark code inlined, got %+v", got.Benchmarks)
+	}
+	if got.Iterations != 10 || got.Runs != 2 || got.Timeout != 30*time.Second {
+		t.Errorf("Expected the recorded settings, got %+v", got)
+	}
+	if changed, err := m.changedBenchmarks(got); err != nil || len(changed) != 0 {
+		t.Errorf("Expected unchanged benchmarks, got %v, %v", changed, err)
+	}
+
+	got.Iterations = 20
+	if changed, _ := m.changedBenchmarks(got); len(changed) != 2 {
+		t.Errorf("Expected both benchmarks to change with other settings, got %v", changed)
+	}
+
+	m.Config["iterations"] = 20
+	if _, err := m.benchmarkConfig(); err == nil || !strings.Contains(err.Error(), "do not match their hash") {
+		t.Errorf("Expected edited inputs to be rejected, got %v", err)
+	}
+}
+
+func TestLoadManifest_Version(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifest(path); err == nil || !strings.Contains(err.Error(), "unsupported version 99") {
+		t.Errorf("Expected an unsupported version error, got %v", err)
+	}
+}
+
+func TestRerunSession(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{{Name: "A", Code: "Integer a = 1;"}, {Name: "B", Code: "Integer b = 2;"}},
+		Iterations: 10,
+		Runs:       1,
+		Parallel:   1,
+		Aggregate:  "median",
+		Output:     "json",
+	}
+	path := filepath.Join(dir, "manifest.json")
+	if err := g.saveManifest(path, nil, config, "", "mock"); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "results.json")
+	rerunCmd := newRerunCmd(g)
+	setFlags(t, rerunCmd, "out", out)
+	if err := rerunCmd.RunE(rerunCmd, []string{path}); err != nil {
+		t.Fatalf("rerun error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name": "A"`) || !strings.Contains(string(data), `"name": "B"`) {
+		t.Errorf("Expected both benchmarks re-run, got: %s", data)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// newOptions are the flags of a new command
+type newOptions struct {
+	global      *globalOptions
+	interactive bool
+	template    string
+}
+
+// newNewCmd creates a new command with g as its global options
+func newNewCmd(g *globalOptions) *cobra.Command {
+	o := &newOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "new [suite.yaml]",
+		Short: "Create benchmarks step by step or from an example",
+		Long: `Create a suite without learning the flags first.
+
+--interactive asks for each benchmark's name and code (inline or a file),
+the iterations, tracking options and org, then saves the benchmarks to the
+suite file, runs them right away, or both. Benchmarks are added to an
+existing suite file.
+
+--template writes one of the example suites (see apex-bench examples).`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: o.run,
+	}
+
+	cmd.Flags().BoolVarP(&o.interactive, "interactive", "i", false, "Ask for the benchmarks and settings step by step")
+	cmd.Flags().StringVar(&o.template, "template", "", "Write this example suite: "+strings.Join(exampleNames(), ", "))
+
+	cmd.MarkFlagsMutuallyExclusive("interactive", "template")
+	return cmd
+}
+
+func (o *newOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	switch {
+	case o.template != "":
+		ex, err := findExample(o.template)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			path = ex.Name + ".yaml"
+		}
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+		if err := os.WriteFile(path, []byte(ex.Suite), 0o644); err != nil {
+			return fmt.Errorf("failed to write suite: %w", err)
+		}
+		g.progressf("Suite written to %s; run it with: apex-bench suite %s\n", path, path)
+		return nil
+	case !o.interactive:
+		return fmt.Errorf("use --interactive to be asked for the benchmarks, or --template with one of: %s", strings.Join(exampleNames(), ", "))
+	}
+
+	w, err := runWizard(cmd.InOrStdin(), cmd.ErrOrStderr(), path)
+	if err != nil {
+		return err
+	}
+	if w.Save {
+		if err := addToSuite(w.Path, w.Config); err != nil {
+			return err
+		}
+		g.progressf("Saved %d benchmarks to %s; run them with: apex-bench suite %s\n", len(w.Config.Benchmarks), w.Path, w.Path)
+	}
+	if !w.Run {
+		return nil
+	}
+
+	exec, org, err := g.newExecutor(executorOptions{Backend: executor.DefaultBackend, Org: w.Config.Org})
+	if err != nil {
+		return err
+	}
+	return g.compareBenchmarksWithExecutor(commandContext(cmd), exec, org, w.Config)
+}
+
+// wizard is what the user chose in the interactive builder
+type wizard struct {
+	Config types.BenchmarkConfig
+	Path   string // Suite file to save to
+	Save   bool
+	Run    bool
+}
+
+// runWizard asks for benchmarks and settings on out, reading answers from
+// in. Benchmarks are saved to path, when given, or to a file it asks for.
+func runWizard(in io.Reader, out io.Writer, path string) (wizard, error) {
+	p := prompter{r: bufio.NewReader(in), w: out}
+	w := wizard{Path: path}
+	config := types.BenchmarkConfig{
+		Runs:           1,
+		Aggregate:      "mean",
+		NoiseThreshold: 20,
+		Metrics:        "cpu,heap,db",
+		Output:         compareDefaultOutput,
+	}
+
+	for {
+		fmt.Fprintf(out, "\nBenchmark %d\n", len(config.Benchmarks)+1)
+		spec, err := askBenchmark(p, config.Benchmarks)
+		if err != nil {
+			return wizard{}, err
+		}
+		config.Benchmarks = append(config.Benchmarks, spec)
+		more, err := p.askBool("Add another benchmark to compare with?", len(config.Benchmarks) == 1)
+		if err != nil {
+			return wizard{}, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	fmt.Fprintln(out, "\nSettings")
+	var err error
+	if config.Iterations, err = p.askInt("Iterations", 100, 1); err != nil {
+		return wizard{}, err
+	}
+	if config.Warmup, err = p.askInt("Warmup iterations", 10, 0); err != nil {
+		return wizard{}, err
+	}
+	if config.TrackHeap, err = p.askBool("Track heap usage?", false); err != nil {
+		return wizard{}, err
+	}
+	if config.TrackDB, err = p.askBool("Track DML and SOQL?", false); err != nil {
+		return wizard{}, err
+	}
+	if config.Org, err = p.ask("Org alias or username (empty for the default org)", ""); err != nil {
+		return wizard{}, err
+	}
+
+	for {
+		action, err := p.ask("Save to a suite file, run now, or both? (save/run/both)", "both")
+		if err != nil {
+			return wizard{}, err
+		}
+		switch strings.ToLower(action) {
+		case "save", "s":
+			w.Save = true
+		case "run", "r":
+			w.Run = true
+		case "both", "b":
+			w.Save, w.Run = true, true
+		default:
+			fmt.Fprintln(out, "Please answer save, run or both")
+			continue
+		}
+		break
+	}
+	if w.Save && w.Path == "" {
+		if w.Path, err = p.ask("Suite file", "benchmarks.yaml"); err != nil {
+			return wizard{}, err
+		}
+	}
+
+	w.Config = config
+	return w, nil
+}
+
+// askBenchmark asks for one benchmark, whose name must differ from those
+// of existing
+func askBenchmark(p prompter, existing []types.BenchmarkSpec) (types.BenchmarkSpec, error) {
+	var spec types.BenchmarkSpec
+	for {
+		name, err := p.ask("Name", fmt.Sprintf("Benchmark %d", len(existing)+1))
+		if err != nil {
+			return spec, err
+		}
+		if _, taken := orchestrator.FindBenchmark(existing, name); taken {
+			fmt.Fprintf(p.w, "A benchmark is already named %q\n", name)
+			continue
+		}
+		spec.Name = name
+		break
+	}
+	for {
+		code, err := p.ask("Apex code, or the path to a .apex file", "")
+		if err != nil {
+			return spec, err
+		}
+		if code == "" {
+			fmt.Fprintln(p.w, "A benchmark needs code to measure")
+			continue
+		}
+		if fileExists(code) {
+			spec.File = code
+		} else {
+			spec.Code = code
+		}
+		return spec, nil
+	}
+}
+
+// prompter asks questions on w and reads the answers from r
+type prompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// ask returns the answer to question, or def when the answer is empty
+func (p prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.w, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.w, "%s: ", question)
+	}
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// readLine reads one answer, trimmed
+func (p prompter) readLine() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if errors.Is(err, io.EOF) && line == "" {
+		return "", fmt.Errorf("input ended before all questions were answered")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// askInt asks for a whole number of at least min until one is given
+func (p prompter) askInt(question string, def, min int) (int, error) {
+	for {
+		answer, err := p.ask(question, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= min {
+			return n, nil
+		}
+		fmt.Fprintf(p.w, "Please answer with a whole number of at least %d\n", min)
+	}
+}
+
+// askBool asks a yes or no question until it is answered
+func (p prompter) askBool(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		fmt.Fprintf(p.w, "%s [%s]: ", question, hint)
+		answer, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.w, "Please answer y or n")
+	}
+}
+
+// addToSuite saves the benchmarks of config to the suite file at path. A
+// new file also gets the settings of config; benchmarks are appended to an
+// existing file, keeping its settings and comments.
+func addToSuite(path string, config types.BenchmarkConfig) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		suite := struct {
+			Benchmarks []types.BenchmarkSpec `yaml:"benchmarks"`
+			Iterations int                   `yaml:"iterations"`
+			Warmup     int                   `yaml:"warmup"`
+			TrackHeap  bool                  `yaml:"trackHeap,omitempty"`
+			TrackDB    bool                  `yaml:"trackDB,omitempty"`
+			Org        string                `yaml:"org,omitempty"`
+		}{config.Benchmarks, config.Iterations, config.Warmup, config.TrackHeap, config.TrackDB, config.Org}
+		if data, err = yaml.Marshal(suite); err != nil {
+			return fmt.Errorf("failed to encode suite: %w", err)
+		}
+		return saveSuiteFile(path, data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read suite: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse suite %s: %w", path, err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("suite %s is not a mapping of settings", path)
+	}
+	root := doc.Content[0]
+	var list *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "benchmarks" {
+			list = root.Content[i+1]
+		}
+	}
+	if list == nil {
+		list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "benchmarks"}, list)
+	}
+	for _, spec := range config.Benchmarks {
+		var node yaml.Node
+		if err := node.Encode(spec); err != nil {
+			return fmt.Errorf("failed to encode benchmark %s: %w", spec.Name, err)
+		}
+		list.Content = append(list.Content, &node)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode suite: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode suite: %w", err)
+	}
+	updated, err := parseSuiteFile(buf.Bytes(), path)
+	if err != nil {
+		return err
+	}
+	if err := orchestrator.ValidateUniqueNames(updated.Benchmarks); err != nil {
+		return fmt.Errorf("cannot add to %s: %w", path, err)
+	}
+	return saveSuiteFile(path, buf.Bytes())
+}
+
+// saveSuiteFile writes a suite file
+func saveSuiteFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write suite: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWizard(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fast.apex")
+	if err := os.WriteFile(file, []byte("Integer a = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	answers := strings.Join([]string{
+		"Slow",                // Name
+		"",                    // Code is required
+		"String s = 'a' + 1;", // Code
+		"",                    // Add another (default yes)
+		"Slow",                // Name already taken
+		"Fast",                // Name
+		file,                  // File
+		"n",                   // No more
+		"abc",                 // Iterations must be a number
+		"50",                  // Iterations
+		"0",                   // Warmup
+		"y",                   // Track heap
+		"",                    // Track DB (default no)
+		"dev",                 // Org
+		"later",               // Unknown action
+		"save",                // Action
+		"",                    // Suite file (default)
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	w, err := runWizard(strings.NewReader(answers), &out, "")
+	if err != nil {
+		t.Fatalf("runWizard() error = %v\n%s", err, out.String())
+	}
+	c := w.Config
+	if len(c.Benchmarks) != 2 || c.Benchmarks[0].Code != "String s = 'a' + 1;" || c.Benchmarks[1].File != file {
+		t.Errorf("Unexpected benchmarks: %+v", c.Benchmarks)
+	}
+	if c.Iterations != 50 || c.Warmup != 0 || !c.TrackHeap || c.TrackDB || c.Org != "dev" {
+		t.Errorf("Unexpected settings: %+v", c)
+	}
+	if !w.Save || w.Run || w.Path != "benchmarks.yaml" {
+		t.Errorf("Expected to save to benchmarks.yaml only, got %+v", w)
+	}
+	for _, want := range []string{"already named \"Slow\"", "needs code", "whole number", "save, run or both"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected prompts to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	if _, err := runWizard(strings.NewReader("Only\n"), &out, ""); err == nil || !strings.Contains(err.Error(), "input ended") {
+		t.Errorf("Expected an error when input ends, got %v", err)
+	}
+}
+
+func TestAddToSuite(t *testing.T) {
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	var out bytes.Buffer
+	w, err := runWizard(strings.NewReader("A\nInteger a = 1;\nn\n20\n2\nn\ny\n\nsave\n"), &out, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addToSuite(path, w.Config); err != nil {
+		t.Fatalf("addToSuite() error = %v", err)
+	}
+	config, err := loadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Benchmarks) != 1 || config.Iterations != 20 || !config.TrackDB {
+		t.Errorf("Unexpected new suite: %+v", config)
+	}
+
+	// Benchmarks are appended to an existing suite, keeping its comments
+	existing := "# Team benchmarks\nbenchmarks:\n  - name: Old\n    code: \"Integer o = 0;\"\niterations: 7\n"
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addToSuite(path, w.Config); err != nil {
+		t.Fatalf("addToSuite() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	config, err = loadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Benchmarks) != 2 || config.Benchmarks[1].Name != "A" || config.Iterations != 7 || !strings.Contains(string(data), "# Team benchmarks") {
+		t.Errorf("Expected A appended to the existing suite, got:\n%s", data)
+	}
+
+	if err := addToSuite(path, w.Config); err == nil || !strings.Contains(err.Error(), "both named") {
+		t.Errorf("Expected a duplicate name error, got %v", err)
+	}
+}
+
+func TestNewSuite_Template(t *testing.T) {
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	newCmd := newNewCmd(&globalOptions{})
+	setFlags(t, newCmd, "template", "map-vs-list")
+
+	path := filepath.Join(t.TempDir(), "map.yaml")
+	if err := newCmd.RunE(newCmd, []string{path}); err != nil {
+		t.Fatalf("new --template error = %v", err)
+	}
+	if _, err := loadSuite(path); err != nil {
+		t.Errorf("Expected a loadable suite, got %v", err)
+	}
+	if err := newCmd.RunE(newCmd, []string{path}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected an existing file to be kept, got %v", err)
+	}
+
+	setFlags(t, newCmd, "template", "")
+	if err := newCmd.RunE(newCmd, nil); err == nil || !strings.Contains(err.Error(), "--interactive") {
+		t.Errorf("Expected a hint at --interactive, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// newOrgsCmd creates an orgs command with g as its global options
+func newOrgsCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "orgs",
+		Short: "List authenticated orgs",
+		Long: `List the orgs authenticated in the Salesforce CLI, marking the default
+org, to pick a target for --org.`,
+		Args: cobra.NoArgs,
+		RunE: g.listOrgs,
+	}
+}
+
+func (g *globalOptions) listOrgs(cmd *cobra.Command, args []string) error {
+	if err := executor.CheckSalesforceCLI(); err != nil {
+		return err
+	}
+	orgs, err := executor.ListOrgs()
+	if err != nil {
+		return err
+	}
+	return g.printOrgs(orgs, types.BenchmarkConfig{Outputs: g.outputs, Output: "table"})
+}
+
+// printOrgs writes orgs to the outputs requested by config
+func (g *globalOptions) printOrgs(orgs []executor.OrgInfo, config types.BenchmarkConfig) error {
+	targets, err := parseOutputTargets(config)
+	if err != nil {
+		return err
+	}
+
+	return g.writeReports(targets, func(format string, w io.Writer) error {
+		if format == "json" {
+			if orgs == nil {
+				orgs = []executor.OrgInfo{}
+			}
+			return reporter.PrintJSON(orgs, w)
+		}
+		return printOrgTable(orgs, w)
+	})
+}
+
+// printOrgTable writes orgs as a table, marking the default org with *
+func printOrgTable(orgs []executor.OrgInfo, w io.Writer) error {
+	if len(orgs) == 0 {
+		fmt.Fprintln(w, "No authenticated orgs. Run: sf org login web")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.Header("", "Alias", "Username", "Instance", "Status")
+	for _, org := range orgs {
+		marker := ""
+		if org.IsDefault {
+			marker = "*"
+		}
+		if err := table.Append([]string{marker, org.Alias, org.Username, org.InstanceURL, org.Status}); err != nil {
+			return fmt.Errorf("failed to append row: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("failed to render table: %w", err)
+	}
+	return nil
+}
+
+// completeOrgs offers the aliases and usernames of authenticated orgs for
+// shell completion of --org
+func completeOrgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	orgs, err := executor.ListOrgs()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, org := range orgs {
+		for _, name := range []string{org.Alias, org.Username} {
+			if name != "" && strings.HasPrefix(name, toComplete) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
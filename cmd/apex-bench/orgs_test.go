@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestPrintOrgs(t *testing.T) {
+	g := &globalOptions{}
+	orgs := []executor.OrgInfo{
+		{Alias: "dev", Username: "me@example.com", InstanceURL: "https://dev.my.salesforce.com", Status: "Connected", IsDefault: true},
+		{Username: "hub@example.com", Status: "Connected"},
+	}
+	dir := t.TempDir()
+	tablePath := filepath.Join(dir, "orgs.txt")
+	jsonPath := filepath.Join(dir, "orgs.json")
+
+	config := types.BenchmarkConfig{Outputs: []string{"table:" + tablePath, "json:" + jsonPath}}
+	if err := g.printOrgs(orgs, config); err != nil {
+		t.Fatalf("printOrgs() error = %v", err)
+	}
+
+	table, err := os.ReadFile(tablePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ALIAS", "dev", "me@example.com", "hub@example.com", "*"} {
+		if !strings.Contains(string(table), want) {
+			t.Errorf("Expected table to contain %q, got:\n%s", want, table)
+		}
+	}
+
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []executor.OrgInfo
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(decoded) != 2 || !decoded[0].IsDefault {
+		t.Errorf("Unexpected JSON orgs: %+v", decoded)
+	}
+}
+
+func TestPrintOrgs_NoOrgs(t *testing.T) {
+	g := &globalOptions{}
+	path := filepath.Join(t.TempDir(), "orgs.txt")
+	if err := g.printOrgs(nil, types.BenchmarkConfig{Output: "table", Out: path}); err != nil {
+		t.Fatalf("printOrgs() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "No authenticated orgs") {
+		t.Errorf("Expected hint about logging in, got: %s", content)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/exporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/storage"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// outputFormats lists the supported report formats
+var outputFormats = []string{"json", "table"}
+
+// outputTarget is one requested report
+type outputTarget struct {
+	format string
+	path   string // Empty for stdout
+}
+
+// parseOutputTargets resolves the reports requested by config. Each entry of
+// config.Outputs is "format" or "format:path"; entries without a path go to
+// config.Out, or to stdout when that is empty. config.Output is used when no
+// outputs are listed.
+func parseOutputTargets(config types.BenchmarkConfig) ([]outputTarget, error) {
+	entries := config.Outputs
+	if len(entries) == 0 {
+		entries = []string{config.Output}
+	}
+
+	targets := make([]outputTarget, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		format, path, _ := strings.Cut(entry, ":")
+		format = strings.TrimSpace(format)
+		path = strings.TrimSpace(path)
+		if path == "" {
+			path = config.Out
+		}
+
+		known := false
+		for _, f := range outputFormats {
+			known = known || f == format
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown output format: %s", format)
+		}
+
+		if path != "" {
+			if seen[path] {
+				return nil, fmt.Errorf("output file %s requested more than once", path)
+			}
+			seen[path] = true
+		}
+
+		targets = append(targets, outputTarget{format: format, path: path})
+	}
+
+	return targets, nil
+}
+
+// rawFlag returns the raw mode selected by --raw and --no-raw
+func rawFlag(raw string, noRaw bool) string {
+	if noRaw {
+		return string(reporter.RawNone)
+	}
+	return raw
+}
+
+// writeReports writes every target with report, which renders one format,
+// copies the first target's report to the clipboard with --copy-result,
+// then uploads the JSON report to every --upload destination
+func (g *globalOptions) writeReports(targets []outputTarget, report func(format string, w io.Writer) error) error {
+	report = redactReport(g.redactor, report)
+	for _, target := range targets {
+		err := g.writeReport(target.path, func(w io.Writer) error {
+			return report(target.format, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if g.copy && len(targets) > 0 {
+		if err := g.copyReport(targets[0].format, report); err != nil {
+			return err
+		}
+	}
+	return g.uploadReport(g.uploads, report)
+}
+
+// copyReport renders the report in format, without terminal colors, and
+// places it on the system clipboard
+func (g *globalOptions) copyReport(format string, report func(format string, w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := writePlain(&buf, func(w io.Writer) error { return report(format, w) }); err != nil {
+		return err
+	}
+	if err := g.writeClipboard(buf.String()); err != nil {
+		return err
+	}
+	g.progressf("Results copied to the clipboard\n")
+	return nil
+}
+
+// uploadReport renders the JSON report and stores it at every destination,
+// under a timestamped name when the destination is a prefix
+func (g *globalOptions) uploadReport(destinations []string, report func(format string, w io.Writer) error) error {
+	if len(destinations) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := report("json", &buf); err != nil {
+		return err
+	}
+
+	name := "apex-bench-" + time.Now().UTC().Format("20060102T150405Z") + ".json"
+	for _, dest := range destinations {
+		location, err := storage.Upload(context.Background(), dest, name, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		g.progressf("Results uploaded to %s\n", location)
+	}
+	return nil
+}
+
+// exportResults sends the metrics of results to every --export service,
+// tagged with org and the git ref being benchmarked
+func (g *globalOptions) exportResults(results []types.AggregatedResult, org string) error {
+	if len(g.exports) == 0 {
+		return nil
+	}
+	tags := exporter.Tags{Org: org, GitRef: g.gitRef()}
+	for _, name := range g.exports {
+		if err := exporter.Export(context.Background(), name, results, tags, time.Now()); err != nil {
+			return err
+		}
+		g.progressf("Metrics exported to %s\n", name)
+	}
+	return nil
+}
+
+// gitRefEnv names the git ref metrics are tagged with, for CI jobs whose
+// checkout has no branch
+const gitRefEnv = "APEX_BENCH_GIT_REF"
+
+// gitRef returns the git ref of the working directory: APEX_BENCH_GIT_REF,
+// else the current branch, else the short commit of a detached checkout;
+// empty outside a repository
+func (g *globalOptions) gitRef() string {
+	if ref := os.Getenv(gitRefEnv); ref != "" {
+		return ref
+	}
+	output, err := g.gitOutput(".", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return ""
+	}
+	if ref := strings.TrimSpace(string(output)); ref != "HEAD" {
+		return ref
+	}
+	output, err = g.gitOutput(".", "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// setOutput directs reports and messages to the writers of cmd, so
+// embedding code and tests can capture them. Messages are masked by the
+// redactor.
+func (g *globalOptions) setOutput(cmd *cobra.Command) {
+	g.out = cmd.OutOrStdout()
+	g.errOut = g.redactor.Writer(cmd.ErrOrStderr())
+}
+
+// stdout returns the writer of reports
+func (g *globalOptions) stdout() io.Writer {
+	if g.out != nil {
+		return g.out
+	}
+	return os.Stdout
+}
+
+// stderr returns the writer of progress, warnings and other messages
+func (g *globalOptions) stderr() io.Writer {
+	if g.errOut != nil {
+		return g.errOut
+	}
+	return os.Stderr
+}
+
+// plainMu serializes the switching off of colors by writePlain. It only
+// keeps concurrent reports from restoring each other's setting:
+// color.NoColor is process-wide, so output colored at the same time, such
+// as a table another command prints to a terminal, is written plain too.
+var plainMu sync.Mutex
+
+// writePlain runs write against w with terminal colors switched off
+func writePlain(w io.Writer, write func(io.Writer) error) error {
+	plainMu.Lock()
+	defer plainMu.Unlock()
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+	return write(w)
+}
+
+// writeReport runs write against stdout, or against the file at path when
+// one is given. Parent directories are created as needed, and files never
+// get terminal colors. A partially written file is removed on error.
+func (g *globalOptions) writeReport(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return write(g.stdout())
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := writePlain(f, write); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	g.progressf("Results written to %s\n", path)
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/exporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// update rewrites golden files with the current output
+var update = flag.Bool("update", false, "update golden files")
+
+func TestWriteReport_CreatesParentDirectories(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := filepath.Join(t.TempDir(), "nested", "dir", "results.json")
+	err := g.writeReport(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "{}\n")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	if string(content) != "{}\n" {
+		t.Errorf("Unexpected file content: %q", content)
+	}
+}
+
+func TestWriteReport_RemovesFileOnError(t *testing.T) {
+	g := &globalOptions{}
+	path := filepath.Join(t.TempDir(), "results.json")
+	err := g.writeReport(path, func(w io.Writer) error {
+		return fmt.Errorf("boom")
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+		t.Errorf("Expected partial file to be removed, stat error: %v", statErr)
+	}
+}
+
+func TestRunBenchmarkWithExecutor_OutFile(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := filepath.Join(t.TempDir(), "out", "result.json")
+	spec := types.CodeSpec{Name: "ToFile", UserCode: "Integer a = 1;", Iterations: 10}
+
+	err := g.runBenchmarkWithExecutor(context.Background(), &mockExecutor{}, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json", Out: path})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	if !strings.Contains(string(content), `"name": "ToFile"`) {
+		t.Errorf("Expected JSON result in file, got: %s", content)
+	}
+}
+
+func TestParseOutputTargets(t *testing.T) {
+	targets, err := parseOutputTargets(types.BenchmarkConfig{
+		Outputs: []string{"table", "json:results.json"},
+	})
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	expected := []outputTarget{{format: "table"}, {format: "json", path: "results.json"}}
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %d targets, got %v", len(expected), targets)
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("Target %d: expected %+v, got %+v", i, expected[i], targets[i])
+		}
+	}
+}
+
+func TestParseOutputTargets_FallbacksAndErrors(t *testing.T) {
+	targets, err := parseOutputTargets(types.BenchmarkConfig{Output: "json", Out: "out.json"})
+	if err != nil || len(targets) != 1 || targets[0] != (outputTarget{format: "json", path: "out.json"}) {
+		t.Errorf("Expected single target from Output and Out, got %v (err %v)", targets, err)
+	}
+
+	if _, err := parseOutputTargets(types.BenchmarkConfig{Outputs: []string{"xml:a.xml"}}); err == nil || !strings.Contains(err.Error(), "unknown output format") {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+
+	if _, err := parseOutputTargets(types.BenchmarkConfig{Outputs: []string{"json:a", "table:a"}}); err == nil {
+		t.Error("Expected error for the same file requested twice")
+	}
+}
+
+func TestCompareBenchmarksWithExecutor_MultipleOutputs(t *testing.T) {
+	g := &globalOptions{}
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = oldStdout, oldStderr }()
+	os.Stdout, _ = os.Open(os.DevNull)
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := filepath.Join(t.TempDir(), "results.json")
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{
+			{Name: "First", Code: "Integer a = 1;"},
+			{Name: "Second", Code: "Integer b = 2;"},
+		},
+		Iterations: 10,
+		Runs:       1,
+		Parallel:   1,
+		Outputs:    []string{"table", "json:" + path},
+	}
+
+	if err := g.compareBenchmarksWithExecutor(context.Background(), &mockExecutor{}, "test-org", config); err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected JSON file: %v", err)
+	}
+	if !strings.Contains(string(content), `"name": "Second"`) {
+		t.Errorf("Expected JSON results in file, got: %s", content)
+	}
+}
+
+func TestUploadReport(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	var formats []string
+	err := g.uploadReport([]string{"file://" + filepath.ToSlash(dir) + "/"}, func(format string, w io.Writer) error {
+		formats = append(formats, format)
+		_, err := io.WriteString(w, `{"name":"A"}`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("uploadReport() error = %v", err)
+	}
+	if !reflect.DeepEqual(formats, []string{"json"}) {
+		t.Errorf("Expected the JSON report, got %v", formats)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "apex-bench-*.json"))
+	if len(files) != 1 {
+		t.Errorf("Expected one timestamped report, got %v", files)
+	}
+}
+
+func TestCompareCommand_Golden(t *testing.T) {
+	oldNoColor := color.NoColor
+	defer func() { color.NoColor = oldNoColor }()
+
+	var out, errOut bytes.Buffer
+	rootCmd := NewRootCmd()
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&errOut)
+	rootCmd.SetArgs([]string{
+		"compare", "--replay", filepath.Join("testdata", "replay"), "--no-color",
+		"--bench", "Concat:String s = 'a' + 'b';",
+		"--bench", "Format:String s = String.format('{0}', new List<Object>{'a'});",
+		"--runs", "2", "--iterations", "100", "--warmup", "10",
+	})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("compare failed: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "compare.golden")
+	if *update {
+		if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(want) {
+		t.Errorf("Output differs from %s (run with -update to accept it):\n%s", golden, out.String())
+	}
+	if !strings.Contains(errOut.String(), "[2/2] Running benchmark: Format") {
+		t.Errorf("Expected progress on the command's error writer, got: %s", errOut.String())
+	}
+}
+
+func TestExportResults(t *testing.T) {
+	g := &globalOptions{}
+	var got []exporter.Point
+	exporter.Register(exporter.Exporter{Name: "capture", KeyEnv: "CAPTURE_KEY", Export: func(ctx context.Context, key string, points []exporter.Point) error {
+		got = points
+		return nil
+	}})
+	t.Setenv("CAPTURE_KEY", "key")
+	t.Setenv(gitRefEnv, "feature/faster-maps")
+
+	g.exports = []string{"capture"}
+	if err := g.exportResults([]types.AggregatedResult{{Name: "A", AvgCpuMs: 2}}, "dev"); err != nil {
+		t.Fatalf("exportResults() error = %v", err)
+	}
+	if len(got) == 0 || got[0].Value != 2 || got[0].Tags["org"] != "dev" || got[0].Tags["git_ref"] != "feature/faster-maps" {
+		t.Errorf("Unexpected points: %+v", got)
+	}
+}
+
+func TestGitRef(t *testing.T) {
+	g := &globalOptions{}
+	t.Setenv(gitRefEnv, "")
+
+	branch := "main\n"
+	g.git = func(dir string, args ...string) ([]byte, error) {
+		if args[1] == "--short" {
+			return []byte("abc1234\n"), nil
+		}
+		return []byte(branch), nil
+	}
+	if ref := g.gitRef(); ref != "main" {
+		t.Errorf("gitRef() = %q, want the branch", ref)
+	}
+	branch = "HEAD\n"
+	if ref := g.gitRef(); ref != "abc1234" {
+		t.Errorf("gitRef() = %q, want the commit of a detached checkout", ref)
+	}
+	g.git = func(dir string, args ...string) ([]byte, error) { return nil, fmt.Errorf("not a git repository") }
+	if ref := g.gitRef(); ref != "" {
+		t.Errorf("gitRef() = %q outside a repository, want none", ref)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+)
+
+// newRedactor builds the redactor of the --redact values, regular
+// expressions or env:NAME for the value of an environment variable, and of
+// the values of --var variables with secret-looking names
+func (g *globalOptions) newRedactor() (*redact.Redactor, error) {
+	vars, _ := parseVars(g.vars) // Checked by resolveFlags
+	secrets := redact.SecretValues(vars)
+	var patterns []string
+	for _, value := range g.redact {
+		name, ok := strings.CutPrefix(value, "env:")
+		if !ok {
+			patterns = append(patterns, value)
+			continue
+		}
+		if !generator.VarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid --redact %q (expected env:NAME)", value)
+		}
+		if secret := os.Getenv(name); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return redact.New(patterns, secrets)
+}
+
+// redactReport wraps report so that every rendering is masked by r
+func redactReport(r *redact.Redactor, report func(format string, w io.Writer) error) func(format string, w io.Writer) error {
+	if r == nil {
+		return report
+	}
+	return func(format string, w io.Writer) error {
+		var buf bytes.Buffer
+		if err := report(format, &buf); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, r.String(buf.String()))
+		return err
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+	"github.com/spf13/cobra"
+)
+
+func TestNewRedactor(t *testing.T) {
+	g := &globalOptions{}
+	t.Setenv("APEX_BENCH_TEST_SID", "00D5g000004ABCD!AQ4AQ")
+
+	if r, err := g.newRedactor(); err != nil || r != nil {
+		t.Fatalf("Expected no redactor without --redact, got %v, %v", r, err)
+	}
+
+	g.vars = []string{"API_TOKEN=tok-123456", "ACCOUNT_ID=001000000000001"}
+	g.redact = []string{`Bearer \S+`, "env:APEX_BENCH_TEST_SID"}
+	r, err := g.newRedactor()
+	if err != nil {
+		t.Fatalf("newRedactor() error = %v", err)
+	}
+	got := r.String("tok-123456 Bearer xyz 00D5g000004ABCD!AQ4AQ 001000000000001")
+	want := strings.Join([]string{redact.Mask, redact.Mask, redact.Mask, "001000000000001"}, " ")
+	if got != want {
+		t.Errorf("Redacted %q, want %q", got, want)
+	}
+
+	g.redact = []string{"env:NOT A NAME"}
+	if _, err := g.newRedactor(); err == nil {
+		t.Error("Expected an error for an invalid env:NAME")
+	}
+}
+
+func TestRedactReport(t *testing.T) {
+	r, _ := redact.New(nil, []string{"tok-123456"})
+	report := redactReport(r, func(format string, w io.Writer) error {
+		_, err := io.WriteString(w, format+": failed with tok-123456\n")
+		return err
+	})
+	var buf bytes.Buffer
+	if err := report("table", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "table: failed with "+redact.Mask+"\n" {
+		t.Errorf("Report = %q", buf.String())
+	}
+}
+
+func TestSetOutput_Redacts(t *testing.T) {
+	r, _ := redact.New(nil, []string{"tok-123456"})
+	g := &globalOptions{redactor: r}
+	var out, errOut bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	g.setOutput(cmd)
+
+	g.warnf("request with tok-123456 failed")
+	if errOut.String() != "Warning: request with "+redact.Mask+" failed\n" {
+		t.Errorf("Expected the message masked, got %q", errOut.String())
+	}
+	if g.stdout() != &out {
+		t.Error("Expected reports written to the command's output")
+	}
+}
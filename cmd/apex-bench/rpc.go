@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// rpcOptions are the flags of an rpc command
+type rpcOptions struct {
+	global  *globalOptions
+	backend string
+}
+
+// newRPCCmd creates an rpc command with g as its global options
+func newRPCCmd(g *globalOptions) *cobra.Command {
+	o := &rpcOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "rpc",
+		Short: "Serve benchmarks over JSON-RPC on stdin and stdout",
+		Long: `Run as a long-lived backend for editor extensions, speaking JSON-RPC 2.0
+with one JSON message per line: requests on stdin, responses and
+notifications on stdout, logs on stderr.
+
+Methods:
+  benchmark   params: a suite (as in suite files, in JSON), or a single
+              benchmark given by "code" and optionally "name", "setup" and
+              "teardown" next to the settings, e.g. the current selection:
+                {"code": "Integer a = 1;", "iterations": 50}
+              result: {"results": [...]} as in JSON output. While it runs,
+              "progress" notifications report {"id", "completed", "total"}
+              executions.
+  cancel      params: {"id": <id of a benchmark request>}; the request
+              fails with the partial results.
+  shutdown    waits for running requests, answers and exits.
+
+Requests run concurrently and share the execution queue. The process also
+exits when stdin is closed.`,
+		Args: cobra.NoArgs,
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+	return cmd
+}
+
+func (o *rpcOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+	if err != nil {
+		return err
+	}
+	flags := cmd.Flags()
+	server := newRPCServer(commandContext(cmd), g, exec, org, cmd.OutOrStdout(), func(config *types.BenchmarkConfig) {
+		g.applySuiteOverrides(flags, config)
+	})
+	g.progressf("Serving benchmarks over JSON-RPC on stdin and stdout...\n")
+	return server.serve(cmd.InOrStdin())
+}
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcBenchmarkError = -32000 // A benchmark request failed
+)
+
+// rpcMessage is a JSON-RPC request, notification or response
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a JSON-RPC response
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// rpcProgress is the params of a progress notification
+type rpcProgress struct {
+	ID        json.RawMessage `json:"id,omitempty"`
+	Completed int             `json:"completed"` // Executions finished so far
+	Total     int             `json:"total"`     // Executions the request needs
+}
+
+// rpcResults is the result of a benchmark request
+type rpcResults struct {
+	Results []types.AggregatedResult `json:"results"`
+}
+
+// rpcServer answers JSON-RPC requests, running benchmark requests in the
+// background
+type rpcServer struct {
+	ctx       context.Context // Cancels running requests
+	global    *globalOptions
+	exec      executor.Executor
+	org       string
+	overrides func(*types.BenchmarkConfig) // Server-wide settings applied to each request; may be nil
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc // Running requests by ID
+	running sync.WaitGroup
+}
+
+// newRPCServer creates a server running requests against org with exec
+// until ctx is done, writing messages to out and logs as g does
+func newRPCServer(ctx context.Context, g *globalOptions, exec executor.Executor, org string, out io.Writer, overrides func(*types.BenchmarkConfig)) *rpcServer {
+	return &rpcServer{
+		ctx:       ctx,
+		global:    g,
+		exec:      exec,
+		org:       org,
+		overrides: overrides,
+		out:       out,
+		cancels:   make(map[string]context.CancelFunc),
+	}
+}
+
+// serve answers the requests read from in until it ends, shutdown is
+// requested or the server's context is done, then waits for running
+// requests
+func (s *rpcServer) serve(in io.Reader) error {
+	defer s.running.Wait()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), maxRequestSize)
+		for scanner.Scan() {
+			select {
+			case lines <- append([]byte(nil), scanner.Bytes()...):
+			case <-done:
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("failed to read requests: %w", err)
+			}
+			return nil
+		case line := <-lines:
+			if strings.TrimSpace(string(line)) == "" {
+				continue
+			}
+			if s.handle(line) {
+				return nil
+			}
+		}
+	}
+}
+
+// handle answers one message and reports whether shutdown was requested
+func (s *rpcServer) handle(line []byte) bool {
+	var req rpcMessage
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.reply(nil, nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+		return false
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.reply(req.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: `expected a "2.0" request with a method`})
+		return false
+	}
+
+	switch req.Method {
+	case "benchmark":
+		config, err := rpcBenchmarkConfig(req.Params)
+		if err != nil {
+			s.reply(req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()})
+			return false
+		}
+		s.start(req.ID, config)
+	case "cancel":
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ID) == 0 {
+			s.reply(req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: `cancel needs the "id" of a request`})
+			return false
+		}
+		s.mu.Lock()
+		cancel, ok := s.cancels[string(params.ID)]
+		s.mu.Unlock()
+		if ok {
+			cancel()
+		}
+		s.reply(req.ID, map[string]bool{"cancelled": ok}, nil)
+	case "shutdown":
+		s.running.Wait()
+		s.reply(req.ID, map[string]bool{}, nil)
+		return true
+	default:
+		s.reply(req.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)})
+	}
+	return false
+}
+
+// rpcBenchmarkConfig reads the suite of a benchmark request, turning a
+// top-level "code" into a single benchmark
+func rpcBenchmarkConfig(params json.RawMessage) (types.BenchmarkConfig, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(params, &fields); err != nil || fields == nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("benchmark params must be an object")
+	}
+	if _, ok := fields["code"]; ok {
+		if _, ok := fields["benchmarks"]; ok {
+			return types.BenchmarkConfig{}, fmt.Errorf(`give either "code" or "benchmarks", not both`)
+		}
+		single := map[string]any{"name": "Selection"}
+		for _, key := range []string{"name", "code", "setup", "teardown"} {
+			if v, ok := fields[key]; ok {
+				single[key] = v
+				delete(fields, key)
+			}
+		}
+		fields["benchmarks"] = []any{single}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("failed to encode params: %w", err)
+	}
+	config, err := parseSuite(data, "request")
+	if err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	if len(config.Outputs) > 0 || config.Out != "" {
+		return types.BenchmarkConfig{}, fmt.Errorf("out and outputs are not accepted; results are returned in the response")
+	}
+	return config, nil
+}
+
+// start runs a benchmark request in the background, reporting its
+// progress and answering when it finishes
+func (s *rpcServer) start(id json.RawMessage, config types.BenchmarkConfig) {
+	if s.overrides != nil {
+		s.overrides(&config)
+	}
+	if config.Org == "" {
+		config.Org = s.org
+	}
+	config.Outputs, config.Out, config.Output = nil, "", compareDefaultOutput
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	if len(id) > 0 {
+		s.cancels[string(id)] = cancel
+	}
+	s.mu.Unlock()
+
+	total := len(config.Benchmarks) * max(config.Runs, 1)
+	if config.Combine {
+		total = max(config.Runs, 1)
+	}
+	var progressMu sync.Mutex
+	completed := 0
+	exec := executor.NewObservingExecutor(s.exec, func(executor.ExecResult, error) {
+		progressMu.Lock()
+		completed++
+		progress := rpcProgress{ID: id, Completed: completed, Total: total}
+		progressMu.Unlock()
+		s.notify("progress", progress)
+	})
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.cancels, string(id))
+			s.mu.Unlock()
+			cancel()
+		}()
+
+		c, err := s.global.runComparison(ctx, exec, config.Org, config)
+		if err == nil {
+			err = c.Err(ctx)
+		}
+		if err != nil {
+			fmt.Fprintf(s.global.stderr(), "Request %s failed: %v\n", id, err)
+			var data any
+			if len(c.Results) > 0 {
+				data = rpcResults{Results: c.Results}
+			}
+			s.reply(id, nil, &rpcError{Code: rpcBenchmarkError, Message: err.Error(), Data: data})
+			return
+		}
+		s.reply(id, rpcResults{Results: c.Results}, nil)
+	}()
+}
+
+// reply answers the request with id; notifications, which have no id, get
+// no answer unless they could not be parsed
+func (s *rpcServer) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	if len(id) == 0 && (rpcErr == nil || rpcErr.Code != rpcParseError) {
+		return
+	}
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if result == nil && rpcErr == nil {
+		result = map[string]any{}
+	}
+	s.write(rpcMessage{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr})
+}
+
+// notify sends a notification
+func (s *rpcServer) notify(method string, params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(rpcMessage{JSONRPC: "2.0", Method: method, Params: data})
+}
+
+// write sends one message on its own line
+func (s *rpcServer) write(msg rpcMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Fprintf(s.global.stderr(), "Failed to encode response: %v\n", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+)
+
+func TestRPCServer(t *testing.T) {
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	requests := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "benchmark", "params": {"code": "Integer a = 1;", "iterations": 10, "runs": 2}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "benchmark", "params": {"benchmarks": [{"name": "A", "code": "Integer a = 1;"}, {"name": "B", "code": "Integer b = 2;"}], "iterations": 10}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "benchmark", "params": {"code": "Integer a = 1;", "iteratons": 10}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "benchmark", "params": {"code": "Integer a = 1;", "out": "results.json"}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "cancel", "params": {"id": 99}}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "explain"}`,
+		``,
+		`not json`,
+	}, "\n")
+
+	var out bytes.Buffer
+	server := newRPCServer(context.Background(), &globalOptions{}, executor.NewSimulatedExecutor(), "dev", &out, nil)
+	if err := server.serve(strings.NewReader(requests)); err != nil {
+		t.Fatalf("serve() error = %v", err)
+	}
+
+	responses := make(map[string]rpcMessage)
+	progress := 0
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg struct {
+			rpcMessage
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("Invalid message %q: %v", line, err)
+		}
+		if msg.Method == "progress" {
+			progress++
+			continue
+		}
+		msg.rpcMessage.Result = msg.Result
+		responses[string(msg.ID)] = msg.rpcMessage
+	}
+
+	var results rpcResults
+	if r := responses["1"]; r.Error != nil || json.Unmarshal(r.Result.(json.RawMessage), &results) != nil || len(results.Results) != 1 || results.Results[0].Name != "Selection" {
+		t.Errorf("Expected the selection's result, got %+v", r)
+	}
+	if r := responses["2"]; r.Error != nil || json.Unmarshal(r.Result.(json.RawMessage), &results) != nil || len(results.Results) != 2 {
+		t.Errorf("Expected the results of A and B, got %+v", r)
+	}
+	if progress != 4 {
+		t.Errorf("Expected a progress notification per execution, got %d", progress)
+	}
+	for id, code := range map[string]int{"3": rpcInvalidParams, "4": rpcInvalidParams, "6": rpcMethodNotFound, "null": rpcParseError} {
+		if r := responses[id]; r.Error == nil || r.Error.Code != code {
+			t.Errorf("Expected error %d for request %s, got %+v", code, id, r)
+		}
+	}
+	if r := responses["5"]; r.Error != nil || string(r.Result.(json.RawMessage)) != `{"cancelled":false}` {
+		t.Errorf("Expected nothing to cancel, got %+v", r)
+	}
+}
@@ -1,155 +1,371 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
-	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
-	"github.com/ipavlic/apex-benchmark-cli/pkg/parser"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
-	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 	"github.com/spf13/cobra"
 )
 
-var (
-	// Flags for run command
-	runCode       string
-	runFile       string
-	runName       string
-	runIterations int
-	runWarmup     int
-	runRuns       int
-	runParallel   int
-	runTrackHeap  bool
-	runTrackDB    bool
-	runOrg        string
-	runOutput     string
-)
-
-var runCmd = &cobra.Command{
-	Use:   "run",
-	Short: "Run a single benchmark",
-	Long: `Run a benchmark on a single Apex code snippet.
-You must provide either --code for inline code or --file for a code file.`,
-	RunE: runBenchmark,
+// runOptions are the flags of a run command
+type runOptions struct {
+	global *globalOptions
+	measureOptions
+	code          string
+	file          string
+	fence         int
+	fromClipboard bool
+	name          string
+	minSuccessful int
+	trackHeapPeak bool
+	trackCache    string
+	queryPlan     bool
+	captureDebug  bool
+	debugLogDir   string
+	keepLogs      string
+	showRuns      bool
+	raw           string
+	noRaw         bool
+	record        string
+	replay        string
+	apiFloor      int
 }
 
-func init() {
-	runCmd.Flags().StringVar(&runCode, "code", "", "Inline Apex code to benchmark")
-	runCmd.Flags().StringVar(&runFile, "file", "", "Path to Apex code file")
-	runCmd.Flags().StringVar(&runName, "name", "Benchmark", "Benchmark name")
-	runCmd.Flags().IntVar(&runIterations, "iterations", 100, "Number of measurement iterations")
-	runCmd.Flags().IntVar(&runWarmup, "warmup", 10, "Number of warmup iterations")
-	runCmd.Flags().IntVar(&runRuns, "runs", 1, "Number of complete runs for aggregation")
-	runCmd.Flags().IntVar(&runParallel, "parallel", 1, "Maximum concurrent executions")
-	runCmd.Flags().BoolVar(&runTrackHeap, "track-heap", false, "Enable heap usage tracking")
-	runCmd.Flags().BoolVar(&runTrackDB, "track-db", false, "Enable DML/SOQL tracking")
-	runCmd.Flags().StringVar(&runOrg, "org", "", "Target Salesforce org (uses default if not specified)")
-	runCmd.Flags().StringVar(&runOutput, "output", "json", "Output format: json, table")
+// runDefaultOutput is the report format used when --output is not given
+const runDefaultOutput = "json"
+
+// NewRunCmd creates a run command with g as its global options. Its flags
+// are bound to variables of its own, so separate instances can be executed
+// concurrently and repeatedly without seeing each other's flags.
+func NewRunCmd(g *globalOptions) *cobra.Command {
+	o := &runOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "run [dir]",
+		Short: "Run a single benchmark",
+		Long: `Run a benchmark on a single Apex code snippet.
+You must provide either --code for inline code or --file for a code file.
+Either flag given as - reads the code from stdin:
+
+  apex-bench run --code - < snippet.apex
+
+--from-clipboard benchmarks the code on the system clipboard instead, and
+the global --copy-result copies the report back, e.g. a snippet copied from
+the Developer Console:
+
+  apex-bench run --from-clipboard --output table --copy-result
+
+Given a directory instead, every .apex file in it is a benchmark named after
+the file, run with these settings and compared; end the directory with /...
+to include its subdirectories. A .yaml sidecar next to a file, with the same
+base name, may set its name, setup, teardown, tags, units and threshold:
+
+  apex-bench run ./benchmarks/... --runs 5`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: o.run,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&o.code, "code", "", "Inline Apex code to benchmark (- reads it from stdin)")
+	flags.StringVar(&o.file, "file", "", "Path to Apex code file (- reads stdin); a pattern such as dir/*.apex compares every matching file")
+	flags.IntVar(&o.fence, "fence", 0, "Benchmark this apex code fence of a Markdown --file, counting from 1 (default: its only one)")
+	flags.BoolVar(&o.fromClipboard, "from-clipboard", false, "Benchmark the Apex code on the system clipboard")
+	flags.StringVar(&o.name, "name", "", "Benchmark name (default: the --file name without its extension, or "+defaultBenchName+")")
+	o.measureOptions.addFlags(flags)
+	flags.IntVar(&o.minSuccessful, "min-successful-runs", 0, "Aggregate the successful runs when some fail, if at least this many succeed (0 requires all)")
+	flags.BoolVar(&o.trackHeapPeak, "track-heap-peak", false, "Track the heap high-water mark during measurement and its share of the heap limit")
+	flags.StringVar(&o.trackCache, "track-cache", "", "Track keys and capacity used in this Platform Cache partition, e.g. local.Bench, or session:local.Bench for the session cache")
+	flags.BoolVar(&o.queryPlan, "query-plan", false, "Attach the query plan of each inline SOQL query (requires --track-db)")
+	flags.BoolVar(&o.captureDebug, "capture-debug", false, "Attach System.debug output from benchmark code to the results")
+	flags.StringVar(&o.debugLogDir, "debug-log-dir", "", "Write captured System.debug output to this directory (implies --capture-debug)")
+	flags.StringVar(&o.keepLogs, "keep-logs", "", "Save each run's full debug log under this directory")
+	flags.BoolVar(&o.showRuns, "show-runs", false, "Also print a table of each run's averages in table output")
+	flags.StringVar(&o.raw, "raw", "full", "Per-run results in JSON output: full, summary (only their count) or none")
+	flags.BoolVar(&o.noRaw, "no-raw", false, "Leave per-run results out of JSON output (same as --raw none)")
+	flags.IntVar(&o.apiFloor, "api-floor", 0, "Stop before the org's remaining daily API requests drop below this (0 disables)")
+	flags.StringVar(&o.record, "record", "", "Save every execution to this directory for later replay")
+	flags.StringVar(&o.replay, "replay", "", "Replay executions saved with --record (or debug logs) from this directory instead of running them")
+	cmd.MarkFlagsMutuallyExclusive("raw", "no-raw")
+	return cmd
 }
 
-func runBenchmark(cmd *cobra.Command, args []string) error {
+func (o *runOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	if len(args) == 1 {
+		return o.runDir(cmd, args[0])
+	}
+
 	// Validate flags
-	if runCode == "" && runFile == "" {
+	if o.code == "" && o.file == "" && !o.fromClipboard {
 		return fmt.Errorf("must provide either --code or --file")
 	}
-	if runCode != "" && runFile != "" {
+	if o.code != "" && o.file != "" {
 		return fmt.Errorf("cannot provide both --code and --file")
 	}
+	if o.fromClipboard && (o.code != "" || o.file != "") {
+		return fmt.Errorf("cannot combine --from-clipboard with --code or --file")
+	}
+	if o.fence != 0 && !bench.IsMarkdown(o.file) {
+		return fmt.Errorf("--fence needs a Markdown --file (.md)")
+	}
 
-	// Check Salesforce CLI
-	if err := executor.CheckSalesforceCLI(); err != nil {
-		return err
+	// A pattern matching several files compares them, like a directory
+	file := o.file
+	if isGlob(file) {
+		files, names, err := globFiles(file)
+		if err != nil {
+			return err
+		}
+		if len(files) > 1 {
+			config := suiteDefaults()
+			for i, file := range files {
+				config.Benchmarks = append(config.Benchmarks, types.BenchmarkSpec{Name: names[i], File: file, Fence: o.fence})
+			}
+			return o.compare(cmd, config)
+		}
+		file = files[0]
 	}
 
-	// Get org
-	org, err := executor.GetOrg(runOrg)
+	// Select the backend and the org it runs against
+	exec, org, err := g.newExecutor(executorOptions{
+		Backend:   o.backend,
+		Org:       g.org,
+		RecordDir: o.record,
+		ReplayDir: o.replay,
+		APIFloor:  o.apiFloor,
+	})
 	if err != nil {
 		return err
 	}
-	if runOrg == "" {
-		fmt.Fprintf(os.Stderr, "Using default org: %s\n", org)
-	}
 
-	// Read code from file if needed
-	userCode := runCode
-	if runFile != "" {
-		content, err := os.ReadFile(runFile)
-		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", runFile, err)
+	// Read code from file, stdin or the clipboard if needed
+	var userCode string
+	if o.fromClipboard {
+		userCode, err = g.readClipboard()
+		if err == nil && strings.TrimSpace(userCode) == "" {
+			err = fmt.Errorf("the clipboard holds no code")
 		}
-		userCode = string(content)
+	} else {
+		userCode, err = g.readCode(o.code, file, o.fence, cmd.InOrStdin())
+	}
+	if err != nil {
+		return err
 	}
 
 	// Build CodeSpec
 	spec := types.CodeSpec{
-		Name:       runName,
-		UserCode:   strings.TrimSpace(userCode),
-		Iterations: runIterations,
-		Warmup:     runWarmup,
-		TrackHeap:  runTrackHeap,
-		TrackDB:    runTrackDB,
+		Name:          benchName(o.name, file, o.fence),
+		UserCode:      strings.TrimSpace(userCode),
+		Iterations:    o.iterations,
+		Warmup:        o.warmup,
+		BatchSize:     o.batchSize,
+		TrackHeap:     o.trackHeap,
+		TrackHeapPeak: o.trackHeapPeak,
+		TrackDB:       o.trackDB,
+		TrackCache:    o.trackCache,
+		Namespace:     g.namespace,
+		Vars:          g.benchVars(nil),
 	}
 
-	// Create executor and run
-	exec := executor.NewCLIExecutor()
-	return runBenchmarkWithExecutor(exec, org, spec, runOutput, runRuns, runParallel)
+	// Run
+	config := types.BenchmarkConfig{
+		Runs:           o.runs,
+		MinSuccessful:  o.minSuccessful,
+		QueryPlan:      o.queryPlan,
+		Parallel:       g.parallel,
+		Timeout:        g.timeout,
+		Delay:          g.delay,
+		Jitter:         g.jitter,
+		CaptureDebug:   o.captureDebug,
+		DebugLogDir:    o.debugLogDir,
+		KeepLogs:       o.keepLogs,
+		Aggregate:      o.aggregate,
+		NoiseThreshold: o.noiseThreshold,
+		Metrics:        o.metrics,
+		ShowRuns:       o.showRuns,
+		Raw:            rawFlag(o.raw, o.noRaw),
+		APIVersion:     o.apiVersion,
+		Outputs:        g.outputs,
+		Output:         runDefaultOutput,
+		Out:            o.out,
+	}
+	return g.runBenchmarkWithExecutor(commandContext(cmd), exec, org, spec, config)
 }
 
-// runBenchmarkWithExecutor is the testable core logic
-func runBenchmarkWithExecutor(exec executor.Executor, org string, spec types.CodeSpec, outputFormat string, runs int, parallel int) error {
-	// Generate Apex code
-	fmt.Fprintf(os.Stderr, "Generating benchmark code...\n")
-	apexCode, err := generator.Generate(spec)
+// runDir runs every benchmark file in dir with the settings of
+// the run flags and compares them
+func (o *runOptions) runDir(cmd *cobra.Command, dir string) error {
+	if o.code != "" || o.file != "" || o.fromClipboard {
+		return fmt.Errorf("cannot combine a benchmark directory with --code, --file or --from-clipboard")
+	}
+	if !isBenchmarkDir(dir) {
+		return fmt.Errorf("%s is not a directory; use --file for a single benchmark file", dir)
+	}
+	config, err := loadBenchmarkDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to generate code: %w", err)
+		return err
 	}
+	return o.compare(cmd, config)
+}
 
-	// Execute
-	var outputs []string
+// compare compares the benchmarks of config with the settings of the run
+// flags
+func (o *runOptions) compare(cmd *cobra.Command, config types.BenchmarkConfig) error {
+	g := o.global
+	config.Iterations = o.iterations
+	config.Warmup = o.warmup
+	config.BatchSize = o.batchSize
+	config.Runs = o.runs
+	config.MinSuccessful = o.minSuccessful
+	config.TrackHeap = o.trackHeap
+	config.TrackHeapPeak = o.trackHeapPeak
+	config.TrackDB = o.trackDB
+	config.TrackCache = o.trackCache
+	config.QueryPlan = o.queryPlan
+	config.CaptureDebug = o.captureDebug
+	config.DebugLogDir = o.debugLogDir
+	config.KeepLogs = o.keepLogs
+	config.Aggregate = o.aggregate
+	config.NoiseThreshold = o.noiseThreshold
+	config.Metrics = o.metrics
+	config.ShowRuns = o.showRuns
+	config.Raw = rawFlag(o.raw, o.noRaw)
+	config.APIVersion = o.apiVersion
+	config.Parallel = g.parallel
+	config.Timeout = g.timeout
+	config.Delay = g.delay
+	config.Jitter = g.jitter
+	config.Namespace = g.namespace
+	config.Vars = g.benchVars(config.Vars)
+	config.Outputs = g.outputs
+	config.Output = runDefaultOutput
+	config.Out = o.out
 
-	if runs == 1 {
-		fmt.Fprintf(os.Stderr, "Executing benchmark (1 run)...\n")
-		output, err := exec.Run(apexCode, org)
-		if err != nil {
-			return fmt.Errorf("execution failed: %w", err)
+	exec, org, err := g.newExecutor(executorOptions{
+		Backend:   o.backend,
+		Org:       g.org,
+		RecordDir: o.record,
+		ReplayDir: o.replay,
+		APIFloor:  o.apiFloor,
+	})
+	if err != nil {
+		return err
+	}
+	return g.compareBenchmarksWithExecutor(commandContext(cmd), exec, org, config)
+}
+
+// runBenchmarkWithExecutor is the testable core logic. Execution and output
+// settings are taken from config; its benchmark list is not used. When ctx
+// is cancelled after some runs finished, their partial result is reported
+// before the error is returned.
+func (g *globalOptions) runBenchmarkWithExecutor(ctx context.Context, exec executor.Executor, org string, spec types.CodeSpec, config types.BenchmarkConfig) error {
+	targets, err := parseOutputTargets(config)
+	if err != nil {
+		return err
+	}
+	single, runErr := orchestrator.Run(ctx, g.sessionOptions(exec, org, config), spec)
+	runErr = flagError(runErr)
+	if runErr != nil && !single.Result.Partial {
+		return runErr
+	}
+
+	// Output
+	g.progressf("\n")
+	err = g.writeReports(targets, func(format string, w io.Writer) error {
+		if format == "table" {
+			return reporter.PrintTableWithMetrics(single.Result, w, single.Metrics)
 		}
-		outputs = []string{output}
-	} else {
-		fmt.Fprintf(os.Stderr, "Executing benchmark (%d runs, %d parallel)...\n", runs, parallel)
-		var err error
-		outputs, err = exec.ExecuteParallel(apexCode, runs, parallel, org)
+		return reporter.PrintJSON(reporter.TrimRawResult(single.Result, single.Raw), w)
+	})
+	if err != nil {
+		return err
+	}
+	if err := g.exportResults([]types.AggregatedResult{single.Result}, org); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// readCode returns the Apex code given with --code, or read from the --file
+// path, taking the apex code fence numbered fence of a Markdown file. Either
+// given as "-" reads the code from stdin.
+func (g *globalOptions) readCode(code, file string, fence int, stdin io.Reader) (string, error) {
+	if code == "-" || file == "-" {
+		if f, ok := stdin.(*os.File); ok {
+			if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				g.progressf("Reading Apex code from stdin; end it with Ctrl-D\n")
+			}
+		}
+		content, err := io.ReadAll(stdin)
 		if err != nil {
-			return fmt.Errorf("execution failed: %w", err)
+			return "", fmt.Errorf("failed to read code from stdin: %w", err)
 		}
+		if strings.TrimSpace(string(content)) == "" {
+			return "", fmt.Errorf("no code on stdin")
+		}
+		return string(content), nil
 	}
+	return bench.ReadCode(types.BenchmarkSpec{Code: code, File: file, Fence: fence})
+}
 
-	// Parse results
-	fmt.Fprintf(os.Stderr, "Parsing results...\n")
-	results, err := parser.ParseMultipleResults(outputs)
-	if err != nil {
-		return fmt.Errorf("failed to parse results: %w", err)
+// defaultBenchName names benchmarks given neither --name nor --file
+const defaultBenchName = "Benchmark"
+
+// benchName returns the benchmark name given with --name or, when it is
+// empty, derived from file; without either it is defaultBenchName
+func benchName(name, file string, fence int) string {
+	switch {
+	case name != "":
+		return name
+	case file == "" || file == "-":
+		return defaultBenchName
 	}
+	return fileBenchName(file, fence)
+}
 
-	// Aggregate
-	fmt.Fprintf(os.Stderr, "Aggregating results...\n")
-	aggregated, err := stats.Aggregate(results)
-	if err != nil {
-		return fmt.Errorf("failed to aggregate results: %w", err)
+// fileBenchName derives a benchmark name from its file: the base name
+// without the extension, followed by #N for code fence N of a Markdown file
+func fileBenchName(file string, fence int) string {
+	base := filepath.Base(file)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if fence > 0 {
+		name += "#" + strconv.Itoa(fence)
 	}
-	aggregated.Warmup = spec.Warmup
+	return name
+}
 
-	// Output
-	fmt.Fprintf(os.Stderr, "\n")
-	switch outputFormat {
-	case "json":
-		return reporter.PrintJSON(aggregated, os.Stdout)
-	case "table":
-		return reporter.PrintTable(aggregated, os.Stdout)
-	default:
-		return fmt.Errorf("unknown output format: %s", outputFormat)
+// sessionOptions returns the orchestrator options of a session, reporting
+// progress and warnings on stderr according to --quiet and --verbose, and
+// every execution with --log-format json
+func (g *globalOptions) sessionOptions(exec executor.Executor, org string, config types.BenchmarkConfig) orchestrator.Options {
+	opts := orchestrator.Options{
+		Executor: exec,
+		Org:      org,
+		Config:   config,
+		Logf:     g.progressf,
+		Debugf:   g.verbosef,
+		Warnf: func(format string, args ...interface{}) {
+			g.logf(slog.LevelWarn, "  Warning: ", format+"\n", args...)
+		},
+		Redactor: g.redactor,
 	}
+	if g.jsonLogs() {
+		opts.OnRunComplete = g.logRun
+	}
+	return opts
+}
+
+// newRunner creates a benchmark runner reporting like sessionOptions
+func (g *globalOptions) newRunner(exec executor.Executor, org string, config types.BenchmarkConfig) *bench.Runner {
+	return g.sessionOptions(exec, org, config).Runner()
 }
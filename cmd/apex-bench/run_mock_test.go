@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
@@ -14,22 +17,36 @@ import (
 type mockExecutor struct {
 	runFunc             func(apexCode string, org string) (string, error)
 	executeParallelFunc func(apexCode string, runs int, maxConcurrent int, org string) ([]string, error)
+	lastRequest         executor.ExecRequest
 }
 
-func (m *mockExecutor) Run(apexCode string, org string) (string, error) {
+func (m *mockExecutor) Run(ctx context.Context, req executor.ExecRequest) (executor.ExecResult, error) {
+	m.lastRequest = req
 	if m.runFunc != nil {
-		return m.runFunc(apexCode, org)
+		output, err := m.runFunc(req.Code, req.Org)
+		return executor.ExecResult{Logs: output}, err
 	}
-	return mockSuccessfulBenchResultFromCode(apexCode), nil
+	return executor.ExecResult{Logs: mockSuccessfulBenchResultFromCode(req.Code)}, nil
 }
 
-func (m *mockExecutor) ExecuteParallel(apexCode string, runs int, maxConcurrent int, org string) ([]string, error) {
+func (m *mockExecutor) ExecuteParallel(ctx context.Context, req executor.ExecRequest, runs int, maxConcurrent int) ([]executor.ExecResult, error) {
+	m.lastRequest = req
+	var outputs []string
 	if m.executeParallelFunc != nil {
-		return m.executeParallelFunc(apexCode, runs, maxConcurrent, org)
+		var err error
+		outputs, err = m.executeParallelFunc(req.Code, runs, maxConcurrent, req.Org)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for i := 0; i < runs; i++ {
+			outputs = append(outputs, mockSuccessfulBenchResultFromCode(req.Code))
+		}
 	}
-	results := make([]string, runs)
-	for i := 0; i < runs; i++ {
-		results[i] = mockSuccessfulBenchResultFromCode(apexCode)
+
+	results := make([]executor.ExecResult, len(outputs))
+	for i, output := range outputs {
+		results[i] = executor.ExecResult{Logs: output}
 	}
 	return results, nil
 }
@@ -41,22 +58,39 @@ USER_DEBUG|[DEBUG]`
 }
 
 func mockSuccessfulBenchResultFromCode(apexCode string) string {
-	// Extract benchmark name from generated code
-	// The generated code contains: "name":"BenchmarkName" in the JSON
-	name := "TestBench"
-	if strings.Contains(apexCode, `"name":"`) {
-		start := strings.Index(apexCode, `"name":"`) + len(`"name":"`)
-		end := strings.Index(apexCode[start:], `"`)
-		if end > 0 {
-			name = apexCode[start : start+end]
+	// Extract benchmark names from generated code
+	// The generated code contains: "name":"BenchmarkName" in the JSON,
+	// once per benchmark when several are combined into one script
+	var names []string
+	rest := apexCode
+	for {
+		idx := strings.Index(rest, `"name":"`)
+		if idx == -1 {
+			break
+		}
+		rest = rest[idx+len(`"name":"`):]
+		end := strings.Index(rest, `"`)
+		if end <= 0 {
+			break
 		}
+		names = append(names, rest[:end])
+		rest = rest[end:]
+	}
+	if len(names) == 0 {
+		names = []string{"TestBench"}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("USER_DEBUG|[DEBUG]\n")
+	for _, name := range names {
+		fmt.Fprintf(&sb, `USER_DEBUG|BENCH_RESULT:{"name":"%s","iterations":10,"avgCpuMs":5.5,"minCpuMs":5.0,"maxCpuMs":6.0,"avgWallMs":5.5,"minWallMs":5.0,"maxWallMs":6.0}`+"\n", name)
 	}
-	return fmt.Sprintf(`USER_DEBUG|[DEBUG]
-USER_DEBUG|BENCH_RESULT:{"name":"%s","iterations":10,"avgCpuMs":5.5,"minCpuMs":5.0,"maxCpuMs":6.0,"avgWallMs":5.5,"minWallMs":5.0,"maxWallMs":6.0}
-USER_DEBUG|[DEBUG]`, name)
+	sb.WriteString("USER_DEBUG|[DEBUG]")
+	return sb.String()
 }
 
 func TestRunBenchmarkWithExecutor_Success(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -75,7 +109,7 @@ func TestRunBenchmarkWithExecutor_Success(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json"})
 
 	// Restore stdout and capture output
 	w.Close()
@@ -97,6 +131,7 @@ func TestRunBenchmarkWithExecutor_Success(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_TableOutput(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -115,7 +150,7 @@ func TestRunBenchmarkWithExecutor_TableOutput(t *testing.T) {
 		Warmup:     1,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "table", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "table"})
 
 	// Restore stdout and capture output
 	w.Close()
@@ -135,6 +170,7 @@ func TestRunBenchmarkWithExecutor_TableOutput(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_MultipleRuns(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -153,7 +189,7 @@ func TestRunBenchmarkWithExecutor_MultipleRuns(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 3, 2)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 3, Parallel: 2, Output: "json"})
 
 	// Restore stdout and capture output
 	w.Close()
@@ -167,6 +203,7 @@ func TestRunBenchmarkWithExecutor_MultipleRuns(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_ExecutionError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -185,7 +222,7 @@ func TestRunBenchmarkWithExecutor_ExecutionError(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json"})
 
 	if err == nil {
 		t.Error("Expected error, got success")
@@ -196,6 +233,7 @@ func TestRunBenchmarkWithExecutor_ExecutionError(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_ParallelExecutionError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -214,7 +252,7 @@ func TestRunBenchmarkWithExecutor_ParallelExecutionError(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 3, 2)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 3, Parallel: 2, Output: "json"})
 
 	if err == nil {
 		t.Error("Expected error, got success")
@@ -225,6 +263,7 @@ func TestRunBenchmarkWithExecutor_ParallelExecutionError(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_InvalidOutputFormat(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -238,7 +277,7 @@ func TestRunBenchmarkWithExecutor_InvalidOutputFormat(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "xml", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "xml"})
 
 	if err == nil {
 		t.Error("Expected error for invalid output format")
@@ -249,6 +288,7 @@ func TestRunBenchmarkWithExecutor_InvalidOutputFormat(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_InvalidBenchmarkSpec(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -262,7 +302,7 @@ func TestRunBenchmarkWithExecutor_InvalidBenchmarkSpec(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json"})
 
 	if err == nil {
 		t.Error("Expected error for invalid spec")
@@ -273,6 +313,7 @@ func TestRunBenchmarkWithExecutor_InvalidBenchmarkSpec(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_ParseError(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -292,7 +333,7 @@ func TestRunBenchmarkWithExecutor_ParseError(t *testing.T) {
 		Warmup:     2,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json"})
 
 	if err == nil {
 		t.Error("Expected parse error")
@@ -303,6 +344,7 @@ func TestRunBenchmarkWithExecutor_ParseError(t *testing.T) {
 }
 
 func TestRunBenchmarkWithExecutor_WithTrackingOptions(t *testing.T) {
+	g := &globalOptions{}
 	// Redirect stderr to suppress log output
 	oldStderr := os.Stderr
 	defer func() { os.Stderr = oldStderr }()
@@ -335,7 +377,7 @@ func TestRunBenchmarkWithExecutor_WithTrackingOptions(t *testing.T) {
 		TrackDB:    true,
 	}
 
-	err := runBenchmarkWithExecutor(mock, "test-org", spec, "json", 1, 1)
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json"})
 
 	// Restore stdout
 	w.Close()
@@ -347,3 +389,181 @@ func TestRunBenchmarkWithExecutor_WithTrackingOptions(t *testing.T) {
 		t.Fatalf("Expected success, got error: %v", err)
 	}
 }
+
+func TestRunBenchmarkWithExecutor_CompileErrorMappedToUserCode(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	mock := &mockExecutor{
+		runFunc: func(apexCode string, org string) (string, error) {
+			// Report an error on the measured copy of the second user line
+			lines := strings.Split(apexCode, "\n")
+			lineNum, column := 0, 0
+			for i, line := range lines {
+				if idx := strings.Index(line, "Integer y = x +;"); idx != -1 {
+					lineNum, column = i+1, idx+15
+				}
+			}
+			return "", &executor.CompileError{Problem: "Unexpected token ';'", Line: lineNum, Column: column}
+		},
+	}
+	spec := types.CodeSpec{
+		Name:       "Broken",
+		UserCode:   "Integer x = 1;\nInteger y = x +;",
+		Iterations: 10,
+		Warmup:     1,
+	}
+
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json"})
+	if err == nil {
+		t.Fatal("Expected compile error")
+	}
+
+	msg := err.Error()
+	if !strings.Contains(msg, "code line 2, column 15") {
+		t.Errorf("Expected error to point at user code line 2, got: %s", msg)
+	}
+	if !strings.Contains(msg, "    Integer y = x +;\n                  ^") {
+		t.Errorf("Expected caret under offending column, got: %s", msg)
+	}
+}
+
+func TestRunBenchmarkWithExecutor_CaptureDebug(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	mock := &mockExecutor{
+		runFunc: func(apexCode string, org string) (string, error) {
+			return "13:45:23.100 (100)|USER_DEBUG|[3]|DEBUG|hello from user code\n" + mockSuccessfulBenchResultFromCode(apexCode), nil
+		},
+	}
+	spec := types.CodeSpec{
+		Name:       "Debugging",
+		UserCode:   "System.debug('hello from user code');",
+		Iterations: 10,
+		Warmup:     1,
+	}
+
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, CaptureDebug: true, Output: "json"})
+
+	w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"debugOutput"`) || !strings.Contains(buf.String(), "hello from user code") {
+		t.Errorf("Expected captured debug output in JSON, got: %s", buf.String())
+	}
+}
+
+func TestRunBenchmarkWithExecutor_InvalidAggregate(t *testing.T) {
+	g := &globalOptions{}
+	executed := false
+	mock := &mockExecutor{
+		runFunc: func(apexCode string, org string) (string, error) {
+			executed = true
+			return mockSuccessfulBenchResultFromCode(apexCode), nil
+		},
+	}
+	spec := types.CodeSpec{Name: "Test", UserCode: "Integer a = 1;", Iterations: 10}
+
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Aggregate: "mode", Output: "json"})
+	if err == nil || !strings.Contains(err.Error(), "unknown aggregation strategy") {
+		t.Errorf("Expected aggregation strategy error, got: %v", err)
+	}
+	if executed {
+		t.Error("Expected validation before execution")
+	}
+}
+
+func TestRunBenchmarkWithExecutor_APIVersion(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	mock := &mockExecutor{}
+	spec := types.CodeSpec{Name: "Versioned", UserCode: "Integer a = 1;", Iterations: 10}
+	err := g.runBenchmarkWithExecutor(context.Background(), mock, "test-org", spec, types.BenchmarkConfig{Runs: 2, Parallel: 1, Output: "json", APIVersion: "58.0"})
+
+	w.Close()
+	os.Stdout = oldStdout
+	buf.ReadFrom(r)
+
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if mock.lastRequest.APIVersion != "58.0" {
+		t.Errorf("Expected API version 58.0 in the request, got %q", mock.lastRequest.APIVersion)
+	}
+	if !strings.Contains(buf.String(), `"apiVersion": "58.0"`) {
+		t.Errorf("Expected apiVersion in JSON output, got: %s", buf.String())
+	}
+}
+
+func TestRunBenchmarkWithExecutor_InvalidAPIVersion(t *testing.T) {
+	g := &globalOptions{}
+	spec := types.CodeSpec{Name: "Versioned", UserCode: "Integer a = 1;", Iterations: 10}
+	err := g.runBenchmarkWithExecutor(context.Background(), &mockExecutor{}, "test-org", spec, types.BenchmarkConfig{Runs: 1, Parallel: 1, Output: "json", APIVersion: "v58"})
+	if err == nil || !strings.Contains(err.Error(), "invalid API version") {
+		t.Errorf("Expected invalid API version error, got: %v", err)
+	}
+}
+
+// interruptedExecutor finishes one run of every ExecuteParallel, then
+// cancels the context as Ctrl+C would
+type interruptedExecutor struct {
+	mockExecutor
+	cancel context.CancelFunc
+}
+
+func (e *interruptedExecutor) ExecuteParallel(ctx context.Context, req executor.ExecRequest, runs int, maxConcurrent int) ([]executor.ExecResult, error) {
+	e.cancel()
+	runErrs := &executor.RunErrors{Succeeded: []executor.ExecResult{{Logs: mockSuccessfulBenchResultFromCode(req.Code)}}}
+	for i := 2; i <= runs; i++ {
+		runErrs.Failed = append(runErrs.Failed, i)
+		runErrs.Errs = append(runErrs.Errs, ctx.Err())
+	}
+	return nil, runErrs
+}
+
+func TestRunBenchmarkWithExecutor_Interrupted(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := t.TempDir() + "/result.json"
+	spec := types.CodeSpec{Name: "TestBench", UserCode: "String s = 'test';", Iterations: 10}
+
+	err := g.runBenchmarkWithExecutor(ctx, &interruptedExecutor{cancel: cancel}, "test-org", spec, types.BenchmarkConfig{Runs: 4, Parallel: 2, Outputs: []string{"json:" + out}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected interruption error, got %v", err)
+	}
+
+	data, readErr := os.ReadFile(out)
+	if readErr != nil {
+		t.Fatalf("Expected the partial result to be written: %v", readErr)
+	}
+	if !strings.Contains(string(data), `"partial": true`) || !strings.Contains(string(data), `"runs": 1`) {
+		t.Errorf("Expected a partial result of 1 run, got: %s", data)
+	}
+}
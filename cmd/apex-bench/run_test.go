@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -11,6 +14,10 @@ import (
 
 func TestRunCommand_Flags(t *testing.T) {
 	// Test that all flags are registered
+	runCmd, _, err := NewRootCmd().Find([]string{"run"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	flags := runCmd.Flags()
 
 	if flags.Lookup("code") == nil {
@@ -28,29 +35,67 @@ func TestRunCommand_Flags(t *testing.T) {
 	if flags.Lookup("warmup") == nil {
 		t.Error("Expected 'warmup' flag to be registered")
 	}
+	if flags.Lookup("batch-size") == nil {
+		t.Error("Expected 'batch-size' flag to be registered")
+	}
 	if flags.Lookup("runs") == nil {
 		t.Error("Expected 'runs' flag to be registered")
 	}
-	if flags.Lookup("parallel") == nil {
-		t.Error("Expected 'parallel' flag to be registered")
-	}
 	if flags.Lookup("track-heap") == nil {
 		t.Error("Expected 'track-heap' flag to be registered")
 	}
 	if flags.Lookup("track-db") == nil {
 		t.Error("Expected 'track-db' flag to be registered")
 	}
-	if flags.Lookup("org") == nil {
-		t.Error("Expected 'org' flag to be registered")
+	if flags.Lookup("capture-debug") == nil {
+		t.Error("Expected 'capture-debug' flag to be registered")
+	}
+	if flags.Lookup("debug-log-dir") == nil {
+		t.Error("Expected 'debug-log-dir' flag to be registered")
+	}
+	if flags.Lookup("keep-logs") == nil {
+		t.Error("Expected 'keep-logs' flag to be registered")
+	}
+	if flags.Lookup("aggregate") == nil {
+		t.Error("Expected 'aggregate' flag to be registered")
+	}
+	if flags.Lookup("noise-threshold") == nil {
+		t.Error("Expected 'noise-threshold' flag to be registered")
+	}
+	if flags.Lookup("metrics") == nil {
+		t.Error("Expected 'metrics' flag to be registered")
+	}
+	if flags.Lookup("record") == nil {
+		t.Error("Expected 'record' flag to be registered")
+	}
+	if flags.Lookup("replay") == nil {
+		t.Error("Expected 'replay' flag to be registered")
+	}
+	if flags.Lookup("api-version") == nil {
+		t.Error("Expected 'api-version' flag to be registered")
+	}
+	if flags.Lookup("api-floor") == nil {
+		t.Error("Expected 'api-floor' flag to be registered")
 	}
-	if flags.Lookup("output") == nil {
-		t.Error("Expected 'output' flag to be registered")
+	if flags.Lookup("backend") == nil {
+		t.Error("Expected 'backend' flag to be registered")
+	}
+	if flags.Lookup("out") == nil {
+		t.Error("Expected 'out' flag to be registered")
+	}
+
+	// Shared flags are inherited from the root command
+	inherited := runCmd.InheritedFlags()
+	for _, name := range []string{"org", "output", "parallel", "timeout", "verbose", "quiet"} {
+		if inherited.Lookup(name) == nil {
+			t.Errorf("Expected inherited '%s' flag", name)
+		}
 	}
 }
 
 func TestRunCommand_DefaultValues(t *testing.T) {
 	// Test default flag values
-	flags := runCmd.Flags()
+	flags := NewRunCmd(&globalOptions{}).Flags()
 
 	iterVal, _ := flags.GetInt("iterations")
 	if iterVal != 100 {
@@ -67,24 +112,24 @@ func TestRunCommand_DefaultValues(t *testing.T) {
 		t.Errorf("Expected default runs 1, got %d", runsVal)
 	}
 
-	parallelVal, _ := flags.GetInt("parallel")
-	if parallelVal != 1 {
-		t.Errorf("Expected default parallel 1, got %d", parallelVal)
+	rootCmd := NewRootCmd()
+	if def := rootCmd.PersistentFlags().Lookup("parallel").DefValue; def != "1" {
+		t.Errorf("Expected default parallel 1, got %s", def)
 	}
 
-	outputVal, _ := flags.GetString("output")
-	if outputVal != "json" {
-		t.Errorf("Expected default output 'json', got %s", outputVal)
+	// --output has no default of its own, so each command picks its format
+	if def := rootCmd.PersistentFlags().Lookup("output").DefValue; def != "[]" {
+		t.Errorf("Expected no default output flag value, got %s", def)
+	}
+	if runDefaultOutput != "json" {
+		t.Errorf("Expected default output json, got %s", runDefaultOutput)
 	}
 }
 
 func TestRunBenchmark_NoCodeOrFile(t *testing.T) {
-	// Reset flags
-	runCode = ""
-	runFile = ""
-
-	cmd := &cobra.Command{}
-	err := runBenchmark(cmd, []string{})
+	g := &globalOptions{}
+	cmd := NewRunCmd(g)
+	err := cmd.RunE(cmd, []string{})
 
 	if err == nil {
 		t.Error("Expected error when no code or file provided")
@@ -96,11 +141,10 @@ func TestRunBenchmark_NoCodeOrFile(t *testing.T) {
 }
 
 func TestRunBenchmark_BothCodeAndFile(t *testing.T) {
-	runCode = "String s = 'test';"
-	runFile = "test.apex"
-
-	cmd := &cobra.Command{}
-	err := runBenchmark(cmd, []string{})
+	g := &globalOptions{}
+	cmd := NewRunCmd(g)
+	setFlags(t, cmd, "code", "String s = 'test';", "file", "test.apex")
+	err := cmd.RunE(cmd, []string{})
 
 	if err == nil {
 		t.Error("Expected error when both code and file provided")
@@ -112,9 +156,10 @@ func TestRunBenchmark_BothCodeAndFile(t *testing.T) {
 }
 
 func TestRunCommand_Integration(t *testing.T) {
+	g := &globalOptions{}
 	// Test the cobra command setup
 	rootCmd := &cobra.Command{Use: "test"}
-	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(NewRunCmd(g))
 
 	// Test help
 	var buf bytes.Buffer
@@ -163,3 +208,141 @@ func TestRunCommand_FileNotFoundScenario(t *testing.T) {
 		t.Error("Expected error when reading non-existent file")
 	}
 }
+
+func TestReadCode(t *testing.T) {
+	g := &globalOptions{}
+	file := filepath.Join(t.TempDir(), "code.apex")
+	if err := os.WriteFile(file, []byte("String s = 'from file';"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	piped := "String s = 'piped';\n"
+
+	tests := []struct {
+		code, file string
+		want       string
+		wantErr    string
+	}{
+		{code: "String s = 'inline';", want: "String s = 'inline';"},
+		{file: file, want: "String s = 'from file';"},
+		{code: "-", want: piped},
+		{file: "-", want: piped},
+		{file: "/nonexistent/file.apex", wantErr: "failed to read file"},
+	}
+	for _, tt := range tests {
+		got, err := g.readCode(tt.code, tt.file, 0, strings.NewReader(piped))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readCode(%q, %q) error = %v, want %q", tt.code, tt.file, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("readCode(%q, %q) = %q, %v, want %q", tt.code, tt.file, got, err, tt.want)
+		}
+	}
+
+	if _, err := g.readCode("-", "", 0, strings.NewReader("  \n")); err == nil || !strings.Contains(err.Error(), "no code on stdin") {
+		t.Errorf("Expected an error for empty stdin, got %v", err)
+	}
+}
+
+// setFlags sets the flags of cmd from name, value pairs
+func setFlags(t *testing.T, cmd *cobra.Command, pairs ...string) {
+	t.Helper()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := cmd.Flags().Set(pairs[i], pairs[i+1]); err != nil {
+			t.Fatalf("--%s %s: %v", pairs[i], pairs[i+1], err)
+		}
+	}
+}
+
+func TestNewRunCmd_Instances(t *testing.T) {
+	g := &globalOptions{}
+	first, second := NewRunCmd(g), NewRunCmd(g)
+	setFlags(t, first, "code", "Integer a = 1;", "iterations", "5")
+	if code, _ := second.Flags().GetString("code"); code != "" {
+		t.Errorf("Expected a second instance without --code, got %q", code)
+	}
+	if iterations, _ := second.Flags().GetInt("iterations"); iterations != 100 {
+		t.Errorf("Expected a second instance with default iterations, got %d", iterations)
+	}
+}
+
+func TestNewRootCmd_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	errs := make(chan error, 4)
+	for i := range 4 {
+		go func() {
+			root := NewRootCmd()
+			root.SetErr(io.Discard)
+			root.SetArgs([]string{"run", "--code", "Integer a = 1;", "--backend", "mock", "--iterations", "5", "--warmup", "1",
+				"--name", fmt.Sprintf("Bench%d", i), "--output", "json:" + filepath.Join(dir, fmt.Sprintf("%d.json", i))})
+			errs <- root.Execute()
+		}()
+	}
+	for range 4 {
+		if err := <-errs; err != nil {
+			t.Errorf("Execute() error = %v", err)
+		}
+	}
+	for i := range 4 {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.json", i)))
+		if err != nil || !strings.Contains(string(data), fmt.Sprintf(`"Bench%d"`, i)) {
+			t.Errorf("Expected the results of Bench%d, got %s (%v)", i, data, err)
+		}
+	}
+}
+
+func TestRun_NameFromFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "list_sort.apex")
+	if err := os.WriteFile(file, []byte("Integer a = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--file", file}, `"name": "list_sort"`},
+		{[]string{"--file", file, "--name", "Sorting"}, `"name": "Sorting"`},
+		{[]string{"--code", "Integer a = 1;"}, `"name": "Benchmark"`},
+	}
+	for i, tt := range tests {
+		out := filepath.Join(dir, fmt.Sprintf("%d.json", i))
+		root := NewRootCmd()
+		root.SetErr(io.Discard)
+		root.SetArgs(append([]string{"run"}, append(tt.args, "--backend", "mock", "--iterations", "5", "--warmup", "1", "--out", out)...))
+		if err := root.Execute(); err != nil {
+			t.Fatalf("Execute(%v) error = %v", tt.args, err)
+		}
+		if data, _ := os.ReadFile(out); !strings.Contains(string(data), tt.want) {
+			t.Errorf("Expected %s for %v, got %s", tt.want, tt.args, data)
+		}
+	}
+}
+
+// The help names the default itself, so pflag must not add "(default ...)"
+func TestRun_NameFlagHelp(t *testing.T) {
+	for _, name := range []string{"run", "watch", "scale"} {
+		cmd, _, err := NewRootCmd().Find([]string{name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		flag := cmd.Flags().Lookup("name")
+		if flag == nil || flag.DefValue != "" {
+			t.Fatalf("Expected an empty --name default for %s, got %+v", name, flag)
+		}
+		if usage := cmd.Flags().FlagUsages(); strings.Contains(usage, `(default "Benchmark")`) {
+			t.Errorf("Expected no flag default in the %s help, got:\n%s", name, usage)
+		}
+	}
+}
+
+func TestFileBenchName(t *testing.T) {
+	if got := fileBenchName(filepath.Join("bench", "map.get.apex"), 0); got != "map.get" {
+		t.Errorf("fileBenchName() = %q, want map.get", got)
+	}
+	if got := fileBenchName("docs/perf.md", 3); got != "perf#3" {
+		t.Errorf("fileBenchName() = %q, want perf#3", got)
+	}
+}
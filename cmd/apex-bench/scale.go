@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// scaleOptions are the flags of a scale command
+type scaleOptions struct {
+	global     *globalOptions
+	code       string
+	file       string
+	name       string
+	rows       []int
+	object     string
+	field      string
+	seedFile   string
+	iterations int
+	warmup     int
+	batchSize  int
+	runs       int
+	trackDB    bool
+	aggregate  string
+	noise      float64
+	out        string
+	apiVersion string
+	backend    string
+}
+
+// maxSeedRows is the DML row limit of a transaction, which bounds how many
+// records --object can seed
+const maxSeedRows = 10000
+
+// newScaleCmd creates a scale command with g as its global options
+func newScaleCmd(g *globalOptions) *cobra.Command {
+	o := &scaleOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "scale",
+		Short: "Measure how a SOQL benchmark scales with the number of records",
+		Long: `Seed N records for every N in --rows, benchmark the code at each scale
+and report time against row count, answering "does this scale?".
+
+Records are seeded with --object, which inserts N records of that sObject
+with --field set to "apex-bench <n>", or with --seed-file, Apex code that
+seeds rowCount records itself. Seeded records are rolled back after every
+run, so nothing is left behind in the org.`,
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.code, "code", "", "Inline Apex code to benchmark (- reads it from stdin)")
+	cmd.Flags().StringVar(&o.file, "file", "", "Path to Apex code file (- reads stdin)")
+	cmd.Flags().StringVar(&o.name, "name", "", "Benchmark name (default: the --file name without its extension, or "+defaultBenchName+")")
+	cmd.Flags().IntSliceVar(&o.rows, "rows", []int{10, 100, 1000}, "Record counts to seed and benchmark at")
+	cmd.Flags().StringVar(&o.object, "object", "", "sObject to seed records of, e.g. Account")
+	cmd.Flags().StringVar(&o.field, "field", "Name", "Field set on seeded records; use a required field such as LastName for Contact")
+	cmd.Flags().StringVar(&o.seedFile, "seed-file", "", "Apex code that seeds rowCount records, instead of --object")
+	cmd.Flags().IntVar(&o.iterations, "iterations", 100, "Number of measurement iterations")
+	cmd.Flags().IntVar(&o.warmup, "warmup", 10, "Number of warmup iterations")
+	cmd.Flags().IntVar(&o.batchSize, "batch-size", 0, "Iterations timed together per sample (0 starts at 1 and doubles while batches read 0 ms)")
+	cmd.Flags().IntVar(&o.runs, "runs", 1, "Number of complete runs for aggregation at each scale")
+	cmd.Flags().BoolVar(&o.trackDB, "track-db", false, "Enable DML/SOQL tracking")
+	cmd.Flags().StringVar(&o.aggregate, "aggregate", "mean", "How runs are combined: mean, median, min, trimmed-mean")
+	cmd.Flags().Float64Var(&o.noise, "noise-threshold", 20, "Flag results whose run-to-run CPU variation exceeds this percentage")
+	cmd.Flags().StringVar(&o.out, "out", "", "Write results to this file instead of stdout")
+	cmd.Flags().StringVar(&o.apiVersion, "api-version", "", "Salesforce API version to execute with, e.g. 62.0 (default: org default)")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+
+	cmd.MarkFlagsMutuallyExclusive("code", "file")
+	cmd.MarkFlagsOneRequired("code", "file")
+	cmd.MarkFlagsMutuallyExclusive("object", "seed-file")
+	cmd.MarkFlagsOneRequired("object", "seed-file")
+	return cmd
+}
+
+func (o *scaleOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	userCode, err := g.readCode(o.code, o.file, 0, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	seed := ""
+	if o.seedFile != "" {
+		content, err := os.ReadFile(o.seedFile)
+		if err != nil {
+			return fmt.Errorf("failed to read seed file %s: %w", o.seedFile, err)
+		}
+		seed = string(content)
+	}
+
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+	if err != nil {
+		return err
+	}
+
+	spec := types.CodeSpec{
+		Name:       benchName(o.name, o.file, 0),
+		UserCode:   strings.TrimSpace(userCode),
+		Iterations: o.iterations,
+		Warmup:     o.warmup,
+		BatchSize:  o.batchSize,
+		TrackDB:    o.trackDB,
+		Namespace:  g.namespace,
+		Vars:       g.benchVars(nil),
+	}
+	config := types.BenchmarkConfig{
+		Runs:           o.runs,
+		Parallel:       g.parallel,
+		Timeout:        g.timeout,
+		Delay:          g.delay,
+		Jitter:         g.jitter,
+		Aggregate:      o.aggregate,
+		NoiseThreshold: o.noise,
+		APIVersion:     o.apiVersion,
+		Outputs:        g.outputs,
+		Output:         compareDefaultOutput,
+		Out:            o.out,
+	}
+	sweep := rowSweep{Rows: o.rows, Object: o.object, Field: o.field, Seed: seed}
+	return g.scaleBenchmarkWithExecutor(commandContext(cmd), exec, org, spec, sweep, config)
+}
+
+// rowSweep describes the record counts of a scale run and how the records
+// are seeded
+type rowSweep struct {
+	Rows   []int
+	Object string // sObject seeded with generated records
+	Field  string // Field set on generated records
+	Seed   string // Apex seeding rowCount records; replaces Object
+}
+
+// specs returns one benchmark of spec per row count, in ascending order of
+// the returned rows, with the records seeded in setup and rolled back after
+// measuring
+func (s rowSweep) specs(spec types.CodeSpec) ([]types.CodeSpec, []int, error) {
+	if s.Seed == "" && !apexIdentifier.MatchString(s.Object) {
+		return nil, nil, fmt.Errorf("invalid --object %q", s.Object)
+	}
+	if s.Seed == "" && !apexIdentifier.MatchString(s.Field) {
+		return nil, nil, fmt.Errorf("invalid --field %q", s.Field)
+	}
+	rows := append([]int(nil), s.Rows...)
+	sort.Ints(rows)
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("--rows must list at least one record count")
+	}
+
+	specs := make([]types.CodeSpec, 0, len(rows))
+	for i, n := range rows {
+		switch {
+		case n < 1:
+			return nil, nil, fmt.Errorf("--rows must be positive, got %d", n)
+		case i > 0 && n == rows[i-1]:
+			return nil, nil, fmt.Errorf("--rows lists %d twice", n)
+		case s.Seed == "" && n > maxSeedRows:
+			return nil, nil, fmt.Errorf("--object can seed at most %d records per transaction, got %d", maxSeedRows, n)
+		}
+
+		scaled := spec
+		scaled.Name = fmt.Sprintf("%s (%d rows)", spec.Name, n)
+		scaled.Setup = fmt.Sprintf("Integer rowCount = %d;\n%s", n, s.seedCode())
+		scaled.Rollback = true
+		specs = append(specs, scaled)
+	}
+	return specs, rows, nil
+}
+
+// apexIdentifier matches sObject and field API names
+var apexIdentifier = regexp.MustCompile(`^[A-Za-z]\w*$`)
+
+// seedCode returns the Apex that inserts rowCount records
+func (s rowSweep) seedCode() string {
+	if s.Seed != "" {
+		return strings.TrimSpace(s.Seed)
+	}
+	return fmt.Sprintf(`List<SObject> seedRecords = new List<SObject>();
+for (Integer seedIndex = 0; seedIndex < rowCount; seedIndex++) {
+    SObject seedRecord = Schema.getGlobalDescribe().get('%s').newSObject();
+    seedRecord.put('%s', 'apex-bench ' + seedIndex);
+    seedRecords.add(seedRecord);
+}
+insert seedRecords;`, s.Object, s.Field)
+}
+
+// scaleBenchmarkWithExecutor is the testable core logic. Every row count is
+// benchmarked even if a smaller one fails, since hitting a limit at scale is
+// itself a finding.
+func (g *globalOptions) scaleBenchmarkWithExecutor(ctx context.Context, exec executor.Executor, org string, spec types.CodeSpec, sweep rowSweep, config types.BenchmarkConfig) error {
+	if _, err := stats.ParseStrategy(config.Aggregate); err != nil {
+		return err
+	}
+	targets, err := parseOutputTargets(config)
+	if err != nil {
+		return err
+	}
+	if err := orchestrator.ValidateAPIVersion(config.APIVersion); err != nil {
+		return err
+	}
+	specs, rows, err := sweep.specs(spec)
+	if err != nil {
+		return err
+	}
+
+	config.KeepGoing = true
+	results, runErr := g.newRunner(exec, org, config).Compare(ctx, specs)
+	if len(results) == 0 {
+		return runErr
+	}
+	// Results are in the order of specs
+	for i := range results {
+		results[i].Rows = rows[i]
+	}
+
+	g.progressf("\n")
+	err = g.writeReports(targets, func(format string, w io.Writer) error {
+		if format == "table" {
+			return reporter.PrintScaling(results, w)
+		}
+		return reporter.PrintJSON(results, w)
+	})
+	if err != nil {
+		return err
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scales failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestRowSweep_Specs(t *testing.T) {
+	spec := types.CodeSpec{Name: "Query", UserCode: "List<Account> a = [SELECT Id FROM Account];", Iterations: 10}
+	sweep := rowSweep{Rows: []int{1000, 10, 100}, Object: "Account", Field: "Name"}
+
+	specs, rows, err := sweep.specs(spec)
+	if err != nil {
+		t.Fatalf("specs() error = %v", err)
+	}
+	if !reflect.DeepEqual(rows, []int{10, 100, 1000}) {
+		t.Errorf("Expected ascending rows, got %v", rows)
+	}
+	if specs[0].Name != "Query (10 rows)" || !specs[0].Rollback {
+		t.Errorf("Unexpected spec: %+v", specs[0])
+	}
+	if !strings.HasPrefix(specs[2].Setup, "Integer rowCount = 1000;") || !strings.Contains(specs[2].Setup, "get('Account').newSObject()") {
+		t.Errorf("Expected setup to seed Account records, got %s", specs[2].Setup)
+	}
+
+	custom := rowSweep{Rows: []int{20000}, Seed: "insert new List<Contact>();"}
+	if specs, _, err := custom.specs(spec); err != nil || !strings.HasSuffix(specs[0].Setup, "insert new List<Contact>();") {
+		t.Errorf("Expected custom seed code, got %v, %v", specs, err)
+	}
+}
+
+func TestRowSweep_SpecsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		sweep rowSweep
+		want  string
+	}{
+		{"no rows", rowSweep{Object: "Account", Field: "Name"}, "at least one"},
+		{"zero", rowSweep{Rows: []int{0, 10}, Object: "Account", Field: "Name"}, "must be positive"},
+		{"duplicate", rowSweep{Rows: []int{10, 10}, Object: "Account", Field: "Name"}, "lists 10 twice"},
+		{"too many", rowSweep{Rows: []int{20000}, Object: "Account", Field: "Name"}, "at most 10000"},
+		{"object", rowSweep{Rows: []int{10}, Object: "Account'); delete", Field: "Name"}, "invalid --object"},
+		{"field", rowSweep{Rows: []int{10}, Object: "Account", Field: ""}, "invalid --field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.sweep.specs(types.CodeSpec{Name: "Q", UserCode: "x", Iterations: 1})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("specs() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleBenchmarkWithExecutor_SimulatedBackend(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	out := filepath.Join(t.TempDir(), "scale.json")
+	spec := types.CodeSpec{Name: "Query", UserCode: "List<Account> a = [SELECT Id FROM Account];", Iterations: 10}
+	sweep := rowSweep{Rows: []int{100, 10}, Object: "Account", Field: "Name"}
+	config := types.BenchmarkConfig{Runs: 1, Parallel: 1, Aggregate: "median", Outputs: []string{"json:" + out}}
+
+	if err := g.scaleBenchmarkWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", spec, sweep, config); err != nil {
+		t.Fatalf("scaleBenchmarkWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(data)
+	if !strings.Contains(output, "\"rows\": 10\n") || !strings.Contains(output, `"name": "Query (100 rows)"`) {
+		t.Errorf("Expected a result per row count, got: %s", output)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/spf13/cobra"
+)
+
+// scheduleOptions are the flags of a schedule command
+type scheduleOptions struct {
+	global  *globalOptions
+	every   time.Duration
+	history string
+	count   int
+	backend string
+}
+
+// newScheduleCmd creates a schedule command with g as its global options
+func newScheduleCmd(g *globalOptions) *cobra.Command {
+	o := &scheduleOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "schedule <suite-file>",
+		Short: "Run a suite on an interval, appending results to a history file",
+		Long: `Run the benchmarks of a suite file every --every, appending each
+session's results to the --history file, for a continuous performance feed
+from a staging org. Press Ctrl+C to stop.
+
+The suite runs with keepGoing, so one failing benchmark is recorded in the
+history instead of ending the session, and a failed session is reported
+without stopping the schedule. Interval starts are spaced --every apart; a
+session running longer than the interval is followed by the next at once.
+
+The history file holds one JSON object per session:
+{"time": ..., "org": ..., "results": [...]}.`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.run,
+	}
+
+	cmd.Flags().DurationVar(&o.every, "every", 0, "Interval between the starts of suite sessions, e.g. 1h")
+	cmd.Flags().StringVar(&o.history, "history", "", "JSON Lines file each session's results are appended to")
+	cmd.Flags().IntVar(&o.count, "count", 0, "Stop after this many sessions (0 runs until interrupted)")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+
+	cmd.MarkFlagRequired("every")
+	cmd.MarkFlagRequired("history")
+	return cmd
+}
+
+func (o *scheduleOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	if o.every <= 0 {
+		return fmt.Errorf("--every must be positive, got %s", o.every)
+	}
+	if o.count < 0 {
+		return fmt.Errorf("--count cannot be negative, got %d", o.count)
+	}
+	config, err := loadSuite(args[0])
+	if err != nil {
+		return err
+	}
+	g.applySuiteOverrides(cmd.Flags(), &config)
+	config.History = o.history
+	config.KeepGoing = true
+
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: config.Org})
+	if err != nil {
+		return err
+	}
+	return g.runOnSchedule(commandContext(cmd), o.every, o.count, func(ctx context.Context) error {
+		return g.compareBenchmarksWithExecutor(ctx, exec, org, config)
+	})
+}
+
+// runOnSchedule calls session every interval, starting at once, until ctx
+// is done or count sessions ran when count is positive. Failed sessions are
+// reported and the schedule continues.
+func (g *globalOptions) runOnSchedule(ctx context.Context, every time.Duration, count int, session func(context.Context) error) error {
+	for n := 1; count == 0 || n <= count; n++ {
+		start := time.Now()
+		g.progressf("\n[%s] Session %d\n", start.Format(time.DateTime), n)
+		if err := session(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			g.warnf("session %d failed: %v", n, err)
+		}
+		if n == count {
+			break
+		}
+
+		next := start.Add(every)
+		g.progressf("Next session at %s (Ctrl+C to stop)\n", next.Format(time.DateTime))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+	return nil
+}
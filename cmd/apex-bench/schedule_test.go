@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/history"
+)
+
+func TestRunOnSchedule(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	// Failed sessions do not stop the schedule
+	sessions := 0
+	err := g.runOnSchedule(context.Background(), time.Millisecond, 3, func(ctx context.Context) error {
+		sessions++
+		return errors.New("org unavailable")
+	})
+	if err != nil || sessions != 3 {
+		t.Errorf("Expected 3 sessions without error, got %d, %v", sessions, err)
+	}
+
+	// Interrupting stops it between sessions
+	ctx, cancel := context.WithCancel(context.Background())
+	sessions = 0
+	err = g.runOnSchedule(ctx, time.Hour, 0, func(ctx context.Context) error {
+		sessions++
+		cancel()
+		return nil
+	})
+	if err != nil || sessions != 1 {
+		t.Errorf("Expected to stop after 1 session, got %d, %v", sessions, err)
+	}
+}
+
+func TestSchedule_AppendsHistory(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := writeSuite(t, `benchmarks:
+  - name: A
+    code: "Integer a = 1;"
+iterations: 10
+`)
+	config, err := loadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Parallel = 1
+	config.History = filepath.Join(t.TempDir(), "history.jsonl")
+	config.Outputs = []string{"json:" + filepath.Join(t.TempDir(), "out.json")}
+
+	exec := executor.NewSimulatedExecutor()
+	err = g.runOnSchedule(context.Background(), time.Millisecond, 2, func(ctx context.Context) error {
+		return g.compareBenchmarksWithExecutor(ctx, exec, "staging", config)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := history.Load(config.History)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(entries))
+	}
+	if entries[0].Org != "staging" || len(entries[0].Results) != 1 || entries[0].Results[0].Name != "A" {
+		t.Errorf("Unexpected history entry: %+v", entries[0])
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/spf13/cobra"
+)
+
+// newSchemaCmd creates a schema command
+func newSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema [" + strings.Join(reporter.SchemaNames(), "|") + "]",
+		Short: "Print the JSON Schema of the JSON output",
+		Long: `Print the JSON Schema of the JSON output, so downstream consumers can
+validate results. run writes one aggregated-result, compare an array of them;
+each aggregated result lists its runs as result objects under "raw".
+Defaults to aggregated-result.`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: reporter.SchemaNames(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := "aggregated-result"
+			if len(args) == 1 {
+				name = args[0]
+			}
+			return reporter.PrintSchema(name, cmd.OutOrStdout())
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// serveOptions are the flags of a serve command
+type serveOptions struct {
+	global  *globalOptions
+	addr    string
+	history string
+	backend string
+}
+
+// maxRequestSize bounds a submitted benchmark spec
+const maxRequestSize = 1 << 20
+
+// newServeCmd creates a serve command with g as its global options
+func newServeCmd(g *globalOptions) *cobra.Command {
+	o := &serveOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an HTTP API for submitting benchmarks",
+		Long: `Serve a small HTTP API so dashboards and chatops bots can run benchmarks
+remotely against the org:
+
+  POST /benchmarks     submit a suite (YAML or JSON, as in suite files);
+                       answers 202 with the job and its Location
+  GET  /results/{id}   the job's status (running, done or failed), error
+                       and results
+
+Benchmarks must give inline code; file, org and settings writing files
+are not accepted over HTTP. Submitted benchmarks share the process's
+execution queue (--max-executions, --org-limit, priority) and, with
+--history, every finished job is appended to the history file.
+
+The API has no authentication: keep the default localhost address or put
+it behind a proxy that adds some. Press Ctrl+C to stop; running jobs are
+cancelled.`,
+		Args: cobra.NoArgs,
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.addr, "addr", "localhost:8080", "Address to listen on")
+	cmd.Flags().StringVar(&o.history, "history", "", "JSON Lines file the results of every job are appended to")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+	return cmd
+}
+
+func (o *serveOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	flags := cmd.Flags()
+	server := newBenchmarkServer(ctx, g, exec, org, o.history, func(config *types.BenchmarkConfig) {
+		g.applySuiteOverrides(flags, config)
+	})
+	httpServer := &http.Server{Addr: o.addr, Handler: server.handler()}
+
+	errs := make(chan error, 1)
+	go func() { errs <- httpServer.ListenAndServe() }()
+	g.progressf("Serving benchmarks on http://%s (Ctrl+C to stop)...\n", o.addr)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+	server.wait()
+	return nil
+}
+
+// benchmarkServer runs submitted suites in the background and keeps their
+// outcome in memory
+type benchmarkServer struct {
+	ctx       context.Context // Cancels running jobs
+	global    *globalOptions
+	exec      executor.Executor
+	org       string
+	history   string                       // File finished jobs are appended to; empty skips
+	overrides func(*types.BenchmarkConfig) // Server-wide settings applied to each suite; may be nil
+
+	mu      sync.Mutex
+	jobs    map[string]*benchmarkJob
+	running sync.WaitGroup
+}
+
+// benchmarkJob is a submitted suite, as reported by GET /results/{id}
+type benchmarkJob struct {
+	ID        string                   `json:"id"`
+	Status    string                   `json:"status"` // running, done or failed
+	Error     string                   `json:"error,omitempty"`
+	Submitted time.Time                `json:"submitted"`
+	Finished  *time.Time               `json:"finished,omitempty"`
+	Results   []types.AggregatedResult `json:"results,omitempty"`
+}
+
+// Job statuses
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// newBenchmarkServer creates a server running jobs against org with exec
+// until ctx is done, logging as g does
+func newBenchmarkServer(ctx context.Context, g *globalOptions, exec executor.Executor, org string, history string, overrides func(*types.BenchmarkConfig)) *benchmarkServer {
+	return &benchmarkServer{
+		ctx:       ctx,
+		global:    g,
+		exec:      exec,
+		org:       org,
+		history:   history,
+		overrides: overrides,
+		jobs:      make(map[string]*benchmarkJob),
+	}
+}
+
+// handler routes the API
+func (s *benchmarkServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /benchmarks", s.submit)
+	mux.HandleFunc("GET /results/{id}", s.result)
+	return mux
+}
+
+// submit starts a job for the suite in the request body
+func (s *benchmarkServer) submit(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("failed to read request: %w", err))
+		return
+	}
+	config, err := parseSuite(data, "request")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.global.checkRemoteSuite(config); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if s.overrides != nil {
+		s.overrides(&config)
+	}
+	config.Org = s.org
+	config.History = s.history
+	config.Outputs, config.Out = nil, ""
+
+	id, err := newJobID()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	job := &benchmarkJob{ID: id, Status: jobRunning, Submitted: time.Now().UTC()}
+	s.mu.Lock()
+	s.jobs[id] = job
+	s.mu.Unlock()
+
+	s.global.progressf("Job %s: running %d benchmarks\n", id, len(config.Benchmarks))
+	s.running.Add(1)
+	go s.run(job, config)
+
+	w.Header().Set("Location", "/results/"+id)
+	s.writeJob(w, http.StatusAccepted, job)
+}
+
+// run executes the suite of job and records its outcome
+func (s *benchmarkServer) run(job *benchmarkJob, config types.BenchmarkConfig) {
+	defer s.running.Done()
+
+	c, err := s.global.runComparison(s.ctx, s.exec, s.org, config)
+	if err == nil {
+		err = c.Err(s.ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := time.Now().UTC()
+	job.Finished = &finished
+	job.Results = c.Results
+	job.Status = jobDone
+	if err != nil {
+		job.Status, job.Error = jobFailed, err.Error()
+		fmt.Fprintf(s.global.stderr(), "Job %s failed: %v\n", job.ID, err)
+		return
+	}
+	s.global.progressf("Job %s: done\n", job.ID)
+}
+
+// result reports a job
+func (s *benchmarkServer) result(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no job %q", r.PathValue("id")))
+		return
+	}
+	s.writeJob(w, http.StatusOK, job)
+}
+
+// writeJob writes a snapshot of job
+func (s *benchmarkServer) writeJob(w http.ResponseWriter, status int, job *benchmarkJob) {
+	s.mu.Lock()
+	snapshot := *job
+	s.mu.Unlock()
+	writeJSON(w, status, snapshot)
+}
+
+// wait waits for running jobs to finish
+func (s *benchmarkServer) wait() {
+	s.running.Wait()
+}
+
+// checkRemoteSuite rejects settings that would let a remote client read or
+// write files on the server, read its environment, or pick another org
+func (g *globalOptions) checkRemoteSuite(config types.BenchmarkConfig) error {
+	vars := g.benchVars(config.Vars)
+	for _, spec := range config.Benchmarks {
+		if spec.File != "" {
+			return fmt.Errorf("benchmark %q uses a file; submit its code instead", spec.Name)
+		}
+		for _, name := range generator.VarNames(spec.Code + "\n" + spec.Setup + "\n" + spec.Teardown) {
+			if _, ok := vars[name]; !ok {
+				return fmt.Errorf("benchmark %q uses ${%s}; give it in vars, the server's environment is not read", spec.Name, name)
+			}
+		}
+	}
+	switch {
+	case config.Org != "":
+		return fmt.Errorf("org is set by the server")
+	case config.Out != "" || len(config.Outputs) > 0 || config.History != "" || config.DebugLogDir != "" || config.KeepLogs != "":
+		return fmt.Errorf("out, outputs, history, debugLogDir and keepLogs are not accepted over HTTP")
+	}
+	return nil
+}
+
+// newJobID returns a random job identifier
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeJSONError writes err as a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/history"
+)
+
+func TestBenchmarkServer(t *testing.T) {
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	historyPath := filepath.Join(t.TempDir(), "history.jsonl")
+	server := newBenchmarkServer(context.Background(), &globalOptions{}, executor.NewSimulatedExecutor(), "staging", historyPath, nil)
+	ts := httptest.NewServer(server.handler())
+	defer ts.Close()
+
+	body := `{"benchmarks": [{"name": "A", "code": "Integer a = 1;"}], "iterations": 10, "parallel": 1}`
+	resp, err := http.Post(ts.URL+"/benchmarks", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job benchmarkJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || job.ID == "" || resp.Header.Get("Location") != "/results/"+job.ID {
+		t.Fatalf("Expected an accepted job, got %d %+v", resp.StatusCode, job)
+	}
+
+	server.wait()
+	resp, err = http.Get(ts.URL + "/results/" + job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if job.Status != jobDone || len(job.Results) != 1 || job.Results[0].Name != "A" || job.Finished == nil {
+		t.Errorf("Expected a finished job with results, got %+v", job)
+	}
+
+	entries, err := history.Load(historyPath)
+	if err != nil || len(entries) != 1 || entries[0].Org != "staging" {
+		t.Errorf("Expected the job in the history, got %+v, %v", entries, err)
+	}
+
+	resp, err = http.Get(ts.URL + "/results/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+}
+
+func TestBenchmarkServer_RejectsUnsafeSuites(t *testing.T) {
+	server := newBenchmarkServer(context.Background(), &globalOptions{}, executor.NewSimulatedExecutor(), "", "", nil)
+	ts := httptest.NewServer(server.handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"file", `{"benchmarks": [{"name": "A", "file": "/etc/passwd"}]}`, "uses a file"},
+		{"org", `{"benchmarks": [{"name": "A", "code": "1;"}], "org": "prod"}`, "org is set by the server"},
+		{"output", `{"benchmarks": [{"name": "A", "code": "1;"}], "out": "/tmp/x"}`, "not accepted over HTTP"},
+		{"environment", `{"benchmarks": [{"name": "A", "code": "String s = '${HOME}';"}]}`, "environment is not read"},
+		{"invalid", `{"benchmarks": []}`, "lists no benchmarks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/benchmarks", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body["error"], tt.want) {
+				t.Errorf("Expected 400 mentioning %q, got %d %v", tt.want, resp.StatusCode, body)
+			}
+		})
+	}
+}
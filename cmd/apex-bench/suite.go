@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/config"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// suiteOptions are the flags of a suite command
+type suiteOptions struct {
+	global    *globalOptions
+	tags      []string
+	skipTags  []string
+	filter    string
+	failFast  bool
+	keepGoing bool
+	out       string
+	raw       string
+	noRaw     bool
+	backend   string
+	manifest  string
+	cache     bool
+	cacheAge  time.Duration
+	changed   bool
+	base      string
+}
+
+// newSuiteCmd creates a suite command with g as its global options
+func newSuiteCmd(g *globalOptions) *cobra.Command {
+	o := &suiteOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "suite <file>",
+		Short: "Run the benchmarks listed in a suite file",
+		Long: `Run the benchmarks listed in a suite file (.yaml, .yml or .json) and
+compare them. The file lists benchmarks under "benchmarks" (name, file or
+code, setup, teardown, tags) next to the measurement settings applied to all
+of them; see testdata/configs/example.yaml. Unknown keys and values of the
+wrong type are errors naming their line and column. "extends" names a base
+file whose settings the suite overrides and "include" lists files whose
+benchmarks and settings it adds, by paths relative to the suite.
+
+A directory instead of a file runs every .apex file in it, with default
+settings, as a benchmark named after the file (dir/... includes
+subdirectories); see run for the sidecar files setting their metadata.
+
+Use --tags to run only benchmarks with one of the given tags,
+--skip-tags to leave out benchmarks with any of them and --filter to run
+only benchmarks whose name matches a regular expression.
+
+A summary of the session follows the results on stderr.`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringSliceVar(&o.tags, "tags", nil, "Run only benchmarks with one of these tags, e.g. soql,bulk")
+	cmd.Flags().StringSliceVar(&o.skipTags, "skip-tags", nil, "Skip benchmarks with any of these tags, e.g. slow")
+	cmd.Flags().StringVar(&o.filter, "filter", "", "Run only benchmarks whose name matches this regular expression")
+	cmd.Flags().BoolVar(&o.failFast, "fail-fast", false, "Stop at the first failing benchmark, reporting the results completed so far (default)")
+	cmd.Flags().BoolVar(&o.keepGoing, "keep-going", false, "Run every benchmark even if some fail, reporting each failure in the results")
+	cmd.Flags().StringVar(&o.out, "out", "", "Write results to this file instead of stdout")
+	cmd.Flags().StringVar(&o.raw, "raw", "", "Per-run results in JSON output: full, summary (only their count) or none (default: the file's raw, or full)")
+	cmd.Flags().BoolVar(&o.noRaw, "no-raw", false, "Leave per-run results out of JSON output (same as --raw none)")
+	cmd.Flags().BoolVar(&o.cache, "cache", false, "Serve benchmarks whose script and settings are unchanged from the suite's history instead of running them")
+	cmd.Flags().DurationVar(&o.cacheAge, "cache-max-age", orchestrator.DefaultCacheMaxAge, "Oldest cached result --cache serves, e.g. 24h")
+	cmd.Flags().BoolVar(&o.changed, "changed-only", false, "Run only benchmarks affected by git changes since --base, taking the rest from the suite's history")
+	cmd.Flags().StringVar(&o.base, "base", "HEAD", "Git ref --changed-only detects changes since, e.g. origin/main")
+	cmd.Flags().StringVar(&o.manifest, "manifest", "", "Write a manifest of the session to this file, for reproducing it with rerun")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+
+	cmd.MarkFlagsMutuallyExclusive("fail-fast", "keep-going")
+	cmd.MarkFlagsMutuallyExclusive("raw", "no-raw")
+	return cmd
+}
+
+func (o *suiteOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	config, err := loadSuite(args[0])
+	if err != nil {
+		return err
+	}
+
+	g.applySuiteOverrides(cmd.Flags(), &config)
+	if o.out != "" {
+		config.Out = o.out
+	}
+	if o.keepGoing || o.failFast {
+		config.KeepGoing = o.keepGoing
+	}
+	if o.raw != "" || o.noRaw {
+		config.Raw = rawFlag(o.raw, o.noRaw)
+	}
+	if cmd.Flags().Changed("cache") {
+		config.Cache = o.cache
+	}
+	if cmd.Flags().Changed("cache-max-age") {
+		config.CacheMaxAge = o.cacheAge
+	}
+
+	filter := benchmarkFilter{Tags: o.tags, SkipTags: o.skipTags}
+	if o.filter != "" {
+		if filter.Name, err = regexp.Compile(o.filter); err != nil {
+			return fmt.Errorf("invalid --filter: %w", err)
+		}
+	}
+	config.Benchmarks = filterBenchmarks(config.Benchmarks, filter)
+	if len(config.Benchmarks) == 0 {
+		return fmt.Errorf("no benchmarks in %s match the given filters", args[0])
+	}
+
+	b, err := executor.LookupBackend(o.backend)
+	if err != nil {
+		return err
+	}
+	if o.changed {
+		if err := g.selectChanged(&config, args[0], o.base); err != nil {
+			return err
+		}
+	}
+
+	exec, org, err := g.newExecutor(executorOptions{
+		Backend: o.backend,
+		Org:     config.Org,
+	})
+	if err != nil {
+		return err
+	}
+	if o.manifest != "" {
+		if err := g.saveManifest(o.manifest, cmd, config, org, o.backend); err != nil {
+			return err
+		}
+	}
+	usage := func() (executor.APIUsage, error) { return executor.GetAPIUsage(org) }
+	if !b.RequiresOrg {
+		usage = nil
+	}
+	return g.runSuiteWithExecutor(commandContext(cmd), exec, org, config, usage)
+}
+
+// runSuiteWithExecutor compares the suite's benchmarks like compare does and
+// ends with a summary of the session on stderr. When usage is given, the
+// summary includes the daily API requests the session consumed.
+func (g *globalOptions) runSuiteWithExecutor(ctx context.Context, exec executor.Executor, org string, config types.BenchmarkConfig, usage func() (executor.APIUsage, error)) error {
+	var before *executor.APIUsage
+	if usage != nil {
+		// The summary is informational, so failing to get usage only drops
+		// API requests from it
+		if u, err := usage(); err != nil {
+			g.verbosef("Leaving API requests out of the summary: %v\n", err)
+		} else {
+			before = &u
+		}
+	}
+
+	counting := executor.NewCountingExecutor(exec)
+	start := time.Now()
+	c, err := g.runComparison(ctx, counting, org, config)
+	if err != nil {
+		return err
+	}
+	if err := c.report(); err != nil {
+		return err
+	}
+
+	summary := summarizeSuite(c, time.Since(start), counting.Executions())
+	if before != nil {
+		if after, err := usage(); err != nil {
+			g.verbosef("Leaving API requests out of the summary: %v\n", err)
+		} else {
+			requests := max(after.Used-before.Used, 0)
+			summary.APIRequests = &requests
+		}
+	}
+	if !g.quiet {
+		fmt.Fprintln(g.stderr())
+		summary.print(g.stderr())
+	}
+	return c.Err(ctx)
+}
+
+// suiteSummary is the at-a-glance digest printed after a suite
+type suiteSummary struct {
+	Benchmarks    int // Benchmarks that were to run
+	Completed     int // Benchmarks that produced a result
+	Failed        int
+	BudgetsPassed int
+	BudgetsFailed int
+	Slowest       string // Slowest successful benchmark by the ranking metric
+	SlowestValue  float64
+	Metric        string // Ranking metric: "cpu", "wall" or "heap"
+	Elapsed       time.Duration
+	Executions    int
+	APIRequests   *int // Daily API requests consumed, when known
+	Invocations   types.InvocationTiming
+}
+
+// summarizeSuite summarizes a finished comparison
+func summarizeSuite(c comparison, elapsed time.Duration, executions int) suiteSummary {
+	summary := suiteSummary{
+		Benchmarks:  c.Benchmarks,
+		Completed:   len(c.Results),
+		Metric:      c.Metrics.RelativeTo,
+		Elapsed:     elapsed,
+		Executions:  executions,
+		Invocations: c.Invocations,
+	}
+	if summary.Metric != "wall" {
+		// Slowest is about time, so heap rankings fall back to CPU time
+		summary.Metric = "cpu"
+	}
+	value := stats.MetricValue(summary.Metric)
+	for _, result := range c.Results {
+		if result.Error != "" {
+			summary.Failed++
+			continue
+		}
+		for _, check := range result.Thresholds {
+			if check.Pass {
+				summary.BudgetsPassed++
+			} else {
+				summary.BudgetsFailed++
+			}
+		}
+		if v, ok := value(result); ok && (summary.Slowest == "" || v > summary.SlowestValue) {
+			summary.Slowest = result.Name
+			summary.SlowestValue = v
+		}
+	}
+	return summary
+}
+
+// print writes the summary as an indented list
+func (s suiteSummary) print(w io.Writer) {
+	fmt.Fprintln(w, "Suite summary:")
+
+	benchmarks := fmt.Sprintf("%d", s.Benchmarks)
+	var notes []string
+	if s.Failed > 0 {
+		notes = append(notes, fmt.Sprintf("%d failed", s.Failed))
+	}
+	if s.Completed < s.Benchmarks {
+		notes = append(notes, fmt.Sprintf("%d not run", s.Benchmarks-s.Completed))
+	}
+	if len(notes) > 0 {
+		benchmarks += " (" + strings.Join(notes, ", ") + ")"
+	}
+	fmt.Fprintf(w, "  Benchmarks:   %s\n", benchmarks)
+
+	if s.BudgetsPassed+s.BudgetsFailed > 0 {
+		fmt.Fprintf(w, "  Budgets:      %d passed, %d failed\n", s.BudgetsPassed, s.BudgetsFailed)
+	}
+	if s.Slowest != "" {
+		fmt.Fprintf(w, "  Slowest:      %s (%.3f ms %s)\n", s.Slowest, s.SlowestValue, strings.ToUpper(s.Metric))
+	}
+	fmt.Fprintf(w, "  Total time:   %s\n", s.Elapsed.Round(100*time.Millisecond))
+	fmt.Fprintf(w, "  Executions:   %d\n", s.Executions)
+	if t := s.Invocations; t.Invocations > 0 && t.TotalMs > 0 {
+		fmt.Fprintf(w, "  Overhead:     %s of %s outside Apex (%.0f%%)\n",
+			msDuration(t.OverheadMs), msDuration(t.TotalMs), t.OverheadMs/t.TotalMs*100)
+	}
+	if s.APIRequests != nil {
+		fmt.Fprintf(w, "  API requests: %d\n", *s.APIRequests)
+	}
+}
+
+// msDuration returns ms milliseconds as a duration rounded for display
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond)).Round(100 * time.Millisecond)
+}
+
+// selectChanged marks the benchmarks of config not affected by git changes
+// since base as unchanged, so their latest results are taken from history
+func (g *globalOptions) selectChanged(config *types.BenchmarkConfig, suitePath, base string) error {
+	changed, err := g.changedFiles(filepath.Dir(suitePath), base)
+	if err != nil {
+		return fmt.Errorf("--changed-only: %w", err)
+	}
+	affected, err := changedBenchmarks(config.Benchmarks, suitePath, changed)
+	if err != nil {
+		return err
+	}
+	config.Unchanged = nil
+	for _, spec := range config.Benchmarks {
+		if !slices.Contains(affected, spec.Name) {
+			config.Unchanged = append(config.Unchanged, spec.Name)
+		}
+	}
+	g.progressf("%d of %d benchmarks changed since %s\n", len(affected), len(config.Benchmarks), base)
+	return nil
+}
+
+// applySuiteOverrides applies the shared flags given on the command line
+// to a suite file's settings
+func (g *globalOptions) applySuiteOverrides(flags *pflag.FlagSet, config *types.BenchmarkConfig) {
+	if g.org != "" {
+		config.Org = g.org
+	}
+	if g.namespace != "" {
+		config.Namespace = g.namespace
+	}
+	config.Vars = g.benchVars(config.Vars)
+	if flags.Changed("parallel") || config.Parallel == 0 {
+		config.Parallel = g.parallel
+	}
+	if flags.Changed("timeout") || config.Timeout == 0 {
+		config.Timeout = g.timeout
+	}
+	if flags.Changed("delay") || config.Delay == 0 {
+		config.Delay = g.delay
+	}
+	if flags.Changed("jitter") || config.Jitter == 0 {
+		config.Jitter = g.jitter
+	}
+	if len(g.outputs) > 0 {
+		config.Outputs = g.outputs
+	}
+}
+
+// loadSuite reads a suite file, expanding benchmark files given as
+// patterns, or builds a suite from a directory of benchmark files. Settings
+// missing from the file keep the defaults of the compare command.
+func loadSuite(path string) (types.BenchmarkConfig, error) {
+	if isBenchmarkDir(path) {
+		return loadBenchmarkDir(path)
+	}
+	if _, err := config.FormatOf(path); err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("failed to read suite: %w", err)
+	}
+	suite, err := parseSuiteFile(data, path)
+	if err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	if suite.Benchmarks, err = expandFileGlobs(suite.Benchmarks); err != nil {
+		return types.BenchmarkConfig{}, fmt.Errorf("suite %s: %w", path, err)
+	}
+	if err := checkThresholdNames(suite, path); err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	return suite, nil
+}
+
+// suiteDefaults returns the settings of a suite that sets none: the
+// defaults of the compare command
+func suiteDefaults() types.BenchmarkConfig {
+	return types.BenchmarkConfig{
+		Iterations:     100,
+		Warmup:         10,
+		Runs:           1,
+		Aggregate:      "mean",
+		NoiseThreshold: 20,
+		Metrics:        "cpu,heap,db",
+		Output:         compareDefaultOutput,
+	}
+}
+
+// parseSuite parses a suite given other than as a file, such as in a
+// request, in YAML, which reads JSON as its subset; name names it in errors.
+// It cannot extend or include files.
+func parseSuite(data []byte, name string) (types.BenchmarkConfig, error) {
+	suite := suiteDefaults()
+	if err := config.Decode(data, config.YAML, name, &suite); err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	if err := checkSuite(suite, name); err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	return suite, nil
+}
+
+// parseSuiteFile parses data as the suite file at path, in the format of its
+// extension and with the files it extends and includes
+func parseSuiteFile(data []byte, path string) (types.BenchmarkConfig, error) {
+	suite := suiteDefaults()
+	if err := config.DecodeFile(data, path, &suite); err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	if err := checkSuite(suite, path); err != nil {
+		return types.BenchmarkConfig{}, err
+	}
+	return suite, nil
+}
+
+// checkSuite checks the benchmarks and thresholds of a parsed suite; path
+// names it in errors
+func checkSuite(suite types.BenchmarkConfig, path string) error {
+	if len(suite.Benchmarks) == 0 {
+		return fmt.Errorf("suite %s lists no benchmarks", path)
+	}
+	for i, spec := range suite.Benchmarks {
+		if strings.TrimSpace(spec.Name) == "" {
+			return fmt.Errorf("benchmark %d in %s has no name", i+1, path)
+		}
+		if (spec.File == "") == (spec.Code == "") {
+			return fmt.Errorf("benchmark %q in %s needs exactly one of file or code", spec.Name, path)
+		}
+		if spec.Fence < 0 || (spec.Fence > 0 && !bench.IsMarkdown(spec.File)) {
+			return fmt.Errorf("benchmark %q in %s sets fence, which needs a Markdown file and numbers from 1", spec.Name, path)
+		}
+	}
+	return checkThresholdNames(suite, path)
+}
+
+// checkThresholdNames checks that the thresholds of a suite name its
+// benchmarks. Names below a benchmark whose file is a pattern, such as
+// "Strings/concat", are checked once the pattern is expanded.
+func checkThresholdNames(config types.BenchmarkConfig, path string) error {
+	for name := range config.Thresholds {
+		if _, ok := orchestrator.FindBenchmark(config.Benchmarks, name); ok {
+			continue
+		}
+		pending := false
+		for _, spec := range config.Benchmarks {
+			pending = pending || (isGlob(spec.File) && strings.HasPrefix(name, spec.Name+"/"))
+		}
+		if !pending {
+			return fmt.Errorf("thresholds in %s name unknown benchmark %q", path, name)
+		}
+	}
+	return nil
+}
+
+// benchmarkFilter selects the benchmarks of a suite to run
+type benchmarkFilter struct {
+	Tags     []string       // Run only benchmarks with at least one of these tags
+	SkipTags []string       // Skip benchmarks with any of these tags
+	Name     *regexp.Regexp // Run only benchmarks whose name matches, when set
+}
+
+// matches reports whether spec is selected by the filter. Tags are compared
+// case-insensitively.
+func (f benchmarkFilter) matches(spec types.BenchmarkSpec) bool {
+	if f.Name != nil && !f.Name.MatchString(spec.Name) {
+		return false
+	}
+	if len(f.Tags) > 0 && !hasAnyTag(spec, f.Tags) {
+		return false
+	}
+	return !hasAnyTag(spec, f.SkipTags)
+}
+
+// filterBenchmarks returns the benchmarks selected by filter, in order
+func filterBenchmarks(specs []types.BenchmarkSpec, filter benchmarkFilter) []types.BenchmarkSpec {
+	selected := make([]types.BenchmarkSpec, 0, len(specs))
+	for _, spec := range specs {
+		if filter.matches(spec) {
+			selected = append(selected, spec)
+		}
+	}
+	return selected
+}
+
+// hasAnyTag reports whether spec has one of tags
+func hasAnyTag(spec types.BenchmarkSpec, tags []string) bool {
+	for _, tag := range tags {
+		for _, own := range spec.Tags {
+			if strings.EqualFold(strings.TrimSpace(tag), own) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func writeSuite(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSuite_Example(t *testing.T) {
+	config, err := loadSuite(filepath.Join("..", "..", "testdata", "configs", "example.yaml"))
+	if err != nil {
+		t.Fatalf("loadSuite() error = %v", err)
+	}
+
+	if len(config.Benchmarks) != 3 || config.Iterations != 200 || config.Runs != 5 || config.Parallel != 3 {
+		t.Errorf("Unexpected suite: %+v", config)
+	}
+	if !reflect.DeepEqual(config.Benchmarks[1].Tags, []string{"strings", "slow"}) {
+		t.Errorf("Expected tags of String Format, got %v", config.Benchmarks[1].Tags)
+	}
+	// Settings missing from the file keep their defaults
+	if config.Aggregate != "mean" || config.Metrics != "cpu,heap,db" || config.NoiseThreshold != 20 {
+		t.Errorf("Expected defaults for missing settings, got %+v", config)
+	}
+}
+
+func TestLoadSuite_JSON(t *testing.T) {
+	config, err := loadSuite(filepath.Join("..", "..", "testdata", "configs", "example.json"))
+	if err != nil {
+		t.Fatalf("loadSuite() error = %v", err)
+	}
+	if len(config.Benchmarks) != 2 || config.Iterations != 200 || config.Runs != 5 || config.Aggregate != "mean" {
+		t.Errorf("Unexpected suite: %+v", config)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "suite.json")
+	if err := os.WriteFile(path, []byte(`{"benchmarks": [{"name": "A", "code": "x"}], "runs": "5"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSuite(path); err == nil || !strings.Contains(err.Error(), `suite.json:1:54: runs: expected a whole number, got "5"`) {
+		t.Errorf("Expected a positioned type error, got %v", err)
+	}
+
+	path = filepath.Join(dir, "suite.txt")
+	if err := os.WriteFile(path, []byte("benchmarks: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSuite(path); err == nil || !strings.Contains(err.Error(), "unsupported config file") {
+		t.Errorf("Expected an unsupported extension to be rejected, got %v", err)
+	}
+}
+
+func TestLoadSuite_ExtendsAndInclude(t *testing.T) {
+	dir := writeBenchmarkDir(t, map[string]string{
+		"base-bench.yaml":      "iterations: 500\nruns: 3\nthresholds:\n  Concat:\n    maxCpuMs: 5\n",
+		"strings/bench.yaml":   "benchmarks:\n  - name: Concat\n    code: \"String s = 'a' + 'b';\"\n",
+		"lists/bench.json":     `{"benchmarks": [{"name": "Sort", "code": "new List<Integer>{2, 1}.sort();"}]}`,
+		"ci/suite.yaml":        "extends: ../base-bench.yaml\ninclude:\n  - ../strings/bench.yaml\n  - ../lists/bench.json\nruns: 5\n",
+		"ci/bad-threshold.yml": "include: ../lists/bench.json\nthresholds:\n  Concat:\n    maxCpuMs: 1\n",
+	})
+
+	config, err := loadSuite(filepath.Join(dir, "ci", "suite.yaml"))
+	if err != nil {
+		t.Fatalf("loadSuite() error = %v", err)
+	}
+	if len(config.Benchmarks) != 2 || config.Benchmarks[0].Name != "Concat" || config.Benchmarks[1].Name != "Sort" {
+		t.Errorf("Expected the included benchmarks, got %+v", config.Benchmarks)
+	}
+	if config.Iterations != 500 || config.Runs != 5 || config.Warmup != 10 {
+		t.Errorf("Expected the base's settings under the suite's and defaults under both, got %+v", config)
+	}
+	if _, ok := config.Thresholds["Concat"]; !ok {
+		t.Errorf("Expected the base's thresholds, got %v", config.Thresholds)
+	}
+
+	// Thresholds are checked against the merged benchmarks
+	if _, err := loadSuite(filepath.Join(dir, "ci", "bad-threshold.yml")); err == nil || !strings.Contains(err.Error(), `unknown benchmark "Concat"`) {
+		t.Errorf("Expected an unknown benchmark in thresholds, got %v", err)
+	}
+}
+
+func TestLoadSuite_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", "lists no benchmarks"},
+		{"unknown key", "benchmarks:\n  - name: A\n    code: x\nitertions: 5\n", `suite.yaml:4:1: unknown key "itertions"; did you mean "iterations"?`},
+		{"missing name", "benchmarks:\n  - code: x\n", "has no name"},
+		{"no source", "benchmarks:\n  - name: A\n", "exactly one of file or code"},
+		{"both sources", "benchmarks:\n  - name: A\n    code: x\n    file: a.apex\n", "exactly one of file or code"},
+		{"unknown threshold", "benchmarks:\n  - name: A\n    code: x\nthresholds:\n  B:\n    maxCpuMs: 1\n", `unknown benchmark "B"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadSuite(writeSuite(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadSuite() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBenchmarks(t *testing.T) {
+	specs := []types.BenchmarkSpec{
+		{Name: "Query", Tags: []string{"soql"}},
+		{Name: "Bulk Insert", Tags: []string{"bulk", "slow"}},
+		{Name: "Concat", Tags: []string{"strings"}},
+		{Name: "Untagged"},
+	}
+
+	tests := []struct {
+		name   string
+		filter benchmarkFilter
+		want   []string
+	}{
+		{"no filter", benchmarkFilter{}, []string{"Query", "Bulk Insert", "Concat", "Untagged"}},
+		{"tags", benchmarkFilter{Tags: []string{"soql", "bulk"}}, []string{"Query", "Bulk Insert"}},
+		{"skip tags", benchmarkFilter{SkipTags: []string{"slow"}}, []string{"Query", "Concat", "Untagged"}},
+		{"both", benchmarkFilter{Tags: []string{"soql", "bulk"}, SkipTags: []string{"slow"}}, []string{"Query"}},
+		{"case-insensitive", benchmarkFilter{Tags: []string{"SOQL"}}, []string{"Query"}},
+		{"name", benchmarkFilter{Name: regexp.MustCompile("^(Query|Concat)$")}, []string{"Query", "Concat"}},
+		{"name and tags", benchmarkFilter{Name: regexp.MustCompile("n"), SkipTags: []string{"slow"}}, []string{"Concat", "Untagged"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, spec := range filterBenchmarks(specs, tt.filter) {
+				got = append(got, spec.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterBenchmarks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuite_SimulatedBackend(t *testing.T) {
+	g := &globalOptions{}
+	path := writeSuite(t, `benchmarks:
+  - name: A
+    code: "Integer a = 1;"
+    tags: [fast]
+  - name: B
+    code: "Integer b = 2;"
+iterations: 10
+warmup: 1
+runs: 2
+`)
+	config, err := loadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Benchmarks = filterBenchmarks(config.Benchmarks, benchmarkFilter{Tags: []string{"fast"}})
+	config.Parallel = 1
+	config.Outputs = []string{"json:" + filepath.Join(t.TempDir(), "out.json")}
+
+	if err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config); err != nil {
+		t.Fatalf("compareBenchmarksWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(config.Outputs[0], "json:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name": "A"`) || strings.Contains(string(data), `"name": "B"`) {
+		t.Errorf("Expected only benchmark A in output, got %s", data)
+	}
+}
+
+func TestSuite_Thresholds(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	path := writeSuite(t, `benchmarks:
+  - name: A
+    code: "Integer a = 1;"
+  - name: B
+    code: "Integer b = 2;"
+iterations: 10
+thresholds:
+  A:
+    maxCpuMs: 1000
+  B:
+    maxCpuMs: 0.000001
+`)
+	config, err := loadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Parallel = 1
+	config.KeepGoing = true
+	config.Outputs = []string{"json:" + filepath.Join(t.TempDir(), "out.json")}
+
+	err = g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "1 budget checks failed") {
+		t.Fatalf("Expected the budget of B to fail, got %v", err)
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(config.Outputs[0], "json:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"metric": "maxCpuMs"`) || !strings.Contains(string(data), `"pass": true`) {
+		t.Errorf("Expected budget outcomes in output, got %s", data)
+	}
+
+	// Limits on metrics that are not tracked cannot be checked
+	config.Thresholds = map[string]types.Threshold{"A": {MaxSoql: new(float64)}}
+	err = g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "requires trackDB") {
+		t.Errorf("Expected trackDB to be required, got %v", err)
+	}
+}
+
+func TestSummarizeSuite(t *testing.T) {
+	c := comparison{Comparison: orchestrator.Comparison{
+		Benchmarks: 4,
+		Results: []types.AggregatedResult{
+			{Name: "A", AvgCpuMs: 2, Thresholds: []types.ThresholdCheck{{Metric: "maxCpuMs", Pass: true}}},
+			{Name: "B", AvgCpuMs: 7, Thresholds: []types.ThresholdCheck{{Metric: "maxCpuMs"}}},
+			{Name: "C", Error: "compile error"},
+		},
+		Invocations: types.InvocationTiming{Invocations: 12, TotalMs: 80000, ApexMs: 20000, OverheadMs: 60000},
+	}}
+	summary := summarizeSuite(c, 83*time.Second, 12)
+	requests := 14
+	summary.APIRequests = &requests
+
+	var buf bytes.Buffer
+	summary.print(&buf)
+	output := buf.String()
+	for _, want := range []string{
+		"Benchmarks:   4 (1 failed, 1 not run)",
+		"Budgets:      1 passed, 1 failed",
+		"Slowest:      B (7.000 ms CPU)",
+		"Total time:   1m23s",
+		"Executions:   12",
+		"API requests: 14",
+		"Overhead:     1m0s of 1m20s outside Apex (75%)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	summary = summarizeSuite(comparison{Comparison: orchestrator.Comparison{Benchmarks: 1, Results: []types.AggregatedResult{{Name: "A"}}}}, time.Second, 1)
+	buf.Reset()
+	summary.print(&buf)
+	if strings.Contains(buf.String(), "Budgets:") || strings.Contains(buf.String(), "API requests:") || strings.Contains(buf.String(), "Overhead:") {
+		t.Errorf("Expected no budget, API or overhead lines, got:\n%s", buf.String())
+	}
+}
+
+func TestRunSuiteWithExecutor_APIUsage(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{{Name: "A", Code: "Integer a = 1;"}, {Name: "B", Code: "Integer b = 2;"}},
+		Iterations: 10,
+		Runs:       2,
+		Parallel:   1,
+		Outputs:    []string{"json:" + filepath.Join(t.TempDir(), "out.json")},
+	}
+	calls := 0
+	usage := func() (executor.APIUsage, error) {
+		calls++
+		return executor.APIUsage{Used: 100 * calls, Max: 15000}, nil
+	}
+	if err := g.runSuiteWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config, usage); err != nil {
+		t.Fatalf("runSuiteWithExecutor() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected usage before and after the suite, got %d calls", calls)
+	}
+}
+
+func TestSuite_Cache(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.json")
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{{Name: "A", Code: "Integer a = 1;"}, {Name: "B", Code: "Integer b = 2;"}},
+		Iterations: 10,
+		Runs:       1,
+		Parallel:   1,
+		Aggregate:  "median",
+		Cache:      true,
+		Outputs:    []string{"json:" + out},
+	}
+	err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "requires a history file") {
+		t.Fatalf("Expected a history file to be required, got %v", err)
+	}
+
+	config.History = filepath.Join(dir, "history.jsonl")
+	run := func() int {
+		t.Helper()
+		counting := executor.NewCountingExecutor(executor.NewSimulatedExecutor())
+		if err := g.compareBenchmarksWithExecutor(context.Background(), counting, "", config); err != nil {
+			t.Fatalf("compareBenchmarksWithExecutor() error = %v", err)
+		}
+		return counting.Executions()
+	}
+	if n := run(); n != 2 {
+		t.Errorf("Expected both benchmarks to run without a cache, got %d executions", n)
+	}
+	if n := run(); n != 0 {
+		t.Errorf("Expected both benchmarks served from the cache, got %d executions", n)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), `"cachedFrom"`) != 2 {
+		t.Errorf("Expected cached results in the output, got %s", data)
+	}
+
+	config.Benchmarks[1].Code = "Integer b = 3;"
+	if n := run(); n != 1 {
+		t.Errorf("Expected only the changed benchmark to run, got %d executions", n)
+	}
+	data, _ = os.ReadFile(out)
+	if strings.Index(string(data), `"name": "A"`) > strings.Index(string(data), `"name": "B"`) {
+		t.Errorf("Expected results in benchmark order, got %s", data)
+	}
+
+	config.CacheMaxAge = time.Nanosecond
+	if n := run(); n != 2 {
+		t.Errorf("Expected expired results to run again, got %d executions", n)
+	}
+}
+
+func TestSuite_Unchanged(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	dir := t.TempDir()
+	config := types.BenchmarkConfig{
+		Benchmarks: []types.BenchmarkSpec{{Name: "A", Code: "Integer a = 1;"}, {Name: "B", Code: "Integer b = 2;"}},
+		Iterations: 10,
+		Runs:       1,
+		Parallel:   1,
+		Aggregate:  "median",
+		Unchanged:  []string{"A"},
+		Outputs:    []string{"json:" + filepath.Join(dir, "out.json")},
+	}
+	err := g.compareBenchmarksWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", config)
+	if err == nil || !strings.Contains(err.Error(), "--changed-only requires a history file") {
+		t.Fatalf("Expected a history file to be required, got %v", err)
+	}
+
+	// Without a stored result, unchanged benchmarks run too
+	config.History = filepath.Join(dir, "history.jsonl")
+	counting := executor.NewCountingExecutor(executor.NewSimulatedExecutor())
+	if err := g.compareBenchmarksWithExecutor(context.Background(), counting, "", config); err != nil {
+		t.Fatal(err)
+	}
+	if counting.Executions() != 2 {
+		t.Errorf("Expected both benchmarks to run, got %d executions", counting.Executions())
+	}
+
+	// Settings changed, but A is unchanged and taken from history
+	config.Iterations = 20
+	counting = executor.NewCountingExecutor(executor.NewSimulatedExecutor())
+	if err := g.compareBenchmarksWithExecutor(context.Background(), counting, "", config); err != nil {
+		t.Fatal(err)
+	}
+	if counting.Executions() != 1 {
+		t.Errorf("Expected only B to run, got %d executions", counting.Executions())
+	}
+}
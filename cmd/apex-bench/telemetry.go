@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/scheduler"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/telemetry"
+	"github.com/spf13/cobra"
+)
+
+// newTelemetryCmd creates a telemetry command
+func newTelemetryCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "telemetry on|off|status",
+		Short: "Turn anonymous usage telemetry on or off",
+		Long: `Telemetry is off unless you turn it on. When on, each command records
+which command ran, how many Apex executions it started, how long it took
+and the class of any error (such as compile or timeout), with a random id,
+the apex-bench version and the platform. Benchmark code, org names, file
+paths and error messages are never recorded. Every event is appended to a
+local log, shown by status, before it is sent.
+
+APEX_BENCH_TELEMETRY=on|off overrides the setting saved here, and
+DO_NOT_TRACK=1 turns telemetry off regardless.`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"on", "off", "status"},
+		RunE:      g.runTelemetry,
+	}
+}
+
+// openTelemetryStore returns where telemetry settings and events are kept,
+// through g.telemetryStore when set
+func (g *globalOptions) openTelemetryStore() (telemetry.Store, error) {
+	if g.telemetryStore != nil {
+		return g.telemetryStore()
+	}
+	return telemetry.DefaultStore()
+}
+
+func (g *globalOptions) runTelemetry(cmd *cobra.Command, args []string) error {
+	store, err := g.openTelemetryStore()
+	if err != nil {
+		return err
+	}
+	settings, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "on", "off":
+		settings.Enabled = args[0] == "on"
+		if settings, err = store.Save(settings); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown telemetry action %q (expected on, off or status)", args[0])
+	}
+
+	enabled, source, err := telemetry.Enabled(settings, os.Getenv)
+	if err != nil {
+		return err
+	}
+	state := "off"
+	if enabled {
+		state = "on"
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Telemetry is %s (%s)\n", state, source)
+	if args[0] != "status" && enabled != settings.Enabled {
+		fmt.Fprintf(out, "%s overrides the saved setting\n", source)
+	}
+	fmt.Fprintf(out, "Settings: %s\nEvent log: %s\n", store.SettingsPath(), store.LogPath())
+	return nil
+}
+
+// recordTelemetry records the invocation of cmd, which took duration and
+// returned err, when telemetry is enabled. Failing to record never fails
+// the command.
+func (g *globalOptions) recordTelemetry(cmd *cobra.Command, duration time.Duration, err error) {
+	if cmd == nil || !cmd.HasParent() || cmd.Name() == "telemetry" {
+		return
+	}
+	store, storeErr := g.openTelemetryStore()
+	if storeErr != nil {
+		return
+	}
+	settings, loadErr := store.Load()
+	if loadErr != nil {
+		g.verbosef("Skipping telemetry: %v\n", loadErr)
+		return
+	}
+	if enabled, _, _ := telemetry.Enabled(settings, os.Getenv); !enabled {
+		return
+	}
+	if settings, loadErr = store.EnsureID(settings); loadErr != nil {
+		g.verbosef("Skipping telemetry: %v\n", loadErr)
+		return
+	}
+
+	event := telemetry.Event{
+		ID:         settings.ID,
+		Time:       time.Now().UTC(),
+		Command:    strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "),
+		Executions: scheduler.Default.Started(),
+		DurationMs: duration.Milliseconds(),
+		ErrorClass: errorClass(err),
+		Version:    version,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if err := store.Record(context.Background(), event); err != nil {
+		g.verbosef("Skipping telemetry: %v\n", err)
+	}
+}
+
+// errorClass names the kind of err without revealing its message, which
+// may quote benchmark code or org details
+func errorClass(err error) string {
+	var compileErr *executor.CompileError
+	var runErrs *executor.RunErrors
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "interrupted"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &compileErr):
+		return "compile"
+	case errors.Is(err, exec.ErrNotFound):
+		return "cli-missing"
+	case errors.As(err, &runErrs):
+		return "execution"
+	}
+	return "other"
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/telemetry"
+)
+
+// useTelemetryStore keeps the telemetry of g in a temporary directory for
+// the test
+func useTelemetryStore(t *testing.T, g *globalOptions) telemetry.Store {
+	t.Helper()
+	store := telemetry.Store{Dir: t.TempDir()}
+	g.telemetryStore = func() (telemetry.Store, error) { return store, nil }
+	t.Setenv(telemetry.EnvVar, "")
+	t.Setenv("DO_NOT_TRACK", "")
+	return store
+}
+
+func TestRunTelemetry(t *testing.T) {
+	g := &globalOptions{}
+	store := useTelemetryStore(t, g)
+	var out bytes.Buffer
+	telemetryCmd := newTelemetryCmd(g)
+	telemetryCmd.SetOut(&out)
+
+	if err := g.runTelemetry(telemetryCmd, []string{"status"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Telemetry is off (default)") || !strings.Contains(out.String(), store.LogPath()) {
+		t.Errorf("Unexpected status:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := g.runTelemetry(telemetryCmd, []string{"on"}); err != nil {
+		t.Fatal(err)
+	}
+	if settings, _ := store.Load(); !settings.Enabled || settings.ID == "" {
+		t.Errorf("Expected telemetry on with an id, got %+v", settings)
+	}
+	if !strings.Contains(out.String(), "Telemetry is on") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	// The environment wins over the saved setting
+	out.Reset()
+	t.Setenv("DO_NOT_TRACK", "1")
+	if err := g.runTelemetry(telemetryCmd, []string{"on"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Telemetry is off (DO_NOT_TRACK)") || !strings.Contains(out.String(), "overrides") {
+		t.Errorf("Expected DO_NOT_TRACK to override, got:\n%s", out.String())
+	}
+
+	if err := g.runTelemetry(telemetryCmd, []string{"maybe"}); err == nil {
+		t.Error("Expected an unknown action to be rejected")
+	}
+}
+
+func TestRecordTelemetry(t *testing.T) {
+	g := &globalOptions{}
+	store := useTelemetryStore(t, g)
+	root := NewRootCmd()
+	orgsCmd, _, _ := root.Find([]string{"orgs"})
+	telemetryCmd, _, _ := root.Find([]string{"telemetry"})
+
+	// Nothing is recorded until telemetry is turned on
+	g.recordTelemetry(orgsCmd, time.Second, nil)
+	if _, err := os.Stat(store.LogPath()); !os.IsNotExist(err) {
+		t.Fatalf("Expected no events while telemetry is off, got %v", err)
+	}
+
+	settings, err := store.Save(telemetry.Settings{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.recordTelemetry(orgsCmd, 1500*time.Millisecond, fmt.Errorf("org secret-org: %w", &executor.CompileError{Problem: "Unexpected token 'secret code'"}))
+	g.recordTelemetry(telemetryCmd, time.Second, nil)
+
+	data, err := os.ReadFile(store.LogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Expected no error details in the event, got %s", data)
+	}
+	var event telemetry.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Expected one event, got %s (%v)", data, err)
+	}
+	if event.ID != settings.ID || event.Command != "orgs" || event.DurationMs != 1500 || event.ErrorClass != "compile" || event.Version != version {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("sf apex run interrupted: %w", context.Canceled), "interrupted"},
+		{fmt.Errorf("sf apex run timed out: %w", context.DeadlineExceeded), "timeout"},
+		{&executor.RunErrors{Failed: []int{1}, Errs: []error{&executor.CompileError{Problem: "x"}}}, "compile"},
+		{&executor.RunErrors{Failed: []int{1}, Errs: []error{errors.New("Apex execution failed")}}, "execution"},
+		{fmt.Errorf("sf CLI not found: %w", exec.ErrNotFound), "cli-missing"},
+		{errors.New("must provide either --code or --file"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRecordTelemetry_EnvVar(t *testing.T) {
+	g := &globalOptions{}
+	store := useTelemetryStore(t, g)
+	t.Setenv(telemetry.EnvVar, "on")
+	orgsCmd, _, _ := NewRootCmd().Find([]string{"orgs"})
+
+	g.recordTelemetry(orgsCmd, time.Second, nil)
+	g.recordTelemetry(orgsCmd, time.Second, nil)
+
+	settings, err := store.Load()
+	if err != nil || settings.Enabled || settings.ID == "" {
+		t.Fatalf("Expected an install id without opting in, got %+v (%v)", settings, err)
+	}
+	data, err := os.ReadFile(store.LogPath())
+	if err != nil {
+		t.Fatalf("Expected events when %s enables telemetry: %v", telemetry.EnvVar, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, line := range lines {
+		var event telemetry.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil || event.ID != settings.ID {
+			t.Errorf("Expected an event with id %q, got %s (%v)", settings.ID, line, err)
+		}
+	}
+	if len(lines) != 2 {
+		t.Errorf("Expected 2 events, got %d", len(lines))
+	}
+}
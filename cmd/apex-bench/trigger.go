@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// triggerOptions are the flags of a trigger command
+type triggerOptions struct {
+	global     *globalOptions
+	object     string
+	operation  string
+	records    int
+	field      string
+	values     []string
+	name       string
+	iterations int
+	warmup     int
+	runs       int
+	trackHeap  bool
+	trackDB    bool
+	aggregate  string
+	noise      float64
+	metrics    string
+	out        string
+	apiVersion string
+	backend    string
+}
+
+// Transaction limits that bound a trigger benchmark: every measured DML
+// statement and the rows it touches count against them
+const (
+	maxDmlStatements = 150
+	maxDmlRows       = 10000
+)
+
+// newTriggerCmd creates a trigger command with g as its global options
+func newTriggerCmd(g *globalOptions) *cobra.Command {
+	o := &triggerOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "trigger",
+		Short: "Benchmark the triggers of an sObject through DML",
+		Long: `Benchmark trigger execution end-to-end: every iteration performs one
+insert, update or delete of --records generated records of --object, so the
+measured time is that of the DML call and the triggers, flows and validation
+it fires.
+
+Records are built before measuring, with --field set to a unique text value
+and --set adding Apex values for other fields, e.g.
+--set "Industry='Technology'" --set "AnnualRevenue=1000". Everything the
+benchmark writes is rolled back after each run.
+
+All DML of a run shares one transaction, so (warmup + iterations) DML
+statements must stay within 150 and the rows they touch within 10,000.`,
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.object, "object", "", "sObject whose triggers to benchmark, e.g. Account")
+	cmd.Flags().StringVar(&o.operation, "operation", "insert", "DML operation to measure: insert, update, delete")
+	cmd.Flags().IntVar(&o.records, "records", 200, "Records per DML statement (200 is the trigger chunk size)")
+	cmd.Flags().StringVar(&o.field, "field", "Name", "Text field set to a unique value on each record; use LastName for Contact")
+	cmd.Flags().StringArrayVar(&o.values, "set", nil, "Additional field value as Field=<Apex expression>, repeatable")
+	cmd.Flags().StringVar(&o.name, "name", "", "Benchmark name (default: operation, records and object)")
+	cmd.Flags().IntVar(&o.iterations, "iterations", 10, "Number of measured DML statements")
+	cmd.Flags().IntVar(&o.warmup, "warmup", 2, "Number of warmup DML statements")
+	cmd.Flags().IntVar(&o.runs, "runs", 1, "Number of complete runs for aggregation")
+	cmd.Flags().BoolVar(&o.trackHeap, "track-heap", false, "Enable heap usage tracking")
+	cmd.Flags().BoolVar(&o.trackDB, "track-db", false, "Enable DML/SOQL tracking, counting what the triggers do")
+	cmd.Flags().StringVar(&o.aggregate, "aggregate", "mean", "How runs are combined: mean, median, min, trimmed-mean")
+	cmd.Flags().Float64Var(&o.noise, "noise-threshold", 20, "Flag results whose run-to-run CPU variation exceeds this percentage")
+	cmd.Flags().StringVar(&o.metrics, "metrics", "cpu,heap,db", "Metric groups shown in table output: cpu, wall, heap, db")
+	cmd.Flags().StringVar(&o.out, "out", "", "Write results to this file instead of stdout")
+	cmd.Flags().StringVar(&o.apiVersion, "api-version", "", "Salesforce API version to execute with, e.g. 62.0 (default: org default)")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+
+	cmd.MarkFlagRequired("object")
+	return cmd
+}
+
+func (o *triggerOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	dml := triggerDML{
+		Object:    o.object,
+		Operation: o.operation,
+		Records:   o.records,
+		Field:     o.field,
+		Values:    o.values,
+	}
+	spec, err := dml.spec(o.iterations, o.warmup)
+	if err != nil {
+		return err
+	}
+	if o.name != "" {
+		spec.Name = o.name
+	}
+	spec.TrackHeap = o.trackHeap
+	spec.TrackDB = o.trackDB
+	spec.Namespace = g.namespace
+	spec.Vars = g.benchVars(nil)
+
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+	if err != nil {
+		return err
+	}
+
+	config := types.BenchmarkConfig{
+		Runs:           o.runs,
+		Parallel:       g.parallel,
+		Timeout:        g.timeout,
+		Delay:          g.delay,
+		Jitter:         g.jitter,
+		Aggregate:      o.aggregate,
+		NoiseThreshold: o.noise,
+		Metrics:        o.metrics,
+		APIVersion:     o.apiVersion,
+		Outputs:        g.outputs,
+		Output:         compareDefaultOutput,
+		Out:            o.out,
+	}
+	return g.runBenchmarkWithExecutor(commandContext(cmd), exec, org, spec, config)
+}
+
+// triggerDML describes the DML statement measured by a trigger benchmark
+type triggerDML struct {
+	Object    string
+	Operation string   // insert, update or delete
+	Records   int      // Records per statement
+	Field     string   // Text field given a unique value per record
+	Values    []string // Further fields as Field=<Apex expression>
+}
+
+// spec generates the benchmark. Setup builds every record up front, and
+// inserts them for update and delete, so each measured iteration is a
+// single DML statement; the whole run is rolled back afterwards.
+func (d triggerDML) spec(iterations, warmup int) (types.CodeSpec, error) {
+	if !apexIdentifier.MatchString(d.Object) {
+		return types.CodeSpec{}, fmt.Errorf("invalid --object %q", d.Object)
+	}
+	if !apexIdentifier.MatchString(d.Field) {
+		return types.CodeSpec{}, fmt.Errorf("invalid --field %q", d.Field)
+	}
+	if d.Records < 1 {
+		return types.CodeSpec{}, fmt.Errorf("--records must be positive, got %d", d.Records)
+	}
+	if iterations < 1 || warmup < 0 {
+		return types.CodeSpec{}, fmt.Errorf("--iterations must be positive and --warmup not negative")
+	}
+
+	// Statements and rows used by the whole run: setup inserts the records
+	// to update or delete, and the savepoint counts as a statement
+	measured := warmup + iterations
+	var statements, rows int
+	switch d.Operation {
+	case "insert":
+		statements, rows = measured, measured*d.Records
+	case "update":
+		statements, rows = measured+1, (measured+1)*d.Records
+	case "delete":
+		statements, rows = measured+1, 2*measured*d.Records
+	default:
+		return types.CodeSpec{}, fmt.Errorf("unknown --operation %q (expected insert, update or delete)", d.Operation)
+	}
+	statements++
+	if statements > maxDmlStatements {
+		return types.CodeSpec{}, fmt.Errorf("%s needs %d DML statements, over the limit of %d; lower --iterations or --warmup", d.Operation, statements, maxDmlStatements)
+	}
+	if rows > maxDmlRows {
+		return types.CodeSpec{}, fmt.Errorf("%s touches %d DML rows, over the limit of %d; lower --records, --iterations or --warmup", d.Operation, rows, maxDmlRows)
+	}
+
+	var assignments strings.Builder
+	for _, value := range d.Values {
+		field, expr, ok := strings.Cut(value, "=")
+		field = strings.TrimSpace(field)
+		if !ok || !apexIdentifier.MatchString(field) || strings.TrimSpace(expr) == "" {
+			return types.CodeSpec{}, fmt.Errorf("invalid --set %q (expected Field=<Apex expression>)", value)
+		}
+		fmt.Fprintf(&assignments, "        triggerRecord.put('%s', %s);\n", field, strings.TrimSpace(expr))
+	}
+
+	// One batch of records per warmup and measured iteration; updates reuse
+	// a single batch
+	batches := measured
+	if d.Operation == "update" {
+		batches = 1
+	}
+	setup := fmt.Sprintf(`List<List<SObject>> triggerBatches = new List<List<SObject>>();
+for (Integer batchIndex = 0; batchIndex < %d; batchIndex++) {
+    List<SObject> triggerBatch = new List<SObject>();
+    for (Integer recordIndex = 0; recordIndex < %d; recordIndex++) {
+        SObject triggerRecord = Schema.getGlobalDescribe().get('%s').newSObject();
+        triggerRecord.put('%s', 'apex-bench ' + batchIndex + '-' + recordIndex);
+%s        triggerBatch.add(triggerRecord);
+    }
+    triggerBatches.add(triggerBatch);
+}
+Integer triggerBatchIndex = 0;`, batches, d.Records, d.Object, d.Field, assignments.String())
+
+	code := "insert triggerBatches[triggerBatchIndex++];"
+	switch d.Operation {
+	case "update":
+		// The same records are updated every iteration
+		setup += "\nList<SObject> triggerRecords = triggerBatches[0];\ninsert triggerRecords;"
+		code = "update triggerRecords;"
+	case "delete":
+		setup += "\nList<SObject> triggerRecords = new List<SObject>();\nfor (List<SObject> triggerBatch : triggerBatches) {\n    triggerRecords.addAll(triggerBatch);\n}\ninsert triggerRecords;"
+		code = "delete triggerBatches[triggerBatchIndex++];"
+	}
+
+	return types.CodeSpec{
+		Name:       fmt.Sprintf("%s %d %s", d.Operation, d.Records, d.Object),
+		UserCode:   code,
+		Setup:      setup,
+		Iterations: iterations,
+		Warmup:     warmup,
+		BatchSize:  1,
+		Rollback:   true,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestTriggerDML_Spec(t *testing.T) {
+	tests := []struct {
+		operation string
+		code      string
+		setup     []string
+	}{
+		{"insert", "insert triggerBatches[triggerBatchIndex++];", []string{"batchIndex < 12;"}},
+		{"update", "update triggerRecords;", []string{"batchIndex < 1;", "insert triggerRecords;"}},
+		{"delete", "delete triggerBatches[triggerBatchIndex++];", []string{"batchIndex < 12;", "triggerRecords.addAll(triggerBatch);", "insert triggerRecords;"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			dml := triggerDML{Object: "Account", Operation: tt.operation, Records: 200, Field: "Name", Values: []string{"Industry='Technology'", " AnnualRevenue = 1000"}}
+			spec, err := dml.spec(10, 2)
+			if err != nil {
+				t.Fatalf("spec() error = %v", err)
+			}
+			if spec.Name != tt.operation+" 200 Account" || spec.UserCode != tt.code || !spec.Rollback {
+				t.Errorf("Unexpected spec: %+v", spec)
+			}
+			for _, want := range append(tt.setup,
+				"get('Account').newSObject()",
+				"triggerRecord.put('Industry', 'Technology');",
+				"triggerRecord.put('AnnualRevenue', 1000);",
+			) {
+				if !strings.Contains(spec.Setup, want) {
+					t.Errorf("Expected %q in setup, got:\n%s", want, spec.Setup)
+				}
+			}
+			if _, err := generator.Generate(spec); err != nil {
+				t.Errorf("Generate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTriggerDML_SpecInvalid(t *testing.T) {
+	valid := triggerDML{Object: "Account", Operation: "insert", Records: 200, Field: "Name"}
+	tests := []struct {
+		name       string
+		modify     func(d *triggerDML)
+		iterations int
+		want       string
+	}{
+		{"operation", func(d *triggerDML) { d.Operation = "upsert" }, 10, "unknown --operation"},
+		{"object", func(d *triggerDML) { d.Object = "Account;" }, 10, "invalid --object"},
+		{"records", func(d *triggerDML) { d.Records = 0 }, 10, "--records must be positive"},
+		{"set", func(d *triggerDML) { d.Values = []string{"Industry"} }, 10, "invalid --set"},
+		{"rows", func(d *triggerDML) {}, 60, "touches 12400 DML rows"},
+		{"statements", func(d *triggerDML) { d.Records = 1 }, 150, "needs 153 DML statements"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dml := valid
+			tt.modify(&dml)
+			_, err := dml.spec(tt.iterations, 2)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("spec() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTriggerBenchmark_SimulatedBackend(t *testing.T) {
+	g := &globalOptions{}
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	spec, err := triggerDML{Object: "Contact", Operation: "insert", Records: 50, Field: "LastName"}.spec(5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "trigger.json")
+	config := types.BenchmarkConfig{Runs: 1, Parallel: 1, Aggregate: "median", Outputs: []string{"json:" + out}}
+	if err := g.runBenchmarkWithExecutor(context.Background(), executor.NewSimulatedExecutor(), "", spec, config); err != nil {
+		t.Fatalf("runBenchmarkWithExecutor() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name": "insert 50 Contact"`) {
+		t.Errorf("Expected the trigger benchmark result, got: %s", data)
+	}
+}
+
+func TestTriggerCmd_NoiseThreshold(t *testing.T) {
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+
+	// runNoisy reports whether the trigger benchmark was flagged noisy with
+	// --noise-threshold threshold
+	runNoisy := func(threshold string) bool {
+		t.Helper()
+		g := &globalOptions{parallel: 1}
+		out := filepath.Join(t.TempDir(), "trigger.json")
+		g.outputs = []string{"json:" + out}
+		cmd := newTriggerCmd(g)
+		setFlags(t, cmd, "object", "Contact", "field", "LastName", "records", "10", "runs", "3", "backend", "mock", "noise-threshold", threshold)
+		if err := cmd.RunE(cmd, nil); err != nil {
+			t.Fatalf("trigger error = %v", err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Contains(string(data), `"noisy": true`)
+	}
+	if !runNoisy("0.0001") || runNoisy("1000") {
+		t.Error("Expected --noise-threshold to decide whether the result is noisy")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, injected by release builds with
+//
+//	-ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+//
+// the names Homebrew and Scoop builds made with GoReleaser set by default.
+// Builds without them fall back to the VCS details Go embeds.
+var (
+	commit string
+	date   string
+)
+
+// newVersionCmd creates a version command with g as its global options
+func newVersionCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version",
+		Long: `Print the apex-bench version. With --verbose, also print the commit and
+date it was built from, the Go version and the platform; --output json
+prints all of them as JSON, for bug reports and CI logs:
+
+  apex-bench version --verbose
+  apex-bench version --output json`,
+		Args: cobra.NoArgs,
+		RunE: g.printVersion,
+	}
+}
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+// currentBuildInfo returns the build details of the running binary, with
+// "unknown" for those that were neither injected nor embedded
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		info = withVCSSettings(info, embedded.Settings)
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// withVCSSettings fills the commit and date of info that were not injected
+// from the vcs.* settings Go embeds when building inside a repository
+func withVCSSettings(info buildInfo, settings []debug.BuildSetting) buildInfo {
+	if info.Commit != "" && info.Date != "" {
+		return info
+	}
+	var revision, modified, vcsTime string
+	for _, setting := range settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		case "vcs.time":
+			vcsTime = setting.Value
+		}
+	}
+	if info.Commit == "" && revision != "" {
+		info.Commit = revision
+		if modified == "true" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Date == "" {
+		info.Date = vcsTime
+	}
+	return info
+}
+
+func (g *globalOptions) printVersion(cmd *cobra.Command, args []string) error {
+	targets, err := parseOutputTargets(types.BenchmarkConfig{Outputs: g.outputs, Output: "table"})
+	if err != nil {
+		return err
+	}
+	info := currentBuildInfo()
+	return g.writeReports(targets, func(format string, w io.Writer) error {
+		if format == "json" {
+			return reporter.PrintJSON(info, w)
+		}
+		return printVersionText(info, g.verbose, w)
+	})
+}
+
+// printVersionText writes info as text, only the version unless verbose
+func printVersionText(info buildInfo, verbose bool, w io.Writer) error {
+	if !verbose {
+		_, err := fmt.Fprintf(w, "apex-bench %s\n", info.Version)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "apex-bench %s\n  commit:   %s\n  date:     %s\n  go:       %s\n  platform: %s\n",
+		info.Version, info.Commit, info.Date, info.GoVersion, info.Platform)
+	return err
+}
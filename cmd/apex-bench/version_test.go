@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestWithVCSSettings(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "abc123"},
+		{Key: "vcs.time", Value: "2026-01-02T03:04:05Z"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+
+	info := withVCSSettings(buildInfo{}, settings)
+	if info.Commit != "abc123-dirty" || info.Date != "2026-01-02T03:04:05Z" {
+		t.Errorf("Expected the embedded commit and date, got %+v", info)
+	}
+
+	// Injected values win over embedded ones
+	info = withVCSSettings(buildInfo{Commit: "def456"}, settings)
+	if info.Commit != "def456" || info.Date != "2026-01-02T03:04:05Z" {
+		t.Errorf("Expected the injected commit, got %+v", info)
+	}
+
+	if info := withVCSSettings(buildInfo{}, nil); info.Commit != "" || info.Date != "" {
+		t.Errorf("Expected nothing without settings, got %+v", info)
+	}
+}
+
+func TestPrintVersionText(t *testing.T) {
+	info := buildInfo{Version: "1.2.0", Commit: "abc123", Date: "2026-01-02T03:04:05Z", GoVersion: "go1.23.0", Platform: "windows/amd64"}
+
+	var buf bytes.Buffer
+	if err := printVersionText(info, false, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "apex-bench 1.2.0\n" {
+		t.Errorf("Unexpected version: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := printVersionText(info, true, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"apex-bench 1.2.0", "commit:   abc123", "date:     2026-01-02T03:04:05Z", "go:       go1.23.0", "platform: windows/amd64"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected verbose version to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestPrintVersion_JSON(t *testing.T) {
+	g := &globalOptions{}
+	oldCommit := commit
+	defer func() { commit = oldCommit }()
+
+	path := filepath.Join(t.TempDir(), "version.json")
+	g.outputs = []string{"json:" + path}
+	commit = "abc123"
+	if err := g.printVersion(&cobra.Command{}, nil); err != nil {
+		t.Fatalf("printVersion() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info buildInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	want := buildInfo{Version: version, Commit: "abc123", GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info.Date == "" {
+		t.Errorf("Expected a date, or unknown, got %+v", info)
+	}
+	info.Date = ""
+	if info != want {
+		t.Errorf("Expected %+v, got %+v", want, info)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/orchestrator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// watchOptions are the flags of a watch command
+type watchOptions struct {
+	global        *globalOptions
+	file          string
+	name          string
+	iterations    int
+	warmup        int
+	batchSize     int
+	runs          int
+	trackHeap     bool
+	trackHeapPeak bool
+	trackDB       bool
+	trackCache    string
+	aggregate     string
+	noise         float64
+	metrics       string
+	apiVersion    string
+	backend       string
+	debounce      time.Duration
+}
+
+// newWatchCmd creates a watch command with g as its global options
+func newWatchCmd(g *globalOptions) *cobra.Command {
+	o := &watchOptions{global: g}
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Re-run a benchmark whenever its file changes",
+		Long: `Watch an Apex code file and re-run its benchmark on every save,
+comparing each result with the previous one. Press Ctrl+C to stop.`,
+		RunE: o.run,
+	}
+
+	cmd.Flags().StringVar(&o.file, "file", "", "Path to Apex code file to watch")
+	cmd.Flags().StringVar(&o.name, "name", "", "Benchmark name (default: the --file name without its extension, or "+defaultBenchName+")")
+	cmd.Flags().IntVar(&o.iterations, "iterations", 100, "Number of measurement iterations")
+	cmd.Flags().IntVar(&o.warmup, "warmup", 10, "Number of warmup iterations")
+	cmd.Flags().IntVar(&o.batchSize, "batch-size", 0, "Iterations timed together per sample (0 starts at 1 and doubles while batches read 0 ms)")
+	cmd.Flags().IntVar(&o.runs, "runs", 1, "Number of complete runs for aggregation")
+	cmd.Flags().BoolVar(&o.trackHeap, "track-heap", false, "Enable heap usage tracking")
+	cmd.Flags().BoolVar(&o.trackHeapPeak, "track-heap-peak", false, "Track the heap high-water mark during measurement and its share of the heap limit")
+	cmd.Flags().BoolVar(&o.trackDB, "track-db", false, "Enable DML/SOQL tracking")
+	cmd.Flags().StringVar(&o.trackCache, "track-cache", "", "Track keys and capacity used in this Platform Cache partition, e.g. local.Bench, or session:local.Bench for the session cache")
+	cmd.Flags().StringVar(&o.aggregate, "aggregate", "mean", "How runs are combined: mean, median, min, trimmed-mean")
+	cmd.Flags().Float64Var(&o.noise, "noise-threshold", 20, "Flag results whose run-to-run CPU variation exceeds this percentage")
+	cmd.Flags().StringVar(&o.metrics, "metrics", "cpu,heap,db", "Metric groups shown in table output: cpu, wall, heap, db")
+	cmd.Flags().StringVar(&o.apiVersion, "api-version", "", "Salesforce API version to execute with, e.g. 62.0 (default: org default)")
+	cmd.Flags().StringVar(&o.backend, "backend", executor.DefaultBackend, "Execution backend: "+strings.Join(executor.BackendNames(), ", "))
+	cmd.Flags().DurationVar(&o.debounce, "debounce", 300*time.Millisecond, "Wait this long after a change before re-running")
+
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func (o *watchOptions) run(cmd *cobra.Command, args []string) error {
+	g := o.global
+	exec, org, err := g.newExecutor(executorOptions{Backend: o.backend, Org: g.org})
+	if err != nil {
+		return err
+	}
+
+	spec := types.CodeSpec{
+		Name:          benchName(o.name, o.file, 0),
+		Iterations:    o.iterations,
+		Warmup:        o.warmup,
+		BatchSize:     o.batchSize,
+		TrackHeap:     o.trackHeap,
+		TrackHeapPeak: o.trackHeapPeak,
+		TrackDB:       o.trackDB,
+		TrackCache:    o.trackCache,
+		Namespace:     g.namespace,
+		Vars:          g.benchVars(nil),
+	}
+	config := types.BenchmarkConfig{
+		Runs:           o.runs,
+		Parallel:       g.parallel,
+		Timeout:        g.timeout,
+		Delay:          g.delay,
+		Jitter:         g.jitter,
+		Aggregate:      o.aggregate,
+		NoiseThreshold: o.noise,
+		Metrics:        o.metrics,
+		APIVersion:     o.apiVersion,
+	}
+
+	return g.watchBenchmarkWithExecutor(commandContext(cmd), exec, org, o.file, spec, config, o.debounce, g.stdout())
+}
+
+// watchBenchmarkWithExecutor is the testable core logic. It benchmarks the
+// code in path, then again after every change until ctx is done, writing
+// each result and its change from the previous one to w. Failed runs, such
+// as compile errors while editing, are reported and watching continues.
+func (g *globalOptions) watchBenchmarkWithExecutor(ctx context.Context, exec executor.Executor, org string, path string, spec types.CodeSpec, config types.BenchmarkConfig, debounce time.Duration, w io.Writer) error {
+	if _, err := stats.ParseStrategy(config.Aggregate); err != nil {
+		return err
+	}
+	metrics, err := reporter.ParseMetrics(config.Metrics)
+	if err != nil {
+		return err
+	}
+	if err := orchestrator.ValidateAPIVersion(config.APIVersion); err != nil {
+		return err
+	}
+
+	var previous *types.AggregatedResult
+	bench := func() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(g.stderr(), "Error: failed to read file %s: %v\n", path, err)
+			return
+		}
+		spec.UserCode = strings.TrimSpace(string(content))
+
+		current, err := g.newRunner(exec, org, config).Run(ctx, spec)
+		if err != nil {
+			fmt.Fprintf(g.stderr(), "Error: %v\n", err)
+			return
+		}
+
+		fmt.Fprintf(w, "\n[%s] %s\n", time.Now().Format("15:04:05"), path)
+		if previous == nil {
+			err = reporter.PrintTableWithMetrics(current, w, metrics)
+		} else {
+			before := *previous
+			before.Name += " (previous)"
+			err = reporter.PrintComparisonWithMetrics([]types.AggregatedResult{before, current}, w, metrics)
+			fmt.Fprintln(w, formatChange(*previous, current))
+		}
+		if err != nil {
+			fmt.Fprintf(g.stderr(), "Error: %v\n", err)
+		}
+		previous = &current
+	}
+
+	bench()
+	g.progressf("Watching %s for changes (Ctrl+C to stop)...\n", path)
+	return watchPath(ctx, path, debounce, bench)
+}
+
+// formatChange describes how the CPU time changed between two results
+func formatChange(previous, current types.AggregatedResult) string {
+	if previous.AvgCpuMs == 0 {
+		return fmt.Sprintf("Avg CPU: %.3f ms (was %.3f ms)", current.AvgCpuMs, previous.AvgCpuMs)
+	}
+	change := (current.AvgCpuMs - previous.AvgCpuMs) / previous.AvgCpuMs * 100
+	return fmt.Sprintf("Avg CPU: %.3f ms (was %.3f ms, %+.1f%%)", current.AvgCpuMs, previous.AvgCpuMs, change)
+}
+
+// watchPath calls onChange after path is written, once no further changes
+// arrived for debounce, until ctx is done. The directory is watched rather
+// than the file because many editors save by replacing the file.
+func watchPath(ctx context.Context, path string, debounce time.Duration, onChange func()) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(abs)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == abs && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				timer.Reset(debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("file watcher failed: %w", err)
+		case <-timer.C:
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes and reads
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls until cond holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchBenchmarkWithExecutor(t *testing.T) {
+	g := &globalOptions{}
+	path := filepath.Join(t.TempDir(), "algo.apex")
+	if err := os.WriteFile(path, []byte("Integer x = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := types.CodeSpec{Name: "Algo", Iterations: 10, Warmup: 1}
+	config := types.BenchmarkConfig{Runs: 1, Parallel: 1, Aggregate: "median", Metrics: "cpu"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &lockedBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- g.watchBenchmarkWithExecutor(ctx, &mockExecutor{}, "test-org", path, spec, config, 20*time.Millisecond, out)
+	}()
+
+	waitFor(t, "first result", func() bool { return strings.Contains(out.String(), "Algo") })
+
+	// Give the watcher time to start, then save a change
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("Integer x = 2;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "comparison", func() bool { return strings.Contains(out.String(), "Algo (previous)") })
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("watchBenchmarkWithExecutor() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop after cancel")
+	}
+	if !strings.Contains(out.String(), "Avg CPU:") {
+		t.Errorf("Expected CPU change summary, got:\n%s", out.String())
+	}
+}
+
+func TestWatchBenchmarkWithExecutor_InvalidAggregate(t *testing.T) {
+	g := &globalOptions{}
+	config := types.BenchmarkConfig{Aggregate: "mode", Metrics: "cpu"}
+	err := g.watchBenchmarkWithExecutor(context.Background(), &mockExecutor{}, "test-org", "algo.apex", types.CodeSpec{}, config, time.Millisecond, &bytes.Buffer{})
+	if err == nil {
+		t.Error("Expected error for invalid aggregation")
+	}
+}
+
+func TestFormatChange(t *testing.T) {
+	previous := types.AggregatedResult{AvgCpuMs: 2.0}
+	current := types.AggregatedResult{AvgCpuMs: 1.5}
+
+	got := formatChange(previous, current)
+	if got != "Avg CPU: 1.500 ms (was 2.000 ms, -25.0%)" {
+		t.Errorf("formatChange() = %q", got)
+	}
+}
@@ -0,0 +1,532 @@
+package bench
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/parser"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// Runner generates, executes, parses and aggregates benchmarks. It is the
+// library entry point for tools that embed apex-bench instead of running
+// the CLI.
+//
+// Execution settings are taken from Config: Runs, Parallel, Timeout, Delay,
+// Jitter, Combine, KeepGoing, MinSuccessful, CaptureDebug, DebugLogDir,
+// KeepLogs, Aggregate, NoiseThreshold, QueryPlan and APIVersion.
+// Measurement settings (Iterations, Warmup, ...) come from each CodeSpec;
+// use NewCodeSpec to apply them from Config.
+type Runner struct {
+	Executor executor.Executor
+	Org      string
+	Config   types.BenchmarkConfig
+
+	// Optional message sinks; nil discards the messages
+	Logf   func(format string, args ...interface{}) // Progress
+	Debugf func(format string, args ...interface{}) // Per-run details
+	Warnf  func(format string, args ...interface{}) // Problems that do not stop the run
+
+	// Fetches query plans with Config.QueryPlan; nil skips them
+	Explainer executor.QueryExplainer
+
+	// Masks secrets in saved logs, captured debug output and the errors of
+	// failed results; nil keeps them
+	Redactor *redact.Redactor
+
+	// Optional progress hooks, for progress displays and saving results as
+	// they come; nil skips them. Calls are never concurrent, and are made
+	// before Run or Compare returns.
+	OnRunComplete       func(RunEvent)       // After each execution of a script
+	OnBenchmarkComplete func(BenchmarkEvent) // After each benchmark, failed ones included
+
+	executed    bool                   // A script ran, so the next one pauses first with Config.Delay
+	invocations types.InvocationTiming // Every timed execution so far
+}
+
+// NewRunner creates a Runner executing against org with exec. A Runs or
+// Parallel of 0 means 1.
+func NewRunner(exec executor.Executor, org string, config types.BenchmarkConfig) *Runner {
+	if config.Runs < 1 {
+		config.Runs = 1
+	}
+	if config.Parallel < 1 {
+		config.Parallel = 1
+	}
+	return &Runner{Executor: exec, Org: org, Config: config}
+}
+
+// Run benchmarks one piece of code. When ctx is cancelled after some runs
+// finished, they are aggregated into a result marked Partial, returned with
+// the error.
+func (r *Runner) Run(ctx context.Context, spec types.CodeSpec) (types.AggregatedResult, error) {
+	if _, err := stats.ParseStrategy(r.Config.Aggregate); err != nil {
+		return types.AggregatedResult{}, err
+	}
+	aggregated, err := r.measure(ctx, spec, true)
+	r.benchmarkComplete(0, 1, spec, aggregated, err)
+	return aggregated, err
+}
+
+// Compare benchmarks several pieces of code, one script per benchmark or,
+// with Config.Combine, all of them in a single script per run. On failure
+// the results completed so far are returned with the error; with
+// Config.KeepGoing failed benchmarks are instead reported through the Error
+// of their result. When ctx is cancelled, a benchmark with finished runs is
+// included as a Partial result.
+func (r *Runner) Compare(ctx context.Context, specs []types.CodeSpec) ([]types.AggregatedResult, error) {
+	if _, err := stats.ParseStrategy(r.Config.Aggregate); err != nil {
+		return nil, err
+	}
+	if r.Config.Combine {
+		return r.runCombined(ctx, specs)
+	}
+	return r.runSeparately(ctx, specs)
+}
+
+// runSeparately generates and executes one script per benchmark. A failing
+// benchmark stops the comparison, returning the results completed so far,
+// unless Config.KeepGoing is set.
+func (r *Runner) runSeparately(ctx context.Context, specs []types.CodeSpec) ([]types.AggregatedResult, error) {
+	aggregatedResults := make([]types.AggregatedResult, 0, len(specs))
+
+	for i, spec := range specs {
+		r.logf("\n[%d/%d] Running benchmark: %s\n", i+1, len(specs), spec.Name)
+
+		aggregated, err := r.measure(ctx, spec, false)
+		r.benchmarkComplete(i, len(specs), spec, aggregated, err)
+		if err != nil {
+			if aggregated.Partial {
+				aggregatedResults = append(aggregatedResults, aggregated)
+			}
+			if !r.Config.KeepGoing || ctx.Err() != nil {
+				return aggregatedResults, err
+			}
+			r.warnf("%v", err)
+			aggregatedResults = append(aggregatedResults, r.failedResult(spec, err))
+			continue
+		}
+
+		aggregatedResults = append(aggregatedResults, aggregated)
+		r.logf("  Completed: avg CPU %.3f ms\n", aggregated.AvgCpuMs)
+	}
+
+	return aggregatedResults, nil
+}
+
+// measure generates, executes, parses and aggregates one benchmark. Run
+// measures it alone, logging each step; within a comparison the steps are
+// not logged and errors name the benchmark.
+func (r *Runner) measure(ctx context.Context, spec types.CodeSpec, alone bool) (types.AggregatedResult, error) {
+	logf, of := r.logf, ""
+	if !alone {
+		logf, of = func(string, ...interface{}) {}, " for "+spec.Name
+	}
+
+	// Generate
+	logf("Generating benchmark code...\n")
+	apexCode, sourceMap, err := generator.GenerateWithSourceMap(spec)
+	if err != nil {
+		return types.AggregatedResult{}, fmt.Errorf("failed to generate code%s: %w", of, err)
+	}
+
+	// Execute
+	if r.Config.Runs == 1 {
+		logf("Executing benchmark (1 run)...\n")
+	} else {
+		logf("Executing benchmark (%d runs, %d parallel)...\n", r.Config.Runs, r.Config.Parallel)
+	}
+	exec, err := r.execute(ctx, apexCode, []string{spec.Name})
+	if err != nil {
+		return types.AggregatedResult{}, fmt.Errorf("execution failed%s: %w", of, AnnotateCompileError(err, sourceMap))
+	}
+	outputs := exec.outputs
+
+	// Parse
+	logf("Parsing results...\n")
+	results, err := parser.ParseMultipleResults(outputs)
+	if err != nil {
+		return types.AggregatedResult{}, fmt.Errorf("failed to parse results%s: %w", of, err)
+	}
+	r.warnLimitInconsistencies(results)
+	exec.timing = r.invocationTiming(exec, apexTimes(results))
+
+	if r.capturesDebug() {
+		debugByRun := make([][]string, len(outputs))
+		for i, output := range outputs {
+			debugByRun[i] = flattenDebug(parser.ExtractUserDebug(output))
+		}
+		if err := r.captureUserDebug(results, debugByRun); err != nil {
+			return types.AggregatedResult{}, err
+		}
+	}
+
+	if r.Config.KeepLogs != "" {
+		if err := r.keepRunLogs(results, outputs); err != nil {
+			return types.AggregatedResult{}, err
+		}
+	}
+
+	// Aggregate
+	logf("Aggregating results...\n")
+	aggregated, err := r.aggregate(ctx, results, spec, exec)
+	if err != nil {
+		return types.AggregatedResult{}, fmt.Errorf("failed to aggregate results%s: %w", of, err)
+	}
+	if exec.partial {
+		if alone {
+			return aggregated, r.interrupted(ctx, exec)
+		}
+		return aggregated, fmt.Errorf("%s %w", spec.Name, r.interrupted(ctx, exec))
+	}
+	return aggregated, nil
+}
+
+// failedResult records a benchmark that failed under Config.KeepGoing
+func (r *Runner) failedResult(spec types.CodeSpec, err error) types.AggregatedResult {
+	return types.AggregatedResult{
+		SchemaVersion: types.SchemaVersion,
+		Name:          spec.Name,
+		Iterations:    spec.Iterations,
+		Warmup:        spec.Warmup,
+		Error:         r.Redactor.String(err.Error()),
+	}
+}
+
+// runCombined generates a single script containing every benchmark, which
+// saves one sf CLI round trip per benchmark and run. The benchmarks succeed
+// or fail together; with Config.KeepGoing a failure is recorded on each.
+func (r *Runner) runCombined(ctx context.Context, specs []types.CodeSpec) ([]types.AggregatedResult, error) {
+	r.logf("\nRunning %d benchmarks in a single script\n", len(specs))
+
+	aggregatedResults, err := r.measureCombined(ctx, specs)
+	for i, spec := range specs {
+		var aggregated types.AggregatedResult
+		if i < len(aggregatedResults) {
+			aggregated = aggregatedResults[i]
+		}
+		r.benchmarkComplete(i, len(specs), spec, aggregated, err)
+	}
+	if err != nil && r.Config.KeepGoing && ctx.Err() == nil {
+		r.warnf("%v", err)
+		aggregatedResults = make([]types.AggregatedResult, 0, len(specs))
+		for _, spec := range specs {
+			aggregatedResults = append(aggregatedResults, r.failedResult(spec, err))
+		}
+		return aggregatedResults, nil
+	}
+	return aggregatedResults, err
+}
+
+// measureCombined executes the combined script and aggregates each
+// benchmark's results
+func (r *Runner) measureCombined(ctx context.Context, specs []types.CodeSpec) ([]types.AggregatedResult, error) {
+	apexCode, sourceMap, err := generator.GenerateCombined(specs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate combined code: %w", err)
+	}
+
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.Name
+	}
+	exec, err := r.execute(ctx, apexCode, names)
+	if err != nil {
+		return nil, fmt.Errorf("execution failed: %w", AnnotateCompileError(err, sourceMap))
+	}
+	outputs := exec.outputs
+
+	// Collect each benchmark's result from every run
+	resultsByName := make(map[string][]types.Result, len(specs))
+	debugByName := make(map[string][][]string, len(specs))
+	apex := make([]float64, len(outputs)) // Of every benchmark in the run
+	for i, output := range outputs {
+		parsed, err := parser.ParseResultsByName(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse results of run %d: %w", i+1, err)
+		}
+		// Benchmarks run in order, so debug group j belongs to benchmark j
+		debugGroups := parser.ExtractUserDebug(output)
+		for j, spec := range specs {
+			result, ok := parsed[spec.Name]
+			if !ok {
+				return nil, fmt.Errorf("run %d produced no result for %s", i+1, spec.Name)
+			}
+			resultsByName[spec.Name] = append(resultsByName[spec.Name], result)
+			apex[i] += apexMs(result)
+
+			var debug []string
+			if j < len(debugGroups) {
+				debug = debugGroups[j]
+			}
+			debugByName[spec.Name] = append(debugByName[spec.Name], debug)
+		}
+	}
+
+	exec.timing = r.invocationTiming(exec, apex)
+
+	aggregatedResults := make([]types.AggregatedResult, 0, len(specs))
+	for _, spec := range specs {
+		r.warnLimitInconsistencies(resultsByName[spec.Name])
+
+		if r.capturesDebug() {
+			if err := r.captureUserDebug(resultsByName[spec.Name], debugByName[spec.Name]); err != nil {
+				return nil, err
+			}
+		}
+
+		// Every benchmark shares the run's log, so each gets its own copy
+		if r.Config.KeepLogs != "" {
+			if err := r.keepRunLogs(resultsByName[spec.Name], outputs); err != nil {
+				return nil, err
+			}
+		}
+
+		aggregated, err := r.aggregate(ctx, resultsByName[spec.Name], spec, exec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate results for %s: %w", spec.Name, err)
+		}
+
+		aggregatedResults = append(aggregatedResults, aggregated)
+		r.logf("  %s: avg CPU %.3f ms\n", spec.Name, aggregated.AvgCpuMs)
+	}
+
+	if exec.partial {
+		return aggregatedResults, r.interrupted(ctx, exec)
+	}
+	return aggregatedResults, nil
+}
+
+// execution is the outcome of running a script Config.Runs times
+type execution struct {
+	outputs   []string                // Debug log of each run used
+	durations []time.Duration         // Wall time of each run used, indexed like outputs
+	failed    int                     // Runs that failed and were left out
+	partial   bool                    // Interrupted before every run finished
+	paused    []time.Duration         // Pauses taken before executions, with Config.Delay
+	timing    *types.InvocationTiming // Executions against their Apex time
+}
+
+// execute runs the script of the benchmarks names once directly or
+// Config.Runs times in parallel and returns the debug log of each run. When
+// some parallel runs fail and at least Config.MinSuccessful succeeded, or
+// ctx is cancelled after some runs completed, the successful runs are
+// returned.
+func (r *Runner) execute(ctx context.Context, apexCode string, names []string) (execution, error) {
+	req := executor.ExecRequest{
+		Code:       apexCode,
+		Org:        r.Org,
+		Timeout:    r.Config.Timeout,
+		APIVersion: r.Config.APIVersion,
+		Priority:   r.Config.Priority,
+		Delay:      r.Config.Delay,
+		Jitter:     r.Config.Jitter,
+	}
+	runs, parallel := r.Config.Runs, r.Config.Parallel
+
+	var results []executor.ExecResult
+	var exec execution
+
+	// Scripts after the first pause like the runs within one
+	if r.executed && r.Config.Delay > 0 {
+		paused, err := executor.Pause(ctx, r.Config.Delay, r.Config.Jitter)
+		if err != nil {
+			return execution{}, err
+		}
+		exec.paused = append(exec.paused, paused)
+	}
+	r.executed = true
+	exe := r.observed(names)
+	if runs <= 1 {
+		result, err := executor.Schedule(ctx, exe.Run, req)
+		if err != nil {
+			return execution{}, err
+		}
+		results = []executor.ExecResult{result}
+	} else {
+		var err error
+		results, err = exe.ExecuteParallel(ctx, req, runs, parallel)
+		if err != nil {
+			var runErrs *executor.RunErrors
+			switch {
+			case !errors.As(err, &runErrs):
+				return execution{}, err
+			case ctx.Err() != nil && len(runErrs.Succeeded) > 0:
+				results, exec.partial = runErrs.Succeeded, true
+			case ctx.Err() != nil || r.Config.MinSuccessful == 0:
+				return execution{}, err
+			case len(runErrs.Succeeded) < r.Config.MinSuccessful:
+				return execution{}, fmt.Errorf("only %d of %d runs succeeded, need %d: %w", len(runErrs.Succeeded), runs, r.Config.MinSuccessful, err)
+			default:
+				results, exec.failed = runErrs.Succeeded, len(runErrs.Failed)
+				r.warnf("%d of %d runs failed, aggregating the %d that succeeded: %v", exec.failed, runs, len(results), err)
+			}
+		}
+	}
+
+	exec.outputs = make([]string, len(results))
+	exec.durations = make([]time.Duration, len(results))
+	for i, result := range results {
+		exec.outputs[i] = result.Logs
+		exec.durations[i] = result.Duration
+		if result.Paused > 0 {
+			exec.paused = append(exec.paused, result.Paused)
+		}
+	}
+	return exec, nil
+}
+
+// interrupted is the error returned with results of an interrupted execution
+func (r *Runner) interrupted(ctx context.Context, exec execution) error {
+	return fmt.Errorf("interrupted after %d of %d runs: %w", len(exec.outputs), r.Config.Runs, ctx.Err())
+}
+
+// aggregate combines the runs of one benchmark, flags noisy results and,
+// with Config.QueryPlan, attaches the plans of its queries
+func (r *Runner) aggregate(ctx context.Context, results []types.Result, spec types.CodeSpec, exec execution) (types.AggregatedResult, error) {
+	aggregated, err := stats.AggregateWith(results, stats.Strategy(r.Config.Aggregate))
+	if err != nil {
+		return types.AggregatedResult{}, err
+	}
+	aggregated.FailedRuns = exec.failed
+	aggregated.Partial = exec.partial
+	aggregated.Warmup = spec.Warmup
+	aggregated.APIVersion = r.Config.APIVersion
+	aggregated.Namespace = spec.Namespace
+	stats.FlagNoisy(&aggregated, r.Config.NoiseThreshold/100)
+	stats.FlagWaitBound(&aggregated)
+	aggregated.Pacing = r.pacing(exec)
+	aggregated.Invocations = exec.timing
+	if r.Config.QueryPlan && !exec.partial {
+		aggregated.QueryPlans = r.explainQueries(ctx, spec)
+	}
+	return aggregated, nil
+}
+
+// pacing summarizes the pauses of exec, or returns nil without a delay
+func (r *Runner) pacing(exec execution) *types.Pacing {
+	if r.Config.Delay <= 0 {
+		return nil
+	}
+	p := &types.Pacing{
+		DelayMs:  float64(r.Config.Delay) / float64(time.Millisecond),
+		JitterMs: float64(r.Config.Jitter) / float64(time.Millisecond),
+		Pauses:   len(exec.paused),
+	}
+	var total time.Duration
+	for _, paused := range exec.paused {
+		total += paused
+	}
+	if p.Pauses > 0 {
+		p.AvgPauseMs = float64(total) / float64(p.Pauses) / float64(time.Millisecond)
+	}
+	return p
+}
+
+// warnLimitInconsistencies reports results whose self-reported numbers
+// disagree with the transaction's CUMULATIVE_LIMIT_USAGE
+func (r *Runner) warnLimitInconsistencies(results []types.Result) {
+	for i, result := range results {
+		for _, problem := range parser.CheckLimitUsage(result) {
+			r.warnf("%s run %d: %s", result.Name, i+1, problem)
+		}
+	}
+}
+
+func (r *Runner) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+func (r *Runner) debugf(format string, args ...interface{}) {
+	if r.Debugf != nil {
+		r.Debugf(format, args...)
+	}
+}
+
+func (r *Runner) warnf(format string, args ...interface{}) {
+	if r.Warnf != nil {
+		r.Warnf(format, args...)
+	}
+}
+
+// NewCodeSpec reads a benchmark's code with ReadCode and applies the shared
+// measurement settings from config
+func NewCodeSpec(benchSpec types.BenchmarkSpec, config types.BenchmarkConfig) (types.CodeSpec, error) {
+	userCode, err := ReadCode(benchSpec)
+	if err != nil {
+		return types.CodeSpec{}, err
+	}
+
+	return types.CodeSpec{
+		Name:          benchSpec.Name,
+		UserCode:      strings.TrimSpace(userCode),
+		Setup:         benchSpec.Setup,
+		Teardown:      benchSpec.Teardown,
+		Iterations:    config.Iterations,
+		Warmup:        config.Warmup,
+		BatchSize:     config.BatchSize,
+		TrackHeap:     config.TrackHeap,
+		TrackHeapPeak: config.TrackHeapPeak,
+		TrackDB:       config.TrackDB,
+		TrackCache:    config.TrackCache,
+		Namespace:     config.Namespace,
+		Vars:          config.Vars,
+		Collectors:    config.Collectors,
+	}, nil
+}
+
+// CacheKey identifies a measurement of spec against org with config, for
+// serving unchanged benchmarks from earlier results: the generated script
+// and every setting that changes how its runs are executed and aggregated.
+func CacheKey(spec types.CodeSpec, org string, config types.BenchmarkConfig) (string, error) {
+	scriptHash, err := generator.ScriptHash(spec)
+	if err != nil {
+		return "", err
+	}
+	key := strings.Join([]string{
+		scriptHash,
+		org,
+		config.APIVersion,
+		strconv.Itoa(max(config.Runs, 1)),
+		strconv.Itoa(config.MinSuccessful),
+		config.Aggregate,
+		strconv.FormatFloat(config.NoiseThreshold, 'g', -1, 64),
+		strconv.FormatBool(config.Combine),
+		strconv.FormatBool(config.QueryPlan),
+		strconv.FormatBool(config.CaptureDebug),
+	}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AnnotateCompileError appends the offending user code line to Apex compile
+// errors, since reported positions refer to the generated script
+func AnnotateCompileError(err error, sourceMap *generator.SourceMap) error {
+	var compileErr *executor.CompileError
+	if !errors.As(err, &compileErr) {
+		return err
+	}
+
+	pos, ok := sourceMap.Lookup(compileErr.Line, compileErr.Column)
+	if !ok {
+		return err
+	}
+
+	excerpt := strings.TrimRight(generator.FormatPosition(pos), "\n")
+	if pos.Benchmark != "" {
+		excerpt = pos.Benchmark + ": " + excerpt
+	}
+	return fmt.Errorf("%w\n\n%s", err, excerpt)
+}
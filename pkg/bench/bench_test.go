@@ -0,0 +1,315 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// failingExecutor fails every execution with err
+type failingExecutor struct {
+	err error
+}
+
+func (e failingExecutor) Run(ctx context.Context, req executor.ExecRequest) (executor.ExecResult, error) {
+	return executor.ExecResult{}, e.err
+}
+
+func (e failingExecutor) ExecuteParallel(ctx context.Context, req executor.ExecRequest, runs int, maxConcurrent int) ([]executor.ExecResult, error) {
+	return nil, e.err
+}
+
+// codeFailingExecutor fails executions of scripts containing marker
+type codeFailingExecutor struct {
+	executor.Executor
+	marker string
+}
+
+func (e codeFailingExecutor) Run(ctx context.Context, req executor.ExecRequest) (executor.ExecResult, error) {
+	if strings.Contains(req.Code, e.marker) {
+		return executor.ExecResult{}, errors.New("compile error")
+	}
+	return e.Executor.Run(ctx, req)
+}
+
+func TestRunner_Run(t *testing.T) {
+	runner := NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{Runs: 3, Parallel: 2, Aggregate: "median", APIVersion: "62.0"})
+	var progress []string
+	runner.Logf = func(format string, args ...interface{}) { progress = append(progress, format) }
+
+	spec := types.CodeSpec{Name: "Concat", UserCode: "String s = 'a' + 'b';", Iterations: 50, Warmup: 5, Namespace: "acme"}
+	result, err := runner.Run(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if result.Name != "Concat" || result.Runs != 3 || result.Warmup != 5 || result.APIVersion != "62.0" || result.Namespace != "acme" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.AvgCpuMs <= 0 {
+		t.Errorf("Expected positive CPU time, got %v", result.AvgCpuMs)
+	}
+	if len(progress) == 0 {
+		t.Error("Expected progress messages")
+	}
+}
+
+func TestRunner_Compare(t *testing.T) {
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "Integer a = 1;", Iterations: 10},
+		{Name: "B", UserCode: "Integer b = 2;", Iterations: 10},
+	}
+
+	for _, combine := range []bool{false, true} {
+		runner := NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{Runs: 2, Combine: combine})
+		results, err := runner.Compare(context.Background(), specs)
+		if err != nil {
+			t.Fatalf("Compare(combine=%v) error = %v", combine, err)
+		}
+		if len(results) != 2 || results[0].Name != "A" || results[1].Name != "B" {
+			t.Errorf("Compare(combine=%v) = %+v", combine, results)
+		}
+	}
+}
+
+func TestRunner_Delay(t *testing.T) {
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "Integer a = 1;", Iterations: 10},
+		{Name: "B", UserCode: "Integer b = 2;", Iterations: 10},
+	}
+	config := types.BenchmarkConfig{Runs: 3, Parallel: 1, Delay: 5 * time.Millisecond, Jitter: time.Millisecond}
+	results, err := NewRunner(executor.NewSimulatedExecutor(), "", config).Compare(context.Background(), specs)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	// Runs pause between each other, and the second benchmark before its first run
+	for i, want := range []int{2, 3} {
+		p := results[i].Pacing
+		if p == nil || p.Pauses != want || p.DelayMs != 5 || p.JitterMs != 1 {
+			t.Fatalf("%s: expected %d pauses of 5ms, got %+v", results[i].Name, want, p)
+		}
+		if p.AvgPauseMs < 4 || p.AvgPauseMs > 6 {
+			t.Errorf("%s: expected pauses within the jitter, got %vms", results[i].Name, p.AvgPauseMs)
+		}
+	}
+
+	results, err = NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{Runs: 2}).Compare(context.Background(), specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Pacing != nil {
+		t.Errorf("Expected no pacing without a delay, got %+v", results[0].Pacing)
+	}
+}
+
+func TestRunner_InvalidAggregate(t *testing.T) {
+	runner := NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{Aggregate: "mode"})
+	if _, err := runner.Run(context.Background(), types.CodeSpec{Name: "A", UserCode: "Integer a = 1;"}); err == nil {
+		t.Error("Expected error for unknown aggregation")
+	}
+}
+
+func TestRunner_ExecutionError(t *testing.T) {
+	runner := NewRunner(failingExecutor{err: errors.New("boom")}, "test-org", types.BenchmarkConfig{})
+	_, err := runner.Run(context.Background(), types.CodeSpec{Name: "A", UserCode: "Integer a = 1;", Iterations: 1})
+	if err == nil || !strings.Contains(err.Error(), "execution failed: boom") {
+		t.Errorf("Run() error = %v, want execution failure", err)
+	}
+}
+
+func TestRunner_CompareFailure(t *testing.T) {
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "Integer a = 1;", Iterations: 10},
+		{Name: "B", UserCode: "Integer b = ;", Iterations: 10},
+		{Name: "C", UserCode: "Integer c = 3;", Iterations: 10},
+	}
+	exec := codeFailingExecutor{Executor: executor.NewSimulatedExecutor(), marker: "Integer b = ;"}
+
+	// Stops at the failure, keeping the completed results
+	results, err := NewRunner(exec, "", types.BenchmarkConfig{}).Compare(context.Background(), specs)
+	if err == nil || !strings.Contains(err.Error(), "execution failed for B") {
+		t.Errorf("Compare() error = %v, want failure of B", err)
+	}
+	if len(results) != 1 || results[0].Name != "A" {
+		t.Errorf("Expected the result of A, got %+v", results)
+	}
+
+	// Keeps going, recording the failure
+	results, err = NewRunner(exec, "", types.BenchmarkConfig{KeepGoing: true}).Compare(context.Background(), specs)
+	if err != nil {
+		t.Fatalf("Compare(keep-going) error = %v", err)
+	}
+	if len(results) != 3 || results[1].Error == "" || results[0].Error != "" || results[2].Error != "" {
+		t.Errorf("Expected only B to fail, got %+v", results)
+	}
+
+	// Combined benchmarks fail together
+	results, err = NewRunner(exec, "", types.BenchmarkConfig{KeepGoing: true, Combine: true}).Compare(context.Background(), specs)
+	if err != nil {
+		t.Fatalf("Compare(combined keep-going) error = %v", err)
+	}
+	for _, result := range results {
+		if result.Error == "" {
+			t.Errorf("Expected %s to record the combined failure", result.Name)
+		}
+	}
+}
+
+// flakyExecutor fails the given number of runs of every ExecuteParallel
+type flakyExecutor struct {
+	executor.Executor
+	failures int
+}
+
+func (e flakyExecutor) ExecuteParallel(ctx context.Context, req executor.ExecRequest, runs int, maxConcurrent int) ([]executor.ExecResult, error) {
+	results, err := e.Executor.ExecuteParallel(ctx, req, runs, maxConcurrent)
+	if err != nil {
+		return nil, err
+	}
+	runErrs := &executor.RunErrors{Succeeded: results[e.failures:]}
+	for i := 0; i < e.failures; i++ {
+		runErrs.Failed = append(runErrs.Failed, i+1)
+		runErrs.Errs = append(runErrs.Errs, errors.New("request timed out"))
+	}
+	return nil, runErrs
+}
+
+func TestRunner_MinSuccessfulRuns(t *testing.T) {
+	exec := flakyExecutor{Executor: executor.NewSimulatedExecutor(), failures: 2}
+	spec := types.CodeSpec{Name: "A", UserCode: "Integer a = 1;", Iterations: 10}
+
+	// All runs are required by default
+	if _, err := NewRunner(exec, "", types.BenchmarkConfig{Runs: 5}).Run(context.Background(), spec); err == nil {
+		t.Error("Expected error when runs fail")
+	}
+
+	// Enough runs succeeded
+	runner := NewRunner(exec, "", types.BenchmarkConfig{Runs: 5, MinSuccessful: 3})
+	var warnings []string
+	runner.Warnf = func(format string, args ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+	result, err := runner.Run(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Runs != 3 || result.FailedRuns != 2 {
+		t.Errorf("Expected 3 runs aggregated and 2 failed, got %d and %d", result.Runs, result.FailedRuns)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "2 of 5 runs failed") {
+		t.Errorf("Expected a warning about the failed runs, got %v", warnings)
+	}
+
+	// Too few runs succeeded
+	_, err = NewRunner(exec, "", types.BenchmarkConfig{Runs: 5, MinSuccessful: 4}).Run(context.Background(), spec)
+	if err == nil || !strings.Contains(err.Error(), "only 3 of 5 runs succeeded, need 4") {
+		t.Errorf("Run() error = %v, want too few successful runs", err)
+	}
+}
+
+// interruptingExecutor completes some runs of every ExecuteParallel, then
+// cancels the context as Ctrl+C would
+type interruptingExecutor struct {
+	executor.Executor
+	completed int
+	cancel    context.CancelFunc
+}
+
+func (e interruptingExecutor) ExecuteParallel(ctx context.Context, req executor.ExecRequest, runs int, maxConcurrent int) ([]executor.ExecResult, error) {
+	results, err := e.Executor.ExecuteParallel(ctx, req, e.completed, maxConcurrent)
+	if err != nil {
+		return nil, err
+	}
+	e.cancel()
+	runErrs := &executor.RunErrors{Succeeded: results}
+	for i := e.completed; i < runs; i++ {
+		runErrs.Failed = append(runErrs.Failed, i+1)
+		runErrs.Errs = append(runErrs.Errs, ctx.Err())
+	}
+	return nil, runErrs
+}
+
+func TestRunner_Interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := interruptingExecutor{Executor: executor.NewSimulatedExecutor(), completed: 2, cancel: cancel}
+	runner := NewRunner(exec, "", types.BenchmarkConfig{Runs: 5})
+
+	result, err := runner.Run(ctx, types.CodeSpec{Name: "A", UserCode: "Integer a = 1;", Iterations: 10})
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "interrupted after 2 of 5 runs") {
+		t.Errorf("Run() error = %v, want interruption", err)
+	}
+	if !result.Partial || result.Runs != 2 || result.FailedRuns != 0 {
+		t.Errorf("Expected a partial result of 2 runs, got %+v", result)
+	}
+}
+
+func TestRunner_CompareInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "Integer a = 1;", Iterations: 10},
+		{Name: "B", UserCode: "Integer b = 2;", Iterations: 10},
+	}
+	exec := interruptingExecutor{Executor: executor.NewSimulatedExecutor(), completed: 1, cancel: cancel}
+
+	// Keeping going does not outlast an interruption
+	results, err := NewRunner(exec, "", types.BenchmarkConfig{Runs: 3, KeepGoing: true}).Compare(ctx, specs)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Compare() error = %v, want interruption", err)
+	}
+	if len(results) != 1 || results[0].Name != "A" || !results[0].Partial {
+		t.Errorf("Expected a partial result for A only, got %+v", results)
+	}
+}
+
+func TestNewCodeSpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.apex")
+	if err := os.WriteFile(path, []byte("  Integer a = 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := types.BenchmarkConfig{Iterations: 20, Warmup: 2, BatchSize: 5, TrackHeap: true}
+
+	spec, err := NewCodeSpec(types.BenchmarkSpec{Name: "A", File: path, Setup: "Integer s = 0;"}, config)
+	if err != nil {
+		t.Fatalf("NewCodeSpec() error = %v", err)
+	}
+	if spec.UserCode != "Integer a = 1;" || spec.Setup != "Integer s = 0;" || spec.Iterations != 20 || spec.BatchSize != 5 || !spec.TrackHeap {
+		t.Errorf("Unexpected spec: %+v", spec)
+	}
+
+	if _, err := NewCodeSpec(types.BenchmarkSpec{Name: "B", File: filepath.Join(t.TempDir(), "missing.apex")}, config); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	spec := types.CodeSpec{Name: "A", UserCode: "Integer a = 1;", Iterations: 10}
+	config := types.BenchmarkConfig{Runs: 3, Aggregate: "median"}
+
+	key, err := CacheKey(spec, "dev", config)
+	if err != nil {
+		t.Fatalf("CacheKey() error = %v", err)
+	}
+	if again, _ := CacheKey(spec, "dev", config); again != key {
+		t.Errorf("Expected a stable key, got %q and %q", key, again)
+	}
+
+	otherOrg, _ := CacheKey(spec, "prod", config)
+	config.Runs = 5
+	otherRuns, _ := CacheKey(spec, "dev", config)
+	spec.Iterations = 20
+	otherSpec, _ := CacheKey(spec, "dev", types.BenchmarkConfig{Runs: 3, Aggregate: "median"})
+	for _, other := range []string{otherOrg, otherRuns, otherSpec} {
+		if other == key {
+			t.Errorf("Expected a different key when the org, settings or code change")
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bench
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// RunEvent reports one finished execution of a benchmark script, for
+// following progress within a benchmark
+type RunEvent struct {
+	Benchmarks []string      // Benchmarks in the script; several with Config.Combine
+	Run        int           // Executions of the script finished so far, from 1
+	Runs       int           // Executions planned, Config.Runs
+	Duration   time.Duration // Time the execution took
+	Err        error         // Why the execution failed, or nil
+}
+
+// BenchmarkEvent reports a benchmark that ended, with its result or the
+// error that ended it
+type BenchmarkEvent struct {
+	Index  int // Position among the benchmarks of the call, from 0
+	Total  int // Benchmarks of the call
+	Result types.AggregatedResult
+	Err    error // Non-nil when the benchmark failed or was interrupted; Result then holds its partial result or only its name and error
+}
+
+// observed returns the executor to run a script of the benchmarks names
+// with: Executor itself, or a wrapper reporting each execution to
+// OnRunComplete
+func (r *Runner) observed(names []string) executor.Executor {
+	if r.OnRunComplete == nil {
+		return r.Executor
+	}
+	var mu sync.Mutex
+	finished := 0
+	return executor.NewObservingExecutor(r.Executor, func(result executor.ExecResult, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		finished++
+		r.OnRunComplete(RunEvent{Benchmarks: names, Run: finished, Runs: r.Config.Runs, Duration: result.Duration, Err: err})
+	})
+}
+
+// benchmarkComplete reports the end of benchmark index of total to
+// OnBenchmarkComplete. Without a result, one is made from spec and err.
+func (r *Runner) benchmarkComplete(index, total int, spec types.CodeSpec, result types.AggregatedResult, err error) {
+	if r.OnBenchmarkComplete == nil {
+		return
+	}
+	if result.Name == "" && err != nil {
+		result = r.failedResult(spec, err)
+	}
+	r.OnBenchmarkComplete(BenchmarkEvent{Index: index, Total: total, Result: result, Err: err})
+}
@@ -0,0 +1,82 @@
+package bench
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestRunner_Events(t *testing.T) {
+	exec := codeFailingExecutor{Executor: executor.NewSimulatedExecutor(), marker: "FAIL"}
+	specs := []types.CodeSpec{
+		{Name: "Good", UserCode: "String s = 'a';", Iterations: 10},
+		{Name: "Bad", UserCode: "String s = 'FAIL';", Iterations: 10},
+	}
+
+	runner := NewRunner(exec, "", types.BenchmarkConfig{Runs: 3, Parallel: 2, KeepGoing: true})
+	var runs []RunEvent
+	var benchmarks []BenchmarkEvent
+	runner.OnRunComplete = func(e RunEvent) { runs = append(runs, e) }
+	runner.OnBenchmarkComplete = func(e BenchmarkEvent) { benchmarks = append(benchmarks, e) }
+
+	if _, err := runner.Compare(context.Background(), specs); err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	if len(runs) != 6 {
+		t.Fatalf("Expected 6 run events, got %d", len(runs))
+	}
+	for i, e := range runs[:3] {
+		if e.Benchmarks[0] != "Good" || e.Run != i+1 || e.Runs != 3 || e.Err != nil {
+			t.Errorf("Unexpected run event %d: %+v", i, e)
+		}
+	}
+	if runs[3].Benchmarks[0] != "Bad" || runs[3].Err == nil {
+		t.Errorf("Expected a failed run of Bad, got %+v", runs[3])
+	}
+
+	if len(benchmarks) != 2 {
+		t.Fatalf("Expected 2 benchmark events, got %d", len(benchmarks))
+	}
+	if e := benchmarks[0]; e.Index != 0 || e.Total != 2 || e.Result.Name != "Good" || e.Result.Runs != 3 || e.Err != nil {
+		t.Errorf("Unexpected event for Good: %+v", e)
+	}
+	if e := benchmarks[1]; e.Index != 1 || e.Result.Name != "Bad" || e.Result.Error == "" || e.Err == nil {
+		t.Errorf("Unexpected event for Bad: %+v", e)
+	}
+}
+
+func TestRunner_EventsCombined(t *testing.T) {
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "String s = 'a';", Iterations: 10},
+		{Name: "B", UserCode: "String s = 'b';", Iterations: 10},
+	}
+
+	runner := NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{Runs: 2, Combine: true})
+	var runs []RunEvent
+	var names []string
+	runner.OnRunComplete = func(e RunEvent) { runs = append(runs, e) }
+	runner.OnBenchmarkComplete = func(e BenchmarkEvent) { names = append(names, e.Result.Name) }
+
+	if _, err := runner.Compare(context.Background(), specs); err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if len(runs) != 2 || len(runs[0].Benchmarks) != 2 {
+		t.Errorf("Expected 2 runs of the combined script, got %+v", runs)
+	}
+	if len(names) != 2 || names[0] != "A" || names[1] != "B" {
+		t.Errorf("Expected events for A and B, got %v", names)
+	}
+
+	var single []BenchmarkEvent
+	runner = NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{})
+	runner.OnBenchmarkComplete = func(e BenchmarkEvent) { single = append(single, e) }
+	if _, err := runner.Run(context.Background(), specs[0]); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(single) != 1 || single[0].Total != 1 || single[0].Result.Name != "A" {
+		t.Errorf("Expected one event from Run, got %+v", single)
+	}
+}
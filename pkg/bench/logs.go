@@ -0,0 +1,108 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// capturesDebug reports whether user System.debug output should be kept
+func (r *Runner) capturesDebug() bool {
+	return r.Config.CaptureDebug || r.Config.DebugLogDir != ""
+}
+
+// flattenDebug merges the debug message groups of one log
+func flattenDebug(groups [][]string) []string {
+	var messages []string
+	for _, group := range groups {
+		messages = append(messages, group...)
+	}
+	return messages
+}
+
+// captureUserDebug attaches each run's debug messages to its result.
+// debugByRun is indexed like results. When Config.DebugLogDir is set, the
+// messages of run N are also written to <dir>/<benchmark>/run-N.debug.log.
+func (r *Runner) captureUserDebug(results []types.Result, debugByRun [][]string) error {
+	dir := r.Config.DebugLogDir
+	total := 0
+	for i := range results {
+		if i < len(debugByRun) {
+			results[i].DebugOutput = debugByRun[i]
+			r.Redactor.Strings(results[i].DebugOutput)
+			total += len(debugByRun[i])
+		}
+	}
+
+	if dir == "" || len(results) == 0 {
+		r.logf("  Captured %d debug messages\n", total)
+		return nil
+	}
+
+	benchDir := filepath.Join(dir, safeFileName(results[0].Name))
+	if err := os.MkdirAll(benchDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create debug log directory: %w", err)
+	}
+
+	for i, result := range results {
+		path := filepath.Join(benchDir, fmt.Sprintf("run-%d.debug.log", i+1))
+		content := strings.Join(result.DebugOutput, "\n")
+		if content != "" {
+			content += "\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return fmt.Errorf("failed to write debug log %s: %w", path, err)
+		}
+	}
+
+	r.logf("  Captured %d debug messages in %s\n", total, benchDir)
+	return nil
+}
+
+// keepRunLogs writes each run's full log to <Config.KeepLogs>/<benchmark>/run-N.log
+// and records the path on the run's result. outputs is indexed like results.
+func (r *Runner) keepRunLogs(results []types.Result, outputs []string) error {
+	dir := r.Config.KeepLogs
+	if len(results) == 0 {
+		return nil
+	}
+
+	benchDir := filepath.Join(dir, safeFileName(results[0].Name))
+	if err := os.MkdirAll(benchDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	for i := range results {
+		if i >= len(outputs) {
+			break
+		}
+		path := filepath.Join(benchDir, fmt.Sprintf("run-%d.log", i+1))
+		if err := os.WriteFile(path, []byte(r.Redactor.String(outputs[i])), 0o644); err != nil {
+			return fmt.Errorf("failed to write log %s: %w", path, err)
+		}
+		results[i].LogFile = path
+	}
+
+	r.logf("  Saved %d run logs in %s\n", len(results), benchDir)
+	return nil
+}
+
+// safeFileName replaces characters that are unsafe in file names so a
+// benchmark name can be used as a directory name
+func safeFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if strings.Trim(safe, ".") == "" {
+		return "benchmark"
+	}
+	return safe
+}
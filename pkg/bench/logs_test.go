@@ -0,0 +1,107 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestSafeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Simple", "Simple"},
+		{"Map: keyed by Id", "Map__keyed_by_Id"},
+		{"../escape", ".._escape"},
+		{"..", "benchmark"},
+		{"", "benchmark"},
+	}
+
+	for _, tt := range tests {
+		if got := safeFileName(tt.name); got != tt.want {
+			t.Errorf("safeFileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCaptureUserDebug_WritesFiles(t *testing.T) {
+	dir := t.TempDir()
+	results := []types.Result{{Name: "My Bench"}, {Name: "My Bench"}}
+	debugByRun := [][]string{{"one", "two"}, nil}
+
+	r := &Runner{Config: types.BenchmarkConfig{DebugLogDir: dir}}
+	if err := r.captureUserDebug(results, debugByRun); err != nil {
+		t.Fatalf("captureUserDebug failed: %v", err)
+	}
+
+	if len(results[0].DebugOutput) != 2 {
+		t.Errorf("Expected debug output attached to first result, got %q", results[0].DebugOutput)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "My_Bench", "run-1.debug.log"))
+	if err != nil {
+		t.Fatalf("Expected run-1 debug log: %v", err)
+	}
+	if string(content) != "one\ntwo\n" {
+		t.Errorf("Unexpected run-1 debug log: %q", content)
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, "My_Bench", "run-2.debug.log"))
+	if err != nil {
+		t.Fatalf("Expected run-2 debug log: %v", err)
+	}
+	if len(content) != 0 {
+		t.Errorf("Expected empty run-2 debug log, got %q", content)
+	}
+}
+
+func TestKeepRunLogs(t *testing.T) {
+	dir := t.TempDir()
+	results := []types.Result{{Name: "Bench"}, {Name: "Bench"}}
+	outputs := []string{"log of run 1", "log of run 2"}
+
+	r := &Runner{Config: types.BenchmarkConfig{KeepLogs: dir}}
+	if err := r.keepRunLogs(results, outputs); err != nil {
+		t.Fatalf("keepRunLogs failed: %v", err)
+	}
+
+	for i, result := range results {
+		want := filepath.Join(dir, "Bench", fmt.Sprintf("run-%d.log", i+1))
+		if result.LogFile != want {
+			t.Errorf("Result %d: expected log path %s, got %s", i, want, result.LogFile)
+		}
+		content, err := os.ReadFile(want)
+		if err != nil {
+			t.Fatalf("Expected log file %s: %v", want, err)
+		}
+		if string(content) != outputs[i] {
+			t.Errorf("Result %d: expected log %q, got %q", i, outputs[i], content)
+		}
+	}
+}
+
+func TestKeepRunLogs_Redacted(t *testing.T) {
+	dir := t.TempDir()
+	results := []types.Result{{Name: "Bench"}}
+	redactor, err := redact.New(nil, []string{"00Dxx0000001gPL!AQ4AQ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runner{Config: types.BenchmarkConfig{KeepLogs: dir}, Redactor: redactor}
+	if err := r.keepRunLogs(results, []string{"USER_DEBUG|token=00Dxx0000001gPL!AQ4AQ"}); err != nil {
+		t.Fatalf("keepRunLogs failed: %v", err)
+	}
+	content, err := os.ReadFile(results[0].LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "USER_DEBUG|token="+redact.Mask {
+		t.Errorf("Expected the token to be masked, got %q", content)
+	}
+}
@@ -0,0 +1,127 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// IsMarkdown reports whether path names a Markdown file, whose apex code
+// fences are benchmarked instead of the whole file
+func IsMarkdown(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// ReadCode returns the code of a benchmark: its inline code, or the content
+// of its file. For a Markdown file, the code is the apex code fence
+// numbered by Fence, or the only one when Fence is 0.
+func ReadCode(benchSpec types.BenchmarkSpec) (string, error) {
+	if benchSpec.File == "" {
+		return benchSpec.Code, nil
+	}
+	content, err := os.ReadFile(benchSpec.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", benchSpec.File, err)
+	}
+	if !IsMarkdown(benchSpec.File) {
+		return string(content), nil
+	}
+	code, err := ExtractFence(string(content), benchSpec.Fence)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", benchSpec.File, err)
+	}
+	return code, nil
+}
+
+// ExtractFence returns the code of the n-th apex code fence of a Markdown
+// document, counting from 1 and skipping fences of other languages. With n
+// 0, the document must have exactly one apex fence.
+func ExtractFence(markdown string, n int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("fence numbers start at 1, got %d", n)
+	}
+	fences := apexFences(markdown)
+	switch {
+	case len(fences) == 0:
+		return "", fmt.Errorf("no ```apex code fences")
+	case n == 0 && len(fences) > 1:
+		return "", fmt.Errorf("%d ```apex code fences; choose one by number", len(fences))
+	case n > len(fences):
+		return "", fmt.Errorf("only %d ```apex code fences, no fence %d", len(fences), n)
+	case n == 0:
+		n = 1
+	}
+	return fences[n-1], nil
+}
+
+// apexFences returns the content of the fenced code blocks of a Markdown
+// document whose info string names apex, following CommonMark: a fence is
+// three or more backticks or tildes indented by at most three spaces, and
+// closes with at least as many of the same character. An unclosed fence
+// runs to the end of the document.
+func apexFences(markdown string) []string {
+	var fences []string
+	var body []string
+	var marker string // Opening fence while inside a block
+	indent := 0
+	apex := false
+
+	for _, line := range strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		lead := len(line) - len(trimmed)
+		if marker == "" {
+			if lead > 3 {
+				continue
+			}
+			fence := fenceRun(trimmed)
+			if fence == "" {
+				continue
+			}
+			info := strings.TrimSpace(trimmed[len(fence):])
+			if fence[0] == '`' && strings.Contains(info, "`") {
+				continue // Inline code, not a fence
+			}
+			lang, _, _ := strings.Cut(info, " ")
+			marker, indent, body = fence, lead, nil
+			apex = strings.EqualFold(lang, "apex")
+			continue
+		}
+
+		if fence := fenceRun(trimmed); lead <= 3 && fence != "" && fence[0] == marker[0] && len(fence) >= len(marker) && strings.TrimSpace(trimmed[len(fence):]) == "" {
+			if apex {
+				fences = append(fences, strings.Join(body, "\n"))
+			}
+			marker = ""
+			continue
+		}
+		// Content loses up to the opening fence's indentation
+		body = append(body, line[min(lead, indent):])
+	}
+	if marker != "" && apex {
+		fences = append(fences, strings.Join(body, "\n"))
+	}
+	return fences
+}
+
+// fenceRun returns the run of three or more backticks or tildes line
+// starts with, or "" when it starts with none
+func fenceRun(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	end := 0
+	for end < len(line) && line[end] == line[0] {
+		end++
+	}
+	if end < 3 {
+		return ""
+	}
+	return line[:end]
+}
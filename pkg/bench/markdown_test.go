@@ -0,0 +1,73 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+const perfDoc = "# String building\n\n" +
+	"Concatenating in a loop:\n\n" +
+	"```apex\nString s = '';\nfor (Integer i = 0; i < 10; i++) {\n    s += i;\n}\n```\n\n" +
+	"Not benchmarked:\n\n" +
+	"```java\nString s = \"\";\n```\n\n" +
+	"Joining a list:\n\n" +
+	"  ~~~~ Apex title=\"join\"\n  List<String> parts = new List<String>();\n  String s = String.join(parts, ',');\n  ```\n  ~~~~\n\n" +
+	"Inline ```apex code``` is not a fence.\n"
+
+func TestExtractFence(t *testing.T) {
+	tests := []struct {
+		n       int
+		want    string
+		wantErr string
+	}{
+		{n: 1, want: "String s = '';\nfor (Integer i = 0; i < 10; i++) {\n    s += i;\n}"},
+		{n: 2, want: "List<String> parts = new List<String>();\nString s = String.join(parts, ',');\n```"},
+		{n: 3, wantErr: "only 2"},
+		{n: 0, wantErr: "choose one"},
+		{n: -1, wantErr: "start at 1"},
+	}
+	for _, tt := range tests {
+		got, err := ExtractFence(perfDoc, tt.n)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExtractFence(%d) error = %v, want %q", tt.n, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ExtractFence(%d) = %q, %v, want %q", tt.n, got, err, tt.want)
+		}
+	}
+
+	if got, err := ExtractFence("Intro\n\n```apex\nInteger a = 1;\n", 0); err != nil || got != "Integer a = 1;\n" {
+		t.Errorf("Expected the only, unclosed fence, got %q, %v", got, err)
+	}
+	if _, err := ExtractFence("No code here\n", 0); err == nil || !strings.Contains(err.Error(), "no ```apex") {
+		t.Errorf("Expected an error without fences, got %v", err)
+	}
+}
+
+func TestReadCode(t *testing.T) {
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "perf.md")
+	code := filepath.Join(dir, "code.apex")
+	os.WriteFile(doc, []byte(perfDoc), 0o644)
+	os.WriteFile(code, []byte("Integer a = 1;"), 0o644)
+
+	if got, err := ReadCode(types.BenchmarkSpec{File: doc, Fence: 2}); err != nil || !strings.HasPrefix(got, "List<String>") {
+		t.Errorf("ReadCode(fence 2) = %q, %v", got, err)
+	}
+	if _, err := ReadCode(types.BenchmarkSpec{File: doc}); err == nil || !strings.Contains(err.Error(), doc) {
+		t.Errorf("Expected an error naming the file, got %v", err)
+	}
+	if got, err := ReadCode(types.BenchmarkSpec{File: code}); err != nil || got != "Integer a = 1;" {
+		t.Errorf("ReadCode(apex file) = %q, %v", got, err)
+	}
+	if got, err := ReadCode(types.BenchmarkSpec{Code: "Integer b = 2;"}); err != nil || got != "Integer b = 2;" {
+		t.Errorf("ReadCode(inline) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,38 @@
+package bench
+
+import (
+	"context"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/generator"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// explainQueries fetches the plan of each inline SOQL query in the
+// benchmark's code. Queries that cannot be explained are reported as
+// warnings and left out.
+func (r *Runner) explainQueries(ctx context.Context, spec types.CodeSpec) []types.QueryPlan {
+	if r.Explainer == nil {
+		return nil
+	}
+	queries := generator.ExtractQueries(spec.UserCode)
+	if len(queries) == 0 {
+		r.warnf("%s: no inline SOQL queries to explain", spec.Name)
+		return nil
+	}
+
+	var plans []types.QueryPlan
+	for _, query := range queries {
+		if generator.HasBindVariables(query) {
+			r.warnf("%s: skipping the plan of %q, which uses bind variables", spec.Name, query)
+			continue
+		}
+		plan, err := r.Explainer.ExplainQuery(ctx, r.Org, query)
+		if err != nil {
+			r.warnf("%s: failed to explain %q: %v", spec.Name, query, err)
+			continue
+		}
+		r.debugf("  Plan of %s: %s, cost %.2f\n", query, plan.LeadingOperation, plan.RelativeCost)
+		plans = append(plans, plan)
+	}
+	return plans
+}
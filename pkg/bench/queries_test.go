@@ -0,0 +1,45 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestRunner_QueryPlans(t *testing.T) {
+	spec := types.CodeSpec{
+		Name: "Queries",
+		UserCode: `List<Account> a = [SELECT Id FROM Account WHERE Name = 'Acme'];
+Set<Id> ids = new Set<Id>();
+List<Contact> c = [SELECT Id FROM Contact WHERE AccountId IN :ids];`,
+		Iterations: 10,
+		TrackDB:    true,
+	}
+	runner := NewRunner(executor.NewSimulatedExecutor(), "", types.BenchmarkConfig{QueryPlan: true})
+	runner.Explainer = executor.NewSimulatedExecutor()
+	var warnings []string
+	runner.Warnf = func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	result, err := runner.Run(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(result.QueryPlans) != 1 || result.QueryPlans[0].SobjectType != "Account" {
+		t.Errorf("Expected the plan of the Account query, got %+v", result.QueryPlans)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "bind variables") {
+		t.Errorf("Expected a warning for the query with bind variables, got %v", warnings)
+	}
+
+	// Without the option no plans are fetched
+	runner.Config.QueryPlan = false
+	if result, _ := runner.Run(context.Background(), spec); result.QueryPlans != nil {
+		t.Errorf("Expected no plans, got %+v", result.QueryPlans)
+	}
+}
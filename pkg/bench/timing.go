@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// apexMs returns the Apex time of a run: the wall time of its transaction
+// phases, or of its measured loop when the harness reported no phases
+func apexMs(result types.Result) float64 {
+	p := result.Phases
+	if p == nil {
+		return result.TotalWallMs
+	}
+	return p.SetupWallMs + p.WarmupWallMs + p.MeasureWallMs + p.TeardownWallMs
+}
+
+// apexTimes returns the Apex time of each run
+func apexTimes(results []types.Result) []float64 {
+	apex := make([]float64, len(results))
+	for i, result := range results {
+		apex[i] = apexMs(result)
+	}
+	return apex
+}
+
+// invocationTiming compares the executions of exec with apex, the Apex time
+// of each of its runs, reporting each as a detail, and adds them to the
+// timing of the runner. It returns nil when the executor did not time its
+// executions.
+func (r *Runner) invocationTiming(exec execution, apex []float64) *types.InvocationTiming {
+	var t types.InvocationTiming
+	for i, d := range exec.durations {
+		if d <= 0 || i >= len(apex) {
+			continue
+		}
+		r.debugf("  Run %d: %s, %s in Apex\n", i+1, d.Round(time.Millisecond), msDuration(apex[i]))
+		t.Invocations++
+		t.TotalMs += float64(d) / float64(time.Millisecond)
+		t.ApexMs += apex[i]
+	}
+	if t.Invocations == 0 {
+		return nil
+	}
+	t.OverheadMs = max(t.TotalMs-t.ApexMs, 0)
+
+	r.invocations.Invocations += t.Invocations
+	r.invocations.TotalMs += t.TotalMs
+	r.invocations.ApexMs += t.ApexMs
+	r.invocations.OverheadMs = max(r.invocations.TotalMs-r.invocations.ApexMs, 0)
+	return &t
+}
+
+// msDuration converts milliseconds to a duration rounded to the millisecond
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond)
+}
+
+// Invocations returns the timing of every execution of the runner so far,
+// for a summary of the harness overhead of a session
+func (r *Runner) Invocations() types.InvocationTiming {
+	return r.invocations
+}
@@ -0,0 +1,111 @@
+package bench
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// timedExecutor reports every execution of the simulated executor as
+// taking duration
+type timedExecutor struct {
+	duration time.Duration
+}
+
+func (e timedExecutor) Run(ctx context.Context, req executor.ExecRequest) (executor.ExecResult, error) {
+	result, err := executor.NewSimulatedExecutor().Run(ctx, req)
+	result.Duration = e.duration
+	return result, err
+}
+
+func (e timedExecutor) ExecuteParallel(ctx context.Context, req executor.ExecRequest, runs int, maxConcurrent int) ([]executor.ExecResult, error) {
+	results := make([]executor.ExecResult, runs)
+	for i := range results {
+		result, err := e.Run(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+func TestRunner_Invocations(t *testing.T) {
+	runner := NewRunner(timedExecutor{duration: 2 * time.Second}, "", types.BenchmarkConfig{Runs: 2, Aggregate: "median"})
+	var details []string
+	runner.Debugf = func(format string, args ...interface{}) {
+		details = append(details, strings.TrimSpace(format))
+	}
+
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "Integer i = 1;", Iterations: 10},
+		{Name: "B", UserCode: "Integer j = 2;", Iterations: 10},
+	}
+	results, err := runner.Compare(context.Background(), specs)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	for _, result := range results {
+		timing := result.Invocations
+		if timing == nil || timing.Invocations != 2 || timing.TotalMs != 4000 {
+			t.Fatalf("Expected two 2s invocations for %s, got %+v", result.Name, timing)
+		}
+		if timing.ApexMs <= 0 || timing.ApexMs >= timing.TotalMs || timing.OverheadMs != timing.TotalMs-timing.ApexMs {
+			t.Errorf("Expected Apex time inside the invocations of %s, got %+v", result.Name, timing)
+		}
+	}
+
+	session := runner.Invocations()
+	if session.Invocations != 4 || session.TotalMs != 8000 || session.ApexMs != results[0].Invocations.ApexMs+results[1].Invocations.ApexMs {
+		t.Errorf("Expected the session to total both benchmarks, got %+v", session)
+	}
+	if len(details) != 4 || details[0] != "Run %d: %s, %s in Apex" {
+		t.Errorf("Expected a detail per run, got %q", details)
+	}
+}
+
+func TestRunner_Invocations_Combined(t *testing.T) {
+	runner := NewRunner(timedExecutor{duration: time.Second}, "", types.BenchmarkConfig{Runs: 1, Aggregate: "median", Combine: true})
+	specs := []types.CodeSpec{
+		{Name: "A", UserCode: "Integer i = 1;", Iterations: 10},
+		{Name: "B", UserCode: "Integer j = 2;", Iterations: 10},
+	}
+	results, err := runner.Compare(context.Background(), specs)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	// The benchmarks share one invocation, counted once for the session
+	if session := runner.Invocations(); session.Invocations != 1 || session.TotalMs != 1000 {
+		t.Errorf("Expected one invocation, got %+v", session)
+	}
+	if *results[0].Invocations != *results[1].Invocations {
+		t.Errorf("Expected the benchmarks to share the script's timing, got %+v and %+v", results[0].Invocations, results[1].Invocations)
+	}
+}
+
+func TestRunner_Invocations_Untimed(t *testing.T) {
+	runner := NewRunner(timedExecutor{}, "", types.BenchmarkConfig{Runs: 1, Aggregate: "median"})
+	result, err := runner.Run(context.Background(), types.CodeSpec{Name: "A", UserCode: "Integer i = 1;", Iterations: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Invocations != nil || runner.Invocations().Invocations != 0 {
+		t.Errorf("Expected no timing without durations, got %+v", result.Invocations)
+	}
+}
+
+func TestApexMs(t *testing.T) {
+	phases := types.Result{TotalWallMs: 5, Phases: &types.PhaseTimings{SetupWallMs: 1, WarmupWallMs: 2, MeasureWallMs: 6, TeardownWallMs: 1}}
+	if got := apexMs(phases); got != 10 {
+		t.Errorf("apexMs() = %v, want the phases' 10", got)
+	}
+	if got := apexMs(types.Result{TotalWallMs: 5}); got != 5 {
+		t.Errorf("apexMs() = %v, want the loop's 5", got)
+	}
+}
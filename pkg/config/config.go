@@ -0,0 +1,403 @@
+// Package config loads configuration files, such as suites and benchmark
+// sidecars, written in YAML or JSON. Files are checked against the Go type
+// they decode into before decoding, so unknown keys like "iteratons" and
+// values of the wrong type are errors naming the line and column, rather
+// than being silently ignored.
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a config file
+type Format string
+
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+)
+
+// FormatOf returns the format of a config file by its extension: .yaml,
+// .yml or .json
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".json":
+		return JSON, nil
+	}
+	return "", fmt.Errorf("unsupported config file %s (use .yaml, .yml or .json)", path)
+}
+
+// Error reports a problem at a position of a config file
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	Key    string // Path of the offending key, e.g. benchmarks[2].fence; empty for syntax errors
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Key != "" {
+		msg = e.Key + ": " + msg
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, msg)
+}
+
+// Load reads the config file at path into v, which must be a pointer, in
+// the format of its extension, with the files it extends and includes
+func Load(path string, v interface{}) error {
+	if _, err := FormatOf(path); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	return DecodeFile(data, path, v)
+}
+
+// DecodeFile decodes data as the contents of the config file at path into
+// v, like Load, so that files it extends and includes are found next to
+// path
+func DecodeFile(data []byte, path string, v interface{}) error {
+	t, err := target(v, path)
+	if err != nil {
+		return err
+	}
+	root, err := resolve(data, path, t, nil)
+	if err != nil || root == nil {
+		return err
+	}
+	return decode(root, path, v)
+}
+
+// Decode checks data in format against the type of v and decodes it into v,
+// which must be a pointer; name identifies the data in errors. An empty
+// document leaves v as it is. Keys are matched against the yaml tags of
+// struct fields. Data read other than from a file, such as a request, cannot
+// extend or include files.
+func Decode(data []byte, format Format, name string, v interface{}) error {
+	t, err := target(v, name)
+	if err != nil {
+		return err
+	}
+	root, err := parse(data, format, name)
+	if err != nil || root == nil {
+		return err
+	}
+	if err := (checker{file: name}).check(root, t, ""); err != nil {
+		return err
+	}
+	return decode(root, name, v)
+}
+
+// target returns the type v points to
+func target(v interface{}, name string) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer {
+		return nil, fmt.Errorf("config of %s must be decoded into a pointer, not %v", name, t)
+	}
+	return t.Elem(), nil
+}
+
+// parse returns the root node of data in format, or nil for an empty
+// document
+func parse(data []byte, format Format, name string) (*yaml.Node, error) {
+	if format == JSON {
+		if err := checkJSON(data, name); err != nil {
+			return nil, err
+		}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", name, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// decode decodes the checked node root into v
+func decode(root *yaml.Node, name string, v interface{}) error {
+	if err := root.Decode(v); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", name, err)
+	}
+	return nil
+}
+
+// checkJSON reports JSON syntax errors in data with their position, which
+// YAML, reading JSON as its subset, would accept or misplace
+func checkJSON(data []byte, name string) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		// The offset is just past the offending character
+		line, column := position(data, max(syntax.Offset-1, 0))
+		return &Error{File: name, Line: line, Column: column, Msg: "invalid JSON: " + syntax.Error()}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", name, err)
+	}
+	return nil
+}
+
+// position returns the line and column, from 1, of the byte at offset in
+// data
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textType        = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// checker walks a document alongside the type it decodes into
+type checker struct {
+	file string
+}
+
+// fail returns an Error at node
+func (c checker) fail(node *yaml.Node, key, format string, args ...interface{}) error {
+	return &Error{File: c.file, Line: node.Line, Column: node.Column, Key: key, Msg: fmt.Sprintf(format, args...)}
+}
+
+// check checks that node can be decoded into a value of type t; key is the
+// path of node in the document
+func (c checker) check(node *yaml.Node, t reflect.Type, key string) error {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.ShortTag() == "!!null" || t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return c.fail(node, key, "expected a mapping, got %s", describe(node))
+		}
+		fields := structFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[k.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %q", k.Value)
+				if s := suggest(k.Value, fields); s != "" {
+					msg += fmt.Sprintf("; did you mean %q?", s)
+				}
+				return c.fail(k, key, "%s", msg)
+			}
+			if err := c.check(value, field, join(key, k.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return c.fail(node, key, "expected a mapping, got %s", describe(node))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, value := node.Content[i], node.Content[i+1]
+			if err := c.check(k, t.Key(), key); err != nil {
+				return err
+			}
+			if err := c.check(value, t.Elem(), join(key, k.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return c.fail(node, key, "expected a list, got %s", describe(node))
+		}
+		for i, item := range node.Content {
+			if err := c.check(item, t.Elem(), fmt.Sprintf("%s[%d]", key, i+1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if node.Kind != yaml.ScalarNode || !scalarFits(node, t) {
+		return c.fail(node, key, "expected %s, got %s", expected(t), describe(node))
+	}
+	return nil
+}
+
+// scalarFits reports whether the scalar node decodes into a value of type t
+func scalarFits(node *yaml.Node, t reflect.Type) bool {
+	tag := node.ShortTag()
+	switch {
+	case t == durationType:
+		if tag == "!!int" {
+			return true
+		}
+		_, err := time.ParseDuration(node.Value)
+		return err == nil
+	case t.Kind() == reflect.String, reflect.PointerTo(t).Implements(textType):
+		// Unquoted values such as apiVersion: 62.0 are meant as strings
+		return true
+	case t.Kind() == reflect.Bool:
+		return tag == "!!bool"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uintptr:
+		if tag == "!!float" {
+			f, err := strconv.ParseFloat(node.Value, 64)
+			return err == nil && f == float64(int64(f))
+		}
+		return tag == "!!int"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return tag == "!!int" || tag == "!!float"
+	}
+	return true
+}
+
+// expected describes the values of type t
+func expected(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "a duration such as 30s"
+	case t.Kind() == reflect.Bool:
+		return "true or false"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uintptr:
+		return "a whole number"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "a number"
+	}
+	return "a string"
+}
+
+// describe names the value of node for errors
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	switch node.ShortTag() {
+	case "!!bool":
+		return "boolean " + node.Value
+	case "!!int", "!!float":
+		return "number " + node.Value
+	}
+	return strconv.Quote(node.Value)
+}
+
+// join appends name to the key path key
+func join(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// structFields returns the fields of struct type t by key, including those
+// of inlined structs
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+opts+",", ",inline,") {
+			inner := f.Type
+			if inner.Kind() == reflect.Pointer {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				for k, v := range structFields(inner) {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// suggest returns the key of fields closest to an unknown key, or "" when
+// none differs from it by only a typo or two
+func suggest(key string, fields map[string]reflect.Type) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var best string
+	bestDistance := -1
+	for _, name := range names {
+		d := editDistance(strings.ToLower(key), strings.ToLower(name))
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if bestDistance >= 0 && bestDistance <= max(2, len(key)/3) {
+		return best
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type benchmark struct {
+	Name  string   `yaml:"name"`
+	Fence int      `yaml:"fence,omitempty"`
+	Tags  []string `yaml:"tags"`
+}
+
+type suite struct {
+	Benchmarks []benchmark            `yaml:"benchmarks"`
+	Iterations int                    `yaml:"iterations"`
+	TrackHeap  bool                   `yaml:"trackHeap"`
+	Noise      float64                `yaml:"noiseThreshold"`
+	APIVersion string                 `yaml:"apiVersion"`
+	Timeout    time.Duration          `yaml:"timeout"`
+	Limits     map[string]*float64    `yaml:"limits"`
+	Vars       map[string]string      `yaml:"vars"`
+	Extra      map[string]interface{} `yaml:"extra"`
+	Internal   string                 `yaml:"-"`
+}
+
+func TestDecode(t *testing.T) {
+	yamlSuite := `
+benchmarks:
+  - name: A
+    fence: 2
+    tags: [x, y]
+iterations: 10
+trackHeap: true
+noiseThreshold: 15
+apiVersion: 62.0
+timeout: 30s
+limits:
+  A: 1.5
+extra:
+  anything: [1, {b: c}]
+`
+	jsonSuite := `{
+	"benchmarks": [{"name": "A", "fence": 2, "tags": ["x", "y"]}],
+	"iterations": 10,
+	"trackHeap": true,
+	"noiseThreshold": 15,
+	"apiVersion": "62.0",
+	"timeout": "30s",
+	"limits": {"A": 1.5},
+	"extra": {"anything": [1, {"b": "c"}]}
+}`
+	for _, tt := range []struct {
+		format Format
+		data   string
+	}{{YAML, yamlSuite}, {JSON, jsonSuite}} {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var s suite
+			if err := Decode([]byte(tt.data), tt.format, "suite", &s); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if len(s.Benchmarks) != 1 || s.Benchmarks[0].Fence != 2 || len(s.Benchmarks[0].Tags) != 2 {
+				t.Errorf("Unexpected benchmarks %+v", s.Benchmarks)
+			}
+			if s.Iterations != 10 || !s.TrackHeap || s.Noise != 15 || s.APIVersion != "62.0" || s.Timeout != 30*time.Second {
+				t.Errorf("Unexpected settings %+v", s)
+			}
+			if s.Limits["A"] == nil || *s.Limits["A"] != 1.5 {
+				t.Errorf("Unexpected limits %v", s.Limits)
+			}
+		})
+	}
+}
+
+func TestDecode_Empty(t *testing.T) {
+	s := suite{Iterations: 100}
+	if err := Decode([]byte("# nothing yet\n"), YAML, "suite", &s); err != nil || s.Iterations != 100 {
+		t.Errorf("Expected an empty document to keep the defaults, got %+v, %v", s, err)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		want   string
+	}{
+		{"typo", YAML, "benchmarks: []\niteratons: 5\n", `suite:2:1: unknown key "iteratons"; did you mean "iterations"?`},
+		{"unknown key", YAML, "color: red\n", `suite:1:1: unknown key "color"`},
+		{"ignored field", YAML, "Internal: x\n", `unknown key "Internal"`},
+		{"nested key", YAML, "benchmarks:\n  - name: A\n    fenc: 1\n", `suite:3:5: benchmarks[1]: unknown key "fenc"; did you mean "fence"?`},
+		{"string for int", YAML, "iterations: ten\n", `suite:1:13: iterations: expected a whole number, got "ten"`},
+		{"fraction for int", YAML, "iterations: 1.5\n", `iterations: expected a whole number, got number 1.5`},
+		{"string for bool", YAML, "trackHeap: \"yes\"\n", `trackHeap: expected true or false, got "yes"`},
+		{"bad duration", YAML, "timeout: soon\n", `timeout: expected a duration such as 30s, got "soon"`},
+		{"list for string", YAML, "apiVersion: [62]\n", `apiVersion: expected a string, got a list`},
+		{"scalar for list", YAML, "benchmarks: A\n", `benchmarks: expected a list, got "A"`},
+		{"map value", YAML, "limits:\n  A: lots\n", `suite:2:6: limits.A: expected a number, got "lots"`},
+		{"JSON type", JSON, "{\n  \"benchmarks\": [{\"name\": \"A\", \"fence\": \"two\"}]\n}", `suite:2:41: benchmarks[1].fence: expected a whole number, got "two"`},
+		{"JSON typo", JSON, `{"trackheap": true}`, `suite:1:2: unknown key "trackheap"; did you mean "trackHeap"?`},
+		{"JSON syntax", JSON, "{\n  \"iterations\": 10,\n}", "suite:3:1: invalid JSON"},
+		{"YAML syntax", YAML, "benchmarks: [\n", "failed to parse config suite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s suite
+			err := Decode([]byte(tt.data), tt.format, "suite", &s)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "suite.json")
+	if err := os.WriteFile(path, []byte(`{"iterations": 5}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var s suite
+	if err := Load(path, &s); err != nil || s.Iterations != 5 {
+		t.Errorf("Load() = %+v, %v", s, err)
+	}
+
+	if err := Load(filepath.Join(dir, "missing.yaml"), &s); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing file to be reported as such, got %v", err)
+	}
+	if err := Load(filepath.Join(dir, "suite.toml"), &s); err == nil || !strings.Contains(err.Error(), ".yaml, .yml or .json") {
+		t.Errorf("Expected an unsupported extension to be rejected, got %v", err)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]Format{"a.yaml": YAML, "a.YML": YAML, "dir/a.json": JSON} {
+		if got, err := FormatOf(path); err != nil || got != want {
+			t.Errorf("FormatOf(%s) = %v, %v, want %v", path, got, err, want)
+		}
+	}
+}
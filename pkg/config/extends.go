@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of a config file that pull in other config files, by paths relative
+// to the file
+const (
+	// extendsKey names a base file whose settings the file overrides
+	extendsKey = "extends"
+	// includeKey lists files whose settings are merged into the file
+	includeKey = "include"
+)
+
+// resolve returns the root node of data, the contents of the config file at
+// path, with the files it extends and includes merged in. Each file is
+// checked against t on its own, so errors point into the file they are in.
+// chain lists the absolute paths of the files being resolved, to stop files
+// that pull in themselves.
+//
+// Settings of a file override those of the file it extends: mappings such
+// as thresholds or profiles are merged key by key, while lists such as
+// benchmarks replace the base's. Included files are merged in order before
+// the file's own settings, which override theirs, and their lists are
+// appended, so a file can gather the benchmarks of several others.
+func resolve(data []byte, path string, t reflect.Type, chain []string) (*yaml.Node, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parse(data, format, path)
+	if err != nil || root == nil {
+		return root, err
+	}
+	c := checker{file: path}
+	extends, includes, err := c.takeReferences(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.check(root, t, ""); err != nil {
+		return nil, err
+	}
+	if extends == "" && len(includes) == 0 {
+		return root, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	chain = append(slices.Clip(chain), abs)
+	load := func(ref string) (*yaml.Node, error) {
+		if !filepath.IsAbs(ref) {
+			ref = filepath.Join(filepath.Dir(path), ref)
+		}
+		if refAbs, err := filepath.Abs(ref); err == nil && slices.Contains(chain, refAbs) {
+			return nil, fmt.Errorf("%s: %s extends or includes itself", path, ref)
+		}
+		if _, err := FormatOf(ref); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read config %s: %w", path, ref, err)
+		}
+		return resolve(data, ref, t, chain)
+	}
+
+	var merged *yaml.Node
+	for _, include := range includes {
+		node, err := load(include)
+		if err != nil {
+			return nil, err
+		}
+		merged = merge(merged, node, true)
+	}
+	merged = merge(merged, root, true)
+	if extends != "" {
+		base, err := load(extends)
+		if err != nil {
+			return nil, err
+		}
+		merged = merge(base, merged, false)
+	}
+	return merged, nil
+}
+
+// takeReferences removes the extends and include keys from the root node of
+// a file, returning the file it extends and those it includes
+func (c checker) takeReferences(root *yaml.Node) (string, []string, error) {
+	if root.Kind != yaml.MappingNode {
+		return "", nil, nil
+	}
+	var extends string
+	var includes []string
+	content := make([]*yaml.Node, 0, len(root.Content))
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k, value := root.Content[i], root.Content[i+1]
+		switch k.Value {
+		case extendsKey:
+			if value.Kind != yaml.ScalarNode || value.ShortTag() != "!!str" || value.Value == "" {
+				return "", nil, c.fail(value, extendsKey, "expected the path of a config file, got %s", describe(value))
+			}
+			extends = value.Value
+		case includeKey:
+			items := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				items = value.Content
+			}
+			for _, item := range items {
+				if item.Kind != yaml.ScalarNode || item.ShortTag() != "!!str" || item.Value == "" {
+					return "", nil, c.fail(item, includeKey, "expected paths of config files, got %s", describe(item))
+				}
+				includes = append(includes, item.Value)
+			}
+		default:
+			content = append(content, k, value)
+		}
+	}
+	root.Content = content
+	return extends, includes, nil
+}
+
+// merge returns the settings of src laid over those of dst. Mappings are
+// merged key by key; lists are appended when appendLists is set, and
+// replaced like other values otherwise. Either may be nil for an empty file.
+func merge(dst, src *yaml.Node, appendLists bool) *yaml.Node {
+	if src == nil {
+		return dst
+	}
+	if dst == nil || dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return src
+	}
+	merged := *dst
+	merged.Content = slices.Clone(dst.Content)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		k, value := src.Content[i], src.Content[i+1]
+		j := keyIndex(&merged, k.Value)
+		if j < 0 {
+			merged.Content = append(merged.Content, k, value)
+			continue
+		}
+		existing := merged.Content[j+1]
+		switch {
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			merged.Content[j+1] = merge(existing, value, appendLists)
+		case appendLists && existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			list := *existing
+			list.Content = append(slices.Clone(existing.Content), value.Content...)
+			merged.Content[j+1] = &list
+		default:
+			merged.Content[j+1] = value
+		}
+	}
+	return &merged
+}
+
+// keyIndex returns the index of key in the content of mapping, or -1
+func keyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the config files in a temporary directory, returning
+// the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad_Extends(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base-bench.yaml":   "benchmarks:\n  - name: Base\niterations: 50\ntrackHeap: true\nlimits:\n  A: 1\n  B: 2\n",
+		"module/bench.yaml": "extends: ../base-bench.yaml\nbenchmarks:\n  - name: Own\niterations: 10\nlimits:\n  B: 3\n",
+	})
+
+	var s suite
+	if err := Load(filepath.Join(dir, "module", "bench.yaml"), &s); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if s.Iterations != 10 || !s.TrackHeap {
+		t.Errorf("Expected own settings over the base's, got %+v", s)
+	}
+	if len(s.Benchmarks) != 1 || s.Benchmarks[0].Name != "Own" {
+		t.Errorf("Expected own benchmarks to replace the base's, got %+v", s.Benchmarks)
+	}
+	if len(s.Limits) != 2 || *s.Limits["A"] != 1 || *s.Limits["B"] != 3 {
+		t.Errorf("Expected limits merged by key, got %v", s.Limits)
+	}
+}
+
+func TestLoad_Include(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shared.json":    `{"iterations": 50, "vars": {"SIZE": "10"}}`,
+		"strings.yaml":   "benchmarks:\n  - name: Concat\n  - name: Join\nvars:\n  SEP: ','\n",
+		"lists.yaml":     "benchmarks:\n  - name: Sort\n",
+		"all.yaml":       "extends: shared.json\ninclude: [strings.yaml, lists.yaml]\nbenchmarks:\n  - name: Own\niterations: 20\n",
+		"one.yaml":       "include: lists.yaml\n",
+		"empty.yaml":     "",
+		"with-empty.yml": "include: [empty.yaml, lists.yaml]\n",
+	})
+
+	var s suite
+	if err := Load(filepath.Join(dir, "all.yaml"), &s); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var names []string
+	for _, b := range s.Benchmarks {
+		names = append(names, b.Name)
+	}
+	if strings.Join(names, ",") != "Concat,Join,Sort,Own" {
+		t.Errorf("Expected included benchmarks in order before the file's own, got %v", names)
+	}
+	if s.Iterations != 20 || s.Vars["SIZE"] != "10" || s.Vars["SEP"] != "," {
+		t.Errorf("Expected settings of every file, got %+v", s)
+	}
+
+	for _, name := range []string{"one.yaml", "with-empty.yml"} {
+		var one suite
+		if err := Load(filepath.Join(dir, name), &one); err != nil || len(one.Benchmarks) != 1 {
+			t.Errorf("Load(%s) = %+v, %v", name, one, err)
+		}
+	}
+}
+
+func TestLoad_ReferenceErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yaml":       "extends: b.yaml\n",
+		"b.yaml":       "include: [a.yaml]\n",
+		"self.yaml":    "include: self.yaml\n",
+		"typo.yaml":    "benchmarks: []\niteratons: 5\n",
+		"uses.yaml":    "benchmarks: []\ninclude:\n  - typo.yaml\n",
+		"missing.yaml": "extends: nowhere.yaml\n",
+		"number.yaml":  "extends: 5\n",
+		"list.yaml":    "include:\n  - [a.yaml]\n",
+		"format.yaml":  "include: notes.txt\n",
+	})
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"a.yaml", "a.yaml extends or includes itself"},
+		{"self.yaml", "self.yaml extends or includes itself"},
+		{"uses.yaml", `typo.yaml:2:1: unknown key "iteratons"`},
+		{"missing.yaml", "failed to read config"},
+		{"number.yaml", "number.yaml:1:10: extends: expected the path of a config file, got number 5"},
+		{"list.yaml", "list.yaml:2:5: include: expected paths of config files, got a list"},
+		{"format.yaml", "unsupported config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var s suite
+			err := Load(filepath.Join(dir, tt.file), &s)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_NoReferences(t *testing.T) {
+	var s suite
+	err := Decode([]byte("extends: base.yaml\n"), YAML, "request", &s)
+	if err == nil || !strings.Contains(err.Error(), `unknown key "extends"`) {
+		t.Errorf("Expected data not read from a file to extend nothing, got %v", err)
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"base.yaml": "iterations: 50\n"})
+	var s suite
+	err := DecodeFile([]byte("extends: base.yaml\ntrackHeap: true\n"), filepath.Join(dir, "suite.yaml"), &s)
+	if err != nil || s.Iterations != 50 || !s.TrackHeap {
+		t.Errorf("DecodeFile() = %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,239 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLogLevel is the Apex_code debug level requested when ExecRequest
+// does not set one. USER_DEBUG events, which carry BENCH_RESULT, are logged
+// at DEBUG.
+const defaultLogLevel = "DEBUG"
+
+// APIExecutor implements Executor by calling executeAnonymous on the Apex
+// SOAP API directly. It borrows the access token of an org authorized in
+// the sf (or legacy sfdx) CLI, so only the first execution per org starts a
+// CLI process.
+type APIExecutor struct {
+	client *http.Client
+
+	mu       sync.Mutex
+	sessions map[string]orgSession
+}
+
+// orgSession holds what is needed to call the API of one org
+type orgSession struct {
+	InstanceURL string `json:"instanceUrl"`
+	AccessToken string `json:"accessToken"`
+	APIVersion  string `json:"apiVersion"`
+}
+
+// OrgDisplayResponse represents the JSON response from `sf org display --json`
+//
+// Expected JSON structure:
+//
+//	{
+//	  "status": 0,
+//	  "result": {
+//	    "accessToken": "00D...",
+//	    "instanceUrl": "https://example.my.salesforce.com",
+//	    "apiVersion": "62.0",
+//	    "username": "user@example.com"
+//	  }
+//	}
+type OrgDisplayResponse struct {
+	Status int        `json:"status"`
+	Result orgSession `json:"result"`
+}
+
+// NewAPIExecutor creates a new executor that calls the Salesforce API
+func NewAPIExecutor() *APIExecutor {
+	return &APIExecutor{
+		client:   &http.Client{},
+		sessions: make(map[string]orgSession),
+	}
+}
+
+// Run executes Apex code once and returns the debug log from the
+// DebuggingInfo response header. An expired session is refreshed once.
+func (e *APIExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	result, err := e.executeAnonymous(ctx, req, false)
+	if errors.Is(err, errInvalidSession) {
+		result, err = e.executeAnonymous(ctx, req, true)
+	}
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+// ExecuteParallel runs the same Apex code multiple times in parallel
+func (e *APIExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
+
+// errInvalidSession reports that the cached access token was rejected
+var errInvalidSession = errors.New("invalid session")
+
+// executeAnonymous performs one SOAP call, optionally fetching a fresh
+// session first
+func (e *APIExecutor) executeAnonymous(ctx context.Context, req ExecRequest, refresh bool) (ExecResult, error) {
+	session, err := e.session(req.Org, refresh)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	apiVersion := req.APIVersion
+	if apiVersion == "" {
+		apiVersion = session.APIVersion
+	}
+	logLevel := req.LogLevel
+	if logLevel == "" {
+		logLevel = defaultLogLevel
+	}
+
+	endpoint := strings.TrimRight(session.InstanceURL, "/") + "/services/Soap/s/" + apiVersion
+	body := executeAnonymousEnvelope(session.AccessToken, logLevel, req.Code)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("failed to build executeAnonymous request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "text/xml; charset=UTF-8")
+	httpReq.Header.Set("SOAPAction", `""`)
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("executeAnonymous request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("failed to read executeAnonymous response: %w", err)
+	}
+	result := ExecResult{Raw: raw}
+	if usage, ok := ParseLimitInfo(resp.Header.Get("Sforce-Limit-Info")); ok {
+		result.APIUsage = &usage
+	}
+
+	var envelope soapResponse
+	if err := xml.Unmarshal(raw, &envelope); err != nil {
+		return result, fmt.Errorf("failed to parse executeAnonymous response (HTTP %d): %w\nOutput: %s", resp.StatusCode, err, string(raw))
+	}
+	if fault := envelope.Body.Fault; fault != nil {
+		if strings.Contains(fault.Code, "INVALID_SESSION_ID") && !refresh {
+			return result, errInvalidSession
+		}
+		return result, fmt.Errorf("executeAnonymous failed: %s", fault.String)
+	}
+
+	r := envelope.Body.Response.Result
+	if !r.Success {
+		if !r.Compiled {
+			return result, &CompileError{Problem: r.CompileProblem, Line: r.Line, Column: r.Column}
+		}
+		return result, fmt.Errorf("Apex execution failed: %s", r.ExceptionMessage)
+	}
+
+	result.Logs = envelope.Header.DebuggingInfo.DebugLog
+	return result, nil
+}
+
+// session returns the cached session for org, asking the sf CLI for one
+// when there is none or refresh is set
+func (e *APIExecutor) session(org string, refresh bool) (orgSession, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if s, ok := e.sessions[org]; ok && !refresh {
+		return s, nil
+	}
+
+	command, args := "sf", []string{"org", "display", "--json"}
+	if org != "" {
+		args = append(args, "--target-org", org)
+	}
+	if UsingLegacyCLI() {
+		command, args = "sfdx", []string{"force:org:display", "--json"}
+		if org != "" {
+			args = append(args, "--targetusername", org)
+		}
+	}
+	output, err := execCommand(command, args...).Output()
+	if err != nil {
+		return orgSession{}, fmt.Errorf("failed to get org session: %w", err)
+	}
+
+	var response OrgDisplayResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return orgSession{}, fmt.Errorf("failed to parse org display output: %w", err)
+	}
+	s := response.Result
+	if s.AccessToken == "" || s.InstanceURL == "" || s.APIVersion == "" {
+		return orgSession{}, fmt.Errorf("sf org display did not return an access token, instance URL and API version")
+	}
+
+	e.sessions[org] = s
+	return s, nil
+}
+
+// executeAnonymousEnvelope builds the SOAP request. Apex_profiling at INFO
+// keeps the CUMULATIVE_LIMIT_USAGE section in the returned log.
+func executeAnonymousEnvelope(sessionID, logLevel, code string) string {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:apex="http://soap.sforce.com/2006/08/apex">` +
+		`<soapenv:Header><apex:DebuggingHeader>` +
+		`<apex:categories><apex:category>Apex_code</apex:category><apex:level>`)
+	xml.EscapeText(&b, []byte(logLevel))
+	b.WriteString(`</apex:level></apex:categories>` +
+		`<apex:categories><apex:category>Apex_profiling</apex:category><apex:level>INFO</apex:level></apex:categories>` +
+		`<apex:debugLevel>DETAIL</apex:debugLevel></apex:DebuggingHeader>` +
+		`<apex:SessionHeader><apex:sessionId>`)
+	xml.EscapeText(&b, []byte(sessionID))
+	b.WriteString(`</apex:sessionId></apex:SessionHeader></soapenv:Header>` +
+		`<soapenv:Body><apex:executeAnonymous><apex:String>`)
+	xml.EscapeText(&b, []byte(code))
+	b.WriteString(`</apex:String></apex:executeAnonymous></soapenv:Body></soapenv:Envelope>`)
+	return b.String()
+}
+
+// soapResponse is the part of an executeAnonymous response envelope that is
+// used
+type soapResponse struct {
+	Header struct {
+		DebuggingInfo struct {
+			DebugLog string `xml:"debugLog"`
+		} `xml:"DebuggingInfo"`
+	} `xml:"Header"`
+	Body struct {
+		Fault *struct {
+			Code   string `xml:"faultcode"`
+			String string `xml:"faultstring"`
+		} `xml:"Fault"`
+		Response struct {
+			Result struct {
+				Column           int    `xml:"column"`
+				CompileProblem   string `xml:"compileProblem"`
+				Compiled         bool   `xml:"compiled"`
+				ExceptionMessage string `xml:"exceptionMessage"`
+				Line             int    `xml:"line"`
+				Success          bool   `xml:"success"`
+			} `xml:"result"`
+		} `xml:"executeAnonymousResponse"`
+	} `xml:"Body"`
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// mockOrgDisplay makes sf org display report a session for instanceURL
+func mockOrgDisplay(t *testing.T, instanceURL string) *int {
+	t.Helper()
+	calls := 0
+	oldExecCommand := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		calls++
+		return exec.Command("echo", `{"status":0,"result":{"accessToken":"token-`+strings.Repeat("x", calls)+`","instanceUrl":"`+instanceURL+`","apiVersion":"62.0"}}`)
+	}
+	t.Cleanup(func() { execCommand = oldExecCommand })
+	return &calls
+}
+
+const executeAnonymousSuccess = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="http://soap.sforce.com/2006/08/apex">
+<soapenv:Header><DebuggingInfo><debugLog>15:45:09.123 (456789)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Api"}</debugLog></DebuggingInfo></soapenv:Header>
+<soapenv:Body><executeAnonymousResponse><result><column>-1</column><compiled>true</compiled><line>-1</line><success>true</success></result></executeAnonymousResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+func TestAPIExecutor_Run_Success(t *testing.T) {
+	var gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		io.WriteString(w, executeAnonymousSuccess)
+	}))
+	defer server.Close()
+	calls := mockOrgDisplay(t, server.URL)
+
+	executor := NewAPIExecutor()
+	req := ExecRequest{Code: "if (1 < 2) {}", Org: "test-org", APIVersion: "61.0", LogLevel: "FINEST"}
+	for i := 0; i < 2; i++ {
+		result, err := executor.Run(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !strings.Contains(result.Logs, "BENCH_RESULT") {
+			t.Errorf("Expected debug log, got: %q", result.Logs)
+		}
+	}
+
+	if *calls != 1 {
+		t.Errorf("Expected the session to be fetched once, got %d calls", *calls)
+	}
+	if gotPath != "/services/Soap/s/61.0" {
+		t.Errorf("Expected requested API version in path, got %s", gotPath)
+	}
+	if !strings.Contains(gotBody, "if (1 &lt; 2) {}") || !strings.Contains(gotBody, "<apex:level>FINEST</apex:level>") {
+		t.Errorf("Expected escaped code and log level in request, got: %s", gotBody)
+	}
+}
+
+func TestAPIExecutor_Run_CompileError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><executeAnonymousResponse><result><column>4</column><compileProblem>Unexpected token</compileProblem><compiled>false</compiled><line>2</line><success>false</success></result></executeAnonymousResponse></soapenv:Body></soapenv:Envelope>`)
+	}))
+	defer server.Close()
+	mockOrgDisplay(t, server.URL)
+
+	_, err := NewAPIExecutor().Run(context.Background(), ExecRequest{Code: "x", Org: "test-org"})
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("Expected *CompileError, got: %v", err)
+	}
+	if compileErr.Line != 2 || compileErr.Column != 4 {
+		t.Errorf("Expected position 2:4, got %d:%d", compileErr.Line, compileErr.Column)
+	}
+}
+
+func TestAPIExecutor_Run_RefreshesInvalidSession(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><soapenv:Fault><faultcode>sf:INVALID_SESSION_ID</faultcode><faultstring>INVALID_SESSION_ID: Session expired</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+			return
+		}
+		io.WriteString(w, executeAnonymousSuccess)
+	}))
+	defer server.Close()
+	calls := mockOrgDisplay(t, server.URL)
+
+	if _, err := NewAPIExecutor().Run(context.Background(), ExecRequest{Code: "x", Org: "test-org"}); err != nil {
+		t.Fatalf("Expected retry to succeed, got: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("Expected the session to be refreshed, got %d org display calls", *calls)
+	}
+}
@@ -0,0 +1,138 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Environment variables that let headless jobs authenticate without
+// pre-provisioned sf configuration
+const (
+	EnvAuthURL     = "SFDX_AUTH_URL"   // An sfdx auth URL (force://...)
+	EnvJWTKeyFile  = "SF_JWT_KEY_FILE" // Private key file for the JWT flow
+	EnvConsumerKey = "SF_CONSUMER_KEY" // Connected app consumer key for the JWT flow
+	EnvUsername    = "SF_USERNAME"     // User to authenticate as with the JWT flow
+	EnvLoginURL    = "SF_LOGIN_URL"    // Optional login URL for the JWT flow, e.g. https://test.salesforce.com
+)
+
+// DefaultLoginAlias is the alias given to orgs authenticated from the
+// environment when no org is specified
+const DefaultLoginAlias = "apex-bench"
+
+// LoginResponse represents the JSON response from `sf org login sfdx-url`
+// and `sf org login jwt`
+type LoginResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Result  struct {
+		Username string `json:"username"`
+		OrgID    string `json:"orgId"`
+	} `json:"result"`
+}
+
+// LoginFromEnv authenticates an org from SFDX_AUTH_URL or, failing that,
+// from the JWT variables, storing it in the CLI under alias. It returns the
+// alias and the variable used, or "" when the environment has no
+// credentials. An auth URL is passed to the CLI in a file in tempDir, or in
+// the system temporary directory when tempDir is empty, removed afterwards.
+// The CLI keeps the org authenticated, so the same credentials are only
+// logged in once per process, however many executors a command creates.
+func LoginFromEnv(alias, tempDir string) (string, string, error) {
+	if alias == "" {
+		alias = DefaultLoginAlias
+	}
+
+	authURL := os.Getenv(EnvAuthURL)
+	keyFile, consumerKey, username := os.Getenv(EnvJWTKeyFile), os.Getenv(EnvConsumerKey), os.Getenv(EnvUsername)
+	loginURL := os.Getenv(EnvLoginURL)
+	source := EnvAuthURL
+	if authURL == "" {
+		if keyFile == "" && consumerKey == "" {
+			return "", "", nil
+		}
+		if keyFile == "" || consumerKey == "" || username == "" {
+			return "", "", fmt.Errorf("JWT login needs %s, %s and %s", EnvJWTKeyFile, EnvConsumerKey, EnvUsername)
+		}
+		source = EnvJWTKeyFile
+	}
+
+	key := strings.Join([]string{alias, authURL, keyFile, consumerKey, username, loginURL}, "\x00")
+	loginsMu.Lock()
+	defer loginsMu.Unlock()
+	if logins[key] {
+		return alias, source, nil
+	}
+
+	var err error
+	if source == EnvAuthURL {
+		err = loginAuthURL(alias, authURL, tempDir)
+	} else {
+		err = loginJWT(alias, keyFile, consumerKey, username, loginURL)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	logins[key] = true
+	return alias, source, nil
+}
+
+var (
+	loginsMu sync.Mutex
+	logins   = make(map[string]bool) // Credentials and alias of the logins done
+)
+
+// loginAuthURL stores the org of an sfdx auth URL under alias
+func loginAuthURL(alias, authURL, tempDir string) error {
+	file, err := os.CreateTemp(tempDir, "apex-bench-auth-*")
+	if err != nil {
+		return fmt.Errorf("failed to create auth URL file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(authURL)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write auth URL file: %w", err)
+	}
+
+	command, args := "sf", []string{"org", "login", "sfdx-url", "--sfdx-url-file", file.Name(), "--alias", alias, "--json"}
+	if UsingLegacyCLI() {
+		command, args = "sfdx", []string{"force:auth:sfdxurl:store", "--sfdxurlfile", file.Name(), "--setalias", alias, "--json"}
+	}
+	return login(command, args)
+}
+
+// loginJWT authenticates username with the JWT flow, storing the org under
+// alias
+func loginJWT(alias, keyFile, consumerKey, username, loginURL string) error {
+	command, args := "sf", []string{"org", "login", "jwt", "--jwt-key-file", keyFile, "--client-id", consumerKey, "--username", username, "--alias", alias, "--json"}
+	if loginURL != "" {
+		args = append(args, "--instance-url", loginURL)
+	}
+	if UsingLegacyCLI() {
+		command, args = "sfdx", []string{"force:auth:jwt:grant", "--jwtkeyfile", keyFile, "--clientid", consumerKey, "--username", username, "--setalias", alias, "--json"}
+		if loginURL != "" {
+			args = append(args, "--instanceurl", loginURL)
+		}
+	}
+	return login(command, args)
+}
+
+// login runs a CLI login command and checks its JSON response
+func login(command string, args []string) error {
+	output, runErr := execCommand(command, args...).Output()
+
+	var response LoginResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		if runErr != nil {
+			return fmt.Errorf("org login failed: %w\nOutput: %s", runErr, string(output))
+		}
+		return fmt.Errorf("failed to parse org login output: %w", err)
+	}
+	if response.Status != 0 || runErr != nil {
+		return fmt.Errorf("org login failed: %s", response.Message)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// clearAuthEnv unsets the login variables for the test
+func clearAuthEnv(t *testing.T) {
+	for _, name := range []string{EnvAuthURL, EnvJWTKeyFile, EnvConsumerKey, EnvUsername, EnvLoginURL} {
+		t.Setenv(name, "")
+	}
+}
+
+// captureLogin records CLI invocations and answers with response
+func captureLogin(t *testing.T, response string) *[]string {
+	calls := &[]string{}
+	oldExecCommand := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		*calls = append(*calls, command+" "+strings.Join(args, " "))
+		for i, arg := range args {
+			if arg == "--sfdx-url-file" {
+				content, _ := os.ReadFile(args[i+1])
+				*calls = append(*calls, "file:"+string(content))
+			}
+		}
+		return exec.Command("echo", response)
+	}
+	t.Cleanup(func() {
+		execCommand = oldExecCommand
+		loginsMu.Lock()
+		clear(logins)
+		loginsMu.Unlock()
+	})
+	return calls
+}
+
+func TestLoginFromEnv_NoCredentials(t *testing.T) {
+	clearAuthEnv(t)
+	calls := captureLogin(t, "{}")
+
+	alias, _, err := LoginFromEnv("", "")
+	if err != nil || alias != "" {
+		t.Errorf("Expected no login, got alias %q (err %v)", alias, err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("Expected no CLI calls, got %v", *calls)
+	}
+}
+
+func TestLoginFromEnv_AuthURL(t *testing.T) {
+	clearAuthEnv(t)
+	t.Setenv(EnvAuthURL, "force://PlatformCLI::token@example.my.salesforce.com")
+	calls := captureLogin(t, `{"status":0,"result":{"username":"ci@example.com"}}`)
+
+	alias, source, err := LoginFromEnv("", "")
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got: %v", err)
+	}
+	if alias != DefaultLoginAlias || source != EnvAuthURL {
+		t.Errorf("Expected alias %q from %s, got %q from %s", DefaultLoginAlias, EnvAuthURL, alias, source)
+	}
+	if !strings.HasPrefix((*calls)[0], "sf org login sfdx-url --sfdx-url-file ") || !strings.Contains((*calls)[0], "--alias apex-bench") {
+		t.Errorf("Unexpected login command: %v", *calls)
+	}
+	if (*calls)[1] != "file:force://PlatformCLI::token@example.my.salesforce.com" {
+		t.Errorf("Expected the auth URL in the file passed to sf, got %v", *calls)
+	}
+
+	// Commands such as serve create executors repeatedly
+	alias, _, err = LoginFromEnv("", "")
+	if err != nil || alias != DefaultLoginAlias || len(*calls) != 2 {
+		t.Errorf("Expected the login to be reused, got %q (err %v) after %v", alias, err, *calls)
+	}
+	if _, _, err := LoginFromEnv("other", ""); err != nil || len(*calls) != 4 {
+		t.Errorf("Expected another alias to log in again, got %v (err %v)", *calls, err)
+	}
+}
+
+func TestLoginFromEnv_JWT(t *testing.T) {
+	clearAuthEnv(t)
+	t.Setenv(EnvJWTKeyFile, "server.key")
+	t.Setenv(EnvConsumerKey, "3MVG9")
+	t.Setenv(EnvUsername, "ci@example.com")
+	t.Setenv(EnvLoginURL, "https://test.salesforce.com")
+	calls := captureLogin(t, `{"status":0,"result":{"username":"ci@example.com"}}`)
+
+	alias, _, err := LoginFromEnv("ci-org", "")
+	if err != nil || alias != "ci-org" {
+		t.Fatalf("Expected login as ci-org, got %q (err %v)", alias, err)
+	}
+	expected := "sf org login jwt --jwt-key-file server.key --client-id 3MVG9 --username ci@example.com --alias ci-org --json --instance-url https://test.salesforce.com"
+	if (*calls)[0] != expected {
+		t.Errorf("Expected %q, got %q", expected, (*calls)[0])
+	}
+}
+
+func TestLoginFromEnv_IncompleteJWT(t *testing.T) {
+	clearAuthEnv(t)
+	t.Setenv(EnvJWTKeyFile, "server.key")
+	captureLogin(t, "{}")
+
+	if _, _, err := LoginFromEnv("", ""); err == nil || !strings.Contains(err.Error(), EnvConsumerKey) {
+		t.Errorf("Expected missing variable error, got: %v", err)
+	}
+}
+
+func TestLoginFromEnv_Failure(t *testing.T) {
+	clearAuthEnv(t)
+	t.Setenv(EnvAuthURL, "force://bad")
+	captureLogin(t, `{"status":1,"message":"Invalid SFDX authorization URL"}`)
+
+	_, _, err := LoginFromEnv("", "")
+	if err == nil || !strings.Contains(err.Error(), "Invalid SFDX authorization URL") {
+		t.Errorf("Expected login error with the CLI message, got: %v", err)
+	}
+}
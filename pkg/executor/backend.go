@@ -0,0 +1,115 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBackend is the backend used when none is selected
+const DefaultBackend = "sf-cli"
+
+// Backend describes a registered way of executing anonymous Apex
+type Backend struct {
+	Name        string
+	Description string
+	RequiresOrg bool         // Needs a target org
+	Check       func() error // Verifies the backend's tools are installed; may be nil
+	New         func(opts Options) (Executor, error)
+}
+
+// Options configures backends when they are created
+type Options struct {
+	ReplayDir string // Recordings to replay, for the replay backend
+	TempDir   string // Directory for the scripts of CLI backends; empty uses the system default
+	KeepTemp  bool   // Leave the scripts of CLI backends in TempDir after each execution
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Backend)
+)
+
+func init() {
+	Register(Backend{
+		Name:        "sf-cli",
+		Description: "runs each execution with sf apex run",
+		RequiresOrg: true,
+		Check:       CheckSalesforceCLI,
+		New: func(opts Options) (Executor, error) {
+			e := NewCLIExecutor()
+			e.TempDir, e.KeepTemp = opts.TempDir, opts.KeepTemp
+			return e, nil
+		},
+	})
+	Register(Backend{
+		Name:        "sfdx",
+		Description: "runs each execution with the legacy sfdx force:apex:execute",
+		RequiresOrg: true,
+		Check:       CheckLegacyCLI,
+		New: func(opts Options) (Executor, error) {
+			e := NewLegacyCLIExecutor()
+			e.TempDir, e.KeepTemp = opts.TempDir, opts.KeepTemp
+			return e, nil
+		},
+	})
+	Register(Backend{
+		Name:        "soap-api",
+		Description: "calls executeAnonymous on the Apex SOAP API using the org's sf CLI session",
+		RequiresOrg: true,
+		Check:       CheckSalesforceCLI,
+		New:         func(Options) (Executor, error) { return NewAPIExecutor(), nil },
+	})
+	Register(Backend{
+		Name:        "mock",
+		Description: "returns simulated results without an org, for demos and tests",
+		New:         func(Options) (Executor, error) { return NewSimulatedExecutor(), nil },
+	})
+	Register(Backend{
+		Name:        "replay",
+		Description: "replays executions saved with --record, or plain debug logs",
+		New: func(opts Options) (Executor, error) {
+			if opts.ReplayDir == "" {
+				return nil, fmt.Errorf("the replay backend needs a recordings directory (--replay <dir>)")
+			}
+			return NewReplayExecutor(opts.ReplayDir)
+		},
+	})
+}
+
+// Register adds a backend, replacing any registered under the same name
+func Register(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[b.Name] = b
+}
+
+// LookupBackend returns the backend registered under name. An empty name
+// selects DefaultBackend.
+func LookupBackend(name string) (Backend, error) {
+	if name == "" {
+		name = DefaultBackend
+	}
+
+	backendsMu.RLock()
+	b, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return Backend{}, fmt.Errorf("unknown backend %q (expected %s)", name, strings.Join(BackendNames(), ", "))
+	}
+	return b, nil
+}
+
+// BackendNames returns the names of all registered backends, sorted
+func BackendNames() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLookupBackend(t *testing.T) {
+	b, err := LookupBackend("")
+	if err != nil || b.Name != DefaultBackend {
+		t.Errorf("Expected default backend %q, got %q (err %v)", DefaultBackend, b.Name, err)
+	}
+
+	for _, name := range []string{"sf-cli", "soap-api", "mock"} {
+		b, err := LookupBackend(name)
+		if err != nil {
+			t.Errorf("Expected backend %q, got error: %v", name, err)
+			continue
+		}
+		if exec, err := b.New(Options{}); err != nil || exec == nil {
+			t.Errorf("Backend %q failed to create an executor: %v", name, err)
+		}
+	}
+
+	_, err = LookupBackend("carrier-pigeon")
+	if err == nil || !strings.Contains(err.Error(), "sf-cli") {
+		t.Errorf("Expected unknown backend error listing backends, got: %v", err)
+	}
+}
+
+func TestRegister_AddsBackend(t *testing.T) {
+	Register(Backend{Name: "test-backend", New: func(Options) (Executor, error) { return &MockExecutor{}, nil }})
+	defer func() {
+		backendsMu.Lock()
+		delete(backends, "test-backend")
+		backendsMu.Unlock()
+	}()
+
+	found := false
+	for _, name := range BackendNames() {
+		found = found || name == "test-backend"
+	}
+	if !found {
+		t.Errorf("Expected registered backend in %v", BackendNames())
+	}
+}
+
+func TestSimulatedExecutor_Run(t *testing.T) {
+	code := "// Apex Benchmark - Generated Code\n// Benchmark: First\n// Iterations: 50\n// Warmup: 5\n// Benchmark: Second\n// Iterations: 20\n// Warmup: 5\n"
+
+	results, err := NewSimulatedExecutor().ExecuteParallel(context.Background(), ExecRequest{Code: code}, 2, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	logs := results[0].Logs
+	if strings.Count(logs, "BENCH_RESULT:") != 2 {
+		t.Errorf("Expected one BENCH_RESULT per benchmark, got: %s", logs)
+	}
+	if !strings.Contains(logs, `"name":"Second","iterations":20`) {
+		t.Errorf("Expected name and iterations from the header, got: %s", logs)
+	}
+}
+
+func TestSimulatedExecutor_Run_NoBenchmarks(t *testing.T) {
+	_, err := NewSimulatedExecutor().Run(context.Background(), ExecRequest{Code: "Integer a = 1;"})
+	if err == nil {
+		t.Error("Expected error for a script without benchmarks")
+	}
+}
@@ -0,0 +1,40 @@
+package executor
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// goos is the operating system CLI names are resolved for, a variable so
+// tests can resolve them as on Windows
+var goos = runtime.GOOS
+
+// windowsSuffixes are tried after a bare CLI name on Windows. The
+// Salesforce CLI installs sf.cmd and sfdx.cmd, which exec.LookPath finds
+// through PATHEXT, but corporate machines sometimes ship a PATHEXT without
+// .CMD.
+var windowsSuffixes = []string{".cmd", ".exe"}
+
+// cliPath resolves the name of a CLI such as sf to the executable on PATH.
+// When nothing is found, name is returned unchanged, so running it fails
+// with exec.ErrNotFound as before.
+func cliPath(name string) string {
+	candidates := []string{name}
+	if goos == "windows" {
+		for _, suffix := range windowsSuffixes {
+			candidates = append(candidates, name+suffix)
+		}
+	}
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path
+		}
+	}
+	return name
+}
+
+// cliCommand returns an exec.Cmd running the named CLI directly, without a
+// shell, so arguments such as temp file paths with spaces reach it intact
+func cliCommand(name string, args ...string) *exec.Cmd {
+	return exec.Command(cliPath(name), args...)
+}
@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeExecutable creates an empty executable file named name in dir
+func writeExecutable(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCLIPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("resolves extensionless names, which Windows does not run")
+	}
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	if got := cliPath("sf"); got != "sf" {
+		t.Errorf("cliPath() without sf on PATH = %q, want the bare name", got)
+	}
+	want := writeExecutable(t, dir, "sf")
+	if got := cliPath("sf"); got != want {
+		t.Errorf("cliPath() = %q, want %q", got, want)
+	}
+}
+
+func TestCLIPath_Windows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("simulates Windows name resolution on other systems")
+	}
+	oldGOOS := goos
+	defer func() { goos = oldGOOS }()
+	goos = "windows"
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	// The npm installer's sf.cmd is found even when PATHEXT lacks .CMD
+	want := writeExecutable(t, dir, "sf.cmd")
+	if got := cliPath("sf"); got != want {
+		t.Errorf("cliPath() = %q, want %q", got, want)
+	}
+	if got := cliPath("sfdx"); got != "sfdx" {
+		t.Errorf("cliPath() without sfdx on PATH = %q, want the bare name", got)
+	}
+}
@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// CountingExecutor wraps another Executor and counts the executions it
+// starts, failed ones included, for reporting what a session cost
+type CountingExecutor struct {
+	inner Executor
+	count atomic.Int64
+}
+
+// NewCountingExecutor creates an executor that counts inner's executions
+func NewCountingExecutor(inner Executor) *CountingExecutor {
+	return &CountingExecutor{inner: inner}
+}
+
+// Run executes req, counting the execution
+func (e *CountingExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	e.count.Add(1)
+	return e.inner.Run(ctx, req)
+}
+
+// ExecuteParallel runs the same Apex code multiple times in parallel,
+// counting each execution
+func (e *CountingExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
+
+// Executions returns the number of executions started so far
+func (e *CountingExecutor) Executions() int {
+	return int(e.count.Load())
+}
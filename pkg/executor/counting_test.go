@@ -0,0 +1,23 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCountingExecutor(t *testing.T) {
+	inner := &MockExecutor{Output: "ok"}
+	counting := NewCountingExecutor(inner)
+
+	if _, err := counting.ExecuteParallel(context.Background(), ExecRequest{Code: "x"}, 3, 1); err != nil {
+		t.Fatalf("ExecuteParallel() error = %v", err)
+	}
+	inner.Error = errors.New("boom")
+	if _, err := counting.Run(context.Background(), ExecRequest{Code: "x"}); err == nil {
+		t.Fatal("Expected the inner error")
+	}
+	if got := counting.Executions(); got != 4 {
+		t.Errorf("Executions() = %d, want 4", got)
+	}
+}
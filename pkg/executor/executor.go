@@ -1,33 +1,95 @@
 package executor
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
-	"golang.org/x/sync/semaphore"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/scheduler"
 )
 
-// execCommand is a variable that points to exec.Command
+// execCommand is a variable that points to cliCommand
 // This allows us to mock it in tests
-var execCommand = exec.Command
+var execCommand = cliCommand
 
 // Executor interface allows for mocking in tests
 type Executor interface {
-	Run(apexCode string, org string) (string, error)
-	ExecuteParallel(apexCode string, runs int, maxConcurrent int, org string) ([]string, error)
+	Run(ctx context.Context, req ExecRequest) (ExecResult, error)
+	ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error)
+}
+
+// ExecRequest describes one anonymous Apex execution
+type ExecRequest struct {
+	Code       string
+	Org        string        // Target org alias or username; empty uses the sf default
+	Timeout    time.Duration // Limit for a single execution; 0 means none
+	APIVersion string        // API version such as "62.0"; empty uses the org default
+	LogLevel   string        // Apex debug log level, for backends that can set one
+	Priority   int           // Higher priorities start first when executions queue
+	Delay      time.Duration // Pause between the executions of a parallel worker
+	Jitter     time.Duration // Random variation of Delay, up to this much either way
+}
+
+// ExecResult is the outcome of one execution
+type ExecResult struct {
+	Logs     string        // Debug log, which holds the BENCH_RESULT output
+	Raw      []byte        // Unparsed backend response
+	Duration time.Duration // Wall time of the execution, including CLI overhead
+	LogID    string        // Id of the ApexLog record, when the backend reports it
+	APIUsage *APIUsage     // Org API usage after the execution, when the backend reports it
+	Paused   time.Duration // Pause taken before the execution, with a Delay
 }
 
 // CLIExecutor implements Executor using the Salesforce CLI
-type CLIExecutor struct{}
+type CLIExecutor struct {
+	legacy bool // Use the sfdx force:apex:execute command set
+
+	TempDir  string // Directory the script of each execution is written to; empty uses the system default
+	KeepTemp bool   // Leave the scripts in TempDir after their executions, for inspection
+}
 
-// NewCLIExecutor creates a new executor that uses sf CLI
+// NewCLIExecutor creates a new executor that uses sf CLI, or sfdx when the
+// last CLI check fell back to it
 func NewCLIExecutor() *CLIExecutor {
-	return &CLIExecutor{}
+	return &CLIExecutor{legacy: UsingLegacyCLI()}
+}
+
+// NewLegacyCLIExecutor creates a new executor that uses the legacy sfdx
+// CLI, whose force:apex:execute reports the same JSON as sf apex run
+func NewLegacyCLIExecutor() *CLIExecutor {
+	return &CLIExecutor{legacy: true}
+}
+
+// apexRunCommand returns the command and arguments that execute file
+func (e *CLIExecutor) apexRunCommand(file string, req ExecRequest) (string, []string) {
+	if e.legacy {
+		args := []string{"force:apex:execute", "--apexcodefile", file, "--json"}
+		if req.Org != "" {
+			args = append(args, "--targetusername", req.Org)
+		}
+		if req.APIVersion != "" {
+			args = append(args, "--apiversion", req.APIVersion)
+		}
+		return "sfdx", args
+	}
+
+	args := []string{"apex", "run", "--file", file, "--json"}
+	if req.Org != "" {
+		args = append(args, "--target-org", req.Org)
+	}
+	if req.APIVersion != "" {
+		args = append(args, "--api-version", req.APIVersion)
+	}
+	return "sf", args
 }
 
 // ApexRunResponse represents the JSON response from `sf apex run --json`
@@ -64,48 +126,120 @@ type ApexRunResponse struct {
 	} `json:"result"`
 }
 
-// Run executes Apex code once and returns the debug log output
-func (e *CLIExecutor) Run(apexCode string, org string) (string, error) {
+// CompileError reports an Apex compilation failure. Line and Column refer to
+// the generated script and are -1 when sf does not report a position.
+type CompileError struct {
+	Problem string `json:"problem"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+func (e *CompileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("Apex compilation failed: %s (line %d, column %d)", e.Problem, e.Line, e.Column)
+	}
+	return fmt.Sprintf("Apex compilation failed: %s", e.Problem)
+}
+
+// Run executes Apex code once and returns the debug log output. The sf
+// process is killed when ctx is done or req.Timeout expires.
+func (e *CLIExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
 	// Create temp file
-	tempFile, err := createTempApexFile(apexCode)
+	tempFile, err := createTempApexFile(e.TempDir, req.Code)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return ExecResult{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if !e.KeepTemp {
+		defer os.Remove(tempFile)
 	}
-	defer os.Remove(tempFile)
 
-	// Build sf command with --json flag for structured output
-	args := []string{"apex", "run", "--file", tempFile, "--json"}
-	if org != "" {
-		args = append(args, "--target-org", org)
+	// Build the CLI command with --json flag for structured output. Neither
+	// command has a debug level option, so req.LogLevel is not forwarded.
+	command, args := e.apexRunCommand(tempFile, req)
+	label := command + " " + args[0]
+	if !e.legacy {
+		label += " " + args[1]
+	}
+
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
 	}
 
 	// Execute command
-	cmd := execCommand("sf", args...)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("sf apex run failed: %w\nOutput: %s", err, string(output))
+	start := time.Now()
+	output, runErr := runCommand(ctx, execCommand(command, args...))
+	result := ExecResult{Raw: output, Duration: time.Since(start)}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) && req.Timeout > 0 {
+			return result, fmt.Errorf("%s timed out after %s: %w", label, req.Timeout, ctxErr)
+		}
+		return result, fmt.Errorf("%s interrupted: %w", label, ctxErr)
 	}
 
-	// Parse JSON response
+	// Parse JSON response. sf exits non-zero when Apex fails to compile or
+	// throws, but still reports the details as JSON on stdout.
 	var response ApexRunResponse
 	if err := json.Unmarshal(output, &response); err != nil {
-		return "", fmt.Errorf("failed to parse sf apex run JSON output: %w\nOutput: %s", err, string(output))
+		if runErr != nil {
+			return result, fmt.Errorf("%s failed: %w\nOutput: %s", label, runErr, string(output))
+		}
+		return result, fmt.Errorf("failed to parse %s JSON output: %w\nOutput: %s", label, err, string(output))
 	}
 
 	// Check if execution was successful
 	if !response.Result.Success {
 		if !response.Result.Compiled {
-			return "", fmt.Errorf("Apex compilation failed: %s", response.Result.CompileProblem)
+			return result, &CompileError{
+				Problem: response.Result.CompileProblem,
+				Line:    response.Result.Line,
+				Column:  response.Result.Column,
+			}
 		}
-		return "", fmt.Errorf("Apex execution failed: %s", response.Result.ExceptionMessage)
+		return result, fmt.Errorf("Apex execution failed: %s", response.Result.ExceptionMessage)
+	}
+	if runErr != nil {
+		return result, fmt.Errorf("%s failed: %w\nOutput: %s", label, runErr, string(output))
 	}
 
-	// Return the logs which contain our BENCH_RESULT output
-	return response.Result.Logs, nil
+	// The logs contain our BENCH_RESULT output
+	result.Logs = response.Result.Logs
+	return result, nil
+}
+
+// runCommand runs cmd and returns its standard output, killing the process
+// when ctx is done
+func runCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return stdout.Bytes(), err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return stdout.Bytes(), ctx.Err()
+	}
 }
 
 // ExecuteParallel runs the same Apex code multiple times in parallel
-func (e *CLIExecutor) ExecuteParallel(apexCode string, runs int, maxConcurrent int, org string) ([]string, error) {
+func (e *CLIExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
+
+// executeParallel calls run runs times from at most maxConcurrent workers.
+// Every call also waits for a slot of scheduler.Default, which limits the
+// executions of the whole process. It is shared by the backends'
+// ExecuteParallel methods.
+func executeParallel(ctx context.Context, run func(context.Context, ExecRequest) (ExecResult, error), req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
 	if runs <= 0 {
 		return nil, fmt.Errorf("runs must be positive, got %d", runs)
 	}
@@ -113,55 +247,130 @@ func (e *CLIExecutor) ExecuteParallel(apexCode string, runs int, maxConcurrent i
 		maxConcurrent = 1
 	}
 
-	// Create semaphore for rate limiting
-	sem := semaphore.NewWeighted(int64(maxConcurrent))
-	ctx := context.Background()
-
-	results := make([]string, runs)
+	results := make([]ExecResult, runs)
 	errors := make([]error, runs)
-	var wg sync.WaitGroup
-
+	indexes := make(chan int, runs)
 	for i := 0; i < runs; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(maxConcurrent, runs); w++ {
 		wg.Add(1)
-		go func(index int) {
+		go func() {
 			defer wg.Done()
-
-			// Acquire semaphore
-			if err := sem.Acquire(ctx, 1); err != nil {
-				errors[index] = fmt.Errorf("failed to acquire semaphore: %w", err)
-				return
+			first := true
+			for index := range indexes {
+				var paused time.Duration
+				if !first {
+					if paused, errors[index] = Pause(ctx, req.Delay, req.Jitter); errors[index] != nil {
+						continue
+					}
+				}
+				first = false
+				results[index], errors[index] = Schedule(ctx, run, req)
+				results[index].Paused = paused
 			}
-			defer sem.Release(1)
-
-			// Execute
-			output, err := e.Run(apexCode, org)
-			if err != nil {
-				errors[index] = err
-				return
-			}
-			results[index] = output
-		}(i)
+		}()
 	}
 
 	wg.Wait()
 
-	// Check for errors
-	var errorMessages []string
+	// Check for errors, keeping the runs that succeeded
+	runErrs := &RunErrors{}
 	for i, err := range errors {
 		if err != nil {
-			errorMessages = append(errorMessages, fmt.Sprintf("run %d: %v", i+1, err))
+			runErrs.Failed = append(runErrs.Failed, i+1)
+			runErrs.Errs = append(runErrs.Errs, err)
+		} else {
+			runErrs.Succeeded = append(runErrs.Succeeded, results[i])
 		}
 	}
-	if len(errorMessages) > 0 {
-		return nil, fmt.Errorf("execution errors:\n%s", strings.Join(errorMessages, "\n"))
+	if len(runErrs.Errs) > 0 {
+		return nil, runErrs
 	}
 
 	return results, nil
 }
 
-// createTempApexFile writes Apex code to a temporary file
-func createTempApexFile(apexCode string) (string, error) {
-	tmpFile, err := os.CreateTemp("", "apex-bench-*.apex")
+// Schedule calls run once a slot of scheduler.Default is free. When the org
+// rejects the execution for running too much Apex at once, the org's limit
+// is lowered and the execution retried, down to one at a time.
+func Schedule(ctx context.Context, run func(context.Context, ExecRequest) (ExecResult, error), req ExecRequest) (ExecResult, error) {
+	for {
+		release, err := scheduler.Default.Acquire(ctx, scheduler.Job{Org: req.Org, Priority: req.Priority})
+		if err != nil {
+			return ExecResult{}, fmt.Errorf("failed to acquire execution slot: %w", err)
+		}
+		result, err := run(ctx, req)
+		throttled := IsConcurrencyLimit(err) && scheduler.Default.Throttle(req.Org)
+		release()
+		if !throttled {
+			return result, err
+		}
+	}
+}
+
+// Pause waits delay, varied randomly by up to jitter either way, and
+// returns how long it waited. Spacing executions out spares shared orgs and
+// keeps runs from lining up with periodic work in the org. It returns early
+// with ctx's error when ctx is done.
+func Pause(ctx context.Context, delay, jitter time.Duration) (time.Duration, error) {
+	if jitter > 0 {
+		delay += time.Duration(rand.Int64N(int64(2*jitter)+1)) - jitter
+	}
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// concurrencyLimitPattern matches errors Salesforce returns when an org has
+// too many Apex requests in flight, such as "ConcurrentPerOrgLongTxn Limit
+// exceeded" or "Unable to process request. Concurrent requests limit exceeded."
+var concurrencyLimitPattern = regexp.MustCompile(`(?i)ConcurrentPerOrg\w*|concurrent\s+(apex\s+|requests?\s+)?limit\s+exceeded`)
+
+// IsConcurrencyLimit reports whether err is an org rejecting an execution
+// because too many run at once
+func IsConcurrencyLimit(err error) bool {
+	return err != nil && concurrencyLimitPattern.MatchString(err.Error())
+}
+
+// RunErrors is returned by ExecuteParallel when some runs fail. It keeps
+// the results of the runs that succeeded so callers can use them anyway;
+// each run's error can be inspected with errors.As.
+type RunErrors struct {
+	Succeeded []ExecResult // In run order
+	Failed    []int        // Numbers of the failed runs, from 1
+	Errs      []error      // Error of each failed run
+}
+
+func (e *RunErrors) Error() string {
+	var sb strings.Builder
+	sb.WriteString("execution errors:")
+	for i, err := range e.Errs {
+		fmt.Fprintf(&sb, "\nrun %d: %v", e.Failed[i], err)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the errors of the failed runs
+func (e *RunErrors) Unwrap() []error {
+	return e.Errs
+}
+
+// createTempApexFile writes Apex code to a temporary file in dir, or in the
+// system temporary directory when dir is empty
+func createTempApexFile(dir, apexCode string) (string, error) {
+	tmpFile, err := os.CreateTemp(dir, "apex-bench-*.apex")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -175,17 +384,44 @@ func createTempApexFile(apexCode string) (string, error) {
 	return tmpFile.Name(), nil
 }
 
-// CheckSalesforceCLI verifies that sf CLI is installed
+// CheckSalesforceCLI verifies that sf CLI is installed and records its
+// version, see DetectedCLIVersion. When sf is not found but the legacy sfdx
+// CLI is, sfdx is used instead; see UsingLegacyCLI.
 func CheckSalesforceCLI() error {
 	cmd := execCommand("sf", "--version")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		// Environments that have not migrated may only have sfdx
+		if errors.Is(err, exec.ErrNotFound) && CheckLegacyCLI() == nil {
+			return nil
+		}
 		return fmt.Errorf("sf CLI not found or not working: %w\nPlease install Salesforce CLI: https://developer.salesforce.com/tools/salesforcecli", err)
 	}
 
-	if !strings.Contains(string(output), "@salesforce/cli") {
+	version, err := ParseCLIVersion(string(output))
+	if err != nil || version.Package != SFPackage {
 		return fmt.Errorf("unexpected sf CLI output: %s", string(output))
 	}
+	setDetectedVersion(version, false)
+
+	return nil
+}
+
+// CheckLegacyCLI verifies that the sfdx CLI is installed and records its
+// version. Current sf installs also provide sfdx, reporting the sf version.
+// Afterwards org lookups use the sfdx command set.
+func CheckLegacyCLI() error {
+	cmd := execCommand("sfdx", "--version")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sfdx CLI not found or not working: %w", err)
+	}
+
+	version, err := ParseCLIVersion(string(output))
+	if err != nil {
+		return fmt.Errorf("unexpected sfdx CLI output: %s", string(output))
+	}
+	setDetectedVersion(version, true)
 
 	return nil
 }
@@ -219,6 +455,9 @@ type ConfigGetResponse struct {
 // GetDefaultOrg returns the default Salesforce org alias/username
 func GetDefaultOrg() (string, error) {
 	cmd := execCommand("sf", "config", "get", "target-org", "--json")
+	if UsingLegacyCLI() {
+		cmd = execCommand("sfdx", "force:config:get", "defaultusername", "--json")
+	}
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to get default org: %w", err)
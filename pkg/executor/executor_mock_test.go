@@ -1,11 +1,15 @@
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestHelperProcess is used by TestMain to provide mock command execution
@@ -99,14 +103,43 @@ func TestCLIExecutor_Run_Success(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	output, err := executor.Run("String s = 'test';", "test-org")
+	result, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
 
-	if !strings.Contains(output, "BENCH_RESULT") {
-		t.Errorf("Expected output to contain BENCH_RESULT, got: %s", output)
+	if !strings.Contains(result.Logs, "BENCH_RESULT") {
+		t.Errorf("Expected output to contain BENCH_RESULT, got: %s", result.Logs)
+	}
+}
+
+func TestCLIExecutor_Run_TempDir(t *testing.T) {
+	oldExecCommand := execCommand
+	execCommand = mockCommand
+	defer func() { execCommand = oldExecCommand }()
+
+	dir := t.TempDir()
+	executor := NewCLIExecutor()
+	executor.TempDir = dir
+	if _, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the script to be removed, found %d files", len(entries))
+	}
+
+	// KeepTemp leaves the script for inspection
+	executor.KeepTemp = true
+	if _, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'kept';", Org: "test-org"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".apex") {
+		t.Fatalf("Expected the script to be kept, got %v", entries)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, entries[0].Name())); string(content) != "String s = 'kept';" {
+		t.Errorf("Unexpected script %q", content)
 	}
 }
 
@@ -116,14 +149,14 @@ func TestCLIExecutor_Run_WithoutOrg(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	output, err := executor.Run("String s = 'test';", "")
+	result, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';"})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
 
-	if !strings.Contains(output, "BENCH_RESULT") {
-		t.Errorf("Expected output to contain BENCH_RESULT, got: %s", output)
+	if !strings.Contains(result.Logs, "BENCH_RESULT") {
+		t.Errorf("Expected output to contain BENCH_RESULT, got: %s", result.Logs)
 	}
 }
 
@@ -234,7 +267,7 @@ func TestExecuteParallel_Success(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	results, err := executor.ExecuteParallel("String s = 'test';", 3, 2, "test-org")
+	results, err := executor.ExecuteParallel(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"}, 3, 2)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -245,8 +278,8 @@ func TestExecuteParallel_Success(t *testing.T) {
 	}
 
 	for i, result := range results {
-		if !strings.Contains(result, "BENCH_RESULT") {
-			t.Errorf("Result %d: expected to contain BENCH_RESULT, got: %s", i, result)
+		if !strings.Contains(result.Logs, "BENCH_RESULT") {
+			t.Errorf("Result %d: expected to contain BENCH_RESULT, got: %s", i, result.Logs)
 		}
 	}
 }
@@ -258,7 +291,7 @@ func TestExecuteParallel_DefaultMaxConcurrent(t *testing.T) {
 
 	executor := NewCLIExecutor()
 	// Test with maxConcurrent = 0, should default to 1
-	results, err := executor.ExecuteParallel("String s = 'test';", 2, 0, "test-org")
+	results, err := executor.ExecuteParallel(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"}, 2, 0)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -274,7 +307,7 @@ func TestCreateTempApexFile_WriteError(t *testing.T) {
 	// For now, just test that it works with normal input
 	code := "String s = 'test';"
 
-	tempFile, err := createTempApexFile(code)
+	tempFile, err := createTempApexFile("", code)
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -300,7 +333,7 @@ func TestCLIExecutor_Run_Error(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	_, err := executor.Run("String s = 'test';", "test-org")
+	_, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"})
 
 	if err == nil {
 		t.Error("Expected error when command fails")
@@ -321,7 +354,7 @@ func TestExecuteParallel_SingleError(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	_, err := executor.ExecuteParallel("String s = 'test';", 3, 1, "test-org")
+	_, err := executor.ExecuteParallel(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"}, 3, 1)
 
 	if err == nil {
 		t.Error("Expected error when one execution fails")
@@ -330,6 +363,15 @@ func TestExecuteParallel_SingleError(t *testing.T) {
 	if !strings.Contains(err.Error(), "execution errors") {
 		t.Errorf("Expected 'execution errors' in error message, got: %v", err)
 	}
+
+	// The successful runs are kept
+	var runErrs *RunErrors
+	if !errors.As(err, &runErrs) {
+		t.Fatalf("Expected *RunErrors, got %T", err)
+	}
+	if len(runErrs.Succeeded) != 2 || len(runErrs.Failed) != 1 {
+		t.Errorf("Expected 2 runs to succeed and 1 to fail, got %d succeeded and failed runs %v", len(runErrs.Succeeded), runErrs.Failed)
+	}
 }
 
 func TestCheckSalesforceCLI_UnexpectedOutput(t *testing.T) {
@@ -424,7 +466,7 @@ func TestCLIExecutor_Run_CompilationError(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	_, err := executor.Run("String s = 'test';", "test-org")
+	_, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"})
 
 	if err == nil {
 		t.Error("Expected error for compilation failure")
@@ -433,6 +475,34 @@ func TestCLIExecutor_Run_CompilationError(t *testing.T) {
 	if !strings.Contains(err.Error(), "Apex compilation failed") {
 		t.Errorf("Expected 'Apex compilation failed' error, got: %v", err)
 	}
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("Expected *CompileError, got %T", err)
+	}
+	if compileErr.Line != 5 || compileErr.Column != 10 {
+		t.Errorf("Expected position 5:10, got %d:%d", compileErr.Line, compileErr.Column)
+	}
+}
+
+func TestCLIExecutor_Run_CompilationErrorWithNonZeroExit(t *testing.T) {
+	oldExecCommand := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		// sf exits with status 1 but still prints the JSON response
+		return exec.Command("sh", "-c", `echo '{"status":1,"result":{"success":false,"compiled":false,"compileProblem":"Variable does not exist: x","line":3,"column":1}}'; exit 1`)
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	executor := NewCLIExecutor()
+	_, err := executor.Run(context.Background(), ExecRequest{Code: "x = 1;", Org: "test-org"})
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("Expected *CompileError, got: %v", err)
+	}
+	if compileErr.Problem != "Variable does not exist: x" {
+		t.Errorf("Unexpected compile problem: %q", compileErr.Problem)
+	}
 }
 
 func TestCLIExecutor_Run_ExecutionError(t *testing.T) {
@@ -457,7 +527,7 @@ func TestCLIExecutor_Run_ExecutionError(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	_, err := executor.Run("String s = 'test';", "test-org")
+	_, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"})
 
 	if err == nil {
 		t.Error("Expected error for execution failure")
@@ -481,7 +551,7 @@ func TestCLIExecutor_Run_InvalidJSON(t *testing.T) {
 	defer func() { execCommand = oldExecCommand }()
 
 	executor := NewCLIExecutor()
-	_, err := executor.Run("String s = 'test';", "test-org")
+	_, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org"})
 
 	if err == nil {
 		t.Error("Expected error for invalid JSON")
@@ -491,3 +561,62 @@ func TestCLIExecutor_Run_InvalidJSON(t *testing.T) {
 		t.Errorf("Expected 'failed to parse' error, got: %v", err)
 	}
 }
+
+func TestCLIExecutor_Run_RequestOptions(t *testing.T) {
+	oldExecCommand := execCommand
+	var gotArgs []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return mockCommand(command, args...)
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	executor := NewCLIExecutor()
+	result, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Org: "test-org", APIVersion: "62.0"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	joined := strings.Join(gotArgs, " ")
+	if !strings.Contains(joined, "--target-org test-org") || !strings.Contains(joined, "--api-version 62.0") {
+		t.Errorf("Expected org and API version arguments, got: %v", gotArgs)
+	}
+	if !strings.Contains(string(result.Raw), `"status": 0`) {
+		t.Errorf("Expected raw sf response, got: %s", result.Raw)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("Expected positive duration, got %v", result.Duration)
+	}
+}
+
+func TestCLIExecutor_Run_Timeout(t *testing.T) {
+	oldExecCommand := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		return exec.Command("sleep", "5")
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	executor := NewCLIExecutor()
+	_, err := executor.Run(context.Background(), ExecRequest{Code: "String s = 'test';", Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout message, got: %v", err)
+	}
+}
+
+func TestCLIExecutor_Run_Canceled(t *testing.T) {
+	oldExecCommand := execCommand
+	execCommand = mockCommand
+	defer func() { execCommand = oldExecCommand }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	executor := NewCLIExecutor()
+	_, err := executor.Run(ctx, ExecRequest{Code: "String s = 'test';"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
@@ -1,10 +1,14 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/scheduler"
 )
 
 // MockExecutor implements Executor for testing
@@ -17,24 +21,24 @@ type MockExecutor struct {
 	ShouldDelay bool
 }
 
-func (m *MockExecutor) Run(apexCode string, org string) (string, error) {
+func (m *MockExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
 	m.CallCount++
-	m.LastCode = apexCode
-	m.LastOrg = org
+	m.LastCode = req.Code
+	m.LastOrg = req.Org
 	if m.Error != nil {
-		return "", m.Error
+		return ExecResult{}, m.Error
 	}
-	return m.Output, nil
+	return ExecResult{Logs: m.Output}, nil
 }
 
-func (m *MockExecutor) ExecuteParallel(apexCode string, runs int, maxConcurrent int, org string) ([]string, error) {
-	results := make([]string, runs)
+func (m *MockExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	results := make([]ExecResult, runs)
 	for i := 0; i < runs; i++ {
-		output, err := m.Run(apexCode, org)
+		result, err := m.Run(ctx, req)
 		if err != nil {
 			return nil, err
 		}
-		results[i] = output
+		results[i] = result
 	}
 	return results, nil
 }
@@ -48,12 +52,13 @@ func TestCLIExecutor_Run_CreatesTempFile(t *testing.T) {
 
 func TestExecuteParallel_InvalidRuns(t *testing.T) {
 	executor := &CLIExecutor{}
-	_, err := executor.ExecuteParallel("String s = 'test';", 0, 1, "")
+	req := ExecRequest{Code: "String s = 'test';"}
+	_, err := executor.ExecuteParallel(context.Background(), req, 0, 1)
 	if err == nil {
 		t.Error("Expected error for zero runs")
 	}
 
-	_, err = executor.ExecuteParallel("String s = 'test';", -1, 1, "")
+	_, err = executor.ExecuteParallel(context.Background(), req, -1, 1)
 	if err == nil {
 		t.Error("Expected error for negative runs")
 	}
@@ -68,13 +73,13 @@ func TestMockExecutor_Run(t *testing.T) {
 	code := "String s = 'test';"
 	org := "my-org"
 
-	output, err := mock.Run(code, org)
+	result, err := mock.Run(context.Background(), ExecRequest{Code: code, Org: org})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	if output != mock.Output {
-		t.Errorf("Expected output %q, got %q", mock.Output, output)
+	if result.Logs != mock.Output {
+		t.Errorf("Expected output %q, got %q", mock.Output, result.Logs)
 	}
 
 	if mock.LastCode != code {
@@ -96,7 +101,7 @@ func TestMockExecutor_Run_WithError(t *testing.T) {
 		Error: expectedErr,
 	}
 
-	_, err := mock.Run("String s = 'test';", "")
+	_, err := mock.Run(context.Background(), ExecRequest{Code: "String s = 'test';"})
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -112,7 +117,7 @@ func TestMockExecutor_ExecuteParallel(t *testing.T) {
 	}
 
 	runs := 5
-	results, err := mock.ExecuteParallel("String s = 'test';", runs, 2, "")
+	results, err := mock.ExecuteParallel(context.Background(), ExecRequest{Code: "String s = 'test';"}, runs, 2)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -122,8 +127,8 @@ func TestMockExecutor_ExecuteParallel(t *testing.T) {
 	}
 
 	for i, result := range results {
-		if result != mock.Output {
-			t.Errorf("Result %d: expected %q, got %q", i, mock.Output, result)
+		if result.Logs != mock.Output {
+			t.Errorf("Result %d: expected %q, got %q", i, mock.Output, result.Logs)
 		}
 	}
 
@@ -135,7 +140,7 @@ func TestMockExecutor_ExecuteParallel(t *testing.T) {
 func TestCreateTempApexFile(t *testing.T) {
 	code := "String s = 'hello';"
 
-	tempFile, err := createTempApexFile(code)
+	tempFile, err := createTempApexFile("", code)
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
@@ -185,3 +190,78 @@ func TestGetDefaultOrg(t *testing.T) {
 		t.Logf("Default org: %s", org)
 	}
 }
+
+func TestIsConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf("ConcurrentPerOrgLongTxn Limit exceeded"), true},
+		{fmt.Errorf("Unable to process request. Concurrent requests limit exceeded."), true},
+		{fmt.Errorf("unable to process request: concurrent Apex limit exceeded"), true},
+		{fmt.Errorf("Apex CPU time limit exceeded"), false},
+	}
+	for _, tt := range tests {
+		if got := IsConcurrencyLimit(tt.err); got != tt.want {
+			t.Errorf("IsConcurrencyLimit(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_ThrottlesOnConcurrencyLimit(t *testing.T) {
+	org := "throttle-test-org"
+	defer scheduler.Default.SetOrgLimit(org, 0)
+
+	calls := 0
+	run := func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+		calls++
+		if calls == 1 {
+			return ExecResult{}, fmt.Errorf("ConcurrentPerOrgLongTxn Limit exceeded")
+		}
+		return ExecResult{Logs: "ok"}, nil
+	}
+
+	result, err := Schedule(context.Background(), run, ExecRequest{Org: org})
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if result.Logs != "ok" || calls != 2 {
+		t.Errorf("Expected one retry, got %d calls and logs %q", calls, result.Logs)
+	}
+
+	// Once the org runs one execution at a time, the error is returned
+	calls = 0
+	failing := func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+		calls++
+		return ExecResult{}, fmt.Errorf("ConcurrentPerOrgLongTxn Limit exceeded")
+	}
+	if _, err := Schedule(context.Background(), failing, ExecRequest{Org: org}); err == nil {
+		t.Error("Expected the error once the limit cannot drop further")
+	}
+	if calls != 1 {
+		t.Errorf("Expected no retry at a limit of 1, got %d calls", calls)
+	}
+}
+
+func TestPause(t *testing.T) {
+	for range 20 {
+		paused, err := Pause(context.Background(), 2*time.Millisecond, time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paused < time.Millisecond || paused > 3*time.Millisecond {
+			t.Errorf("Expected a pause of 2ms ± 1ms, got %v", paused)
+		}
+	}
+
+	if paused, err := Pause(context.Background(), 0, 0); err != nil || paused != 0 {
+		t.Errorf("Expected no pause without a delay, got %v, %v", paused, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Pause(ctx, time.Hour, 0); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
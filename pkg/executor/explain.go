@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// QueryExplainer is implemented by executors that can fetch the query
+// optimizer's plan for a SOQL query
+type QueryExplainer interface {
+	ExplainQuery(ctx context.Context, org, query string) (types.QueryPlan, error)
+}
+
+// explainResponse is the body returned by /query/?explain=. Plans are
+// sorted by relative cost, so the first one is what the optimizer picks.
+type explainResponse struct {
+	Plans []struct {
+		Cardinality          int     `json:"cardinality"`
+		LeadingOperationType string  `json:"leadingOperationType"`
+		RelativeCost         float64 `json:"relativeCost"`
+		SobjectCardinality   int     `json:"sobjectCardinality"`
+		SobjectType          string  `json:"sobjectType"`
+		Notes                []struct {
+			Description string `json:"description"`
+		} `json:"notes"`
+	} `json:"plans"`
+}
+
+// apiError is an entry of a REST API error response
+type apiError struct {
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+}
+
+// ExplainQuery fetches the plan the optimizer would use for query from the
+// REST API's explain resource. An expired session is refreshed once.
+func (e *APIExecutor) ExplainQuery(ctx context.Context, org, query string) (types.QueryPlan, error) {
+	plan, err := e.explain(ctx, org, query, false)
+	if errors.Is(err, errInvalidSession) {
+		plan, err = e.explain(ctx, org, query, true)
+	}
+	return plan, err
+}
+
+// explain performs one explain request, optionally fetching a fresh
+// session first
+func (e *APIExecutor) explain(ctx context.Context, org, query string, refresh bool) (types.QueryPlan, error) {
+	session, err := e.session(org, refresh)
+	if err != nil {
+		return types.QueryPlan{}, err
+	}
+
+	endpoint := strings.TrimRight(session.InstanceURL, "/") + "/services/data/v" + session.APIVersion + "/query/?explain=" + url.QueryEscape(query)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return types.QueryPlan{}, fmt.Errorf("failed to build explain request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return types.QueryPlan{}, fmt.Errorf("explain request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return types.QueryPlan{}, fmt.Errorf("failed to read explain response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errs []apiError
+		if json.Unmarshal(raw, &errs) != nil || len(errs) == 0 {
+			return types.QueryPlan{}, fmt.Errorf("explain failed (HTTP %d): %s", resp.StatusCode, string(raw))
+		}
+		if errs[0].ErrorCode == "INVALID_SESSION_ID" && !refresh {
+			return types.QueryPlan{}, errInvalidSession
+		}
+		return types.QueryPlan{}, fmt.Errorf("explain failed: %s: %s", errs[0].ErrorCode, errs[0].Message)
+	}
+
+	var response explainResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return types.QueryPlan{}, fmt.Errorf("failed to parse explain response: %w", err)
+	}
+	if len(response.Plans) == 0 {
+		return types.QueryPlan{}, fmt.Errorf("explain returned no plans")
+	}
+
+	p := response.Plans[0]
+	plan := types.QueryPlan{
+		Query:              query,
+		LeadingOperation:   p.LeadingOperationType,
+		SobjectType:        p.SobjectType,
+		RelativeCost:       p.RelativeCost,
+		Cardinality:        p.Cardinality,
+		SobjectCardinality: p.SobjectCardinality,
+	}
+	for _, note := range p.Notes {
+		plan.Notes = append(plan.Notes, note.Description)
+	}
+	return plan, nil
+}
+
+// ExplainQuery returns a plausible plan for query without an org. The
+// same query always gets the same plan.
+func (e *SimulatedExecutor) ExplainQuery(ctx context.Context, org, query string) (types.QueryPlan, error) {
+	if err := ctx.Err(); err != nil {
+		return types.QueryPlan{}, err
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(query))
+	seed := h.Sum32()
+
+	plan := types.QueryPlan{
+		Query:              query,
+		LeadingOperation:   "TableScan",
+		RelativeCost:       0.5 + float64(seed%150)/100,
+		SobjectCardinality: 1000 + int(seed%9000),
+	}
+	if fields := strings.Fields(query); len(fields) > 0 {
+		for i, field := range fields[:len(fields)-1] {
+			if strings.EqualFold(field, "FROM") {
+				plan.SobjectType = fields[i+1]
+				break
+			}
+		}
+	}
+	plan.Cardinality = plan.SobjectCardinality
+	if strings.Contains(strings.ToUpper(query), " WHERE ") {
+		plan.LeadingOperation = "Index"
+		plan.RelativeCost /= 10
+		plan.Cardinality = plan.SobjectCardinality / 100
+	}
+	return plan, nil
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPIExecutor_ExplainQuery(t *testing.T) {
+	var gotPath, gotQuery, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotQuery = r.URL.Query().Get("explain")
+		gotAuth = r.Header.Get("Authorization")
+		io.WriteString(w, `{"plans":[
+			{"cardinality":12,"fields":["Name"],"leadingOperationType":"Index","notes":[],"relativeCost":0.05,"sobjectCardinality":1200,"sobjectType":"Account"},
+			{"cardinality":12,"fields":[],"leadingOperationType":"TableScan","notes":[{"description":"Not considering filter for optimization because unindexed","fields":["IsDeleted"],"tableEnumOrId":"Account"}],"relativeCost":0.9,"sobjectCardinality":1200,"sobjectType":"Account"}
+		]}`)
+	}))
+	defer server.Close()
+	mockOrgDisplay(t, server.URL)
+
+	query := "SELECT Id FROM Account WHERE Name = 'Acme'"
+	plan, err := NewAPIExecutor().ExplainQuery(context.Background(), "test-org", query)
+	if err != nil {
+		t.Fatalf("ExplainQuery() error = %v", err)
+	}
+	if gotPath != "/services/data/v62.0/query/" || gotQuery != query || gotAuth != "Bearer token-x" {
+		t.Errorf("Unexpected request: path %s, explain %q, auth %q", gotPath, gotQuery, gotAuth)
+	}
+	if plan.Query != query || plan.LeadingOperation != "Index" || plan.SobjectType != "Account" ||
+		plan.RelativeCost != 0.05 || plan.Cardinality != 12 || plan.SobjectCardinality != 1200 || plan.Notes != nil {
+		t.Errorf("Expected the cheapest plan, got %+v", plan)
+	}
+}
+
+func TestAPIExecutor_ExplainQuery_Errors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `[{"message":"Session expired or invalid","errorCode":"INVALID_SESSION_ID"}]`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `[{"message":"unexpected token: FORM","errorCode":"MALFORMED_QUERY"}]`)
+	}))
+	defer server.Close()
+	calls := mockOrgDisplay(t, server.URL)
+
+	_, err := NewAPIExecutor().ExplainQuery(context.Background(), "test-org", "SELECT Id FORM Account")
+	if err == nil || !strings.Contains(err.Error(), "MALFORMED_QUERY: unexpected token: FORM") {
+		t.Errorf("Expected the API error, got %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("Expected the session to be refreshed, got %d org display calls", *calls)
+	}
+}
+
+func TestSimulatedExecutor_ExplainQuery(t *testing.T) {
+	e := NewSimulatedExecutor()
+	query := "SELECT Id FROM Contact WHERE Email = 'a@b.c'"
+	first, err := e.ExplainQuery(context.Background(), "", query)
+	if err != nil {
+		t.Fatalf("ExplainQuery() error = %v", err)
+	}
+	second, _ := e.ExplainQuery(context.Background(), "", query)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same plan for the same query, got %+v and %+v", first, second)
+	}
+	if first.SobjectType != "Contact" || first.LeadingOperation != "Index" {
+		t.Errorf("Unexpected plan: %+v", first)
+	}
+}
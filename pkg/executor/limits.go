@@ -0,0 +1,183 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// ErrAPIBudget is returned when an execution would take the org's remaining
+// daily API requests below the configured floor
+var ErrAPIBudget = errors.New("org API request budget exhausted")
+
+// APIUsage is an org's daily API request usage
+type APIUsage struct {
+	Used int `json:"used"`
+	Max  int `json:"max"`
+}
+
+// Remaining returns the number of API requests left today
+func (u APIUsage) Remaining() int {
+	return u.Max - u.Used
+}
+
+// limitInfoPattern matches the api-usage part of a Sforce-Limit-Info
+// response header, e.g. "api-usage=25/15000"
+var limitInfoPattern = regexp.MustCompile(`api-usage=(\d+)/(\d+)`)
+
+// ParseLimitInfo extracts API usage from a Sforce-Limit-Info header
+func ParseLimitInfo(header string) (APIUsage, bool) {
+	match := limitInfoPattern.FindStringSubmatch(header)
+	if match == nil {
+		return APIUsage{}, false
+	}
+	used, _ := strconv.Atoi(match[1])
+	max, _ := strconv.Atoi(match[2])
+	return APIUsage{Used: used, Max: max}, true
+}
+
+// LimitsResponse represents the JSON response from `sf limits api display --json`
+//
+// Expected JSON structure:
+//
+//	{
+//	  "status": 0,
+//	  "result": [
+//	    {"name": "DailyApiRequests", "max": 15000, "remaining": 14975}
+//	  ]
+//	}
+type LimitsResponse struct {
+	Status int `json:"status"`
+	Result []struct {
+		Name      string `json:"name"`
+		Max       int    `json:"max"`
+		Remaining int    `json:"remaining"`
+	} `json:"result"`
+}
+
+// GetAPIUsage asks the CLI for the org's daily API request usage
+func GetAPIUsage(org string) (APIUsage, error) {
+	command, args := "sf", []string{"limits", "api", "display", "--json"}
+	if org != "" {
+		args = append(args, "--target-org", org)
+	}
+	if UsingLegacyCLI() {
+		command, args = "sfdx", []string{"force:limits:api:display", "--json"}
+		if org != "" {
+			args = append(args, "--targetusername", org)
+		}
+	}
+
+	output, err := execCommand(command, args...).Output()
+	if err != nil {
+		return APIUsage{}, fmt.Errorf("failed to get API limits: %w", err)
+	}
+
+	var response LimitsResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return APIUsage{}, fmt.Errorf("failed to parse API limits output: %w", err)
+	}
+	for _, limit := range response.Result {
+		if limit.Name == "DailyApiRequests" {
+			return APIUsage{Used: limit.Max - limit.Remaining, Max: limit.Max}, nil
+		}
+	}
+	return APIUsage{}, fmt.Errorf("API limits output has no DailyApiRequests entry")
+}
+
+// budgetRefreshInterval is how many executions may run on an estimate
+// before usage is queried again while the budget is comfortable
+const budgetRefreshInterval = 10
+
+// BudgetExecutor wraps another Executor and keeps the org's remaining daily
+// API requests above a floor. Usage is taken from execution results when
+// the backend reports it and queried from the CLI otherwise. Within twice
+// the floor executions are serialized and usage is checked before each one;
+// below the floor they fail with ErrAPIBudget.
+type BudgetExecutor struct {
+	inner Executor
+	org   string
+	floor int
+	usage func(org string) (APIUsage, error)
+
+	mu        sync.Mutex
+	known     *APIUsage
+	sinceSync int // Executions since known was updated
+	serial    sync.Mutex
+}
+
+// NewBudgetExecutor creates an executor that stops before the org's
+// remaining daily API requests drop below floor
+func NewBudgetExecutor(inner Executor, org string, floor int) *BudgetExecutor {
+	return &BudgetExecutor{inner: inner, org: org, floor: floor, usage: GetAPIUsage}
+}
+
+// Run executes req when the API budget allows it
+func (e *BudgetExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	remaining, err := e.remaining()
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if remaining < e.floor {
+		return ExecResult{}, fmt.Errorf("%w: %d daily API requests left, floor is %d", ErrAPIBudget, remaining, e.floor)
+	}
+
+	// Close to the floor, run one execution at a time so each check sees the
+	// previous execution's usage
+	if remaining < 2*e.floor {
+		e.serial.Lock()
+		defer e.serial.Unlock()
+		e.mu.Lock()
+		if e.sinceSync > 0 {
+			e.known = nil
+		}
+		e.mu.Unlock()
+		if remaining, err = e.remaining(); err != nil {
+			return ExecResult{}, err
+		}
+		if remaining < e.floor {
+			return ExecResult{}, fmt.Errorf("%w: %d daily API requests left, floor is %d", ErrAPIBudget, remaining, e.floor)
+		}
+	}
+
+	result, err := e.inner.Run(ctx, req)
+
+	e.mu.Lock()
+	if result.APIUsage != nil {
+		usage := *result.APIUsage
+		e.known = &usage
+		e.sinceSync = 0
+	} else {
+		e.sinceSync++
+	}
+	e.mu.Unlock()
+
+	return result, err
+}
+
+// ExecuteParallel runs the same Apex code multiple times in parallel while
+// the API budget allows it
+func (e *BudgetExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
+
+// remaining returns the last known remaining API requests, querying them
+// when unknown or stale
+func (e *BudgetExecutor) remaining() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.known == nil || e.sinceSync >= budgetRefreshInterval {
+		usage, err := e.usage(e.org)
+		if err != nil {
+			return 0, err
+		}
+		e.known = &usage
+		e.sinceSync = 0
+	}
+	return e.known.Remaining(), nil
+}
@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParseLimitInfo(t *testing.T) {
+	usage, ok := ParseLimitInfo("api-usage=25/15000; per-app-api-usage=17/250(appName=sample)")
+	if !ok || usage.Used != 25 || usage.Max != 15000 || usage.Remaining() != 14975 {
+		t.Errorf("Expected 25/15000, got %+v (%v)", usage, ok)
+	}
+	if _, ok := ParseLimitInfo(""); ok {
+		t.Error("Expected no usage from an empty header")
+	}
+}
+
+func TestGetAPIUsage(t *testing.T) {
+	oldExecCommand := execCommand
+	var gotArgs []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return exec.Command("echo", `{"status":0,"result":[{"name":"DailyAsyncApexExecutions","max":250000,"remaining":250000},{"name":"DailyApiRequests","max":15000,"remaining":14000}]}`)
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	usage, err := GetAPIUsage("test-org")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if usage.Used != 1000 || usage.Max != 15000 {
+		t.Errorf("Expected 1000/15000, got %+v", usage)
+	}
+	if strings.Join(gotArgs, " ") != "limits api display --json --target-org test-org" {
+		t.Errorf("Unexpected arguments: %v", gotArgs)
+	}
+}
+
+func TestBudgetExecutor_AbortsBelowFloor(t *testing.T) {
+	inner := &MockExecutor{Output: "ok"}
+	budget := NewBudgetExecutor(inner, "test-org", 100)
+	budget.usage = func(string) (APIUsage, error) { return APIUsage{Used: 950, Max: 1000}, nil }
+
+	_, err := budget.ExecuteParallel(context.Background(), ExecRequest{Code: "x"}, 3, 2)
+	if !errors.Is(err, ErrAPIBudget) {
+		t.Fatalf("Expected ErrAPIBudget, got: %v", err)
+	}
+	if inner.CallCount != 0 {
+		t.Errorf("Expected no executions, got %d", inner.CallCount)
+	}
+}
+
+func TestBudgetExecutor_ThrottlesNearFloor(t *testing.T) {
+	inner := &MockExecutor{Output: "ok"}
+	budget := NewBudgetExecutor(inner, "test-org", 100)
+	remaining := 180
+	queries := 0
+	budget.usage = func(string) (APIUsage, error) {
+		queries++
+		remaining -= 20 // Each execution and query uses requests
+		return APIUsage{Used: 1000 - remaining, Max: 1000}, nil
+	}
+
+	results, err := budget.ExecuteParallel(context.Background(), ExecRequest{Code: "x"}, 5, 1)
+	if !errors.Is(err, ErrAPIBudget) {
+		t.Fatalf("Expected the budget to run out, got %v (%d results)", err, len(results))
+	}
+	if inner.CallCount == 0 || inner.CallCount >= 5 {
+		t.Errorf("Expected some but not all executions, got %d", inner.CallCount)
+	}
+	if queries < inner.CallCount {
+		t.Errorf("Expected usage to be checked before every execution near the floor, got %d queries for %d executions", queries, inner.CallCount)
+	}
+}
+
+func TestBudgetExecutor_UsesReportedUsage(t *testing.T) {
+	queries := 0
+	inner := &usageExecutor{usage: APIUsage{Used: 10, Max: 100000}}
+	budget := NewBudgetExecutor(inner, "test-org", 100)
+	budget.usage = func(string) (APIUsage, error) {
+		queries++
+		return APIUsage{Used: 0, Max: 100000}, nil
+	}
+
+	if _, err := budget.ExecuteParallel(context.Background(), ExecRequest{Code: "x"}, 25, 1); err != nil {
+		t.Fatalf("Expected success, got: %v", err)
+	}
+	if queries != 1 {
+		t.Errorf("Expected reported usage to replace CLI queries, got %d queries", queries)
+	}
+}
+
+// usageExecutor reports API usage with every result
+type usageExecutor struct {
+	usage APIUsage
+}
+
+func (e *usageExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	usage := e.usage
+	return ExecResult{APIUsage: &usage}, nil
+}
+
+func (e *usageExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"context"
+)
+
+// ObservingExecutor wraps another Executor and reports every execution it
+// finishes, failed ones included, for following a session's progress
+type ObservingExecutor struct {
+	inner   Executor
+	observe func(ExecResult, error)
+}
+
+// NewObservingExecutor creates an executor calling observe after each of
+// inner's executions. observe may be called from several goroutines at once.
+func NewObservingExecutor(inner Executor, observe func(ExecResult, error)) *ObservingExecutor {
+	return &ObservingExecutor{inner: inner, observe: observe}
+}
+
+// Run executes req and reports the execution
+func (e *ObservingExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	result, err := e.inner.Run(ctx, req)
+	e.observe(result, err)
+	return result, err
+}
+
+// ExecuteParallel runs the same Apex code multiple times in parallel,
+// reporting each execution as it finishes
+func (e *ObservingExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
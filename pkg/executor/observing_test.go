@@ -0,0 +1,34 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestObservingExecutor(t *testing.T) {
+	inner := &MockExecutor{Output: "ok"}
+	var mu sync.Mutex
+	succeeded, failed := 0, 0
+	observing := NewObservingExecutor(inner, func(result ExecResult, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+		} else if result.Logs == "ok" {
+			succeeded++
+		}
+	})
+
+	if _, err := observing.ExecuteParallel(context.Background(), ExecRequest{Code: "x"}, 3, 2); err != nil {
+		t.Fatalf("ExecuteParallel() error = %v", err)
+	}
+	inner.Error = errors.New("boom")
+	if _, err := observing.Run(context.Background(), ExecRequest{Code: "x"}); err == nil {
+		t.Fatal("Expected the inner error")
+	}
+	if succeeded != 3 || failed != 1 {
+		t.Errorf("Observed %d succeeded and %d failed executions, want 3 and 1", succeeded, failed)
+	}
+}
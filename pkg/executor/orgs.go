@@ -0,0 +1,159 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OrgInfo is an org authenticated in the Salesforce CLI
+type OrgInfo struct {
+	Alias       string `json:"alias,omitempty"`
+	Username    string `json:"username"`
+	InstanceURL string `json:"instanceUrl,omitempty"`
+	Status      string `json:"status,omitempty"` // e.g. "Connected" or, for scratch orgs, "Active"
+	IsDefault   bool   `json:"isDefault"`
+	IsScratch   bool   `json:"isScratch,omitempty"`
+}
+
+// orgListEntry is one org in `sf org list --json` output
+type orgListEntry struct {
+	Alias             string `json:"alias"`
+	Username          string `json:"username"`
+	InstanceURL       string `json:"instanceUrl"`
+	ConnectedStatus   string `json:"connectedStatus"`
+	Status            string `json:"status"`
+	IsDefaultUsername bool   `json:"isDefaultUsername"`
+}
+
+// OrgListResponse represents the JSON response from `sf org list --json`
+//
+// Expected JSON structure (sf also lists devHubs, sandboxes and other, which
+// repeat orgs from nonScratchOrgs):
+//
+//	{
+//	  "status": 0,
+//	  "result": {
+//	    "nonScratchOrgs": [
+//	      {
+//	        "alias": "dev",
+//	        "username": "me@example.com",
+//	        "instanceUrl": "https://example.my.salesforce.com",
+//	        "connectedStatus": "Connected",
+//	        "isDefaultUsername": true
+//	      }
+//	    ],
+//	    "scratchOrgs": [
+//	      {"alias": "scratch", "username": "test-x@example.com", "status": "Active"}
+//	    ]
+//	  }
+//	}
+type OrgListResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Result  struct {
+		NonScratchOrgs []orgListEntry `json:"nonScratchOrgs"`
+		DevHubs        []orgListEntry `json:"devHubs"`
+		Sandboxes      []orgListEntry `json:"sandboxes"`
+		Other          []orgListEntry `json:"other"`
+		ScratchOrgs    []orgListEntry `json:"scratchOrgs"`
+	} `json:"result"`
+}
+
+// ListOrgs returns the orgs authenticated in the CLI, each listed once
+func ListOrgs() ([]OrgInfo, error) {
+	cmd := execCommand("sf", "org", "list", "--json")
+	if UsingLegacyCLI() {
+		cmd = execCommand("sfdx", "force:org:list", "--json")
+	}
+	output, runErr := cmd.Output()
+
+	var response OrgListResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("failed to list orgs: %w", runErr)
+		}
+		return nil, fmt.Errorf("failed to parse org list output: %w", err)
+	}
+	if response.Status != 0 {
+		return nil, fmt.Errorf("failed to list orgs: %s", response.Message)
+	}
+
+	var orgs []OrgInfo
+	seen := make(map[string]bool)
+	add := func(entries []orgListEntry, scratch bool) {
+		for _, e := range entries {
+			if e.Username == "" || seen[e.Username] {
+				continue
+			}
+			seen[e.Username] = true
+			status := e.ConnectedStatus
+			if status == "" {
+				status = e.Status
+			}
+			orgs = append(orgs, OrgInfo{
+				Alias:       e.Alias,
+				Username:    e.Username,
+				InstanceURL: e.InstanceURL,
+				Status:      status,
+				IsDefault:   e.IsDefaultUsername,
+				IsScratch:   scratch,
+			})
+		}
+	}
+	add(response.Result.NonScratchOrgs, false)
+	add(response.Result.DevHubs, false)
+	add(response.Result.Sandboxes, false)
+	add(response.Result.Other, false)
+	add(response.Result.ScratchOrgs, true)
+	return orgs, nil
+}
+
+// ValidateOrg checks that name is the alias or username of one of orgs,
+// suggesting the closest match when it is not
+func ValidateOrg(name string, orgs []OrgInfo) error {
+	var best string
+	bestDistance := -1
+	for _, org := range orgs {
+		for _, candidate := range []string{org.Alias, org.Username} {
+			if candidate == "" {
+				continue
+			}
+			if candidate == name {
+				return nil
+			}
+			d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+			if bestDistance < 0 || d < bestDistance {
+				best, bestDistance = candidate, d
+			}
+		}
+	}
+
+	// Only suggest names that differ by a typo or two
+	if bestDistance >= 0 && bestDistance <= max(2, len(name)/3) {
+		return fmt.Errorf("unknown org %q; did you mean %q?", name, best)
+	}
+	return fmt.Errorf("unknown org %q (run `apex-bench orgs` to list authenticated orgs)", name)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
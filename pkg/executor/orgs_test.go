@@ -0,0 +1,105 @@
+package executor
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestListOrgs(t *testing.T) {
+	oldExecCommand := execCommand
+	var gotArgs []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return exec.Command("echo", `{"status":0,"result":{
+			"nonScratchOrgs":[
+				{"alias":"dev","username":"me@example.com","instanceUrl":"https://dev.my.salesforce.com","connectedStatus":"Connected","isDefaultUsername":true},
+				{"username":"hub@example.com","instanceUrl":"https://hub.my.salesforce.com","connectedStatus":"Connected"}
+			],
+			"devHubs":[{"username":"hub@example.com","connectedStatus":"Connected"}],
+			"scratchOrgs":[{"alias":"scratch","username":"test-x@example.com","status":"Active"}]
+		}}`)
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	orgs, err := ListOrgs()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Join(gotArgs, " ") != "org list --json" {
+		t.Errorf("Unexpected arguments: %v", gotArgs)
+	}
+	if len(orgs) != 3 {
+		t.Fatalf("Expected 3 orgs (dev hub listed once), got %d: %+v", len(orgs), orgs)
+	}
+	if orgs[0].Alias != "dev" || !orgs[0].IsDefault || orgs[0].Status != "Connected" {
+		t.Errorf("Unexpected first org: %+v", orgs[0])
+	}
+	if !orgs[2].IsScratch || orgs[2].Status != "Active" {
+		t.Errorf("Expected active scratch org, got %+v", orgs[2])
+	}
+}
+
+func TestListOrgs_Error(t *testing.T) {
+	oldExecCommand := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		return exec.Command("echo", `{"status":1,"message":"No orgs found"}`)
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	_, err := ListOrgs()
+	if err == nil || !strings.Contains(err.Error(), "No orgs found") {
+		t.Errorf("Expected CLI message in error, got: %v", err)
+	}
+}
+
+func TestValidateOrg(t *testing.T) {
+	orgs := []OrgInfo{
+		{Alias: "perf-sandbox", Username: "perf@example.com"},
+		{Username: "me@example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		org     string
+		wantErr string
+	}{
+		{"alias", "perf-sandbox", ""},
+		{"username", "me@example.com", ""},
+		{"typo", "perf-sandbx", `did you mean "perf-sandbox"?`},
+		{"unrelated", "production", "apex-bench orgs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOrg(tt.org, orgs)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"dev", "", 3},
+		{"kitten", "sitting", 3},
+		{"perf-sandbox", "perf-sandbx", 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
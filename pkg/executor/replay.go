@@ -0,0 +1,228 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+)
+
+// Recording is one execution saved by RecordingExecutor. Generated scripts
+// differ on every run, so recordings are matched by the benchmark names in
+// the script header rather than by code.
+type Recording struct {
+	Benchmarks   []string      `json:"benchmarks"`
+	Org          string        `json:"org,omitempty"`
+	Logs         string        `json:"logs"`
+	Raw          string        `json:"raw,omitempty"`
+	DurationMs   float64       `json:"durationMs"`
+	Error        string        `json:"error,omitempty"`
+	CompileError *CompileError `json:"compileError,omitempty"`
+}
+
+// recordingKey identifies the benchmarks of a script
+func recordingKey(names []string) string {
+	return strings.Join(names, "\x00")
+}
+
+// scriptKey returns the recording key of a generated script
+func scriptKey(code string) string {
+	benchmarks := scriptBenchmarks(code)
+	names := make([]string, len(benchmarks))
+	for i, b := range benchmarks {
+		names[i] = b.name
+	}
+	return recordingKey(names)
+}
+
+// RecordingExecutor wraps another Executor and saves every execution to a
+// directory as NNNN.json, continuing the numbering of earlier recordings
+type RecordingExecutor struct {
+	inner Executor
+	dir   string
+
+	// Masks secrets in the saved logs and errors; nil keeps them
+	Redactor *redact.Redactor
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewRecordingExecutor creates an executor that records inner's executions
+// to dir, creating it if needed
+func NewRecordingExecutor(inner Executor, dir string) (*RecordingExecutor, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording directory %s: %w", dir, err)
+	}
+
+	next := 1
+	for _, entry := range entries {
+		n, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return &RecordingExecutor{inner: inner, dir: dir, next: next}, nil
+}
+
+// Run executes req with the wrapped executor and records the outcome
+func (e *RecordingExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	result, err := e.inner.Run(ctx, req)
+	if saveErr := e.save(req, result, err); saveErr != nil {
+		return result, errors.Join(err, saveErr)
+	}
+	return result, err
+}
+
+// ExecuteParallel runs the same Apex code multiple times in parallel,
+// recording each execution
+func (e *RecordingExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
+
+// save writes one recording
+func (e *RecordingExecutor) save(req ExecRequest, result ExecResult, runErr error) error {
+	rec := Recording{
+		Org:        req.Org,
+		Logs:       e.Redactor.String(result.Logs),
+		Raw:        e.Redactor.String(string(result.Raw)),
+		DurationMs: float64(result.Duration) / float64(time.Millisecond),
+	}
+	for _, b := range scriptBenchmarks(req.Code) {
+		rec.Benchmarks = append(rec.Benchmarks, b.name)
+	}
+	if runErr != nil {
+		rec.Error = e.Redactor.String(runErr.Error())
+		var compileErr *CompileError
+		if errors.As(runErr, &compileErr) {
+			masked := *compileErr
+			masked.Problem = e.Redactor.String(masked.Problem)
+			rec.CompileError = &masked
+		}
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+
+	e.mu.Lock()
+	path := filepath.Join(e.dir, fmt.Sprintf("%04d.json", e.next))
+	e.next++
+	e.mu.Unlock()
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
+
+// ReplayExecutor implements Executor by returning saved executions. JSON
+// recordings are replayed for scripts with the same benchmarks; plain .log
+// files, such as debug logs attached to a bug report, are replayed for any
+// script that has no matching recording. Recordings are used in file name
+// order and reused from the start once exhausted.
+type ReplayExecutor struct {
+	recordings map[string][]Recording
+	logs       []Recording
+
+	mu   sync.Mutex
+	used map[string]int
+}
+
+// NewReplayExecutor loads the recordings and debug logs in dir
+func NewReplayExecutor(dir string) (*ReplayExecutor, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay directory %s: %w", dir, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	e := &ReplayExecutor{recordings: make(map[string][]Recording), used: make(map[string]int)}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		switch filepath.Ext(name) {
+		case ".json":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read recording %s: %w", path, err)
+			}
+			var rec Recording
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return nil, fmt.Errorf("failed to parse recording %s: %w", path, err)
+			}
+			key := recordingKey(rec.Benchmarks)
+			e.recordings[key] = append(e.recordings[key], rec)
+		case ".log":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read debug log %s: %w", path, err)
+			}
+			e.logs = append(e.logs, Recording{Logs: string(data)})
+		}
+	}
+
+	if len(e.recordings) == 0 && len(e.logs) == 0 {
+		return nil, fmt.Errorf("no recordings (*.json) or debug logs (*.log) found in %s", dir)
+	}
+	return e, nil
+}
+
+// Run returns the next saved execution for the script's benchmarks
+func (e *ReplayExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	if err := ctx.Err(); err != nil {
+		return ExecResult{}, err
+	}
+
+	key := scriptKey(req.Code)
+	candidates := e.recordings[key]
+	if len(candidates) == 0 {
+		key = ""
+		candidates = e.logs
+	}
+	if len(candidates) == 0 {
+		return ExecResult{}, fmt.Errorf("no recording for benchmarks %s", strings.ReplaceAll(scriptKey(req.Code), "\x00", ", "))
+	}
+
+	e.mu.Lock()
+	rec := candidates[e.used[key]%len(candidates)]
+	e.used[key]++
+	e.mu.Unlock()
+
+	result := ExecResult{
+		Logs:     rec.Logs,
+		Raw:      []byte(rec.Raw),
+		Duration: time.Duration(rec.DurationMs * float64(time.Millisecond)),
+	}
+	if rec.CompileError != nil {
+		return result, rec.CompileError
+	}
+	if rec.Error != "" {
+		return result, errors.New(rec.Error)
+	}
+	return result, nil
+}
+
+// ExecuteParallel returns the next runs saved executions
+func (e *ReplayExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const replayScript = "// Apex Benchmark - Generated Code\n// Benchmark: Concat\n// Iterations: 10\n// Warmup: 1\n"
+
+func TestRecordingExecutor_RecordsAndReplays(t *testing.T) {
+	dir := t.TempDir()
+	inner := &MockExecutor{Output: "USER_DEBUG|BENCH_RESULT:{\"name\":\"Concat\"}"}
+
+	recorder, err := NewRecordingExecutor(inner, dir)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	if _, err := recorder.ExecuteParallel(context.Background(), ExecRequest{Code: replayScript, Org: "test-org"}, 3, 2); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 recordings, got %v", files)
+	}
+
+	// A second recorder continues the numbering
+	recorder, err = NewRecordingExecutor(inner, dir)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	recorder.Run(context.Background(), ExecRequest{Code: replayScript})
+	if _, err := os.Stat(filepath.Join(dir, "0004.json")); err != nil {
+		t.Errorf("Expected 0004.json after existing recordings: %v", err)
+	}
+
+	replay, err := NewReplayExecutor(dir)
+	if err != nil {
+		t.Fatalf("Failed to load recordings: %v", err)
+	}
+	result, err := replay.Run(context.Background(), ExecRequest{Code: replayScript})
+	if err != nil {
+		t.Fatalf("Expected replayed result, got: %v", err)
+	}
+	if result.Logs != inner.Output {
+		t.Errorf("Expected recorded logs, got %q", result.Logs)
+	}
+
+	_, err = replay.Run(context.Background(), ExecRequest{Code: "// Benchmark: Other\n"})
+	if err == nil || !strings.Contains(err.Error(), "Other") {
+		t.Errorf("Expected missing recording error, got: %v", err)
+	}
+}
+
+func TestRecordingExecutor_RecordsCompileErrors(t *testing.T) {
+	dir := t.TempDir()
+	inner := &MockExecutor{Error: &CompileError{Problem: "Unexpected token", Line: 3, Column: 1}}
+
+	recorder, _ := NewRecordingExecutor(inner, dir)
+	recorder.Run(context.Background(), ExecRequest{Code: replayScript})
+
+	replay, err := NewReplayExecutor(dir)
+	if err != nil {
+		t.Fatalf("Failed to load recordings: %v", err)
+	}
+	_, err = replay.Run(context.Background(), ExecRequest{Code: replayScript})
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) || compileErr.Line != 3 {
+		t.Errorf("Expected replayed *CompileError at line 3, got: %v", err)
+	}
+}
+
+func TestReplayExecutor_DebugLogs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.log"), []byte("first"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.log"), []byte("second"), 0o644)
+
+	replay, err := NewReplayExecutor(dir)
+	if err != nil {
+		t.Fatalf("Failed to load debug logs: %v", err)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		result, err := replay.Run(context.Background(), ExecRequest{Code: replayScript})
+		if err != nil {
+			t.Fatalf("Expected replayed log, got: %v", err)
+		}
+		got = append(got, result.Logs)
+	}
+	if strings.Join(got, ",") != "first,second,first" {
+		t.Errorf("Expected logs in file order, reused once exhausted, got %v", got)
+	}
+}
+
+func TestNewReplayExecutor_Empty(t *testing.T) {
+	if _, err := NewReplayExecutor(t.TempDir()); err == nil {
+		t.Error("Expected error for a directory without recordings")
+	}
+}
@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// SimulatedExecutor implements Executor without an org. It reads the
+// benchmark names and iteration counts from the generated script header and
+// logs a plausible BENCH_RESULT for each, so the rest of the pipeline can be
+// exercised offline.
+type SimulatedExecutor struct{}
+
+// NewSimulatedExecutor creates an executor that returns simulated results
+func NewSimulatedExecutor() *SimulatedExecutor {
+	return &SimulatedExecutor{}
+}
+
+// Run returns a debug log with one simulated result per benchmark in the
+// script
+func (e *SimulatedExecutor) Run(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	if err := ctx.Err(); err != nil {
+		return ExecResult{}, err
+	}
+	start := time.Now()
+
+	benchmarks := scriptBenchmarks(req.Code)
+	if len(benchmarks) == 0 {
+		return ExecResult{}, fmt.Errorf("no benchmarks found in script")
+	}
+
+	var logs strings.Builder
+	for i, b := range benchmarks {
+		data, err := json.Marshal(simulateResult(b.name, b.iterations))
+		if err != nil {
+			return ExecResult{}, fmt.Errorf("failed to encode simulated result: %w", err)
+		}
+		fmt.Fprintf(&logs, "00:00:00.%03d (%d)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:%s\n", i, i+1, data)
+	}
+
+	return ExecResult{Logs: logs.String(), Raw: []byte(logs.String()), Duration: time.Since(start)}, nil
+}
+
+// ExecuteParallel runs the same script multiple times
+func (e *SimulatedExecutor) ExecuteParallel(ctx context.Context, req ExecRequest, runs int, maxConcurrent int) ([]ExecResult, error) {
+	return executeParallel(ctx, e.Run, req, runs, maxConcurrent)
+}
+
+// scriptBenchmark is a benchmark listed in a generated script header
+type scriptBenchmark struct {
+	name       string
+	iterations int
+}
+
+// scriptBenchmarks reads the "// Benchmark:" and "// Iterations:" header
+// lines of a generated script
+func scriptBenchmarks(code string) []scriptBenchmark {
+	var benchmarks []scriptBenchmark
+	scanner := bufio.NewScanner(strings.NewReader(code))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "// Benchmark: "); ok {
+			benchmarks = append(benchmarks, scriptBenchmark{name: name, iterations: 1})
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "// Iterations: "); ok && len(benchmarks) > 0 {
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				benchmarks[len(benchmarks)-1].iterations = n
+			}
+		}
+	}
+	return benchmarks
+}
+
+// simulateResult derives a stable per-name cost with a few percent of
+// run-to-run jitter
+func simulateResult(name string, iterations int) types.Result {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	base := 0.05 + float64(h.Sum32()%1000)/1000
+
+	avg := base * (0.95 + rand.Float64()*0.1)
+	return types.Result{
+		Name:        name,
+		Iterations:  iterations,
+		AvgCpuMs:    avg,
+		MinCpuMs:    avg * 0.8,
+		MaxCpuMs:    avg * 1.5,
+		AvgWallMs:   avg * 1.1,
+		MinWallMs:   avg * 0.9,
+		MaxWallMs:   avg * 1.7,
+		TotalWallMs: avg * 1.1 * float64(iterations),
+		Phases: &types.PhaseTimings{
+			MeasureWallMs: avg * 1.1 * float64(iterations),
+			MeasureCpuMs:  avg * float64(iterations),
+		},
+	}
+}
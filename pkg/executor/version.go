@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// CLI package names reported by --version
+const (
+	SFPackage   = "@salesforce/cli"
+	SFDXPackage = "sfdx-cli"
+)
+
+// CLIVersion is a Salesforce CLI version as reported by --version, e.g.
+// "@salesforce/cli/2.61.8 darwin-arm64 node-v20.17.0"
+type CLIVersion struct {
+	Package string // SFPackage or SFDXPackage
+	Major   int
+	Minor   int
+	Patch   int
+}
+
+func (v CLIVersion) String() string {
+	return fmt.Sprintf("%s/%d.%d.%d", v.Package, v.Major, v.Minor, v.Patch)
+}
+
+// cliVersionPattern matches the package and version in --version output
+var cliVersionPattern = regexp.MustCompile(`(@salesforce/cli|sfdx-cli)/(\d+)\.(\d+)\.(\d+)`)
+
+// ParseCLIVersion extracts the CLI version from --version output
+func ParseCLIVersion(output string) (CLIVersion, error) {
+	match := cliVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return CLIVersion{}, fmt.Errorf("unexpected sf CLI output: %s", output)
+	}
+
+	v := CLIVersion{Package: match[1]}
+	v.Major, _ = strconv.Atoi(match[2])
+	v.Minor, _ = strconv.Atoi(match[3])
+	v.Patch, _ = strconv.Atoi(match[4])
+	return v, nil
+}
+
+// Warning describes why v may not work, or returns "" for supported
+// versions. sf v1 predates the stable `apex run --json` output, and sfdx
+// older than v7 lacks `force:apex:execute --json`.
+func (v CLIVersion) Warning() string {
+	switch {
+	case v.Package == SFPackage && v.Major < 2:
+		return fmt.Sprintf("sf CLI %s is not supported; please update to v2 or later (npm install -g @salesforce/cli)", v)
+	case v.Package == SFDXPackage && v.Major < 7:
+		return fmt.Sprintf("sfdx CLI %s is not supported; please update to v7 or migrate to sf", v)
+	case v.Package == SFDXPackage:
+		return fmt.Sprintf("sfdx CLI %s is deprecated; consider migrating to sf", v)
+	}
+	return ""
+}
+
+var (
+	detectedMu      sync.Mutex
+	detectedVersion *CLIVersion
+	legacyCLI       bool
+)
+
+// DetectedCLIVersion returns the version found by the last successful
+// CheckSalesforceCLI or CheckLegacyCLI call
+func DetectedCLIVersion() (CLIVersion, bool) {
+	detectedMu.Lock()
+	defer detectedMu.Unlock()
+	if detectedVersion == nil {
+		return CLIVersion{}, false
+	}
+	return *detectedVersion, true
+}
+
+// UsingLegacyCLI reports whether the last CLI check selected sfdx, so that
+// invocations are translated to its force:* command set
+func UsingLegacyCLI() bool {
+	detectedMu.Lock()
+	defer detectedMu.Unlock()
+	return legacyCLI
+}
+
+// setDetectedVersion stores the version and command set found by a CLI check
+func setDetectedVersion(v CLIVersion, legacy bool) {
+	detectedMu.Lock()
+	defer detectedMu.Unlock()
+	detectedVersion = &v
+	legacyCLI = legacy
+}
@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParseCLIVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    CLIVersion
+		warning bool
+	}{
+		{"@salesforce/cli/2.61.8 darwin-arm64 node-v20.17.0", CLIVersion{SFPackage, 2, 61, 8}, false},
+		{"@salesforce/cli/1.86.0 linux-x64 node-v18.12.1", CLIVersion{SFPackage, 1, 86, 0}, true},
+		{"sfdx-cli/7.209.6 win32-x64 node-v18.16.0", CLIVersion{SFDXPackage, 7, 209, 6}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCLIVersion(tt.output)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.output, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.output, tt.want, got)
+		}
+		if (got.Warning() != "") != tt.warning {
+			t.Errorf("%q: unexpected warning %q", tt.output, got.Warning())
+		}
+	}
+
+	if _, err := ParseCLIVersion("command not found"); err == nil {
+		t.Error("Expected error for output without a version")
+	}
+}
+
+func TestCheckSalesforceCLI_RecordsVersion(t *testing.T) {
+	oldExecCommand := execCommand
+	execCommand = mockCommand
+	defer func() { execCommand = oldExecCommand }()
+
+	if err := CheckSalesforceCLI(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	v, ok := DetectedCLIVersion()
+	if !ok || v.String() != "@salesforce/cli/2.0.0" {
+		t.Errorf("Expected detected version @salesforce/cli/2.0.0, got %v (%v)", v, ok)
+	}
+}
+
+// resetDetectedCLI restores the state before any CLI check when the test ends
+func resetDetectedCLI(t *testing.T) {
+	t.Cleanup(func() {
+		detectedMu.Lock()
+		defer detectedMu.Unlock()
+		detectedVersion = nil
+		legacyCLI = false
+	})
+}
+
+func TestCheckLegacyCLI(t *testing.T) {
+	resetDetectedCLI(t)
+	oldExecCommand := execCommand
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		return exec.Command("echo", "sfdx-cli/7.209.6 darwin-arm64 node-v18.16.0")
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	if err := CheckLegacyCLI(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if v, _ := DetectedCLIVersion(); v.Package != SFDXPackage {
+		t.Errorf("Expected sfdx version, got %v", v)
+	}
+}
+
+func TestLegacyCLIExecutor_Run(t *testing.T) {
+	oldExecCommand := execCommand
+	var gotCommand string
+	var gotArgs []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		gotCommand, gotArgs = command, args
+		return exec.Command("echo", `{"status":0,"result":{"success":true,"compiled":true,"logs":"BENCH_RESULT:{}"}}`)
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	executor := NewLegacyCLIExecutor()
+	result, err := executor.Run(t.Context(), ExecRequest{Code: "Integer a = 1;", Org: "legacy-org", APIVersion: "58.0"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Logs != "BENCH_RESULT:{}" {
+		t.Errorf("Expected logs from the response, got %q", result.Logs)
+	}
+
+	joined := strings.Join(gotArgs, " ")
+	if gotCommand != "sfdx" || !strings.HasPrefix(joined, "force:apex:execute --apexcodefile ") ||
+		!strings.Contains(joined, "--targetusername legacy-org") || !strings.Contains(joined, "--apiversion 58.0") {
+		t.Errorf("Expected sfdx force:apex:execute arguments, got %s %v", gotCommand, gotArgs)
+	}
+}
+
+func TestCheckSalesforceCLI_FallsBackToSfdx(t *testing.T) {
+	resetDetectedCLI(t)
+	oldExecCommand := execCommand
+	var calls []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		calls = append(calls, command+" "+strings.Join(args, " "))
+		switch {
+		case command == "sf":
+			return exec.Command("apex-bench-nonexistent-sf")
+		case args[0] == "--version":
+			return exec.Command("echo", "sfdx-cli/7.209.6 linux-x64 node-v18.16.0")
+		default:
+			return exec.Command("echo", `{"status":0,"result":[{"key":"defaultusername","value":"legacy-org"}]}`)
+		}
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	if err := CheckSalesforceCLI(); err != nil {
+		t.Fatalf("Expected fallback to sfdx, got: %v", err)
+	}
+	if !UsingLegacyCLI() || !NewCLIExecutor().legacy {
+		t.Error("Expected the legacy command set to be selected")
+	}
+
+	org, err := GetDefaultOrg()
+	if err != nil || org != "legacy-org" {
+		t.Errorf("Expected default org from sfdx, got %q (err %v)", org, err)
+	}
+	if last := calls[len(calls)-1]; last != "sfdx force:config:get defaultusername --json" {
+		t.Errorf("Expected translated config lookup, got %q", last)
+	}
+}
@@ -0,0 +1,174 @@
+// Package exporter sends benchmark results to observability services as
+// custom metrics, so performance trends appear next to other monitoring
+// data. Exporters are registered by name and read their API keys from the
+// environment.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// MetricPrefix starts the name of every exported metric
+const MetricPrefix = "apex_bench."
+
+// Point is one metric value of a benchmark
+type Point struct {
+	Metric string // Full name, e.g. apex_bench.cpu_ms
+	Value  float64
+	Time   time.Time
+	Tags   map[string]string // e.g. benchmark, org and git_ref
+}
+
+// Tags describe where results come from, attached to every point
+type Tags struct {
+	Org    string
+	GitRef string
+}
+
+// Exporter describes a registered metrics service
+type Exporter struct {
+	Name        string
+	Description string
+	KeyEnv      string // Environment variable holding the API key
+	Export      func(ctx context.Context, key string, points []Point) error
+}
+
+var (
+	exportersMu sync.RWMutex
+	exporters   = make(map[string]Exporter)
+)
+
+// Register adds an exporter, replacing any with the same name
+func Register(e Exporter) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	exporters[e.Name] = e
+}
+
+// Lookup returns the exporter registered under name
+func Lookup(name string) (Exporter, error) {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+	e, ok := exporters[name]
+	if !ok {
+		return Exporter{}, fmt.Errorf("unknown exporter %q (available: %s)", name, strings.Join(namesLocked(), ", "))
+	}
+	return e, nil
+}
+
+// Names returns the names of the registered exporters, sorted
+func Names() []string {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check reports whether name is a registered exporter whose API key is set
+func Check(name string) error {
+	e, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	if os.Getenv(e.KeyEnv) == "" {
+		return fmt.Errorf("exporter %s needs an API key in %s", name, e.KeyEnv)
+	}
+	return nil
+}
+
+// Export sends the metrics of results to the exporter registered under
+// name. Failed and interrupted benchmarks are left out, so they do not skew
+// trends.
+func Export(ctx context.Context, name string, results []types.AggregatedResult, tags Tags, now time.Time) error {
+	e, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	key := os.Getenv(e.KeyEnv)
+	if key == "" {
+		return fmt.Errorf("exporter %s needs an API key in %s", name, e.KeyEnv)
+	}
+	points := Points(results, tags, now)
+	if len(points) == 0 {
+		return nil
+	}
+	if err := e.Export(ctx, key, points); err != nil {
+		return fmt.Errorf("failed to export to %s: %w", name, err)
+	}
+	return nil
+}
+
+// Points returns the metrics of results: CPU and wall time with their
+// deviations, and heap, SOQL and DML usage when they were tracked
+func Points(results []types.AggregatedResult, tags Tags, now time.Time) []Point {
+	var points []Point
+	for _, r := range results {
+		if r.Error != "" || r.Partial {
+			continue
+		}
+		pointTags := map[string]string{"benchmark": r.Name}
+		if tags.Org != "" {
+			pointTags["org"] = tags.Org
+		}
+		if tags.GitRef != "" {
+			pointTags["git_ref"] = tags.GitRef
+		}
+		add := func(metric string, value float64) {
+			points = append(points, Point{Metric: MetricPrefix + metric, Value: value, Time: now, Tags: pointTags})
+		}
+		add("cpu_ms", r.AvgCpuMs)
+		add("cpu_ms.stddev", r.StdDevCpuMs)
+		add("wall_ms", r.AvgWallMs)
+		add("wall_ms.stddev", r.StdDevWallMs)
+		if r.AvgHeapKb != nil {
+			add("heap_kb", *r.AvgHeapKb)
+		}
+		if r.AvgSoqlQueries != nil {
+			add("soql_queries", *r.AvgSoqlQueries)
+		}
+		if r.AvgDmlStatements != nil {
+			add("dml_statements", *r.AvgDmlStatements)
+		}
+	}
+	return points
+}
+
+// post sends body as JSON to url with the given headers and fails on any
+// status other than 2xx
+func post(ctx context.Context, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
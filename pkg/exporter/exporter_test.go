@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestPoints(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	results := []types.AggregatedResult{
+		{Name: "Concat", AvgCpuMs: 1.5, StdDevCpuMs: 0.1, AvgWallMs: 2, StdDevWallMs: 0.2, AvgHeapKb: floatPtr(12), AvgSoqlQueries: floatPtr(1)},
+		{Name: "Broken", Error: "compile error"},
+		{Name: "Stopped", Partial: true, AvgCpuMs: 9},
+	}
+
+	points := Points(results, Tags{Org: "dev", GitRef: "main"}, now)
+	var metrics []string
+	for _, p := range points {
+		metrics = append(metrics, p.Metric)
+		if p.Tags["benchmark"] != "Concat" || p.Tags["org"] != "dev" || p.Tags["git_ref"] != "main" || !p.Time.Equal(now) {
+			t.Errorf("Unexpected point %+v", p)
+		}
+	}
+	want := "apex_bench.cpu_ms apex_bench.cpu_ms.stddev apex_bench.wall_ms apex_bench.wall_ms.stddev apex_bench.heap_kb apex_bench.soql_queries"
+	if got := strings.Join(metrics, " "); got != want {
+		t.Errorf("Points() metrics = %s, want %s", got, want)
+	}
+	if points[0].Value != 1.5 || points[4].Value != 12 {
+		t.Errorf("Unexpected values: %+v", points)
+	}
+
+	// Empty tags are left out rather than sent blank
+	if tags := Points(results[:1], Tags{}, now)[0].Tags; len(tags) != 1 {
+		t.Errorf("Expected only the benchmark tag, got %v", tags)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Setenv("DD_API_KEY", "")
+	if err := Check("datadog"); err == nil || !strings.Contains(err.Error(), "DD_API_KEY") {
+		t.Errorf("Expected the missing key to be reported, got %v", err)
+	}
+	t.Setenv("DD_API_KEY", "key")
+	if err := Check("datadog"); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := Check("graphite"); err == nil || !strings.Contains(err.Error(), "datadog, newrelic") {
+		t.Errorf("Expected an unknown exporter to list the available ones, got %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got []Point
+	Register(Exporter{Name: "test", KeyEnv: "TEST_EXPORT_KEY", Export: func(ctx context.Context, key string, points []Point) error {
+		if key != "secret" {
+			t.Errorf("Expected the key from the environment, got %q", key)
+		}
+		got = points
+		return nil
+	}})
+	Register(Exporter{Name: "failing", KeyEnv: "TEST_EXPORT_KEY", Export: func(ctx context.Context, key string, points []Point) error {
+		return errors.New("503 Service Unavailable")
+	}})
+	defer func() {
+		exportersMu.Lock()
+		delete(exporters, "test")
+		delete(exporters, "failing")
+		exportersMu.Unlock()
+	}()
+	t.Setenv("TEST_EXPORT_KEY", "secret")
+
+	results := []types.AggregatedResult{{Name: "A", AvgCpuMs: 1}}
+	if err := Export(context.Background(), "test", results, Tags{}, time.Now()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("Expected 4 points, got %+v", got)
+	}
+	if err := Export(context.Background(), "failing", results, Tags{}, time.Now()); err == nil || !strings.Contains(err.Error(), "failed to export to failing") {
+		t.Errorf("Expected the export failure, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Environment variables selecting the account region of a service
+const (
+	DatadogSiteEnv     = "DD_SITE"          // e.g. datadoghq.eu; default datadoghq.com
+	NewRelicRegionEnv  = "NEW_RELIC_REGION" // EU for the EU data center; default US
+	datadogDefaultSite = "datadoghq.com"
+)
+
+// Service endpoints, variables so tests can point them at a local server
+var (
+	datadogURL = func() string {
+		site := os.Getenv(DatadogSiteEnv)
+		if site == "" {
+			site = datadogDefaultSite
+		}
+		return "https://api." + site + "/api/v2/series"
+	}
+	newRelicURL = func() string {
+		if strings.EqualFold(os.Getenv(NewRelicRegionEnv), "EU") {
+			return "https://metric-api.eu.newrelic.com/metric/v1"
+		}
+		return "https://metric-api.newrelic.com/metric/v1"
+	}
+)
+
+func init() {
+	Register(Exporter{
+		Name:        "datadog",
+		Description: "Datadog custom metrics, with an API key in DD_API_KEY (DD_SITE selects the site)",
+		KeyEnv:      "DD_API_KEY",
+		Export:      exportDatadog,
+	})
+	Register(Exporter{
+		Name:        "newrelic",
+		Description: "New Relic metrics, with a license key in NEW_RELIC_LICENSE_KEY (NEW_RELIC_REGION=EU for the EU region)",
+		KeyEnv:      "NEW_RELIC_LICENSE_KEY",
+		Export:      exportNewRelic,
+	})
+}
+
+// datadogGauge is the type of gauge series in the Datadog v2 series API
+const datadogGauge = 3
+
+// exportDatadog submits points as gauges to the Datadog series API, with
+// tags in Datadog's name:value form
+func exportDatadog(ctx context.Context, key string, points []Point) error {
+	type point struct {
+		Timestamp int64   `json:"timestamp"`
+		Value     float64 `json:"value"`
+	}
+	type series struct {
+		Metric string   `json:"metric"`
+		Type   int      `json:"type"`
+		Points []point  `json:"points"`
+		Tags   []string `json:"tags"`
+	}
+	payload := struct {
+		Series []series `json:"series"`
+	}{}
+	for _, p := range points {
+		payload.Series = append(payload.Series, series{
+			Metric: p.Metric,
+			Type:   datadogGauge,
+			Points: []point{{Timestamp: p.Time.Unix(), Value: p.Value}},
+			Tags:   datadogTags(p.Tags),
+		})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, datadogURL(), map[string]string{"DD-API-KEY": key}, body)
+}
+
+// datadogTags returns tags as sorted name:value strings
+func datadogTags(tags map[string]string) []string {
+	list := make([]string, 0, len(tags))
+	for name, value := range tags {
+		list = append(list, name+":"+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// exportNewRelic submits points as gauges to the New Relic Metric API, with
+// tags as attributes
+func exportNewRelic(ctx context.Context, key string, points []Point) error {
+	type metric struct {
+		Name       string            `json:"name"`
+		Type       string            `json:"type"`
+		Value      float64           `json:"value"`
+		Timestamp  int64             `json:"timestamp"` // Milliseconds since the epoch
+		Attributes map[string]string `json:"attributes"`
+	}
+	metrics := make([]metric, 0, len(points))
+	for _, p := range points {
+		metrics = append(metrics, metric{
+			Name:       p.Metric,
+			Type:       "gauge",
+			Value:      p.Value,
+			Timestamp:  p.Time.UnixMilli(),
+			Attributes: p.Tags,
+		})
+	}
+	body, err := json.Marshal([]struct {
+		Metrics []metric `json:"metrics"`
+	}{{Metrics: metrics}})
+	if err != nil {
+		return err
+	}
+	return post(ctx, newRelicURL(), map[string]string{"Api-Key": key}, body)
+}
@@ -0,0 +1,104 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capture starts a server recording the last request, and points url at it
+// for the test
+func capture(t *testing.T, url *func() string, status int) *http.Request {
+	t.Helper()
+	var last http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		last = *r.Clone(context.Background())
+		last.Body = io.NopCloser(strings.NewReader(string(body)))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	old := *url
+	*url = func() string { return server.URL }
+	t.Cleanup(func() { *url = old })
+	return &last
+}
+
+var testPoints = []Point{{
+	Metric: "apex_bench.cpu_ms",
+	Value:  1.5,
+	Time:   time.Unix(1767323045, 0),
+	Tags:   map[string]string{"benchmark": "Concat", "org": "dev"},
+}}
+
+func TestExportDatadog(t *testing.T) {
+	req := capture(t, &datadogURL, http.StatusAccepted)
+	if err := exportDatadog(context.Background(), "dd-key", testPoints); err != nil {
+		t.Fatalf("exportDatadog() error = %v", err)
+	}
+	if req.Method != http.MethodPost || req.Header.Get("DD-API-KEY") != "dd-key" {
+		t.Errorf("Unexpected request %s with key %q", req.Method, req.Header.Get("DD-API-KEY"))
+	}
+	body, _ := io.ReadAll(req.Body)
+	want := `{"series":[{"metric":"apex_bench.cpu_ms","type":3,"points":[{"timestamp":1767323045,"value":1.5}],"tags":["benchmark:Concat","org:dev"]}]}`
+	if string(body) != want {
+		t.Errorf("Unexpected payload:\n%s\nwant:\n%s", body, want)
+	}
+}
+
+func TestExportNewRelic(t *testing.T) {
+	req := capture(t, &newRelicURL, http.StatusAccepted)
+	if err := exportNewRelic(context.Background(), "nr-key", testPoints); err != nil {
+		t.Fatalf("exportNewRelic() error = %v", err)
+	}
+	if req.Header.Get("Api-Key") != "nr-key" {
+		t.Errorf("Expected the license key header, got %q", req.Header.Get("Api-Key"))
+	}
+	var payload []struct {
+		Metrics []struct {
+			Name       string            `json:"name"`
+			Type       string            `json:"type"`
+			Value      float64           `json:"value"`
+			Timestamp  int64             `json:"timestamp"`
+			Attributes map[string]string `json:"attributes"`
+		} `json:"metrics"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 1 || len(payload[0].Metrics) != 1 {
+		t.Fatalf("Unexpected payload: %+v", payload)
+	}
+	m := payload[0].Metrics[0]
+	if m.Name != "apex_bench.cpu_ms" || m.Type != "gauge" || m.Value != 1.5 || m.Timestamp != 1767323045000 || m.Attributes["benchmark"] != "Concat" {
+		t.Errorf("Unexpected metric: %+v", m)
+	}
+}
+
+func TestExport_Rejected(t *testing.T) {
+	capture(t, &datadogURL, http.StatusForbidden)
+	err := exportDatadog(context.Background(), "bad-key", testPoints)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the rejection, got %v", err)
+	}
+}
+
+func TestServiceURLs(t *testing.T) {
+	t.Setenv(DatadogSiteEnv, "datadoghq.eu")
+	if got := datadogURL(); got != "https://api.datadoghq.eu/api/v2/series" {
+		t.Errorf("datadogURL() = %s", got)
+	}
+	t.Setenv(DatadogSiteEnv, "")
+	if got := datadogURL(); got != "https://api.datadoghq.com/api/v2/series" {
+		t.Errorf("datadogURL() = %s", got)
+	}
+	t.Setenv(NewRelicRegionEnv, "eu")
+	if got := newRelicURL(); got != "https://metric-api.eu.newrelic.com/metric/v1" {
+		t.Errorf("newRelicURL() = %s", got)
+	}
+}
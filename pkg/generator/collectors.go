@@ -0,0 +1,281 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// Collector is a metric tracked by the measurement harness, contributed as
+// Apex snippets at fixed points of a benchmark. Snippets are templates
+// executed with the benchmark's CodeSpec, so they can use its settings such
+// as {{.TrackCache}}, and the functions of snippetFuncs. All collectors of a benchmark share its harness class,
+// so the members they declare need names unique across collectors.
+type Collector struct {
+	Name string
+	// Enabled reports whether a benchmark tracks the collector. When nil,
+	// the collector is tracked when CodeSpec.Collectors names it.
+	Enabled func(types.CodeSpec) bool
+
+	Fields           string // Harness member declarations
+	StartMeasurement string // Statements before the first measured batch
+	StartBatch       string // Statements before each batch is timed
+	EndBatch         string // Statements after each batch, once its timing stopped
+	EndMeasurement   string // Statements after the last measured batch
+
+	// Result is an Apex expression of result JSON members, each starting
+	// with a comma, e.g. ',"soqlQueries":' + soqlQueriesDelta. Members must
+	// match fields of types.Result to be parsed; other collectors report
+	// through Values.
+	Result string
+	// Values maps names to numeric Apex expressions, typically harness
+	// fields, reported under "collected" in the result
+	Values map[string]string
+}
+
+var (
+	collectorsMu sync.RWMutex
+	collectors   []Collector
+)
+
+func init() {
+	RegisterCollector(Collector{
+		Name:    "heap",
+		Enabled: func(spec types.CodeSpec) bool { return spec.TrackHeap },
+		Fields: `    Long totalHeapUsed = 0;
+    Decimal minHeapUsed = null;
+    Decimal maxHeapUsed = null;
+    Long heapBefore;
+`,
+		StartBatch: `        heapBefore = Limits.getHeapSize();
+`,
+		EndBatch: `        Long heapAfter = Limits.getHeapSize();
+        Long heapDelta = heapAfter - heapBefore;
+        totalHeapUsed += heapDelta;
+        Decimal heapPerIteration = Decimal.valueOf(heapDelta) / currentBatch;
+        if (minHeapUsed == null || heapPerIteration < minHeapUsed) minHeapUsed = heapPerIteration;
+        if (maxHeapUsed == null || heapPerIteration > maxHeapUsed) maxHeapUsed = heapPerIteration;
+`,
+		Result: `',"avgHeapKb":' + (Decimal.valueOf(totalHeapUsed) / measurementIterations / 1024).toPlainString() +
+            ',"minHeapKb":' + (minHeapUsed / 1024).toPlainString() +
+            ',"maxHeapKb":' + (maxHeapUsed / 1024).toPlainString()`,
+	})
+	RegisterCollector(Collector{
+		Name:    "heap-peak",
+		Enabled: func(spec types.CodeSpec) bool { return spec.TrackHeapPeak },
+		Fields: `    // Heap high-water mark, sampled after every batch so allocations that
+    // are collected between iterations still count
+    Integer peakHeap;
+`,
+		StartMeasurement: `        peakHeap = Limits.getHeapSize();
+`,
+		EndBatch: `        peakHeap = Math.max(peakHeap, Limits.getHeapSize());
+`,
+		Result: `',"peakHeapKb":' + (Decimal.valueOf(peakHeap) / 1024).toPlainString() +
+            ',"heapLimitKb":' + (Decimal.valueOf(Limits.getLimitHeapSize()) / 1024).toPlainString()`,
+	})
+	RegisterCollector(Collector{
+		Name:    "db",
+		Enabled: func(spec types.CodeSpec) bool { return spec.TrackDB },
+		Fields: `    Integer dmlStatementsBefore;
+    Integer soqlQueriesBefore;
+    Integer aggregateQueriesBefore;
+    Integer futureCallsBefore;
+    Integer queueableJobsBefore;
+    Integer dmlStatementsDelta;
+    Integer soqlQueriesDelta;
+    Integer aggregateQueriesDelta;
+    Integer futureCallsDelta;
+    Integer queueableJobsDelta;
+`,
+		StartMeasurement: `        dmlStatementsBefore = Limits.getDmlStatements();
+        soqlQueriesBefore = Limits.getQueries();
+        aggregateQueriesBefore = Limits.getAggregateQueries();
+        futureCallsBefore = Limits.getFutureCalls();
+        queueableJobsBefore = Limits.getQueueableJobs();
+`,
+		EndMeasurement: `        dmlStatementsDelta = Limits.getDmlStatements() - dmlStatementsBefore;
+        soqlQueriesDelta = Limits.getQueries() - soqlQueriesBefore;
+        aggregateQueriesDelta = Limits.getAggregateQueries() - aggregateQueriesBefore;
+        futureCallsDelta = Limits.getFutureCalls() - futureCallsBefore;
+        queueableJobsDelta = Limits.getQueueableJobs() - queueableJobsBefore;
+`,
+		Result: `',"dmlStatements":' + dmlStatementsDelta +
+            ',"soqlQueries":' + soqlQueriesDelta +
+            ',"aggregateQueries":' + aggregateQueriesDelta +
+            ',"futureCalls":' + futureCallsDelta +
+            ',"queueableJobs":' + queueableJobsDelta`,
+	})
+	RegisterCollector(Collector{
+		Name:    "cache",
+		Enabled: func(spec types.CodeSpec) bool { return spec.TrackCache != "" },
+		Fields: `    // Usage of the tracked Platform Cache partition, sampled around the
+    // measured iterations
+    Cache.Partition cachePartition;
+    Integer cacheKeysBefore;
+    Double cacheCapacityBefore;
+    Integer cacheKeysDelta;
+    Double cacheCapacityDelta;
+`,
+		StartMeasurement: `        cachePartition = Cache.{{cacheScope .TrackCache}}.getPartition('{{cachePartition .TrackCache}}');
+        cacheKeysBefore = cachePartition.getNumKeys();
+        cacheCapacityBefore = cachePartition.getCapacity();
+`,
+		EndMeasurement: `        cacheKeysDelta = cachePartition.getNumKeys() - cacheKeysBefore;
+        cacheCapacityDelta = cachePartition.getCapacity() - cacheCapacityBefore;
+`,
+		Result: `',"cacheKeys":' + cacheKeysDelta +
+            ',"cacheCapacityPct":' + Decimal.valueOf(cacheCapacityDelta).toPlainString() +
+            ',"cacheMissRate":' + Decimal.valueOf(cachePartition.getMissRate()).toPlainString()`,
+	})
+	RegisterCollector(Collector{
+		Name: "callouts",
+		Fields: `    Integer calloutsBefore;
+    Integer calloutsDelta;
+`,
+		StartMeasurement: `        calloutsBefore = Limits.getCallouts();
+`,
+		EndMeasurement: `        calloutsDelta = Limits.getCallouts() - calloutsBefore;
+`,
+		Values: map[string]string{"callouts": "calloutsDelta"},
+	})
+}
+
+// RegisterCollector adds a collector, replacing any registered under the
+// same name. Collectors contribute their snippets in registration order.
+func RegisterCollector(c Collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+
+	for i, existing := range collectors {
+		if existing.Name == c.Name {
+			collectors[i] = c
+			return
+		}
+	}
+	collectors = append(collectors, c)
+}
+
+// CollectorNames returns the names of all registered collectors, sorted
+func CollectorNames() []string {
+	collectorsMu.RLock()
+	defer collectorsMu.RUnlock()
+
+	names := make([]string, len(collectors))
+	for i, c := range collectors {
+		names[i] = c.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderedCollector holds the snippets of a collector rendered for one
+// benchmark
+type renderedCollector struct {
+	Fields           string
+	StartMeasurement string
+	StartBatch       string
+	EndBatch         string
+	EndMeasurement   string
+	Result           string
+}
+
+// collectedValue is a value reported under "collected" in the result
+type collectedValue struct {
+	Name string
+	Expr string
+}
+
+// checkCollectors verifies that every collector named by spec is registered
+func checkCollectors(spec types.CodeSpec) error {
+	known := CollectorNames()
+	for _, name := range spec.Collectors {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	return nil
+}
+
+// renderCollectors renders the snippets of the collectors spec tracks, in
+// registration order, along with the values they report under "collected"
+func renderCollectors(spec types.CodeSpec) ([]renderedCollector, []collectedValue, error) {
+	collectorsMu.RLock()
+	registered := slices.Clone(collectors)
+	collectorsMu.RUnlock()
+
+	var rendered []renderedCollector
+	var values []collectedValue
+	for _, c := range registered {
+		enabled := slices.Contains(spec.Collectors, c.Name)
+		if c.Enabled != nil {
+			enabled = enabled || c.Enabled(spec)
+		}
+		if !enabled {
+			continue
+		}
+
+		r := renderedCollector{}
+		for _, s := range []struct {
+			dst *string
+			src string
+		}{
+			{&r.Fields, c.Fields},
+			{&r.StartMeasurement, c.StartMeasurement},
+			{&r.StartBatch, c.StartBatch},
+			{&r.EndBatch, c.EndBatch},
+			{&r.EndMeasurement, c.EndMeasurement},
+			{&r.Result, c.Result},
+		} {
+			text, err := renderSnippet(c.Name, s.src, spec)
+			if err != nil {
+				return nil, nil, err
+			}
+			*s.dst = text
+		}
+		rendered = append(rendered, r)
+
+		names := make([]string, 0, len(c.Values))
+		for name := range c.Values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			values = append(values, collectedValue{Name: apexStringEscape(jsonString(name)), Expr: c.Values[name]})
+		}
+	}
+	return rendered, values, nil
+}
+
+// snippetFuncs are the functions available to collector snippets
+var snippetFuncs = template.FuncMap{
+	"cacheScope": func(track string) string {
+		scope, _ := splitCachePartition(track)
+		return scope
+	},
+	"cachePartition": func(track string) string {
+		_, partition := splitCachePartition(track)
+		return partition
+	},
+}
+
+// renderSnippet executes one snippet of a collector with spec
+func renderSnippet(name, snippet string, spec types.CodeSpec) (string, error) {
+	if snippet == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(name).Funcs(snippetFuncs).Parse(snippet)
+	if err != nil {
+		return "", fmt.Errorf("collector %s: failed to parse snippet: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, spec); err != nil {
+		return "", fmt.Errorf("collector %s: failed to render snippet: %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,144 @@
+package generator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// typeDeclPattern matches the header of a class, interface or enum declaration
+var typeDeclPattern = regexp.MustCompile(`(?is)^(?:(?:public|private|protected|global|static|virtual|abstract|with\s+sharing|without\s+sharing|inherited\s+sharing|@\w+(?:\([^)]*\))?)\s+)*(?:class|interface|enum)\s+\w+`)
+
+// methodDeclPattern matches the header of a method declaration
+var methodDeclPattern = regexp.MustCompile(`(?is)^(?:(?:public|private|protected|global|static|virtual|abstract|override|testmethod|webservice|@\w+(?:\([^)]*\))?)\s+)*([\w.]+(?:\s*<[\w.<>,\s]*>)?(?:\s*\[\])?)\s+(\w+)\s*\([^()]*\)$`)
+
+// statementKeywords can never be the return type or name of a method
+var statementKeywords = map[string]bool{
+	"if": true, "else": true, "for": true, "while": true, "do": true,
+	"switch": true, "when": true, "try": true, "catch": true, "finally": true,
+	"return": true, "new": true, "throw": true,
+}
+
+// splitDeclarations separates top-level method, class, interface and enum
+// declarations from executable statements in user code. Declarations cannot
+// live inside the measurement loop, so they are hoisted to the top of the
+// generated script while the remaining statements are benchmarked. Hoisted
+// declarations are blanked out of the body with newlines so that both keep
+// their original line numbers.
+func splitDeclarations(code string) (declarations []fragment, body fragment) {
+	var stmts strings.Builder
+
+	depth := 0
+	segStart := 0
+	headerEnd := -1
+
+	flush := func(end int) {
+		segment := code[segStart:end]
+		if headerEnd != -1 && isDeclarationHeader(code[segStart:headerEnd]) {
+			line := strings.Count(code[:segStart], "\n") + 1
+			column := segStart - strings.LastIndexByte(code[:segStart], '\n')
+			declarations = append(declarations, trimFragment(SectionCode, segment, line, column))
+			stmts.WriteString(strings.Repeat("\n", strings.Count(segment, "\n")))
+		} else {
+			stmts.WriteString(segment)
+		}
+		segStart = end
+		headerEnd = -1
+	}
+
+	for i := 0; i < len(code); i++ {
+		switch {
+		case code[i] == '\'':
+			// String literal, honouring backslash escapes
+			for i++; i < len(code) && code[i] != '\''; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+		case strings.HasPrefix(code[i:], "//"):
+			if end := strings.IndexByte(code[i:], '\n'); end != -1 {
+				i += end
+			} else {
+				i = len(code)
+			}
+		case strings.HasPrefix(code[i:], "/*"):
+			if end := strings.Index(code[i+2:], "*/"); end != -1 {
+				i += end + 3
+			} else {
+				i = len(code)
+			}
+		case code[i] == '{':
+			if depth == 0 && headerEnd == -1 {
+				headerEnd = i
+			}
+			depth++
+		case code[i] == '}':
+			depth--
+			if depth == 0 {
+				flush(i + 1)
+			}
+		case code[i] == ';' && depth == 0:
+			// Keep a trailing line comment with the statement it annotates
+			end := i + 1
+			rest := strings.TrimLeft(code[end:], " \t")
+			if strings.HasPrefix(rest, "//") {
+				end = len(code) - len(rest)
+				if nl := strings.IndexByte(rest, '\n'); nl != -1 {
+					end += nl
+				} else {
+					end = len(code)
+				}
+			}
+			flush(end)
+			i = end - 1
+		}
+	}
+
+	if segStart < len(code) {
+		stmts.WriteString(code[segStart:])
+	}
+
+	return declarations, trimFragment(SectionCode, stmts.String(), 1, 1)
+}
+
+// isDeclarationHeader reports whether the text preceding a top-level block
+// declares a type or method rather than opening a control-flow statement
+func isDeclarationHeader(header string) bool {
+	header = strings.TrimSpace(stripComments(header))
+
+	if typeDeclPattern.MatchString(header) {
+		return true
+	}
+
+	match := methodDeclPattern.FindStringSubmatch(header)
+	if match == nil {
+		return false
+	}
+
+	returnType := strings.ToLower(strings.Fields(match[1])[0])
+	name := strings.ToLower(match[2])
+	return !statementKeywords[returnType] && !statementKeywords[name]
+}
+
+// stripComments removes line and block comments from Apex source
+func stripComments(code string) string {
+	var sb strings.Builder
+	for i := 0; i < len(code); i++ {
+		switch {
+		case strings.HasPrefix(code[i:], "//"):
+			end := strings.IndexByte(code[i:], '\n')
+			if end == -1 {
+				return sb.String()
+			}
+			i += end - 1
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end == -1 {
+				return sb.String()
+			}
+			i += end + 3
+		default:
+			sb.WriteByte(code[i])
+		}
+	}
+	return sb.String()
+}
@@ -2,9 +2,14 @@ package generator
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
@@ -13,38 +18,190 @@ import (
 // templateData extends CodeSpec with additional template variables
 type templateData struct {
 	types.CodeSpec
-	LoopVar string
+	// UserCode shadows CodeSpec.UserCode with declarations removed
+	UserCode     string
+	Declarations string
+	LoopVar      string
+	BatchVar     string
+	HarnessClass string
+	HarnessVar   string
+	SavepointVar string
+	NameJSON     string
+	AutoBatch    bool // No batch size was set, so the harness grows it when batches read 0 ms
+	Collectors   []renderedCollector
+	Collected    []collectedValue
 }
 
 // Generate creates Apex code from a CodeSpec using the template
 func Generate(spec types.CodeSpec) (string, error) {
-	// Validate input
-	if err := validateSpec(spec); err != nil {
+	code, _, err := GenerateWithSourceMap(spec)
+	return code, err
+}
+
+// GenerateWithSourceMap creates Apex code from a CodeSpec along with a
+// SourceMap that translates generated line numbers back to user code
+func GenerateWithSourceMap(spec types.CodeSpec) (string, *SourceMap, error) {
+	return GenerateCombined([]types.CodeSpec{spec})
+}
+
+// GenerateCombined creates a single Apex script that runs several benchmarks
+// one after another, each emitting its own BENCH_RESULT line. Each benchmark
+// runs in its own block scope, so setup variables may reuse names. Combined
+// benchmarks share one transaction and therefore its governor limits, and
+// they cannot declare top-level methods or classes, which could clash.
+func GenerateCombined(specs []types.CodeSpec) (string, *SourceMap, error) {
+	return generate(specs, func() string { return strings.ReplaceAll(uuid.New().String(), "-", "_") })
+}
+
+// ScriptHash returns the SHA-256 hash, in hex, of the Apex generated for
+// spec. Generated scripts name their harness identifiers uniquely, so those
+// are fixed for hashing; equal hashes mean the same script runs.
+func ScriptHash(spec types.CodeSpec) (string, error) {
+	code, _, err := generate([]types.CodeSpec{spec}, func() string { return "00000000_0000_0000_0000_000000000000" })
+	if err != nil {
 		return "", err
 	}
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// generate creates the script of specs, naming each benchmark's harness
+// identifiers with a fresh newID
+func generate(specs []types.CodeSpec, newID func() string) (string, *SourceMap, error) {
+	if len(specs) == 0 {
+		return "", nil, fmt.Errorf("no benchmarks to generate")
+	}
+
+	var fragments []fragment
+	sources := make(map[sourceKey]string)
+	benchmarks := make([]templateData, 0, len(specs))
+	names := make(map[string]bool, len(specs))
 
-	// Generate unique loop variable name to avoid conflicts with user code
-	loopVar := "i_" + strings.ReplaceAll(uuid.New().String(), "-", "_")
+	for _, spec := range specs {
+		// Validate input
+		if err := validateSpec(spec); err != nil {
+			if len(specs) > 1 {
+				return "", nil, fmt.Errorf("benchmark %s: %w", spec.Name, err)
+			}
+			return "", nil, err
+		}
+		if names[spec.Name] {
+			return "", nil, fmt.Errorf("duplicate benchmark name %q in combined script", spec.Name)
+		}
+		names[spec.Name] = true
+
+		data, err := prepareBenchmark(spec, newID(), &fragments)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(specs) > 1 && data.Declarations != "" {
+			return "", nil, fmt.Errorf("benchmark %s declares methods or classes and cannot be combined with other benchmarks", spec.Name)
+		}
+		benchmarks = append(benchmarks, data)
+
+		sources[sourceKey{spec.Name, SectionCode}] = spec.UserCode
+		sources[sourceKey{spec.Name, SectionSetup}] = spec.Setup
+		sources[sourceKey{spec.Name, SectionTeardown}] = spec.Teardown
+	}
 
 	// Parse template
 	tmpl, err := template.New("apex").Parse(apexTemplate)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+		return "", nil, fmt.Errorf("failed to parse template: %w", err)
 	}
 
-	// Prepare template data
+	// Execute template
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "script", benchmarks); err != nil {
+		return "", nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	code, sourceMap := substituteFragments(buf.String(), fragments, sources)
+	return code, sourceMap, nil
+}
+
+// prepareBenchmark builds the template data for one benchmark, naming its
+// harness identifiers with id. User code is rendered as placeholders,
+// appended to fragments, so the positions it lands on in the generated
+// script can be recorded for error reporting.
+func prepareBenchmark(spec types.CodeSpec, id string, fragments *[]fragment) (templateData, error) {
+	addFragment := func(f fragment) string {
+		f.benchmark = spec.Name
+		*fragments = append(*fragments, f)
+		return placeholder(len(*fragments) - 1)
+	}
+
+	for _, code := range []*string{&spec.UserCode, &spec.Setup, &spec.Teardown} {
+		expanded, err := expandVars(*code, spec.Vars)
+		if err != nil {
+			return templateData{}, err
+		}
+		*code = expanded
+	}
+	spec.UserCode = expandNamespace(spec.UserCode, spec.Namespace)
+	spec.Setup = expandNamespace(spec.Setup, spec.Namespace)
+	spec.Teardown = expandNamespace(spec.Teardown, spec.Namespace)
+
+	// Methods and classes cannot be declared inside the measurement loop
+	declarations, body := splitDeclarations(spec.UserCode)
+	if body.text == "" {
+		return templateData{}, fmt.Errorf("user code only contains declarations, nothing to benchmark")
+	}
+
+	// The few harness identifiers that share the top-level scope with user
+	// code are named uniquely by id
 	data := templateData{
 		CodeSpec: spec,
-		LoopVar:  loopVar,
+		UserCode: addFragment(body),
+		LoopVar:  "i_" + id,
+		BatchVar: "j_" + id,
+		// Apex class names are limited to 40 characters
+		HarnessClass: "BenchHarness_" + id[:8],
+		HarnessVar:   "harness_" + id,
+		SavepointVar: "savepoint_" + id,
+		NameJSON:     apexStringEscape(jsonString(spec.Name)),
 	}
 
-	// Execute template
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
+	declPlaceholders := make([]string, len(declarations))
+	for i, decl := range declarations {
+		declPlaceholders[i] = addFragment(decl)
 	}
+	data.Declarations = strings.Join(declPlaceholders, "\n\n")
 
-	return buf.String(), nil
+	if spec.Setup != "" {
+		data.Setup = addFragment(trimFragment(SectionSetup, spec.Setup, 1, 1))
+	}
+	if spec.Teardown != "" {
+		data.Teardown = addFragment(trimFragment(SectionTeardown, spec.Teardown, 1, 1))
+	}
+	if data.BatchSize <= 0 {
+		data.BatchSize = 1
+		data.AutoBatch = true
+	}
+
+	collectors, collected, err := renderCollectors(spec)
+	if err != nil {
+		return templateData{}, err
+	}
+	data.Collectors, data.Collected = collectors, collected
+
+	return data, nil
+}
+
+// namespacePattern matches a managed package namespace prefix
+var namespacePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,14}$`)
+
+// cachePartitionPattern matches a qualified Platform Cache partition name,
+// optionally prefixed with the org: or session: cache it is in
+var cachePartitionPattern = regexp.MustCompile(`^(?:(?:org|session):)?\w+\.\w+$`)
+
+// splitCachePartition returns the Apex class of the cache a tracked
+// partition is in, Org unless prefixed with session:, and the partition name
+func splitCachePartition(track string) (string, string) {
+	if partition, ok := strings.CutPrefix(track, "session:"); ok {
+		return "Session", partition
+	}
+	return "Org", strings.TrimPrefix(track, "org:")
 }
 
 // validateSpec ensures the CodeSpec has valid values
@@ -61,9 +218,49 @@ func validateSpec(spec types.CodeSpec) error {
 		return fmt.Errorf("warmup cannot be negative, got %d", spec.Warmup)
 	}
 
+	if spec.BatchSize < 0 {
+		return fmt.Errorf("batch size cannot be negative, got %d", spec.BatchSize)
+	}
+
+	if spec.Namespace != "" && !namespacePattern.MatchString(spec.Namespace) {
+		return fmt.Errorf("namespace must be 1 to 15 letters, digits or underscores starting with a letter, got %q", spec.Namespace)
+	}
+
+	if spec.TrackCache != "" && !cachePartitionPattern.MatchString(spec.TrackCache) {
+		return fmt.Errorf("cache partition must be a qualified name such as local.Bench, optionally prefixed with org: or session:, got %q", spec.TrackCache)
+	}
+
+	if err := checkCollectors(spec); err != nil {
+		return err
+	}
+
 	if strings.TrimSpace(spec.Name) == "" {
 		return fmt.Errorf("benchmark name cannot be empty")
 	}
 
+	// Names are echoed into a line comment in the generated code, so line
+	// breaks and other control characters would corrupt the script
+	for _, r := range spec.Name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("benchmark name cannot contain control characters, got %q", spec.Name)
+		}
+	}
+
 	return nil
 }
+
+// jsonString encodes s as a quoted JSON string
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string cannot fail
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// apexStringEscape escapes s for use inside a single-quoted Apex string literal
+func apexStringEscape(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return replacer.Replace(s)
+}
@@ -1,12 +1,24 @@
 package generator
 
 import (
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
+// harnessSuffix matches the unique suffix appended to harness identifiers
+var harnessSuffix = regexp.MustCompile(`_[0-9a-f]{8}_[0-9a-f]{4}_[0-9a-f]{4}_[0-9a-f]{4}_[0-9a-f]{12}`)
+
+// stripHarnessSuffix removes unique identifier suffixes so tests can match
+// harness statements by their base variable names
+func stripHarnessSuffix(code string) string {
+	return harnessSuffix.ReplaceAllString(code, "")
+}
+
 func TestGenerate_BasicCode(t *testing.T) {
 	spec := types.CodeSpec{
 		Name:       "TestBenchmark",
@@ -21,6 +33,7 @@ func TestGenerate_BasicCode(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
+	result = stripHarnessSuffix(result)
 
 	// Verify the generated code contains expected elements
 	expectations := []string{
@@ -29,10 +42,10 @@ func TestGenerate_BasicCode(t *testing.T) {
 		"Integer warmupIterations = 10;",
 		"Integer measurementIterations = 100;",
 		"BENCH_RESULT:",
-		"< warmupIterations;",  // Loop uses UUID-based variable
-		"< measurementIterations;", // Loop uses UUID-based variable
-		"Long wallStart = System.now().getTime();",
-		"Integer cpuStart = Limits.getCpuTime();",
+		"< harness.warmupIterations;",
+		"< harness.measurementIterations;",
+		"wallStart = System.now().getTime();",
+		"cpuStart = Limits.getCpuTime();",
 	}
 
 	for _, expected := range expectations {
@@ -56,11 +69,12 @@ func TestGenerate_WithHeapTracking(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
+	result = stripHarnessSuffix(result)
 
 	// Verify heap tracking code is present
 	heapExpectations := []string{
 		"Long totalHeapUsed = 0;",
-		"Long heapBefore = Limits.getHeapSize();",
+		"heapBefore = Limits.getHeapSize();",
 		"Long heapAfter = Limits.getHeapSize();",
 		"avgHeapKb",
 		"minHeapKb",
@@ -74,6 +88,46 @@ func TestGenerate_WithHeapTracking(t *testing.T) {
 	}
 }
 
+func TestGenerate_WithHeapPeakTracking(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:          "PeakBenchmark",
+		UserCode:      "List<String> lst = new List<String>();",
+		Iterations:    50,
+		TrackHeapPeak: true,
+	}
+
+	result, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"peakHeap = Limits.getHeapSize();",
+		"peakHeap = Math.max(peakHeap, Limits.getHeapSize());",
+		"Limits.getLimitHeapSize()",
+		`',"peakHeapKb":'`,
+		`',"heapLimitKb":'`,
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Generated code missing heap peak tracking: %q", expected)
+		}
+	}
+
+	// Delta-based heap tracking stays off
+	if strings.Contains(result, "totalHeapUsed") {
+		t.Error("Expected no per-iteration heap tracking without TrackHeap")
+	}
+
+	spec.TrackHeapPeak = false
+	result, err = Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if strings.Contains(result, "peakHeap") {
+		t.Error("Expected no heap peak tracking when disabled")
+	}
+}
+
 func TestGenerate_WithDBTracking(t *testing.T) {
 	spec := types.CodeSpec{
 		Name:       "DBTest",
@@ -88,13 +142,20 @@ func TestGenerate_WithDBTracking(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
+	result = stripHarnessSuffix(result)
 
 	// Verify DB tracking code is present
 	dbExpectations := []string{
-		"Integer dmlStatementsBefore = Limits.getDmlStatements();",
-		"Integer soqlQueriesBefore = Limits.getQueries();",
+		"dmlStatementsBefore = Limits.getDmlStatements();",
+		"soqlQueriesBefore = Limits.getQueries();",
+		"aggregateQueriesBefore = Limits.getAggregateQueries();",
+		"futureCallsBefore = Limits.getFutureCalls();",
+		"queueableJobsBefore = Limits.getQueueableJobs();",
 		"dmlStatements",
 		"soqlQueries",
+		`',"aggregateQueries":'`,
+		`',"futureCalls":'`,
+		`',"queueableJobs":'`,
 	}
 
 	for _, expected := range dbExpectations {
@@ -355,6 +416,7 @@ func TestGenerate_MaxIterations(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
+	result = stripHarnessSuffix(result)
 
 	if !strings.Contains(result, "Integer measurementIterations = 10000;") {
 		t.Error("Large iteration count not set correctly")
@@ -383,3 +445,784 @@ func TestGenerate_ValidationError(t *testing.T) {
 		t.Errorf("Expected error about name, got: %v", err)
 	}
 }
+
+func TestGenerate_NameEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"plain", `'"name":"plain",'`},
+		{`with "quotes"`, `'"name":"with \\"quotes\\"",'`},
+		{`back\slash`, `'"name":"back\\\\slash",'`},
+		{"it's", `'"name":"it\'s",'`},
+		{"Map: keyed", `'"name":"Map: keyed",'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := types.CodeSpec{
+				Name:       tt.name,
+				UserCode:   "Integer x = 1;",
+				Iterations: 10,
+				Warmup:     1,
+			}
+
+			result, err := Generate(spec)
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			if !strings.Contains(result, tt.expected) {
+				t.Errorf("Expected escaped name %s in generated code", tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateSpec_ControlCharactersInName(t *testing.T) {
+	for _, name := range []string{"line\nbreak", "carriage\rreturn", "tab\there"} {
+		spec := types.CodeSpec{
+			Name:       name,
+			UserCode:   "Integer x = 1;",
+			Iterations: 10,
+			Warmup:     1,
+		}
+
+		if err := validateSpec(spec); err == nil {
+			t.Errorf("Expected error for name %q", name)
+		}
+	}
+}
+
+func TestGenerate_HarnessIsolatedFromUserCode(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "Collisions",
+		UserCode:   "Integer i = 0; Long wallStart = 1; Long totalCpuTime = 2; String resultJson = '';",
+		Iterations: 10,
+		Warmup:     1,
+		TrackHeap:  true,
+		TrackDB:    true,
+	}
+
+	result, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if !harnessSuffix.MatchString(result) {
+		t.Error("Expected top-level harness identifiers to carry a unique suffix")
+	}
+
+	// Harness state is declared inside the generated class, so outside of it
+	// the user declarations must be the only ones with these names
+	start := strings.Index(result, "public class BenchHarness_")
+	end := strings.Index(result[start:], "\n}\n")
+	if start == -1 || end == -1 {
+		t.Fatal("Expected generated code to contain the harness class")
+	}
+	topLevel := result[:start] + result[start+end:]
+
+	for _, decl := range []string{"Long wallStart ", "Long totalCpuTime ", "String resultJson ", "Integer i "} {
+		if count := strings.Count(topLevel, decl); count != 2 {
+			t.Errorf("Expected %q only in the two user code copies, found %d occurrences", decl, count)
+		}
+	}
+}
+
+func TestGenerate_HoistsUserDeclarations(t *testing.T) {
+	spec := types.CodeSpec{
+		Name: "WithMethods",
+		UserCode: `// Helper used by the benchmark
+static Integer square(Integer x) {
+    return x * x;
+}
+
+class Point {
+    Integer x;
+}
+
+Integer total = 0;
+for (Integer n = 0; n < 10; n++) {
+    total += square(n);
+}`,
+		Iterations: 10,
+		Warmup:     1,
+	}
+
+	result, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if count := strings.Count(result, "static Integer square(Integer x) {"); count != 1 {
+		t.Errorf("Expected method declared once, found %d", count)
+	}
+	if count := strings.Count(result, "class Point {"); count != 1 {
+		t.Errorf("Expected class declared once, found %d", count)
+	}
+	if count := strings.Count(result, "total += square(n);"); count != 2 {
+		t.Errorf("Expected statements in warmup and measurement loops, found %d", count)
+	}
+	if strings.Index(result, "class Point {") > strings.Index(result, "total += square(n);") {
+		t.Error("Expected declarations to be hoisted above the benchmark loops")
+	}
+}
+
+func TestGenerate_OnlyDeclarations(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "NoStatements",
+		UserCode:   "void helper() { Integer x = 1; }",
+		Iterations: 10,
+		Warmup:     1,
+	}
+
+	if _, err := Generate(spec); err == nil {
+		t.Error("Expected error when user code contains only declarations")
+	}
+}
+
+func TestSplitDeclarations(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		wantDecls string
+		wantBody  string
+	}{
+		{
+			name:     "statements only",
+			code:     "Integer x = 1;\nx++;",
+			wantBody: "Integer x = 1;\nx++;",
+		},
+		{
+			name:     "control flow is not a declaration",
+			code:     "if (x > 0) {\n    x--;\n} else if (x < 0) {\n    x++;\n}",
+			wantBody: "if (x > 0) {\n    x--;\n} else if (x < 0) {\n    x++;\n}",
+		},
+		{
+			name:     "collection initializer is not a declaration",
+			code:     "List<Integer> l = new List<Integer>{1, 2};",
+			wantBody: "List<Integer> l = new List<Integer>{1, 2};",
+		},
+		{
+			name:      "generic return type",
+			code:      "public static Map<Id, List<Account>> group(List<Account> a) { return null; }\nObject o = group(null);",
+			wantDecls: "public static Map<Id, List<Account>> group(List<Account> a) { return null; }",
+			wantBody:  "Object o = group(null);",
+		},
+		{
+			name:      "braces inside strings and comments",
+			code:      "String s = '{'; // }\nvoid f() { String t = '}'; /* { */ }",
+			wantDecls: "void f() { String t = '}'; /* { */ }",
+			wantBody:  "String s = '{'; // }",
+		},
+		{
+			name:      "interface and enum",
+			code:      "interface Shape { Decimal area(); }\nenum Color { RED, GREEN }\nColor c = Color.RED;",
+			wantDecls: "interface Shape { Decimal area(); }\n\nenum Color { RED, GREEN }",
+			wantBody:  "Color c = Color.RED;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decls, body := splitDeclarations(tt.code)
+			texts := make([]string, len(decls))
+			for i, d := range decls {
+				texts[i] = d.text
+			}
+			if got := strings.Join(texts, "\n\n"); got != tt.wantDecls {
+				t.Errorf("declarations = %q, want %q", got, tt.wantDecls)
+			}
+			if body.text != tt.wantBody {
+				t.Errorf("body = %q, want %q", body.text, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGenerateWithSourceMap_Lookup(t *testing.T) {
+	spec := types.CodeSpec{
+		Name: "Mapped",
+		UserCode: `Integer a = 1;
+void helper() {
+    Integer b = 2;
+}
+Integer c = a +;`,
+		Setup:      "\nList<Integer> nums = new List<Integer>();\nnums.add(1);",
+		Teardown:   "nums.clear();",
+		Iterations: 10,
+		Warmup:     1,
+	}
+
+	code, sm, err := GenerateWithSourceMap(spec)
+	if err != nil {
+		t.Fatalf("GenerateWithSourceMap failed: %v", err)
+	}
+	lines := strings.Split(code, "\n")
+
+	// findLine returns the 1-based line number of the nth line containing s
+	findLine := func(s string, nth int) int {
+		for i, l := range lines {
+			if strings.Contains(l, s) {
+				if nth == 0 {
+					return i + 1
+				}
+				nth--
+			}
+		}
+		t.Fatalf("generated code does not contain %q", s)
+		return 0
+	}
+
+	tests := []struct {
+		name        string
+		genLine     int
+		genColumn   int
+		wantSection string
+		wantLine    int
+		wantColumn  int
+		wantText    string
+	}{
+		{"measured body", findLine("Integer c = a +;", 1), 0, SectionCode, 5, 0, "Integer c = a +;"},
+		{"warmup body", findLine("Integer c = a +;", 0), 0, SectionCode, 5, 0, "Integer c = a +;"},
+		{"hoisted declaration", findLine("Integer b = 2;", 0), 5, SectionCode, 3, 5, "    Integer b = 2;"},
+		{"setup after leading blank line", findLine("nums.add(1);", 0), 1, SectionSetup, 3, 1, "nums.add(1);"},
+		{"teardown", findLine("nums.clear();", 0), 0, SectionTeardown, 1, 0, "nums.clear();"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, ok := sm.Lookup(tt.genLine, tt.genColumn)
+			if !ok {
+				t.Fatalf("Expected line %d to map to user code", tt.genLine)
+			}
+			if pos.Section != tt.wantSection || pos.Line != tt.wantLine || pos.Column != tt.wantColumn {
+				t.Errorf("Lookup = %s:%d:%d, want %s:%d:%d", pos.Section, pos.Line, pos.Column, tt.wantSection, tt.wantLine, tt.wantColumn)
+			}
+			if pos.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", pos.Text, tt.wantText)
+			}
+		})
+	}
+
+	// First line of the measured body is indented by the template
+	bodyLine := findLine("Integer a = 1;", 1)
+	column := strings.Index(lines[bodyLine-1], "Integer a") + 1
+	pos, ok := sm.Lookup(bodyLine, column+8)
+	if !ok || pos.Line != 1 || pos.Column != 9 {
+		t.Errorf("Expected column to be adjusted for template indentation, got %+v", pos)
+	}
+
+	if _, ok := sm.Lookup(findLine("public void endBatch()", 0), 1); ok {
+		t.Error("Expected harness lines not to map to user code")
+	}
+}
+
+func TestGenerateWithSourceMap_IndentedFirstLine(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "Indented",
+		UserCode:   "    Integer a = 1 +;\nInteger b = 2; void helper() {}",
+		Setup:      "\n\tInteger s = 0 +;",
+		Iterations: 10,
+		Warmup:     1,
+	}
+	code, sm, err := GenerateWithSourceMap(spec)
+	if err != nil {
+		t.Fatalf("GenerateWithSourceMap failed: %v", err)
+	}
+	lines := strings.Split(code, "\n")
+
+	// lookup maps the generated column of the nth occurrence of s back to
+	// user code
+	lookup := func(s string, nth int) Position {
+		t.Helper()
+		for i, l := range lines {
+			if col := strings.Index(l, s); col != -1 {
+				if nth == 0 {
+					pos, ok := sm.Lookup(i+1, col+1)
+					if !ok {
+						t.Fatalf("Expected %q to map to user code", s)
+					}
+					return pos
+				}
+				nth--
+			}
+		}
+		t.Fatalf("generated code does not contain %q", s)
+		return Position{}
+	}
+
+	// Columns count the trimmed indentation of the first line
+	if pos := lookup("1 +;", 0); pos.Section != SectionCode || pos.Line != 1 || pos.Column != 17 {
+		t.Errorf("Expected code line 1, column 17, got %+v", pos)
+	}
+	if pos := lookup("s = 0 +;", 0); pos.Section != SectionSetup || pos.Line != 2 || pos.Column != 10 {
+		t.Errorf("Expected setup line 2, column 10, got %+v", pos)
+	}
+	// A hoisted declaration keeps the column it had after a statement
+	if pos := lookup("void helper()", 0); pos.Line != 2 || pos.Column != 16 {
+		t.Errorf("Expected code line 2, column 16, got %+v", pos)
+	}
+}
+
+func TestFormatPosition(t *testing.T) {
+	got := FormatPosition(Position{Section: SectionCode, Line: 2, Column: 5, Text: "\tx = y +;"})
+	want := "code line 2, column 5:\n    \tx = y +;\n    \t   ^\n"
+	if got != want {
+		t.Errorf("FormatPosition = %q, want %q", got, want)
+	}
+}
+
+func TestGenerate_BatchSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+		expected  string
+		auto      string
+	}{
+		{"default grows batches below clock resolution", 0, "public Integer batchSize = 1;", "Boolean autoBatch = true;"},
+		{"explicit batch size", 25, "public Integer batchSize = 25;", "Boolean autoBatch = false;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := types.CodeSpec{
+				Name:       "Batched",
+				UserCode:   "Integer x = 1;",
+				Iterations: 100,
+				Warmup:     1,
+				BatchSize:  tt.batchSize,
+			}
+
+			result, err := Generate(spec)
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			result = stripHarnessSuffix(result)
+
+			for _, expected := range []string{
+				tt.expected,
+				tt.auto,
+				"i < harness.measurementIterations; i += harness.currentBatch",
+				"for (Integer j = harness.startBatch(i); j > 0; j--)",
+				"Decimal.valueOf(wallDelta) / currentBatch",
+				"loopWallTime = System.now().getTime() - loopWallStart;",
+				"avgCpuMs.toPlainString()",
+			} {
+				if !strings.Contains(result, expected) {
+					t.Errorf("Generated code missing %q", expected)
+				}
+			}
+			if strings.Contains(result, ".format()") {
+				t.Error("Expected locale-independent number formatting")
+			}
+		})
+	}
+}
+
+func TestValidateSpec_NegativeBatchSize(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "Test",
+		UserCode:   "Integer x = 1;",
+		Iterations: 10,
+		BatchSize:  -1,
+	}
+
+	if err := validateSpec(spec); err == nil {
+		t.Error("Expected error for negative batch size")
+	}
+}
+
+func TestGenerateCombined(t *testing.T) {
+	specs := []types.CodeSpec{
+		{Name: "First", UserCode: "String s = 'a';", Iterations: 10, Warmup: 1},
+		{Name: "Second", UserCode: "String s = 'b';", Iterations: 20, Warmup: 2, Setup: "Integer n = 5;"},
+	}
+
+	code, sourceMap, err := GenerateCombined(specs)
+	if err != nil {
+		t.Fatalf("GenerateCombined failed: %v", err)
+	}
+
+	if count := strings.Count(code, "System.debug('BENCH_RESULT:'"); count != 2 {
+		t.Errorf("Expected 2 BENCH_RESULT statements, got %d", count)
+	}
+	for _, want := range []string{`'"name":"First",'`, `'"name":"Second",'`, "measurementIterations = 10;", "measurementIterations = 20;"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected combined code to contain %q", want)
+		}
+	}
+
+	// Both benchmarks declare s, so each must live in its own block
+	if count := strings.Count(code, "// Benchmark scope"); count != 2 {
+		t.Errorf("Expected 2 benchmark scopes, got %d", count)
+	}
+
+	// Source positions resolve to the benchmark they came from
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "Integer n = 5;") {
+			pos, ok := sourceMap.Lookup(i+1, 1)
+			if !ok || pos.Benchmark != "Second" || pos.Section != SectionSetup {
+				t.Errorf("Expected setup line to map to Second, got %+v (ok=%v)", pos, ok)
+			}
+		}
+	}
+}
+
+func TestGenerateCombined_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []types.CodeSpec
+		wantErr string
+	}{
+		{
+			name:    "no benchmarks",
+			specs:   nil,
+			wantErr: "no benchmarks",
+		},
+		{
+			name: "duplicate names",
+			specs: []types.CodeSpec{
+				{Name: "Same", UserCode: "Integer a = 1;", Iterations: 10},
+				{Name: "Same", UserCode: "Integer b = 1;", Iterations: 10},
+			},
+			wantErr: "duplicate",
+		},
+		{
+			name: "declarations",
+			specs: []types.CodeSpec{
+				{Name: "Plain", UserCode: "Integer a = 1;", Iterations: 10},
+				{Name: "Helper", UserCode: "void helper() {}\nhelper();", Iterations: 10},
+			},
+			wantErr: "cannot be combined",
+		},
+		{
+			name: "invalid benchmark",
+			specs: []types.CodeSpec{
+				{Name: "Plain", UserCode: "Integer a = 1;", Iterations: 10},
+				{Name: "Bad", UserCode: "Integer b = 1;", Iterations: 0},
+			},
+			wantErr: "benchmark Bad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := GenerateCombined(tt.specs)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestExtractQueries(t *testing.T) {
+	code := `List<Account> a = [SELECT Id,
+    Name FROM Account LIMIT 10];
+// List<Lead> l = [SELECT Id FROM Lead];
+Integer n = [select count() from Contact];
+a = [SELECT Id, Name FROM Account LIMIT 10];
+Integer[] arr = new Integer[]{1};
+Integer x = arr[0];`
+
+	want := []string{"SELECT Id, Name FROM Account LIMIT 10", "select count() from Contact"}
+	if got := ExtractQueries(code); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractQueries() = %q, want %q", got, want)
+	}
+}
+
+func TestHasBindVariables(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT Id FROM Account WHERE Id IN :ids", true},
+		{"SELECT Id FROM Account WHERE Name = : name", true},
+		{"SELECT Id FROM Account WHERE CreatedDate = LAST_N_DAYS:30", false},
+		{"SELECT Id FROM Account WHERE CreatedDate > 2024-01-01T00:00:00Z", false},
+	}
+	for _, tt := range tests {
+		if got := HasBindVariables(tt.query); got != tt.want {
+			t.Errorf("HasBindVariables(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestGenerate_Rollback(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "Seeded",
+		UserCode:   "List<Account> a = [SELECT Id FROM Account];",
+		Setup:      "insert new Account(Name = 'x');",
+		Iterations: 10,
+		Rollback:   true,
+	}
+	code, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	savepoint := strings.Index(code, "= Database.setSavepoint();")
+	setup := strings.Index(code, "insert new Account(Name = 'x');")
+	result := strings.Index(code, "System.debug('BENCH_RESULT:'")
+	rollback := strings.Index(code, "Database.rollback(savepoint_")
+	if savepoint == -1 || !(savepoint < setup && setup < result && result < rollback) {
+		t.Errorf("Expected setup and measurement between savepoint and rollback, got:\n%s", code)
+	}
+
+	spec.Rollback = false
+	if code, _ := Generate(spec); strings.Contains(code, "Savepoint") {
+		t.Error("Expected no savepoint without Rollback")
+	}
+}
+
+func TestGenerate_WithCacheTracking(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "CacheTest",
+		UserCode:   "Cache.Org.put('local.Bench.k', 1);",
+		Iterations: 10,
+		TrackCache: "local.Bench",
+	}
+
+	result, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	for _, expected := range []string{
+		"cachePartition = Cache.Org.getPartition('local.Bench');",
+		"cacheKeysBefore = cachePartition.getNumKeys();",
+		"cacheCapacityDelta = cachePartition.getCapacity() - cacheCapacityBefore;",
+		`',"cacheKeys":'`,
+		`',"cacheCapacityPct":'`,
+		`',"cacheMissRate":'`,
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Generated code missing cache tracking: %q", expected)
+		}
+	}
+
+	spec.TrackCache = "session:local.Bench"
+	if result, _ := Generate(spec); !strings.Contains(result, "cachePartition = Cache.Session.getPartition('local.Bench');") {
+		t.Error("Expected the session cache partition to be tracked")
+	}
+	spec.TrackCache = "org:local.Bench"
+	if result, _ := Generate(spec); !strings.Contains(result, "cachePartition = Cache.Org.getPartition('local.Bench');") {
+		t.Error("Expected the org cache partition to be tracked")
+	}
+
+	spec.TrackCache = ""
+	if result, _ := Generate(spec); strings.Contains(result, "cachePartition") {
+		t.Error("Expected no cache tracking without a partition")
+	}
+
+	for _, invalid := range []string{"Bench'); delete", "platform:local.Bench"} {
+		spec.TrackCache = invalid
+		if _, err := Generate(spec); err == nil || !strings.Contains(err.Error(), "qualified name") {
+			t.Errorf("Expected invalid partition error for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestGenerate_Namespace(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "Managed",
+		UserCode:   "%%%NAMESPACE_DOT%%%Pricing.quote(new %%%NAMESPACE%%%Quote__c());",
+		Setup:      "Integer n = [SELECT COUNT() FROM %%%NAMESPACE%%%Quote__c];",
+		Iterations: 10,
+		Namespace:  "acme",
+	}
+
+	result, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(result, "acme.Pricing.quote(new acme__Quote__c());") || !strings.Contains(result, "FROM acme__Quote__c]") {
+		t.Errorf("Expected namespace tokens to be expanded, got:\n%s", result)
+	}
+
+	spec.Namespace = ""
+	result, _ = Generate(spec)
+	if !strings.Contains(result, "Pricing.quote(new Quote__c());") || strings.Contains(result, "%%%") {
+		t.Errorf("Expected namespace tokens to be removed, got:\n%s", result)
+	}
+
+	spec.Namespace = "acme.corp"
+	if _, err := Generate(spec); err == nil || !strings.Contains(err.Error(), "namespace must be") {
+		t.Errorf("Expected invalid namespace error, got %v", err)
+	}
+}
+
+func TestGenerate_Vars(t *testing.T) {
+	t.Setenv("APEX_BENCH_TEST_OBJECT", "Contact")
+	spec := types.CodeSpec{
+		Name:       "Parameterized",
+		UserCode:   "List<SObject> rows = Database.query('SELECT Id FROM ${APEX_BENCH_TEST_OBJECT} LIMIT ${SIZE}');",
+		Setup:      "Id accountId = '${ACCOUNT_ID}';",
+		Iterations: 10,
+		Vars:       map[string]string{"SIZE": "200", "ACCOUNT_ID": "001000000000001"},
+	}
+
+	result, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(result, "FROM Contact LIMIT 200") || !strings.Contains(result, "Id accountId = '001000000000001';") {
+		t.Errorf("Expected variables to be substituted, got:\n%s", result)
+	}
+
+	spec.Vars["APEX_BENCH_TEST_OBJECT"] = "Lead"
+	result, _ = Generate(spec)
+	if !strings.Contains(result, "FROM Lead LIMIT") {
+		t.Errorf("Expected Vars to take precedence over the environment, got:\n%s", result)
+	}
+
+	spec.UserCode = "String s = '$${SIZE}';"
+	result, _ = Generate(spec)
+	if !strings.Contains(result, "String s = '${SIZE}';") {
+		t.Errorf("Expected $${SIZE} to be kept as ${SIZE}, got:\n%s", result)
+	}
+
+	spec.Teardown = "delete [SELECT Id FROM ${APEX_BENCH_TEST_UNDEFINED}];"
+	if _, err := Generate(spec); err == nil || !strings.Contains(err.Error(), "undefined variable ${APEX_BENCH_TEST_UNDEFINED}") {
+		t.Errorf("Expected undefined variable error, got %v", err)
+	}
+}
+
+func TestVarNames(t *testing.T) {
+	got := VarNames("${A} ${B} $${C} ${A} ${not valid} $D")
+	if strings.Join(got, ",") != "A,B" {
+		t.Errorf("VarNames() = %v, want [A B]", got)
+	}
+}
+
+func TestGenerate_PhaseTimings(t *testing.T) {
+	spec := types.CodeSpec{
+		Name:       "Seeded",
+		UserCode:   "List<Account> a = [SELECT Id FROM Account];",
+		Setup:      "insert new Account(Name = 'x');",
+		Teardown:   "delete [SELECT Id FROM Account];",
+		Iterations: 10,
+		Warmup:     2,
+	}
+	code, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	setup := strings.Index(code, "insert new Account(Name = 'x');")
+	endSetup := strings.Index(code, ".endSetup();")
+	endWarmup := strings.Index(code, ".endWarmup();")
+	teardown := strings.Index(code, "delete [SELECT Id FROM Account];")
+	endTeardown := strings.Index(code, ".endTeardown();")
+	if setup == -1 || !(setup < endSetup && endSetup < endWarmup && endWarmup < teardown && teardown < endTeardown) {
+		t.Errorf("Expected each phase to be closed after its code, got:\n%s", code)
+	}
+	if !strings.Contains(code, `',"phases":{'`) {
+		t.Error("Expected phase timings in the result JSON")
+	}
+	if !strings.Contains(code, "System.debug('BENCH_WARMUP:start');") || !strings.Contains(code, "System.debug('BENCH_WARMUP:end');") {
+		t.Error("Expected warmup to be marked in the debug log")
+	}
+}
+
+func TestGenerate_WarmupCheck(t *testing.T) {
+	code, err := Generate(types.CodeSpec{Name: "Test", UserCode: "Integer x = 1;", Iterations: 50, BatchSize: 5})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	for _, want := range []string{"Integer earlyIterations = Math.max(1, 50 / 10);", "batchStart = done;", "warmupCheckJson() +"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected code to contain %q", want)
+		}
+	}
+}
+
+func TestGenerate_AutoBatchGrowth(t *testing.T) {
+	code, err := Generate(types.CodeSpec{Name: "Test", UserCode: "Integer x = 1;", Iterations: 200})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	for _, want := range []string{
+		"Integer maxAutoBatchSize = Math.max(1, 200 / 10);",
+		"batchSize = Math.min(batchSize * 2, maxAutoBatchSize);",
+		"batchingJson() +",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected code to contain %q", want)
+		}
+	}
+}
+
+func TestGenerate_ResultParts(t *testing.T) {
+	code, err := Generate(types.CodeSpec{Name: "Test", UserCode: "Integer x = 1;", Iterations: 10})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	logParts := strings.Index(code, ".logParts()) {")
+	whole := strings.Index(code, "System.debug('BENCH_RESULT:' + harness_")
+	if logParts == -1 || whole < logParts || !strings.Contains(code, "'BENCH_RESULT_PART ' + (p + 1) + '/' + parts + ':'") {
+		t.Errorf("Expected long results to be logged in parts, got:\n%s", code)
+	}
+}
+
+func TestRegisterCollector(t *testing.T) {
+	RegisterCollector(Collector{
+		Name:             "test-rows",
+		Fields:           "    Integer rowsBefore;\n",
+		StartMeasurement: "        rowsBefore = Limits.getQueryRows(); // {{.Name}}\n",
+		Values:           map[string]string{"queryRows": "Limits.getQueryRows() - rowsBefore"},
+	})
+	if !slices.Contains(CollectorNames(), "test-rows") {
+		t.Fatalf("Expected test-rows among %v", CollectorNames())
+	}
+
+	spec := types.CodeSpec{Name: "Rows", UserCode: "Integer x = 1;", Iterations: 10, Collectors: []string{"test-rows"}}
+	code, err := Generate(spec)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	for _, want := range []string{
+		"Integer rowsBefore;",
+		"rowsBefore = Limits.getQueryRows(); // Rows",
+		`',"collected":{' +`,
+		`'"queryRows":' + Decimal.valueOf(Limits.getQueryRows() - rowsBefore).toPlainString() +`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected code to contain %q", want)
+		}
+	}
+
+	spec.Collectors = nil
+	if code, _ := Generate(spec); strings.Contains(code, "rowsBefore") || strings.Contains(code, `"collected"`) {
+		t.Error("Expected collectors named by no benchmark to be left out")
+	}
+
+	spec.Collectors = []string{"missing"}
+	if _, err := Generate(spec); err == nil || !strings.Contains(err.Error(), `unknown collector "missing"`) {
+		t.Errorf("Expected an unknown collector error, got %v", err)
+	}
+}
+
+func TestScriptHash(t *testing.T) {
+	spec := types.CodeSpec{Name: "Test", UserCode: "Integer x = 1;", Iterations: 10}
+
+	first, err := ScriptHash(spec)
+	if err != nil {
+		t.Fatalf("ScriptHash() error = %v", err)
+	}
+	second, _ := ScriptHash(spec)
+	if first != second || len(first) != 64 {
+		t.Errorf("Expected a stable SHA-256 hash, got %q and %q", first, second)
+	}
+
+	spec.Iterations = 20
+	if changed, _ := ScriptHash(spec); changed == first {
+		t.Error("Expected a different hash for different settings")
+	}
+	if _, err := ScriptHash(types.CodeSpec{Name: "Empty"}); err == nil {
+		t.Error("Expected an error for an invalid spec")
+	}
+}
@@ -0,0 +1,22 @@
+package generator
+
+import "strings"
+
+// Namespace tokens, as used by CumulusCI, let the same benchmark run against
+// a managed package and against its unpackaged source
+const (
+	// NamespaceToken expands to "ns__", for custom objects and fields
+	NamespaceToken = "%%%NAMESPACE%%%"
+	// NamespaceDotToken expands to "ns.", for classes
+	NamespaceDotToken = "%%%NAMESPACE_DOT%%%"
+)
+
+// expandNamespace replaces the namespace tokens in code. Without a
+// namespace the tokens are removed.
+func expandNamespace(code, namespace string) string {
+	prefix, dot := "", ""
+	if namespace != "" {
+		prefix, dot = namespace+"__", namespace+"."
+	}
+	return strings.NewReplacer(NamespaceDotToken, dot, NamespaceToken, prefix).Replace(code)
+}
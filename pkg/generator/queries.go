@@ -0,0 +1,34 @@
+package generator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// inlineQueryPattern matches an inline SOQL query such as [SELECT Id FROM Account]
+var inlineQueryPattern = regexp.MustCompile(`(?is)\[\s*(SELECT\b[^\]]*)\]`)
+
+// bindVariablePattern matches an Apex bind variable such as :accountIds
+var bindVariablePattern = regexp.MustCompile(`:\s*[A-Za-z_]`)
+
+// ExtractQueries returns the distinct inline SOQL queries in Apex code, in
+// order of appearance, with whitespace collapsed. Queries in comments are
+// ignored; dynamic queries built from strings are not detected.
+func ExtractQueries(code string) []string {
+	var queries []string
+	seen := make(map[string]bool)
+	for _, m := range inlineQueryPattern.FindAllStringSubmatch(stripComments(code), -1) {
+		query := strings.Join(strings.Fields(m[1]), " ")
+		if !seen[query] {
+			seen[query] = true
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// HasBindVariables reports whether a query refers to Apex variables, which
+// only resolve inside Apex
+func HasBindVariables(query string) bool {
+	return bindVariablePattern.MatchString(query)
+}
@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source sections of a CodeSpec that can appear in generated code
+const (
+	SectionCode     = "code"
+	SectionSetup    = "setup"
+	SectionTeardown = "teardown"
+)
+
+// Position identifies a location in user-provided code
+type Position struct {
+	Benchmark string // Name of the benchmark the code belongs to
+	Section   string // One of SectionCode, SectionSetup, SectionTeardown
+	Line      int    // 1-based line within the section's source
+	Column    int    // 1-based column, 0 if unknown
+	Text      string // The source line at Line
+}
+
+// sourceRegion records where a fragment of user code was placed in the
+// generated script
+type sourceRegion struct {
+	benchmark string
+	section   string
+	genLine   int // 1-based line of the fragment's first character
+	genColumn int // 1-based column of the fragment's first character
+	lines     int // number of lines the fragment spans
+	srcLine   int // 1-based line of the fragment within its section
+	srcColumn int // 1-based column of the fragment's first character there
+}
+
+// sourceKey identifies one section of one benchmark's user code
+type sourceKey struct {
+	benchmark string
+	section   string
+}
+
+// SourceMap translates positions in generated Apex back to user code
+type SourceMap struct {
+	regions []sourceRegion
+	sources map[sourceKey][]string
+}
+
+// Lookup maps a 1-based line and column in the generated code to the user
+// code it came from. It returns false for positions inside the harness.
+func (m *SourceMap) Lookup(line, column int) (Position, bool) {
+	if m == nil {
+		return Position{}, false
+	}
+
+	for _, r := range m.regions {
+		if line < r.genLine || line >= r.genLine+r.lines {
+			continue
+		}
+
+		pos := Position{
+			Benchmark: r.benchmark,
+			Section:   r.section,
+			Line:      r.srcLine + (line - r.genLine),
+			Column:    column,
+		}
+		if line == r.genLine && column > 0 {
+			pos.Column = column - r.genColumn + r.srcColumn
+			if pos.Column < 1 {
+				pos.Column = 1
+			}
+		}
+		if src := m.sources[sourceKey{r.benchmark, r.section}]; pos.Line-1 < len(src) {
+			pos.Text = src[pos.Line-1]
+		}
+		return pos, true
+	}
+
+	return Position{}, false
+}
+
+// FormatPosition renders a user code position as a short excerpt with a
+// caret under the offending column
+func FormatPosition(pos Position) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s line %d", pos.Section, pos.Line)
+	if pos.Column > 0 {
+		fmt.Fprintf(&sb, ", column %d", pos.Column)
+	}
+	fmt.Fprintf(&sb, ":\n    %s\n", pos.Text)
+	if pos.Column > 0 {
+		// Reproduce tabs so the caret lines up with the source text
+		var pad strings.Builder
+		for i, ch := range pos.Text {
+			if i >= pos.Column-1 {
+				break
+			}
+			if ch == '\t' {
+				pad.WriteByte('\t')
+			} else {
+				pad.WriteByte(' ')
+			}
+		}
+		fmt.Fprintf(&sb, "    %s^\n", pad.String())
+	}
+	return sb.String()
+}
+
+// fragment is a piece of user code together with the line and column it
+// starts at in its section
+type fragment struct {
+	benchmark string
+	section   string
+	text      string
+	line      int
+	column    int
+}
+
+// placeholder returns the marker substituted for fragment i while rendering
+func placeholder(i int) string {
+	return fmt.Sprintf("\x00%d\x00", i)
+}
+
+// substituteFragments replaces fragment placeholders in rendered template
+// output with the fragment text, recording where each one landed
+func substituteFragments(rendered string, fragments []fragment, sources map[sourceKey]string) (string, *SourceMap) {
+	sm := &SourceMap{sources: make(map[sourceKey][]string)}
+	for key, src := range sources {
+		sm.sources[key] = strings.Split(src, "\n")
+	}
+
+	var out strings.Builder
+	line, column := 1, 1
+	advance := func(s string) {
+		out.WriteString(s)
+		if nl := strings.LastIndexByte(s, '\n'); nl != -1 {
+			line += strings.Count(s, "\n")
+			column = len(s) - nl
+		} else {
+			column += len(s)
+		}
+	}
+
+	rest := rendered
+	for {
+		start := strings.IndexByte(rest, '\x00')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(rest[start+1:], '\x00')
+		if end == -1 {
+			break
+		}
+		end += start + 1
+
+		var idx int
+		if _, err := fmt.Sscanf(rest[start+1:end], "%d", &idx); err != nil || idx < 0 || idx >= len(fragments) {
+			advance(rest[:end+1])
+			rest = rest[end+1:]
+			continue
+		}
+
+		advance(rest[:start])
+		f := fragments[idx]
+		sm.regions = append(sm.regions, sourceRegion{
+			benchmark: f.benchmark,
+			section:   f.section,
+			genLine:   line,
+			genColumn: column,
+			lines:     strings.Count(f.text, "\n") + 1,
+			srcLine:   f.line,
+			srcColumn: f.column,
+		})
+		advance(f.text)
+		rest = rest[end+1:]
+	}
+	advance(rest)
+
+	return out.String(), sm
+}
+
+// trimFragment trims surrounding whitespace from text, which starts at line
+// and column of its section, while tracking where the trimmed text starts
+func trimFragment(section, text string, line, column int) fragment {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	leading := text[:len(text)-len(trimmed)]
+	if nl := strings.LastIndexByte(leading, '\n'); nl != -1 {
+		line += strings.Count(leading, "\n")
+		column = len(leading) - nl
+	} else {
+		column += len(leading)
+	}
+	return fragment{section: section, text: strings.TrimRight(trimmed, " \t\r\n"), line: line, column: column}
+}
@@ -1,122 +1,291 @@
 package generator
 
-const apexTemplate = `// Apex Benchmark - Generated Code
-// Benchmark: {{.Name}}
+// apexTemplate renders a script for one or more benchmarks. The "script"
+// template is executed with a slice of templateData.
+const apexTemplate = `{{define "script"}}// Apex Benchmark - Generated Code
+{{range .}}// Benchmark: {{.Name}}
 // Iterations: {{.Iterations}}
 // Warmup: {{.Warmup}}
-
-{{if .Setup}}
-// Setup code
-{{.Setup}}
+{{end}}
+{{range .}}
+{{if .Declarations}}
+// User declarations
+{{.Declarations}}
+{{end}}
+{{template "harness" .}}
+{{end}}
+{{range .}}{{template "benchmark" .}}{{end}}
 {{end}}
 
-Integer warmupIterations = {{.Warmup}};
-Integer measurementIterations = {{.Iterations}};
+{{define "harness"}}
+// Measurement harness - all state lives in this class so it cannot collide
+// with variables declared by setup, benchmark or teardown code.
+// Iterations are timed in batches of batchSize; per-iteration min/max values
+// are batch averages, which keeps them meaningful when a single iteration
+// is shorter than the millisecond clock resolution.
+public class {{.HarnessClass}} {
+    public Integer warmupIterations = {{.Warmup}};
+    public Integer measurementIterations = {{.Iterations}};
+    public Integer batchSize = {{.BatchSize}};
 
-// Warmup phase - JIT optimization
-for (Integer {{.LoopVar}} = 0; {{.LoopVar}} < warmupIterations; {{.LoopVar}}++) {
-    {{.UserCode}}
-}
+    // With no batch size set, a batch reading 0 ms CPU is below the clock
+    // resolution: the batch size doubles, up to a tenth of the iterations,
+    // and min/max restart so they only come from batches the clock can see
+    Boolean autoBatch = {{.AutoBatch}};
+    Integer maxAutoBatchSize = Math.max(1, {{.Iterations}} / 10);
+    Boolean autoBatched = false;
+    Integer zeroBatches = 0;
 
-// Measurement phase
-Long totalWallTime = 0;
-Long totalCpuTime = 0;
-Long minWallTime = null;
-Long maxWallTime = null;
-Integer minCpuTime = null;
-Integer maxCpuTime = null;
-
-{{if .TrackHeap}}
-Long totalHeapUsed = 0;
-Long minHeapUsed = null;
-Long maxHeapUsed = null;
-{{end}}
+    Long totalWallTime = 0;
+    Long totalCpuTime = 0;
+    Decimal minWallMs = null;
+    Decimal maxWallMs = null;
+    Decimal minCpuMs = null;
+    Decimal maxCpuMs = null;
 
-{{if .TrackDB}}
-Integer dmlStatementsBefore = Limits.getDmlStatements();
-Integer soqlQueriesBefore = Limits.getQueries();
-{{end}}
+    Long loopWallStart;
+    Long loopWallTime;
 
-for (Integer {{.LoopVar}} = 0; {{.LoopVar}} < measurementIterations; {{.LoopVar}}++) {
-    {{if .TrackHeap}}
-    Long heapBefore = Limits.getHeapSize();
-    {{end}}
+    // Wall and CPU time of each phase of the transaction, to show when setup
+    // or teardown outweigh the measured iterations
+    Long phaseWallStart;
+    Integer phaseCpuStart;
+    Long setupWallMs = 0;
+    Integer setupCpuMs = 0;
+    Long warmupWallMs = 0;
+    Integer warmupCpuMs = 0;
+    Long measureWallMs = 0;
+    Integer measureCpuMs = 0;
+    Long teardownWallMs = 0;
+    Integer teardownCpuMs = 0;
 
-    Long wallStart = System.now().getTime();
-    Integer cpuStart = Limits.getCpuTime();
+    // Time of the batches starting within the first earlyIterations measured
+    // iterations, compared with the rest to show whether warmup was enough
+    Integer earlyIterations = Math.max(1, {{.Iterations}} / 10);
+    Integer earlyCount = 0;
+    Long earlyCpuTime = 0;
 
-    {{.UserCode}}
+    Long wallStart;
+    Integer cpuStart;
+    Integer batchStart;
+    public Integer currentBatch;
+{{range .Collectors}}{{if .Fields}}
+{{.Fields}}{{end}}{{end}}
+    public void startPhase() {
+        phaseWallStart = System.now().getTime();
+        phaseCpuStart = Limits.getCpuTime();
+    }
+
+    // BENCH_WARMUP markers bracket the warmup iterations, so the metrics
+    // user code logs during them are left out
+    public void endSetup() {
+        setupWallMs = System.now().getTime() - phaseWallStart;
+        setupCpuMs = Limits.getCpuTime() - phaseCpuStart;
+        if (warmupIterations > 0) {
+            System.debug('BENCH_WARMUP:start');
+        }
+        startPhase();
+    }
+
+    public void endWarmup() {
+        warmupWallMs = System.now().getTime() - phaseWallStart;
+        warmupCpuMs = Limits.getCpuTime() - phaseCpuStart;
+        if (warmupIterations > 0) {
+            System.debug('BENCH_WARMUP:end');
+        }
+    }
+
+    public void endTeardown() {
+        teardownWallMs = System.now().getTime() - phaseWallStart;
+        teardownCpuMs = Limits.getCpuTime() - phaseCpuStart;
+    }
+
+    public void startMeasurement() {
+        startPhase();
+{{range .Collectors}}{{.StartMeasurement}}{{end}}        loopWallStart = System.now().getTime();
+    }
+
+    // Starts timing the batch beginning at iteration done and returns its size
+    public Integer startBatch(Integer done) {
+        batchStart = done;
+        currentBatch = Math.min(batchSize, measurementIterations - done);
+{{range .Collectors}}{{.StartBatch}}{{end}}        wallStart = System.now().getTime();
+        cpuStart = Limits.getCpuTime();
+        return currentBatch;
+    }
+
+    public void endBatch() {
+        Long wallEnd = System.now().getTime();
+        Integer cpuEnd = Limits.getCpuTime();
+
+{{range .Collectors}}{{.EndBatch}}{{end}}
+        Long wallDelta = wallEnd - wallStart;
+        Integer cpuDelta = cpuEnd - cpuStart;
+
+        totalWallTime += wallDelta;
+        totalCpuTime += cpuDelta;
+        if (batchStart < earlyIterations) {
+            earlyCount += currentBatch;
+            earlyCpuTime += cpuDelta;
+        }
 
-    Long wallEnd = System.now().getTime();
-    Integer cpuEnd = Limits.getCpuTime();
+        if (cpuDelta == 0) {
+            // Grow only when another batch follows, so min/max get a value
+            if (autoBatch && batchSize < maxAutoBatchSize && batchStart + currentBatch < measurementIterations) {
+                batchSize = Math.min(batchSize * 2, maxAutoBatchSize);
+                autoBatched = true;
+                minWallMs = null;
+                maxWallMs = null;
+                minCpuMs = null;
+                maxCpuMs = null;
+                return;
+            }
+            zeroBatches++;
+        }
 
-    {{if .TrackHeap}}
-    Long heapAfter = Limits.getHeapSize();
-    Long heapDelta = heapAfter - heapBefore;
-    totalHeapUsed += heapDelta;
-    if (minHeapUsed == null || heapDelta < minHeapUsed) minHeapUsed = heapDelta;
-    if (maxHeapUsed == null || heapDelta > maxHeapUsed) maxHeapUsed = heapDelta;
-    {{end}}
+        Decimal wallPerIteration = Decimal.valueOf(wallDelta) / currentBatch;
+        Decimal cpuPerIteration = Decimal.valueOf(cpuDelta) / currentBatch;
 
-    Long wallDelta = wallEnd - wallStart;
-    Integer cpuDelta = cpuEnd - cpuStart;
+        if (minWallMs == null || wallPerIteration < minWallMs) minWallMs = wallPerIteration;
+        if (maxWallMs == null || wallPerIteration > maxWallMs) maxWallMs = wallPerIteration;
+        if (minCpuMs == null || cpuPerIteration < minCpuMs) minCpuMs = cpuPerIteration;
+        if (maxCpuMs == null || cpuPerIteration > maxCpuMs) maxCpuMs = cpuPerIteration;
+    }
 
-    totalWallTime += wallDelta;
-    totalCpuTime += cpuDelta;
+    public void endMeasurement() {
+        loopWallTime = System.now().getTime() - loopWallStart;
+        measureWallMs = System.now().getTime() - phaseWallStart;
+        measureCpuMs = Limits.getCpuTime() - phaseCpuStart;
+{{range .Collectors}}{{.EndMeasurement}}{{end}}        startPhase();
+    }
 
-    if (minWallTime == null || wallDelta < minWallTime) minWallTime = wallDelta;
-    if (maxWallTime == null || wallDelta > maxWallTime) maxWallTime = wallDelta;
-    if (minCpuTime == null || cpuDelta < minCpuTime) minCpuTime = cpuDelta;
-    if (maxCpuTime == null || cpuDelta > maxCpuTime) maxCpuTime = cpuDelta;
+    // Early and remaining per-iteration CPU, or nothing when the early
+    // batches cover every iteration
+    String warmupCheckJson() {
+        if (earlyCount >= measurementIterations) {
+            return '';
+        }
+        Decimal earlyAvgCpuMs = Decimal.valueOf(earlyCpuTime) / earlyCount;
+        Decimal restAvgCpuMs = Decimal.valueOf(totalCpuTime - earlyCpuTime) / (measurementIterations - earlyCount);
+        return ',"warmupCheck":{"earlyIterations":' + earlyCount +
+            ',"earlyAvgCpuMs":' + earlyAvgCpuMs.toPlainString() +
+            ',"restAvgCpuMs":' + restAvgCpuMs.toPlainString() + '}';
+    }
+
+    // Batching adjustments, or nothing when every batch registered on the clock
+    String batchingJson() {
+        String json = '';
+        if (autoBatched) {
+            json += ',"autoBatched":true';
+        }
+        if (zeroBatches > 0) {
+            json += ',"zeroBatches":' + zeroBatches;
+        }
+        return json;
+    }
+
+    // Results longer than this are logged as BENCH_RESULT_PART n/total
+    // messages, which the parser joins, so large payloads stay within the
+    // debug message size
+    Integer maxResultLength = 3000;
+    public String resultJson;
+
+    // Builds resultJson and logs it in parts when it is too long for one
+    // debug message; returns false when it fits in one
+    public Boolean logParts() {
+        resultJson = toJson();
+        if (resultJson.length() <= maxResultLength) {
+            return false;
+        }
+        Integer parts = (resultJson.length() + maxResultLength - 1) / maxResultLength;
+        for (Integer p = 0; p < parts; p++) {
+            Integer start = p * maxResultLength;
+            System.debug('BENCH_RESULT_PART ' + (p + 1) + '/' + parts + ':' +
+                resultJson.substring(start, Math.min(resultJson.length(), start + maxResultLength)));
+        }
+        return true;
+    }
+
+    public String toJson() {
+        // Averages are computed from the summed batch deltas, which excludes
+        // harness overhead between batches (milliseconds with decimals)
+        Decimal avgWallMs = Decimal.valueOf(totalWallTime) / measurementIterations;
+        Decimal avgCpuMs = Decimal.valueOf(totalCpuTime) / measurementIterations;
+
+        // toPlainString avoids locale-specific grouping and scientific notation
+        return '{' +
+            '"name":{{.NameJSON}},' +
+            '"iterations":' + measurementIterations + ',' +
+            '"batchSize":' + batchSize + ',' +
+            '"avgWallMs":' + avgWallMs.toPlainString() + ',' +
+            '"avgCpuMs":' + avgCpuMs.toPlainString() + ',' +
+            '"minWallMs":' + minWallMs.toPlainString() + ',' +
+            '"maxWallMs":' + maxWallMs.toPlainString() + ',' +
+            '"minCpuMs":' + minCpuMs.toPlainString() + ',' +
+            '"maxCpuMs":' + maxCpuMs.toPlainString() + ',' +
+            '"totalWallMs":' + loopWallTime +
+            ',"phases":{' +
+                '"setupWallMs":' + setupWallMs + ',"setupCpuMs":' + setupCpuMs +
+                ',"warmupWallMs":' + warmupWallMs + ',"warmupCpuMs":' + warmupCpuMs +
+                ',"measureWallMs":' + measureWallMs + ',"measureCpuMs":' + measureCpuMs +
+                ',"teardownWallMs":' + teardownWallMs + ',"teardownCpuMs":' + teardownCpuMs +
+            '}' +
+            warmupCheckJson() +
+            batchingJson() +
+{{range .Collectors}}{{if .Result}}            {{.Result}} +
+{{end}}{{end}}{{if .Collected}}            ',"collected":{' +
+{{range $i, $v := .Collected}}                '{{if $i}},{{end}}{{$v.Name}}:' + Decimal.valueOf({{$v.Expr}}).toPlainString() +
+{{end}}            '}' +
+{{end}}            '}';
+    }
 }
+{{end}}
 
-{{if .TrackDB}}
-Integer dmlStatementsAfter = Limits.getDmlStatements();
-Integer soqlQueriesAfter = Limits.getQueries();
-Integer dmlStatementsDelta = dmlStatementsAfter - dmlStatementsBefore;
-Integer soqlQueriesDelta = soqlQueriesAfter - soqlQueriesBefore;
+{{define "benchmark"}}
+// Benchmark scope - keeps variables of combined benchmarks apart
+{
+{{if .Rollback}}
+// Everything below, including setup, is rolled back once the result is logged
+Savepoint {{.SavepointVar}} = Database.setSavepoint();
 {{end}}
+{{.HarnessClass}} {{.HarnessVar}} = new {{.HarnessClass}}();
+{{.HarnessVar}}.startPhase();
+{{if .Setup}}
+// Setup code
+{{.Setup}}
+{{end}}
+{{.HarnessVar}}.endSetup();
+
+// Warmup phase - JIT optimization
+for (Integer {{.LoopVar}} = 0; {{.LoopVar}} < {{.HarnessVar}}.warmupIterations; {{.LoopVar}}++) {
+    {{.UserCode}}
+}
+{{.HarnessVar}}.endWarmup();
+
+// Measurement phase
+{{.HarnessVar}}.startMeasurement();
+for (Integer {{.LoopVar}} = 0; {{.LoopVar}} < {{.HarnessVar}}.measurementIterations; {{.LoopVar}} += {{.HarnessVar}}.currentBatch) {
+    for (Integer {{.BatchVar}} = {{.HarnessVar}}.startBatch({{.LoopVar}}); {{.BatchVar}} > 0; {{.BatchVar}}--) {
+        {{.UserCode}}
+    }
+    {{.HarnessVar}}.endBatch();
+}
+{{.HarnessVar}}.endMeasurement();
 
 {{if .Teardown}}
 // Teardown code
 {{.Teardown}}
 {{end}}
+{{.HarnessVar}}.endTeardown();
 
-// Calculate averages (convert to milliseconds with decimals)
-Decimal avgWallMs = Decimal.valueOf(totalWallTime) / measurementIterations;
-Decimal avgCpuMs = Decimal.valueOf(totalCpuTime) / measurementIterations;
-Decimal minWallMs = Decimal.valueOf(minWallTime);
-Decimal maxWallMs = Decimal.valueOf(maxWallTime);
-Decimal minCpuMs = Decimal.valueOf(minCpuTime);
-Decimal maxCpuMs = Decimal.valueOf(maxCpuTime);
-
-{{if .TrackHeap}}
-Decimal avgHeapKb = Decimal.valueOf(totalHeapUsed) / measurementIterations / 1024;
-Decimal minHeapKb = Decimal.valueOf(minHeapUsed) / 1024;
-Decimal maxHeapKb = Decimal.valueOf(maxHeapUsed) / 1024;
+// Output result with marker for parsing; results too long for one debug
+// message are logged in numbered parts instead
+if (!{{.HarnessVar}}.logParts()) {
+    System.debug('BENCH_RESULT:' + {{.HarnessVar}}.resultJson);
+}
+{{if .Rollback}}
+Database.rollback({{.SavepointVar}});
+{{end}}
+}
 {{end}}
-
-// Build result JSON
-String resultJson = '{' +
-    '"name":"{{.Name}}",' +
-    '"iterations":' + measurementIterations + ',' +
-    '"avgWallMs":' + avgWallMs.format() + ',' +
-    '"avgCpuMs":' + avgCpuMs.format() + ',' +
-    '"minWallMs":' + minWallMs.format() + ',' +
-    '"maxWallMs":' + maxWallMs.format() + ',' +
-    '"minCpuMs":' + minCpuMs.format() + ',' +
-    '"maxCpuMs":' + maxCpuMs.format() +
-    {{if .TrackHeap}}
-    ',"avgHeapKb":' + avgHeapKb.format() +
-    ',"minHeapKb":' + minHeapKb.format() +
-    ',"maxHeapKb":' + maxHeapKb.format() +
-    {{end}}
-    {{if .TrackDB}}
-    ',"dmlStatements":' + dmlStatementsDelta +
-    ',"soqlQueries":' + soqlQueriesDelta +
-    {{end}}
-    '}';
-
-// Output result with marker for parsing
-System.debug('BENCH_RESULT:' + resultJson);
 `
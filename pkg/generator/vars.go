@@ -0,0 +1,53 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// varPattern matches ${NAME} references, and $${NAME} escapes of them
+var varPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// VarNamePattern is the form of variable names, as in shells
+var VarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// VarNames returns the names of the ${NAME} references in code, in order of
+// first appearance
+func VarNames(code string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range varPattern.FindAllStringSubmatch(code, -1) {
+		if strings.HasPrefix(m[0], "$$") || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// expandVars replaces the ${NAME} references in code with their value in
+// vars or, failing that, in the environment. $${NAME} is kept as ${NAME}.
+func expandVars(code string, vars map[string]string) (string, error) {
+	var undefined []string
+	expanded := varPattern.ReplaceAllStringFunc(code, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := ref[2 : len(ref)-1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		undefined = append(undefined, name)
+		return ref
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined variable ${%s} (set it with --var %s=value, in the suite's vars or in the environment)", undefined[0], undefined[0])
+	}
+	return expanded, nil
+}
@@ -0,0 +1,234 @@
+// Package history keeps benchmark results over time in an append-only
+// JSON Lines file, one entry per benchmark session, so trends can be
+// followed across runs.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// Entry is the outcome of one benchmark session
+type Entry struct {
+	Time    time.Time                `json:"time"`
+	Org     string                   `json:"org,omitempty"`
+	Results []types.AggregatedResult `json:"results"`
+}
+
+// maxLineSize bounds one entry in a history file; results with raw runs
+// can be large
+const maxLineSize = 64 << 20
+
+// Append adds entry to the history file at path, creating the file and its
+// directory when missing
+func Append(path string, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create history directory: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history %s: %w", path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Load reads every entry of the history file at path, oldest first. A
+// missing file is an empty history.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history %s: %w", path, err)
+	}
+	defer f.Close()
+
+	entries, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Read decodes entries written as JSON Lines, or as one JSON array such as
+// an export with the json format
+func Read(r io.Reader) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if unicode.IsSpace(c) {
+			continue
+		}
+		br.UnreadRune()
+		if c == '[' {
+			var entries []Entry
+			if err := json.NewDecoder(br).Decode(&entries); err != nil {
+				return nil, fmt.Errorf("invalid JSON array: %w", err)
+			}
+			return entries, nil
+		}
+		break
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid entry on line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Write encodes entries as JSON Lines
+func Write(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save replaces the history file at path with entries. The file is written
+// next to it first and renamed, so a failure leaves the old history intact.
+func Save(path string, entries []Entry) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create history directory: %w", err)
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write history %s: %w", path, err)
+	}
+	if err := Write(f, entries); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write history %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write history %s: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write history %s: %w", path, err)
+	}
+	return nil
+}
+
+// Merge adds the entries of incoming missing from entries and returns the
+// union ordered by time, with the number added. Entries are the same when
+// they share their time and org, which identifies a session.
+func Merge(entries, incoming []Entry) ([]Entry, int) {
+	seen := make(map[string]bool, len(entries))
+	merged := make([]Entry, 0, len(entries)+len(incoming))
+	for _, entry := range entries {
+		seen[entry.key()] = true
+		merged = append(merged, entry)
+	}
+	added := 0
+	for _, entry := range incoming {
+		if seen[entry.key()] {
+			continue
+		}
+		seen[entry.key()] = true
+		merged = append(merged, entry)
+		added++
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Time.Before(merged[j].Time) })
+	return merged, added
+}
+
+// Cached returns the newest successful result of entries with cacheKey
+// that was measured at or after since, along with when it was measured.
+// Results that were themselves served from the cache count from when they
+// were measured.
+func Cached(entries []Entry, cacheKey string, since time.Time) (types.AggregatedResult, time.Time, bool) {
+	var found types.AggregatedResult
+	var measured time.Time
+	ok := false
+	for _, entry := range entries {
+		for _, result := range entry.Results {
+			if result.CacheKey != cacheKey || result.Error != "" || result.Partial {
+				continue
+			}
+			at := entry.Time
+			if result.CachedFrom != nil {
+				at = *result.CachedFrom
+			}
+			if at.Before(since) || (ok && !at.After(measured)) {
+				continue
+			}
+			found, measured, ok = result, at, true
+		}
+	}
+	return found, measured, ok
+}
+
+// Latest returns the newest successful result of entries named name, along
+// with when it was measured
+func Latest(entries []Entry, name string) (types.AggregatedResult, time.Time, bool) {
+	var found types.AggregatedResult
+	var measured time.Time
+	ok := false
+	for _, entry := range entries {
+		for _, result := range entry.Results {
+			if result.Name != name || result.Error != "" || result.Partial {
+				continue
+			}
+			at := entry.Time
+			if result.CachedFrom != nil {
+				at = *result.CachedFrom
+			}
+			if ok && !at.After(measured) {
+				continue
+			}
+			found, measured, ok = result, at, true
+		}
+	}
+	return found, measured, ok
+}
+
+// key identifies the session of an entry
+func (e Entry) key() string {
+	return e.Time.UTC().Format(time.RFC3339Nano) + " " + e.Org
+}
@@ -0,0 +1,134 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perf", "history.jsonl")
+
+	entries, err := Load(path)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected an empty history for a missing file, got %v, %v", entries, err)
+	}
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 2 {
+		entry := Entry{
+			Time:    start.Add(time.Duration(i) * time.Hour),
+			Org:     "staging",
+			Results: []types.AggregatedResult{{Name: "Loop", AvgCpuMs: float64(i + 1)}},
+		}
+		if err := Append(path, entry); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	entries, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if !entries[1].Time.Equal(start.Add(time.Hour)) || entries[1].Org != "staging" || entries[1].Results[0].AvgCpuMs != 2 {
+		t.Errorf("Unexpected second entry: %+v", entries[1])
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte("{\"results\":[]}\nnot json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error naming line 2, got %v", err)
+	}
+}
+
+func TestRead_Array(t *testing.T) {
+	entries, err := Read(strings.NewReader(` [{"time": "2026-01-02T03:04:05Z", "org": "a", "results": []}]`))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Org != "a" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestMergeAndSave(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	local := []Entry{{Time: start, Org: "a"}, {Time: start.Add(2 * time.Hour), Org: "a"}}
+	remote := []Entry{{Time: start, Org: "a"}, {Time: start.Add(time.Hour), Org: "b"}}
+
+	merged, added := Merge(local, remote)
+	if added != 1 || len(merged) != 3 {
+		t.Fatalf("Expected 1 new entry of 3, got %d of %d", added, len(merged))
+	}
+	if merged[1].Org != "b" {
+		t.Errorf("Expected entries ordered by time, got %+v", merged)
+	}
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := Save(path, merged); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil || len(loaded) != 3 {
+		t.Errorf("Expected 3 saved entries, got %d, %v", len(loaded), err)
+	}
+	if leftovers, _ := filepath.Glob(path + ".*.tmp"); len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files, got %v", leftovers)
+	}
+}
+
+func TestCached(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	earlier := day.Add(-48 * time.Hour)
+	entries := []Entry{
+		{Time: earlier, Results: []types.AggregatedResult{{Name: "Old", CacheKey: "k", AvgCpuMs: 1}}},
+		{Time: day, Results: []types.AggregatedResult{
+			{Name: "Failed", CacheKey: "k", Error: "boom"},
+			{Name: "Copy", CacheKey: "k", AvgCpuMs: 1, CachedFrom: &earlier},
+			{Name: "Other", CacheKey: "other"},
+		}},
+		{Time: day.Add(-time.Hour), Results: []types.AggregatedResult{{Name: "Newest", CacheKey: "k", AvgCpuMs: 2}}},
+	}
+
+	result, measured, ok := Cached(entries, "k", day.Add(-24*time.Hour))
+	if !ok || result.Name != "Newest" || !measured.Equal(day.Add(-time.Hour)) {
+		t.Errorf("Expected the newest successful result, got %q at %v (%v)", result.Name, measured, ok)
+	}
+	if _, _, ok := Cached(entries, "k", day); ok {
+		t.Error("Expected no result measured since the cutoff")
+	}
+	if _, _, ok := Cached(entries, "missing", earlier); ok {
+		t.Error("Expected no result for an unknown key")
+	}
+}
+
+func TestLatest(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: day, Results: []types.AggregatedResult{{Name: "A", AvgCpuMs: 2}, {Name: "B", Error: "boom"}}},
+		{Time: day.Add(-time.Hour), Results: []types.AggregatedResult{{Name: "A", AvgCpuMs: 1}, {Name: "B", AvgCpuMs: 3}}},
+	}
+
+	result, measured, ok := Latest(entries, "A")
+	if !ok || result.AvgCpuMs != 2 || !measured.Equal(day) {
+		t.Errorf("Expected the newest result of A, got %+v at %v", result, measured)
+	}
+	if result, _, ok := Latest(entries, "B"); !ok || result.AvgCpuMs != 3 {
+		t.Errorf("Expected the newest successful result of B, got %+v", result)
+	}
+	if _, _, ok := Latest(entries, "C"); ok {
+		t.Error("Expected no result for an unknown benchmark")
+	}
+}
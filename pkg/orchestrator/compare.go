@@ -0,0 +1,411 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/history"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// Comparison is the outcome of comparing benchmarks, before it is reported
+type Comparison struct {
+	Results        []types.AggregatedResult
+	Metrics        reporter.Metrics       // Table settings, and the metric requirements are checked on
+	Raw            reporter.RawMode       // Per-run data kept in JSON reports
+	Benchmarks     int                    // Benchmarks that were to run
+	RunErr         error                  // Failure that stopped the comparison early
+	BudgetFailures int                    // Threshold checks that failed
+	Requirements   []stats.Assertion      // Conditions checked by Err
+	Invocations    types.InvocationTiming // Executions of the session against their Apex time; cached results have none
+
+	logf func(format string, args ...interface{})
+}
+
+// Compare validates the options, runs the benchmarks of Config, serving
+// stored results with Config.Cache and Config.Unchanged, checks their
+// budgets and appends the results to Config.History. It only fails when no
+// benchmark produced a result; other failures are left to Comparison.Err.
+func Compare(ctx context.Context, opts Options) (Comparison, error) {
+	config := opts.Config
+	if _, err := stats.ParseStrategy(config.Aggregate); err != nil {
+		return Comparison{}, err
+	}
+	metrics, err := reporter.ParseMetrics(config.Metrics)
+	if err != nil {
+		return Comparison{}, err
+	}
+	metrics.ShowRuns = config.ShowRuns
+	metrics.NoiseThreshold = config.NoiseThreshold / 100
+	rawMode, err := reporter.ParseRawMode(config.Raw)
+	if err != nil {
+		return Comparison{}, err
+	}
+	if metrics.RelativeTo, err = reporter.ParseRelativeTo(config.RelativeTo); err != nil {
+		return Comparison{}, err
+	}
+	if metrics.RelativeTo == "heap" && !config.TrackHeap {
+		return Comparison{}, optionErrorf("{RelativeTo} heap requires {TrackHeap}")
+	}
+	if err := ValidateAPIVersion(config.APIVersion); err != nil {
+		return Comparison{}, err
+	}
+	if err := ValidateMinSuccessful(config); err != nil {
+		return Comparison{}, err
+	}
+	if config.QueryPlan && !config.TrackDB {
+		return Comparison{}, optionErrorf("{QueryPlan} requires {TrackDB}")
+	}
+	if err := ValidateUniqueNames(config.Benchmarks); err != nil {
+		return Comparison{}, err
+	}
+	if metrics.Baseline, err = findBaseline(config.Benchmarks, config.Baseline); err != nil {
+		return Comparison{}, err
+	}
+	requirements, err := parseRequirements(config.Benchmarks, config.Require)
+	if err != nil {
+		return Comparison{}, err
+	}
+	thresholds, err := benchmarkThresholds(config)
+	if err != nil {
+		return Comparison{}, err
+	}
+	units, err := benchmarkUnits(config.Benchmarks)
+	if err != nil {
+		return Comparison{}, err
+	}
+	if config.PerUnits < 0 {
+		return Comparison{}, optionErrorf("{PerUnits} cannot be negative, got %g", config.PerUnits)
+	}
+	if units != nil {
+		metrics.PerUnits = config.PerUnits
+		if metrics.PerUnits == 0 {
+			metrics.PerUnits = 1
+		}
+	}
+
+	specs := make([]types.CodeSpec, 0, len(config.Benchmarks))
+	for _, benchSpec := range config.Benchmarks {
+		spec, err := bench.NewCodeSpec(benchSpec, config)
+		if err != nil {
+			return Comparison{}, err
+		}
+		specs = append(specs, spec)
+	}
+
+	var cacheKeys map[string]string
+	var cached map[int]types.AggregatedResult
+	if config.Cache || len(config.Unchanged) > 0 {
+		if cacheKeys, cached, err = cachedResults(opts, specs); err != nil {
+			return Comparison{}, err
+		}
+	}
+	toRun := make([]types.CodeSpec, 0, len(specs))
+	for i, spec := range specs {
+		if _, ok := cached[i]; !ok {
+			toRun = append(toRun, spec)
+		}
+	}
+
+	var aggregatedResults []types.AggregatedResult
+	var runErr error
+	var invocations types.InvocationTiming
+	if len(toRun) > 0 {
+		runner := opts.Runner()
+		aggregatedResults, runErr = runner.Compare(ctx, toRun)
+		invocations = runner.Invocations()
+	}
+	if len(cached) > 0 {
+		aggregatedResults = mergeCached(specs, cached, aggregatedResults)
+	}
+	if len(aggregatedResults) == 0 {
+		return Comparison{}, runErr
+	}
+	for i := range aggregatedResults {
+		if aggregatedResults[i].CachedFrom == nil {
+			aggregatedResults[i].CacheKey = cacheKeys[aggregatedResults[i].Name]
+		}
+	}
+
+	for i := range aggregatedResults {
+		stats.NormalizePerUnit(&aggregatedResults[i], units[aggregatedResults[i].Name])
+	}
+
+	budgetFailures := 0
+	for i, result := range aggregatedResults {
+		threshold, ok := thresholds[result.Name]
+		if !ok || result.Error != "" {
+			continue
+		}
+		stats.CheckThresholds(&aggregatedResults[i], threshold)
+		for _, c := range aggregatedResults[i].Thresholds {
+			if !c.Pass {
+				budgetFailures++
+			}
+		}
+	}
+
+	if config.History != "" && ctx.Err() == nil {
+		entry := history.Entry{Time: time.Now().UTC(), Org: opts.Org, Results: aggregatedResults}
+		if err := history.Append(config.History, entry); err != nil {
+			return Comparison{}, err
+		}
+	}
+
+	return Comparison{
+		Results:        aggregatedResults,
+		Metrics:        metrics,
+		Raw:            rawMode,
+		Benchmarks:     len(specs),
+		RunErr:         runErr,
+		BudgetFailures: budgetFailures,
+		Requirements:   requirements,
+		Invocations:    invocations,
+		logf:           opts.logf,
+	}, nil
+}
+
+// Err returns why the comparison failed, if it did: a benchmark stopping it
+// early, failed benchmarks, exceeded budgets or unmet requirements. Each
+// requirement's outcome is reported as progress.
+func (c Comparison) Err(ctx context.Context) error {
+	if c.RunErr != nil && ctx.Err() != nil {
+		return c.RunErr
+	}
+	if c.RunErr != nil {
+		return optionErrorf("%w (stopped after %d of %d benchmarks; use {KeepGoing} to run the rest)", c.RunErr, len(c.Results), c.Benchmarks)
+	}
+	failed := 0
+	for _, result := range c.Results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	requireErr := c.checkRequirements()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d benchmarks failed", failed, len(c.Results))
+	}
+	if c.BudgetFailures > 0 {
+		return fmt.Errorf("%d budget checks failed", c.BudgetFailures)
+	}
+	return requireErr
+}
+
+// checkRequirements evaluates the requirements over the metric comparisons
+// are ranked by, reporting each outcome, and fails if any does not hold
+func (c Comparison) checkRequirements() error {
+	logf := c.logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	var failed []string
+	for _, a := range c.Requirements {
+		ok, detail := a.Check(c.Results, stats.MetricValue(c.Metrics.RelativeTo))
+		if ok {
+			logf("PASS %s (%s)\n", a.Expr, detail)
+			continue
+		}
+		logf("FAIL %s (%s)\n", a.Expr, detail)
+		failed = append(failed, fmt.Sprintf("%s (%s)", a.Expr, detail))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d requirements failed: %s", len(failed), len(c.Requirements), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// DefaultCacheMaxAge is the oldest cached result served when the config
+// sets no limit
+const DefaultCacheMaxAge = 24 * time.Hour
+
+// cachedResults looks up stored results of specs in Config.History: with
+// Config.Cache, results measured with the same script and settings within
+// the cache's maximum age, and for benchmarks in Config.Unchanged, their
+// latest result. It returns the cache key of each benchmark by name, when
+// caching, and the stored results by index in specs. Benchmarks whose
+// script cannot be generated are left to fail when they run.
+func cachedResults(opts Options, specs []types.CodeSpec) (map[string]string, map[int]types.AggregatedResult, error) {
+	config := opts.Config
+	if config.History == "" {
+		if config.Cache {
+			return nil, nil, optionErrorf("{Cache} requires a history file to serve results from")
+		}
+		return nil, nil, optionErrorf("{Unchanged} requires a history file with results of the unchanged benchmarks")
+	}
+	if config.CacheMaxAge < 0 {
+		return nil, nil, optionErrorf("{CacheMaxAge} cannot be negative, got %s", config.CacheMaxAge)
+	}
+	maxAge := config.CacheMaxAge
+	if maxAge == 0 {
+		maxAge = DefaultCacheMaxAge
+	}
+	entries, err := history.Load(config.History)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	since := time.Now().Add(-maxAge)
+	keys := make(map[string]string, len(specs))
+	cached := make(map[int]types.AggregatedResult)
+	for i, spec := range specs {
+		var result types.AggregatedResult
+		var measured time.Time
+		ok := false
+		if config.Cache {
+			if key, err := bench.CacheKey(spec, opts.Org, config); err == nil {
+				keys[spec.Name] = key
+				result, measured, ok = history.Cached(entries, key, since)
+			}
+		}
+		if !ok && slices.Contains(config.Unchanged, spec.Name) {
+			result, measured, ok = history.Latest(entries, spec.Name)
+		}
+		if !ok {
+			continue
+		}
+
+		// Budgets and units are checked again for this session
+		result.Name = spec.Name
+		result.CachedFrom = &measured
+		result.Thresholds = nil
+		result.Units, result.CpuMsPerUnit, result.WallMsPerUnit = 0, 0, 0
+		cached[i] = result
+		opts.logf("Using the stored result of %s measured %s ago\n", spec.Name, time.Since(measured).Round(time.Second))
+	}
+	return keys, cached, nil
+}
+
+// mergeCached returns the results of specs in order, taking cached ones
+// from cached and the others from measured, which holds the results of the
+// benchmarks that ran, in order
+func mergeCached(specs []types.CodeSpec, cached map[int]types.AggregatedResult, measured []types.AggregatedResult) []types.AggregatedResult {
+	merged := make([]types.AggregatedResult, 0, len(specs))
+	next := 0
+	for i, spec := range specs {
+		if result, ok := cached[i]; ok {
+			merged = append(merged, result)
+			continue
+		}
+		if next < len(measured) && measured[next].Name == spec.Name {
+			merged = append(merged, measured[next])
+			next++
+		}
+	}
+	return merged
+}
+
+// ValidateUniqueNames rejects benchmarks sharing a name, which would make
+// comparison rows ambiguous and collide in anything keyed by name, such as
+// combined results and baselines
+func ValidateUniqueNames(specs []types.BenchmarkSpec) error {
+	seen := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		name := strings.TrimSpace(spec.Name)
+		if first, ok := seen[name]; ok {
+			return fmt.Errorf("benchmarks %d and %d are both named %q; benchmark names must be unique", first+1, i+1, name)
+		}
+		seen[name] = i
+	}
+	return nil
+}
+
+// findBaseline returns the name of the benchmark designated as baseline,
+// which must be one of specs. An empty baseline is returned as is.
+func findBaseline(specs []types.BenchmarkSpec, baseline string) (string, error) {
+	baseline = strings.TrimSpace(baseline)
+	if baseline == "" {
+		return "", nil
+	}
+	name, ok := FindBenchmark(specs, baseline)
+	if !ok {
+		return "", optionErrorf("{Baseline} %q matches no benchmark", baseline)
+	}
+	return name, nil
+}
+
+// FindBenchmark returns the name of the benchmark in specs called name,
+// ignoring surrounding whitespace
+func FindBenchmark(specs []types.BenchmarkSpec, name string) (string, bool) {
+	for _, spec := range specs {
+		if strings.TrimSpace(spec.Name) == strings.TrimSpace(name) {
+			return spec.Name, true
+		}
+	}
+	return "", false
+}
+
+// benchmarkUnits returns the units of work of each benchmark by name, or
+// nil when none declares them. Per-unit comparison needs every benchmark's
+// units, so declaring only some is rejected.
+func benchmarkUnits(specs []types.BenchmarkSpec) (map[string]float64, error) {
+	units := make(map[string]float64, len(specs))
+	var missing []string
+	for _, spec := range specs {
+		switch {
+		case spec.Units < 0:
+			return nil, fmt.Errorf("benchmark %q: units cannot be negative, got %g", spec.Name, spec.Units)
+		case spec.Units == 0:
+			missing = append(missing, spec.Name)
+		default:
+			units[spec.Name] = spec.Units
+		}
+	}
+	if len(units) == 0 {
+		return nil, nil
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("units are set for some benchmarks but not for %s; set them for every benchmark to compare per unit", strings.Join(missing, ", "))
+	}
+	return units, nil
+}
+
+// parseRequirements parses --require conditions, checking that every
+// benchmark they name is compared
+func parseRequirements(specs []types.BenchmarkSpec, exprs []string) ([]stats.Assertion, error) {
+	requirements := make([]stats.Assertion, 0, len(exprs))
+	for _, expr := range exprs {
+		a, err := stats.ParseAssertion(expr)
+		if err != nil {
+			return nil, err
+		}
+		for _, operand := range []*stats.Operand{&a.Left, &a.Right} {
+			if operand.Name == "" {
+				continue
+			}
+			name, ok := FindBenchmark(specs, operand.Name)
+			if !ok {
+				return nil, fmt.Errorf("requirement %q names unknown benchmark %q", a.Expr, operand.Name)
+			}
+			operand.Name = name
+		}
+		requirements = append(requirements, a)
+	}
+	return requirements, nil
+}
+
+// benchmarkThresholds returns the budgets of the compared benchmarks by
+// benchmark name. Budgets of benchmarks left out, e.g. by suite filters, are
+// dropped; limits on metrics that are not tracked are rejected.
+func benchmarkThresholds(config types.BenchmarkConfig) (map[string]types.Threshold, error) {
+	thresholds := make(map[string]types.Threshold, len(config.Thresholds))
+	for key, threshold := range config.Thresholds {
+		name, ok := FindBenchmark(config.Benchmarks, key)
+		if !ok {
+			continue
+		}
+		if threshold.MaxHeapKb != nil && !config.TrackHeap {
+			return nil, fmt.Errorf("maxHeapKb threshold of %q requires trackHeap", name)
+		}
+		if threshold.MaxSoql != nil && !config.TrackDB {
+			return nil, fmt.Errorf("maxSoql threshold of %q requires trackDB", name)
+		}
+		thresholds[name] = threshold
+	}
+	return thresholds, nil
+}
@@ -0,0 +1,97 @@
+package orchestrator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestCompare(t *testing.T) {
+	var progress []string
+	opts := Options{
+		Executor: executor.NewSimulatedExecutor(),
+		Config: types.BenchmarkConfig{
+			Benchmarks: []types.BenchmarkSpec{{Name: "Concat", Code: "String s = 'a' + 'b';"}, {Name: "Format", Code: "String s = 'a';"}},
+			Iterations: 10,
+			Runs:       2,
+			Metrics:    "cpu,wall",
+			Require:    []string{"Concat < 0"},
+		},
+		Logf: func(format string, args ...interface{}) { progress = append(progress, format) },
+	}
+
+	c, err := Compare(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if len(c.Results) != 2 || c.Benchmarks != 2 || c.Results[0].Runs != 2 || !c.Metrics.Wall {
+		t.Errorf("Unexpected comparison: %+v", c)
+	}
+	if c.Invocations.Invocations != 4 {
+		t.Errorf("Expected the session's 4 invocations to be timed, got %+v", c.Invocations)
+	}
+	err = c.Err(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 requirements failed: Concat < 0") {
+		t.Errorf("Expected a failed requirement, got %v", err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != "FAIL %s (%s)\n" {
+		t.Errorf("Expected the requirement's outcome as progress, got %q", progress)
+	}
+
+	opts.Config.Benchmarks[1].Name = "Concat"
+	if _, err := Compare(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "both named") {
+		t.Errorf("Expected a duplicate name error, got %v", err)
+	}
+}
+
+func TestValidateUniqueNames(t *testing.T) {
+	unique := []types.BenchmarkSpec{{Name: "A"}, {Name: "B"}, {Name: "a"}}
+	if err := ValidateUniqueNames(unique); err != nil {
+		t.Errorf("ValidateUniqueNames() error = %v", err)
+	}
+
+	duplicate := []types.BenchmarkSpec{{Name: "Loop"}, {Name: "Map"}, {Name: " Loop "}}
+	err := ValidateUniqueNames(duplicate)
+	if err == nil || !strings.Contains(err.Error(), `benchmarks 1 and 3 are both named "Loop"`) {
+		t.Errorf("Expected duplicate name error, got %v", err)
+	}
+}
+
+func TestFindBaseline(t *testing.T) {
+	specs := []types.BenchmarkSpec{{Name: "Current"}, {Name: "Refactored"}}
+
+	if got, err := findBaseline(specs, ""); err != nil || got != "" {
+		t.Errorf("findBaseline() with no baseline = %q, %v", got, err)
+	}
+	if got, err := findBaseline(specs, " Current "); err != nil || got != "Current" {
+		t.Errorf("findBaseline() = %q, %v, want Current", got, err)
+	}
+	if _, err := findBaseline(specs, "current"); err == nil || !strings.Contains(err.Error(), "matches no benchmark") {
+		t.Errorf("Expected an unknown baseline error, got %v", err)
+	}
+}
+
+func TestBenchmarkUnits(t *testing.T) {
+	units, err := benchmarkUnits([]types.BenchmarkSpec{{Name: "A"}, {Name: "B"}})
+	if err != nil || units != nil {
+		t.Errorf("benchmarkUnits() without units = %v, %v, want nil", units, err)
+	}
+
+	units, err = benchmarkUnits([]types.BenchmarkSpec{{Name: "A", Units: 10}, {Name: "B", Units: 100}})
+	if err != nil || units["A"] != 10 || units["B"] != 100 {
+		t.Errorf("benchmarkUnits() = %v, %v", units, err)
+	}
+
+	_, err = benchmarkUnits([]types.BenchmarkSpec{{Name: "A", Units: 10}, {Name: "B"}})
+	if err == nil || !strings.Contains(err.Error(), "not for B") {
+		t.Errorf("Expected an error for missing units, got %v", err)
+	}
+
+	_, err = benchmarkUnits([]types.BenchmarkSpec{{Name: "A", Units: -1}, {Name: "B", Units: 1}})
+	if err == nil || !strings.Contains(err.Error(), "cannot be negative") {
+		t.Errorf("Expected an error for negative units, got %v", err)
+	}
+}
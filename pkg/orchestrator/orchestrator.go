@@ -0,0 +1,170 @@
+// Package orchestrator runs benchmark sessions the way the run and compare
+// commands do: it validates a configuration, serves stored results, runs
+// the remaining benchmarks with a bench.Runner and checks budgets and
+// requirements. Parsing flags and rendering reports are left to callers.
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/bench"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/redact"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/reporter"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// OptionError reports invalid or conflicting Config settings. Format names
+// the settings by their Config field in braces, e.g. "{QueryPlan} requires
+// {TrackDB}", so callers can name them the way their users set them.
+type OptionError struct {
+	Format string
+	Args   []interface{} // Arguments of Format; an error among them is wrapped
+}
+
+// optionErrorf returns an OptionError
+func optionErrorf(format string, args ...interface{}) error {
+	return &OptionError{Format: format, Args: args}
+}
+
+// optionPattern matches a setting named in the Format of an OptionError
+var optionPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+func (e *OptionError) Error() string {
+	return e.Message(func(field string) string { return field })
+}
+
+// Message returns the error with each setting named by name
+func (e *OptionError) Message(name func(field string) string) string {
+	format := optionPattern.ReplaceAllStringFunc(e.Format, func(m string) string {
+		return name(m[1 : len(m)-1])
+	})
+	return fmt.Errorf(format, e.Args...).Error()
+}
+
+func (e *OptionError) Unwrap() error {
+	for _, arg := range e.Args {
+		if err, ok := arg.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Options are the settings of a session
+type Options struct {
+	Executor executor.Executor
+	Org      string
+	Config   types.BenchmarkConfig
+
+	// Optional message sinks; nil discards the messages
+	Logf   func(format string, args ...interface{}) // Progress
+	Debugf func(format string, args ...interface{}) // Per-run details
+	Warnf  func(format string, args ...interface{}) // Problems that do not stop the session
+
+	// Masks secrets in saved logs, captured debug output and errors; nil
+	// keeps them
+	Redactor *redact.Redactor
+
+	// Optional hook after each execution of a script, see
+	// bench.Runner.OnRunComplete
+	OnRunComplete func(bench.RunEvent)
+}
+
+// Runner creates a bench.Runner for the options, fetching query plans with
+// Config.QueryPlan
+func (o Options) Runner() *bench.Runner {
+	runner := bench.NewRunner(o.Executor, o.Org, o.Config)
+	runner.Logf = o.Logf
+	runner.Debugf = o.Debugf
+	runner.Warnf = o.Warnf
+	runner.Redactor = o.Redactor
+	runner.OnRunComplete = o.OnRunComplete
+	if o.Config.QueryPlan {
+		runner.Explainer = QueryExplainer(o.Executor)
+	}
+	return runner
+}
+
+func (o Options) logf(format string, args ...interface{}) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// QueryExplainer returns exec when it can explain queries itself and
+// otherwise explains them over the API with the org's sf CLI session
+func QueryExplainer(exec executor.Executor) executor.QueryExplainer {
+	if explainer, ok := exec.(executor.QueryExplainer); ok {
+		return explainer
+	}
+	return executor.NewAPIExecutor()
+}
+
+// Single is the outcome of benchmarking one piece of code
+type Single struct {
+	Result  types.AggregatedResult
+	Metrics reporter.Metrics // Table settings from Config.Metrics, Config.ShowRuns and Config.NoiseThreshold
+	Raw     reporter.RawMode // Per-run data kept in JSON reports
+}
+
+// Run validates the options and benchmarks spec. Execution settings are
+// taken from Config; its benchmark list is not used. When ctx is cancelled
+// after some runs finished, the partial result is returned with the error.
+func Run(ctx context.Context, opts Options, spec types.CodeSpec) (Single, error) {
+	config := opts.Config
+	if _, err := stats.ParseStrategy(config.Aggregate); err != nil {
+		return Single{}, err
+	}
+	metrics, err := reporter.ParseMetrics(config.Metrics)
+	if err != nil {
+		return Single{}, err
+	}
+	metrics.ShowRuns = config.ShowRuns
+	metrics.NoiseThreshold = config.NoiseThreshold / 100
+	rawMode, err := reporter.ParseRawMode(config.Raw)
+	if err != nil {
+		return Single{}, err
+	}
+	if err := ValidateAPIVersion(config.APIVersion); err != nil {
+		return Single{}, err
+	}
+	if err := ValidateMinSuccessful(config); err != nil {
+		return Single{}, err
+	}
+	if config.QueryPlan && !spec.TrackDB {
+		return Single{}, optionErrorf("{QueryPlan} requires {TrackDB}")
+	}
+
+	aggregated, err := opts.Runner().Run(ctx, spec)
+	if err != nil && !aggregated.Partial {
+		return Single{}, err
+	}
+	return Single{Result: aggregated, Metrics: metrics, Raw: rawMode}, err
+}
+
+// apiVersionPattern matches Salesforce API versions such as "62.0"
+var apiVersionPattern = regexp.MustCompile(`^\d+\.0$`)
+
+// ValidateAPIVersion checks an --api-version value; empty is allowed and
+// uses the org default
+func ValidateAPIVersion(version string) error {
+	if version != "" && !apiVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid API version %q (expected e.g. 62.0)", version)
+	}
+	return nil
+}
+
+// ValidateMinSuccessful checks MinSuccessful against Runs
+func ValidateMinSuccessful(config types.BenchmarkConfig) error {
+	if config.MinSuccessful < 0 {
+		return optionErrorf("{MinSuccessful} must not be negative, got %d", config.MinSuccessful)
+	}
+	if config.MinSuccessful > max(config.Runs, 1) {
+		return optionErrorf("{MinSuccessful} %d exceeds {Runs} %d", config.MinSuccessful, max(config.Runs, 1))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/executor"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestRun(t *testing.T) {
+	opts := Options{Executor: executor.NewSimulatedExecutor(), Config: types.BenchmarkConfig{Runs: 3, Raw: "summary", ShowRuns: true}}
+	spec := types.CodeSpec{Name: "Concat", UserCode: "String s = 'a' + 'b';", Iterations: 10}
+
+	single, err := Run(context.Background(), opts, spec)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if single.Result.Name != "Concat" || single.Result.Runs != 3 || single.Raw != "summary" || !single.Metrics.ShowRuns {
+		t.Errorf("Unexpected outcome: %+v", single)
+	}
+
+	for config, want := range map[*types.BenchmarkConfig]string{
+		{APIVersion: "62"}:          "invalid API version",
+		{Aggregate: "mode"}:         "mode",
+		{QueryPlan: true}:           "QueryPlan requires TrackDB",
+		{Runs: 2, MinSuccessful: 3}: "MinSuccessful 3 exceeds Runs 2",
+		{Raw: "some"}:               "unknown raw mode",
+	} {
+		opts.Config = *config
+		if _, err := Run(context.Background(), opts, spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() with %+v: expected an error containing %q, got %v", *config, want, err)
+		}
+	}
+}
+
+func TestValidateAPIVersion(t *testing.T) {
+	for version, valid := range map[string]bool{"": true, "62.0": true, "62": false, "v62.0": false} {
+		if err := ValidateAPIVersion(version); (err == nil) != valid {
+			t.Errorf("ValidateAPIVersion(%q) error = %v, want valid %v", version, err, valid)
+		}
+	}
+}
+
+func TestOptionError(t *testing.T) {
+	err := ValidateMinSuccessful(types.BenchmarkConfig{Runs: 2, MinSuccessful: 3})
+	optionErr, ok := err.(*OptionError)
+	if !ok {
+		t.Fatalf("Expected an OptionError, got %T", err)
+	}
+	if got := optionErr.Message(strings.ToLower); got != "minsuccessful 3 exceeds runs 2" {
+		t.Errorf("Message() = %q", got)
+	}
+
+	c := Comparison{RunErr: context.DeadlineExceeded, Benchmarks: 2}
+	err = c.Err(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "use KeepGoing to run the rest") {
+		t.Errorf("Expected the run error wrapped with a hint, got %v", err)
+	}
+}
+
+func TestValidateMinSuccessful(t *testing.T) {
+	tests := []struct {
+		config  types.BenchmarkConfig
+		wantErr bool
+	}{
+		{types.BenchmarkConfig{Runs: 5}, false},
+		{types.BenchmarkConfig{Runs: 5, MinSuccessful: 3}, false},
+		{types.BenchmarkConfig{Runs: 5, MinSuccessful: 5}, false},
+		{types.BenchmarkConfig{Runs: 5, MinSuccessful: 6}, true},
+		{types.BenchmarkConfig{Runs: 5, MinSuccessful: -1}, true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateMinSuccessful(tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateMinSuccessful(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
@@ -2,63 +2,266 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
-// ParseResult extracts the benchmark result from sf apex run output
+// ErrTruncatedResult is returned when a BENCH_RESULT marker is found but its
+// JSON was cut off, typically because the debug log hit its size limit
+var ErrTruncatedResult = errors.New("BENCH_RESULT JSON is truncated in the debug log; " +
+	"increase the debug log size or reduce other System.debug output in the benchmark code")
+
+// logEventPattern matches the timestamp prefix that starts a new debug log
+// event, e.g. "13:45:23.123 (123456)|". Lines without it continue the
+// previous event.
+var logEventPattern = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(?:\.\d+)? \(\d+\)\|`)
+
+// userDebugPrefix matches the "[line]|LEVEL|" part of a USER_DEBUG event that
+// precedes the logged message
+var userDebugPrefix = regexp.MustCompile(`^\[\d+\]\|\w+\|`)
+
+// truncationMarkers appear in debug logs where Salesforce dropped content
+var truncationMarkers = []string{
+	"*** Skipped ",
+	"MAXIMUM DEBUG LOG SIZE REACHED",
+}
+
+// ParseResult extracts the benchmark result from sf apex run output. When
+// the output holds several results, the first one is returned.
 func ParseResult(debugOutput string) (types.Result, error) {
+	results, err := ParseAllResults(debugOutput)
+	if err != nil {
+		return types.Result{}, err
+	}
+	return results[0], nil
+}
+
+// ParseAllResults extracts every BENCH_RESULT in the output, in the order
+// they were logged
+func ParseAllResults(debugOutput string) ([]types.Result, error) {
 	// Look for the BENCH_RESULT marker in the output
 	// The generated Apex code outputs: System.debug('BENCH_RESULT:' + resultJson);
 	// sf apex run output includes this as: USER_DEBUG|...|BENCH_RESULT:{json}
 
-	// Find all occurrences of BENCH_RESULT: and try to parse JSON from each
-	marker := "BENCH_RESULT:"
+	// Find all occurrences of BENCH_RESULT: and try to parse JSON from each.
+	// Results too long for one debug message are logged as numbered
+	// BENCH_RESULT_PART messages and joined before parsing.
+	var results []types.Result
+	var parts resultParts
+	truncated := false
 	searchPos := 0
 
 	for {
-		markerIdx := strings.Index(debugOutput[searchPos:], marker)
+		markerIdx := strings.Index(debugOutput[searchPos:], "BENCH_RESULT")
 		if markerIdx == -1 {
 			break
 		}
 
 		markerIdx += searchPos
-		jsonStart := markerIdx + len(marker)
-		remaining := debugOutput[jsonStart:]
-
-		// Find matching brace using a brace counter for robust parsing
-		braceCount := 0
-		jsonEnd := -1
-		for i, ch := range remaining {
-			if ch == '{' {
-				braceCount++
-			} else if ch == '}' {
-				braceCount--
-				if braceCount == 0 {
-					jsonEnd = i + 1
-					break
-				}
+		rest := debugOutput[markerIdx:]
+		// Move to next occurrence
+		searchPos = markerIdx + len("BENCH_RESULT")
+
+		var text string
+		switch {
+		case strings.HasPrefix(rest, resultMarker):
+			text = rest[len(resultMarker):]
+		case strings.HasPrefix(rest, partMarker):
+			joined, done := parts.add(rest[len(partMarker):])
+			if !done {
+				continue
 			}
+			text = joined
+		default:
+			continue
 		}
 
-		if jsonEnd != -1 {
-			jsonStr := remaining[:jsonEnd]
+		result, err := parseResultAt(text)
+		switch {
+		case err == nil:
+			results = append(results, result)
+		case errors.Is(err, ErrTruncatedResult):
+			truncated = true
+		}
+	}
+	if parts.lost || parts.total > 0 {
+		truncated = true
+	}
 
-			// Try to parse JSON
-			var result types.Result
-			if err := json.Unmarshal([]byte(jsonStr), &result); err == nil {
-				// Successfully parsed!
-				return result, nil
-			}
+	// A truncated result means a benchmark's numbers are missing, even if
+	// others in the same log parsed
+	if truncated || (len(results) == 0 && isTruncatedLog(debugOutput)) {
+		return nil, ErrTruncatedResult
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("could not find valid BENCH_RESULT JSON in output.\n\nOutput:\n%s", debugOutput)
+	}
+
+	// All results in a log share the transaction's limit usage
+	if usage := ParseLimitUsage(debugOutput); usage != nil {
+		for i := range results {
+			results[i].Transaction = usage
+		}
+	}
+
+	// Custom metrics belong to the result they were logged before
+	for i, metrics := range ExtractCustomMetrics(debugOutput) {
+		if i < len(results) && metrics != nil {
+			results[i].CustomMetrics = metrics
 		}
+	}
 
-		// Move to next occurrence
-		searchPos = markerIdx + len(marker)
+	return results, nil
+}
+
+// Markers of a whole result, of one part of a result logged in parts, of
+// a custom metric logged by user code and of the start and end of warmup
+const (
+	resultMarker = "BENCH_RESULT:"
+	partMarker   = "BENCH_RESULT_PART "
+	metricMarker = "BENCH_METRIC:"
+	warmupMarker = "BENCH_WARMUP:"
+)
+
+// partHeaderPattern matches the "n/total:" header of a BENCH_RESULT_PART
+var partHeaderPattern = regexp.MustCompile(`^(\d+)/(\d+):`)
+
+// resultParts joins the BENCH_RESULT_PART messages of a result, which are
+// logged one after another
+type resultParts struct {
+	next, total int  // Part expected next and the part count; total is 0 between results
+	lost        bool // A result missed a part or was left unfinished
+	json        strings.Builder
+}
+
+// add appends the part at s, which follows a BENCH_RESULT_PART marker as
+// "n/total:chunk". After the last part it returns the joined parts followed
+// by the rest of s, for parseResultAt to read the final chunk like any
+// result, wrapped lines included.
+func (p *resultParts) add(s string) (string, bool) {
+	m := partHeaderPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	n, _ := strconv.Atoi(m[1])
+	total, _ := strconv.Atoi(m[2])
+
+	if n == 1 {
+		// A first part starts a new result, abandoning an unfinished one
+		p.lost = p.lost || p.total > 0
+		p.next, p.total = 1, total
+		p.json.Reset()
+	}
+	if n != p.next || total != p.total {
+		p.lost = p.lost || p.total > 0
+		p.total = 0
+		return "", false
 	}
+	s = s[len(m[0]):]
+	if n == total {
+		p.total = 0
+		return p.json.String() + s, true
+	}
+	chunk, ok := partText(s)
+	if !ok {
+		p.lost = true
+		p.total = 0
+		return "", false
+	}
+	p.json.WriteString(chunk)
+	p.next++
+	return "", false
+}
 
-	return types.Result{}, fmt.Errorf("could not find valid BENCH_RESULT JSON in output.\n\nOutput:\n%s", debugOutput)
+// partText returns the chunk of a part that is not the last: the rest of
+// its line plus any wrapped continuation lines. It reports false when the
+// log was truncated within the part.
+func partText(s string) (string, bool) {
+	lines := strings.Split(s, "\n")
+	text := strings.TrimRight(lines[0], "\r")
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if isTruncatedLog(line) {
+			return "", false
+		}
+		if logEventPattern.MatchString(line) || strings.Contains(line, "BENCH_RESULT") {
+			break
+		}
+		text += line
+	}
+	return text, true
+}
+
+// parseResultAt parses the JSON object at the start of s, which directly
+// follows a BENCH_RESULT marker. Salesforce may wrap long debug messages
+// onto following lines, so while the object is incomplete, continuation
+// lines are appended until the next log event starts. A streaming decoder
+// stops at the end of the object and, unlike brace counting, handles braces
+// inside quoted names.
+func parseResultAt(s string) (types.Result, error) {
+	if !strings.HasPrefix(s, "{") {
+		return types.Result{}, fmt.Errorf("BENCH_RESULT is not followed by a JSON object")
+	}
+
+	lines := strings.Split(s, "\n")
+	text := strings.TrimRight(lines[0], "\r")
+	for next := 1; ; next++ {
+		var result types.Result
+		err := json.NewDecoder(strings.NewReader(text)).Decode(&result)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return types.Result{}, err
+		}
+
+		// The object is incomplete; try the next wrapped line
+		if next >= len(lines) {
+			return types.Result{}, ErrTruncatedResult
+		}
+		line := strings.TrimRight(lines[next], "\r")
+		if logEventPattern.MatchString(line) || isTruncatedLog(line) {
+			return types.Result{}, ErrTruncatedResult
+		}
+		text += line
+	}
+}
+
+// isTruncatedLog reports whether the log contains a Salesforce truncation
+// marker
+func isTruncatedLog(log string) bool {
+	for _, m := range truncationMarkers {
+		if strings.Contains(log, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseResultsByName extracts every BENCH_RESULT in the output, keyed by
+// benchmark name. It is used when several benchmarks run in one script.
+func ParseResultsByName(debugOutput string) (map[string]types.Result, error) {
+	all, err := ParseAllResults(debugOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]types.Result, len(all))
+	for _, result := range all {
+		if _, exists := results[result.Name]; exists {
+			return nil, fmt.Errorf("duplicate BENCH_RESULT for benchmark %q", result.Name)
+		}
+		results[result.Name] = result
+	}
+
+	return results, nil
 }
 
 // ParseMultipleResults parses results from multiple executions
@@ -88,6 +291,7 @@ func ExtractDebugLines(output string) []string {
 	lines := strings.Split(output, "\n")
 
 	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
 		// sf apex run typically prefixes debug lines with timestamps and log levels
 		// Look for lines that contain USER_DEBUG or similar
 		if strings.Contains(line, "USER_DEBUG") || strings.Contains(line, "BENCH_RESULT") {
@@ -97,3 +301,194 @@ func ExtractDebugLines(output string) []string {
 
 	return debugLines
 }
+
+// ExtractUserDebug returns the messages logged with System.debug by user
+// code, leaving out BENCH_RESULT and BENCH_WARMUP markers and BENCH_METRIC
+// messages.
+// Messages are grouped by the BENCH_RESULT that follows them, so when
+// several benchmarks share a script group i holds what benchmark i logged.
+// Messages after the last marker form a final group of their own.
+func ExtractUserDebug(output string) [][]string {
+	return debugMessageGroups(output, func(message string) bool {
+		return !strings.HasPrefix(message, metricMarker) && !strings.HasPrefix(message, warmupMarker)
+	})
+}
+
+// ExtractCustomMetrics returns the values of the BENCH_METRIC:name=value
+// messages logged by user code, grouped like ExtractUserDebug. Values of a
+// name logged several times, e.g. once per iteration, are summed; messages
+// that are not a name and a number are ignored. Like CPU and wall time,
+// metrics logged by warmup iterations are left out.
+func ExtractCustomMetrics(output string) []map[string]float64 {
+	groups := debugMessageGroups(output, func(message string) bool {
+		return strings.HasPrefix(message, metricMarker) || strings.HasPrefix(message, warmupMarker)
+	})
+
+	metrics := make([]map[string]float64, len(groups))
+	for i, group := range groups {
+		warmup := false
+		for _, message := range group {
+			if marker, ok := strings.CutPrefix(message, warmupMarker); ok {
+				warmup = marker == "start"
+				continue
+			}
+			if warmup {
+				continue
+			}
+			name, value, ok := strings.Cut(strings.TrimPrefix(message, metricMarker), "=")
+			name = strings.TrimSpace(name)
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if !ok || name == "" || err != nil {
+				continue
+			}
+			if metrics[i] == nil {
+				metrics[i] = make(map[string]float64)
+			}
+			metrics[i][name] += v
+		}
+	}
+	return metrics
+}
+
+// debugMessageGroups returns the USER_DEBUG messages for which keep is
+// true, grouped by the BENCH_RESULT that follows them
+func debugMessageGroups(output string, keep func(message string) bool) [][]string {
+	var groups [][]string
+	var current []string
+	inMessage := false
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		idx := strings.Index(line, "USER_DEBUG|")
+		if idx == -1 {
+			// Lines without an event prefix continue a multi-line message
+			if inMessage && !logEventPattern.MatchString(line) {
+				current[len(current)-1] += "\n" + line
+			} else {
+				inMessage = false
+			}
+			continue
+		}
+
+		message := line[idx+len("USER_DEBUG|"):]
+		message = userDebugPrefix.ReplaceAllString(message, "")
+		if strings.HasPrefix(message, resultMarker) || isLastPart(message) {
+			groups = append(groups, current)
+			current = nil
+			inMessage = false
+			continue
+		}
+		if strings.HasPrefix(message, partMarker) || !keep(message) {
+			inMessage = false
+			continue
+		}
+
+		current = append(current, message)
+		inMessage = true
+	}
+
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	return groups
+}
+
+// isLastPart reports whether message is the final BENCH_RESULT_PART of a
+// result
+func isLastPart(message string) bool {
+	m := partHeaderPattern.FindStringSubmatch(strings.TrimPrefix(message, partMarker))
+	return strings.HasPrefix(message, partMarker) && m != nil && m[1] == m[2]
+}
+
+// limitUsagePattern matches one "Name: used out of limit" line of a
+// CUMULATIVE_LIMIT_USAGE section
+var limitUsagePattern = regexp.MustCompile(`^\s*([A-Za-z ]+?):\s*(\d+)\s+out of\s+\d+`)
+
+// ParseLimitUsage extracts the transaction's governor limit usage from the
+// CUMULATIVE_LIMIT_USAGE section of a debug log. The default namespace is
+// preferred when several namespaces are listed. It returns nil when the log
+// has no such section.
+func ParseLimitUsage(output string) *types.LimitUsage {
+	start := strings.Index(output, "|CUMULATIVE_LIMIT_USAGE")
+	if start == -1 {
+		return nil
+	}
+	section := output[start+len("|CUMULATIVE_LIMIT_USAGE"):]
+	if end := strings.Index(section, "|CUMULATIVE_LIMIT_USAGE_END"); end != -1 {
+		section = section[:end]
+	}
+
+	var usage *types.LimitUsage
+	collecting := false
+	for _, line := range strings.Split(section, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if idx := strings.Index(line, "LIMIT_USAGE_FOR_NS|"); idx != -1 {
+			ns := line[idx+len("LIMIT_USAGE_FOR_NS|"):]
+			isDefault := strings.HasPrefix(ns, "(default)")
+			// Keep the first namespace unless the default one follows
+			if usage != nil && !isDefault {
+				collecting = false
+				continue
+			}
+			usage = &types.LimitUsage{}
+			collecting = true
+			continue
+		}
+		if usage == nil || !collecting {
+			continue
+		}
+
+		match := limitUsagePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		switch match[1] {
+		case "Maximum CPU time":
+			usage.CpuTimeMs = value
+		case "Maximum heap size":
+			usage.HeapBytes = value
+		case "Number of SOQL queries":
+			usage.SoqlQueries = value
+		case "Number of query rows":
+			usage.QueryRows = value
+		case "Number of DML statements":
+			usage.DmlStatements = value
+		case "Number of DML rows":
+			usage.DmlRows = value
+		}
+	}
+
+	return usage
+}
+
+// CheckLimitUsage cross-checks a result's self-reported numbers against the
+// transaction totals and describes any inconsistencies. The measured part of
+// a transaction can never use more than the whole transaction.
+func CheckLimitUsage(result types.Result) []string {
+	usage := result.Transaction
+	if usage == nil {
+		return nil
+	}
+
+	var problems []string
+
+	// Per-iteration averages are rounded, so allow a millisecond of slack
+	measuredCpu := result.AvgCpuMs * float64(result.Iterations)
+	if measuredCpu > float64(usage.CpuTimeMs)+1 {
+		problems = append(problems, fmt.Sprintf("measured CPU time %.1f ms exceeds transaction CPU time %d ms", measuredCpu, usage.CpuTimeMs))
+	}
+	if result.SoqlQueries != nil && *result.SoqlQueries > usage.SoqlQueries {
+		problems = append(problems, fmt.Sprintf("measured SOQL queries %d exceed transaction SOQL queries %d", *result.SoqlQueries, usage.SoqlQueries))
+	}
+	if result.DmlStatements != nil && *result.DmlStatements > usage.DmlStatements {
+		problems = append(problems, fmt.Sprintf("measured DML statements %d exceed transaction DML statements %d", *result.DmlStatements, usage.DmlStatements))
+	}
+
+	return problems
+}
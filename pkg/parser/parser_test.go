@@ -1,8 +1,12 @@
 package parser
 
 import (
+	"errors"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
 func TestParseResult_ValidJSON(t *testing.T) {
@@ -103,6 +107,151 @@ func TestParseResult_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestParseAllResults(t *testing.T) {
+	output := `USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"B","iterations":10,"avgWallMs":1.0,"avgCpuMs":0.9,"minWallMs":0.8,"maxWallMs":1.2,"minCpuMs":0.8,"maxCpuMs":1.0}
+USER_DEBUG|[2]|DEBUG|BENCH_RESULT:not json
+USER_DEBUG|[3]|DEBUG|BENCH_RESULT:{"name":"A","iterations":20,"avgWallMs":2.0,"avgCpuMs":1.9,"minWallMs":1.8,"maxWallMs":2.2,"minCpuMs":1.8,"maxCpuMs":2.0}
+USER_DEBUG|[4]|DEBUG|BENCH_RESULT:{"name":"B","iterations":30,"avgWallMs":3.0,"avgCpuMs":2.9,"minWallMs":2.8,"maxWallMs":3.2,"minCpuMs":2.8,"maxCpuMs":3.0}`
+
+	results, err := ParseAllResults(output)
+	if err != nil {
+		t.Fatalf("ParseAllResults failed: %v", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	// Results keep log order and duplicates are preserved
+	wantIterations := []int{10, 20, 30}
+	for i, result := range results {
+		if result.Iterations != wantIterations[i] {
+			t.Errorf("Result %d: expected %d iterations, got %d", i, wantIterations[i], result.Iterations)
+		}
+	}
+	if results[0].Name != "B" || results[1].Name != "A" || results[2].Name != "B" {
+		t.Errorf("Unexpected result order: %q, %q, %q", results[0].Name, results[1].Name, results[2].Name)
+	}
+}
+
+func TestParseAllResults_NoMarker(t *testing.T) {
+	_, err := ParseAllResults("USER_DEBUG|nothing here")
+	if err == nil || !strings.Contains(err.Error(), "could not find valid BENCH_RESULT") {
+		t.Errorf("Expected missing result error, got: %v", err)
+	}
+}
+
+func TestParseResultsByName(t *testing.T) {
+	output := `USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"First","iterations":10,"avgWallMs":1.0,"avgCpuMs":0.9,"minWallMs":0.8,"maxWallMs":1.2,"minCpuMs":0.8,"maxCpuMs":1.0}
+USER_DEBUG|[2]|DEBUG|other output
+USER_DEBUG|[3]|DEBUG|BENCH_RESULT:{"name":"Second {x}","iterations":20,"avgWallMs":2.0,"avgCpuMs":1.9,"minWallMs":1.8,"maxWallMs":2.2,"minCpuMs":1.8,"maxCpuMs":2.0}`
+
+	results, err := ParseResultsByName(output)
+	if err != nil {
+		t.Fatalf("ParseResultsByName failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results["First"].Iterations != 10 {
+		t.Errorf("Expected First to have 10 iterations, got %d", results["First"].Iterations)
+	}
+	if results["Second {x}"].Iterations != 20 {
+		t.Errorf("Expected Second {x} to have 20 iterations, got %d", results["Second {x}"].Iterations)
+	}
+}
+
+func TestParseResultsByName_Duplicate(t *testing.T) {
+	output := `BENCH_RESULT:{"name":"Same","iterations":10,"avgWallMs":1.0,"avgCpuMs":0.9,"minWallMs":0.8,"maxWallMs":1.2,"minCpuMs":0.8,"maxCpuMs":1.0}
+BENCH_RESULT:{"name":"Same","iterations":10,"avgWallMs":1.0,"avgCpuMs":0.9,"minWallMs":0.8,"maxWallMs":1.2,"minCpuMs":0.8,"maxCpuMs":1.0}`
+
+	_, err := ParseResultsByName(output)
+	if err == nil || !strings.Contains(err.Error(), "duplicate BENCH_RESULT") {
+		t.Errorf("Expected duplicate error, got: %v", err)
+	}
+}
+
+func TestParseResultsByName_NoMarker(t *testing.T) {
+	_, err := ParseResultsByName("USER_DEBUG|nothing here")
+	if err == nil || !strings.Contains(err.Error(), "could not find valid BENCH_RESULT") {
+		t.Errorf("Expected missing result error, got: %v", err)
+	}
+}
+
+func TestParseResult_WrappedDebugLine(t *testing.T) {
+	output := `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Wrapped","iterations":100,"avgWallMs":1.
+5,"avgCpuMs":1.2,"minWallMs":1.0,"maxWallMs":2.0,
+"minCpuMs":1.0,"maxCpuMs":1.5}
+13:45:23.456 (456789)|CUMULATIVE_LIMIT_USAGE`
+
+	result, err := ParseResult(output)
+	if err != nil {
+		t.Fatalf("ParseResult failed: %v", err)
+	}
+
+	if result.Name != "Wrapped" {
+		t.Errorf("Expected name 'Wrapped', got %q", result.Name)
+	}
+	if result.AvgWallMs != 1.5 {
+		t.Errorf("Expected avgWallMs 1.5, got %f", result.AvgWallMs)
+	}
+	if result.MaxCpuMs != 1.5 {
+		t.Errorf("Expected maxCpuMs 1.5, got %f", result.MaxCpuMs)
+	}
+}
+
+func TestParseResult_Truncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{
+			name: "cut off before next event",
+			output: `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Cut","iterations":100,"avgWa
+13:45:23.456 (456789)|CUMULATIVE_LIMIT_USAGE`,
+		},
+		{
+			name:   "cut off at end of log",
+			output: `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Cut","iterations":100`,
+		},
+		{
+			name: "skipped bytes marker",
+			output: `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Cut",
+*** Skipped 123456 bytes of detailed log
+13:45:23.456 (456789)|CUMULATIVE_LIMIT_USAGE`,
+		},
+		{
+			name: "marker lost entirely",
+			output: `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|noise
+*** Skipped 123456 bytes of detailed log
+13:45:23.456 (456789)|MAXIMUM DEBUG LOG SIZE REACHED`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseResult(tt.output)
+			if !errors.Is(err, ErrTruncatedResult) {
+				t.Fatalf("Expected ErrTruncatedResult, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), "increase the debug log size") {
+				t.Errorf("Expected actionable message, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseAllResults_OneTruncated(t *testing.T) {
+	output := `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Whole","iterations":10,"avgWallMs":1.0,"avgCpuMs":0.9,"minWallMs":0.8,"maxWallMs":1.2,"minCpuMs":0.8,"maxCpuMs":1.0}
+13:45:23.124 (123457)|USER_DEBUG|[2]|DEBUG|BENCH_RESULT:{"name":"Cut","iterations":10,"avg`
+
+	_, err := ParseAllResults(output)
+	if !errors.Is(err, ErrTruncatedResult) {
+		t.Errorf("Expected ErrTruncatedResult, got: %v", err)
+	}
+}
+
 func TestParseMultipleResults_Valid(t *testing.T) {
 	outputs := []string{
 		`USER_DEBUG|BENCH_RESULT:{"name":"Test1","iterations":10,"avgWallMs":1.0,"avgCpuMs":0.9,"minWallMs":0.8,"maxWallMs":1.2,"minCpuMs":0.8,"maxCpuMs":1.0}`,
@@ -186,3 +335,235 @@ func TestExtractDebugLines_Empty(t *testing.T) {
 		t.Errorf("Expected 0 debug lines, got %d", len(debugLines))
 	}
 }
+
+func TestExtractUserDebug(t *testing.T) {
+	output := `Execute Anonymous: System.debug('x');
+13:45:23.100 (100)|USER_DEBUG|[3]|DEBUG|first
+13:45:23.101 (101)|USER_DEBUG|[4]|DEBUG|multi
+line
+13:45:23.102 (102)|USER_DEBUG|[40]|DEBUG|BENCH_RESULT:{"name":"A"}
+13:45:23.103 (103)|USER_DEBUG|[5]|DEBUG|second benchmark
+13:45:23.104 (104)|USER_DEBUG|[80]|DEBUG|BENCH_RESULT:{"name":"B"}
+13:45:23.105 (105)|CUMULATIVE_LIMIT_USAGE`
+
+	groups := ExtractUserDebug(output)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d: %q", len(groups), groups)
+	}
+
+	if len(groups[0]) != 2 || groups[0][0] != "first" || groups[0][1] != "multi\nline" {
+		t.Errorf("Unexpected first group: %q", groups[0])
+	}
+	if len(groups[1]) != 1 || groups[1][0] != "second benchmark" {
+		t.Errorf("Unexpected second group: %q", groups[1])
+	}
+}
+
+func TestExtractUserDebug_TrailingMessages(t *testing.T) {
+	output := `13:45:23.100 (100)|USER_DEBUG|[40]|DEBUG|BENCH_RESULT:{"name":"A"}
+13:45:23.101 (101)|USER_DEBUG|[3]|DEBUG|after`
+
+	groups := ExtractUserDebug(output)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d: %q", len(groups), groups)
+	}
+	if len(groups[0]) != 0 {
+		t.Errorf("Expected empty first group, got %q", groups[0])
+	}
+	if len(groups[1]) != 1 || groups[1][0] != "after" {
+		t.Errorf("Unexpected trailing group: %q", groups[1])
+	}
+}
+
+const limitUsageLog = `13:45:23.456 (456789)|CUMULATIVE_LIMIT_USAGE
+13:45:23.456 (456789)|LIMIT_USAGE_FOR_NS|pkg|
+  Number of SOQL queries: 9 out of 100
+  Maximum CPU time: 99 out of 10000
+13:45:23.456 (456789)|LIMIT_USAGE_FOR_NS|(default)|
+  Number of SOQL queries: 3 out of 100
+  Number of query rows: 42 out of 50000
+  Number of DML statements: 2 out of 150
+  Number of DML rows: 7 out of 10000
+  Maximum CPU time: 250 out of 10000
+  Maximum heap size: 12345 out of 6000000
+13:45:23.456 (456789)|CUMULATIVE_LIMIT_USAGE_END`
+
+func TestParseLimitUsage(t *testing.T) {
+	usage := ParseLimitUsage(limitUsageLog)
+	if usage == nil {
+		t.Fatal("Expected limit usage to be parsed")
+	}
+
+	// The default namespace wins over the first listed one
+	want := types.LimitUsage{CpuTimeMs: 250, HeapBytes: 12345, SoqlQueries: 3, QueryRows: 42, DmlStatements: 2, DmlRows: 7}
+	if *usage != want {
+		t.Errorf("Expected %+v, got %+v", want, *usage)
+	}
+}
+
+func TestParseLimitUsage_Missing(t *testing.T) {
+	if usage := ParseLimitUsage("USER_DEBUG|nothing"); usage != nil {
+		t.Errorf("Expected nil usage, got %+v", *usage)
+	}
+}
+
+func TestParseResult_AttachesTransaction(t *testing.T) {
+	output := `13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"T","iterations":100,"avgWallMs":1.5,"avgCpuMs":1.2,"minWallMs":1.0,"maxWallMs":2.0,"minCpuMs":1.0,"maxCpuMs":1.5}
+` + limitUsageLog
+
+	result, err := ParseResult(output)
+	if err != nil {
+		t.Fatalf("ParseResult failed: %v", err)
+	}
+	if result.Transaction == nil || result.Transaction.CpuTimeMs != 250 {
+		t.Errorf("Expected transaction CPU 250, got %+v", result.Transaction)
+	}
+	if problems := CheckLimitUsage(result); len(problems) != 0 {
+		t.Errorf("Expected consistent result, got %q", problems)
+	}
+}
+
+func TestCheckLimitUsage(t *testing.T) {
+	soql := 5
+	result := types.Result{
+		Iterations:  100,
+		AvgCpuMs:    3,
+		SoqlQueries: &soql,
+		Transaction: &types.LimitUsage{CpuTimeMs: 250, SoqlQueries: 3},
+	}
+
+	problems := CheckLimitUsage(result)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %q", problems)
+	}
+	if !strings.Contains(problems[0], "CPU time 300.0 ms exceeds transaction CPU time 250 ms") {
+		t.Errorf("Unexpected CPU problem: %s", problems[0])
+	}
+	if !strings.Contains(problems[1], "SOQL queries 5 exceed") {
+		t.Errorf("Unexpected SOQL problem: %s", problems[1])
+	}
+
+	if problems := CheckLimitUsage(types.Result{AvgCpuMs: 1000, Iterations: 10}); problems != nil {
+		t.Errorf("Expected no problems without transaction usage, got %q", problems)
+	}
+}
+
+func TestParseAllResults_Parts(t *testing.T) {
+	output := `13:45:23.100 (100)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Short","iterations":10,"avgCpuMs":1}
+13:45:23.101 (101)|USER_DEBUG|[2]|DEBUG|before
+13:45:23.102 (102)|USER_DEBUG|[90]|DEBUG|BENCH_RESULT_PART 1/3:{"name":"Long","itera
+13:45:23.103 (103)|USER_DEBUG|[90]|DEBUG|BENCH_RESULT_PART 2/3:tions":20,"avgCp
+13:45:23.104 (104)|USER_DEBUG|[90]|DEBUG|BENCH_RESULT_PART 3/3:uMs":2.5}
+13:45:23.105 (105)|CUMULATIVE_LIMIT_USAGE`
+
+	results, err := ParseAllResults(output)
+	if err != nil {
+		t.Fatalf("ParseAllResults() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Name != "Short" || results[1].Name != "Long" {
+		t.Fatalf("Expected Short then Long, got %+v", results)
+	}
+	if results[1].Iterations != 20 || results[1].AvgCpuMs != 2.5 {
+		t.Errorf("Expected the joined parts to parse, got %+v", results[1])
+	}
+
+	groups := ExtractUserDebug(output)
+	if len(groups) != 2 || len(groups[1]) != 1 || groups[1][0] != "before" {
+		t.Errorf("Expected parts to be left out of user debug, got %q", groups)
+	}
+}
+
+func TestParseAllResults_MissingPart(t *testing.T) {
+	tests := map[string]string{
+		"missing middle": `13:45:23.102 (102)|USER_DEBUG|[90]|DEBUG|BENCH_RESULT_PART 1/3:{"name":"Long","itera
+13:45:23.104 (104)|USER_DEBUG|[90]|DEBUG|BENCH_RESULT_PART 3/3:uMs":2.5}`,
+		"unfinished": `13:45:23.102 (102)|USER_DEBUG|[90]|DEBUG|BENCH_RESULT_PART 1/2:{"name":"Long","itera
+*** Skipped 1200 bytes of detailed log`,
+	}
+	for name, output := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseAllResults(output); !errors.Is(err, ErrTruncatedResult) {
+				t.Errorf("Expected ErrTruncatedResult, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseAllResults_CustomMetrics(t *testing.T) {
+	output := `13:45:23.100 (100)|USER_DEBUG|[3]|DEBUG|BENCH_METRIC:recordsProcessed=200
+13:45:23.101 (101)|USER_DEBUG|[3]|DEBUG|BENCH_METRIC:recordsProcessed=300
+13:45:23.102 (102)|USER_DEBUG|[4]|DEBUG|BENCH_METRIC:batches = 2.5
+13:45:23.103 (103)|USER_DEBUG|[5]|DEBUG|BENCH_METRIC:broken
+13:45:23.104 (104)|USER_DEBUG|[6]|DEBUG|note
+13:45:23.105 (105)|USER_DEBUG|[40]|DEBUG|BENCH_RESULT:{"name":"A","iterations":10,"avgCpuMs":1}
+13:45:23.106 (106)|USER_DEBUG|[80]|DEBUG|BENCH_RESULT:{"name":"B","iterations":10,"avgCpuMs":1}`
+
+	results, err := ParseAllResults(output)
+	if err != nil {
+		t.Fatalf("ParseAllResults() error = %v", err)
+	}
+	want := map[string]float64{"recordsProcessed": 500, "batches": 2.5}
+	if !reflect.DeepEqual(results[0].CustomMetrics, want) {
+		t.Errorf("Expected summed metrics %v, got %v", want, results[0].CustomMetrics)
+	}
+	if results[1].CustomMetrics != nil {
+		t.Errorf("Expected no metrics for B, got %v", results[1].CustomMetrics)
+	}
+
+	groups := ExtractUserDebug(output)
+	if len(groups) != 2 || len(groups[0]) != 1 || groups[0][0] != "note" {
+		t.Errorf("Expected metrics left out of user debug, got %q", groups)
+	}
+}
+
+func TestParseAllResults_CustomMetricsWarmup(t *testing.T) {
+	output := `13:45:23.100 (100)|USER_DEBUG|[3]|DEBUG|BENCH_METRIC:rows=1
+13:45:23.101 (101)|USER_DEBUG|[60]|DEBUG|BENCH_WARMUP:start
+13:45:23.102 (102)|USER_DEBUG|[5]|DEBUG|BENCH_METRIC:rows=10
+13:45:23.103 (103)|USER_DEBUG|[5]|DEBUG|BENCH_METRIC:rows=10
+13:45:23.104 (104)|USER_DEBUG|[65]|DEBUG|BENCH_WARMUP:end
+13:45:23.105 (105)|USER_DEBUG|[5]|DEBUG|BENCH_METRIC:rows=10
+13:45:23.106 (106)|USER_DEBUG|[40]|DEBUG|BENCH_RESULT:{"name":"A","iterations":1,"avgCpuMs":1}`
+
+	results, err := ParseAllResults(output)
+	if err != nil {
+		t.Fatalf("ParseAllResults() error = %v", err)
+	}
+	if got := results[0].CustomMetrics["rows"]; got != 11 {
+		t.Errorf("Expected setup and measured metrics without warmup, got %v", got)
+	}
+	if groups := ExtractUserDebug(output); len(groups) != 1 || len(groups[0]) != 0 {
+		t.Errorf("Expected warmup markers left out of user debug, got %q", groups)
+	}
+}
+
+// Logs saved or relayed on Windows end their lines with \r\n
+func TestParse_CRLF(t *testing.T) {
+	crlf := func(s string) string { return strings.ReplaceAll(s, "\n", "\r\n") }
+	output := crlf(`13:45:23.100 (100)|USER_DEBUG|[3]|DEBUG|multi
+line
+13:45:23.123 (123456)|USER_DEBUG|[1]|DEBUG|BENCH_RESULT:{"name":"Wrapped","iterations":100,"avgWallMs":1.
+5,"avgCpuMs":1.2,"minWallMs":1.0,"maxWallMs":2.0,"minCpuMs":1.0,"maxCpuMs":1.5}
+` + limitUsageLog)
+
+	result, err := ParseResult(output)
+	if err != nil {
+		t.Fatalf("ParseResult failed: %v", err)
+	}
+	if result.Name != "Wrapped" || result.AvgWallMs != 1.5 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.Transaction == nil || result.Transaction.CpuTimeMs != 250 {
+		t.Errorf("Expected the transaction's limit usage, got %+v", result.Transaction)
+	}
+
+	groups := ExtractUserDebug(output)
+	if len(groups) != 1 || len(groups[0]) != 1 || groups[0][0] != "multi\nline" {
+		t.Errorf("Unexpected debug groups: %q", groups)
+	}
+	for _, line := range ExtractDebugLines(output) {
+		if strings.HasSuffix(line, "\r") {
+			t.Errorf("Expected debug lines without \\r, got %q", line)
+		}
+	}
+}
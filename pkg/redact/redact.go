@@ -0,0 +1,104 @@
+// Package redact masks secrets, such as access tokens passed to benchmarks
+// through variables, in text before it is logged or written to disk. A
+// Redactor matches configured regular expressions and literal secret values.
+package redact
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces every secret
+const Mask = "[REDACTED]"
+
+// minSecretLength is the length below which values of secret-looking
+// variables are not masked, so short values such as "1" or "true" do not
+// blank out unrelated text
+const minSecretLength = 6
+
+// secretNamePattern matches variable names that suggest secret values, by
+// their underscore-separated words
+var secretNamePattern = regexp.MustCompile(`(?i)(^|_)(token|secret|password|passwd|credentials?|api_?key|private_?key|access_?key|auth_?url|session_?id)(_|$)`)
+
+// Redactor masks secrets in text. A nil Redactor masks nothing.
+type Redactor struct {
+	re *regexp.Regexp
+}
+
+// New creates a Redactor masking matches of the regular expressions in
+// patterns and occurrences of the literal secrets. It returns nil when
+// there is nothing to mask.
+func New(patterns, secrets []string) (*Redactor, error) {
+	var alternatives []string
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		alternatives = append(alternatives, "(?:"+pattern+")")
+	}
+	// Longer secrets first, so one containing another is masked whole
+	secrets = append([]string(nil), secrets...)
+	sort.SliceStable(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		if secret != "" {
+			alternatives = append(alternatives, regexp.QuoteMeta(secret))
+		}
+	}
+	if len(alternatives) == 0 {
+		return nil, nil
+	}
+	return &Redactor{re: regexp.MustCompile(strings.Join(alternatives, "|"))}, nil
+}
+
+// String returns s with every secret masked
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.re.ReplaceAllLiteralString(s, Mask)
+}
+
+// Strings masks secrets in every element of values, in place
+func (r *Redactor) Strings(values []string) {
+	for i, s := range values {
+		values[i] = r.String(s)
+	}
+}
+
+// Writer returns a writer masking secrets in what is written to w. Each
+// write is masked on its own, so a secret split across writes is missed;
+// formatted messages are written whole.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SecretValues returns the values among vars whose names suggest secrets,
+// such as API_TOKEN or DB_PASSWORD, leaving out values too short to mask
+func SecretValues(vars map[string]string) []string {
+	var secrets []string
+	for name, value := range vars {
+		if len(value) >= minSecretLength && secretNamePattern.MatchString(name) {
+			secrets = append(secrets, value)
+		}
+	}
+	sort.Strings(secrets)
+	return secrets
+}
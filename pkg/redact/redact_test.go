@@ -0,0 +1,85 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := New([]string{`Bearer [A-Za-z0-9._-]+`, `00D[0-9A-Za-z]{12,15}![^\s"]+`}, []string{"hunter22", "hunter22-extended"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Authorization: Bearer abc.def-1", "Authorization: " + Mask},
+		{`{"sid": "00D5g000004ABCD!AQ4AQFakeSession"}`, `{"sid": "` + Mask + `"}`},
+		{"password is hunter22-extended, not hunter22", "password is " + Mask + ", not " + Mask},
+		{"nothing secret", "nothing secret"},
+	}
+	for _, tt := range tests {
+		if got := r.String(tt.in); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	values := []string{"a hunter22", "b"}
+	r.Strings(values)
+	if values[0] != "a "+Mask || values[1] != "b" {
+		t.Errorf("Strings() = %v", values)
+	}
+}
+
+func TestNew_Empty(t *testing.T) {
+	r, err := New(nil, []string{""})
+	if err != nil || r != nil {
+		t.Fatalf("New() = %v, %v; want nil, nil", r, err)
+	}
+	if got := r.String("hunter22"); got != "hunter22" {
+		t.Errorf("nil Redactor changed the text: %q", got)
+	}
+	var buf bytes.Buffer
+	if w := r.Writer(&buf); w != &buf {
+		t.Error("Expected a nil Redactor to return the writer unchanged")
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New([]string{"("}, nil); err == nil || !strings.Contains(err.Error(), "invalid redaction pattern") {
+		t.Errorf("Expected invalid pattern error, got %v", err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	r, _ := New(nil, []string{"s3cr3t-value"})
+	var buf bytes.Buffer
+	w := r.Writer(&buf)
+	n, err := w.Write([]byte("Warning: login with s3cr3t-value failed\n"))
+	if err != nil || n != len("Warning: login with s3cr3t-value failed\n") {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if buf.String() != "Warning: login with "+Mask+" failed\n" {
+		t.Errorf("Wrote %q", buf.String())
+	}
+}
+
+func TestSecretValues(t *testing.T) {
+	vars := map[string]string{
+		"API_TOKEN":         "tok-123456",
+		"DB_PASSWORD":       "correct horse",
+		"SFDX_AUTH_URL":     "force://PlatformCLI::5Aep861@example.my.salesforce.com",
+		"SHORT_SECRET":      "abc",
+		"MAX_OUTPUT_TOKENS": "200000",
+		"ACCOUNT_ID":        "001000000000001",
+		"TOKENIZER":         "whitespace",
+	}
+	got := SecretValues(vars)
+	want := []string{"correct horse", "force://PlatformCLI::5Aep861@example.my.salesforce.com", "tok-123456"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("SecretValues() = %v, want %v", got, want)
+	}
+}
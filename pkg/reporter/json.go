@@ -5,8 +5,53 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// RawMode selects how much per-run data JSON output keeps under raw, which
+// for large suites makes up most of the report
+type RawMode string
+
+const (
+	RawFull    RawMode = "full"    // Every run
+	RawSummary RawMode = "summary" // Only the number of runs, as rawCount
+	RawNone    RawMode = "none"    // Nothing
 )
 
+// ParseRawMode parses a raw mode; empty selects RawFull
+func ParseRawMode(name string) (RawMode, error) {
+	switch mode := RawMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return RawFull, nil
+	case RawFull, RawSummary, RawNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown raw mode %q (expected full, summary or none)", name)
+}
+
+// TrimRaw returns copies of results keeping the per-run data mode selects
+func TrimRaw(results []types.AggregatedResult, mode RawMode) []types.AggregatedResult {
+	trimmed := make([]types.AggregatedResult, len(results))
+	for i, result := range results {
+		trimmed[i] = TrimRawResult(result, mode)
+	}
+	return trimmed
+}
+
+// TrimRawResult is TrimRaw for a single result
+func TrimRawResult(result types.AggregatedResult, mode RawMode) types.AggregatedResult {
+	switch mode {
+	case RawSummary:
+		result.RawCount = len(result.RawResults)
+		result.RawResults = nil
+	case RawNone:
+		result.RawResults = nil
+	}
+	return result
+}
+
 // PrintJSON outputs the result as formatted JSON
 func PrintJSON(result interface{}, writer io.Writer) error {
 	if writer == nil {
@@ -0,0 +1,81 @@
+package reporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metrics selects the metric groups shown in table output. Heap and DB
+// groups only appear for results that tracked them.
+type Metrics struct {
+	CPU  bool
+	Wall bool
+	Heap bool
+	DB   bool
+
+	// RelativeTo is the metric comparisons are ranked by: "cpu", "wall" or
+	// "heap". Empty ranks by CPU time, or by wall time when only wall time
+	// is shown.
+	RelativeTo string
+
+	// Baseline names the result multipliers are computed against, e.g. the
+	// current implementation in a refactoring. Empty uses the best result.
+	Baseline string
+
+	// PerUnits, when positive, ranks CPU and wall time per unit of work and
+	// shows them for this many units, e.g. 1000 for ms per 1000 records.
+	// Results need their units set.
+	PerUnits float64
+
+	// ShowRuns adds a table of each result's runs below the main table, to
+	// spot a single run inflating the spread
+	ShowRuns bool
+
+	// NoiseThreshold is the deviation from the median run, as a fraction,
+	// above which runs are highlighted; 0 selects stats.DefaultNoiseThreshold
+	NoiseThreshold float64
+}
+
+// DefaultMetrics shows CPU time plus any tracked heap and DB metrics
+var DefaultMetrics = Metrics{CPU: true, Heap: true, DB: true}
+
+// ParseMetrics parses a comma-separated list of metric groups such as
+// "cpu,wall". An empty list selects DefaultMetrics.
+func ParseMetrics(list string) (Metrics, error) {
+	if strings.TrimSpace(list) == "" {
+		return DefaultMetrics, nil
+	}
+
+	var metrics Metrics
+	for _, name := range strings.Split(list, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "cpu":
+			metrics.CPU = true
+		case "wall":
+			metrics.Wall = true
+		case "heap":
+			metrics.Heap = true
+		case "db":
+			metrics.DB = true
+		case "":
+		default:
+			return Metrics{}, fmt.Errorf("unknown metric %q (expected cpu, wall, heap or db)", strings.TrimSpace(name))
+		}
+	}
+
+	if metrics == (Metrics{}) {
+		return Metrics{}, fmt.Errorf("no metrics selected")
+	}
+
+	return metrics, nil
+}
+
+// ParseRelativeTo parses the metric a comparison is ranked by. An empty
+// name keeps the default ranking.
+func ParseRelativeTo(name string) (string, error) {
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case "", "cpu", "wall", "heap":
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown relative metric %q (expected cpu, wall or heap)", name)
+}
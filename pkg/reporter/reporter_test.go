@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/fatih/color"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
@@ -100,8 +101,8 @@ func TestPrintTable(t *testing.T) {
 		"1.100 ms",
 		"1.400 ms",
 		"0.123 ms",
-		"NAME",        // Headers are uppercased
-		"AVG CPU",     // Headers are uppercased
+		"NAME",    // Headers are uppercased
+		"AVG CPU", // Headers are uppercased
 	}
 
 	for _, expected := range expectedStrings {
@@ -391,3 +392,719 @@ func TestPrintComparison_MultipleResults(t *testing.T) {
 		t.Error("Should identify Test1 as fastest")
 	}
 }
+
+func TestPrintTable_TransactionCpu(t *testing.T) {
+	result := types.AggregatedResult{
+		Name:             "TestBench",
+		AvgCpuMs:         1.0,
+		TransactionCpuMs: 180,
+		UnmeasuredCpuMs:  55,
+	}
+
+	var buf bytes.Buffer
+	if err := PrintTable(result, &buf); err != nil {
+		t.Fatalf("PrintTable failed: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "Transaction CPU: 180.0 ms (55.0 ms outside measured iterations)") {
+		t.Errorf("Expected transaction CPU line, got: %s", buf.String())
+	}
+}
+
+func TestPrintComparison_ConfidenceInterval(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "A", Runs: 5, AvgCpuMs: 1.23, CI95CpuMs: 0.08},
+		{Name: "B", Runs: 1, AvgCpuMs: 2.5},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "1.230 ms ± 0.080") {
+		t.Errorf("Expected confidence interval in output, got: %s", output)
+	}
+	if strings.Contains(output, "2.500 ms ±") {
+		t.Errorf("Expected no interval for a single run, got: %s", output)
+	}
+}
+
+func TestPrintComparison_NoisyWarning(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Steady", Runs: 5, AvgCpuMs: 1.0, CVCpu: 0.05},
+		{Name: "Jumpy", Runs: 5, AvgCpuMs: 2.0, CVCpu: 0.35, Noisy: true},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "Jumpy ⚠ noisy") {
+		t.Errorf("Expected noisy marker in table, got: %s", output)
+	}
+	if !strings.Contains(output, "Warning: Jumpy is noisy (CPU varies 35% between runs)") {
+		t.Errorf("Expected noisy warning, got: %s", output)
+	}
+	if strings.Contains(output, "Steady ⚠") || strings.Contains(output, "Steady is noisy") {
+		t.Errorf("Expected steady result not to be flagged, got: %s", output)
+	}
+}
+
+func TestPrintComparison_WaitBound(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Compute", Runs: 3, AvgCpuMs: 10.0, AvgWallMs: 12.0, WallCpuRatio: 1.2},
+		{Name: "Query", Runs: 3, AvgCpuMs: 4.0, AvgWallMs: 20.0, WallCpuRatio: 5.0, WaitBound: true},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparisonWithMetrics(results, &buf, Metrics{CPU: true, Wall: true}); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{"WALL / CPU", "1.2x", "5.0x wait", "Note: Query is wait-bound (wall time 5.0x CPU time)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+	if strings.Contains(output, "Compute is wait-bound") {
+		t.Errorf("Expected Compute not to be flagged, got: %s", output)
+	}
+
+	// The column needs both times, the note either
+	buf.Reset()
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "WALL / CPU") || !strings.Contains(buf.String(), "Query is wait-bound") {
+		t.Errorf("Expected only the note with default metrics, got: %s", buf.String())
+	}
+}
+
+func TestPrintComparison_ShowRuns(t *testing.T) {
+	heap := 12.0
+	results := []types.AggregatedResult{
+		{Name: "Steady", Runs: 3, AvgCpuMs: 1.0, RawResults: []types.Result{
+			{AvgCpuMs: 1.0, AvgWallMs: 1.5, AvgHeapKb: &heap},
+			{AvgCpuMs: 1.0, AvgWallMs: 1.4, AvgHeapKb: &heap},
+			{AvgCpuMs: 2.0, AvgWallMs: 2.6, AvgHeapKb: &heap},
+		}},
+		{Name: "Failed", Error: "boom"},
+	}
+
+	var buf bytes.Buffer
+	metrics := DefaultMetrics
+	if err := PrintComparisonWithMetrics(results, &buf, metrics); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "Runs:") {
+		t.Errorf("Expected no runs table without ShowRuns, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	metrics.ShowRuns = true
+	if err := PrintComparisonWithMetrics(results, &buf, metrics); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{"Runs:", "CPU VS MEDIAN", "AVG HEAP", "12.00 KB", "2.000 ms", "+0%", "+100%"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+	if strings.Contains(output, "-0%") || strings.Contains(output, "AVG WALL") {
+		t.Errorf("Expected no negative zero and no wall column, got: %s", output)
+	}
+}
+
+func TestPrintRuns_NoiseThreshold(t *testing.T) {
+	oldNoColor := color.NoColor
+	defer func() { color.NoColor = oldNoColor }()
+	color.NoColor = false
+
+	results := []types.AggregatedResult{{Name: "Drifting", Runs: 3, AvgCpuMs: 1.0, RawResults: []types.Result{
+		{AvgCpuMs: 1.0}, {AvgCpuMs: 1.0}, {AvgCpuMs: 1.3},
+	}}}
+	highlighted := "\x1b[33m+30%"
+
+	var buf bytes.Buffer
+	if err := printRuns(results, &buf, Metrics{CPU: true}); err != nil {
+		t.Fatalf("printRuns failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), highlighted) {
+		t.Errorf("Expected +30%% highlighted at the default threshold, got: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := printRuns(results, &buf, Metrics{CPU: true, NoiseThreshold: 0.5}); err != nil {
+		t.Fatalf("printRuns failed: %v", err)
+	}
+	if strings.Contains(buf.String(), highlighted) || !strings.Contains(buf.String(), "+30%") {
+		t.Errorf("Expected +30%% plain under a 50%% threshold, got: %q", buf.String())
+	}
+}
+
+func TestPrintTable_HeapAndDB(t *testing.T) {
+	avgHeap, minHeap, maxHeap := 15.0, 8.0, 30.0
+	soql, dml := 4.5, 2.0
+	result := types.AggregatedResult{
+		Name:             "Tracked",
+		AvgHeapKb:        &avgHeap,
+		MinHeapKb:        &minHeap,
+		MaxHeapKb:        &maxHeap,
+		AvgSoqlQueries:   &soql,
+		AvgDmlStatements: &dml,
+	}
+
+	var buf bytes.Buffer
+	if err := PrintTable(result, &buf); err != nil {
+		t.Fatalf("PrintTable failed: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"AVG HEAP", "15.00 KB", "8.00 KB", "30.00 KB", "SOQL", "4.5", "DML"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestPrintComparison_HeapColumnOnlyWhenTracked(t *testing.T) {
+	heap := 12.0
+	results := []types.AggregatedResult{
+		{Name: "A", AvgCpuMs: 1.0, AvgHeapKb: &heap},
+		{Name: "B", AvgCpuMs: 2.0},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "AVG HEAP") || !strings.Contains(output, "12.00 KB") {
+		t.Errorf("Expected heap column, got: %s", output)
+	}
+	if strings.Contains(output, "SOQL") || strings.Contains(output, "DML") {
+		t.Errorf("Expected no DB columns without DB tracking, got: %s", output)
+	}
+
+	buf.Reset()
+	results[0].AvgHeapKb = nil
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "AVG HEAP") {
+		t.Errorf("Expected no heap column without heap tracking, got: %s", buf.String())
+	}
+}
+
+func TestPrintComparison_RelativeTrackedMetrics(t *testing.T) {
+	heapA, heapB := 10.0, 15.0
+	soqlA, soqlB := 2.0, 1.0
+	dmlA, dmlB := 0.0, 3.0
+	results := []types.AggregatedResult{
+		{Name: "A", AvgCpuMs: 1.0, AvgHeapKb: &heapA, AvgSoqlQueries: &soqlA, AvgDmlStatements: &dmlA},
+		{Name: "B", AvgCpuMs: 2.0, AvgHeapKb: &heapB, AvgSoqlQueries: &soqlB, AvgDmlStatements: &dmlB},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"10.00 KB (1.00x)", "15.00 KB (1.50x)", "2 (2.00x)", "1 (1.00x)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+	// No ratio against a zero baseline
+	if strings.Contains(output, "3 (") {
+		t.Errorf("Expected no DML multiplier against zero, got: %s", output)
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Metrics
+		wantErr bool
+	}{
+		{"", DefaultMetrics, false},
+		{"cpu", Metrics{CPU: true}, false},
+		{"cpu, Wall,heap,db", Metrics{CPU: true, Wall: true, Heap: true, DB: true}, false},
+		{"wall,", Metrics{Wall: true}, false},
+		{"gpu", Metrics{}, true},
+		{",", Metrics{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMetrics(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMetrics(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMetrics(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestPrintTableWithMetrics_Wall(t *testing.T) {
+	result := types.AggregatedResult{
+		Name:         "TestBench",
+		AvgCpuMs:     1.0,
+		AvgWallMs:    2.5,
+		MinWallMs:    2.0,
+		MaxWallMs:    3.0,
+		StdDevWallMs: 0.4,
+	}
+
+	var buf bytes.Buffer
+	if err := PrintTableWithMetrics(result, &buf, Metrics{CPU: true, Wall: true}); err != nil {
+		t.Fatalf("PrintTableWithMetrics failed: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"AVG CPU", "CPU STD DEV", "AVG WALL", "WALL STD DEV", "2.500 ms", "3.000 ms"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestPrintComparisonWithMetrics_WallOnly(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "LowCpu", AvgCpuMs: 1.0, AvgWallMs: 10.0},
+		{Name: "LowWall", AvgCpuMs: 2.0, AvgWallMs: 5.0},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparisonWithMetrics(results, &buf, Metrics{Wall: true}); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "AVG CPU") {
+		t.Errorf("Expected no CPU columns, got: %s", output)
+	}
+	if !strings.Contains(output, "AVG WALL") {
+		t.Errorf("Expected wall columns, got: %s", output)
+	}
+	// Ranking follows wall time when it is the only time metric
+	if !strings.Contains(output, "Fastest: LowWall") {
+		t.Errorf("Expected LowWall to be fastest, got: %s", output)
+	}
+}
+
+func TestPrintComparison_Colors(t *testing.T) {
+	oldNoColor := color.NoColor
+	defer func() { color.NoColor = oldNoColor }()
+
+	results := []types.AggregatedResult{
+		{Name: "Fast", AvgCpuMs: 1.0},
+		{Name: "Slow", AvgCpuMs: 2.0},
+		{Name: "Jumpy", AvgCpuMs: 1.05, Noisy: true, CVCpu: 0.4},
+	}
+
+	color.NoColor = false
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "\x1b[32;1m1.00x ⭐") {
+		t.Errorf("Expected fastest in green, got: %q", output)
+	}
+	if !strings.Contains(output, "\x1b[31m2.00x") {
+		t.Errorf("Expected slower result in red, got: %q", output)
+	}
+	if !strings.Contains(output, "\x1b[33mJumpy ⚠ noisy") {
+		t.Errorf("Expected noisy result in yellow, got: %q", output)
+	}
+
+	color.NoColor = true
+	buf.Reset()
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("Expected plain output with colors disabled, got: %q", buf.String())
+	}
+}
+
+func TestPrintComparison_Failures(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Slow", AvgCpuMs: 2.0},
+		{Name: "Broken", Error: "execution failed for Broken: compile error"},
+		{Name: "Fast", AvgCpuMs: 1.0},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "Fastest: Fast") {
+		t.Errorf("Expected failed result to be left out of the ranking, got: %s", output)
+	}
+	if !strings.Contains(output, "Failed: Broken: execution failed for Broken: compile error") {
+		t.Errorf("Expected failure to be listed, got: %s", output)
+	}
+
+	// Only failures: no table, just the list
+	buf.Reset()
+	if err := PrintComparison(results[1:2], &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "Fastest") || !strings.Contains(buf.String(), "Failed: Broken") {
+		t.Errorf("Expected only the failure, got: %s", buf.String())
+	}
+}
+
+func TestPrintTable_HeapPeak(t *testing.T) {
+	peak, pct := 512.0, 8.5
+	result := types.AggregatedResult{Name: "Test", AvgCpuMs: 1, PeakHeapKb: &peak, PeakHeapPct: &pct}
+
+	var buf bytes.Buffer
+	if err := PrintTable(result, &buf); err != nil {
+		t.Fatalf("PrintTable failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "PEAK HEAP") || !strings.Contains(buf.String(), "512.00 KB (8.5%)") {
+		t.Errorf("Expected peak heap column, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := PrintComparison([]types.AggregatedResult{result, {Name: "Other", AvgCpuMs: 2}}, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "512.00 KB (8.5%)") {
+		t.Errorf("Expected peak heap column in comparison, got: %s", buf.String())
+	}
+}
+
+func TestPrintComparison_AsyncColumnsOnlyWhenUsed(t *testing.T) {
+	zero, one := 0.0, 1.0
+	results := []types.AggregatedResult{
+		{Name: "Handler", AvgCpuMs: 1, AvgSoqlQueries: &one, AvgFutureCalls: &zero, AvgQueueableJobs: &one},
+		{Name: "Inline", AvgCpuMs: 2, AvgSoqlQueries: &one, AvgFutureCalls: &zero, AvgQueueableJobs: &zero},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "QUEUEABLE") {
+		t.Errorf("Expected queueable column, got: %s", output)
+	}
+	if strings.Contains(output, "FUTURE") || strings.Contains(output, "AGGREGATE") {
+		t.Errorf("Expected unused async columns to be hidden, got: %s", output)
+	}
+}
+
+func TestPrintTable_QueryPlans(t *testing.T) {
+	result := types.AggregatedResult{
+		Name:     "Lookup",
+		AvgCpuMs: 1,
+		QueryPlans: []types.QueryPlan{
+			{Query: "SELECT Id FROM Account WHERE Name = 'Acme'", LeadingOperation: "Index", SobjectType: "Account", RelativeCost: 0.05, Cardinality: 12, SobjectCardinality: 1200},
+			{Query: "SELECT Id FROM Account", LeadingOperation: "TableScan", SobjectType: "Account", RelativeCost: 1.6, Cardinality: 1200, SobjectCardinality: 1200, Notes: []string{"Not considering filter for optimization because unindexed"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintTable(result, &buf); err != nil {
+		t.Fatalf("PrintTable failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"Lookup: SELECT Id FROM Account WHERE Name = 'Acme'",
+		"Index on Account, cost 0.05, ~12 of 1200 rows",
+		"TableScan on Account, cost 1.60, ~1200 of 1200 rows (not selective)",
+		"Note: Not considering filter",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+
+	buf.Reset()
+	if err := PrintTableWithMetrics(result, &buf, Metrics{CPU: true}); err != nil {
+		t.Fatalf("PrintTableWithMetrics failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "Query plans") {
+		t.Errorf("Expected plans to follow the db metric group, got: %s", buf.String())
+	}
+}
+
+func TestPrintScaling(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Query (10 rows)", Rows: 10, AvgCpuMs: 0.5, AvgWallMs: 0.6},
+		{Name: "Query (100 rows)", Rows: 100, AvgCpuMs: 5, AvgWallMs: 6},
+		{Name: "Query (1000 rows)", Rows: 1000, Error: "Too many DML rows: 10001"},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintScaling(results, &buf); err != nil {
+		t.Fatalf("PrintScaling failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"50.000 ms", // CPU per 1k rows
+		"100 │" + strings.Repeat("█", 40) + " 5.000 ms", // Longest bar
+		"roughly linear (exponent 1.00)",
+		"Failed: Query (1000 rows): Too many DML rows",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestPrintTable_CacheColumns(t *testing.T) {
+	keys, used := 10.0, 0.25
+	result := types.AggregatedResult{Name: "Cached", AvgCpuMs: 1, AvgCacheKeys: &keys, AvgCacheCapacityPct: &used}
+
+	var buf bytes.Buffer
+	if err := PrintTable(result, &buf); err != nil {
+		t.Fatalf("PrintTable failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "CACHE KEYS") || !strings.Contains(buf.String(), "+0.25%") {
+		t.Errorf("Expected cache columns, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := PrintComparison([]types.AggregatedResult{result, {Name: "Plain", AvgCpuMs: 2}}, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "CACHE USED") || !strings.Contains(buf.String(), "+0.25%") {
+		t.Errorf("Expected cache columns in comparison, got: %s", buf.String())
+	}
+}
+
+func TestPrintComparisonWithMetrics_RelativeTo(t *testing.T) {
+	heapA, heapB := 200.0, 50.0
+	results := []types.AggregatedResult{
+		{Name: "LowCpu", AvgCpuMs: 1.0, AvgWallMs: 10.0, AvgHeapKb: &heapA},
+		{Name: "LowWall", AvgCpuMs: 2.0, AvgWallMs: 5.0, AvgHeapKb: &heapB},
+	}
+
+	tests := []struct {
+		relativeTo string
+		want       []string
+	}{
+		{"", []string{"Fastest: LowCpu", "2.00x"}},
+		{"wall", []string{"RELATIVE WALL", "Fastest: LowWall", "2.00x"}},
+		{"heap", []string{"RELATIVE HEAP", "Least heap: LowWall", "4.00x"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		metrics := Metrics{CPU: true, Heap: true, RelativeTo: tt.relativeTo}
+		if err := PrintComparisonWithMetrics(results, &buf, metrics); err != nil {
+			t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("RelativeTo %q: expected output to contain %q, got: %s", tt.relativeTo, want, buf.String())
+			}
+		}
+	}
+}
+
+func TestParseRelativeTo(t *testing.T) {
+	for input, want := range map[string]string{"": "", "cpu": "cpu", " Wall": "wall", "HEAP": "heap"} {
+		if got, err := ParseRelativeTo(input); err != nil || got != want {
+			t.Errorf("ParseRelativeTo(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseRelativeTo("db"); err == nil {
+		t.Error("Expected an error for an unknown metric")
+	}
+}
+
+func TestPrintComparisonWithMetrics_Baseline(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Refactored", AvgCpuMs: 1.35},
+		{Name: "Current", AvgCpuMs: 1.0},
+		{Name: "Cached", AvgCpuMs: 0.5},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparisonWithMetrics(results, &buf, Metrics{CPU: true, Baseline: "Current"}); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{"RELATIVE VS CURRENT", "1.35x (+35%)", "1.00x baseline", "0.50x (-50%)", "Fastest: Cached"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+
+	// A baseline without a result falls back to the fastest
+	buf.Reset()
+	if err := PrintComparisonWithMetrics(results[:1], &buf, Metrics{CPU: true, Baseline: "Current"}); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "baseline Current has no result") {
+		t.Errorf("Expected a missing baseline warning, got: %s", buf.String())
+	}
+}
+
+func TestPrintComparison_Thresholds(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Fast", AvgCpuMs: 1.5, Thresholds: []types.ThresholdCheck{{Metric: "maxCpuMs", Limit: 2, Value: 1.5, Tracked: true, Pass: true}}},
+		{Name: "Slow", AvgCpuMs: 3.25, Thresholds: []types.ThresholdCheck{
+			{Metric: "maxCpuMs", Limit: 2, Value: 3.25, Tracked: true},
+			{Metric: "maxHeapKb", Limit: 100},
+			{Metric: "maxSoql", Limit: -1, Value: 0, Tracked: true},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{"Budgets:", "PASS Fast: maxCpuMs 1.5 <= 2", "FAIL Slow: maxCpuMs 3.25 > 2", "FAIL Slow: maxHeapKb not tracked", "FAIL Slow: maxSoql 0 > -1"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestPrintComparison_Phases(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Seeded", AvgCpuMs: 0.5, Phases: &types.PhaseTimings{SetupCpuMs: 60, WarmupCpuMs: 5, MeasureCpuMs: 30, TeardownCpuMs: 5}},
+		{Name: "Plain", AvgCpuMs: 1, Phases: &types.PhaseTimings{MeasureCpuMs: 100}},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	want := "Seeded: setup 60 ms (60%), warmup 5 ms (5%), measurement 30 ms (30%), teardown 5 ms (5%) - setup dominates the transaction"
+	if !strings.Contains(output, "Phases (CPU):") || !strings.Contains(output, want) {
+		t.Errorf("Expected phase breakdown %q, got: %s", want, output)
+	}
+	if strings.Contains(output, "Plain: setup") {
+		t.Errorf("Expected no breakdown without setup or teardown, got: %s", output)
+	}
+}
+
+func TestPrintComparison_WarmupWarning(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Cold", AvgCpuMs: 1, WarmupCheck: &types.WarmupCheck{EarlyIterations: 10, EarlyAvgCpuMs: 2, RestAvgCpuMs: 1, Insufficient: true}},
+		{Name: "Warm", AvgCpuMs: 1, WarmupCheck: &types.WarmupCheck{EarlyIterations: 10, EarlyAvgCpuMs: 1, RestAvgCpuMs: 1}},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "Cold's first 10 measured iterations averaged 2.000 ms CPU against 1.000 ms") || !strings.Contains(output, "--warmup") {
+		t.Errorf("Expected a warmup warning for Cold, got: %s", output)
+	}
+	if strings.Contains(output, "Warm's first") {
+		t.Errorf("Expected no warmup warning for Warm, got: %s", output)
+	}
+}
+
+func TestPrintComparison_Batching(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Tiny", AvgCpuMs: 0.01, AutoBatchSize: 16},
+		{Name: "Tinier", AvgCpuMs: 0.001, ZeroBatches: 3},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"Note: Tiny iterations are below the 1 ms clock resolution; timed in batches of up to 16",
+		"Warning: 3 batches of Tinier measured 0 ms CPU",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestPrintComparison_CustomMetrics(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Loader", AvgCpuMs: 2, CustomMetrics: map[string]float64{"recordsProcessed": 1234, "batches": 2.5}},
+		{Name: "Plain", AvgCpuMs: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparison(results, &buf); err != nil {
+		t.Fatalf("PrintComparison failed: %v", err)
+	}
+	output := buf.String()
+	want := "Loader: batches 2.5, recordsProcessed 1234"
+	if !strings.Contains(output, "Custom metrics (mean per run):") || !strings.Contains(output, want) {
+		t.Errorf("Expected output to contain %q, got: %s", want, output)
+	}
+	if strings.Contains(output, "Plain: ") {
+		t.Errorf("Expected no metrics line for Plain, got: %s", output)
+	}
+}
+
+func TestPrintComparison_PerUnit(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "Small", AvgCpuMs: 1, AvgWallMs: 1, Units: 10, CpuMsPerUnit: 0.1, WallMsPerUnit: 0.1},
+		{Name: "Large", AvgCpuMs: 5, AvgWallMs: 5, Units: 100, CpuMsPerUnit: 0.05, WallMsPerUnit: 0.05},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintComparisonWithMetrics(results, &buf, Metrics{CPU: true, PerUnits: 1000}); err != nil {
+		t.Fatalf("PrintComparisonWithMetrics failed: %v", err)
+	}
+	output := buf.String()
+	for _, want := range []string{"1000 UNITS", "RELATIVE PER UNIT", "50.000 ms", "100.000 ms", "Fastest: Large"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestParseRawMode(t *testing.T) {
+	for name, want := range map[string]RawMode{"": RawFull, "full": RawFull, "Summary": RawSummary, "none": RawNone} {
+		got, err := ParseRawMode(name)
+		if err != nil || got != want {
+			t.Errorf("ParseRawMode(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseRawMode("some"); err == nil {
+		t.Error("Expected an error for an unknown raw mode")
+	}
+}
+
+func TestTrimRaw(t *testing.T) {
+	results := []types.AggregatedResult{
+		{Name: "A", Runs: 2, RawResults: []types.Result{{Name: "A"}, {Name: "A"}}},
+	}
+
+	full := TrimRaw(results, RawFull)
+	if len(full[0].RawResults) != 2 || full[0].RawCount != 0 {
+		t.Errorf("Expected full raw results, got %+v", full[0])
+	}
+	summary := TrimRaw(results, RawSummary)
+	if summary[0].RawResults != nil || summary[0].RawCount != 2 {
+		t.Errorf("Expected a raw count only, got %+v", summary[0])
+	}
+	none := TrimRaw(results, RawNone)
+	if none[0].RawResults != nil || none[0].RawCount != 0 {
+		t.Errorf("Expected no raw results, got %+v", none[0])
+	}
+	if len(results[0].RawResults) != 2 {
+		t.Error("Expected TrimRaw to leave its input alone")
+	}
+}
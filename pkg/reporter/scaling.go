@@ -0,0 +1,81 @@
+package reporter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+	"github.com/olekukonko/tablewriter"
+)
+
+// chartWidth is the length of the longest bar in scaling charts
+const chartWidth = 40
+
+// PrintScaling outputs the results of a row-count sweep, ordered by Rows:
+// a table of time at each scale, a bar chart of CPU time against rows and
+// how CPU time grows with the row count. Failed scales are listed below.
+func PrintScaling(results []types.AggregatedResult, writer io.Writer) error {
+	if writer == nil {
+		writer = os.Stdout
+	}
+
+	var failed, succeeded []types.AggregatedResult
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, r)
+		} else {
+			succeeded = append(succeeded, r)
+		}
+	}
+	if len(succeeded) == 0 {
+		printFailures(failed, writer)
+		return fmt.Errorf("no results to display")
+	}
+
+	table := tablewriter.NewWriter(writer)
+	table.Header("Rows", "Avg CPU", "Avg Wall", "CPU per 1k Rows")
+	maxCpu := 0.0
+	for _, r := range succeeded {
+		maxCpu = max(maxCpu, r.AvgCpuMs)
+		row := []string{
+			fmt.Sprintf("%d", r.Rows),
+			formatWithCI(r.AvgCpuMs, r.CI95CpuMs),
+			fmt.Sprintf("%.3f ms", r.AvgWallMs),
+			fmt.Sprintf("%.3f ms", r.AvgCpuMs*1000/float64(max(r.Rows, 1))),
+		}
+		if err := table.Append(row); err != nil {
+			return fmt.Errorf("failed to append row: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("failed to render table: %w", err)
+	}
+
+	// Bar chart of CPU time against rows
+	fmt.Fprintf(writer, "\nCPU time by rows:\n")
+	labelWidth := len(fmt.Sprintf("%d", succeeded[len(succeeded)-1].Rows))
+	for _, r := range succeeded {
+		bar := 0
+		if maxCpu > 0 {
+			bar = int(r.AvgCpuMs / maxCpu * chartWidth)
+		}
+		fmt.Fprintf(writer, "  %*d │%s %.3f ms\n", labelWidth, r.Rows, strings.Repeat("█", max(bar, 1)), r.AvgCpuMs)
+	}
+
+	rows := make([]int, len(succeeded))
+	cpu := make([]float64, len(succeeded))
+	for i, r := range succeeded {
+		rows[i], cpu[i] = r.Rows, r.AvgCpuMs
+	}
+	if k, ok := stats.ScalingExponent(rows, cpu); ok {
+		fmt.Fprintf(writer, "\nScaling: CPU time grows %s with the row count\n", stats.DescribeScaling(k))
+	}
+
+	printNoiseWarnings(succeeded, writer)
+	printIncompleteRuns(succeeded, writer)
+	printFailures(failed, writer)
+	return nil
+}
@@ -0,0 +1,120 @@
+package reporter
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// jsonSchemaDialect is the JSON Schema version of generated schemas
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaTypes are the JSON outputs with a published schema, by name
+var schemaTypes = map[string]reflect.Type{
+	"aggregated-result": reflect.TypeOf(types.AggregatedResult{}),
+	"result":            reflect.TypeOf(types.Result{}),
+}
+
+// SchemaNames lists the outputs JSONSchema accepts
+func SchemaNames() []string {
+	names := make([]string, 0, len(schemaTypes))
+	for name := range schemaTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JSONSchema returns the JSON Schema of the named output, derived from the
+// Go types so it cannot drift from what is written. Fields tagged omitempty
+// are optional; nested structs are described under $defs.
+func JSONSchema(name string) (map[string]interface{}, error) {
+	t, ok := schemaTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q (expected %s)", name, strings.Join(SchemaNames(), " or "))
+	}
+
+	defs := make(map[string]interface{})
+	schema := structSchema(t, defs)
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = t.Name()
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return schema, nil
+}
+
+// PrintSchema outputs the JSON Schema of the named output
+func PrintSchema(name string, writer io.Writer) error {
+	schema, err := JSONSchema(name)
+	if err != nil {
+		return err
+	}
+	return PrintJSON(schema, writer)
+}
+
+// structSchema describes a struct as an object, adding the structs it
+// references to defs
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := typeSchema(field.Type, defs)
+		if name == "schemaVersion" {
+			prop["const"] = types.SchemaVersion
+		}
+		properties[name] = prop
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// typeSchema describes a field type
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // Reserve the name before recursing
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
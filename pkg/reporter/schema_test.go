@@ -0,0 +1,80 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestJSONSchema_AggregatedResult(t *testing.T) {
+	schema, err := JSONSchema("aggregated-result")
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	version := properties["schemaVersion"].(map[string]interface{})
+	if version["const"] != types.SchemaVersion {
+		t.Errorf("Expected schemaVersion const %q, got %v", types.SchemaVersion, version["const"])
+	}
+
+	required := map[string]bool{}
+	for _, name := range schema["required"].([]string) {
+		required[name] = true
+	}
+	if !required["schemaVersion"] || !required["name"] || !required["avgCpuMs"] {
+		t.Errorf("Expected schemaVersion, name and avgCpuMs to be required, got %v", schema["required"])
+	}
+	if required["avgHeapKb"] || required["raw"] {
+		t.Errorf("Expected optional fields not to be required, got %v", schema["required"])
+	}
+
+	raw := properties["raw"].(map[string]interface{})
+	items := raw["items"].(map[string]interface{})
+	if items["$ref"] != "#/$defs/Result" {
+		t.Errorf("Expected raw items to reference Result, got %v", items)
+	}
+	defs := schema["$defs"].(map[string]interface{})
+	if defs["Result"] == nil || defs["LimitUsage"] == nil {
+		t.Errorf("Expected Result and LimitUsage definitions, got %v", defs)
+	}
+}
+
+// Every field written to JSON must be described by the schema
+func TestJSONSchema_CoversOutput(t *testing.T) {
+	heap := 1.5
+	result := types.AggregatedResult{
+		SchemaVersion: types.SchemaVersion,
+		Name:          "Test",
+		AvgHeapKb:     &heap,
+		Noisy:         true,
+		RawResults:    []types.Result{{Name: "Test"}},
+	}
+	var buf bytes.Buffer
+	if err := PrintJSON(result, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var written map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := JSONSchema("aggregated-result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	for key := range written {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("Output field %q is missing from the schema", key)
+		}
+	}
+}
+
+func TestJSONSchema_Unknown(t *testing.T) {
+	if _, err := JSONSchema("report"); err == nil {
+		t.Error("Expected error for unknown schema")
+	}
+}
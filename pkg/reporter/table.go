@@ -3,28 +3,104 @@ package reporter
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/fatih/color"
+	"github.com/ipavlic/apex-benchmark-cli/pkg/stats"
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 	"github.com/olekukonko/tablewriter"
 )
 
-// PrintTable outputs a single result as a formatted table
+// Colors used in tables. The color package disables them when NO_COLOR is
+// set or stdout is not a terminal; set color.NoColor to force plain output.
+var (
+	fastestColor = color.New(color.FgGreen, color.Bold)
+	slowerColor  = color.New(color.FgRed)
+	noisyColor   = color.New(color.FgYellow)
+)
+
+// slowerThreshold is the relative time above which a result is highlighted
+// as slower than the fastest
+const slowerThreshold = 1.10
+
+// PrintTable outputs a single result as a formatted table with the default
+// metric groups
 func PrintTable(result types.AggregatedResult, writer io.Writer) error {
+	return PrintTableWithMetrics(result, writer, DefaultMetrics)
+}
+
+// PrintTableWithMetrics outputs a single result as a formatted table showing
+// the selected metric groups
+func PrintTableWithMetrics(result types.AggregatedResult, writer io.Writer, metrics Metrics) error {
 	if writer == nil {
 		writer = os.Stdout
 	}
 
+	// Std dev columns are qualified once both time metrics are shown
+	cpuStdDev, wallStdDev := "Std Dev", "Std Dev"
+	if metrics.CPU && metrics.Wall {
+		cpuStdDev, wallStdDev = "CPU Std Dev", "Wall Std Dev"
+	}
+
+	header := []any{"Name"}
+	row := []string{displayName(result)}
+	if metrics.CPU {
+		header = append(header, "Avg CPU", "Min CPU", "Max CPU", cpuStdDev)
+		row = append(row,
+			formatWithCI(result.AvgCpuMs, result.CI95CpuMs),
+			fmt.Sprintf("%.3f ms", result.MinCpuMs),
+			fmt.Sprintf("%.3f ms", result.MaxCpuMs),
+			fmt.Sprintf("%.3f ms", result.StdDevCpuMs),
+		)
+	}
+	if metrics.Wall {
+		header = append(header, "Avg Wall", "Min Wall", "Max Wall", wallStdDev)
+		row = append(row,
+			formatWithCI(result.AvgWallMs, result.CI95WallMs),
+			fmt.Sprintf("%.3f ms", result.MinWallMs),
+			fmt.Sprintf("%.3f ms", result.MaxWallMs),
+			fmt.Sprintf("%.3f ms", result.StdDevWallMs),
+		)
+	}
+	if metrics.CPU && metrics.Wall {
+		header = append(header, "Wall/CPU")
+		row = append(row, formatWallCpuRatio(result))
+	}
+	if metrics.Heap && result.AvgHeapKb != nil {
+		header = append(header, "Avg Heap", "Min Heap", "Max Heap")
+		row = append(row, formatKb(result.AvgHeapKb), formatKb(result.MinHeapKb), formatKb(result.MaxHeapKb))
+	}
+	if metrics.Heap && result.PeakHeapKb != nil {
+		header = append(header, "Peak Heap")
+		row = append(row, formatPeakHeap(result))
+	}
+	if metrics.DB && result.AvgSoqlQueries != nil {
+		header = append(header, "SOQL")
+		row = append(row, formatCount(result.AvgSoqlQueries))
+	}
+	if metrics.DB && result.AvgDmlStatements != nil {
+		header = append(header, "DML")
+		row = append(row, formatCount(result.AvgDmlStatements))
+	}
+	for _, c := range asyncColumns {
+		if metrics.DB && nonZero(c.value(result)) {
+			header = append(header, c.header)
+			row = append(row, formatCount(c.value(result)))
+		}
+	}
+	if metrics.DB && result.AvgCacheKeys != nil {
+		header = append(header, "Cache Keys", "Cache Used")
+		row = append(row, formatCount(result.AvgCacheKeys), formatCacheUsed(result.AvgCacheCapacityPct))
+	}
+
 	table := tablewriter.NewWriter(writer)
-	table.Header("Name", "Avg CPU", "Min CPU", "Max CPU", "Std Dev")
-
-	err := table.Append([]string{
-		result.Name,
-		fmt.Sprintf("%.3f ms", result.AvgCpuMs),
-		fmt.Sprintf("%.3f ms", result.MinCpuMs),
-		fmt.Sprintf("%.3f ms", result.MaxCpuMs),
-		fmt.Sprintf("%.3f ms", result.StdDevCpuMs),
-	})
+	table.Header(header...)
+
+	err := table.Append(row)
 	if err != nil {
 		return fmt.Errorf("failed to append row: %w", err)
 	}
@@ -33,11 +109,45 @@ func PrintTable(result types.AggregatedResult, writer io.Writer) error {
 		return fmt.Errorf("failed to render table: %w", err)
 	}
 
+	if metrics.CPU && result.TransactionCpuMs > 0 {
+		fmt.Fprintf(writer, "\nTransaction CPU: %.1f ms (%.1f ms outside measured iterations)\n",
+			result.TransactionCpuMs, result.UnmeasuredCpuMs)
+	}
+
+	if metrics.CPU {
+		printPhases([]types.AggregatedResult{result}, writer)
+	}
+	printCustomMetrics([]types.AggregatedResult{result}, writer)
+	printNoiseWarnings([]types.AggregatedResult{result}, writer)
+	if metrics.CPU || metrics.Wall {
+		printWaitBound([]types.AggregatedResult{result}, writer)
+	}
+	printBatching([]types.AggregatedResult{result}, writer)
+	printIncompleteRuns([]types.AggregatedResult{result}, writer)
+	printThresholds([]types.AggregatedResult{result}, writer)
+	if metrics.DB {
+		printQueryPlans([]types.AggregatedResult{result}, writer)
+	}
+	if metrics.ShowRuns {
+		if err := printRuns([]types.AggregatedResult{result}, writer, metrics); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// PrintComparison outputs multiple results as a comparison table
+// PrintComparison outputs multiple results as a comparison table with the
+// default metric groups
 func PrintComparison(results []types.AggregatedResult, writer io.Writer) error {
+	return PrintComparisonWithMetrics(results, writer, DefaultMetrics)
+}
+
+// PrintComparisonWithMetrics outputs multiple results as a comparison table
+// showing the selected metric groups. Results are ranked by
+// metrics.RelativeTo, by default CPU time, or wall time when only wall time
+// is shown. Failed benchmarks are listed below the table.
+func PrintComparisonWithMetrics(results []types.AggregatedResult, writer io.Writer, metrics Metrics) error {
 	if writer == nil {
 		writer = os.Stdout
 	}
@@ -46,34 +156,197 @@ func PrintComparison(results []types.AggregatedResult, writer io.Writer) error {
 		return fmt.Errorf("no results to display")
 	}
 
-	// Find the fastest (lowest avg CPU time)
+	var failed []types.AggregatedResult
+	succeeded := make([]types.AggregatedResult, 0, len(results))
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, r)
+		} else {
+			succeeded = append(succeeded, r)
+		}
+	}
+	if len(succeeded) > 0 {
+		if err := printRanking(succeeded, writer, metrics); err != nil {
+			return err
+		}
+	}
+	printFailures(failed, writer)
+	return nil
+}
+
+// printRanking outputs the comparison table of successful results
+func printRanking(results []types.AggregatedResult, writer io.Writer, metrics Metrics) error {
+	rankBy, best := rankMetric(metrics)
+
+	// Find the fastest
 	fastestIdx := 0
-	fastestCpu := results[0].AvgCpuMs
+	fastest := rankBy(results[0])
 	for i, r := range results {
-		if r.AvgCpuMs < fastestCpu {
-			fastestCpu = r.AvgCpuMs
+		if rankBy(r) < fastest {
+			fastest = rankBy(r)
 			fastestIdx = i
 		}
 	}
 
+	// Multipliers are relative to the baseline when one is named and
+	// succeeded, otherwise to the fastest
+	baselineIdx := -1
+	for i, r := range results {
+		if metrics.Baseline != "" && r.Name == metrics.Baseline {
+			baselineIdx = i
+		}
+	}
+	reference := fastest
+	if baselineIdx >= 0 {
+		reference = rankBy(results[baselineIdx])
+	}
+
+	// Heap and DB columns appear when selected and any result tracked them
+	var showHeap, showPeak, showSoql, showDml, showCache bool
+	for _, r := range results {
+		showHeap = showHeap || (metrics.Heap && r.AvgHeapKb != nil)
+		showPeak = showPeak || (metrics.Heap && r.PeakHeapKb != nil)
+		showSoql = showSoql || (metrics.DB && r.AvgSoqlQueries != nil)
+		showDml = showDml || (metrics.DB && r.AvgDmlStatements != nil)
+		showCache = showCache || (metrics.DB && r.AvgCacheKeys != nil)
+	}
+
+	// Tracked metrics are shown relative to the baseline or the lowest value
+	bestHeap := lowest(results, func(r types.AggregatedResult) *float64 { return r.AvgHeapKb })
+	bestSoql := lowest(results, func(r types.AggregatedResult) *float64 { return r.AvgSoqlQueries })
+	bestDml := lowest(results, func(r types.AggregatedResult) *float64 { return r.AvgDmlStatements })
+	if baselineIdx >= 0 {
+		baseline := results[baselineIdx]
+		bestHeap, bestSoql, bestDml = baseline.AvgHeapKb, baseline.AvgSoqlQueries, baseline.AvgDmlStatements
+	}
+
+	header := []any{"Name"}
+	if metrics.CPU {
+		header = append(header, "Avg CPU", "Min CPU", "Max CPU")
+	}
+	if metrics.Wall {
+		header = append(header, "Avg Wall", "Min Wall", "Max Wall")
+	}
+	perUnit := metrics.PerUnits > 0 && metrics.RelativeTo != "heap"
+	unitLabel := "unit"
+	if metrics.PerUnits != 1 {
+		unitLabel = fmt.Sprintf("%g units", metrics.PerUnits)
+	}
+	if metrics.CPU && metrics.Wall {
+		header = append(header, "Wall/CPU")
+	}
+	if perUnit && metrics.CPU {
+		header = append(header, "CPU / "+unitLabel)
+	}
+	if perUnit && metrics.Wall {
+		header = append(header, "Wall / "+unitLabel)
+	}
+	relativeHeader := "Relative"
+	if metrics.RelativeTo != "" {
+		relativeHeader += " " + metrics.RelativeTo
+	}
+	if perUnit {
+		relativeHeader += " per unit"
+	}
+	if baselineIdx >= 0 {
+		relativeHeader += " vs " + metrics.Baseline
+	}
+	header = append(header, relativeHeader)
+	if showHeap {
+		header = append(header, "Avg Heap")
+	}
+	if showPeak {
+		header = append(header, "Peak Heap")
+	}
+	if showSoql {
+		header = append(header, "SOQL")
+	}
+	if showDml {
+		header = append(header, "DML")
+	}
+	var showAsync []asyncColumn
+	for _, c := range asyncColumns {
+		for _, r := range results {
+			if metrics.DB && nonZero(c.value(r)) {
+				showAsync = append(showAsync, c)
+				header = append(header, c.header)
+				break
+			}
+		}
+	}
+	if showCache {
+		header = append(header, "Cache Keys", "Cache Used")
+	}
+
 	table := tablewriter.NewWriter(writer)
-	table.Header("Name", "Avg CPU", "Min CPU", "Max CPU", "Relative")
+	table.Header(header...)
 
 	for i, result := range results {
-		relative := result.AvgCpuMs / fastestCpu
+		relative := rankBy(result) / reference
 		relativeStr := fmt.Sprintf("%.2fx", relative)
+		if baselineIdx >= 0 {
+			relativeStr = fmt.Sprintf("%.2fx (%+.0f%%)", relative, (relative-1)*100)
+		}
 
-		if i == fastestIdx {
-			relativeStr = "1.00x ⭐"
+		switch {
+		case i == baselineIdx:
+			relativeStr = "1.00x baseline"
+		case i == fastestIdx && baselineIdx < 0:
+			relativeStr = fastestColor.Sprint("1.00x ⭐")
+		case reference <= 0:
+			// A multiple of nothing has no meaning, e.g. with no heap used
+			relativeStr = "-"
+		case relative > slowerThreshold:
+			relativeStr = slowerColor.Sprint(relativeStr)
+		case relative < 1/slowerThreshold:
+			relativeStr = fastestColor.Sprint(relativeStr)
 		}
 
-		err := table.Append([]string{
-			result.Name,
-			fmt.Sprintf("%.3f ms", result.AvgCpuMs),
-			fmt.Sprintf("%.3f ms", result.MinCpuMs),
-			fmt.Sprintf("%.3f ms", result.MaxCpuMs),
-			relativeStr,
-		})
+		row := []string{displayName(result)}
+		if metrics.CPU {
+			row = append(row,
+				formatWithCI(result.AvgCpuMs, result.CI95CpuMs),
+				fmt.Sprintf("%.3f ms", result.MinCpuMs),
+				fmt.Sprintf("%.3f ms", result.MaxCpuMs),
+			)
+		}
+		if metrics.Wall {
+			row = append(row,
+				formatWithCI(result.AvgWallMs, result.CI95WallMs),
+				fmt.Sprintf("%.3f ms", result.MinWallMs),
+				fmt.Sprintf("%.3f ms", result.MaxWallMs),
+			)
+		}
+		if metrics.CPU && metrics.Wall {
+			row = append(row, formatWallCpuRatio(result))
+		}
+		if perUnit && metrics.CPU {
+			row = append(row, fmt.Sprintf("%.3f ms", result.CpuMsPerUnit*metrics.PerUnits))
+		}
+		if perUnit && metrics.Wall {
+			row = append(row, fmt.Sprintf("%.3f ms", result.WallMsPerUnit*metrics.PerUnits))
+		}
+		row = append(row, relativeStr)
+		if showHeap {
+			row = append(row, formatKb(result.AvgHeapKb)+formatRelative(result.AvgHeapKb, bestHeap))
+		}
+		if showPeak {
+			row = append(row, formatPeakHeap(result))
+		}
+		if showSoql {
+			row = append(row, formatCount(result.AvgSoqlQueries)+formatRelative(result.AvgSoqlQueries, bestSoql))
+		}
+		if showDml {
+			row = append(row, formatCount(result.AvgDmlStatements)+formatRelative(result.AvgDmlStatements, bestDml))
+		}
+		for _, c := range showAsync {
+			row = append(row, formatCount(c.value(result)))
+		}
+		if showCache {
+			row = append(row, formatCount(result.AvgCacheKeys), formatCacheUsed(result.AvgCacheCapacityPct))
+		}
+
+		err := table.Append(row)
 		if err != nil {
 			return fmt.Errorf("failed to append row: %w", err)
 		}
@@ -84,7 +357,397 @@ func PrintComparison(results []types.AggregatedResult, writer io.Writer) error {
 	}
 
 	// Print fastest
-	fmt.Fprintf(writer, "\nFastest: %s\n", results[fastestIdx].Name)
+	fmt.Fprintf(writer, "\n%s: %s\n", best, fastestColor.Sprint(results[fastestIdx].Name))
+	if metrics.Baseline != "" && baselineIdx < 0 {
+		noisyColor.Fprintf(writer, "\nWarning: baseline %s has no result; multipliers are relative to %s\n",
+			metrics.Baseline, results[fastestIdx].Name)
+	}
+
+	if metrics.CPU {
+		printPhases(results, writer)
+	}
+	printCustomMetrics(results, writer)
+	printNoiseWarnings(results, writer)
+	if metrics.CPU || metrics.Wall {
+		printWaitBound(results, writer)
+	}
+	printBatching(results, writer)
+	printIncompleteRuns(results, writer)
+	printThresholds(results, writer)
+	if metrics.DB {
+		printQueryPlans(results, writer)
+	}
+	if metrics.ShowRuns {
+		if err := printRuns(results, writer, metrics); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
+
+// rankMetric returns the value results are ranked by and how the best
+// result is labelled. Results without a tracked heap rank last.
+func rankMetric(metrics Metrics) (func(types.AggregatedResult) float64, string) {
+	relativeTo := metrics.RelativeTo
+	if relativeTo == "" {
+		relativeTo = "cpu"
+		if metrics.Wall && !metrics.CPU {
+			relativeTo = "wall"
+		}
+	}
+
+	value := stats.MetricValue(relativeTo)
+	if metrics.PerUnits > 0 && relativeTo != "heap" {
+		value = func(r types.AggregatedResult) (float64, bool) {
+			if relativeTo == "wall" {
+				return r.WallMsPerUnit, r.Units > 0
+			}
+			return r.CpuMsPerUnit, r.Units > 0
+		}
+	}
+	rankBy := func(r types.AggregatedResult) float64 {
+		if v, ok := value(r); ok {
+			return v
+		}
+		return math.Inf(1)
+	}
+	if relativeTo == "heap" {
+		return rankBy, "Least heap"
+	}
+	return rankBy, "Fastest"
+}
+
+// asyncColumn is a per-run count tracked with --track-db that is shown only
+// when some benchmark used it, since most benchmarks never do
+type asyncColumn struct {
+	header string
+	value  func(types.AggregatedResult) *float64
+}
+
+var asyncColumns = []asyncColumn{
+	{"Aggregate", func(r types.AggregatedResult) *float64 { return r.AvgAggregateQueries }},
+	{"Future", func(r types.AggregatedResult) *float64 { return r.AvgFutureCalls }},
+	{"Queueable", func(r types.AggregatedResult) *float64 { return r.AvgQueueableJobs }},
+}
+
+// nonZero reports whether an optional value is present and not zero
+func nonZero(v *float64) bool {
+	return v != nil && *v != 0
+}
+
+// formatKb formats an optional heap value, "-" when it was not tracked
+func formatKb(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f KB", *v)
+}
+
+// formatPeakHeap formats the heap high-water mark with its share of the
+// heap limit, e.g. "512.00 KB (8.5%)"
+func formatPeakHeap(result types.AggregatedResult) string {
+	if result.PeakHeapPct == nil {
+		return formatKb(result.PeakHeapKb)
+	}
+	return fmt.Sprintf("%s (%.1f%%)", formatKb(result.PeakHeapKb), *result.PeakHeapPct)
+}
+
+// formatCacheUsed formats the change in the share of a cache partition's
+// capacity used
+func formatCacheUsed(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f%%", *v)
+}
+
+// formatCount formats an optional per-run count, "-" when it was not
+// tracked. Averages over runs keep at most one decimal.
+func formatCount(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(math.Round(*v*10)/10, 'f', -1, 64)
+}
+
+// lowest returns the smallest non-nil value of a metric across results
+func lowest(results []types.AggregatedResult, metric func(types.AggregatedResult) *float64) *float64 {
+	var best *float64
+	for _, r := range results {
+		if v := metric(r); v != nil && (best == nil || *v < *best) {
+			best = v
+		}
+	}
+	return best
+}
+
+// formatRelative formats a value as a multiple of the best value, e.g.
+// " (1.50x)". It is empty when either is missing or the best is zero,
+// where a ratio has no meaning.
+func formatRelative(v, best *float64) string {
+	if v == nil || best == nil || *best == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.2fx)", *v / *best)
+}
+
+// displayName returns the name shown in tables, marking noisy results
+func displayName(result types.AggregatedResult) string {
+	if result.Noisy {
+		return noisyColor.Sprint(result.Name + " ⚠ noisy")
+	}
+	return result.Name
+}
+
+// printFailures lists benchmarks that failed under --keep-going
+func printFailures(results []types.AggregatedResult, writer io.Writer) {
+	for _, r := range results {
+		slowerColor.Fprintf(writer, "\nFailed: %s: %s\n", r.Name, r.Error)
+	}
+}
+
+// printNoiseWarnings explains which results are unreliable and how to
+// improve them
+func printNoiseWarnings(results []types.AggregatedResult, writer io.Writer) {
+	for _, r := range results {
+		if r.Noisy {
+			noisyColor.Fprintf(writer, "\nWarning: %s is noisy (CPU varies %.0f%% between runs); "+
+				"increase --runs or --iterations for reliable numbers\n", r.Name, r.CVCpu*100)
+		}
+		if w := r.WarmupCheck; w != nil && w.Insufficient {
+			noisyColor.Fprintf(writer, "\nWarning: %s's first %d measured iterations averaged %.3f ms CPU against %.3f ms "+
+				"for the rest; warmup may be too short, try a higher --warmup\n", r.Name, w.EarlyIterations, w.EarlyAvgCpuMs, w.RestAvgCpuMs)
+		}
+	}
+}
+
+// printRuns lists each run of the results with its averages and how far its
+// CPU time lies from the median run, so a single bad run stands out
+func printRuns(results []types.AggregatedResult, writer io.Writer, metrics Metrics) error {
+	threshold := metrics.NoiseThreshold
+	if threshold <= 0 {
+		threshold = stats.DefaultNoiseThreshold
+	}
+	var showHeap bool
+	for _, r := range results {
+		for _, run := range r.RawResults {
+			showHeap = showHeap || (metrics.Heap && run.AvgHeapKb != nil)
+		}
+	}
+
+	header := []any{"Name", "Run"}
+	if metrics.CPU || !metrics.Wall {
+		header = append(header, "Avg CPU")
+	}
+	if metrics.Wall {
+		header = append(header, "Avg Wall")
+	}
+	if showHeap {
+		header = append(header, "Avg Heap")
+	}
+	header = append(header, "CPU vs Median")
+
+	table := tablewriter.NewWriter(writer)
+	table.Header(header...)
+	rows := 0
+	for _, r := range results {
+		cpus := make([]float64, len(r.RawResults))
+		for i, run := range r.RawResults {
+			cpus[i] = run.AvgCpuMs
+		}
+		median := stats.Median(cpus)
+		for i, run := range r.RawResults {
+			row := []string{r.Name, strconv.Itoa(i + 1)}
+			if metrics.CPU || !metrics.Wall {
+				row = append(row, fmt.Sprintf("%.3f ms", run.AvgCpuMs))
+			}
+			if metrics.Wall {
+				row = append(row, fmt.Sprintf("%.3f ms", run.AvgWallMs))
+			}
+			if showHeap {
+				row = append(row, formatKb(run.AvgHeapKb))
+			}
+			deviation := "-"
+			if median > 0 {
+				pct := math.Round((run.AvgCpuMs/median - 1) * 100)
+				if pct == 0 {
+					pct = 0 // Not -0
+				}
+				deviation = fmt.Sprintf("%+.0f%%", pct)
+				if math.Abs(pct) > threshold*100 {
+					deviation = noisyColor.Sprint(deviation)
+				}
+			}
+			row = append(row, deviation)
+			if err := table.Append(row); err != nil {
+				return fmt.Errorf("failed to append row: %w", err)
+			}
+			rows++
+		}
+	}
+	if rows == 0 {
+		return nil
+	}
+	fmt.Fprintf(writer, "\nRuns:\n")
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("failed to render table: %w", err)
+	}
+	return nil
+}
+
+// formatWallCpuRatio formats the ratio of wall to CPU time, marking
+// wait-bound results
+func formatWallCpuRatio(result types.AggregatedResult) string {
+	if result.WallCpuRatio <= 0 {
+		return "-"
+	}
+	ratio := fmt.Sprintf("%.1fx", result.WallCpuRatio)
+	if result.WaitBound {
+		return noisyColor.Sprint(ratio + " wait")
+	}
+	return ratio
+}
+
+// printWaitBound points wait-bound results at the time they spend outside
+// Apex, which CPU optimizations do not reduce
+func printWaitBound(results []types.AggregatedResult, writer io.Writer) {
+	for _, r := range results {
+		if r.WaitBound {
+			fmt.Fprintf(writer, "\nNote: %s is wait-bound (wall time %.1fx CPU time); most of its time goes to the database, "+
+				"callouts or waiting, so cutting queries, DML and callouts pays off more than faster Apex\n", r.Name, r.WallCpuRatio)
+		}
+	}
+}
+
+// printBatching notes results timed in automatically grown batches and warns
+// about batches that still read 0 ms, whose min values are meaningless
+func printBatching(results []types.AggregatedResult, writer io.Writer) {
+	for _, r := range results {
+		if r.AutoBatchSize > 0 {
+			fmt.Fprintf(writer, "\nNote: %s iterations are below the 1 ms clock resolution; timed in batches of up to %d\n",
+				r.Name, r.AutoBatchSize)
+		}
+		if r.ZeroBatches > 0 {
+			noisyColor.Fprintf(writer, "\nWarning: %d batches of %s measured 0 ms CPU, so its min values are unreliable; "+
+				"raise --iterations or --batch-size\n", r.ZeroBatches, r.Name)
+		}
+	}
+}
+
+// printIncompleteRuns notes results aggregated from only some of their runs
+func printIncompleteRuns(results []types.AggregatedResult, writer io.Writer) {
+	for _, r := range results {
+		if r.FailedRuns > 0 {
+			noisyColor.Fprintf(writer, "\nWarning: %s is based on %d of %d runs; %d failed\n",
+				r.Name, r.Runs, r.Runs+r.FailedRuns, r.FailedRuns)
+		}
+	}
+}
+
+// printPhases breaks down the CPU time of each transaction phase for
+// benchmarks whose setup or teardown took measurable time, flagging those
+// where setup outweighs the measured iterations
+func printPhases(results []types.AggregatedResult, writer io.Writer) {
+	header := false
+	for _, r := range results {
+		p := r.Phases
+		if p == nil || p.SetupCpuMs+p.TeardownCpuMs <= 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(writer, "\nPhases (CPU):\n")
+			header = true
+		}
+		total := p.SetupCpuMs + p.WarmupCpuMs + p.MeasureCpuMs + p.TeardownCpuMs
+		share := func(ms float64) string { return fmt.Sprintf("%.0f ms (%.0f%%)", ms, ms/total*100) }
+		line := fmt.Sprintf("  %s: setup %s, warmup %s, measurement %s, teardown %s", r.Name,
+			share(p.SetupCpuMs), share(p.WarmupCpuMs), share(p.MeasureCpuMs), share(p.TeardownCpuMs))
+		if p.SetupCpuMs > p.MeasureCpuMs {
+			noisyColor.Fprintf(writer, "%s - setup dominates the transaction\n", line)
+		} else {
+			fmt.Fprintln(writer, line)
+		}
+	}
+}
+
+// printCustomMetrics lists the BENCH_METRIC values of user code, as the
+// mean per run
+func printCustomMetrics(results []types.AggregatedResult, writer io.Writer) {
+	header := false
+	for _, r := range results {
+		if len(r.CustomMetrics) == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(writer, "\nCustom metrics (mean per run):\n")
+			header = true
+		}
+		names := make([]string, 0, len(r.CustomMetrics))
+		for name := range r.CustomMetrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, name := range names {
+			values[i] = fmt.Sprintf("%s %g", name, r.CustomMetrics[name])
+		}
+		fmt.Fprintf(writer, "  %s: %s\n", r.Name, strings.Join(values, ", "))
+	}
+}
+
+// printThresholds reports the budget checks of results as PASS or FAIL
+func printThresholds(results []types.AggregatedResult, writer io.Writer) {
+	format := func(v float64) string { return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64) }
+	header := false
+	for _, r := range results {
+		for _, c := range r.Thresholds {
+			if !header {
+				fmt.Fprintf(writer, "\nBudgets:\n")
+				header = true
+			}
+			switch {
+			case !c.Tracked:
+				slowerColor.Fprintf(writer, "  FAIL %s: %s not tracked\n", r.Name, c.Metric)
+			case c.Pass:
+				fastestColor.Fprintf(writer, "  PASS %s: %s %s <= %s\n", r.Name, c.Metric, format(c.Value), format(c.Limit))
+			default:
+				slowerColor.Fprintf(writer, "  FAIL %s: %s %s > %s\n", r.Name, c.Metric, format(c.Value), format(c.Limit))
+			}
+		}
+	}
+}
+
+// printQueryPlans lists the plans fetched with --query-plan, highlighting
+// queries the optimizer considers unselective
+func printQueryPlans(results []types.AggregatedResult, writer io.Writer) {
+	header := false
+	for _, r := range results {
+		for _, plan := range r.QueryPlans {
+			if !header {
+				fmt.Fprintf(writer, "\nQuery plans:\n")
+				header = true
+			}
+			fmt.Fprintf(writer, "  %s: %s\n", r.Name, plan.Query)
+			summary := fmt.Sprintf("    %s on %s, cost %.2f, ~%d of %d rows",
+				plan.LeadingOperation, plan.SobjectType, plan.RelativeCost, plan.Cardinality, plan.SobjectCardinality)
+			if plan.RelativeCost > 1 {
+				noisyColor.Fprintf(writer, "%s (not selective)\n", summary)
+			} else {
+				fmt.Fprintln(writer, summary)
+			}
+			for _, note := range plan.Notes {
+				fmt.Fprintf(writer, "    Note: %s\n", note)
+			}
+		}
+	}
+}
+
+// formatWithCI formats an average with its 95% confidence interval, which is
+// only known when there was more than one run
+func formatWithCI(avg, ci float64) string {
+	if ci == 0 {
+		return fmt.Sprintf("%.3f ms", avg)
+	}
+	return fmt.Sprintf("%.3f ms ± %.3f", avg, ci)
+}
@@ -0,0 +1,247 @@
+// Package scheduler queues Apex executions so that everything a process
+// benchmarks shares one limit on concurrent executions, with optional
+// lower limits per org and priorities deciding who goes next.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Job describes an execution waiting for a slot
+type Job struct {
+	Org      string // Org the execution runs against, for per-org limits
+	Priority int    // Higher priorities are started first; equal ones in order of arrival
+	Weight   int    // Slots the execution occupies; 0 means 1
+}
+
+// Scheduler is a weighted semaphore with a priority queue and per-org
+// limits. Waiting jobs start in priority order as slots free up; a job held
+// back only by its org's limit lets others pass.
+type Scheduler struct {
+	// Warnf receives warnings, such as an org's limit being lowered; nil
+	// discards them
+	Warnf func(format string, args ...any)
+
+	mu       sync.Mutex
+	capacity int // Total slots; 0 means unlimited
+	used     int
+	orgLimit map[string]int
+	orgUsed  map[string]int
+	queue    waitQueue
+	arrivals uint64
+	started  int
+}
+
+// Default is the scheduler shared by the executors of a process. It is
+// unlimited until SetCapacity is called.
+var Default = New(0)
+
+// New creates a scheduler with capacity slots; 0 means unlimited
+func New(capacity int) *Scheduler {
+	return &Scheduler{
+		capacity: max(capacity, 0),
+		orgLimit: make(map[string]int),
+		orgUsed:  make(map[string]int),
+	}
+}
+
+// SetCapacity changes the total number of slots; 0 means unlimited.
+// Running jobs keep their slots.
+func (s *Scheduler) SetCapacity(capacity int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity = max(capacity, 0)
+	s.dispatch()
+}
+
+// SetOrgLimit caps the slots used by jobs against org; 0 removes the cap
+func (s *Scheduler) SetOrgLimit(org string, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit > 0 {
+		s.orgLimit[org] = limit
+	} else {
+		delete(s.orgLimit, org)
+	}
+	s.dispatch()
+}
+
+// Acquire waits until job can start and returns the function releasing its
+// slots, which must be called once the execution finishes. It fails if ctx
+// is done first or the job could never fit.
+func (s *Scheduler) Acquire(ctx context.Context, job Job) (release func(), err error) {
+	weight := max(job.Weight, 1)
+
+	s.mu.Lock()
+	if s.capacity > 0 && weight > s.capacity {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("job of weight %d exceeds scheduler capacity %d", weight, s.capacity)
+	}
+	if limit, ok := s.orgLimit[job.Org]; ok && weight > limit {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("job of weight %d exceeds the limit of %d for org %s", weight, limit, job.Org)
+	}
+
+	w := &waiter{job: job, weight: weight, arrival: s.arrivals, ready: make(chan struct{})}
+	s.arrivals++
+	heap.Push(&s.queue, w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(w), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Started while giving up: hand the slots back
+			s.release(w)
+		default:
+			heap.Remove(&s.queue, w.index)
+			s.dispatch()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Throttle lowers the limit of org below the slots its jobs use now, after
+// the org rejected an execution for running too many at once. It returns
+// false when the limit is already 1 and cannot be lowered further.
+func (s *Scheduler) Throttle(org string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.orgUsed[org]
+	if limit, ok := s.orgLimit[org]; ok {
+		current = min(current, limit)
+	}
+	if current <= 1 {
+		if s.orgLimit[org] == 1 {
+			return false
+		}
+		current = 2
+	}
+	s.orgLimit[org] = current - 1
+	if s.Warnf != nil {
+		s.Warnf("%s rejected an execution for exceeding its concurrent Apex limit; running at most %d at once", orgName(org), current-1)
+	}
+	return true
+}
+
+// orgName names org in messages
+func orgName(org string) string {
+	if org == "" {
+		return "The default org"
+	}
+	return "Org " + org
+}
+
+// Running returns the number of slots in use
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// Started returns the number of jobs started so far, retries after
+// Throttle included
+func (s *Scheduler) Started() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// releaser returns a release function that is safe to call more than once
+func (s *Scheduler) releaser(w *waiter) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.release(w)
+		})
+	}
+}
+
+// release returns w's slots and starts waiting jobs. s.mu must be held.
+func (s *Scheduler) release(w *waiter) {
+	s.used -= w.weight
+	s.orgUsed[w.job.Org] -= w.weight
+	if s.orgUsed[w.job.Org] <= 0 {
+		delete(s.orgUsed, w.job.Org)
+	}
+	s.dispatch()
+}
+
+// dispatch starts waiting jobs in priority order while slots are free. The
+// first job that does not fit in the free slots stops dispatching, so heavy
+// jobs are not starved by lighter ones; jobs blocked by their org's limit
+// are skipped. s.mu must be held.
+func (s *Scheduler) dispatch() {
+	var held []*waiter
+	for s.queue.Len() > 0 {
+		w := s.queue[0]
+		if s.capacity > 0 && s.used+w.weight > s.capacity {
+			break
+		}
+		heap.Pop(&s.queue)
+		if limit, ok := s.orgLimit[w.job.Org]; ok && s.orgUsed[w.job.Org]+w.weight > limit {
+			held = append(held, w)
+			continue
+		}
+		s.used += w.weight
+		s.orgUsed[w.job.Org] += w.weight
+		s.started++
+		close(w.ready)
+	}
+	for _, w := range held {
+		heap.Push(&s.queue, w)
+	}
+}
+
+// waiter is a job in the queue
+type waiter struct {
+	job     Job
+	weight  int
+	arrival uint64
+	index   int // Position in the heap
+	ready   chan struct{}
+}
+
+// waitQueue is a heap of waiters, highest priority and earliest arrival
+// first
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].job.Priority != q[j].job.Priority {
+		return q[i].job.Priority > q[j].job.Priority
+	}
+	return q[i].arrival < q[j].arrival
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return w
+}
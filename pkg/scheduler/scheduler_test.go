@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// acquireAsync starts acquiring job and reports on the returned channel
+// once it holds a slot
+func acquireAsync(t *testing.T, s *Scheduler, job Job) <-chan func() {
+	t.Helper()
+	started := make(chan func(), 1)
+	go func() {
+		release, err := s.Acquire(context.Background(), job)
+		if err != nil {
+			t.Errorf("Acquire() error = %v", err)
+			return
+		}
+		started <- release
+	}()
+	return started
+}
+
+// waitQueued waits until n jobs are queued
+func waitQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		queued := s.queue.Len()
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d queued jobs, got %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_Capacity(t *testing.T) {
+	s := New(2)
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), Job{})
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak != 2 {
+		t.Errorf("Expected at most 2 concurrent jobs, got %d", peak)
+	}
+	if s.Running() != 0 {
+		t.Errorf("Expected every slot to be released, %d in use", s.Running())
+	}
+	if s.Started() != 10 {
+		t.Errorf("Expected 10 started jobs, got %d", s.Started())
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	s := New(1)
+	release, err := s.Acquire(context.Background(), Job{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	low := acquireAsync(t, s, Job{Priority: 0})
+	waitQueued(t, s, 1)
+	high := acquireAsync(t, s, Job{Priority: 5})
+	waitQueued(t, s, 2)
+
+	release()
+	select {
+	case r := <-high:
+		r()
+	case <-low:
+		t.Fatal("Expected the high priority job to start first")
+	case <-time.After(time.Second):
+		t.Fatal("High priority job did not start")
+	}
+	(<-low)()
+}
+
+func TestScheduler_OrgLimit(t *testing.T) {
+	s := New(0)
+	s.SetOrgLimit("limited", 1)
+
+	release, err := s.Acquire(context.Background(), Job{Org: "limited"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked := acquireAsync(t, s, Job{Org: "limited", Priority: 1})
+	waitQueued(t, s, 1)
+
+	// Other orgs pass a job held back by its org's limit
+	other := acquireAsync(t, s, Job{Org: "other"})
+	select {
+	case r := <-other:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("Job against another org did not start")
+	}
+
+	release()
+	(<-blocked)()
+
+	if _, err := s.Acquire(context.Background(), Job{Org: "limited", Weight: 2}); err == nil {
+		t.Error("Expected a job heavier than the org limit to be rejected")
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	s := New(1)
+	release, err := s.Acquire(context.Background(), Job{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(ctx, Job{})
+		done <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	release()
+	release() // Releasing twice is harmless
+	if s.Running() != 0 {
+		t.Errorf("Expected no slots in use, got %d", s.Running())
+	}
+	if _, err := s.Acquire(context.Background(), Job{Weight: 2}); err == nil {
+		t.Error("Expected a job heavier than the capacity to be rejected")
+	}
+}
+
+func TestScheduler_Throttle(t *testing.T) {
+	s := New(0)
+	var warnings []string
+	s.Warnf = func(format string, args ...any) {
+		warnings = append(warnings, format)
+	}
+
+	var releases []func()
+	for range 3 {
+		release, err := s.Acquire(context.Background(), Job{Org: "busy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	// The limit drops below the jobs running when the org pushed back
+	if !s.Throttle("busy") {
+		t.Fatal("Expected the first throttle to lower the limit")
+	}
+	if s.orgLimit["busy"] != 2 {
+		t.Errorf("Expected a limit of 2, got %d", s.orgLimit["busy"])
+	}
+	for _, release := range releases {
+		release()
+	}
+
+	if !s.Throttle("busy") {
+		t.Fatal("Expected an idle org to be lowered to 1")
+	}
+	if s.orgLimit["busy"] != 1 {
+		t.Errorf("Expected a limit of 1, got %d", s.orgLimit["busy"])
+	}
+	if s.Throttle("busy") {
+		t.Error("Expected no throttling below a limit of 1")
+	}
+	if len(warnings) != 2 {
+		t.Errorf("Expected 2 warnings, got %d", len(warnings))
+	}
+}
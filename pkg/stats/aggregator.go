@@ -3,24 +3,118 @@ package stats
 import (
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
 )
 
-// Aggregate combines multiple Results and calculates statistics
+// Strategy selects how the per-run averages are combined into one value
+type Strategy string
+
+// Supported aggregation strategies
+const (
+	StrategyMean        Strategy = "mean"
+	StrategyMedian      Strategy = "median"
+	StrategyMin         Strategy = "min"
+	StrategyTrimmedMean Strategy = "trimmed-mean"
+)
+
+// Strategies lists the supported aggregation strategies
+var Strategies = []Strategy{StrategyMean, StrategyMedian, StrategyMin, StrategyTrimmedMean}
+
+// ParseStrategy validates an aggregation strategy name. An empty name
+// selects the mean.
+func ParseStrategy(name string) (Strategy, error) {
+	if name == "" {
+		return StrategyMean, nil
+	}
+	for _, s := range Strategies {
+		if Strategy(name) == s {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown aggregation strategy %q (expected mean, median, min or trimmed-mean)", name)
+}
+
+// DefaultNoiseThreshold is the coefficient of variation above which results
+// are considered noisy
+const DefaultNoiseThreshold = 0.20
+
+// FlagNoisy marks a result as noisy when the run-to-run coefficient of
+// variation exceeds threshold (a fraction; 0 selects the default). A single
+// run has no run-to-run variation and is never flagged.
+func FlagNoisy(agg *types.AggregatedResult, threshold float64) {
+	if threshold <= 0 {
+		threshold = DefaultNoiseThreshold
+	}
+	agg.Noisy = agg.Runs > 1 && agg.CVCpu > threshold
+}
+
+// WaitBoundRatio is the wall to CPU time ratio from which a benchmark is
+// considered wait-bound
+const WaitBoundRatio = 2.0
+
+// minWaitBoundWallMs is the average wall time below which results are not
+// flagged as wait-bound, since at the 1 ms clock resolution the ratio of
+// tiny times means little
+const minWaitBoundWallMs = 1.0
+
+// FlagWaitBound records the ratio of wall to CPU time of a result and marks
+// it wait-bound when wall time reaches WaitBoundRatio times CPU time: most of
+// its time then goes to the database, callouts or waiting, so fewer
+// queries, DML statements or callouts pay off more than faster Apex.
+func FlagWaitBound(agg *types.AggregatedResult) {
+	if agg.AvgCpuMs <= 0 {
+		agg.WallCpuRatio, agg.WaitBound = 0, false
+		return
+	}
+	agg.WallCpuRatio = agg.AvgWallMs / agg.AvgCpuMs
+	agg.WaitBound = agg.AvgWallMs >= minWaitBoundWallMs && agg.WallCpuRatio >= WaitBoundRatio
+}
+
+// NormalizePerUnit records the units of work a benchmark processes per
+// iteration and its average times per unit, so benchmarks processing
+// different amounts of work can be compared
+func NormalizePerUnit(agg *types.AggregatedResult, units float64) {
+	if units <= 0 {
+		return
+	}
+	agg.Units = units
+	agg.CpuMsPerUnit = agg.AvgCpuMs / units
+	agg.WallMsPerUnit = agg.AvgWallMs / units
+}
+
+// Aggregate combines multiple Results and calculates statistics, averaging
+// the runs with the mean
 func Aggregate(results []types.Result) (types.AggregatedResult, error) {
+	return AggregateWith(results, StrategyMean)
+}
+
+// AggregateWith combines multiple Results and calculates statistics, using
+// strategy to combine the per-run averages. Standard deviation is always
+// computed around the mean. The confidence intervals are those of the mean,
+// so they are only set when strategy is mean.
+func AggregateWith(results []types.Result, strategy Strategy) (types.AggregatedResult, error) {
 	if len(results) == 0 {
 		return types.AggregatedResult{}, fmt.Errorf("cannot aggregate empty results")
 	}
 
+	strategy, err := ParseStrategy(string(strategy))
+	if err != nil {
+		return types.AggregatedResult{}, err
+	}
+	combine := combiner(strategy)
+
 	// Use first result for metadata
 	first := results[0]
 	agg := types.AggregatedResult{
-		Name:       first.Name,
-		Runs:       len(results),
-		Iterations: first.Iterations,
-		Warmup:     0, // Warmup not tracked in Result, would need to pass separately
-		RawResults: results,
+		SchemaVersion: types.SchemaVersion,
+		Name:          first.Name,
+		Runs:          len(results),
+		Iterations:    first.Iterations,
+		Warmup:        0, // Warmup not tracked in Result, would need to pass separately
+		Aggregation:   string(strategy),
+		RawResults:    results,
 	}
 
 	// Aggregate CPU time
@@ -36,8 +130,14 @@ func Aggregate(results []types.Result) (types.AggregatedResult, error) {
 			maxCpu = r.MaxCpuMs
 		}
 	}
-	agg.AvgCpuMs = mean(cpuTimes)
+	agg.AvgCpuMs = combine(cpuTimes)
 	agg.StdDevCpuMs = stdDev(cpuTimes)
+	if strategy == StrategyMean {
+		agg.CI95CpuMs = confidenceInterval95(cpuTimes)
+	}
+	if m := mean(cpuTimes); m > 0 {
+		agg.CVCpu = agg.StdDevCpuMs / m
+	}
 	agg.MinCpuMs = minCpu
 	agg.MaxCpuMs = maxCpu
 
@@ -54,14 +154,331 @@ func Aggregate(results []types.Result) (types.AggregatedResult, error) {
 			maxWall = r.MaxWallMs
 		}
 	}
-	agg.AvgWallMs = mean(wallTimes)
+	agg.AvgWallMs = combine(wallTimes)
 	agg.StdDevWallMs = stdDev(wallTimes)
+	if strategy == StrategyMean {
+		agg.CI95WallMs = confidenceInterval95(wallTimes)
+	}
 	agg.MinWallMs = minWall
 	agg.MaxWallMs = maxWall
 
+	aggregateHeap(&agg, results, combine)
+	aggregateHeapPeak(&agg, results)
+	aggregateDB(&agg, results, combine)
+	aggregateCache(&agg, results, combine)
+	aggregateTransaction(&agg, results)
+	aggregatePhases(&agg, results)
+	aggregateWarmupCheck(&agg, results)
+
+	aggregateCollected(&agg, results)
+	aggregateCustomMetrics(&agg, results)
+
+	for _, r := range results {
+		if r.AutoBatched {
+			agg.AutoBatchSize = max(agg.AutoBatchSize, r.BatchSize)
+		}
+		agg.ZeroBatches += r.ZeroBatches
+	}
+
 	return agg, nil
 }
 
+// aggregateHeap summarizes heap usage of the runs that tracked it. Fields
+// stay nil when heap tracking was off.
+func aggregateHeap(agg *types.AggregatedResult, results []types.Result, combine func([]float64) float64) {
+	var avgs []float64
+	var minHeap, maxHeap *float64
+	for _, r := range results {
+		if r.AvgHeapKb == nil {
+			continue
+		}
+		avgs = append(avgs, *r.AvgHeapKb)
+		if r.MinHeapKb != nil && (minHeap == nil || *r.MinHeapKb < *minHeap) {
+			minHeap = floatPtr(*r.MinHeapKb)
+		}
+		if r.MaxHeapKb != nil && (maxHeap == nil || *r.MaxHeapKb > *maxHeap) {
+			maxHeap = floatPtr(*r.MaxHeapKb)
+		}
+	}
+	if len(avgs) == 0 {
+		return
+	}
+
+	agg.AvgHeapKb = floatPtr(combine(avgs))
+	agg.StdDevHeapKb = floatPtr(stdDev(avgs))
+	agg.MinHeapKb = minHeap
+	agg.MaxHeapKb = maxHeap
+}
+
+// aggregateHeapPeak reports the highest heap high-water mark of the runs
+// that tracked it and, when the limit is known, its share of the limit
+func aggregateHeapPeak(agg *types.AggregatedResult, results []types.Result) {
+	for _, r := range results {
+		if r.PeakHeapKb == nil {
+			continue
+		}
+		if agg.PeakHeapKb == nil || *r.PeakHeapKb > *agg.PeakHeapKb {
+			agg.PeakHeapKb = floatPtr(*r.PeakHeapKb)
+		}
+		if r.HeapLimitKb != nil && *r.HeapLimitKb > 0 {
+			pct := *r.PeakHeapKb / *r.HeapLimitKb * 100
+			if agg.PeakHeapPct == nil || pct > *agg.PeakHeapPct {
+				agg.PeakHeapPct = floatPtr(pct)
+			}
+		}
+	}
+}
+
+// aggregateDB summarizes DML statements, SOQL and aggregate queries, and
+// future and queueable calls of the runs that tracked them. Fields stay nil
+// when DB tracking was off.
+func aggregateDB(agg *types.AggregatedResult, results []types.Result, combine func([]float64) float64) {
+	agg.AvgDmlStatements = combineCounts(results, combine, func(r types.Result) *int { return r.DmlStatements })
+	agg.AvgSoqlQueries = combineCounts(results, combine, func(r types.Result) *int { return r.SoqlQueries })
+	agg.AvgAggregateQueries = combineCounts(results, combine, func(r types.Result) *int { return r.AggregateQueries })
+	agg.AvgFutureCalls = combineCounts(results, combine, func(r types.Result) *int { return r.FutureCalls })
+	agg.AvgQueueableJobs = combineCounts(results, combine, func(r types.Result) *int { return r.QueueableJobs })
+}
+
+// aggregateCache summarizes Platform Cache partition usage of the runs that
+// tracked it. The miss rate is the partition's own running figure, so it is
+// averaged rather than combined with the strategy.
+func aggregateCache(agg *types.AggregatedResult, results []types.Result, combine func([]float64) float64) {
+	agg.AvgCacheKeys = combineCounts(results, combine, func(r types.Result) *int { return r.CacheKeys })
+
+	var capacity, missRate []float64
+	for _, r := range results {
+		if r.CacheCapacityPct != nil {
+			capacity = append(capacity, *r.CacheCapacityPct)
+		}
+		if r.CacheMissRate != nil {
+			missRate = append(missRate, *r.CacheMissRate)
+		}
+	}
+	if len(capacity) > 0 {
+		agg.AvgCacheCapacityPct = floatPtr(combine(capacity))
+	}
+	if len(missRate) > 0 {
+		agg.CacheMissRate = floatPtr(mean(missRate))
+	}
+}
+
+// combineCounts combines a per-run count over the runs that reported it,
+// nil when none did
+func combineCounts(results []types.Result, combine func([]float64) float64, count func(types.Result) *int) *float64 {
+	var values []float64
+	for _, r := range results {
+		if v := count(r); v != nil {
+			values = append(values, float64(*v))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return floatPtr(combine(values))
+}
+
+// floatPtr returns a pointer to a copy of v
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// aggregateTransaction summarizes whole-transaction limit usage of the runs
+// that reported it
+func aggregateTransaction(agg *types.AggregatedResult, results []types.Result) {
+	var cpu, unmeasured []float64
+	for _, r := range results {
+		if r.Transaction == nil {
+			continue
+		}
+		cpu = append(cpu, float64(r.Transaction.CpuTimeMs))
+		unmeasured = append(unmeasured, math.Max(0, float64(r.Transaction.CpuTimeMs)-r.AvgCpuMs*float64(r.Iterations)))
+		if r.Transaction.HeapBytes > agg.TransactionHeapBytes {
+			agg.TransactionHeapBytes = r.Transaction.HeapBytes
+		}
+		if r.Transaction.SoqlQueries > agg.TransactionSoqlQueries {
+			agg.TransactionSoqlQueries = r.Transaction.SoqlQueries
+		}
+	}
+	agg.TransactionCpuMs = mean(cpu)
+	agg.UnmeasuredCpuMs = mean(unmeasured)
+}
+
+// aggregatePhases averages the phase timings of the runs that report them
+func aggregatePhases(agg *types.AggregatedResult, results []types.Result) {
+	var sum types.PhaseTimings
+	n := 0
+	for _, r := range results {
+		if r.Phases == nil {
+			continue
+		}
+		p := r.Phases
+		sum.SetupWallMs += p.SetupWallMs
+		sum.SetupCpuMs += p.SetupCpuMs
+		sum.WarmupWallMs += p.WarmupWallMs
+		sum.WarmupCpuMs += p.WarmupCpuMs
+		sum.MeasureWallMs += p.MeasureWallMs
+		sum.MeasureCpuMs += p.MeasureCpuMs
+		sum.TeardownWallMs += p.TeardownWallMs
+		sum.TeardownCpuMs += p.TeardownCpuMs
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	d := float64(n)
+	agg.Phases = &types.PhaseTimings{
+		SetupWallMs:    sum.SetupWallMs / d,
+		SetupCpuMs:     sum.SetupCpuMs / d,
+		WarmupWallMs:   sum.WarmupWallMs / d,
+		WarmupCpuMs:    sum.WarmupCpuMs / d,
+		MeasureWallMs:  sum.MeasureWallMs / d,
+		MeasureCpuMs:   sum.MeasureCpuMs / d,
+		TeardownWallMs: sum.TeardownWallMs / d,
+		TeardownCpuMs:  sum.TeardownCpuMs / d,
+	}
+}
+
+// aggregateCollected averages each collected value across the runs that
+// report it
+func aggregateCollected(agg *types.AggregatedResult, results []types.Result) {
+	values := make(map[string][]float64)
+	for _, r := range results {
+		for name, v := range r.Collected {
+			values[name] = append(values[name], v)
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	agg.Collected = make(map[string]float64, len(values))
+	for name, vs := range values {
+		agg.Collected[name] = mean(vs)
+	}
+}
+
+// aggregateCustomMetrics sums and averages each custom metric across the
+// runs that report it
+func aggregateCustomMetrics(agg *types.AggregatedResult, results []types.Result) {
+	values := make(map[string][]float64)
+	for _, r := range results {
+		for name, v := range r.CustomMetrics {
+			values[name] = append(values[name], v)
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	agg.CustomMetrics = make(map[string]float64, len(values))
+	agg.CustomMetricTotals = make(map[string]float64, len(values))
+	for name, vs := range values {
+		total := 0.0
+		for _, v := range vs {
+			total += v
+		}
+		agg.CustomMetrics[name] = mean(vs)
+		agg.CustomMetricTotals[name] = total
+	}
+}
+
+// WarmupSlowdownThreshold is how much slower, as a fraction, the early
+// measured iterations may be than the rest before warmup is considered
+// insufficient
+const WarmupSlowdownThreshold = 0.25
+
+// aggregateWarmupCheck averages the early and remaining iteration CPU of the
+// runs that report them and flags insufficient warmup. The early iterations
+// must also be slower in total by at least the 1 ms clock resolution, so a
+// single tick does not count as a slowdown.
+func aggregateWarmupCheck(agg *types.AggregatedResult, results []types.Result) {
+	var early, rest []float64
+	iterations := 0
+	for _, r := range results {
+		if r.WarmupCheck == nil {
+			continue
+		}
+		early = append(early, r.WarmupCheck.EarlyAvgCpuMs)
+		rest = append(rest, r.WarmupCheck.RestAvgCpuMs)
+		iterations = r.WarmupCheck.EarlyIterations
+	}
+	if len(early) == 0 {
+		return
+	}
+
+	check := &types.WarmupCheck{
+		EarlyIterations: iterations,
+		EarlyAvgCpuMs:   mean(early),
+		RestAvgCpuMs:    mean(rest),
+	}
+	excess := check.EarlyAvgCpuMs - check.RestAvgCpuMs
+	check.Insufficient = excess > check.RestAvgCpuMs*WarmupSlowdownThreshold &&
+		excess*float64(check.EarlyIterations) >= 1
+	agg.WarmupCheck = check
+}
+
+// combiner returns the function implementing a validated strategy
+func combiner(strategy Strategy) func([]float64) float64 {
+	switch strategy {
+	case StrategyMedian:
+		return Median
+	case StrategyMin:
+		return minimum
+	case StrategyTrimmedMean:
+		return trimmedMean
+	default:
+		return mean
+	}
+}
+
+// Median returns the middle value, or the mean of the two middle values
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := sortedCopy(values)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// minimum returns the smallest value
+func minimum(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	m := values[0]
+	for _, v := range values[1:] {
+		m = math.Min(m, v)
+	}
+	return m
+}
+
+// trimmedMean drops the lowest and highest 10% of values (at least one of
+// each once there are three or more) and averages the rest
+func trimmedMean(values []float64) float64 {
+	if len(values) < 3 {
+		return mean(values)
+	}
+
+	trim := len(values) / 10
+	if trim == 0 {
+		trim = 1
+	}
+	sorted := sortedCopy(values)
+	return mean(sorted[trim : len(sorted)-trim])
+}
+
+// sortedCopy returns values sorted ascending without modifying the input
+func sortedCopy(values []float64) []float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
 // mean calculates the arithmetic mean of a slice of float64
 func mean(values []float64) float64 {
 	if len(values) == 0 {
@@ -91,3 +508,51 @@ func stdDev(values []float64) float64 {
 	variance := sumSquares / float64(len(values))
 	return math.Sqrt(variance)
 }
+
+// tCritical95 holds two-sided 95% critical values of Student's t
+// distribution for 1 to 30 degrees of freedom
+var tCritical95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tValue95 returns the two-sided 95% critical t value for df degrees of
+// freedom. Beyond 30, df is rounded down to the next of 40, 60 and 120, so
+// the interval errs on the wide side.
+func tValue95(df int) float64 {
+	switch {
+	case df <= 0:
+		return 0
+	case df <= len(tCritical95):
+		return tCritical95[df-1]
+	case df < 40:
+		return tCritical95[len(tCritical95)-1]
+	case df < 60:
+		return 2.021
+	case df < 120:
+		return 2.000
+	default:
+		return 1.980
+	}
+}
+
+// confidenceInterval95 returns the half-width of the 95% confidence interval
+// of the mean of values, based on the sample standard deviation and the
+// t distribution. It is 0 for fewer than two values.
+func confidenceInterval95(values []float64) float64 {
+	n := len(values)
+	if n < 2 {
+		return 0
+	}
+
+	avg := mean(values)
+	sumSquares := 0.0
+	for _, v := range values {
+		diff := v - avg
+		sumSquares += diff * diff
+	}
+	sampleStdDev := math.Sqrt(sumSquares / float64(n-1))
+
+	return tValue95(n-1) * sampleStdDev / math.Sqrt(float64(n))
+}
@@ -178,3 +178,447 @@ func TestStdDev(t *testing.T) {
 	}
 }
 
+func TestAggregate_TransactionUsage(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", Iterations: 100, AvgCpuMs: 1.0, Transaction: &types.LimitUsage{CpuTimeMs: 150, HeapBytes: 2000, SoqlQueries: 1}},
+		{Name: "Test", Iterations: 100, AvgCpuMs: 1.5, Transaction: &types.LimitUsage{CpuTimeMs: 210, HeapBytes: 3000, SoqlQueries: 2}},
+		{Name: "Test", Iterations: 100, AvgCpuMs: 2.0},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+
+	// Only runs that reported usage count
+	if agg.TransactionCpuMs != 180 {
+		t.Errorf("Expected transaction CPU 180, got %f", agg.TransactionCpuMs)
+	}
+	if agg.UnmeasuredCpuMs != 55 {
+		t.Errorf("Expected unmeasured CPU 55, got %f", agg.UnmeasuredCpuMs)
+	}
+	if agg.TransactionHeapBytes != 3000 {
+		t.Errorf("Expected max transaction heap 3000, got %d", agg.TransactionHeapBytes)
+	}
+	if agg.TransactionSoqlQueries != 2 {
+		t.Errorf("Expected max transaction SOQL 2, got %d", agg.TransactionSoqlQueries)
+	}
+}
+
+func TestAggregateWith_Strategies(t *testing.T) {
+	cpu := []float64{1.0, 2.0, 3.0, 4.0, 100.0}
+	results := make([]types.Result, len(cpu))
+	for i, c := range cpu {
+		results[i] = types.Result{Name: "Test", Iterations: 10, AvgCpuMs: c, AvgWallMs: c * 2}
+	}
+
+	tests := []struct {
+		strategy Strategy
+		wantCpu  float64
+	}{
+		{StrategyMean, 22.0},
+		{StrategyMedian, 3.0},
+		{StrategyMin, 1.0},
+		{StrategyTrimmedMean, 3.0},
+		{"", 22.0},
+	}
+
+	for _, tt := range tests {
+		agg, err := AggregateWith(results, tt.strategy)
+		if err != nil {
+			t.Fatalf("AggregateWith(%q) failed: %v", tt.strategy, err)
+		}
+		if math.Abs(agg.AvgCpuMs-tt.wantCpu) > 0.0001 {
+			t.Errorf("AggregateWith(%q): expected avg CPU %f, got %f", tt.strategy, tt.wantCpu, agg.AvgCpuMs)
+		}
+		if math.Abs(agg.AvgWallMs-tt.wantCpu*2) > 0.0001 {
+			t.Errorf("AggregateWith(%q): expected avg wall %f, got %f", tt.strategy, tt.wantCpu*2, agg.AvgWallMs)
+		}
+		if tt.strategy != "" && agg.Aggregation != string(tt.strategy) {
+			t.Errorf("Expected aggregation %q recorded, got %q", tt.strategy, agg.Aggregation)
+		}
+	}
+}
+
+func TestAggregateWith_UnknownStrategy(t *testing.T) {
+	_, err := AggregateWith([]types.Result{{Name: "Test"}}, "mode")
+	if err == nil {
+		t.Fatal("Expected error for unknown strategy")
+	}
+}
+
+func TestMedian(t *testing.T) {
+	if got := Median([]float64{4, 1, 3, 2}); got != 2.5 {
+		t.Errorf("Expected median 2.5, got %f", got)
+	}
+	if got := Median([]float64{5, 1, 3}); got != 3 {
+		t.Errorf("Expected median 3, got %f", got)
+	}
+	if got := Median(nil); got != 0 {
+		t.Errorf("Expected median 0 for empty input, got %f", got)
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	values := make([]float64, 20)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	values[19] = 1000
+
+	// Two values are trimmed from each end of 20
+	if got := trimmedMean(values); got != 10.5 {
+		t.Errorf("Expected trimmed mean 10.5, got %f", got)
+	}
+	if got := trimmedMean([]float64{1, 3}); got != 2 {
+		t.Errorf("Expected plain mean for short input, got %f", got)
+	}
+}
+
+func TestConfidenceInterval95(t *testing.T) {
+	// Sample stddev of 1..5 is sqrt(2.5); t(4) = 2.776
+	want := 2.776 * math.Sqrt(2.5) / math.Sqrt(5)
+	if got := confidenceInterval95([]float64{1, 2, 3, 4, 5}); math.Abs(got-want) > 0.0001 {
+		t.Errorf("Expected CI %f, got %f", want, got)
+	}
+
+	if got := confidenceInterval95([]float64{3}); got != 0 {
+		t.Errorf("Expected CI 0 for a single run, got %f", got)
+	}
+}
+
+func TestTValue95(t *testing.T) {
+	tests := map[int]float64{0: 0, 1: 12.706, 10: 2.228, 30: 2.042, 35: 2.042, 40: 2.021, 59: 2.021, 119: 2.000, 1000: 1.980}
+	for df, want := range tests {
+		if got := tValue95(df); got != want {
+			t.Errorf("tValue95(%d) = %f, want %f", df, got, want)
+		}
+	}
+}
+
+func TestAggregate_ConfidenceInterval(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", AvgCpuMs: 1.0, AvgWallMs: 2.0},
+		{Name: "Test", AvgCpuMs: 3.0, AvgWallMs: 2.0},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+
+	// Sample stddev is sqrt(2); t(1) = 12.706
+	want := 12.706 * math.Sqrt(2) / math.Sqrt(2)
+	if math.Abs(agg.CI95CpuMs-want) > 0.0001 {
+		t.Errorf("Expected CPU CI %f, got %f", want, agg.CI95CpuMs)
+	}
+	if agg.CI95WallMs != 0 {
+		t.Errorf("Expected wall CI 0 for identical runs, got %f", agg.CI95WallMs)
+	}
+
+	// The interval of the mean does not belong next to a median
+	agg, err = AggregateWith(results, StrategyMedian)
+	if err != nil {
+		t.Fatalf("AggregateWith failed: %v", err)
+	}
+	if agg.CI95CpuMs != 0 {
+		t.Errorf("Expected no CI for the median, got %f", agg.CI95CpuMs)
+	}
+}
+
+func TestFlagWaitBound(t *testing.T) {
+	tests := []struct {
+		name      string
+		cpu, wall float64
+		ratio     float64
+		waitBound bool
+	}{
+		{"cpu bound", 10, 12, 1.2, false},
+		{"wait bound", 4, 20, 5, true},
+		{"at the ratio", 5, 10, 2, true},
+		{"below clock resolution", 0.1, 0.5, 5, false},
+		{"no cpu", 0, 3, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := types.AggregatedResult{AvgCpuMs: tt.cpu, AvgWallMs: tt.wall}
+			FlagWaitBound(&agg)
+			if math.Abs(agg.WallCpuRatio-tt.ratio) > 0.0001 || agg.WaitBound != tt.waitBound {
+				t.Errorf("FlagWaitBound() = %.2f, %v; want %.2f, %v", agg.WallCpuRatio, agg.WaitBound, tt.ratio, tt.waitBound)
+			}
+		})
+	}
+}
+
+func TestFlagNoisy(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", AvgCpuMs: 1.0},
+		{Name: "Test", AvgCpuMs: 2.0},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+
+	// Mean 1.5, population stddev 0.5
+	if math.Abs(agg.CVCpu-1.0/3.0) > 0.0001 {
+		t.Errorf("Expected CV 0.333, got %f", agg.CVCpu)
+	}
+
+	FlagNoisy(&agg, 0)
+	if !agg.Noisy {
+		t.Error("Expected result to be noisy with the default threshold")
+	}
+
+	FlagNoisy(&agg, 0.5)
+	if agg.Noisy {
+		t.Error("Expected result not to be noisy with a 50% threshold")
+	}
+
+	single := types.AggregatedResult{Runs: 1, CVCpu: 1}
+	FlagNoisy(&single, 0)
+	if single.Noisy {
+		t.Error("Expected a single run never to be noisy")
+	}
+}
+
+func TestAggregate_HeapAndDB(t *testing.T) {
+	heap := func(v float64) *float64 { return &v }
+	count := func(v int) *int { return &v }
+	results := []types.Result{
+		{Name: "Test", AvgHeapKb: heap(10), MinHeapKb: heap(8), MaxHeapKb: heap(12), DmlStatements: count(2), SoqlQueries: count(4)},
+		{Name: "Test", AvgHeapKb: heap(20), MinHeapKb: heap(15), MaxHeapKb: heap(30), DmlStatements: count(2), SoqlQueries: count(6)},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+
+	if agg.AvgHeapKb == nil || *agg.AvgHeapKb != 15 {
+		t.Errorf("Expected avg heap 15, got %v", agg.AvgHeapKb)
+	}
+	if agg.StdDevHeapKb == nil || *agg.StdDevHeapKb != 5 {
+		t.Errorf("Expected heap stddev 5, got %v", agg.StdDevHeapKb)
+	}
+	if agg.MinHeapKb == nil || *agg.MinHeapKb != 8 {
+		t.Errorf("Expected min heap 8, got %v", agg.MinHeapKb)
+	}
+	if agg.MaxHeapKb == nil || *agg.MaxHeapKb != 30 {
+		t.Errorf("Expected max heap 30, got %v", agg.MaxHeapKb)
+	}
+	if agg.AvgDmlStatements == nil || *agg.AvgDmlStatements != 2 {
+		t.Errorf("Expected avg DML 2, got %v", agg.AvgDmlStatements)
+	}
+	if agg.AvgSoqlQueries == nil || *agg.AvgSoqlQueries != 5 {
+		t.Errorf("Expected avg SOQL 5, got %v", agg.AvgSoqlQueries)
+	}
+}
+
+func TestAggregate_NoTrackingLeavesHeapAndDBNil(t *testing.T) {
+	agg, err := Aggregate([]types.Result{{Name: "Test", AvgCpuMs: 1}})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+
+	if agg.AvgHeapKb != nil || agg.AvgDmlStatements != nil || agg.AvgSoqlQueries != nil {
+		t.Errorf("Expected no heap or DB statistics, got %+v", agg)
+	}
+}
+
+func TestAggregate_HeapPeak(t *testing.T) {
+	kb := func(v float64) *float64 { return &v }
+	results := []types.Result{
+		{Name: "Test", PeakHeapKb: kb(600), HeapLimitKb: kb(6144)},
+		{Name: "Test", PeakHeapKb: kb(1536), HeapLimitKb: kb(6144)},
+		{Name: "Test", PeakHeapKb: kb(900), HeapLimitKb: kb(6144)},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.PeakHeapKb == nil || *agg.PeakHeapKb != 1536 {
+		t.Errorf("Expected peak heap 1536, got %v", agg.PeakHeapKb)
+	}
+	if agg.PeakHeapPct == nil || *agg.PeakHeapPct != 25 {
+		t.Errorf("Expected peak heap at 25%% of the limit, got %v", agg.PeakHeapPct)
+	}
+
+	// Without the limit only the peak is known
+	agg, err = Aggregate([]types.Result{{Name: "Test", PeakHeapKb: kb(100)}})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.PeakHeapKb == nil || agg.PeakHeapPct != nil {
+		t.Errorf("Expected peak without percentage, got %v and %v", agg.PeakHeapKb, agg.PeakHeapPct)
+	}
+}
+
+func TestAggregate_AsyncCounts(t *testing.T) {
+	count := func(v int) *int { return &v }
+	results := []types.Result{
+		{Name: "Test", AggregateQueries: count(1), FutureCalls: count(2), QueueableJobs: count(1)},
+		{Name: "Test", AggregateQueries: count(1), FutureCalls: count(2), QueueableJobs: count(1)},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.AvgAggregateQueries == nil || *agg.AvgAggregateQueries != 1 {
+		t.Errorf("Expected avg aggregate queries 1, got %v", agg.AvgAggregateQueries)
+	}
+	if agg.AvgFutureCalls == nil || *agg.AvgFutureCalls != 2 {
+		t.Errorf("Expected avg future calls 2, got %v", agg.AvgFutureCalls)
+	}
+	if agg.AvgQueueableJobs == nil || *agg.AvgQueueableJobs != 1 {
+		t.Errorf("Expected avg queueable jobs 1, got %v", agg.AvgQueueableJobs)
+	}
+}
+
+func TestAggregate_Cache(t *testing.T) {
+	count := func(v int) *int { return &v }
+	pct := func(v float64) *float64 { return &v }
+	results := []types.Result{
+		{Name: "Test", CacheKeys: count(10), CacheCapacityPct: pct(0.5), CacheMissRate: pct(0.2)},
+		{Name: "Test", CacheKeys: count(10), CacheCapacityPct: pct(0.5), CacheMissRate: pct(0.4)},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.AvgCacheKeys == nil || *agg.AvgCacheKeys != 10 {
+		t.Errorf("Expected avg cache keys 10, got %v", agg.AvgCacheKeys)
+	}
+	if agg.AvgCacheCapacityPct == nil || *agg.AvgCacheCapacityPct != 0.5 {
+		t.Errorf("Expected avg capacity 0.5, got %v", agg.AvgCacheCapacityPct)
+	}
+	if agg.CacheMissRate == nil || math.Abs(*agg.CacheMissRate-0.3) > 1e-9 {
+		t.Errorf("Expected mean miss rate 0.3, got %v", agg.CacheMissRate)
+	}
+
+	agg, _ = Aggregate([]types.Result{{Name: "Test"}})
+	if agg.AvgCacheKeys != nil || agg.AvgCacheCapacityPct != nil || agg.CacheMissRate != nil {
+		t.Error("Expected no cache statistics without tracking")
+	}
+}
+
+func TestAggregate_Phases(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", Phases: &types.PhaseTimings{SetupCpuMs: 10, MeasureCpuMs: 4}},
+		{Name: "Test", Phases: &types.PhaseTimings{SetupCpuMs: 20, MeasureCpuMs: 6}},
+		{Name: "Test"},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.Phases == nil || agg.Phases.SetupCpuMs != 15 || agg.Phases.MeasureCpuMs != 5 {
+		t.Errorf("Expected mean phases over the runs reporting them, got %+v", agg.Phases)
+	}
+
+	agg, _ = Aggregate([]types.Result{{Name: "Test"}})
+	if agg.Phases != nil {
+		t.Error("Expected no phases when no run reports them")
+	}
+}
+
+func TestAggregate_WarmupCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		early, rest  float64
+		iterations   int
+		insufficient bool
+	}{
+		{"steady", 1.1, 1, 10, false},
+		{"slow start", 2, 1, 10, true},
+		{"single tick", 0.2, 0.1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &types.WarmupCheck{EarlyIterations: tt.iterations, EarlyAvgCpuMs: tt.early, RestAvgCpuMs: tt.rest}
+			agg, err := Aggregate([]types.Result{{Name: "Test", WarmupCheck: check}, {Name: "Test"}})
+			if err != nil {
+				t.Fatalf("Aggregate failed: %v", err)
+			}
+			if agg.WarmupCheck == nil || agg.WarmupCheck.EarlyAvgCpuMs != tt.early {
+				t.Fatalf("Expected the reported warmup check, got %+v", agg.WarmupCheck)
+			}
+			if agg.WarmupCheck.Insufficient != tt.insufficient {
+				t.Errorf("Insufficient = %v, want %v", agg.WarmupCheck.Insufficient, tt.insufficient)
+			}
+		})
+	}
+
+	agg, _ := Aggregate([]types.Result{{Name: "Test"}})
+	if agg.WarmupCheck != nil {
+		t.Error("Expected no warmup check when no run reports one")
+	}
+}
+
+func TestAggregate_AutoBatching(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", BatchSize: 8, AutoBatched: true},
+		{Name: "Test", BatchSize: 16, AutoBatched: true, ZeroBatches: 2},
+		{Name: "Test", BatchSize: 1},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.AutoBatchSize != 16 || agg.ZeroBatches != 2 {
+		t.Errorf("Expected auto batch size 16 and 2 zero batches, got %d and %d", agg.AutoBatchSize, agg.ZeroBatches)
+	}
+}
+
+func TestAggregate_Collected(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", Collected: map[string]float64{"callouts": 2, "rows": 10}},
+		{Name: "Test", Collected: map[string]float64{"callouts": 4}},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.Collected["callouts"] != 3 || agg.Collected["rows"] != 10 {
+		t.Errorf("Expected means over the runs reporting each value, got %v", agg.Collected)
+	}
+}
+
+func TestAggregate_CustomMetrics(t *testing.T) {
+	results := []types.Result{
+		{Name: "Test", CustomMetrics: map[string]float64{"rows": 100, "batches": 1}},
+		{Name: "Test", CustomMetrics: map[string]float64{"rows": 300}},
+		{Name: "Test"},
+	}
+
+	agg, err := Aggregate(results)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if agg.CustomMetrics["rows"] != 200 || agg.CustomMetricTotals["rows"] != 400 {
+		t.Errorf("Expected rows mean 200 and total 400, got %v and %v", agg.CustomMetrics["rows"], agg.CustomMetricTotals["rows"])
+	}
+	if agg.CustomMetrics["batches"] != 1 || agg.CustomMetricTotals["batches"] != 1 {
+		t.Errorf("Expected batches from the one run reporting it, got %v", agg.CustomMetrics)
+	}
+}
+
+func TestNormalizePerUnit(t *testing.T) {
+	agg := types.AggregatedResult{AvgCpuMs: 5, AvgWallMs: 8}
+	NormalizePerUnit(&agg, 0)
+	if agg.Units != 0 || agg.CpuMsPerUnit != 0 {
+		t.Errorf("Expected no per-unit times without units, got %+v", agg)
+	}
+
+	NormalizePerUnit(&agg, 100)
+	if agg.Units != 100 || agg.CpuMsPerUnit != 0.05 || agg.WallMsPerUnit != 0.08 {
+		t.Errorf("Expected per-unit times 0.05 and 0.08, got %v and %v", agg.CpuMsPerUnit, agg.WallMsPerUnit)
+	}
+}
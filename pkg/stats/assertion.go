@@ -0,0 +1,203 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+// Assertion is a pass/fail condition over the averages of benchmarks in a
+// comparison, such as "NewImpl <= OldImpl * 0.9"
+type Assertion struct {
+	Expr  string
+	Left  Operand
+	Op    string // <, <=, > or >=
+	Right Operand
+}
+
+// Operand is one side of an assertion: a benchmark's average scaled by a
+// factor, or a constant when Name is empty
+type Operand struct {
+	Name   string
+	Factor float64
+}
+
+// assertionOps are the comparison operators, two-character ones first so
+// that "<=" is not read as "<"
+var assertionOps = []string{"<=", ">=", "<", ">"}
+
+// ParseAssertion parses "<operand> <op> <operand>", where an operand is a
+// benchmark name optionally multiplied by a number ("OldImpl * 0.9") or a
+// plain number. Names containing operators or spaces at the ends can be
+// quoted with double or single quotes.
+func ParseAssertion(expr string) (Assertion, error) {
+	left, op, right, ok := splitAssertion(expr)
+	if !ok {
+		return Assertion{}, fmt.Errorf("invalid requirement %q: expected a comparison such as \"New <= Old * 0.9\"", expr)
+	}
+
+	a := Assertion{Expr: strings.TrimSpace(expr), Op: op}
+	var err error
+	if a.Left, err = parseOperand(left); err != nil {
+		return Assertion{}, fmt.Errorf("invalid requirement %q: %w", expr, err)
+	}
+	if a.Right, err = parseOperand(right); err != nil {
+		return Assertion{}, fmt.Errorf("invalid requirement %q: %w", expr, err)
+	}
+	if a.Left.Name == "" && a.Right.Name == "" {
+		return Assertion{}, fmt.Errorf("invalid requirement %q: no benchmark named", expr)
+	}
+	return a, nil
+}
+
+// splitAssertion splits expr at its comparison operator, skipping quoted
+// text
+func splitAssertion(expr string) (left, op, right string, ok bool) {
+	var quote rune
+	for i, c := range expr {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			for _, candidate := range assertionOps {
+				if strings.HasPrefix(expr[i:], candidate) {
+					return expr[:i], candidate, expr[i+len(candidate):], true
+				}
+			}
+		}
+	}
+	return "", "", "", false
+}
+
+// parseOperand parses a name with an optional "* factor", or a number
+func parseOperand(s string) (Operand, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Operand{}, fmt.Errorf("missing operand")
+	}
+
+	name, factor := s, 1.0
+	if i := strings.LastIndex(s, "*"); i >= 0 && !strings.ContainsAny(s[i:], `"'`) {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+		if err != nil {
+			return Operand{}, fmt.Errorf("invalid factor in %q", s)
+		}
+		name, factor = strings.TrimSpace(s[:i]), f
+	}
+
+	if n := len(name); n >= 2 && (name[0] == '"' || name[0] == '\'') && name[n-1] == name[0] {
+		return Operand{Name: name[1 : n-1], Factor: factor}, nil
+	}
+	if v, err := strconv.ParseFloat(name, 64); err == nil {
+		return Operand{Factor: v * factor}, nil
+	}
+	if name == "" {
+		return Operand{}, fmt.Errorf("missing benchmark name in %q", s)
+	}
+	return Operand{Name: name, Factor: factor}, nil
+}
+
+// MetricValue returns the average a comparison metric reads from a result:
+// "cpu", "wall" or "heap". Heap is only present when it was tracked.
+func MetricValue(metric string) func(types.AggregatedResult) (float64, bool) {
+	switch metric {
+	case "wall":
+		return func(r types.AggregatedResult) (float64, bool) { return r.AvgWallMs, true }
+	case "heap":
+		return func(r types.AggregatedResult) (float64, bool) {
+			if r.AvgHeapKb == nil {
+				return 0, false
+			}
+			return *r.AvgHeapKb, true
+		}
+	default:
+		return func(r types.AggregatedResult) (float64, bool) { return r.AvgCpuMs, true }
+	}
+}
+
+// Names returns the benchmarks the assertion refers to
+func (a Assertion) Names() []string {
+	var names []string
+	for _, o := range []Operand{a.Left, a.Right} {
+		if o.Name != "" {
+			names = append(names, o.Name)
+		}
+	}
+	return names
+}
+
+// Check evaluates the assertion on results, comparing the metric value
+// returned by value. It returns whether it holds and the compared values,
+// e.g. "1.200 <= 1.350". A benchmark without a result fails the assertion.
+func (a Assertion) Check(results []types.AggregatedResult, value func(types.AggregatedResult) (float64, bool)) (bool, string) {
+	left, err := a.Left.eval(results, value)
+	if err != nil {
+		return false, err.Error()
+	}
+	right, err := a.Right.eval(results, value)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	var ok bool
+	switch a.Op {
+	case "<":
+		ok = left < right
+	case "<=":
+		ok = left <= right
+	case ">":
+		ok = left > right
+	case ">=":
+		ok = left >= right
+	}
+	return ok, fmt.Sprintf("%.3f %s %.3f", left, a.Op, right)
+}
+
+// eval returns the operand's value among results
+func (o Operand) eval(results []types.AggregatedResult, value func(types.AggregatedResult) (float64, bool)) (float64, error) {
+	if o.Name == "" {
+		return o.Factor, nil
+	}
+	for _, r := range results {
+		if r.Name != o.Name {
+			continue
+		}
+		if r.Error != "" {
+			return 0, fmt.Errorf("%s failed", o.Name)
+		}
+		v, ok := value(r)
+		if !ok {
+			return 0, fmt.Errorf("%s did not track the metric", o.Name)
+		}
+		return v * o.Factor, nil
+	}
+	return 0, fmt.Errorf("%s has no result", o.Name)
+}
+
+// CheckThresholds records on agg whether it stays within each limit of its
+// budget. Limits on metrics that were not tracked fail, since the budget
+// could not be verified.
+func CheckThresholds(agg *types.AggregatedResult, threshold types.Threshold) {
+	agg.Thresholds = nil
+	check := func(metric string, limit *float64, value *float64) {
+		if limit == nil {
+			return
+		}
+		c := types.ThresholdCheck{Metric: metric, Limit: *limit}
+		if value != nil {
+			c.Value = *value
+			c.Tracked = true
+			c.Pass = *value <= *limit
+		}
+		agg.Thresholds = append(agg.Thresholds, c)
+	}
+	check("maxCpuMs", threshold.MaxCpuMs, &agg.AvgCpuMs)
+	check("maxHeapKb", threshold.MaxHeapKb, agg.AvgHeapKb)
+	check("maxSoql", threshold.MaxSoql, agg.AvgSoqlQueries)
+}
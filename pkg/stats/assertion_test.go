@@ -0,0 +1,101 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipavlic/apex-benchmark-cli/pkg/types"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    Assertion
+		wantErr bool
+	}{
+		{"NewImpl <= OldImpl * 0.9", Assertion{Left: Operand{"NewImpl", 1}, Op: "<=", Right: Operand{"OldImpl", 0.9}}, false},
+		{"New<Old", Assertion{Left: Operand{"New", 1}, Op: "<", Right: Operand{"Old", 1}}, false},
+		{"Map lookup >= 2.5", Assertion{Left: Operand{"Map lookup", 1}, Op: ">=", Right: Operand{"", 2.5}}, false},
+		{`"a<b" > 'c*d' * 2`, Assertion{Left: Operand{"a<b", 1}, Op: ">", Right: Operand{"c*d", 2}}, false},
+		{"New == Old", Assertion{}, true},
+		{"New <= Old * fast", Assertion{}, true},
+		{"1 < 2", Assertion{}, true},
+		{"<= Old", Assertion{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAssertion(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAssertion(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		tt.want.Expr = tt.expr
+		if got != tt.want {
+			t.Errorf("ParseAssertion(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestAssertionCheck(t *testing.T) {
+	heap := 10.0
+	results := []types.AggregatedResult{
+		{Name: "Old", AvgCpuMs: 2.0, AvgWallMs: 3.0, AvgHeapKb: &heap},
+		{Name: "New", AvgCpuMs: 1.5, AvgWallMs: 3.0},
+		{Name: "Broken", Error: "compile error"},
+	}
+
+	tests := []struct {
+		expr   string
+		metric string
+		ok     bool
+		detail string
+	}{
+		{"New <= Old * 0.9", "cpu", true, "1.500 <= 1.800"},
+		{"New <= Old * 0.9", "wall", false, "3.000 <= 2.700"},
+		{"New > 1", "cpu", true, "1.500 > 1.000"},
+		{"New < Old", "heap", false, "New did not track the metric"},
+		{"Broken < Old", "cpu", false, "Broken failed"},
+		{"Missing < Old", "cpu", false, "Missing has no result"},
+	}
+
+	for _, tt := range tests {
+		a, err := ParseAssertion(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseAssertion(%q) error = %v", tt.expr, err)
+		}
+		ok, detail := a.Check(results, MetricValue(tt.metric))
+		if ok != tt.ok || !strings.Contains(detail, tt.detail) {
+			t.Errorf("%q over %s = %v, %q, want %v, %q", tt.expr, tt.metric, ok, detail, tt.ok, tt.detail)
+		}
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	limit := func(v float64) *float64 { return &v }
+	soql := 3.0
+	agg := types.AggregatedResult{AvgCpuMs: 1.5, AvgSoqlQueries: &soql}
+
+	CheckThresholds(&agg, types.Threshold{MaxCpuMs: limit(2), MaxHeapKb: limit(100), MaxSoql: limit(2)})
+
+	want := []types.ThresholdCheck{
+		{Metric: "maxCpuMs", Limit: 2, Value: 1.5, Tracked: true, Pass: true},
+		{Metric: "maxHeapKb", Limit: 100},
+		{Metric: "maxSoql", Limit: 2, Value: 3, Tracked: true},
+	}
+	if len(agg.Thresholds) != len(want) {
+		t.Fatalf("Thresholds = %+v, want %+v", agg.Thresholds, want)
+	}
+	for i := range want {
+		if agg.Thresholds[i] != want[i] {
+			t.Errorf("Thresholds[%d] = %+v, want %+v", i, agg.Thresholds[i], want[i])
+		}
+	}
+
+	CheckThresholds(&agg, types.Threshold{})
+	if agg.Thresholds != nil {
+		t.Errorf("Expected no checks without limits, got %+v", agg.Thresholds)
+	}
+}
@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScalingExponent estimates k in time ≈ c·rows^k by a least-squares fit on
+// the logarithms of both. It needs at least two distinct positive row counts
+// with positive times; ok is false otherwise.
+func ScalingExponent(rows []int, ms []float64) (k float64, ok bool) {
+	var xs, ys []float64
+	for i := range rows {
+		if i < len(ms) && rows[i] > 0 && ms[i] > 0 {
+			xs = append(xs, math.Log(float64(rows[i])))
+			ys = append(ys, math.Log(ms[i]))
+		}
+	}
+	if len(xs) < 2 {
+		return 0, false
+	}
+
+	mx, my := mean(xs), mean(ys)
+	var sxy, sxx float64
+	for i := range xs {
+		sxy += (xs[i] - mx) * (ys[i] - my)
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+	}
+	if sxx == 0 {
+		return 0, false
+	}
+	return sxy / sxx, true
+}
+
+// DescribeScaling puts a scaling exponent into words
+func DescribeScaling(k float64) string {
+	switch {
+	case k < 0.2:
+		return fmt.Sprintf("roughly constant (exponent %.2f)", k)
+	case k < 0.8:
+		return fmt.Sprintf("sublinear (exponent %.2f)", k)
+	case k <= 1.2:
+		return fmt.Sprintf("roughly linear (exponent %.2f)", k)
+	default:
+		return fmt.Sprintf("superlinear (exponent %.2f)", k)
+	}
+}
@@ -0,0 +1,41 @@
+package stats
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestScalingExponent(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []int
+		ms   []float64
+		want float64
+		ok   bool
+	}{
+		{"linear", []int{10, 100, 1000}, []float64{0.1, 1, 10}, 1, true},
+		{"quadratic", []int{10, 100}, []float64{1, 100}, 2, true},
+		{"constant", []int{10, 100, 1000}, []float64{2, 2, 2}, 0, true},
+		{"skips zero times", []int{10, 100, 1000}, []float64{0, 1, 10}, 1, true},
+		{"one point", []int{10}, []float64{1}, 0, false},
+		{"same rows", []int{10, 10}, []float64{1, 2}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ScalingExponent(tt.rows, tt.ms)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("ScalingExponent() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDescribeScaling(t *testing.T) {
+	for k, want := range map[float64]string{0: "constant", 0.5: "sublinear", 1.05: "linear", 2: "superlinear"} {
+		if got := DescribeScaling(k); !strings.Contains(got, want) {
+			t.Errorf("DescribeScaling(%v) = %q, want %q", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package storage uploads reports to archive destinations such as S3 or
+// GCS buckets, chosen by the scheme of a destination URL. Destinations
+// ending in "/" or naming no file are prefixes the report is stored under.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// execCommand is a variable so tests can replace the storage CLIs
+var execCommand = exec.CommandContext
+
+// Writer describes a registered way of storing reports
+type Writer struct {
+	Scheme      string
+	Description string
+	Write       func(ctx context.Context, dest *url.URL, data []byte) error
+}
+
+var (
+	writersMu sync.RWMutex
+	writers   = make(map[string]Writer)
+)
+
+func init() {
+	Register(Writer{
+		Scheme:      "s3",
+		Description: "Amazon S3, with the aws CLI and its configured credentials",
+		Write: func(ctx context.Context, dest *url.URL, data []byte) error {
+			return runCopy(ctx, data, "aws", "s3", "cp", "-", dest.String())
+		},
+	})
+	Register(Writer{
+		Scheme:      "gs",
+		Description: "Google Cloud Storage, with the gcloud CLI and its configured credentials",
+		Write: func(ctx context.Context, dest *url.URL, data []byte) error {
+			return runCopy(ctx, data, "gcloud", "storage", "cp", "-", dest.String())
+		},
+	})
+	Register(Writer{
+		Scheme:      "file",
+		Description: "a local or mounted directory",
+		Write:       writeFile,
+	})
+	for _, scheme := range []string{"http", "https"} {
+		Register(Writer{
+			Scheme:      scheme,
+			Description: "an HTTP PUT, e.g. to a presigned URL or an artifact repository",
+			Write:       put,
+		})
+	}
+}
+
+// Register adds a writer, replacing any registered for the same scheme
+func Register(w Writer) {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+	writers[w.Scheme] = w
+}
+
+// Schemes returns the schemes of all registered writers, sorted
+func Schemes() []string {
+	writersMu.RLock()
+	defer writersMu.RUnlock()
+
+	schemes := make([]string, 0, len(writers))
+	for scheme := range writers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Check verifies that dest is a URL with a registered scheme
+func Check(dest string) error {
+	_, _, err := lookup(dest)
+	return err
+}
+
+// Upload stores data at dest, named name when dest is a prefix, and
+// returns the location written. The location, also in errors, leaves out
+// the query, which holds the signature of presigned URLs.
+func Upload(ctx context.Context, dest, name string, data []byte) (string, error) {
+	u, w, err := lookup(dest)
+	if err != nil {
+		return "", err
+	}
+	if path.Ext(u.Path) == "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	}
+	if err := w.Write(ctx, u, data); err != nil {
+		return "", fmt.Errorf("failed to upload to %s: %w", location(u), err)
+	}
+	return location(u), nil
+}
+
+// location returns u for messages, without its query or password
+func location(u *url.URL) string {
+	shown := *u
+	shown.RawQuery = ""
+	return shown.Redacted()
+}
+
+// lookup parses dest and finds the writer for its scheme
+func lookup(dest string) (*url.URL, Writer, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme == "" {
+		return nil, Writer{}, fmt.Errorf("invalid upload destination %q (expected a URL such as s3://bucket/path)", dest)
+	}
+	if u.Opaque != "" {
+		// file:results/ has no path to store under
+		return nil, Writer{}, fmt.Errorf("invalid upload destination %q (expected // after %s:, e.g. file:///dir)", location(u), u.Scheme)
+	}
+
+	writersMu.RLock()
+	w, ok := writers[u.Scheme]
+	writersMu.RUnlock()
+	if !ok {
+		return nil, Writer{}, fmt.Errorf("unsupported upload destination %q (expected %s)", location(u), strings.Join(Schemes(), ", "))
+	}
+	return u, w, nil
+}
+
+// runCopy pipes data to a storage CLI
+func runCopy(ctx context.Context, data []byte, command string, args ...string) error {
+	cmd := execCommand(ctx, command, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeFile stores data in a local file, creating its directory
+func writeFile(ctx context.Context, dest *url.URL, data []byte) error {
+	p := filepath.FromSlash(dest.Host + dest.Path)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+// put sends data with an HTTP PUT
+func put(ctx context.Context, dest *url.URL, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dest.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The *url.Error names the URL with its query; Upload names it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	return nil
+}
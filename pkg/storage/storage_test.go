@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpload_File(t *testing.T) {
+	dir := t.TempDir()
+	location, err := Upload(context.Background(), "file://"+filepath.ToSlash(dir)+"/reports/", "run.json", []byte(`{"name":"A"}`))
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if !strings.HasSuffix(location, "/reports/run.json") {
+		t.Errorf("Expected the report named under the prefix, got %s", location)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "reports", "run.json"))
+	if err != nil || string(data) != `{"name":"A"}` {
+		t.Errorf("Expected the report in the directory, got %q, %v", data, err)
+	}
+
+	// A destination naming a file is used as is
+	if _, err := Upload(context.Background(), "file://"+filepath.ToSlash(dir)+"/latest.json", "run.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "latest.json")); err != nil {
+		t.Errorf("Expected latest.json, got %v", err)
+	}
+
+	// An opaque URL has no path, so the report would land in the root
+	if _, err := Upload(context.Background(), "file:reports/", "run.json", []byte("{}")); err == nil || !strings.Contains(err.Error(), "file:///") {
+		t.Errorf("Expected file:reports/ to be rejected, got %v", err)
+	}
+}
+
+func TestUpload_HTTP(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+	}))
+	defer server.Close()
+
+	if _, err := Upload(context.Background(), server.URL+"/artifacts", "run.json", []byte("{}")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if method != http.MethodPut || path != "/artifacts/run.json" || body != "{}" {
+		t.Errorf("Unexpected request: %s %s %q", method, path, body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+	if _, err := Upload(context.Background(), failing.URL+"/run.json?X-Amz-Signature=secret", "run.json", nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the status in the error, got %v", err)
+	} else if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected the signature left out of the error, got %v", err)
+	}
+
+	failing.Close()
+	location, err := Upload(context.Background(), failing.URL+"/run.json?X-Amz-Signature=secret", "run.json", nil)
+	if err == nil || strings.Contains(err.Error(), "secret") || location != "" {
+		t.Errorf("Expected a connection error without the signature, got %q, %v", location, err)
+	}
+}
+
+func TestUpload_S3(t *testing.T) {
+	var gotCommand string
+	var gotArgs []string
+	oldExecCommand := execCommand
+	execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		gotCommand, gotArgs = command, args
+		return exec.CommandContext(ctx, "true")
+	}
+	defer func() { execCommand = oldExecCommand }()
+
+	location, err := Upload(context.Background(), "s3://bucket/bench", "run.json", []byte("{}"))
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	want := []string{"s3", "cp", "-", "s3://bucket/bench/run.json"}
+	if gotCommand != "aws" || !reflect.DeepEqual(gotArgs, want) || location != "s3://bucket/bench/run.json" {
+		t.Errorf("Unexpected command: %s %v (%s)", gotCommand, gotArgs, location)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, dest := range []string{"s3://bucket/path", "gs://bucket", "https://example.com/put"} {
+		if err := Check(dest); err != nil {
+			t.Errorf("Check(%q) error = %v", dest, err)
+		}
+	}
+	for _, dest := range []string{"bucket/path", "ftp://host/path", "file:results/"} {
+		if err := Check(dest); err == nil {
+			t.Errorf("Check(%q) expected an error", dest)
+		}
+	}
+}
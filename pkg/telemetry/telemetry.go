@@ -0,0 +1,208 @@
+// Package telemetry records anonymous usage events, only for users who opt
+// in: which command ran, how many executions it started, how long it took
+// and the class of any error. Benchmark code, org names, file paths and
+// error messages are never recorded. Every event is appended to a local log
+// before it is sent, so users can see exactly what is shared.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnvVar turns telemetry on or off, overriding the saved setting
+const EnvVar = "APEX_BENCH_TELEMETRY"
+
+// Endpoint receives events as JSON POSTs. Release builds set it with
+// -ldflags "-X github.com/ipavlic/apex-benchmark-cli/pkg/telemetry.Endpoint=...";
+// when empty, events are only written to the local log.
+var Endpoint string
+
+// sendTimeout limits sending one event, so telemetry never holds up a
+// command noticeably
+const sendTimeout = 2 * time.Second
+
+// Settings are the saved telemetry choices
+type Settings struct {
+	Enabled bool   `json:"enabled"`
+	ID      string `json:"id,omitempty"` // Random install id, created on opting in
+}
+
+// Event is one command invocation
+type Event struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`              // e.g. "compare"
+	Executions int       `json:"executions"`           // Apex executions started
+	DurationMs int64     `json:"durationMs"`           // Wall time of the command
+	ErrorClass string    `json:"errorClass,omitempty"` // e.g. "compile"; empty on success
+	Version    string    `json:"version"`
+	Platform   string    `json:"platform"` // GOOS/GOARCH
+}
+
+// Store keeps the settings and the local event log in a directory
+type Store struct {
+	Dir string
+}
+
+// DefaultStore returns the store in the user's config directory, such as
+// ~/.config/apex-bench on Linux
+func DefaultStore() (Store, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return Store{}, fmt.Errorf("failed to locate the user config directory: %w", err)
+	}
+	return Store{Dir: filepath.Join(dir, "apex-bench")}, nil
+}
+
+// SettingsPath returns the file holding the settings
+func (s Store) SettingsPath() string {
+	return filepath.Join(s.Dir, "telemetry.json")
+}
+
+// LogPath returns the local log of recorded events, one JSON object per line
+func (s Store) LogPath() string {
+	return filepath.Join(s.Dir, "telemetry.log")
+}
+
+// Load returns the saved settings; telemetry is off when none are saved
+func (s Store) Load() (Settings, error) {
+	data, err := os.ReadFile(s.SettingsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, fmt.Errorf("failed to read telemetry settings: %w", err)
+	}
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return Settings{}, fmt.Errorf("invalid telemetry settings %s: %w", s.SettingsPath(), err)
+	}
+	return settings, nil
+}
+
+// Save stores settings, giving them an install id when enabled without one
+func (s Store) Save(settings Settings) (Settings, error) {
+	if settings.Enabled && settings.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return Settings{}, err
+		}
+		settings.ID = id
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return Settings{}, err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return Settings{}, fmt.Errorf("failed to create %s: %w", s.Dir, err)
+	}
+	if err := os.WriteFile(s.SettingsPath(), append(data, '\n'), 0o644); err != nil {
+		return Settings{}, fmt.Errorf("failed to save telemetry settings: %w", err)
+	}
+	return settings, nil
+}
+
+// EnsureID returns settings with an install id, creating and saving one
+// when there is none yet, e.g. when only EnvVar turned telemetry on. The
+// saved opt-in choice is left as it is.
+func (s Store) EnsureID(settings Settings) (Settings, error) {
+	if settings.ID != "" {
+		return settings, nil
+	}
+	id, err := newID()
+	if err != nil {
+		return Settings{}, err
+	}
+	settings.ID = id
+	return s.Save(settings)
+}
+
+// newID returns a random install id, unrelated to the user or machine
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create telemetry id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Enabled reports whether events are recorded and what decided it:
+// DO_NOT_TRACK turns telemetry off, then EnvVar decides, then the saved
+// settings. getenv is os.Getenv outside tests.
+func Enabled(settings Settings, getenv func(string) string) (bool, string, error) {
+	if value := getenv("DO_NOT_TRACK"); value != "" && value != "0" {
+		return false, "DO_NOT_TRACK", nil
+	}
+	switch value := strings.ToLower(strings.TrimSpace(getenv(EnvVar))); value {
+	case "":
+	case "on", "1", "true":
+		return true, EnvVar, nil
+	case "off", "0", "false":
+		return false, EnvVar, nil
+	default:
+		return false, EnvVar, fmt.Errorf("invalid %s %q (expected on or off)", EnvVar, value)
+	}
+	if settings.Enabled {
+		return true, "apex-bench telemetry on", nil
+	}
+	return false, "default", nil
+}
+
+// Record appends event to the local log and sends it to Endpoint, if set
+func (s Store) Record(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.Dir, err)
+	}
+	f, err := os.OpenFile(s.LogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open telemetry log: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write telemetry log: %w", err)
+	}
+
+	if Endpoint == "" {
+		return nil
+	}
+	return send(ctx, Endpoint, data)
+}
+
+// send posts one event to endpoint
+func send(ctx context.Context, endpoint string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send telemetry: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to send telemetry: %s", resp.Status)
+	}
+	return nil
+}
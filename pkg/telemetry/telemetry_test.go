@@ -0,0 +1,139 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_LoadSave(t *testing.T) {
+	store := Store{Dir: t.TempDir()}
+
+	settings, err := store.Load()
+	if err != nil || settings.Enabled {
+		t.Fatalf("Expected telemetry off without settings, got %+v (%v)", settings, err)
+	}
+
+	saved, err := store.Save(Settings{Enabled: true})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if len(saved.ID) != 32 {
+		t.Errorf("Expected a random id on opting in, got %q", saved.ID)
+	}
+
+	// Turning telemetry off and on again keeps the id
+	if _, err := store.Save(Settings{Enabled: false, ID: saved.ID}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil || loaded.Enabled || loaded.ID != saved.ID {
+		t.Errorf("Expected disabled settings with id %q, got %+v (%v)", saved.ID, loaded, err)
+	}
+
+	// An id is created without opting in when only EnvVar enables telemetry
+	other := Store{Dir: t.TempDir()}
+	ensured, err := other.EnsureID(Settings{})
+	if err != nil || len(ensured.ID) != 32 || ensured.Enabled {
+		t.Fatalf("Expected a new id without opting in, got %+v (%v)", ensured, err)
+	}
+	if again, err := other.EnsureID(ensured); err != nil || again.ID != ensured.ID {
+		t.Errorf("Expected the id %q to be kept, got %+v (%v)", ensured.ID, again, err)
+	}
+	if loaded, err := other.Load(); err != nil || loaded != ensured {
+		t.Errorf("Expected %+v to be saved, got %+v (%v)", ensured, loaded, err)
+	}
+
+	if err := os.WriteFile(store.SettingsPath(), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Error("Expected invalid settings to be rejected")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   Settings
+		env        map[string]string
+		wantOn     bool
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "default", wantSource: "default"},
+		{name: "opted in", settings: Settings{Enabled: true}, wantOn: true, wantSource: "apex-bench telemetry on"},
+		{name: "env on", env: map[string]string{EnvVar: "on"}, wantOn: true, wantSource: EnvVar},
+		{name: "env off", settings: Settings{Enabled: true}, env: map[string]string{EnvVar: "off"}, wantSource: EnvVar},
+		{name: "do not track", settings: Settings{Enabled: true}, env: map[string]string{EnvVar: "on", "DO_NOT_TRACK": "1"}, wantSource: "DO_NOT_TRACK"},
+		{name: "do not track 0", env: map[string]string{"DO_NOT_TRACK": "0"}, wantSource: "default"},
+		{name: "invalid env", env: map[string]string{EnvVar: "maybe"}, wantSource: EnvVar, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			on, source, err := Enabled(tt.settings, func(name string) string { return tt.env[name] })
+			if on != tt.wantOn || source != tt.wantSource || (err != nil) != tt.wantErr {
+				t.Errorf("Enabled() = %v, %q, %v; want %v, %q, error %v", on, source, err, tt.wantOn, tt.wantSource, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStore_Record(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	oldEndpoint := Endpoint
+	defer func() { Endpoint = oldEndpoint }()
+
+	store := Store{Dir: t.TempDir()}
+	event := Event{ID: "abc", Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Command: "compare", Executions: 6, DurationMs: 1200, ErrorClass: "compile", Version: "1.0.0", Platform: "linux/amd64"}
+
+	// Without an endpoint events only reach the local log
+	Endpoint = ""
+	if err := store.Record(context.Background(), event); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	Endpoint = server.URL
+	if err := store.Record(context.Background(), event); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	var sent Event
+	if err := json.Unmarshal(received, &sent); err != nil || sent != event {
+		t.Errorf("Expected %+v to be sent, got %s (%v)", event, received, err)
+	}
+	log, err := os.ReadFile(store.LogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(log)), "\n"); len(lines) != 2 || lines[1] != strings.TrimSpace(string(received)) {
+		t.Errorf("Expected both events in the log, got:\n%s", log)
+	}
+}
+
+func TestStore_Record_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	oldEndpoint := Endpoint
+	defer func() { Endpoint = oldEndpoint }()
+	Endpoint = server.URL
+
+	err := Store{Dir: t.TempDir()}.Record(context.Background(), Event{ID: "abc"})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+}
@@ -1,69 +1,308 @@
 package types
 
+import "time"
+
 // CodeSpec defines the input for code generation
 type CodeSpec struct {
-	Name       string
-	UserCode   string
-	Setup      string
-	Teardown   string
-	Iterations int
-	Warmup     int
-	TrackHeap  bool
-	TrackDB    bool
+	Name          string
+	UserCode      string
+	Setup         string
+	Teardown      string
+	Iterations    int
+	Warmup        int
+	BatchSize     int // Iterations timed together per sample; 0 starts at 1 and grows below clock resolution
+	TrackHeap     bool
+	TrackHeapPeak bool // Record the heap high-water mark during measurement
+	TrackDB       bool
+	TrackCache    string   // Platform Cache partition to track, e.g. local.Bench or session:local.Bench; empty disables
+	Namespace     string   // Managed package namespace substituted for namespace tokens
+	Rollback      bool     // Undo the benchmark's DML, including setup, after its result is logged
+	Collectors    []string // Further registered collectors to track, e.g. callouts
+
+	Vars map[string]string // Values substituted for ${NAME} in code, setup and teardown, ahead of the environment
 }
 
 // Result represents the output of a single benchmark run
 type Result struct {
-	Name          string   `json:"name"`
-	Iterations    int      `json:"iterations"`
-	AvgWallMs     float64  `json:"avgWallMs"`
-	AvgCpuMs      float64  `json:"avgCpuMs"`
-	MinWallMs     float64  `json:"minWallMs"`
-	MaxWallMs     float64  `json:"maxWallMs"`
-	MinCpuMs      float64  `json:"minCpuMs"`
-	MaxCpuMs      float64  `json:"maxCpuMs"`
-	AvgHeapKb     *float64 `json:"avgHeapKb,omitempty"`
-	MinHeapKb     *float64 `json:"minHeapKb,omitempty"`
-	MaxHeapKb     *float64 `json:"maxHeapKb,omitempty"`
-	DmlStatements *int     `json:"dmlStatements,omitempty"`
-	SoqlQueries   *int     `json:"soqlQueries,omitempty"`
+	Name          string      `json:"name"`
+	Iterations    int         `json:"iterations"`
+	BatchSize     int         `json:"batchSize,omitempty"`
+	AvgWallMs     float64     `json:"avgWallMs"`
+	AvgCpuMs      float64     `json:"avgCpuMs"`
+	MinWallMs     float64     `json:"minWallMs"`
+	MaxWallMs     float64     `json:"maxWallMs"`
+	MinCpuMs      float64     `json:"minCpuMs"`
+	MaxCpuMs      float64     `json:"maxCpuMs"`
+	TotalWallMs   float64     `json:"totalWallMs,omitempty"`
+	AvgHeapKb     *float64    `json:"avgHeapKb,omitempty"`
+	MinHeapKb     *float64    `json:"minHeapKb,omitempty"`
+	MaxHeapKb     *float64    `json:"maxHeapKb,omitempty"`
+	PeakHeapKb    *float64    `json:"peakHeapKb,omitempty"`  // Highest heap size seen during measurement
+	HeapLimitKb   *float64    `json:"heapLimitKb,omitempty"` // Transaction heap limit
+	DmlStatements *int        `json:"dmlStatements,omitempty"`
+	SoqlQueries   *int        `json:"soqlQueries,omitempty"`
+	DebugOutput   []string    `json:"debugOutput,omitempty"` // User System.debug messages, with --capture-debug
+	LogFile       string      `json:"logFile,omitempty"`     // Saved full log, with --keep-logs
+	Transaction   *LimitUsage `json:"transaction,omitempty"` // Whole-transaction usage from the debug log
+
+	// Aggregate query and async usage, tracked along with DML and SOQL
+	AggregateQueries *int `json:"aggregateQueries,omitempty"`
+	FutureCalls      *int `json:"futureCalls,omitempty"`
+	QueueableJobs    *int `json:"queueableJobs,omitempty"` // System.enqueueJob calls
+
+	// Platform Cache partition usage, with --track-cache
+	CacheKeys        *int     `json:"cacheKeys,omitempty"`        // Keys added during measurement
+	CacheCapacityPct *float64 `json:"cacheCapacityPct,omitempty"` // Change in the share of partition capacity used
+	CacheMissRate    *float64 `json:"cacheMissRate,omitempty"`    // Partition miss rate after measurement
+
+	// Batches below the clock resolution
+	AutoBatched bool `json:"autoBatched,omitempty"` // The harness grew batchSize because batches read 0 ms
+	ZeroBatches int  `json:"zeroBatches,omitempty"` // Batches that read 0 ms CPU without growing the batch size
+
+	Collected map[string]float64 `json:"collected,omitempty"` // Values reported by collectors without result fields of their own
+
+	CustomMetrics map[string]float64 `json:"customMetrics,omitempty"` // BENCH_METRIC:name=value messages of user code, summed by name
+
+	Phases      *PhaseTimings `json:"phases,omitempty"`      // Time spent in setup, warmup, measurement and teardown
+	WarmupCheck *WarmupCheck  `json:"warmupCheck,omitempty"` // First measured iterations against the rest
+}
+
+// WarmupCheck compares the first measured iterations with the rest. Early
+// iterations that are clearly slower mean the warmup was too short for the
+// code to reach a steady state.
+type WarmupCheck struct {
+	EarlyIterations int     `json:"earlyIterations"` // Iterations in the batches starting within the first tenth
+	EarlyAvgCpuMs   float64 `json:"earlyAvgCpuMs"`
+	RestAvgCpuMs    float64 `json:"restAvgCpuMs"`
+	Insufficient    bool    `json:"insufficient,omitempty"` // Set on aggregates when early iterations are significantly slower
 }
 
+// PhaseTimings is the wall and CPU time of each phase of a benchmark's
+// transaction, in milliseconds. Measurement includes harness overhead
+// between batches.
+type PhaseTimings struct {
+	SetupWallMs    float64 `json:"setupWallMs"`
+	SetupCpuMs     float64 `json:"setupCpuMs"`
+	WarmupWallMs   float64 `json:"warmupWallMs"`
+	WarmupCpuMs    float64 `json:"warmupCpuMs"`
+	MeasureWallMs  float64 `json:"measureWallMs"`
+	MeasureCpuMs   float64 `json:"measureCpuMs"`
+	TeardownWallMs float64 `json:"teardownWallMs"`
+	TeardownCpuMs  float64 `json:"teardownCpuMs"`
+}
+
+// LimitUsage is a transaction's governor limit usage as reported in the
+// CUMULATIVE_LIMIT_USAGE section of the debug log. Unlike the harness
+// numbers it includes setup, warmup, teardown and harness overhead.
+type LimitUsage struct {
+	CpuTimeMs     int `json:"cpuTimeMs"`
+	HeapBytes     int `json:"heapBytes"`
+	SoqlQueries   int `json:"soqlQueries"`
+	QueryRows     int `json:"queryRows"`
+	DmlStatements int `json:"dmlStatements"`
+	DmlRows       int `json:"dmlRows"`
+}
+
+// SchemaVersion is the version of the JSON result format. It changes when
+// fields are removed or change meaning; added fields keep the version.
+const SchemaVersion = "1"
+
 // AggregatedResult combines multiple Results with statistics
 type AggregatedResult struct {
-	Name         string   `json:"name"`
-	Runs         int      `json:"runs"`
-	Iterations   int      `json:"iterations"`
-	Warmup       int      `json:"warmup"`
-	AvgCpuMs     float64  `json:"avgCpuMs"`
-	StdDevCpuMs  float64  `json:"stdDevCpuMs"`
-	MinCpuMs     float64  `json:"minCpuMs"`
-	MaxCpuMs     float64  `json:"maxCpuMs"`
-	AvgWallMs    float64  `json:"avgWallMs"`
-	StdDevWallMs float64  `json:"stdDevWallMs"`
-	MinWallMs    float64  `json:"minWallMs"`
-	MaxWallMs    float64  `json:"maxWallMs"`
-	RawResults   []Result `json:"raw,omitempty"`
+	SchemaVersion string `json:"schemaVersion"`
+
+	Name         string  `json:"name"`
+	Error        string  `json:"error,omitempty"` // Why the benchmark failed, with --keep-going
+	Runs         int     `json:"runs"`
+	FailedRuns   int     `json:"failedRuns,omitempty"` // Runs left out with --min-successful-runs
+	Partial      bool    `json:"partial,omitempty"`    // Interrupted before every run finished
+	Iterations   int     `json:"iterations"`
+	Warmup       int     `json:"warmup"`
+	Aggregation  string  `json:"aggregation,omitempty"` // Strategy used to combine runs
+	APIVersion   string  `json:"apiVersion,omitempty"`  // API version requested with --api-version
+	Namespace    string  `json:"namespace,omitempty"`   // Managed package namespace, with --namespace
+	AvgCpuMs     float64 `json:"avgCpuMs"`
+	StdDevCpuMs  float64 `json:"stdDevCpuMs"`
+	CI95CpuMs    float64 `json:"ci95CpuMs"`       // Half-width of the 95% confidence interval of the mean; 0 unless aggregated by mean
+	CVCpu        float64 `json:"cvCpu"`           // Coefficient of variation of run CPU averages
+	Noisy        bool    `json:"noisy,omitempty"` // Run-to-run variation exceeds the noise threshold
+	MinCpuMs     float64 `json:"minCpuMs"`
+	MaxCpuMs     float64 `json:"maxCpuMs"`
+	AvgWallMs    float64 `json:"avgWallMs"`
+	StdDevWallMs float64 `json:"stdDevWallMs"`
+	CI95WallMs   float64 `json:"ci95WallMs"` // Half-width of the 95% confidence interval of the mean; 0 unless aggregated by mean
+	MinWallMs    float64 `json:"minWallMs"`
+	MaxWallMs    float64 `json:"maxWallMs"`
+	// Heap and DB statistics, present only when tracking was enabled
+	AvgHeapKb        *float64 `json:"avgHeapKb,omitempty"`
+	StdDevHeapKb     *float64 `json:"stdDevHeapKb,omitempty"`
+	MinHeapKb        *float64 `json:"minHeapKb,omitempty"`
+	MaxHeapKb        *float64 `json:"maxHeapKb,omitempty"`
+	PeakHeapKb       *float64 `json:"peakHeapKb,omitempty"`       // Highest heap high-water mark across runs
+	PeakHeapPct      *float64 `json:"peakHeapPct,omitempty"`      // PeakHeapKb as a percentage of the heap limit
+	AvgDmlStatements *float64 `json:"avgDmlStatements,omitempty"` // Per run
+	AvgSoqlQueries   *float64 `json:"avgSoqlQueries,omitempty"`   // Per run
+	// Per-run aggregate query and async usage, tracked along with DML and SOQL
+	AvgAggregateQueries *float64 `json:"avgAggregateQueries,omitempty"`
+	AvgFutureCalls      *float64 `json:"avgFutureCalls,omitempty"`
+	AvgQueueableJobs    *float64 `json:"avgQueueableJobs,omitempty"`
+	// Transaction totals from CUMULATIVE_LIMIT_USAGE, when the log has them
+	TransactionCpuMs       float64  `json:"transactionCpuMs,omitempty"`       // Mean across runs
+	UnmeasuredCpuMs        float64  `json:"unmeasuredCpuMs,omitempty"`        // Mean CPU spent outside measured iterations
+	TransactionHeapBytes   int      `json:"transactionHeapBytes,omitempty"`   // Maximum across runs
+	TransactionSoqlQueries int      `json:"transactionSoqlQueries,omitempty"` // Maximum across runs
+	RawResults             []Result `json:"raw,omitempty"`
+	RawCount               int      `json:"rawCount,omitempty"` // Runs left out of raw by a summary
+
+	// Wall time against CPU time; wall time far above CPU time is spent
+	// waiting on the database, callouts or the platform rather than in Apex
+	WallCpuRatio float64 `json:"wallCpuRatio,omitempty"` // AvgWallMs / AvgCpuMs
+	WaitBound    bool    `json:"waitBound,omitempty"`    // WallCpuRatio reaches the wait-bound ratio
+
+	// Batching below the clock resolution
+	AutoBatchSize int `json:"autoBatchSize,omitempty"` // Largest batch size the harness grew to across runs
+	ZeroBatches   int `json:"zeroBatches,omitempty"`   // Batches that read 0 ms CPU, summed across runs
+
+	Collected map[string]float64 `json:"collected,omitempty"` // Mean of each collected value across the runs reporting it
+
+	// BENCH_METRIC values of user code across the runs reporting them
+	CustomMetrics      map[string]float64 `json:"customMetrics,omitempty"`      // Mean per run
+	CustomMetricTotals map[string]float64 `json:"customMetricTotals,omitempty"` // Sum over runs
+
+	Phases      *PhaseTimings     `json:"phases,omitempty"`      // Mean time of each phase across runs
+	WarmupCheck *WarmupCheck      `json:"warmupCheck,omitempty"` // Mean early and remaining iteration CPU across runs
+	Invocations *InvocationTiming `json:"invocations,omitempty"` // Executions of the benchmark against the Apex time inside them
+
+	QueryPlans []QueryPlan `json:"queryPlans,omitempty"` // Plans of the benchmark's SOQL queries, with --query-plan
+	Rows       int         `json:"rows,omitempty"`       // Records seeded before measuring, in scale mode
+
+	// Per-run Platform Cache partition usage, with --track-cache
+	AvgCacheKeys        *float64 `json:"avgCacheKeys,omitempty"`
+	AvgCacheCapacityPct *float64 `json:"avgCacheCapacityPct,omitempty"`
+	CacheMissRate       *float64 `json:"cacheMissRate,omitempty"` // Mean across runs
+
+	// Times per unit of work, when every compared benchmark declares units
+	Units         float64 `json:"units,omitempty"` // Units processed per iteration
+	CpuMsPerUnit  float64 `json:"cpuMsPerUnit,omitempty"`
+	WallMsPerUnit float64 `json:"wallMsPerUnit,omitempty"`
+
+	Thresholds []ThresholdCheck `json:"thresholds,omitempty"` // Budget outcomes, when the config sets thresholds
+	Pacing     *Pacing          `json:"pacing,omitempty"`     // Pauses between executions, with a delay
+
+	// Identity of the measured script and settings, with the result cache
+	CacheKey   string     `json:"cacheKey,omitempty"`
+	CachedFrom *time.Time `json:"cachedFrom,omitempty"` // When the result was measured, if served from the cache
+}
+
+// Pacing records the pauses inserted between executions with a delay
+type Pacing struct {
+	DelayMs    float64 `json:"delayMs"`
+	JitterMs   float64 `json:"jitterMs,omitempty"`
+	Pauses     int     `json:"pauses"`     // Pauses taken before the benchmark's executions
+	AvgPauseMs float64 `json:"avgPauseMs"` // Effective length of those pauses, jitter included
+}
+
+// InvocationTiming compares the wall time of executions, as seen by
+// apex-bench, with the Apex time inside them: the setup, warmup,
+// measurement and teardown of the transaction. The rest is harness
+// overhead, such as CLI startup, authentication, compilation, network and
+// log retrieval. A combined script counts once, with the Apex time of
+// every benchmark in it.
+type InvocationTiming struct {
+	Invocations int     `json:"invocations"` // Successful executions timed
+	TotalMs     float64 `json:"totalMs"`     // Wall time of the executions
+	ApexMs      float64 `json:"apexMs"`      // Apex time inside them
+	OverheadMs  float64 `json:"overheadMs"`  // TotalMs less ApexMs
+}
+
+// Threshold is the performance budget of one benchmark. Limits left unset
+// are not checked.
+type Threshold struct {
+	MaxCpuMs  *float64 `yaml:"maxCpuMs,omitempty"`
+	MaxHeapKb *float64 `yaml:"maxHeapKb,omitempty"` // Needs trackHeap
+	MaxSoql   *float64 `yaml:"maxSoql,omitempty"`   // SOQL queries per run; needs trackDB
+}
+
+// ThresholdCheck is the outcome of checking one budget limit
+type ThresholdCheck struct {
+	Metric  string  `json:"metric"` // maxCpuMs, maxHeapKb or maxSoql
+	Limit   float64 `json:"limit"`
+	Value   float64 `json:"value"`
+	Tracked bool    `json:"tracked"` // The metric was measured; Value is 0 and the check fails otherwise
+	Pass    bool    `json:"pass"`
+}
+
+// QueryPlan is the query optimizer's preferred plan for one SOQL query, as
+// returned by the REST API's explain resource
+type QueryPlan struct {
+	Query              string   `json:"query"`
+	LeadingOperation   string   `json:"leadingOperation"` // e.g. Index, TableScan, Sharing
+	SobjectType        string   `json:"sobjectType,omitempty"`
+	RelativeCost       float64  `json:"relativeCost"`       // Above 1 the query is not selective
+	Cardinality        int      `json:"cardinality"`        // Estimated rows returned
+	SobjectCardinality int      `json:"sobjectCardinality"` // Estimated rows in the object
+	Notes              []string `json:"notes,omitempty"`    // Optimizer notes, e.g. unindexed filters
 }
 
 // BenchmarkConfig represents configuration loaded from file
 type BenchmarkConfig struct {
-	Benchmarks []BenchmarkSpec `yaml:"benchmarks"`
-	Iterations int             `yaml:"iterations"`
-	Warmup     int             `yaml:"warmup"`
-	Runs       int             `yaml:"runs"`
-	Parallel   int             `yaml:"parallel"`
-	TrackHeap  bool            `yaml:"trackHeap"`
-	TrackDB    bool            `yaml:"trackDB"`
-	Org        string          `yaml:"org"`
-	Output     string          `yaml:"output"`
+	Benchmarks     []BenchmarkSpec `yaml:"benchmarks"`
+	Iterations     int             `yaml:"iterations"`
+	Warmup         int             `yaml:"warmup"`
+	BatchSize      int             `yaml:"batchSize"`
+	Runs           int             `yaml:"runs"`
+	Parallel       int             `yaml:"parallel"`
+	Timeout        time.Duration   `yaml:"timeout"` // Limit for a single execution; 0 means none
+	TrackHeap      bool            `yaml:"trackHeap"`
+	TrackHeapPeak  bool            `yaml:"trackHeapPeak"`
+	TrackDB        bool            `yaml:"trackDB"`
+	TrackCache     string          `yaml:"trackCache"` // Platform Cache partition, e.g. local.Bench or session:local.Bench
+	Collectors     []string        `yaml:"collectors"` // Further registered collectors to track, e.g. callouts
+	Combine        bool            `yaml:"combine"`
+	KeepGoing      bool            `yaml:"keepGoing"`         // Run every benchmark of a comparison even if one fails
+	MinSuccessful  int             `yaml:"minSuccessfulRuns"` // Aggregate successful runs if at least this many; 0 requires all
+	QueryPlan      bool            `yaml:"queryPlan"`         // Fetch plans of inline SOQL queries; needs TrackDB
+	CaptureDebug   bool            `yaml:"captureDebug"`
+	DebugLogDir    string          `yaml:"debugLogDir"`
+	KeepLogs       string          `yaml:"keepLogs"`       // Directory for full per-run logs
+	Aggregate      string          `yaml:"aggregate"`      // mean, median, min or trimmed-mean
+	NoiseThreshold float64         `yaml:"noiseThreshold"` // Percent CV above which results are noisy
+	Org            string          `yaml:"org"`
+	APIVersion     string          `yaml:"apiVersion"` // e.g. "62.0"; empty uses the org default
+	Namespace      string          `yaml:"namespace"`  // Managed package namespace for namespace tokens
+	Metrics        string          `yaml:"metrics"`    // Metric groups shown in tables, e.g. "cpu,wall"
+	ShowRuns       bool            `yaml:"showRuns"`   // Tables also list each run of every benchmark
+	RelativeTo     string          `yaml:"relativeTo"` // Metric comparisons are ranked by: cpu, wall or heap
+	Baseline       string          `yaml:"baseline"`   // Benchmark multipliers are computed against; empty uses the fastest
+	Require        []string        `yaml:"require"`    // Conditions over averages such as "New <= Old * 0.9"
+	PerUnits       float64         `yaml:"perUnits"`   // Units per-unit times are shown for, e.g. 1000; 0 means 1
+	Output         string          `yaml:"output"`
+	Outputs        []string        `yaml:"outputs"` // Several reports as "format" or "format:path"; overrides Output
+	Out            string          `yaml:"out"`     // File to write results to instead of stdout
+	Raw            string          `yaml:"raw"`     // Per-run results in JSON output: full, summary or none
+
+	Thresholds map[string]Threshold `yaml:"thresholds"` // Budgets by benchmark name
+	Vars       map[string]string    `yaml:"vars"`       // Values of ${NAME} references in benchmark code, ahead of the environment
+	Priority   int                  `yaml:"priority"`   // Executions with higher priorities start first when they queue
+	Delay      time.Duration        `yaml:"delay"`      // Pause between executions; 0 means none
+	Jitter     time.Duration        `yaml:"jitter"`     // Random variation of Delay, up to this much either way
+	History    string               `yaml:"history"`    // JSON Lines file each session's results are appended to
+
+	Cache       bool          `yaml:"cache"`       // Serve unchanged benchmarks from History instead of running them
+	CacheMaxAge time.Duration `yaml:"cacheMaxAge"` // Oldest cached result served; 0 means 24h
+	// Benchmarks served from their latest result in History instead of
+	// running, such as those unchanged since a git ref
+	Unchanged []string `yaml:"-"`
 }
 
 // BenchmarkSpec defines a single benchmark in config file
 type BenchmarkSpec struct {
-	Name     string `yaml:"name"`
-	File     string `yaml:"file,omitempty"`
-	Code     string `yaml:"code,omitempty"`
-	Setup    string `yaml:"setup,omitempty"`
-	Teardown string `yaml:"teardown,omitempty"`
+	Name     string   `yaml:"name"`
+	File     string   `yaml:"file,omitempty"`
+	Fence    int      `yaml:"fence,omitempty"` // Apex code fence of a Markdown File, from 1; 0 takes its only one
+	Code     string   `yaml:"code,omitempty"`
+	Setup    string   `yaml:"setup,omitempty"`
+	Teardown string   `yaml:"teardown,omitempty"`
+	Tags     []string `yaml:"tags,omitempty"`  // Labels for selecting benchmarks with --tags and --skip-tags
+	Units    float64  `yaml:"units,omitempty"` // Units of work, e.g. records, processed per iteration
 }